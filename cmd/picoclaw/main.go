@@ -9,35 +9,57 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/subtle"
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/sipeed/picoclaw/pkg/agent"
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/calendar"
 	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/chatimport"
+	"github.com/sipeed/picoclaw/pkg/cloudsync"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/devices"
+	"github.com/sipeed/picoclaw/pkg/eval"
+	"github.com/sipeed/picoclaw/pkg/expiry"
+	"github.com/sipeed/picoclaw/pkg/feeds"
 	"github.com/sipeed/picoclaw/pkg/health"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/migrate"
+	"github.com/sipeed/picoclaw/pkg/privacy"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/trace"
+	"github.com/sipeed/picoclaw/pkg/tunnel"
+	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
+	"github.com/sipeed/picoclaw/pkg/webhooksig"
 )
 
 //go:generate cp -r ../../workspace .
@@ -119,7 +141,30 @@ func copyDirectory(src, dst string) error {
 	})
 }
 
+// configProfile is the config profile selected with --profile
+var configProfile string
+
+// takeProfileFlag removes --profile <name> or --profile=<name> from args,
+// which any command accepts, and returns the profile
+func takeProfileFlag(args []string) ([]string, string) {
+	profile := ""
+	kept := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--profile" && i+1 < len(args):
+			profile = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--profile="):
+			profile = strings.TrimPrefix(args[i], "--profile=")
+		default:
+			kept = append(kept, args[i])
+		}
+	}
+	return kept, profile
+}
+
 func main() {
+	os.Args, configProfile = takeProfileFlag(os.Args)
 	if len(os.Args) < 2 {
 		printHelp()
 		os.Exit(1)
@@ -142,6 +187,16 @@ func main() {
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "debuglog":
+		debugLogCmd()
+	case "config":
+		configCmd()
+	case "webhook-key":
+		webhookKeyCmd()
+	case "import":
+		importCmd()
+	case "eval":
+		evalCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -211,9 +266,17 @@ func printHelp() {
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  config      Validate, migrate or encrypt the config, or print its options")
+	fmt.Println("  debuglog    Decrypt the provider debug log")
+	fmt.Println("  eval        Run a suite of test prompts and report regressions")
+	fmt.Println("  import      Import chat history from WhatsApp or Telegram exports")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
+	fmt.Println("  webhook-key Generate or rotate webhook signing keys")
 	fmt.Println("  version     Show version information")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --profile <name>  Apply a profile of the config file (or set PICOCLAW_PROFILE)")
 }
 
 func onboard() {
@@ -399,11 +462,17 @@ func agentCmd() {
 		os.Exit(1)
 	}
 
+	enablePrivacy(cfg)
+	providers.ConfigureHTTP(cfg.ProviderHTTP)
 	provider, err := providers.CreateProvider(cfg)
 	if err != nil {
 		fmt.Printf("Error creating provider: %v\n", err)
 		os.Exit(1)
 	}
+	if cfg.ProviderHTTP.Prewarm {
+		go warmUpProvider(provider)
+	}
+	checkConfiguredModel(provider, cfg.Agents.Defaults.Model)
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
@@ -534,13 +603,25 @@ func gatewayCmd() {
 		os.Exit(1)
 	}
 
+	enablePrivacy(cfg)
+	providers.ConfigureHTTP(cfg.ProviderHTTP)
 	provider, err := providers.CreateProvider(cfg)
 	if err != nil {
 		fmt.Printf("Error creating provider: %v\n", err)
 		os.Exit(1)
 	}
+	if cfg.ProviderHTTP.Prewarm {
+		go warmUpProvider(provider)
+	}
+	if check := checkConfiguredModel(provider, cfg.Agents.Defaults.Model); check.Supported {
+		fmt.Printf("Model %s: %s\n", cfg.Agents.Defaults.Model, check)
+	}
 
-	msgBus := bus.NewMessageBus()
+	msgBus, err := newMessageBus(cfg)
+	if err != nil {
+		fmt.Printf("Error setting up the message bus: %v\n", err)
+		os.Exit(1)
+	}
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
 
 	// Print agent startup info
@@ -564,6 +645,16 @@ func gatewayCmd() {
 	// Setup cron tool and service
 	execTimeout := time.Duration(cfg.Tools.Cron.ExecTimeoutMinutes) * time.Minute
 	cronService := setupCronTool(agentLoop, msgBus, cfg.WorkspacePath(), cfg.Agents.Defaults.RestrictToWorkspace, execTimeout)
+	if cfg.CronBatch.Enabled {
+		cronService.SetBatching(cron.BatchOptions{
+			MaxConcurrent: cfg.CronBatch.MaxConcurrent,
+			MinInterval:   time.Duration(cfg.CronBatch.MinIntervalMS) * time.Millisecond,
+			Spread:        time.Duration(cfg.CronBatch.SpreadSeconds) * time.Second,
+		})
+	}
+	if err := setupScheduledPrompts(cronService, cfg.ScheduledPrompts); err != nil {
+		fmt.Printf("Error loading scheduled prompts: %v\n", err)
+	}
 
 	heartbeatService := heartbeat.NewHeartbeatService(
 		cfg.WorkspacePath(),
@@ -589,6 +680,11 @@ func gatewayCmd() {
 		return tools.SilentResult(response)
 	})
 
+	// Webhook channels need the public URL when they are created
+	publicTunnel := startTunnel(cfg)
+	publicURL := publicBaseURL(cfg, publicTunnel)
+	applyPublicURL(cfg, publicURL)
+
 	channelManager, err := channels.NewManager(cfg, msgBus)
 	if err != nil {
 		fmt.Printf("Error creating channel manager: %v\n", err)
@@ -598,33 +694,47 @@ func gatewayCmd() {
 	// Inject channel manager into agent loop for command handling
 	agentLoop.SetChannelManager(channelManager)
 
-	var transcriber *voice.GroqTranscriber
-	if cfg.Providers.Groq.APIKey != "" {
+	var transcriber voice.Transcriber
+	if cfg.Privacy.LocalOnly {
+		// Only a Whisper server on the local network may hear voice messages
+		if base := cfg.Providers.OpenAI.APIBase; base != "" && privacy.IsLocalURL(base, cfg.Privacy.AllowHosts) {
+			transcriber = providers.NewWhisperTranscriber(cfg.Providers.OpenAI.APIKey, base, "", cfg.Providers.OpenAI.Proxy)
+			logger.InfoCF("voice", "Local Whisper voice transcription enabled", map[string]interface{}{"api_base": base})
+		} else {
+			logger.InfoC("voice", "Voice transcription disabled in local-only mode without a local Whisper server")
+		}
+	} else if cfg.Providers.Groq.APIKey != "" {
 		transcriber = voice.NewGroqTranscriber(cfg.Providers.Groq.APIKey)
 		logger.InfoC("voice", "Groq voice transcription enabled")
+	} else if cfg.Providers.OpenAI.APIKey != "" {
+		transcriber = providers.NewWhisperTranscriber(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase, "", cfg.Providers.OpenAI.Proxy)
+		logger.InfoC("voice", "Whisper voice transcription enabled")
 	}
 
 	if transcriber != nil {
-		if telegramChannel, ok := channelManager.GetChannel("telegram"); ok {
-			if tc, ok := telegramChannel.(*channels.TelegramChannel); ok {
-				tc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Telegram channel")
-			}
-		}
-		if discordChannel, ok := channelManager.GetChannel("discord"); ok {
-			if dc, ok := discordChannel.(*channels.DiscordChannel); ok {
-				dc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Discord channel")
+		for _, name := range []string{"telegram", "discord", "slack", "whatsapp"} {
+			channel, ok := channelManager.GetChannel(name)
+			if !ok {
+				continue
 			}
-		}
-		if slackChannel, ok := channelManager.GetChannel("slack"); ok {
-			if sc, ok := slackChannel.(*channels.SlackChannel); ok {
-				sc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Slack channel")
+			if tc, ok := channel.(interface{ SetTranscriber(voice.Transcriber) }); ok {
+				tc.SetTranscriber(transcriber)
+				logger.InfoCF("voice", "Transcription attached to channel", map[string]interface{}{
+					"channel": name,
+				})
 			}
 		}
 	}
 
+	// Incoming files are kept in the workspace, so the agent can use them
+	// after the message is handled
+	channelManager.SetMediaDir(filepath.Join(cfg.WorkspacePath(), "media"))
+
+	// Replies already sent are not sent again after a crash and restart
+	if err := channelManager.SetIdempotencyFile(filepath.Join(cfg.WorkspacePath(), "channels", "sent_keys.jsonl")); err != nil {
+		fmt.Printf("Warning: idempotency keys kept in memory only: %v\n", err)
+	}
+
 	enabledChannels := channelManager.GetEnabledChannels()
 	if len(enabledChannels) > 0 {
 		fmt.Printf("✓ Channels enabled: %s\n", enabledChannels)
@@ -660,17 +770,104 @@ func gatewayCmd() {
 		fmt.Println("✓ Device event service started")
 	}
 
+	var workspaceSync *cloudsync.Service
+	if cfg.WorkspaceSync.Enabled {
+		workspaceSync, err = cloudsync.NewService(cfg.WorkspaceSync, cfg.WorkspacePath())
+		if err != nil {
+			fmt.Printf("Error enabling workspace sync: %v\n", err)
+		} else {
+			workspaceSync.Start(ctx)
+			fmt.Printf("✓ Workspace sync started (%s)\n", cfg.WorkspaceSync.Backend)
+		}
+	}
+
+	if publicTunnel != nil && cfg.Gateway.PublicURL == "" {
+		publicTunnel.OnChange(func(publicURL string) {
+			channelManager.SetPublicURL(ctx, publicURL)
+		})
+	}
 	if err := channelManager.StartAll(ctx); err != nil {
 		fmt.Printf("Error starting channels: %v\n", err)
 	}
+	if err := cronService.StoreErr(); err != nil {
+		fmt.Printf("⚠ Warning: scheduled jobs are paused: %v\n", err)
+		alertOwner(msgBus, stateManager, fmt.Sprintf("Scheduled jobs are paused because the job store is corrupt (%v). Repair or remove %s to resume them.", err, filepath.Join(cfg.WorkspacePath(), "cron", "jobs.json")))
+	}
+	if err := agentLoop.SessionStoreErr(); err != nil {
+		fmt.Printf("⚠ Warning: session store unavailable, running memoryless: %v\n", err)
+	}
+	if err := channelManager.MediaErr(); err != nil {
+		fmt.Printf("⚠ Warning: media storage unavailable, channels are text-only: %v\n", err)
+	}
 
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
+	adminToken := cfg.Gateway.AdminToken
+	if adminToken == "" {
+		adminToken = cfg.Gateway.ChatToken
+	}
+	healthServer.SetAdminToken(adminToken)
+	if err := configureGateway(healthServer, cfg.Gateway); err != nil {
+		fmt.Printf("Error configuring gateway: %v\n", err)
+		os.Exit(1)
+	}
+	for _, name := range channelManager.GetEnabledChannels() {
+		if channel, ok := channelManager.GetChannel(name); ok {
+			healthServer.RegisterLiveCheck("channel:"+name, func() (bool, string) {
+				h := channel.Health()
+				return h.State.Ready(), h.String()
+			})
+		}
+	}
+	healthServer.RegisterDegradation("sessions", health.ModeMemoryless, agentLoop.SessionStoreErr)
+	healthServer.RegisterDegradation("scheduler", health.ModePaused, cronService.StoreErr)
+	healthServer.RegisterDegradation("media", health.ModeTextOnly, channelManager.MediaErr)
+	for path, handler := range channelManager.WebhookHandlers() {
+		healthServer.Handle(path, handler)
+	}
+	healthServer.HandleAdmin("/admin/config-schema", http.HandlerFunc(serveConfigSchema))
+
+	toolNames, _ := toolsInfo["names"].([]string)
+	about := newAboutInfo(cfg, channelManager.GetEnabledChannels(), toolNames, stateManager)
+	printAbout(about)
+	healthServer.HandleAdmin("/admin/about", serveAbout(about))
+	deadLetters := serveDeadLetters(msgBus)
+	healthServer.HandleAdmin("/admin/dead-letters", deadLetters)
+	healthServer.HandleAdmin("/admin/dead-letters/", deadLetters)
+	healthServer.HandleAdmin("/debug/bus", serveBusStats(msgBus, channelManager))
+	if cfg.Gateway.ChatToken != "" {
+		healthServer.Handle("/api/chat", serveChat(msgBus, cfg.Gateway.ChatToken))
+	}
+	if cfg.ExpiryMonitor.Enabled {
+		monitor := newExpiryMonitor(cfg, msgBus, stateManager)
+		agentLoop.SetExpiryMonitor(monitor)
+		healthServer.HandleAdmin("/admin/expiry", monitor)
+		go monitor.Run(ctx)
+		fmt.Printf("✓ Expiry monitor watching %d certificates and tokens\n", monitor.Len())
+	}
+	if cfg.CalendarFeed.Enabled {
+		horizon := time.Duration(cfg.CalendarFeed.HorizonDays) * 24 * time.Hour
+		feed, err := calendar.NewFeed(cronService, cfg.CalendarFeed.Secret, horizon)
+		if err != nil {
+			fmt.Printf("Error enabling calendar feed: %v\n", err)
+		} else {
+			healthServer.Handle(calendar.PathPrefix, feed)
+			fmt.Printf("✓ Calendar feed available at %s://%s:%d%s\n", healthServer.Scheme(), cfg.Gateway.Host, cfg.Gateway.Port, feed.Path())
+		}
+	}
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("health", "Health server error", map[string]interface{}{"error": err.Error()})
 		}
 	}()
-	fmt.Printf("✓ Health endpoints available at http://%s:%d/health and /ready\n", cfg.Gateway.Host, cfg.Gateway.Port)
+	fmt.Printf("✓ Health endpoints available at %s://%s:%d/health and /ready\n", healthServer.Scheme(), cfg.Gateway.Host, cfg.Gateway.Port)
+
+	// Facebook calls the webhook back while it is registered, so this
+	// waits for the gateway to serve. The tunnel's URL may have changed
+	// since the channels were created.
+	go func() {
+		channelManager.SetPublicURL(ctx, publicBaseURL(cfg, publicTunnel))
+		channelManager.RunWebhookChecks(ctx)
+	}()
 
 	go agentLoop.Run(ctx)
 
@@ -679,16 +876,111 @@ func gatewayCmd() {
 	<-sigChan
 
 	fmt.Println("\nShutting down...")
-	cancel()
-	healthServer.Stop(context.Background())
+	// Stop producing new work, then let accepted messages finish. A second
+	// interrupt skips the wait.
 	deviceService.Stop()
 	heartbeatService.Stop()
 	cronService.Stop()
+	if workspaceSync != nil {
+		workspaceSync.Stop()
+	}
+	drainCtx, stopDrain := context.WithCancel(context.Background())
+	go func() {
+		<-sigChan
+		stopDrain()
+	}()
+	if err := channelManager.Drain(drainCtx); err != nil {
+		fmt.Printf("⚠ Shutting down with pending messages: %v\n", err)
+	}
+	stopDrain()
+
+	cancel()
+	healthServer.Stop(context.Background())
 	agentLoop.Stop()
 	channelManager.StopAll(ctx)
+	if publicTunnel != nil {
+		publicTunnel.Stop()
+	}
+	msgBus.Close()
 	fmt.Println("✓ Gateway stopped")
 }
 
+// enablePrivacy turns on local-only mode when configured. From then on the
+// providers and the agent's web clients fail instead of reaching a host
+// outside the local network.
+func enablePrivacy(cfg *config.Config) {
+	if !cfg.Privacy.LocalOnly {
+		return
+	}
+	privacy.Enable(cfg.Privacy.AllowHosts)
+	webTools := "disabled"
+	if cfg.Privacy.WebProxy != "" {
+		webTools = "through " + cfg.Privacy.WebProxy
+	}
+	fmt.Printf("🔒 Local-only mode: inference stays on the local network, web tools %s\n", webTools)
+	logger.InfoCF("privacy", "Local-only mode enabled", map[string]interface{}{
+		"allow_hosts": strings.Join(cfg.Privacy.AllowHosts, ","),
+		"web_tools":   webTools,
+	})
+}
+
+// newMessageBus returns the gateway's message bus, sized and kept in the
+// journal as the bus config says
+func newMessageBus(cfg *config.Config) (*bus.MessageBus, error) {
+	opts := bus.Options{
+		QueueSize:     cfg.Bus.QueueSize,
+		Overflow:      bus.OverflowPolicy(cfg.Bus.Overflow),
+		HighWatermark: cfg.Bus.HighWatermark,
+		LowWatermark:  cfg.Bus.LowWatermark,
+	}
+	if cfg.Bus.Persistence == bus.PersistenceFile {
+		opts.JournalPath = cfg.Bus.Path
+		if opts.JournalPath == "" {
+			opts.JournalPath = filepath.Join(cfg.WorkspacePath(), "bus", "journal.db")
+		}
+		opts.SyncWrites = cfg.Bus.Sync
+	}
+	if cfg.Bus.Broker == "redis" {
+		broker, err := bus.NewRedisBroker(cfg.Bus.BrokerURL, cfg.Bus.BrokerConsumer)
+		if err != nil {
+			return nil, err
+		}
+		opts.Broker = broker
+		opts.BrokerRole = cfg.Bus.BrokerRole
+		opts.BrokerPrefix = cfg.Bus.BrokerPrefix
+	}
+	return bus.NewMessageBusWithOptions(opts)
+}
+
+// checkConfiguredModel asks the provider whether it serves the configured
+// model and warns with close matches when it does not.
+func checkConfiguredModel(provider providers.LLMProvider, model string) providers.ModelCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	check := providers.CheckModel(ctx, provider, model)
+	if check.Supported && check.Err == nil && !check.Found {
+		logger.WarnCF("provider", "Configured model is not offered by the provider",
+			map[string]interface{}{
+				"model":       model,
+				"suggestions": strings.Join(check.Suggestions, ", "),
+			})
+	}
+	return check
+}
+
+// warmUpProvider opens the provider connections ahead of the first message
+func warmUpProvider(provider providers.LLMProvider) {
+	start := time.Now()
+	if err := providers.WarmUp(context.Background(), provider); err != nil {
+		logger.WarnCF("provider", "Connection warm-up failed",
+			map[string]interface{}{"error": err.Error()})
+		return
+	}
+	logger.DebugCF("provider", "Provider connections warmed up",
+		map[string]interface{}{"duration_ms": time.Since(start).Milliseconds()})
+}
+
 func statusCmd() {
 	cfg, err := loadConfig()
 	if err != nil {
@@ -721,6 +1013,11 @@ func statusCmd() {
 
 	if _, err := os.Stat(configPath); err == nil {
 		fmt.Printf("Model: %s\n", cfg.Agents.Defaults.Model)
+		if provider, err := providers.CreateProvider(cfg); err != nil {
+			fmt.Println("Model check: ✗", err)
+		} else {
+			fmt.Println("Model check:", checkConfiguredModel(provider, cfg.Agents.Defaults.Model))
+		}
 
 		hasOpenRouter := cfg.Providers.OpenRouter.APIKey != ""
 		hasAnthropic := cfg.Providers.Anthropic.APIKey != ""
@@ -983,9 +1280,18 @@ func authStatusCmd() {
 	}
 }
 
+// getConfigPath returns ~/.picoclaw/config.json, or the YAML or TOML config
+// there when only that exists
 func getConfigPath() string {
 	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".picoclaw", "config.json")
+	dir := filepath.Join(home, ".picoclaw")
+	for _, name := range []string{"config.json", "config.yaml", "config.yml", "config.toml"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, "config.json")
 }
 
 func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace string, restrict bool, execTimeout time.Duration) *cron.CronService {
@@ -1007,8 +1313,1201 @@ func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace
 	return cronService
 }
 
+// setupScheduledPrompts registers the context providers of templated jobs
+// and replaces the jobs defined in the configuration with the current ones
+// alertOwner sends an error notification to the last active chat, if any
+func alertOwner(msgBus *bus.MessageBus, stateManager *state.Manager, content string) {
+	channel, chatID, ok := strings.Cut(stateManager.GetLastChannel(), ":")
+	if !ok || channel == "" || chatID == "" || constants.IsInternalChannel(channel) {
+		logger.WarnCF("gateway", "No chat to alert", map[string]interface{}{"alert": content})
+		return
+	}
+	msgBus.PublishOutbound(bus.OutboundMessage{
+		Channel:      channel,
+		ChatID:       chatID,
+		Content:      content,
+		Notification: bus.NotificationError,
+	})
+}
+
+// configureGateway applies the listener options and, unless TLS is off,
+// serves the gateway over HTTPS
+func configureGateway(server *health.Server, cfg config.GatewayConfig) error {
+	server.SetListenOptions(health.ListenOptions{
+		ReadTimeout:    time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:   time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:    time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+	})
+
+	tlsCfg := cfg.TLS
+	if tlsCfg.Mode == "" || tlsCfg.Mode == "off" {
+		return nil
+	}
+	minVersion, err := health.ParseTLSVersion(tlsCfg.MinVersion)
+	if err != nil {
+		return err
+	}
+	opts := health.TLSOptions{
+		HTTPPort:              tlsCfg.HTTPPort,
+		HSTSMaxAge:            time.Duration(tlsCfg.HSTSMaxAgeSeconds) * time.Second,
+		HSTSIncludeSubdomains: tlsCfg.HSTSIncludeSubdomains,
+		MinVersion:            minVersion,
+	}
+	if tlsCfg.Mode == "acme" {
+		opts.ACMEDomains = tlsCfg.Domains
+		opts.ACMEEmail = tlsCfg.Email
+		opts.ACMECacheDir = tlsCfg.CacheDir
+		opts.ACMEDirectoryURL = tlsCfg.DirectoryURL
+	} else {
+		opts.CertFile = tlsCfg.CertFile
+		opts.KeyFile = tlsCfg.KeyFile
+	}
+	if err := server.EnableTLS(opts); err != nil {
+		return fmt.Errorf("gateway TLS: %w", err)
+	}
+	if tlsCfg.Mode == "acme" {
+		fmt.Printf("✓ Gateway HTTPS with ACME certificates for %s\n", strings.Join(tlsCfg.Domains, ", "))
+	}
+	return nil
+}
+
+// startTunnel starts the configured tunnel and waits for its public URL,
+// which replaces the host of Telegram's webhook URL. It returns nil when no
+// tunnel is configured or the client cannot be run.
+func startTunnel(cfg *config.Config) *tunnel.Tunnel {
+	if cfg.Tunnel.Provider == "" {
+		return nil
+	}
+	host := cfg.Gateway.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if mode := cfg.Gateway.TLS.Mode; mode != "" && mode != "off" {
+		scheme = "https"
+	}
+	localURL := scheme + "://" + net.JoinHostPort(host, strconv.Itoa(cfg.Gateway.Port))
+
+	t, err := tunnel.New(cfg.Tunnel, localURL)
+	if err != nil {
+		fmt.Printf("Error starting tunnel: %v\n", err)
+		return nil
+	}
+	t.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Tunnel.StartTimeoutSeconds)*time.Second)
+	defer cancel()
+	publicURL, err := t.WaitURL(ctx)
+	if err != nil {
+		fmt.Printf("⚠ Warning: %v; channels get its URL once it is up\n", err)
+		return t
+	}
+	fmt.Printf("✓ Tunnel (%s) up at %s\n", cfg.Tunnel.Provider, publicURL)
+	return t
+}
+
+// publicBaseURL returns the URL the platforms reach the gateway at: the
+// configured one, the tunnel's, or the first ACME domain; "" if unknown
+func publicBaseURL(cfg *config.Config, t *tunnel.Tunnel) string {
+	if cfg.Gateway.PublicURL != "" {
+		return strings.TrimSuffix(cfg.Gateway.PublicURL, "/")
+	}
+	if t != nil {
+		return t.URL()
+	}
+	if tls := cfg.Gateway.TLS; tls.Mode == "acme" && len(tls.Domains) > 0 {
+		if cfg.Gateway.Port == 443 {
+			return "https://" + tls.Domains[0]
+		}
+		return "https://" + net.JoinHostPort(tls.Domains[0], strconv.Itoa(cfg.Gateway.Port))
+	}
+	return ""
+}
+
+// applyPublicURL points the Telegram webhook at the same path under the
+// public URL, which the channel registers when it starts
+func applyPublicURL(cfg *config.Config, publicURL string) {
+	tg := &cfg.Channels.Telegram
+	if publicURL == "" || tg.Mode != channels.TelegramModeWebhook {
+		return
+	}
+	path := channels.DefaultTelegramWebhookPath
+	if u, err := url.Parse(tg.WebhookURL); err == nil && u.Path != "" && u.Path != "/" {
+		path = u.Path
+	}
+	tg.WebhookURL = publicURL + path
+}
+
+// newExpiryMonitor watches the certificates and tokens the gateway depends
+// on: the WhatsApp bridge certificates, the Graph API token, stored OAuth
+// logins and whatever expiry_monitor lists
+func newExpiryMonitor(cfg *config.Config, msgBus *bus.MessageBus, stateManager *state.Manager) *expiry.Monitor {
+	monitorCfg := cfg.ExpiryMonitor
+	notify := func(content string) {
+		if monitorCfg.Channel == "" || monitorCfg.ChatID == "" {
+			alertOwner(msgBus, stateManager, content)
+			return
+		}
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel:      monitorCfg.Channel,
+			ChatID:       monitorCfg.ChatID,
+			Content:      content,
+			Notification: bus.NotificationError,
+		})
+	}
+	monitor := expiry.NewMonitor(monitorCfg.WarnDays, time.Duration(monitorCfg.CheckHours)*time.Hour, notify)
+
+	addEndpoint := func(name, addr string) {
+		check, err := expiry.TLSEndpoint(name, addr)
+		if err != nil {
+			fmt.Printf("⚠ Warning: not watching %s: %v\n", name, err)
+			return
+		}
+		monitor.Add(check)
+	}
+
+	whatsapp := cfg.Channels.WhatsApp
+	if whatsapp.Enabled {
+		if strings.HasPrefix(whatsapp.BridgeURL, "wss://") {
+			addEndpoint("whatsapp bridge", whatsapp.BridgeURL)
+		}
+		for _, instance := range whatsapp.Instances {
+			if strings.HasPrefix(instance.BridgeURL, "wss://") {
+				addEndpoint("whatsapp bridge "+instance.AccountID, instance.BridgeURL)
+			}
+		}
+		if whatsapp.FBAccessToken != "" {
+			version := whatsapp.FBAPIVersion
+			if version == "" {
+				version = "v22.0"
+			}
+			monitor.Add(expiry.FacebookToken("whatsapp graph token", "https://graph.facebook.com/"+version, whatsapp.FBAccessToken, nil))
+		}
+	}
+
+	if messenger := cfg.Channels.Messenger; messenger.Enabled && messenger.PageAccessToken != "" {
+		version := messenger.APIVersion
+		if version == "" {
+			version = "v22.0"
+		}
+		monitor.Add(expiry.FacebookToken("messenger page token", "https://graph.facebook.com/"+version, messenger.PageAccessToken, nil))
+	}
+
+	if store, err := auth.LoadStore(); err == nil {
+		logins := make([]string, 0, len(store.Credentials))
+		for provider, cred := range store.Credentials {
+			if cred.AuthMethod == "oauth" {
+				logins = append(logins, provider)
+			}
+		}
+		sort.Strings(logins)
+		for _, provider := range logins {
+			monitor.Add(expiry.OAuthLogin(provider))
+		}
+	}
+
+	// ACME certificates renew themselves
+	if gatewayTLS := cfg.Gateway.TLS; gatewayTLS.Mode == "files" {
+		monitor.Add(expiry.CertFile("gateway certificate", gatewayTLS.CertFile))
+	}
+
+	for _, addr := range monitorCfg.Endpoints {
+		addEndpoint(addr, addr)
+	}
+	for _, path := range monitorCfg.CertFiles {
+		monitor.Add(expiry.CertFile(path, path))
+	}
+	return monitor
+}
+
+func setupScheduledPrompts(cronService *cron.CronService, cfg config.ScheduledPromptsConfig) error {
+	loc := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", cfg.Timezone, err)
+		}
+	}
+
+	providers := map[string]cron.ContextProvider{"metrics": devices.NewMetrics()}
+	if len(cfg.Calendars) > 0 {
+		providers["calendar"] = calendar.NewEvents(cfg.Calendars, loc)
+	}
+	if len(cfg.Feeds) > 0 {
+		providers["feeds"] = feeds.NewUnread(cfg.Feeds, cfg.MaxFeedItems)
+	}
+	cronService.SetContextProviders(providers)
+
+	jobs := make([]cron.CronJob, 0, len(cfg.Prompts))
+	seen := make(map[string]bool, len(cfg.Prompts))
+	for _, prompt := range cfg.Prompts {
+		if prompt.Name == "" || prompt.Cron == "" || prompt.Message == "" {
+			return fmt.Errorf("scheduled prompt %q needs a name, cron expression and message", prompt.Name)
+		}
+		if seen[prompt.Name] {
+			return fmt.Errorf("duplicate scheduled prompt %q", prompt.Name)
+		}
+		seen[prompt.Name] = true
+		jobs = append(jobs, cron.CronJob{
+			ID:       cron.ConfigJobPrefix + prompt.Name,
+			Name:     prompt.Name,
+			Enabled:  !prompt.Disabled,
+			Schedule: cron.CronSchedule{Kind: "cron", Expr: prompt.Cron},
+			Payload: cron.CronPayload{
+				Kind:     "agent_turn",
+				Message:  prompt.Message,
+				Channel:  prompt.Channel,
+				To:       prompt.To,
+				Template: true,
+			},
+		})
+	}
+	return cronService.SyncConfigJobs(jobs)
+}
+
 func loadConfig() (*config.Config, error) {
-	return config.LoadConfig(getConfigPath())
+	cfg, err := config.LoadWithOptions(getConfigPath(), config.LoadOptions{Profile: configProfile})
+	if err == nil && len(cfg.MigrationNotes()) > 0 {
+		fmt.Printf("⚠ Warning: %s uses an old config layout (%s); run 'picoclaw config migrate --write' to upgrade it\n",
+			getConfigPath(), cfg.MigrationNotes()[0])
+	}
+	return cfg, err
+}
+
+func importCmd() {
+	if len(os.Args) < 3 || os.Args[2] == "--help" || os.Args[2] == "-h" {
+		importHelp()
+		return
+	}
+
+	path := os.Args[2]
+	owner, title, sessionKey := "", "", ""
+	history := 50
+	force := false
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--owner":
+			if i+1 < len(args) {
+				owner = args[i+1]
+				i++
+			}
+		case "--chat":
+			if i+1 < len(args) {
+				title = args[i+1]
+				i++
+			}
+		case "--session":
+			if i+1 < len(args) {
+				sessionKey = args[i+1]
+				i++
+			}
+		case "--history":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 1 {
+					fmt.Printf("Invalid --history value: %s\n", args[i+1])
+					os.Exit(1)
+				}
+				history = n
+				i++
+			}
+		case "--force":
+			force = true
+		default:
+			fmt.Printf("Unknown flag: %s\n", args[i])
+			importHelp()
+			os.Exit(1)
+		}
+	}
+
+	chats, err := chatimport.Load(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if title != "" {
+		var picked []*chatimport.Chat
+		for _, chat := range chats {
+			if strings.EqualFold(chat.Title, title) {
+				picked = append(picked, chat)
+			}
+		}
+		if len(picked) == 0 {
+			fmt.Printf("Error: no chat named %q in %s\n", title, path)
+			os.Exit(1)
+		}
+		chats = picked
+	}
+	if sessionKey != "" && len(chats) != 1 {
+		fmt.Printf("Error: %s holds %d chats; pick the one for session %s with --chat\n", path, len(chats), sessionKey)
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	workspace := cfg.WorkspacePath()
+
+	for _, chat := range chats {
+		if owner != "" {
+			if err := chat.SetOwner(owner); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if chat.Owner == "" && !chat.Group {
+			var names []string
+			for _, p := range chat.Participants() {
+				names = append(names, p.Name)
+			}
+			fmt.Printf("Error: tell which sender of %q is you with --owner (%s)\n", chat.Title, strings.Join(names, ", "))
+			os.Exit(1)
+		}
+
+		transcript, err := chatimport.WriteMemory(workspace, chat)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Imported %d messages of %q into %s\n", len(chat.Messages), chat.Title, transcript)
+	}
+
+	if sessionKey == "" {
+		fmt.Println("  The agent finds the chat in its memory. Pass --session channel:chat_id to continue it as a conversation.")
+		return
+	}
+	sessions := session.Open(cfg.Session, workspace)
+	if err := sessions.StoreErr(); err != nil {
+		fmt.Printf("Error opening sessions: %v\n", err)
+		os.Exit(1)
+	}
+	defer sessions.Close()
+	if len(sessions.GetHistory(sessionKey)) > 0 && !force {
+		fmt.Printf("Error: session %s already has messages; pass --force to replace them\n", sessionKey)
+		os.Exit(1)
+	}
+	turns := chats[0].Turns(history)
+	messages := make([]providers.Message, len(turns))
+	for i, turn := range turns {
+		messages[i] = providers.Message{Role: turn.Role, Content: turn.Content}
+	}
+	sessions.GetOrCreate(sessionKey)
+	sessions.SetHistory(sessionKey, messages)
+	if err := sessions.Save(sessionKey); err != nil {
+		fmt.Printf("Error saving session: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Session %s continues from the last %d messages\n", sessionKey, min(history, len(chats[0].Messages)))
+}
+
+func importHelp() {
+	fmt.Println("\nImport chat history from WhatsApp or Telegram exports")
+	fmt.Println()
+	fmt.Println("Usage: picoclaw import <export> [options]")
+	fmt.Println()
+	fmt.Println("Exports:")
+	fmt.Println("  WhatsApp    The .txt or .zip of \"Export chat\", with or without media")
+	fmt.Println("  Telegram    The result.json of a Telegram Desktop export in JSON format")
+	fmt.Println()
+	fmt.Println("The transcript goes to memory/imports and the senders to memory/CONTACTS.md.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --owner <name>     Sender name or ID that is you (read from full Telegram exports)")
+	fmt.Println("  --chat <title>     Only import the chat with this title")
+	fmt.Println("  --session <key>    Also seed the session channel:chat_id, e.g. whatsapp:4915123456789@s.whatsapp.net")
+	fmt.Println("  --history <n>      Messages to seed the session with (default: 50)")
+	fmt.Println("  --force            Replace the session history if it has messages")
+}
+
+func evalCmd() {
+	if len(os.Args) < 3 || os.Args[2] == "--help" || os.Args[2] == "-h" {
+		evalHelp()
+		return
+	}
+
+	suitePath := os.Args[2]
+	outPath, baselinePath := "", ""
+	verbose := false
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--out", "-o":
+			if i+1 < len(args) {
+				outPath = args[i+1]
+				i++
+			}
+		case "--baseline", "-b":
+			if i+1 < len(args) {
+				baselinePath = args[i+1]
+				i++
+			}
+		case "--verbose", "-v":
+			verbose = true
+		case "--debug", "-d":
+			logger.SetLevel(logger.DEBUG)
+		default:
+			fmt.Printf("Unknown flag: %s\n", args[i])
+			evalHelp()
+			os.Exit(1)
+		}
+	}
+
+	suite, err := eval.LoadSuite(suitePath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	var baseline *eval.Report
+	if baselinePath != "" {
+		if baseline, err = eval.LoadReport(baselinePath); err != nil {
+			fmt.Printf("Error loading baseline: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	enablePrivacy(cfg)
+	providers.ConfigureHTTP(cfg.ProviderHTTP)
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Printf("Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+	checkConfiguredModel(provider, cfg.Agents.Defaults.Model)
+
+	recorder := &toolRecorder{LLMProvider: provider}
+	agentLoop := agent.NewAgentLoop(cfg, bus.NewMessageBus(), recorder)
+	runID := time.Now().Format("20060102-150405")
+	n := 0
+	target := func(ctx context.Context, prompt string) (eval.Response, error) {
+		n++
+		recorder.take()
+		content, err := agentLoop.ProcessScratch(ctx, prompt, fmt.Sprintf("eval:%s:%d", runID, n))
+		return eval.Response{Content: content, Tools: recorder.take()}, err
+	}
+
+	name := suite.Name
+	if name == "" {
+		name = filepath.Base(suitePath)
+	}
+	fmt.Printf("%s Running %d cases of %s\n\n", logo, len(suite.Cases), name)
+	report := eval.Run(context.Background(), suite, target, func(result eval.Result) {
+		mark := "✓"
+		if !result.Passed {
+			mark = "✗"
+		}
+		fmt.Printf("%s %s (%dms)\n", mark, result.Name, result.LatencyMS)
+		for _, failure := range result.Failures {
+			fmt.Printf("    %s\n", failure)
+		}
+		if verbose {
+			if len(result.Tools) > 0 {
+				fmt.Printf("    tools: %s\n", strings.Join(result.Tools, ", "))
+			}
+			fmt.Printf("    response: %s\n", utils.Truncate(result.Response, 300))
+		}
+	})
+	fmt.Printf("\n%d passed, %d failed\n", report.Passed, report.Failed)
+
+	if outPath != "" {
+		if err := report.Save(outPath); err != nil {
+			fmt.Printf("Error saving report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Report saved to %s\n", outPath)
+	}
+
+	// Against a baseline only regressions fail the run, so known failures
+	// do not block trying a change
+	if baseline != nil {
+		regressions, fixed := report.Compare(baseline)
+		for _, name := range fixed {
+			fmt.Printf("Fixed: %s\n", name)
+		}
+		for _, name := range regressions {
+			fmt.Printf("Regression: %s\n", name)
+		}
+		if len(regressions) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// toolRecorder passes chats on to the provider and remembers the tools the
+// model calls
+type toolRecorder struct {
+	providers.LLMProvider
+
+	mu    sync.Mutex
+	tools []string
+}
+
+func (r *toolRecorder) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	resp, err := r.LLMProvider.Chat(ctx, messages, tools, model, options)
+	if err != nil {
+		return resp, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tc := range resp.ToolCalls {
+		name := tc.Name
+		if name == "" && tc.Function != nil {
+			name = tc.Function.Name
+		}
+		r.tools = append(r.tools, name)
+	}
+	return resp, nil
+}
+
+// take returns the tools called since the last take
+func (r *toolRecorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tools := r.tools
+	r.tools = nil
+	return tools
+}
+
+func evalHelp() {
+	fmt.Println("\nRun a suite of test prompts against the configured agent")
+	fmt.Println()
+	fmt.Println("Usage: picoclaw eval <suite.yaml> [options]")
+	fmt.Println()
+	fmt.Println("Each case sends a prompt in a new, unsaved session and checks the answer:")
+	fmt.Println("  must_contain, must_not_contain   Text the answer must (not) contain, ignoring case")
+	fmt.Println("  must_match                       Regular expression the answer must match")
+	fmt.Println("  must_call, must_not_call         Tools the agent must (not) call")
+	fmt.Println("  max_latency                      Longest the answer may take, e.g. 20s")
+	fmt.Println()
+	fmt.Println("Tools run for real, with the live configuration.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -o, --out <report.json>        Save the results")
+	fmt.Println("  -b, --baseline <report.json>   Compare with an earlier report; only regressions fail the run")
+	fmt.Println("  -v, --verbose                  Show the answers and tool calls")
+	fmt.Println("  -d, --debug                    Enable debug logging")
+}
+
+func debugLogCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	path := cfg.ProviderDebugLog.Path
+	if len(os.Args) > 2 {
+		path = os.Args[2]
+	}
+	if path == "" {
+		path = filepath.Join(cfg.WorkspacePath(), "logs", "provider-debug.log.enc")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Error opening debug log: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	if err := providers.DecryptPayloadLog(f, os.Stdout, cfg.ProviderDebugLog.Key); err != nil {
+		fmt.Printf("Error decrypting debug log: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func configUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  picoclaw config schema                     Print the configuration option catalog")
+	fmt.Println("  picoclaw config validate [--strict] [path] Check a config file and print the effective")
+	fmt.Println("                                             config with secrets masked; --strict fails")
+	fmt.Println("                                             on unknown and deprecated keys")
+	fmt.Println("  picoclaw config migrate [--write] [path]   Upgrade a config file to the current layout;")
+	fmt.Println("                                             prints it, or with --write saves it and keeps")
+	fmt.Println("                                             the old file as <path>.bak")
+	fmt.Println("  picoclaw config encrypt [--section <path>]... [path]")
+	fmt.Println("                                             Encrypt the secrets of a config file in place,")
+	fmt.Println("                                             and every value under each --section")
+	fmt.Println("  picoclaw config decrypt [--write] [path]   Print a config file with its values decrypted;")
+	fmt.Println("                                             --write saves it")
+}
+
+func configCmd() {
+	if len(os.Args) < 3 {
+		configUsage()
+		return
+	}
+
+	switch os.Args[2] {
+	case "schema":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(config.Schema()); err != nil {
+			fmt.Printf("Error writing config schema: %v\n", err)
+			os.Exit(1)
+		}
+	case "validate":
+		configValidateCmd(os.Args[3:])
+	case "migrate":
+		configMigrateCmd(os.Args[3:])
+	case "encrypt":
+		configEncryptCmd(os.Args[3:])
+	case "decrypt":
+		configDecryptCmd(os.Args[3:])
+	default:
+		configUsage()
+	}
+}
+
+// configValidateCmd loads the config as the gateway would, with the
+// environment, and reports what is wrong with it
+func configValidateCmd(args []string) {
+	path := getConfigPath()
+	strict := false
+	for _, arg := range args {
+		switch arg {
+		case "--strict":
+			strict = true
+		default:
+			path = arg
+		}
+	}
+
+	issues, err := config.Lint(path)
+	if err != nil {
+		fmt.Printf("✗ %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	for _, issue := range issues {
+		fmt.Printf("⚠ %s\n", issue)
+	}
+
+	cfg, err := config.LoadWithOptions(path, config.LoadOptions{Profile: configProfile})
+	if err != nil {
+		fmt.Printf("✗ %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	if notes := cfg.MigrationNotes(); len(notes) > 0 {
+		fmt.Printf("⚠ %s; run 'picoclaw config migrate --write' to upgrade the file\n", notes[0])
+	}
+	effective, err := cfg.EffectiveJSON()
+	if err != nil {
+		fmt.Printf("Error writing config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Effective config:")
+	fmt.Println(string(effective))
+
+	if strict && len(issues) > 0 {
+		fmt.Printf("✗ %s has %d ignored keys\n", path, len(issues))
+		os.Exit(1)
+	}
+	fmt.Printf("✓ %s is valid\n", path)
+}
+
+// configMigrateCmd upgrades a config file to the current config_version
+func configMigrateCmd(args []string) {
+	path := getConfigPath()
+	write := false
+	for _, arg := range args {
+		switch arg {
+		case "--write":
+			write = true
+		default:
+			path = arg
+		}
+	}
+
+	data, notes, err := config.MigrateFile(path)
+	if err != nil {
+		fmt.Printf("✗ %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	if len(notes) == 0 {
+		fmt.Printf("✓ %s is already at config_version %d\n", path, config.CurrentConfigVersion)
+		return
+	}
+	for _, note := range notes {
+		fmt.Printf("  %s\n", note)
+	}
+	if !write {
+		fmt.Println("Upgraded config:")
+		os.Stdout.Write(data)
+		fmt.Println("Run with --write to save it.")
+		return
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		fmt.Println("✗ TOML files cannot be written back; run without --write to print the upgraded config as JSON")
+		os.Exit(1)
+	}
+	old, err := os.ReadFile(path)
+	if err == nil {
+		err = os.WriteFile(path+".bak", old, 0600)
+	}
+	if err == nil {
+		err = os.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		fmt.Printf("✗ Error writing %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ %s upgraded to config_version %d, the old file is %s.bak\n", path, config.CurrentConfigVersion, path)
+}
+
+// configEncryptCmd encrypts the secrets of a config file, creating a config
+// key if there is none
+func configEncryptCmd(args []string) {
+	path := getConfigPath()
+	var sections []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--section" && i+1 < len(args):
+			sections = append(sections, args[i+1])
+			i++
+		default:
+			path = args[i]
+		}
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		fmt.Println("✗ TOML files cannot be written back; convert the config to JSON or YAML first")
+		os.Exit(1)
+	}
+
+	keyPath, err := config.EnsureConfigKey()
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		os.Exit(1)
+	}
+	if keyPath != "" {
+		fmt.Printf("Created the config key %s. Keep a copy somewhere safe: the config cannot be read without it.\n", keyPath)
+	}
+
+	data, count, err := config.EncryptFile(path, sections)
+	if err != nil {
+		fmt.Printf("✗ %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	if count == 0 {
+		fmt.Printf("✓ %s has no unencrypted secrets\n", path)
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		fmt.Printf("✗ Error writing %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Encrypted %d values in %s\n", count, path)
+}
+
+// configDecryptCmd shows a config file with its values decrypted, or saves
+// it so
+func configDecryptCmd(args []string) {
+	path := getConfigPath()
+	write := false
+	for _, arg := range args {
+		switch arg {
+		case "--write":
+			write = true
+		default:
+			path = arg
+		}
+	}
+
+	data, count, err := config.DecryptFile(path)
+	if err != nil {
+		fmt.Printf("✗ %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	if !write {
+		os.Stdout.Write(data)
+		return
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		fmt.Println("✗ TOML files cannot be written back; run without --write to print the config as JSON")
+		os.Exit(1)
+	}
+	if count == 0 {
+		fmt.Printf("✓ %s has no encrypted values\n", path)
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		fmt.Printf("✗ Error writing %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Decrypted %d values in %s\n", count, path)
+}
+
+func webhookKeyUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  picoclaw webhook-key generate [id]            Print a new id:secret key")
+	fmt.Println("  picoclaw webhook-key rotate <file> [--keep N] Add a signing key to a key file,")
+	fmt.Println("                                                keeping N previous keys (default 1)")
+}
+
+func webhookKeyCmd() {
+	if len(os.Args) < 3 {
+		webhookKeyUsage()
+		return
+	}
+
+	switch os.Args[2] {
+	case "generate":
+		id := ""
+		if len(os.Args) > 3 {
+			id = os.Args[3]
+		}
+		key, err := webhooksig.GenerateKey(id)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(key.String())
+
+	case "rotate":
+		if len(os.Args) < 4 {
+			webhookKeyUsage()
+			os.Exit(1)
+		}
+		path := os.Args[3]
+		keep := 1
+		args := os.Args[4:]
+		for i := 0; i < len(args); i++ {
+			if args[i] == "--keep" && i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 0 {
+					fmt.Printf("Invalid --keep value: %s\n", args[i+1])
+					os.Exit(1)
+				}
+				keep = n
+				i++
+			}
+		}
+
+		keys, err := webhooksig.ReadKeyFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		key, err := webhooksig.GenerateKey("")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		keys = webhooksig.Rotate(keys, key, keep)
+		if err := webhooksig.WriteKeyFile(path, keys); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ %s now signs; %d previous key(s) still verify\n", key.ID, len(keys)-1)
+		fmt.Println("  Share the new key with receivers before retiring the old ones.")
+
+	default:
+		webhookKeyUsage()
+	}
+}
+
+// serveConfigSchema serves the configuration option catalog to setup tools
+func serveConfigSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.Schema())
+}
+
+// aboutInfo describes the running binary and what the gateway started
+// with. Build tags and plugins make every binary different, so this is
+// the first thing to ask for when debugging a deployment.
+type aboutInfo struct {
+	Version            string    `json:"version"`
+	GitCommit          string    `json:"git_commit,omitempty"`
+	BuildTime          string    `json:"build_time,omitempty"`
+	GoVersion          string    `json:"go_version"`
+	Platform           string    `json:"platform"`
+	BuildTags          []string  `json:"build_tags"`
+	Channels           []string  `json:"channels"`
+	Providers          []string  `json:"providers"`
+	DefaultProvider    string    `json:"default_provider,omitempty"`
+	Tools              []string  `json:"tools"`
+	StatePath          string    `json:"state_path"`
+	StateSchemaVersion int       `json:"state_schema_version"`
+	StartedAt          time.Time `json:"started_at"`
+}
+
+// newAboutInfo collects the about report of the gateway
+func newAboutInfo(cfg *config.Config, channelNames, toolNames []string, stateManager *state.Manager) aboutInfo {
+	build, goVer := formatBuildInfo()
+	about := aboutInfo{
+		Version:            version,
+		GitCommit:          gitCommit,
+		BuildTime:          build,
+		GoVersion:          goVer,
+		Platform:           runtime.GOOS + "/" + runtime.GOARCH,
+		BuildTags:          []string{},
+		Channels:           sortedCopy(channelNames),
+		Providers:          []string{},
+		DefaultProvider:    cfg.AI.DefaultProvider,
+		Tools:              sortedCopy(toolNames),
+		StatePath:          stateManager.Path(),
+		StateSchemaVersion: state.SchemaVersion,
+		StartedAt:          time.Now(),
+	}
+	for _, p := range cfg.AI.Providers {
+		name := p.Name
+		if name == "" {
+			name = p.Type
+		}
+		about.Providers = append(about.Providers, name)
+	}
+
+	// Binaries built without -ldflags still record their tags and revision
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "-tags" && setting.Value != "":
+				about.BuildTags = strings.Split(setting.Value, ",")
+			case setting.Key == "vcs.revision" && about.GitCommit == "":
+				about.GitCommit = setting.Value
+			}
+		}
+	}
+	return about
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// printAbout prints the startup block of the gateway and logs it
+func printAbout(about aboutInfo) {
+	list := func(values []string) string {
+		if len(values) == 0 {
+			return "none"
+		}
+		return strings.Join(values, ", ")
+	}
+
+	fmt.Println("\n📋 Build:")
+	fmt.Printf("  • Version: %s\n", formatVersion())
+	fmt.Printf("  • Go: %s %s\n", about.GoVersion, about.Platform)
+	fmt.Printf("  • Build tags: %s\n", list(about.BuildTags))
+	fmt.Printf("  • Channels: %s\n", list(about.Channels))
+	fmt.Printf("  • Providers: %s\n", list(about.Providers))
+	fmt.Printf("  • Tools: %d\n", len(about.Tools))
+	fmt.Printf("  • State: %s (schema v%d)\n", about.StatePath, about.StateSchemaVersion)
+
+	logger.InfoCF("gateway", "Gateway build", map[string]interface{}{
+		"version":              about.Version,
+		"git_commit":           about.GitCommit,
+		"build_time":           about.BuildTime,
+		"go_version":           about.GoVersion,
+		"platform":             about.Platform,
+		"build_tags":           about.BuildTags,
+		"channels":             about.Channels,
+		"providers":            about.Providers,
+		"tools":                about.Tools,
+		"state_path":           about.StatePath,
+		"state_schema_version": about.StateSchemaVersion,
+	})
+}
+
+// serveAbout serves the about report to admins and monitoring
+func serveAbout(about aboutInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(about)
+	}
+}
+
+// serveDeadLetters serves the dead-letter queue of the bus: GET
+// /admin/dead-letters lists the undelivered messages, POST
+// /admin/dead-letters/retry?id=<id> sends one again ("all" for every entry)
+// and POST /admin/dead-letters/discard?id=<id> drops one
+func serveDeadLetters(msgBus *bus.MessageBus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/dead-letters"), "/")
+		if action == "" {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(msgBus.DeadLetters())
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "missing id", http.StatusBadRequest)
+			return
+		}
+		ids := []string{id}
+		if id == "all" && action == "retry" {
+			ids = ids[:0]
+			for _, dl := range msgBus.DeadLetters() {
+				ids = append(ids, dl.ID)
+			}
+		}
+
+		// Delivery IDs of the requeued messages by dead-letter ID
+		result := make(map[string]string, len(ids))
+		for _, id := range ids {
+			var deliveryID string
+			var err error
+			switch action {
+			case "retry":
+				deliveryID, err = msgBus.RequeueDeadLetter(id)
+			case "discard":
+				err = msgBus.DiscardDeadLetter(id)
+			default:
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				if id == r.URL.Query().Get("id") {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				// Taken by another request meanwhile
+				continue
+			}
+			result[id] = deliveryID
+		}
+		logger.InfoCF("gateway", "Dead letters handled", map[string]interface{}{
+			"action":  action,
+			"entries": len(result),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// busStatsResponse is the body of GET /debug/bus
+type busStatsResponse struct {
+	bus.Stats
+	// Redelivered inbound messages the channels dropped
+	DuplicatesDropped map[string]uint64 `json:"duplicates_dropped"`
+}
+
+// serveBusStats answers GET /debug/bus with the queue depths, message
+// counts and the age of the oldest queued messages
+func serveBusStats(msgBus *bus.MessageBus, channelManager *channels.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(busStatsResponse{
+			Stats:             msgBus.Stats(),
+			DuplicatesDropped: channelManager.DuplicatesDropped(),
+		})
+	}
+}
+
+// chatTimeout bounds how long /api/chat waits for the agent
+const chatTimeout = 5 * time.Minute
+
+// chatRequest is the body of POST /api/chat. Requests with the same session
+// ID share a conversation; without one, each request starts a new one.
+type chatRequest struct {
+	Message   string `json:"message"`
+	SessionID string `json:"session_id"`
+}
+
+type chatResponse struct {
+	Response  string `json:"response,omitempty"`
+	Error     string `json:"error,omitempty"`
+	SessionID string `json:"session_id"`
+	TraceID   string `json:"trace_id"`
+}
+
+// serveChat answers POST /api/chat with the agent's reply, for callers
+// that want the answer in the HTTP response rather than on a chat channel.
+// Requests must carry "Authorization: Bearer <token>".
+func serveChat(msgBus *bus.MessageBus, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req chatRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Message) == "" {
+			http.Error(w, "missing message", http.StatusBadRequest)
+			return
+		}
+		if req.SessionID == "" {
+			req.SessionID = trace.NewID()
+		}
+
+		// The agent may take longer than the gateway's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(chatTimeout + 10*time.Second))
+		ctx, cancel := context.WithTimeout(r.Context(), chatTimeout)
+		defer cancel()
+
+		msg := bus.InboundMessage{
+			Channel:    "api",
+			SenderID:   "api",
+			ChatID:     req.SessionID,
+			Content:    req.Message,
+			SessionKey: "api:" + req.SessionID,
+			TraceID:    trace.NewID(),
+		}
+		resp := chatResponse{SessionID: req.SessionID, TraceID: msg.TraceID}
+		status := http.StatusOK
+		reply, err := msgBus.Request(ctx, msg)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			status, resp.Error = http.StatusGatewayTimeout, "the agent did not answer in time"
+		case err != nil:
+			status, resp.Error = http.StatusServiceUnavailable, err.Error()
+		case reply.Notification == bus.NotificationError:
+			status, resp.Error = http.StatusBadGateway, reply.Content
+		default:
+			resp.Response = reply.Content
+		}
+		logger.InfoCF("gateway", "Chat API request answered", map[string]interface{}{
+			"trace_id": msg.TraceID,
+			"status":   status,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
 }
 
 func cronCmd() {
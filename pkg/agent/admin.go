@@ -0,0 +1,448 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/expiry"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// AdminHandler runs an admin command and returns the reply for the chat
+type AdminHandler func(ctx context.Context, msg bus.InboundMessage, args []string) string
+
+// AdminCommand is an in-chat command reserved for admins. Admin commands are
+// answered before the message reaches the model, even while the agent is
+// paused.
+type AdminCommand struct {
+	Name        string // Including the leading slash, e.g. "/status"
+	Usage       string
+	Description string
+	Handler     AdminHandler
+}
+
+// adminCommands is the registry of admin commands and the senders allowed
+// to run them
+type adminCommands struct {
+	admins   []string // Sender IDs, optionally as "channel:sender_id"
+	commands map[string]AdminCommand
+	mu       sync.RWMutex
+}
+
+func newAdminCommands(admins []string) *adminCommands {
+	return &adminCommands{
+		admins:   admins,
+		commands: make(map[string]AdminCommand),
+	}
+}
+
+// Register adds cmd, replacing any command with the same name
+func (a *adminCommands) Register(cmd AdminCommand) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.commands[cmd.Name] = cmd
+}
+
+// IsAdmin reports whether the sender may run admin commands. Without a
+// configured admin list only the local CLI is trusted.
+func (a *adminCommands) IsAdmin(msg bus.InboundMessage) bool {
+	if len(a.admins) == 0 {
+		return msg.Channel == "cli"
+	}
+	id, _, _ := strings.Cut(msg.SenderID, "|")
+	for _, admin := range a.admins {
+		for _, candidate := range []string{msg.SenderID, id} {
+			if admin == candidate || admin == msg.Channel+":"+candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Handle runs msg if it is a registered admin command. It returns the reply
+// and whether msg was an admin command.
+func (a *adminCommands) Handle(ctx context.Context, msg bus.InboundMessage) (string, bool) {
+	parts := strings.Fields(msg.Content)
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "/") {
+		return "", false
+	}
+
+	a.mu.RLock()
+	cmd, ok := a.commands[parts[0]]
+	a.mu.RUnlock()
+	if !ok {
+		return "", false
+	}
+
+	if !a.IsAdmin(msg) {
+		logger.WarnCF("agent", "Admin command refused", map[string]interface{}{
+			"command":   cmd.Name,
+			"channel":   msg.Channel,
+			"sender_id": msg.SenderID,
+		})
+		return "Not authorized", true
+	}
+	logger.InfoCF("agent", "Admin command", map[string]interface{}{
+		"command":   cmd.Name,
+		"args":      strings.Join(parts[1:], " "),
+		"channel":   msg.Channel,
+		"sender_id": msg.SenderID,
+	})
+	return cmd.Handler(ctx, msg, parts[1:]), true
+}
+
+// Help lists the registered commands
+func (a *adminCommands) Help() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	names := make([]string, 0, len(a.commands))
+	for name := range a.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Admin commands:")
+	for _, name := range names {
+		cmd := a.commands[name]
+		usage := cmd.Usage
+		if usage == "" {
+			usage = cmd.Name
+		}
+		fmt.Fprintf(&b, "\n%s - %s", usage, cmd.Description)
+	}
+	return b.String()
+}
+
+// pauseState records whether the agent is paused everywhere or on single
+// channels
+type pauseState struct {
+	all      bool
+	channels map[string]bool
+	mu       sync.RWMutex
+}
+
+func newPauseState() *pauseState {
+	return &pauseState{channels: make(map[string]bool)}
+}
+
+// Pause pauses channel, or every channel when channel is empty
+func (p *pauseState) Pause(channel string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if channel == "" {
+		p.all = true
+		return
+	}
+	p.channels[channel] = true
+}
+
+// Resume resumes channel, or every channel when channel is empty
+func (p *pauseState) Resume(channel string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if channel == "" {
+		p.all = false
+		p.channels = make(map[string]bool)
+		return
+	}
+	delete(p.channels, channel)
+}
+
+// IsPaused reports whether messages on channel are ignored
+func (p *pauseState) IsPaused(channel string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.all || p.channels[channel]
+}
+
+// String describes the pause state for /status
+func (p *pauseState) String() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.all {
+		return "paused"
+	}
+	if len(p.channels) == 0 {
+		return "active"
+	}
+	paused := make([]string, 0, len(p.channels))
+	for channel := range p.channels {
+		paused = append(paused, channel)
+	}
+	sort.Strings(paused)
+	return "active, paused on " + strings.Join(paused, ", ")
+}
+
+// registerAdminCommands registers the built-in admin commands
+func (al *AgentLoop) registerAdminCommands() {
+	al.admin.Register(AdminCommand{
+		Name:        "/help",
+		Description: "list admin commands",
+		Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+			return al.admin.Help()
+		},
+	})
+
+	al.admin.Register(AdminCommand{
+		Name:        "/status",
+		Description: "show agent and channel state",
+		Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+			return al.adminStatus()
+		},
+	})
+
+	al.admin.Register(AdminCommand{
+		Name:        "/pause",
+		Usage:       "/pause [channel]",
+		Description: "stop answering messages, everywhere or on one channel",
+		Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+			if len(args) > 0 {
+				al.paused.Pause(args[0])
+				return fmt.Sprintf("Paused on %s", args[0])
+			}
+			al.paused.Pause("")
+			return "Paused. Send /resume to continue."
+		},
+	})
+
+	al.admin.Register(AdminCommand{
+		Name:        "/resume",
+		Usage:       "/resume [channel]",
+		Description: "answer messages again",
+		Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+			if len(args) > 0 {
+				al.paused.Resume(args[0])
+				if al.paused.IsPaused(args[0]) {
+					return fmt.Sprintf("Resumed %s, but the agent is still paused everywhere", args[0])
+				}
+				return fmt.Sprintf("Resumed on %s", args[0])
+			}
+			al.paused.Resume("")
+			return "Resumed"
+		},
+	})
+
+	for _, allow := range []bool{true, false} {
+		name, verb := "/deny", "denied"
+		if allow {
+			name, verb = "/allow", "allowed"
+		}
+		al.admin.Register(AdminCommand{
+			Name:        name,
+			Usage:       name + " <sender_id> [channel]",
+			Description: "edit a channel's allowlist until restart",
+			Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+				if len(args) < 1 {
+					return fmt.Sprintf("Usage: %s <sender_id> [channel]", name)
+				}
+				if al.channelManager == nil {
+					return "Channel manager not initialized"
+				}
+				channel := msg.Channel
+				if len(args) > 1 {
+					channel = args[1]
+				}
+				var err error
+				if allow {
+					err = al.channelManager.AllowSender(channel, args[0])
+				} else {
+					err = al.channelManager.DenySender(channel, args[0])
+				}
+				if err != nil {
+					return fmt.Sprintf("Failed: %v", err)
+				}
+				return fmt.Sprintf("%s is now %s on %s (until restart)", args[0], verb, channel)
+			},
+		})
+	}
+
+	if al.guests != nil {
+		al.admin.Register(AdminCommand{
+			Name:        "/share",
+			Usage:       "/share [hours] [channel]",
+			Description: "create a one-off guest link",
+			Handler:     al.adminShare,
+		})
+		al.admin.Register(AdminCommand{
+			Name:        "/unshare",
+			Description: "end all guest access and invalidate unused links",
+			Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+				if al.channelManager == nil {
+					return "Channel manager not initialized"
+				}
+				return fmt.Sprintf("Guest access revoked (%d guests)", al.channelManager.RevokeGuests())
+			},
+		})
+	}
+
+	if al.usage != nil {
+		al.admin.Register(AdminCommand{
+			Name:        "/usage",
+			Usage:       "/usage [YYYY-MM]",
+			Description: "export token usage and costs, this month by default",
+			Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+				month := time.Now().Format("2006-01")
+				if len(args) > 0 {
+					month = args[0]
+				}
+				report, err := al.usage.Export(month)
+				if err != nil {
+					return fmt.Sprintf("Failed: %v", err)
+				}
+				return usageSummary(report) + "\nExported to " + report.CSVPath
+			},
+		})
+	}
+
+	al.admin.Register(AdminCommand{
+		Name:        "/set",
+		Usage:       "/set <name> [value]",
+		Description: "set a setting of this chat, such as its language, or clear it without a value",
+		Handler:     al.adminSet,
+	})
+	al.admin.Register(AdminCommand{
+		Name:        "/settings",
+		Description: "list the settings of this chat",
+		Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+			settings := al.sessions.GetSettings(msg.SessionKey)
+			if len(settings) == 0 {
+				return "No settings for this chat"
+			}
+			names := make([]string, 0, len(settings))
+			for name := range settings {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var b strings.Builder
+			b.WriteString("Settings:")
+			for _, name := range names {
+				fmt.Fprintf(&b, "\n- %s: %s", name, settings[name])
+			}
+			return b.String()
+		},
+	})
+
+	al.admin.Register(AdminCommand{
+		Name:        "/admin",
+		Usage:       "/admin debug-log [on|off|status] | /admin expiry",
+		Description: "toggle the encrypted provider debug log, or show certificate and token expiry",
+		Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+			if len(args) > 0 && args[0] == "expiry" {
+				if al.expiry == nil {
+					return "Expiry monitor not enabled (set expiry_monitor.enabled)"
+				}
+				return al.expiry.Summary()
+			}
+			return al.adminDebugLog(ctx, msg, args)
+		},
+	})
+}
+
+// adminShare creates a guest link for the chat's channel or the given one
+func (al *AgentLoop) adminShare(ctx context.Context, msg bus.InboundMessage, args []string) string {
+	if al.channelManager == nil {
+		return "Channel manager not initialized"
+	}
+	ttl, channel, err := al.guests.shareArgs(args, msg.Channel)
+	if err != nil {
+		return fmt.Sprintf("Usage: /share [hours] [channel] (%v)", err)
+	}
+	link, expires, err := al.channelManager.IssueGuestPass(channel, ttl)
+	if err != nil {
+		return fmt.Sprintf("Failed: %v", err)
+	}
+	logger.InfoCF("agent", "Guest link created", map[string]interface{}{
+		"channel":    channel,
+		"created_by": msg.SenderID,
+		"expires":    expires.Format(time.RFC3339),
+	})
+	return fmt.Sprintf("Guest link (one person, until %s):\n%s", expires.Format("Jan 2 15:04 MST"), link)
+}
+
+// adminSet sets a setting of the chat's session, which the agent is given
+// with every message of the chat
+func (al *AgentLoop) adminSet(ctx context.Context, msg bus.InboundMessage, args []string) string {
+	if len(args) < 1 || msg.SessionKey == "" {
+		return "Usage: /set <name> [value]"
+	}
+	name, value := args[0], strings.Join(args[1:], " ")
+	al.sessions.SetSetting(msg.SessionKey, name, value)
+	if err := al.sessions.Save(msg.SessionKey); err != nil {
+		return fmt.Sprintf("Set until restart, saving failed: %v", err)
+	}
+	if value == "" {
+		return fmt.Sprintf("Cleared %s", name)
+	}
+	return fmt.Sprintf("%s is now %q", name, value)
+}
+
+// adminStatus describes the agent and its channels
+func (al *AgentLoop) adminStatus() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Agent: %s\nModel: %s", al.paused, al.model)
+	if al.channelManager == nil {
+		return b.String()
+	}
+
+	names := al.channelManager.GetEnabledChannels()
+	sort.Strings(names)
+	b.WriteString("\nChannels:")
+	if len(names) == 0 {
+		b.WriteString(" none")
+	}
+	for _, name := range names {
+		state := "unknown"
+		if ch, ok := al.channelManager.GetChannel(name); ok {
+			state = ch.Health().String()
+		}
+		fmt.Fprintf(&b, "\n- %s: %s", name, state)
+	}
+	return b.String()
+}
+
+// adminDebugLog toggles the provider debug log
+func (al *AgentLoop) adminDebugLog(ctx context.Context, msg bus.InboundMessage, args []string) string {
+	if len(args) < 1 || args[0] != "debug-log" {
+		return "Usage: /admin debug-log [on|off|status] | /admin expiry"
+	}
+	if al.payloadLog == nil {
+		return "Provider debug log not configured (set provider_debug_log.key)"
+	}
+	state := "status"
+	if len(args) > 1 {
+		state = args[1]
+	}
+	switch state {
+	case "on":
+		al.payloadLog.SetEnabled(true)
+		logger.InfoCF("agent", "Provider debug log enabled", map[string]interface{}{"sender": msg.SenderID})
+	case "off":
+		al.payloadLog.SetEnabled(false)
+		logger.InfoCF("agent", "Provider debug log disabled", map[string]interface{}{"sender": msg.SenderID})
+	case "status":
+	default:
+		return "Usage: /admin debug-log [on|off|status]"
+	}
+	if al.payloadLog.Enabled() {
+		return fmt.Sprintf("Provider debug log is on (%s)", al.payloadLog.Path())
+	}
+	return "Provider debug log is off"
+}
+
+// SetExpiryMonitor makes the monitor's status available to /admin expiry
+func (al *AgentLoop) SetExpiryMonitor(monitor *expiry.Monitor) {
+	al.expiry = monitor
+}
+
+// RegisterAdminCommand adds an in-chat admin command
+func (al *AgentLoop) RegisterAdminCommand(cmd AdminCommand) {
+	al.admin.Register(cmd)
+}
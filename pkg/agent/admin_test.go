@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestAdminCommandsAuthorization(t *testing.T) {
+	admin := newAdminCommands([]string{"telegram:42", "99"})
+	admin.Register(AdminCommand{
+		Name: "/echo",
+		Handler: func(ctx context.Context, msg bus.InboundMessage, args []string) string {
+			return strings.Join(args, " ")
+		},
+	})
+
+	tests := []struct {
+		name     string
+		msg      bus.InboundMessage
+		want     string
+		wantUsed bool
+	}{
+		{"admin by channel", bus.InboundMessage{Channel: "telegram", SenderID: "42|alice", Content: "/echo hi there"}, "hi there", true},
+		{"admin by id", bus.InboundMessage{Channel: "whatsapp", SenderID: "99", Content: "/echo ok"}, "ok", true},
+		{"wrong channel", bus.InboundMessage{Channel: "whatsapp", SenderID: "42", Content: "/echo hi"}, "Not authorized", true},
+		{"unregistered command", bus.InboundMessage{Channel: "telegram", SenderID: "42", Content: "/other"}, "", false},
+		{"plain message", bus.InboundMessage{Channel: "telegram", SenderID: "42", Content: "echo"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, used := admin.Handle(context.Background(), tt.msg)
+			if got != tt.want || used != tt.wantUsed {
+				t.Errorf("Handle() = %q, %v; want %q, %v", got, used, tt.want, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestAdminCommandsCLIOnlyWithoutAdmins(t *testing.T) {
+	admin := newAdminCommands(nil)
+	if !admin.IsAdmin(bus.InboundMessage{Channel: "cli", SenderID: "user"}) {
+		t.Error("CLI should be trusted without an admin list")
+	}
+	if admin.IsAdmin(bus.InboundMessage{Channel: "telegram", SenderID: "42"}) {
+		t.Error("chat senders should not be trusted without an admin list")
+	}
+}
+
+func TestPauseState(t *testing.T) {
+	p := newPauseState()
+	if p.IsPaused("telegram") || p.String() != "active" {
+		t.Fatal("new state should be active")
+	}
+
+	p.Pause("telegram")
+	if !p.IsPaused("telegram") || p.IsPaused("whatsapp") {
+		t.Error("only telegram should be paused")
+	}
+	if p.String() != "active, paused on telegram" {
+		t.Errorf("String() = %q", p.String())
+	}
+
+	p.Pause("")
+	p.Resume("telegram")
+	if !p.IsPaused("telegram") {
+		t.Error("pausing everywhere should outlast resuming one channel")
+	}
+
+	p.Resume("")
+	if p.IsPaused("telegram") || p.IsPaused("whatsapp") {
+		t.Error("resume without a channel should resume everything")
+	}
+}
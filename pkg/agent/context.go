@@ -5,11 +5,13 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
@@ -158,6 +160,16 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 }
 
 func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID string) []providers.Message {
+	return cb.buildMessages(history, summary, nil, currentMessage, media, channel, chatID)
+}
+
+// BuildSessionMessages builds the messages of a turn from the session of
+// the chat, its settings included
+func (cb *ContextBuilder) BuildSessionMessages(sc session.Context, currentMessage string, media []string, channel, chatID string) []providers.Message {
+	return cb.buildMessages(sc.History, sc.Summary, sc.Settings, currentMessage, media, channel, chatID)
+}
+
+func (cb *ContextBuilder) buildMessages(history []providers.Message, summary string, settings map[string]string, currentMessage string, media []string, channel, chatID string) []providers.Message {
 	messages := []providers.Message{}
 
 	systemPrompt := cb.BuildSystemPrompt()
@@ -166,6 +178,17 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 	if channel != "" && chatID != "" {
 		systemPrompt += fmt.Sprintf("\n\n## Current Session\nChannel: %s\nChat ID: %s", channel, chatID)
 	}
+	if len(settings) > 0 {
+		names := make([]string, 0, len(settings))
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		systemPrompt += "\n\n## Chat Settings\n"
+		for _, name := range names {
+			systemPrompt += fmt.Sprintf("- %s: %s\n", name, settings[name])
+		}
+	}
 
 	// Log system prompt summary for debugging (debug mode only)
 	logger.DebugCF("agent", "System prompt built",
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	defaultEstimatedSteps      = 4
+	defaultOutputTokensPerStep = 1000
+	pendingConfirmationTTL     = 10 * time.Minute
+)
+
+// CostEstimate is the projected usage of running one agent task.
+type CostEstimate struct {
+	Steps        int
+	InputTokens  int
+	OutputTokens int
+	Cost         float64 // In the currency of the pricing table
+	Priced       bool    // False when the model has no pricing entry
+}
+
+// TotalTokens returns input plus output tokens.
+func (e CostEstimate) TotalTokens() int {
+	return e.InputTokens + e.OutputTokens
+}
+
+// costEstimator projects the usage of agent tasks and holds the tasks that
+// are waiting for the user to confirm them.
+type costEstimator struct {
+	cfg config.CostEstimateConfig
+
+	mu      sync.Mutex
+	pending map[string]pendingTask // session key -> task
+	now     func() time.Time
+}
+
+type pendingTask struct {
+	msg     bus.InboundMessage
+	expires time.Time
+}
+
+func newCostEstimator(cfg config.CostEstimateConfig) *costEstimator {
+	if cfg.EstimatedSteps <= 0 {
+		cfg.EstimatedSteps = defaultEstimatedSteps
+	}
+	if cfg.OutputTokensPerStep <= 0 {
+		cfg.OutputTokensPerStep = defaultOutputTokensPerStep
+	}
+	if cfg.Currency == "" {
+		cfg.Currency = "USD"
+	}
+	return &costEstimator{
+		cfg:     cfg,
+		pending: make(map[string]pendingTask),
+		now:     time.Now,
+	}
+}
+
+// Estimate projects a task over the configured number of steps. Every step
+// resends the whole prompt plus the output of the previous steps.
+func (ce *costEstimator) Estimate(model string, promptTokens int) CostEstimate {
+	est := CostEstimate{Steps: ce.cfg.EstimatedSteps}
+	for step := 0; step < est.Steps; step++ {
+		est.InputTokens += promptTokens + step*ce.cfg.OutputTokensPerStep
+	}
+	est.OutputTokens = est.Steps * ce.cfg.OutputTokensPerStep
+
+	if price, ok := ce.pricing(model); ok {
+		est.Priced = true
+		est.Cost = float64(est.InputTokens)/1e6*price.InputPerMillion +
+			float64(est.OutputTokens)/1e6*price.OutputPerMillion
+	}
+	return est
+}
+
+// pricing looks up the model, falling back to the name without its
+// provider prefix (e.g. "openrouter/gpt-4o" -> "gpt-4o").
+func (ce *costEstimator) pricing(model string) (config.ModelPricing, bool) {
+	if price, ok := ce.cfg.Pricing[model]; ok {
+		return price, true
+	}
+	if idx := strings.Index(model, "/"); idx != -1 {
+		price, ok := ce.cfg.Pricing[model[idx+1:]]
+		return price, ok
+	}
+	return config.ModelPricing{}, false
+}
+
+// ExceedsThreshold reports whether the estimate needs user confirmation.
+func (ce *costEstimator) ExceedsThreshold(est CostEstimate) bool {
+	if ce.cfg.TokenThreshold > 0 && est.TotalTokens() > ce.cfg.TokenThreshold {
+		return true
+	}
+	return ce.cfg.CostThreshold > 0 && est.Priced && est.Cost > ce.cfg.CostThreshold
+}
+
+// Hold parks a task until the user confirms it, replacing any earlier one
+// from the same session.
+func (ce *costEstimator) Hold(msg bus.InboundMessage) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	ce.pending[msg.SessionKey] = pendingTask{msg: msg, expires: ce.now().Add(pendingConfirmationTTL)}
+}
+
+// Release removes and returns the task waiting in the session, if any.
+func (ce *costEstimator) Release(sessionKey string) (bus.InboundMessage, bool) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+
+	task, ok := ce.pending[sessionKey]
+	delete(ce.pending, sessionKey)
+	if !ok || ce.now().After(task.expires) {
+		return bus.InboundMessage{}, false
+	}
+	return task.msg, true
+}
+
+// formatCostEstimate renders the confirmation prompt sent to the user.
+func formatCostEstimate(model string, est CostEstimate, currency string) string {
+	var sb strings.Builder
+	sb.WriteString("💰 This task looks expensive.\n")
+	fmt.Fprintf(&sb, "Model: %s\n", model)
+	fmt.Fprintf(&sb, "Estimated: ~%d steps, ~%d input + ~%d output tokens\n", est.Steps, est.InputTokens, est.OutputTokens)
+	if est.Priced {
+		fmt.Fprintf(&sb, "Estimated cost: ~%.4f %s\n", est.Cost, currency)
+	} else {
+		sb.WriteString("Estimated cost: unknown (no pricing configured for this model)\n")
+	}
+	sb.WriteString("Reply /confirm to run it or /cancel to drop it.")
+	return sb.String()
+}
+
+// estimatePromptTokens estimates the tokens sent on the first step of a task:
+// the assembled messages plus the tool definitions.
+func (al *AgentLoop) estimatePromptTokens(msg bus.InboundMessage) int {
+	messages := al.contextBuilder.BuildSessionMessages(
+		al.sessions.Context(msg.SessionKey),
+		msg.Content,
+		nil,
+		msg.Channel,
+		msg.ChatID,
+	)
+	tokens := al.estimateTokens(messages)
+
+	if defs, err := json.Marshal(al.tools.ToProviderDefs()); err == nil {
+		tokens += al.estimateTokens([]providers.Message{{Content: string(defs)}})
+	}
+	return tokens
+}
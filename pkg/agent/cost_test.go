@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestCostEstimatorEstimate(t *testing.T) {
+	ce := newCostEstimator(config.CostEstimateConfig{
+		EstimatedSteps:      3,
+		OutputTokensPerStep: 100,
+		Pricing: map[string]config.ModelPricing{
+			"gpt-4o": {InputPerMillion: 2.5, OutputPerMillion: 10},
+		},
+	})
+
+	est := ce.Estimate("openrouter/gpt-4o", 1000)
+	// Steps resend the prompt plus earlier output: 1000 + 1100 + 1200
+	if est.InputTokens != 3300 || est.OutputTokens != 300 {
+		t.Errorf("unexpected tokens: %+v", est)
+	}
+	wantCost := 3300/1e6*2.5 + 300/1e6*10
+	if !est.Priced || math.Abs(est.Cost-wantCost) > 1e-9 {
+		t.Errorf("cost = %v (priced %v), want %v", est.Cost, est.Priced, wantCost)
+	}
+
+	if unpriced := ce.Estimate("local-model", 1000); unpriced.Priced {
+		t.Error("model without pricing should not be priced")
+	}
+}
+
+func TestCostEstimatorThreshold(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.CostEstimateConfig
+		est  CostEstimate
+		want bool
+	}{
+		{"below both", config.CostEstimateConfig{TokenThreshold: 1000, CostThreshold: 1}, CostEstimate{InputTokens: 500, Cost: 0.5, Priced: true}, false},
+		{"tokens exceeded", config.CostEstimateConfig{TokenThreshold: 1000}, CostEstimate{InputTokens: 900, OutputTokens: 200}, true},
+		{"cost exceeded", config.CostEstimateConfig{CostThreshold: 1}, CostEstimate{Cost: 2, Priced: true}, true},
+		{"unpriced ignores cost threshold", config.CostEstimateConfig{CostThreshold: 1}, CostEstimate{InputTokens: 1e6}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newCostEstimator(tt.cfg).ExceedsThreshold(tt.est); got != tt.want {
+				t.Errorf("ExceedsThreshold() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCostEstimatorHoldRelease(t *testing.T) {
+	ce := newCostEstimator(config.CostEstimateConfig{})
+	now := time.Now()
+	ce.now = func() time.Time { return now }
+
+	ce.Hold(bus.InboundMessage{SessionKey: "s1", Content: "first"})
+	ce.Hold(bus.InboundMessage{SessionKey: "s1", Content: "second"})
+
+	msg, ok := ce.Release("s1")
+	if !ok || msg.Content != "second" {
+		t.Errorf("expected latest task, got %q (ok=%v)", msg.Content, ok)
+	}
+	if _, ok := ce.Release("s1"); ok {
+		t.Error("task should only be released once")
+	}
+
+	ce.Hold(bus.InboundMessage{SessionKey: "s2"})
+	now = now.Add(pendingConfirmationTTL + time.Second)
+	if _, ok := ce.Release("s2"); ok {
+		t.Error("expired task should not be released")
+	}
+}
+
+func TestFormatCostEstimate(t *testing.T) {
+	out := formatCostEstimate("gpt-4o", CostEstimate{Steps: 2, InputTokens: 10, OutputTokens: 5, Cost: 0.25, Priced: true}, "USD")
+	for _, want := range []string{"gpt-4o", "0.2500 USD", "/confirm", "/cancel"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("estimate missing %q:\n%s", want, out)
+		}
+	}
+}
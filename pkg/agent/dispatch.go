@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// DefaultDispatchWorkers is how many agent turns run at once when the
+// configuration sets no number
+const DefaultDispatchWorkers = 4
+
+// chatBacklog is how many messages of one chat wait for its turns. Beyond
+// that, dispatch blocks and the next messages stay on the bus, where its
+// overflow policy and watermarks apply.
+const chatBacklog = 16
+
+// dispatcher runs agent turns on a bounded pool of workers. Turns of
+// different chats run in parallel, while the messages of one chat are
+// handled one after the other in arrival order, so a conversation never
+// interleaves or races its own history.
+type dispatcher struct {
+	slots  chan struct{} // A token per running worker
+	handle func(context.Context, bus.InboundMessage)
+	// release gives up a message not handled because of shutdown, leaving
+	// it for the next start
+	release func(bus.InboundMessage)
+
+	mu sync.Mutex
+	// Chats with a turn running or about to, and the messages waiting for
+	// it, keyed by dispatchKey
+	busy map[string][]bus.InboundMessage
+	// freed is closed, and replaced, when a waiting message is taken
+	freed   chan struct{}
+	running sync.WaitGroup
+}
+
+func newDispatcher(workers int, handle func(context.Context, bus.InboundMessage), release func(bus.InboundMessage)) *dispatcher {
+	if workers <= 0 {
+		workers = DefaultDispatchWorkers
+	}
+	return &dispatcher{
+		slots:   make(chan struct{}, workers),
+		handle:  handle,
+		release: release,
+		busy:    make(map[string][]bus.InboundMessage),
+		freed:   make(chan struct{}),
+	}
+}
+
+// dispatchKey identifies the chat of msg. System messages, such as the
+// results of background subagents, carry the chat they report to as
+// "channel:chat_id" and wait for its turns.
+func dispatchKey(msg bus.InboundMessage) string {
+	if msg.Channel == "system" {
+		return msg.ChatID
+	}
+	return msg.Channel + ":" + msg.ChatID
+}
+
+// dispatch handles msg after the messages of its chat dispatched before it.
+// When every worker is busy, or the chat has a full backlog, it blocks until
+// there is room, which leaves the next messages queued on the bus. Once ctx
+// is done, msg is released instead.
+func (d *dispatcher) dispatch(ctx context.Context, msg bus.InboundMessage) {
+	key := dispatchKey(msg)
+
+	for {
+		d.mu.Lock()
+		waiting, busy := d.busy[key]
+		if !busy {
+			d.busy[key] = nil
+			d.mu.Unlock()
+			break
+		}
+		if len(waiting) < chatBacklog {
+			d.busy[key] = append(waiting, msg)
+			d.mu.Unlock()
+			return
+		}
+		freed := d.freed
+		d.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			d.release(msg)
+			return
+		}
+	}
+
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		// Nothing was queued behind msg: dispatch is not called
+		// concurrently
+		d.mu.Lock()
+		delete(d.busy, key)
+		d.mu.Unlock()
+		d.release(msg)
+		return
+	}
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+		defer func() { <-d.slots }()
+
+		for ok := true; ok; msg, ok = d.next(ctx, key) {
+			d.handle(ctx, msg)
+		}
+	}()
+}
+
+// next returns the message of the chat key waiting longest, or marks the
+// chat idle and reports false. Once ctx is done the waiting messages are
+// released rather than handled.
+func (d *dispatcher) next(ctx context.Context, key string) (bus.InboundMessage, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	waiting := d.busy[key]
+	if len(waiting) == 0 || ctx.Err() != nil {
+		delete(d.busy, key)
+		for _, msg := range waiting {
+			d.release(msg)
+		}
+		return bus.InboundMessage{}, false
+	}
+	d.busy[key] = waiting[1:]
+	close(d.freed)
+	d.freed = make(chan struct{})
+	return waiting[0], true
+}
+
+// wait returns once every dispatched message is handled
+func (d *dispatcher) wait() {
+	d.running.Wait()
+}
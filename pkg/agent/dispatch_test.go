@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestDispatcherSerializesChats(t *testing.T) {
+	var mu sync.Mutex
+	running := make(map[string]int) // Turns running per chat
+	var order []string              // Contents handled in chat "a"
+	parallel, maxParallel := 0, 0
+
+	d := newDispatcher(2, func(ctx context.Context, msg bus.InboundMessage) {
+		key := dispatchKey(msg)
+		mu.Lock()
+		running[key]++
+		if running[key] > 1 {
+			t.Errorf("chat %s handled concurrently", key)
+		}
+		parallel++
+		maxParallel = max(maxParallel, parallel)
+		if key == "telegram:a" {
+			order = append(order, msg.Content)
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running[key]--
+		parallel--
+		mu.Unlock()
+	}, func(msg bus.InboundMessage) {
+		t.Errorf("released %+v", msg)
+	})
+
+	ctx := context.Background()
+	for i, content := range []string{"1", "2", "3"} {
+		d.dispatch(ctx, bus.InboundMessage{Channel: "telegram", ChatID: "a", Content: content})
+		d.dispatch(ctx, bus.InboundMessage{Channel: "telegram", ChatID: "b", Content: content})
+		if i == 0 {
+			// A background result for chat a waits for its turns
+			d.dispatch(ctx, bus.InboundMessage{Channel: "system", ChatID: "telegram:a", Content: "subagent"})
+		}
+	}
+	d.dispatch(ctx, bus.InboundMessage{Channel: "slack", ChatID: "c", Content: "1"})
+	d.wait()
+
+	if maxParallel != 2 {
+		t.Errorf("at most %d turns ran at once, want 2", maxParallel)
+	}
+	if len(order) != 4 || order[0] != "1" || order[1] != "subagent" || order[2] != "2" || order[3] != "3" {
+		t.Errorf("chat a handled in order %v", order)
+	}
+	if len(d.busy) != 0 {
+		t.Errorf("chats left busy: %v", d.busy)
+	}
+}
+
+func TestDispatcherBacklogAndShutdown(t *testing.T) {
+	block := make(chan struct{})
+	var mu sync.Mutex
+	var handled, released []string
+	d := newDispatcher(1, func(ctx context.Context, msg bus.InboundMessage) {
+		if msg.Content == "0" {
+			<-block
+		}
+		mu.Lock()
+		handled = append(handled, msg.Content)
+		mu.Unlock()
+	}, func(msg bus.InboundMessage) {
+		mu.Lock()
+		released = append(released, msg.Content)
+		mu.Unlock()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	msg := func(i int) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", ChatID: "a", Content: fmt.Sprint(i)}
+	}
+	// One running and a full backlog
+	for i := 0; i <= chatBacklog; i++ {
+		d.dispatch(ctx, msg(i))
+	}
+
+	// A flooding chat blocks the dispatch, leaving its messages on the bus
+	returned := make(chan struct{})
+	go func() {
+		d.dispatch(ctx, msg(chatBacklog+1))
+		close(returned)
+	}()
+	select {
+	case <-returned:
+		t.Fatal("dispatch past the backlog did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// On shutdown nothing more is handled and nothing is acknowledged
+	cancel()
+	<-returned
+	close(block)
+	d.wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != 1 || handled[0] != "0" {
+		t.Errorf("handled %v, want only the running turn", handled)
+	}
+	if len(released) != chatBacklog+1 {
+		t.Errorf("released %d messages, want %d", len(released), chatBacklog+1)
+	}
+	if len(d.busy) != 0 {
+		t.Errorf("chats left busy: %v", d.busy)
+	}
+}
@@ -0,0 +1,56 @@
+package agent
+
+import "sync"
+
+// forkPrefix marks answers given inside a fork
+const forkPrefix = "🔮 Hypothetical: "
+
+// forks tracks the chats exploring a what-if branch of their conversation.
+// While a chat is forked its messages run against a scratch copy of the
+// session, so the main history never sees them.
+type forks struct {
+	mu     sync.Mutex
+	active map[string]string // Session key -> scratch session key
+}
+
+func newForks() *forks {
+	return &forks{active: make(map[string]string)}
+}
+
+// forkKey returns the scratch session key of a forked session
+func forkKey(sessionKey string) string {
+	return sessionKey + ":fork"
+}
+
+// start forks a session and returns its scratch key; ok is false when the
+// session is already forked
+func (f *forks) start(sessionKey string) (scratch string, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, forked := f.active[sessionKey]; forked {
+		return "", false
+	}
+	scratch = forkKey(sessionKey)
+	f.active[sessionKey] = scratch
+	return scratch, true
+}
+
+// end leaves the fork of a session and returns the scratch key to discard
+func (f *forks) end(sessionKey string) (scratch string, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	scratch, ok = f.active[sessionKey]
+	delete(f.active, sessionKey)
+	return scratch, ok
+}
+
+// scratch returns the scratch key of a forked session
+func (f *forks) scratch(sessionKey string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	scratch, ok := f.active[sessionKey]
+	return scratch, ok
+}
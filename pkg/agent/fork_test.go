@@ -0,0 +1,31 @@
+package agent
+
+import "testing"
+
+func TestForks(t *testing.T) {
+	f := newForks()
+
+	if _, ok := f.scratch("telegram:1"); ok {
+		t.Error("sessions should not start forked")
+	}
+	scratch, ok := f.start("telegram:1")
+	if !ok || scratch != "telegram:1:fork" {
+		t.Fatalf("start() = %q, %v", scratch, ok)
+	}
+	if _, ok := f.start("telegram:1"); ok {
+		t.Error("a forked session cannot be forked again")
+	}
+	if got, ok := f.scratch("telegram:1"); !ok || got != scratch {
+		t.Errorf("scratch() = %q, %v", got, ok)
+	}
+	if _, ok := f.scratch("telegram:2"); ok {
+		t.Error("forks should be per session")
+	}
+
+	if got, ok := f.end("telegram:1"); !ok || got != scratch {
+		t.Errorf("end() = %q, %v", got, ok)
+	}
+	if _, ok := f.end("telegram:1"); ok {
+		t.Error("ending twice should report no fork")
+	}
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const (
+	defaultGuestLinkHours  = 24
+	defaultGuestMaxHistory = 20
+	// maxGuestLinkHours bounds the links /share hands out
+	maxGuestLinkHours = 7 * 24
+)
+
+const defaultGuestPersona = `You are PicoClaw, a friendly assistant. The person you are talking to is a guest the owner invited for a short while.
+Be helpful and concise. You have no tools and no access to the owner's files, notes or memories; do not pretend otherwise, and do not share anything about the owner.`
+
+// guestMode answers senders admitted by a share link. Guests get their own
+// persona without tools or workspace context, and their history only lives
+// in memory.
+type guestMode struct {
+	persona    string
+	linkTTL    time.Duration
+	maxHistory int
+}
+
+// newGuestMode returns nil when guest mode is disabled
+func newGuestMode(cfg config.GuestConfig) *guestMode {
+	if !cfg.Enabled {
+		return nil
+	}
+	g := &guestMode{
+		persona:    cfg.Persona,
+		linkTTL:    time.Duration(cfg.LinkHours) * time.Hour,
+		maxHistory: cfg.MaxHistory,
+	}
+	if g.persona == "" {
+		g.persona = defaultGuestPersona
+	}
+	if g.linkTTL <= 0 {
+		g.linkTTL = defaultGuestLinkHours * time.Hour
+	}
+	if g.maxHistory <= 0 {
+		g.maxHistory = defaultGuestMaxHistory
+	}
+	return g
+}
+
+// guestSessionKey keeps guest chats apart from the sessions of the chat
+func guestSessionKey(sessionKey string) string {
+	return "guest:" + sessionKey
+}
+
+// shareArgs parses "/share [hours] [channel]"; the channel defaults to the
+// one the command came from
+func (g *guestMode) shareArgs(args []string, channel string) (time.Duration, string, error) {
+	ttl := g.linkTTL
+	if len(args) > 0 {
+		hours, err := strconv.Atoi(args[0])
+		if err != nil || hours <= 0 || hours > maxGuestLinkHours {
+			return 0, "", fmt.Errorf("hours must be between 1 and %d", maxGuestLinkHours)
+		}
+		ttl = time.Duration(hours) * time.Hour
+	}
+	if len(args) > 1 {
+		channel = args[1]
+	}
+	return ttl, channel, nil
+}
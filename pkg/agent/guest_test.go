@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestNewGuestMode(t *testing.T) {
+	if newGuestMode(config.GuestConfig{}) != nil {
+		t.Error("guest mode should be disabled by default")
+	}
+
+	g := newGuestMode(config.GuestConfig{Enabled: true})
+	if g.persona != defaultGuestPersona || g.linkTTL != 24*time.Hour || g.maxHistory != 20 {
+		t.Errorf("unexpected defaults %+v", g)
+	}
+}
+
+func TestGuestShareArgs(t *testing.T) {
+	g := newGuestMode(config.GuestConfig{Enabled: true, LinkHours: 6})
+
+	if ttl, channel, err := g.shareArgs(nil, "telegram"); err != nil || ttl != 6*time.Hour || channel != "telegram" {
+		t.Errorf("shareArgs() = %v, %q, %v", ttl, channel, err)
+	}
+	if ttl, channel, err := g.shareArgs([]string{"2", "discord"}, "telegram"); err != nil || ttl != 2*time.Hour || channel != "discord" {
+		t.Errorf("shareArgs(2 discord) = %v, %q, %v", ttl, channel, err)
+	}
+	for _, bad := range []string{"0", "-1", "soon", "1000"} {
+		if _, _, err := g.shareArgs([]string{bad}, "telegram"); err == nil {
+			t.Errorf("shareArgs(%q) should fail", bad)
+		}
+	}
+}
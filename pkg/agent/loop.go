@@ -22,11 +22,14 @@ import (
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/expiry"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/trace"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -43,7 +46,23 @@ type AgentLoop struct {
 	tools          *tools.ToolRegistry
 	running        atomic.Bool
 	summarizing    sync.Map // Tracks which sessions are currently being summarized
+	memoryless     sync.Map // Sessions already warned that the session store is down
 	channelManager *channels.Manager
+	payloadLog     *providers.PayloadLogger // nil unless the provider debug log is configured
+	admin          *adminCommands
+	paused         *pauseState
+	forks          *forks
+	costs          *costEstimator  // nil when cost confirmation is disabled
+	quiet          *quietHours     // nil when quiet hours are disabled
+	prefetch       *toolPrefetcher // nil when tool prefetching is disabled
+	polls          *tools.PollBook
+	secrets        *tools.SecretsTool // nil unless the secrets tool is enabled
+	archive        *transcriptArchive // nil when the transcript archive is disabled
+	progress       *progressReporter  // nil when progress updates are disabled
+	guests         *guestMode         // nil when guest mode is disabled
+	usage          *usageLedger       // nil when the usage ledger is disabled
+	expiry         *expiry.Monitor    // nil when the expiry monitor is disabled
+	dispatcher     *dispatcher
 }
 
 // processOptions configures how a message is processed
@@ -51,11 +70,14 @@ type processOptions struct {
 	SessionKey      string // Session identifier for history/context
 	Channel         string // Target channel for tool execution
 	ChatID          string // Target chat ID for tool execution
+	AccountID       string // Account the message arrived on, for multi-account channels
+	SenderID        string // Sender of the message, for tools restricted to owners
 	UserMessage     string // User message content (may include prefix)
 	DefaultResponse string // Response when LLM returns empty
 	EnableSummary   bool   // Whether to trigger summarization
 	SendResponse    bool   // Whether to send response via bus
 	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	ReportProgress  bool   // Whether to send progress updates as tools run
 }
 
 // createToolRegistry creates a tool registry with common tools.
@@ -73,19 +95,61 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	// Shell execution
 	registry.Register(tools.NewExecTool(workspace, restrict))
 
-	if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
-		BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
-		BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
-		BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
-		DuckDuckGoMaxResults: cfg.Tools.Web.DuckDuckGo.MaxResults,
-		DuckDuckGoEnabled:    cfg.Tools.Web.DuckDuckGo.Enabled,
-		PerplexityAPIKey:     cfg.Tools.Web.Perplexity.APIKey,
-		PerplexityMaxResults: cfg.Tools.Web.Perplexity.MaxResults,
-		PerplexityEnabled:    cfg.Tools.Web.Perplexity.Enabled,
-	}); searchTool != nil {
-		registry.Register(searchTool)
+	// In local-only mode the web tools only reach the internet through the
+	// local proxy, and are left out without one
+	webProxy := ""
+	if cfg.Privacy.LocalOnly {
+		webProxy = cfg.Privacy.WebProxy
+	}
+	if !cfg.Privacy.LocalOnly || webProxy != "" {
+		if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
+			BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
+			BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
+			BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
+			DuckDuckGoMaxResults: cfg.Tools.Web.DuckDuckGo.MaxResults,
+			DuckDuckGoEnabled:    cfg.Tools.Web.DuckDuckGo.Enabled,
+			PerplexityAPIKey:     cfg.Tools.Web.Perplexity.APIKey,
+			PerplexityMaxResults: cfg.Tools.Web.Perplexity.MaxResults,
+			PerplexityEnabled:    cfg.Tools.Web.Perplexity.Enabled,
+			Proxy:                webProxy,
+		}); searchTool != nil {
+			registry.Register(searchTool)
+		}
+		fetchTool := tools.NewWebFetchTool(50000)
+		fetchTool.SetProxy(webProxy)
+		registry.Register(fetchTool)
+	}
+
+	if k8s := cfg.Tools.Kubernetes; k8s.Enabled {
+		registry.Register(tools.NewKubernetesTool(tools.KubernetesToolOptions{
+			KubectlPath:        k8s.KubectlPath,
+			Kubeconfigs:        k8s.Kubeconfigs,
+			AllowedNamespaces:  k8s.AllowedNamespaces,
+			AllowMutations:     k8s.AllowMutations,
+			DescribeConfigMaps: k8s.DescribeConfigMaps,
+			Timeout:            time.Duration(k8s.TimeoutSeconds) * time.Second,
+		}))
+	}
+
+	if repo := cfg.Tools.Repo; repo.Enabled {
+		registry.Register(tools.NewRepoTool(tools.RepoToolOptions{
+			GitHubToken:   repo.GitHubToken,
+			GitHubAPIBase: repo.GitHubAPIBase,
+			GitLabToken:   repo.GitLabToken,
+			GitLabAPIBase: repo.GitLabAPIBase,
+			AllowedRepos:  repo.AllowedRepos,
+		}))
+	}
+
+	if issues := cfg.Tools.Issues; issues.Enabled {
+		registry.Register(tools.NewIssueTrackerTool(tools.IssueTrackerToolOptions{
+			JiraBaseURL:     issues.JiraBaseURL,
+			JiraEmail:       issues.JiraEmail,
+			JiraAPIToken:    issues.JiraAPIToken,
+			LinearAPIKey:    issues.LinearAPIKey,
+			AllowedProjects: issues.AllowedProjects,
+		}))
 	}
-	registry.Register(tools.NewWebFetchTool(50000))
 
 	// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
 	registry.Register(tools.NewI2CTool())
@@ -94,14 +158,44 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	// Message tool - available to both agent and subagent
 	// Subagent uses it to communicate directly with user
 	messageTool := tools.NewMessageTool()
-	messageTool.SetSendCallback(func(channel, chatID, content string) error {
+	messageTool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error {
 		msgBus.PublishOutbound(bus.OutboundMessage{
 			Channel: channel,
 			ChatID:  chatID,
+			TraceID: trace.ID(ctx),
 			Content: content,
 		})
 		return nil
 	})
+	messageTool.SetCardCallback(func(ctx context.Context, channel, chatID string, card *bus.Card) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			TraceID: trace.ID(ctx),
+			Card:    card,
+		})
+		return nil
+	})
+	messageTool.SetExpiringCallback(func(ctx context.Context, channel, chatID, content string, ttl time.Duration) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel:    channel,
+			ChatID:     chatID,
+			TraceID:    trace.ID(ctx),
+			Content:    content,
+			TTLSeconds: max(1, int(ttl/time.Second)),
+		})
+		return nil
+	})
+	messageTool.SetContactCallback(func(ctx context.Context, channel, chatID, content string, contact *bus.Contact) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			TraceID: trace.ID(ctx),
+			Content: content,
+			Contact: contact,
+		})
+		return nil
+	})
 	registry.Register(messageTool)
 
 	return registry
@@ -113,6 +207,20 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 
 	restrict := cfg.Agents.Defaults.RestrictToWorkspace
 
+	if hedged, err := providers.WithConfiguredHedging(cfg, provider); err != nil {
+		logger.WarnCF("agent", "Hedged requests disabled",
+			map[string]interface{}{"error": err.Error()})
+	} else {
+		provider = hedged
+	}
+
+	// Clamp requests to the model's limits before they reach the provider,
+	// so the debug log records what is actually sent
+	payloadLog := newPayloadLogger(cfg, workspace)
+	provider = providers.WithPayloadLogging(provider, payloadLog)
+	providers.DefaultModels.RegisterConfig(cfg.Models)
+	provider = providers.WithModelCapabilities(provider, providers.DefaultModels)
+
 	// Create tool registry for main agent
 	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus)
 
@@ -130,7 +238,30 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	subagentTool := tools.NewSubagentTool(subagentManager)
 	toolsRegistry.Register(subagentTool)
 
-	sessionsManager := session.NewSessionManager(filepath.Join(workspace, "sessions"))
+	// Register poll tool (for main agent); votes are tallied by the loop
+	polls := tools.NewPollBook()
+	pollTool := tools.NewPollTool(polls)
+	pollTool.SetSendCallback(func(ctx context.Context, channel, chatID string, poll *bus.Poll) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			TraceID: trace.ID(ctx),
+			Poll:    poll,
+		})
+		return nil
+	})
+	toolsRegistry.Register(pollTool)
+
+	// Register secrets and 2FA code tools (for main agent); approvals are answered by the loop
+	secretsTool := newSecretsTool(cfg.Tools.Secrets, msgBus)
+	if secretsTool != nil {
+		toolsRegistry.Register(secretsTool)
+		if cfg.Tools.Secrets.TOTP {
+			toolsRegistry.Register(tools.NewTOTPTool(secretsTool))
+		}
+	}
+
+	sessionsManager := session.Open(cfg.Session, workspace)
 
 	// Create state manager for atomic state persistence
 	stateManager := state.NewManager(workspace)
@@ -139,7 +270,22 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	contextBuilder := NewContextBuilder(workspace)
 	contextBuilder.SetToolsRegistry(toolsRegistry)
 
-	return &AgentLoop{
+	var costs *costEstimator
+	if cfg.CostEstimate.Enabled {
+		costs = newCostEstimator(cfg.CostEstimate)
+	}
+
+	var prefetch *toolPrefetcher
+	if cfg.ToolPrefetch.Enabled {
+		prefetch = newToolPrefetcher(cfg.ToolPrefetch, toolsRegistry.Execute)
+	}
+
+	redact := providers.RedactText
+	if payloadLog != nil {
+		redact = payloadLog.Redact
+	}
+
+	al := &AgentLoop{
 		bus:            msgBus,
 		provider:       provider,
 		workspace:      workspace,
@@ -151,11 +297,123 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		contextBuilder: contextBuilder,
 		tools:          toolsRegistry,
 		summarizing:    sync.Map{},
+		payloadLog:     payloadLog,
+		admin:          newAdminCommands(append(append([]string{}, cfg.Admins...), cfg.ProviderDebugLog.Admins...)),
+		paused:         newPauseState(),
+		forks:          newForks(),
+		costs:          costs,
+		quiet:          newQuietHours(cfg.QuietHours),
+		prefetch:       prefetch,
+		polls:          polls,
+		secrets:        secretsTool,
+		archive:        newTranscriptArchive(cfg.TranscriptArchive, msgBus, redact),
+		progress:       newProgressReporter(cfg.Progress),
+		guests:         newGuestMode(cfg.Guest),
+		usage:          newUsageLedger(cfg, workspace, msgBus),
 	}
+	al.dispatcher = newDispatcher(cfg.Dispatch.Workers, al.handleInbound, al.bus.InboundReleased)
+	al.registerAdminCommands()
+	return al
+}
+
+// newSecretsTool creates the secrets tool, or returns nil when it is
+// disabled or its backend is misconfigured.
+func newSecretsTool(secretsCfg config.SecretsToolConfig, msgBus *bus.MessageBus) *tools.SecretsTool {
+	if !secretsCfg.Enabled {
+		return nil
+	}
+	backend, err := tools.NewSecretBackend(secretsCfg.Backend, secretsCfg.Command,
+		secretsCfg.VaultAddr, secretsCfg.VaultToken, secretsCfg.VaultMount)
+	if err != nil {
+		logger.WarnCF("agent", "Secrets tool disabled", map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+
+	secretsTool := tools.NewSecretsTool(tools.SecretsToolOptions{
+		Backend:      backend,
+		Owners:       secretsCfg.Owners,
+		SkipApproval: secretsCfg.SkipApproval,
+		DeleteAfter:  time.Duration(secretsCfg.DeleteAfterMinutes) * time.Minute,
+		Timeout:      time.Duration(secretsCfg.TimeoutSeconds) * time.Second,
+	})
+	secretsTool.SetPromptCallback(func(ctx context.Context, channel, chatID string, card *bus.Card) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			TraceID: trace.ID(ctx),
+			Card:    card,
+		})
+		return nil
+	})
+	secretsTool.SetDeliverCallback(func(ctx context.Context, channel, chatID, content string, ttl time.Duration) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel:    channel,
+			ChatID:     chatID,
+			TraceID:    trace.ID(ctx),
+			Content:    content,
+			TTLSeconds: max(1, int(ttl/time.Second)),
+		})
+		return nil
+	})
+	return secretsTool
+}
+
+// SetToolPredictor replaces the predictor used for tool prefetching. It has
+// no effect unless tool_prefetch is enabled.
+func (al *AgentLoop) SetToolPredictor(predictor ToolPredictor) {
+	if al.prefetch != nil {
+		al.prefetch.SetPredictor(predictor)
+	}
+}
+
+// newPayloadLogger creates the encrypted provider debug log, or returns nil
+// when no encryption key is configured.
+func newPayloadLogger(cfg *config.Config, workspace string) *providers.PayloadLogger {
+	debugCfg := cfg.ProviderDebugLog
+	if debugCfg.Key == "" {
+		return nil
+	}
+
+	path := debugCfg.Path
+	if path == "" {
+		path = filepath.Join(workspace, "logs", "provider-debug.log.enc")
+	}
+	payloadLog, err := providers.NewPayloadLogger(path, debugCfg.Key)
+	if err != nil {
+		logger.WarnCF("agent", "Provider debug log disabled", map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+
+	// Header values such as organization IDs or gateway tokens too
+	for _, p := range cfg.AI.Providers {
+		payloadLog.AddSecrets(p.APIKey)
+		for _, value := range p.Headers {
+			payloadLog.AddSecrets(value)
+		}
+	}
+	payloadLog.SetEnabled(debugCfg.Enabled)
+	return payloadLog
 }
 
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
+	al.publishLifecycle(bus.AgentStarted)
+	defer al.publishLifecycle(bus.AgentStopped)
+
+	if al.quiet != nil {
+		go al.releaseQuietHours(ctx)
+	}
+	if al.archive != nil {
+		go al.archive.Run(ctx)
+	}
+	if al.usage != nil {
+		go al.usage.Run(ctx)
+	}
+
+	// Turns still running finish before the loop reports it stopped, and
+	// before the session store closes
+	defer al.sessions.Close()
+	defer al.dispatcher.wait()
 
 	for al.running.Load() {
 		select {
@@ -166,34 +424,92 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 			if !ok {
 				continue
 			}
+			al.dispatcher.dispatch(ctx, msg)
+		}
+	}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
-			}
+	return nil
+}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				alreadySent := false
-				if tool, ok := al.tools.Get("message"); ok {
-					if mt, ok := tool.(*tools.MessageTool); ok {
-						alreadySent = mt.HasSentInRound()
-					}
-				}
+// handleInbound runs the agent turn for msg and publishes its reply
+func (al *AgentLoop) handleInbound(ctx context.Context, msg bus.InboundMessage) {
+	// The turn tells whether the message tool already replied
+	turn := &tools.Turn{}
+	response, err := al.processMessage(tools.WithTurn(ctx, turn), msg)
+	if err != nil && ctx.Err() != nil {
+		// Cut short by shutdown; the turn runs again after the restart
+		al.bus.InboundReleased(msg)
+		return
+	}
+	notification := ""
+	if err != nil {
+		// The user gets a reply that fits the kind of error, the details stay in the log
+		logger.ErrorCF("agent", "Error processing message", trace.Fields(ctx, map[string]interface{}{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+			"error":   err.Error(),
+		}))
+		response = errs.UserMessage(err)
+		notification = bus.NotificationError
+	}
 
-				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-					})
-				}
-			}
+	// A caller waiting in bus.Request always gets a reply, even an
+	// empty one
+	if response != "" || msg.CorrelationID != "" {
+		// Check if the message tool already sent a response during this round.
+		// If so, skip publishing to avoid duplicate messages to the user.
+		if !turn.MessageSent() || msg.CorrelationID != "" {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel:       msg.Channel,
+				ChatID:        msg.ChatID,
+				Content:       response,
+				AccountID:     msg.Metadata["account_id"],
+				Notification:  notification,
+				TraceID:       msg.TraceID,
+				CorrelationID: msg.CorrelationID,
+				// A turn run again for the same message, after a
+				// crash, does not answer it twice
+				IdempotencyKey: replyIdempotencyKey(msg),
+			})
 		}
 	}
 
-	return nil
+	// The reply is queued, shutdown can stop waiting for this message
+	al.bus.InboundDone(msg)
+}
+
+// replyIdempotencyKey is the idempotency key of the reply to msg
+func replyIdempotencyKey(msg bus.InboundMessage) string {
+	if msg.TraceID == "" {
+		return ""
+	}
+	return "reply:" + msg.TraceID
+}
+
+// publishLifecycle announces that the agent loop started or stopped
+func (al *AgentLoop) publishLifecycle(state string) {
+	al.bus.PublishEvent(bus.Event{
+		Type:    bus.TopicAgentLifecycle,
+		Source:  "agent",
+		Data:    map[string]string{"state": state, "model": al.model},
+		Payload: bus.AgentLifecycleEvent{State: state, Model: al.model},
+	})
+}
+
+// releaseQuietHours requeues held messages once their quiet window is over
+func (al *AgentLoop) releaseQuietHours(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, msg := range al.quiet.Release() {
+				al.bus.PublishInbound(msg)
+			}
+		}
+	}
 }
 
 func (al *AgentLoop) Stop() {
@@ -208,6 +524,12 @@ func (al *AgentLoop) SetChannelManager(cm *channels.Manager) {
 	al.channelManager = cm
 }
 
+// SessionStoreErr returns why sessions cannot be persisted, or nil when the
+// session store is working. While it is set the agent runs memoryless.
+func (al *AgentLoop) SessionStoreErr() error {
+	return al.sessions.StoreErr()
+}
+
 // RecordLastChannel records the last active channel for this workspace.
 // This uses the atomic state save mechanism to prevent data loss on crash.
 func (al *AgentLoop) RecordLastChannel(channel string) error {
@@ -236,6 +558,14 @@ func (al *AgentLoop) ProcessDirectWithChannel(ctx context.Context, content, sess
 	return al.processMessage(ctx, msg)
 }
 
+// ProcessScratch processes content in a session that starts empty and is
+// never saved, so test prompts leave no history behind
+func (al *AgentLoop) ProcessScratch(ctx context.Context, content, sessionKey string) (string, error) {
+	al.sessions.Fork("", sessionKey)
+	defer al.sessions.Delete(sessionKey)
+	return al.ProcessDirect(ctx, content, sessionKey)
+}
+
 // ProcessHeartbeat processes a heartbeat request without session history.
 // Each heartbeat is independent and doesn't accumulate context.
 func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, chatID string) (string, error) {
@@ -252,6 +582,8 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 }
 
 func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
+	ctx = trace.WithID(ctx, msg.TraceID)
+
 	// Add message preview to log (show full content for error messages)
 	var logContent string
 	if strings.Contains(msg.Content, "Error:") || strings.Contains(msg.Content, "error") {
@@ -265,6 +597,7 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 			"chat_id":     msg.ChatID,
 			"sender_id":   msg.SenderID,
 			"session_key": msg.SessionKey,
+			"trace_id":    msg.TraceID,
 		})
 
 	// Route system messages to processSystemMessage
@@ -272,21 +605,154 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		return al.processSystemMessage(ctx, msg)
 	}
 
+	// Admin commands are answered before anything else, even while paused
+	if response, handled := al.admin.Handle(ctx, msg); handled {
+		return response, nil
+	}
+	if al.paused.IsPaused(msg.Channel) {
+		logger.DebugCF("agent", "Ignoring message while paused", map[string]interface{}{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+		})
+		return "", nil
+	}
+
+	// Guests only ever reach the guest persona
+	if msg.Metadata[channels.MetadataGuest] == "true" {
+		if al.guests == nil {
+			return "", nil
+		}
+		return al.runGuestMessage(ctx, msg)
+	}
+
+	if al.quiet != nil && msg.SenderID != "cron" && !constants.IsInternalChannel(msg.Channel) {
+		if reply, held := al.quiet.Hold(msg); held {
+			logger.InfoCF("agent", "Message held for quiet hours", trace.Fields(ctx, map[string]interface{}{
+				"channel": msg.Channel,
+				"chat_id": msg.ChatID,
+			}))
+			return reply, nil
+		}
+	}
+
+	// Poll votes are tallied for the send_poll tool, not answered
+	if al.recordPollVote(msg) {
+		return "", nil
+	}
+
+	// Approvals of secret requests are answered without the model, which
+	// never sees the secret
+	if al.secrets != nil {
+		if response, handled := al.secrets.HandleReply(ctx, msg.Channel, msg.ChatID, msg.SenderID, userMessageContent(msg)); handled {
+			return response, nil
+		}
+	}
+
 	// Check for commands
 	if response, handled := al.handleCommand(ctx, msg); handled {
 		return response, nil
 	}
 
-	// Process as user message
-	return al.runAgentLoop(ctx, processOptions{
+	// Ask before running tasks projected to exceed the cost threshold.
+	// Scheduled jobs and internal channels have nobody to confirm.
+	if al.costs != nil && msg.SenderID != "cron" && !constants.IsInternalChannel(msg.Channel) {
+		est := al.costs.Estimate(al.model, al.estimatePromptTokens(msg))
+		if al.costs.ExceedsThreshold(est) {
+			al.costs.Hold(msg)
+			logger.InfoCF("agent", "Task held for cost confirmation",
+				map[string]interface{}{
+					"session_key":  msg.SessionKey,
+					"total_tokens": est.TotalTokens(),
+					"cost":         est.Cost,
+				})
+			return formatCostEstimate(al.model, est, al.costs.cfg.Currency), nil
+		}
+	}
+
+	return al.runUserMessage(ctx, msg)
+}
+
+// runUserMessage runs the agent on a message from a user.
+// Inside a fork it runs against the scratch session and marks the answer
+// as hypothetical.
+func (al *AgentLoop) runUserMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
+	scratch, forked := al.forks.scratch(msg.SessionKey)
+	opts := processOptions{
 		SessionKey:      msg.SessionKey,
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
-		UserMessage:     msg.Content,
+		AccountID:       msg.Metadata["account_id"],
+		SenderID:        msg.SenderID,
+		UserMessage:     userMessageContent(msg),
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    false,
+		ReportProgress:  true,
+	}
+	if forked {
+		opts.SessionKey = scratch
+		// The scratch session is thrown away, no need to summarize it
+		opts.EnableSummary = false
+	}
+
+	// Process as user message
+	response, err := al.runAgentLoop(ctx, opts)
+	if err != nil || !forked {
+		return response, err
+	}
+	return forkPrefix + response, nil
+}
+
+// runGuestMessage answers a guest with the guest persona. The model gets no
+// tools and no workspace context, and the history is never saved.
+func (al *AgentLoop) runGuestMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
+	key := guestSessionKey(msg.SessionKey)
+	messages := append([]providers.Message{{Role: "system", Content: al.guests.persona}}, al.sessions.GetHistory(key)...)
+	messages = append(messages, providers.Message{Role: "user", Content: userMessageContent(msg)})
+
+	response, err := al.provider.Chat(ctx, messages, nil, al.model, map[string]interface{}{
+		"max_tokens":  2048,
+		"temperature": 0.7,
 	})
+	if err != nil {
+		return "", err
+	}
+	al.recordUsage(msg.Channel+":"+msg.ChatID, response)
+
+	al.sessions.AddMessage(key, "user", userMessageContent(msg))
+	al.sessions.AddMessage(key, "assistant", response.Content)
+	al.sessions.TruncateHistory(key, al.guests.maxHistory)
+	return response.Content, nil
+}
+
+// userMessageContent returns the text the model sees for a user message.
+// Button presses are marked so the model can tell a choice from typed text.
+func userMessageContent(msg bus.InboundMessage) string {
+	choice, ok := msg.Metadata[channels.MetadataChoice]
+	if !ok {
+		return msg.Content
+	}
+	if label := msg.Metadata[channels.MetadataChoiceLabel]; label != "" && label != choice {
+		return fmt.Sprintf("[Selected option %q] %s", label, choice)
+	}
+	return fmt.Sprintf("[Selected option] %s", choice)
+}
+
+// recordPollVote tallies msg if it is a vote on one of the agent's polls:
+// a native poll answer, or a reply of option numbers in a chat with an
+// open poll
+func (al *AgentLoop) recordPollVote(msg bus.InboundMessage) bool {
+	if al.polls == nil {
+		return false
+	}
+	if pollID, options, ok := channels.PollVote(msg.Metadata); ok {
+		if !al.polls.Vote(pollID, msg.SenderID, options) {
+			logger.DebugCF("agent", "Vote on unknown or closed poll ignored",
+				map[string]interface{}{"poll_id": pollID, "sender_id": msg.SenderID})
+		}
+		return true
+	}
+	return al.polls.VoteByReply(msg.Channel, msg.ChatID, msg.SenderID, msg.Content)
 }
 
 func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
@@ -301,6 +767,17 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 			"chat_id":   msg.ChatID,
 		})
 
+	// Channel lifecycle events are for supervisors; the agent only records them
+	if msg.Metadata["event"] == channels.EventChannelGaveUp {
+		logger.ErrorCF("agent", "Channel gave up reconnecting",
+			map[string]interface{}{
+				"channel":  msg.Metadata["channel"],
+				"attempts": msg.Metadata["attempts"],
+				"error":    msg.Metadata["error"],
+			})
+		return "", nil
+	}
+
 	// Parse origin channel from chat_id (format: "channel:chat_id")
 	var originChannel string
 	if idx := strings.Index(msg.ChatID, ":"); idx > 0 {
@@ -344,6 +821,11 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 // runAgentLoop is the core message processing logic.
 // It handles context building, LLM calls, tool execution, and response handling.
 func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (string, error) {
+	// Direct and heartbeat calls start their own trace
+	if trace.ID(ctx) == "" {
+		ctx = trace.WithID(ctx, trace.NewID())
+	}
+
 	// 0. Record last channel for heartbeat notifications (skip internal channels)
 	if opts.Channel != "" && opts.ChatID != "" {
 		// Don't record internal channels (cli, system, subagent)
@@ -355,19 +837,16 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		}
 	}
 
-	// 1. Update tool contexts
-	al.updateToolContexts(opts.Channel, opts.ChatID)
+	// 1. Tools act on the chat of this turn
+	ctx = withTurn(ctx, opts)
 
 	// 2. Build messages (skip history for heartbeat)
-	var history []providers.Message
-	var summary string
+	var sessionContext session.Context
 	if !opts.NoHistory {
-		history = al.sessions.GetHistory(opts.SessionKey)
-		summary = al.sessions.GetSummary(opts.SessionKey)
+		sessionContext = al.sessions.Context(opts.SessionKey)
 	}
-	messages := al.contextBuilder.BuildMessages(
-		history,
-		summary,
+	messages := al.contextBuilder.BuildSessionMessages(
+		sessionContext,
 		opts.UserMessage,
 		nil,
 		opts.Channel,
@@ -376,6 +855,9 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 
 	// 3. Save user message to session
 	al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+	if al.archive != nil {
+		al.archive.Record(opts, "user", opts.UserMessage)
+	}
 
 	// 4. Run LLM iteration loop
 	finalContent, iteration, err := al.runLLMIteration(ctx, messages, opts)
@@ -393,7 +875,14 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 
 	// 6. Save final assistant message to session
 	al.sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
-	al.sessions.Save(opts.SessionKey)
+	if err := al.sessions.Save(opts.SessionKey); err != nil {
+		finalContent += al.memorylessNotice(opts.SessionKey, err)
+	} else {
+		al.memoryless.Delete(opts.SessionKey)
+	}
+	if al.archive != nil {
+		al.archive.Record(opts, "assistant", finalContent)
+	}
 
 	// 7. Optional: summarization
 	if opts.EnableSummary {
@@ -403,30 +892,55 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 	// 8. Optional: send response via bus
 	if opts.SendResponse {
 		al.bus.PublishOutbound(bus.OutboundMessage{
-			Channel: opts.Channel,
-			ChatID:  opts.ChatID,
-			Content: finalContent,
+			Channel:   opts.Channel,
+			ChatID:    opts.ChatID,
+			Content:   finalContent,
+			AccountID: opts.AccountID,
+			TraceID:   trace.ID(ctx),
 		})
 	}
 
 	// 9. Log response
 	responsePreview := utils.Truncate(finalContent, 120)
 	logger.InfoCF("agent", fmt.Sprintf("Response: %s", responsePreview),
-		map[string]interface{}{
+		trace.Fields(ctx, map[string]interface{}{
 			"session_key":  opts.SessionKey,
 			"iterations":   iteration,
 			"final_length": len(finalContent),
-		})
+		}))
 
 	return finalContent, nil
 }
 
+// memorylessNotice returns the warning appended to the first reply of a
+// session after the session store fails; the conversation continues from
+// memory but is lost on restart
+func (al *AgentLoop) memorylessNotice(sessionKey string, err error) string {
+	if _, warned := al.memoryless.LoadOrStore(sessionKey, true); warned {
+		return ""
+	}
+	logger.WarnCF("agent", "Session store unavailable, running memoryless", map[string]interface{}{
+		"session_key": sessionKey,
+		"error":       err.Error(),
+	})
+	return "\n\n(Note: I can't save our conversation right now, so I'll forget it if I restart.)"
+}
+
 // runLLMIteration executes the LLM call loop with tool handling.
 // Returns the final content, iteration count, and any error.
 func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.Message, opts processOptions) (string, int, error) {
 	iteration := 0
 	var finalContent string
 
+	// Start the tool calls the model will likely ask for while it thinks
+	prefetched := al.prefetch.Start(ctx, opts.UserMessage)
+	defer prefetched.Close()
+
+	var progress *taskProgress
+	if al.progress != nil && opts.ReportProgress && !constants.IsInternalChannel(opts.Channel) {
+		progress = al.progress.start(opts.Channel)
+	}
+
 	for iteration < al.maxIterations {
 		iteration++
 
@@ -441,7 +955,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 
 		// Log LLM request details
 		logger.DebugCF("agent", "LLM request",
-			map[string]interface{}{
+			trace.Fields(ctx, map[string]interface{}{
 				"iteration":         iteration,
 				"model":             al.model,
 				"messages_count":    len(messages),
@@ -449,7 +963,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				"max_tokens":        8192,
 				"temperature":       0.7,
 				"system_prompt_len": len(messages[0].Content),
-			})
+			}))
 
 		// Log full messages (detailed)
 		logger.DebugCF("agent", "Full LLM request",
@@ -471,6 +985,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			})
 
 			if err == nil {
+				al.recordUsage(opts.Channel+":"+opts.ChatID, response)
 				break // Success
 			}
 
@@ -482,17 +997,20 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				strings.Contains(errMsg, "length")
 
 			if isContextError && retry < maxRetries {
-				logger.WarnCF("agent", "Context window error detected, attempting compression", map[string]interface{}{
+				logger.WarnCF("agent", "Context window error detected, attempting compression", trace.Fields(ctx, map[string]interface{}{
 					"error": err.Error(),
 					"retry": retry,
-				})
+				}))
 
 				// Notify user on first retry only
 				if retry == 0 && !constants.IsInternalChannel(opts.Channel) && opts.SendResponse {
 					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: opts.Channel,
-						ChatID:  opts.ChatID,
-						Content: "⚠️ Context window exceeded. Compressing history and retrying...",
+						Channel:      opts.Channel,
+						ChatID:       opts.ChatID,
+						Content:      "⚠️ Context window exceeded. Compressing history and retrying...",
+						AccountID:    opts.AccountID,
+						TraceID:      trace.ID(ctx),
+						Notification: bus.NotificationError,
 					})
 				}
 
@@ -501,14 +1019,12 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 
 				// Rebuild messages with compressed history
 				// Note: We need to reload history from session manager because forceCompression changed it
-				newHistory := al.sessions.GetHistory(opts.SessionKey)
-				newSummary := al.sessions.GetSummary(opts.SessionKey)
+				compressed := al.sessions.Context(opts.SessionKey)
 
 				// Re-create messages for the next attempt
 				// We keep the current user message (opts.UserMessage) effectively
-				messages = al.contextBuilder.BuildMessages(
-					newHistory,
-					newSummary,
+				messages = al.contextBuilder.BuildSessionMessages(
+					compressed,
 					opts.UserMessage,
 					nil,
 					opts.Channel,
@@ -569,9 +1085,8 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				// We pass empty string as "currentMessage" to BuildMessages
 				// because the "current message" is already saved in history (step 3).
 
-				messages = al.contextBuilder.BuildMessages(
-					newHistory,
-					newSummary,
+				messages = al.contextBuilder.BuildSessionMessages(
+					compressed,
 					"", // Empty because history already contains the relevant messages
 					nil,
 					opts.Channel,
@@ -665,14 +1180,24 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				}
 			}
 
-			toolResult := al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			if progress != nil {
+				al.sendProgress(ctx, opts, progress.toolStarted(tc.Name, tc.Arguments))
+			}
 
-			// Send ForUser content to user immediately if not Silent
-			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
+			toolResult, ok := prefetched.Take(ctx, tc.Name, tc.Arguments)
+			if !ok {
+				toolResult = al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			}
+
+			// Send ForUser content and cards to user immediately if not Silent
+			if !toolResult.Silent && (toolResult.ForUser != "" || toolResult.Card != nil) && opts.SendResponse {
 				al.bus.PublishOutbound(bus.OutboundMessage{
-					Channel: opts.Channel,
-					ChatID:  opts.ChatID,
-					Content: toolResult.ForUser,
+					Channel:   opts.Channel,
+					ChatID:    opts.ChatID,
+					Content:   toolResult.ForUser,
+					AccountID: opts.AccountID,
+					Card:      toolResult.Card,
+					TraceID:   trace.ID(ctx),
 				})
 				logger.DebugCF("agent", "Sent tool result to user",
 					map[string]interface{}{
@@ -686,6 +1211,9 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			if contentForLLM == "" && toolResult.Err != nil {
 				contentForLLM = toolResult.Err.Error()
 			}
+			if progress != nil && toolResult.IsError {
+				al.sendProgress(ctx, opts, progress.toolFailed(tc.Name, contentForLLM))
+			}
 
 			toolResultMsg := providers.Message{
 				Role:       "tool",
@@ -702,24 +1230,16 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 	return finalContent, iteration, nil
 }
 
-// updateToolContexts updates the context for tools that need channel/chatID info.
-func (al *AgentLoop) updateToolContexts(channel, chatID string) {
-	// Use ContextualTool interface instead of type assertions
-	if tool, ok := al.tools.Get("message"); ok {
-		if mt, ok := tool.(tools.ContextualTool); ok {
-			mt.SetContext(channel, chatID)
-		}
-	}
-	if tool, ok := al.tools.Get("spawn"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
-		}
-	}
-	if tool, ok := al.tools.Get("subagent"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
-		}
+// withTurn returns ctx carrying the turn answering opts, reusing the one
+// handleInbound started so it can tell whether the message tool replied
+func withTurn(ctx context.Context, opts processOptions) context.Context {
+	turn := tools.TurnFrom(ctx)
+	if turn == nil {
+		turn = &tools.Turn{}
+		ctx = tools.WithTurn(ctx, turn)
 	}
+	turn.Channel, turn.ChatID, turn.SenderID = opts.Channel, opts.ChatID, opts.SenderID
+	return ctx
 }
 
 // maybeSummarize triggers summarization if the session history exceeds thresholds.
@@ -735,9 +1255,10 @@ func (al *AgentLoop) maybeSummarize(sessionKey, channel, chatID string) {
 				// Notify user about optimization if not an internal channel
 				if !constants.IsInternalChannel(channel) {
 					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: channel,
-						ChatID:  chatID,
-						Content: "⚠️ Memory threshold reached. Optimizing conversation history...",
+						Channel:      channel,
+						ChatID:       chatID,
+						Content:      "⚠️ Memory threshold reached. Optimizing conversation history...",
+						Notification: bus.NotificationError,
 					})
 				}
 				al.summarizeSession(sessionKey)
@@ -823,6 +1344,21 @@ func (al *AgentLoop) GetStartupInfo() map[string]interface{} {
 	return info
 }
 
+// sendProgress sends an update line to the chat of a task, if there is one
+func (al *AgentLoop) sendProgress(ctx context.Context, opts processOptions, line string) {
+	if line == "" {
+		return
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:   opts.Channel,
+		ChatID:    opts.ChatID,
+		Content:   line,
+		AccountID: opts.AccountID,
+		TraceID:   trace.ID(ctx),
+		Progress:  true,
+	})
+}
+
 // formatMessagesForLog formats messages for logging
 func formatMessagesForLog(messages []providers.Message) string {
 	if len(messages) == 0 {
@@ -920,8 +1456,8 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 		part1 := validMessages[:mid]
 		part2 := validMessages[mid:]
 
-		s1, _ := al.summarizeBatch(ctx, part1, "")
-		s2, _ := al.summarizeBatch(ctx, part2, "")
+		s1, _ := al.summarizeBatch(ctx, sessionKey, part1, "")
+		s2, _ := al.summarizeBatch(ctx, sessionKey, part2, "")
 
 		// Merge them
 		mergePrompt := fmt.Sprintf("Merge these two conversation summaries into one cohesive summary:\n\n1: %s\n\n2: %s", s1, s2)
@@ -930,12 +1466,13 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 			"temperature": 0.3,
 		})
 		if err == nil {
+			al.recordUsage(sessionKey, resp)
 			finalSummary = resp.Content
 		} else {
 			finalSummary = s1 + " " + s2
 		}
 	} else {
-		finalSummary, _ = al.summarizeBatch(ctx, validMessages, summary)
+		finalSummary, _ = al.summarizeBatch(ctx, sessionKey, validMessages, summary)
 	}
 
 	if omitted && finalSummary != "" {
@@ -950,7 +1487,7 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 }
 
 // summarizeBatch summarizes a batch of messages.
-func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Message, existingSummary string) (string, error) {
+func (al *AgentLoop) summarizeBatch(ctx context.Context, sessionKey string, batch []providers.Message, existingSummary string) (string, error) {
 	prompt := "Provide a concise summary of this conversation segment, preserving core context and key points.\n"
 	if existingSummary != "" {
 		prompt += "Existing context: " + existingSummary + "\n"
@@ -967,9 +1504,18 @@ func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Messa
 	if err != nil {
 		return "", err
 	}
+	al.recordUsage(sessionKey, response)
 	return response.Content, nil
 }
 
+// recordUsage adds the tokens of a model call to the usage ledger
+func (al *AgentLoop) recordUsage(chat string, response *providers.LLMResponse) {
+	if al.usage == nil || response == nil || response.Usage == nil {
+		return
+	}
+	al.usage.Record(al.model, chat, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+}
+
 // estimateTokens estimates the number of tokens in a message list.
 // Uses a safe heuristic of 2.5 characters per token to account for CJK and other
 // overheads better than the previous 3 chars/token.
@@ -999,13 +1545,18 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 	switch cmd {
 	case "/show":
 		if len(args) < 1 {
-			return "Usage: /show [model|channel]", true
+			return "Usage: /show [model|channel|prefetch]", true
 		}
 		switch args[0] {
 		case "model":
 			return fmt.Sprintf("Current model: %s", al.model), true
 		case "channel":
 			return fmt.Sprintf("Current channel: %s", msg.Channel), true
+		case "prefetch":
+			if al.prefetch == nil {
+				return "Tool prefetch is disabled", true
+			}
+			return formatPrefetchStats(al.prefetch.Stats()), true
 		default:
 			return fmt.Sprintf("Unknown show target: %s", args[0]), true
 		}
@@ -1060,6 +1611,71 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 		default:
 			return fmt.Sprintf("Unknown switch target: %s", target), true
 		}
+
+	case "/ack", "/resolve":
+		if al.channelManager == nil {
+			return "Channel manager not initialized", true
+		}
+		ch, exists := al.channelManager.GetChannel("alert_webhook")
+		responder, ok := ch.(channels.IncidentResponder)
+		if !exists || !ok {
+			return "No incident platform configured", true
+		}
+		ref := ""
+		if len(args) > 0 {
+			ref = args[0]
+		}
+		var result string
+		var err error
+		if cmd == "/ack" {
+			result, err = responder.AcknowledgeIncident(ctx, ref, msg.Channel, msg.ChatID)
+		} else {
+			result, err = responder.ResolveIncident(ctx, ref, msg.Channel, msg.ChatID)
+		}
+		if err != nil {
+			return fmt.Sprintf("Failed to %s incident: %v", strings.TrimPrefix(cmd, "/"), err), true
+		}
+		return result, true
+
+	case "/fork":
+		if len(args) > 0 && args[0] == "end" {
+			scratch, ok := al.forks.end(msg.SessionKey)
+			if !ok {
+				return "This conversation is not forked", true
+			}
+			al.sessions.Delete(scratch)
+			return "Fork discarded, back to the main conversation", true
+		}
+		if len(args) > 0 {
+			return "Usage: /fork [end]", true
+		}
+		scratch, ok := al.forks.start(msg.SessionKey)
+		if !ok {
+			return "Already in a fork. Use /fork end to return to the main conversation", true
+		}
+		al.sessions.Fork(msg.SessionKey, scratch)
+		return "Forked the conversation. Ask your what-if questions; nothing is kept once you /fork end", true
+
+	case "/confirm", "/cancel":
+		if al.costs == nil {
+			return "", false
+		}
+		pending, ok := al.costs.Release(msg.SessionKey)
+		if !ok {
+			return "No task is waiting for confirmation", true
+		}
+		if cmd == "/cancel" {
+			return "Cancelled", true
+		}
+		response, err := al.runUserMessage(ctx, pending)
+		if err != nil {
+			logger.ErrorCF("agent", "Error processing confirmed task", trace.Fields(ctx, map[string]interface{}{
+				"channel": msg.Channel,
+				"error":   err.Error(),
+			}))
+			return errs.UserMessage(err), true
+		}
+		return response, true
 	}
 
 	return "", false
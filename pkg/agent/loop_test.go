@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/tools"
@@ -624,3 +626,63 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+func TestUserMessageContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		want     string
+	}{
+		{"typed text", nil, "deploy"},
+		{"button with label", map[string]string{channels.MetadataChoice: "deploy", channels.MetadataChoiceLabel: "Yes"}, `[Selected option "Yes"] deploy`},
+		{"button without label", map[string]string{channels.MetadataChoice: "deploy"}, "[Selected option] deploy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := userMessageContent(bus.InboundMessage{Content: "deploy", Metadata: tt.metadata})
+			if got != tt.want {
+				t.Errorf("userMessageContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordPollVote(t *testing.T) {
+	al := &AgentLoop{polls: tools.NewPollBook()}
+	poll := al.polls.Open("telegram", "42", bus.Poll{Question: "Lunch?", Options: []string{"Pizza", "Sushi"}})
+
+	native := bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "7", Content: "Voted Sushi",
+		Metadata: map[string]string{channels.MetadataPollID: poll.ID, channels.MetadataPollVotes: "1"}}
+	if !al.recordPollVote(native) {
+		t.Error("native poll answers should be tallied")
+	}
+	if !al.recordPollVote(bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "8", Content: "2"}) {
+		t.Error("number replies should be tallied while the poll is open")
+	}
+	if al.recordPollVote(bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "8", Content: "what about dinner?"}) {
+		t.Error("other messages should reach the agent")
+	}
+
+	results, _ := al.polls.Results(poll.ID, "", "")
+	if !strings.Contains(results, "2. Sushi: 2 votes") {
+		t.Errorf("unexpected results %q", results)
+	}
+}
+
+func TestNewPayloadLoggerRedactsConfiguredSecrets(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.ProviderDebugLog.Key = "passphrase"
+	cfg.AI.Providers = []config.ProviderConfig{
+		{Name: "proxy", APIKey: "plain-proxy-key-42", Headers: map[string]string{"X-Gateway": "gateway-token-7"}},
+	}
+
+	payloadLog := newPayloadLogger(cfg, t.TempDir())
+	if payloadLog == nil {
+		t.Fatal("payload logger not created")
+	}
+	got := payloadLog.Redact("key plain-proxy-key-42, header gateway-token-7")
+	if strings.Contains(got, "plain-proxy-key-42") || strings.Contains(got, "gateway-token-7") {
+		t.Errorf("Redact = %q", got)
+	}
+}
@@ -0,0 +1,267 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// defaultPrefetchTimeout bounds a prefetched tool call
+const defaultPrefetchTimeout = 30 * time.Second
+
+// prefetchSafeTools are the tools without side effects, the only ones that may
+// run before the model asks for them
+var prefetchSafeTools = map[string]bool{
+	"web_fetch":  true,
+	"web_search": true,
+	"read_file":  true,
+	"list_dir":   true,
+}
+
+// ToolPrediction is a tool call the model is expected to make
+type ToolPrediction struct {
+	Tool string
+	Args map[string]interface{}
+}
+
+// ToolPredictor guesses the tool calls the model will make for a user
+// message. It runs before every request, so it must be cheap.
+type ToolPredictor interface {
+	Predict(message string) []ToolPrediction
+}
+
+// KeywordPredictor predicts tool calls from the keyword rules of the config
+type KeywordPredictor struct {
+	rules []config.ToolPrefetchRule
+}
+
+// NewKeywordPredictor creates a predictor from keyword rules
+func NewKeywordPredictor(rules []config.ToolPrefetchRule) *KeywordPredictor {
+	return &KeywordPredictor{rules: rules}
+}
+
+// Predict returns the calls of every rule with a keyword in the message
+func (p *KeywordPredictor) Predict(message string) []ToolPrediction {
+	lower := strings.ToLower(message)
+
+	var predictions []ToolPrediction
+	for _, rule := range p.rules {
+		for _, kw := range rule.Keywords {
+			if kw != "" && strings.Contains(lower, strings.ToLower(kw)) {
+				predictions = append(predictions, ToolPrediction{Tool: rule.Tool, Args: expandPrefetchArgs(rule.Args, message)})
+				break
+			}
+		}
+	}
+	return predictions
+}
+
+// expandPrefetchArgs replaces {message} in string arguments
+func expandPrefetchArgs(args map[string]interface{}, message string) map[string]interface{} {
+	expanded := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if s, ok := v.(string); ok {
+			v = strings.ReplaceAll(s, "{message}", message)
+		}
+		expanded[k] = v
+	}
+	return expanded
+}
+
+// PrefetchStats measures how useful prefetching is
+type PrefetchStats struct {
+	Started int64 // Prefetched tool calls
+	Hits    int64 // Prefetched results the model asked for
+	Wasted  int64 // Prefetched results nobody used
+	SavedMS int64 // Tool time hidden behind the LLM request
+}
+
+// toolExecutor runs a tool call
+type toolExecutor func(ctx context.Context, name string, args map[string]interface{}) *tools.ToolResult
+
+// toolPrefetcher runs predicted tool calls alongside the LLM request
+type toolPrefetcher struct {
+	mu        sync.RWMutex
+	predictor ToolPredictor
+	execute   toolExecutor
+	timeout   time.Duration
+
+	started, hits, wasted, savedMS atomic.Int64
+}
+
+func newToolPrefetcher(cfg config.ToolPrefetchConfig, execute toolExecutor) *toolPrefetcher {
+	timeout := defaultPrefetchTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return &toolPrefetcher{
+		predictor: NewKeywordPredictor(cfg.Rules),
+		execute:   execute,
+		timeout:   timeout,
+	}
+}
+
+// SetPredictor replaces the predictor
+func (p *toolPrefetcher) SetPredictor(predictor ToolPredictor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.predictor = predictor
+}
+
+// Stats returns the prefetch counters
+func (p *toolPrefetcher) Stats() PrefetchStats {
+	return PrefetchStats{
+		Started: p.started.Load(),
+		Hits:    p.hits.Load(),
+		Wasted:  p.wasted.Load(),
+		SavedMS: p.savedMS.Load(),
+	}
+}
+
+// prefetchEntry is one prefetched tool call
+type prefetchEntry struct {
+	tool     string
+	key      string
+	done     chan struct{}
+	result   *tools.ToolResult
+	duration time.Duration
+	used     bool
+}
+
+// prefetchBatch holds the prefetched calls for one user message
+type prefetchBatch struct {
+	p       *toolPrefetcher
+	ctx     context.Context // Bounds the prefetched calls
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	entries []*prefetchEntry
+}
+
+// Start runs the calls predicted for message. It returns nil when nothing
+// is predicted; a nil batch is safe to use.
+func (p *toolPrefetcher) Start(ctx context.Context, message string) *prefetchBatch {
+	if p == nil || message == "" {
+		return nil
+	}
+
+	p.mu.RLock()
+	predictions := p.predictor.Predict(message)
+	p.mu.RUnlock()
+
+	var batch *prefetchBatch
+	for _, pred := range predictions {
+		if !prefetchSafeTools[pred.Tool] {
+			logger.WarnCF("agent", "Skipping prefetch of a tool with side effects",
+				map[string]interface{}{"tool": pred.Tool})
+			continue
+		}
+		key, err := prefetchKey(pred.Tool, pred.Args)
+		if err != nil {
+			continue
+		}
+
+		if batch == nil {
+			batchCtx, cancel := context.WithTimeout(ctx, p.timeout)
+			batch = &prefetchBatch{p: p, ctx: batchCtx, cancel: cancel}
+		}
+		entry := &prefetchEntry{tool: pred.Tool, key: key, done: make(chan struct{})}
+		batch.entries = append(batch.entries, entry)
+		p.started.Add(1)
+
+		go func(args map[string]interface{}) {
+			defer close(entry.done)
+			start := time.Now()
+			entry.result = p.execute(batch.ctx, entry.tool, args)
+			entry.duration = time.Since(start)
+		}(pred.Args)
+	}
+	return batch
+}
+
+// Take returns the prefetched result of a call the model made, waiting for
+// it if it is still running. Each prefetched result is used at most once.
+func (b *prefetchBatch) Take(ctx context.Context, tool string, args map[string]interface{}) (*tools.ToolResult, bool) {
+	if b == nil {
+		return nil, false
+	}
+	key, err := prefetchKey(tool, args)
+	if err != nil {
+		return nil, false
+	}
+
+	b.mu.Lock()
+	var entry *prefetchEntry
+	for _, e := range b.entries {
+		if !e.used && e.key == key {
+			e.used = true
+			entry = e
+			break
+		}
+	}
+	b.mu.Unlock()
+	if entry == nil {
+		return nil, false
+	}
+
+	waitStart := time.Now()
+	select {
+	case <-entry.done:
+	case <-ctx.Done():
+		return nil, false
+	}
+	// A call that failed because the prefetch timed out is run again for real
+	if entry.result == nil || entry.result.IsError && b.ctx.Err() != nil {
+		return nil, false
+	}
+
+	saved := entry.duration - time.Since(waitStart)
+	if saved < 0 {
+		saved = 0
+	}
+	b.p.hits.Add(1)
+	b.p.savedMS.Add(saved.Milliseconds())
+	logger.DebugCF("agent", "Used prefetched tool result",
+		map[string]interface{}{"tool": tool, "saved_ms": saved.Milliseconds()})
+	return entry.result, true
+}
+
+// Close cancels the calls still running and counts the unused ones
+func (b *prefetchBatch) Close() {
+	if b == nil {
+		return
+	}
+	b.cancel()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range b.entries {
+		if !e.used {
+			e.used = true
+			b.p.wasted.Add(1)
+		}
+	}
+}
+
+// prefetchKey identifies a call by tool name and arguments. encoding/json
+// sorts map keys, so equal arguments give equal keys.
+func prefetchKey(tool string, args map[string]interface{}) (string, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", fmt.Errorf("prefetch key: %w", err)
+	}
+	return tool + "\x00" + string(data), nil
+}
+
+// formatPrefetchStats renders the counters for /show prefetch
+func formatPrefetchStats(s PrefetchStats) string {
+	return fmt.Sprintf("Tool prefetch: %d started, %d used, %d wasted, %.1fs saved",
+		s.Started, s.Hits, s.Wasted, float64(s.SavedMS)/1000)
+}
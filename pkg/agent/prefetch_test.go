@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestKeywordPredictor(t *testing.T) {
+	p := NewKeywordPredictor([]config.ToolPrefetchRule{
+		{Keywords: []string{"weather", "forecast"}, Tool: "web_fetch", Args: map[string]interface{}{"url": "https://wttr.in/?format=3"}},
+		{Keywords: []string{"news"}, Tool: "web_search", Args: map[string]interface{}{"query": "{message}", "count": 5.0}},
+	})
+
+	tests := []struct {
+		message string
+		want    []ToolPrediction
+	}{
+		{"What's the Weather like?", []ToolPrediction{{Tool: "web_fetch", Args: map[string]interface{}{"url": "https://wttr.in/?format=3"}}}},
+		{"latest news", []ToolPrediction{{Tool: "web_search", Args: map[string]interface{}{"query": "latest news", "count": 5.0}}}},
+		{"write me a poem", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := p.Predict(tt.message); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Predict(%q) = %+v, want %+v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+type fixedPredictor []ToolPrediction
+
+func (p fixedPredictor) Predict(string) []ToolPrediction { return p }
+
+func TestToolPrefetcher(t *testing.T) {
+	var calls atomic.Int32
+	execute := func(ctx context.Context, name string, args map[string]interface{}) *tools.ToolResult {
+		calls.Add(1)
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return tools.NewToolResult("sunny")
+		case <-ctx.Done():
+			return tools.ErrorResult("cancelled")
+		}
+	}
+
+	p := newToolPrefetcher(config.ToolPrefetchConfig{}, execute)
+	p.SetPredictor(fixedPredictor{
+		{Tool: "web_fetch", Args: map[string]interface{}{"url": "https://wttr.in/"}},
+		{Tool: "web_search", Args: map[string]interface{}{"query": "unused"}},
+		{Tool: "exec", Args: map[string]interface{}{"command": "rm -rf /"}},
+	})
+
+	ctx := context.Background()
+	batch := p.Start(ctx, "weather?")
+	time.Sleep(60 * time.Millisecond) // The LLM request
+
+	if _, ok := batch.Take(ctx, "web_fetch", map[string]interface{}{"url": "https://other/"}); ok {
+		t.Error("different arguments should not use the prefetched result")
+	}
+	result, ok := batch.Take(ctx, "web_fetch", map[string]interface{}{"url": "https://wttr.in/"})
+	if !ok || result.ForLLM != "sunny" {
+		t.Fatalf("expected the prefetched result, got %+v, %v", result, ok)
+	}
+	if _, ok := batch.Take(ctx, "web_fetch", map[string]interface{}{"url": "https://wttr.in/"}); ok {
+		t.Error("a prefetched result should only be used once")
+	}
+	batch.Close()
+
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 prefetched calls (exec is never prefetched), got %d", calls.Load())
+	}
+	stats := p.Stats()
+	if stats.Started != 2 || stats.Hits != 1 || stats.Wasted != 1 || stats.SavedMS < 40 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// Nothing predicted: the nil batch is a no-op
+	p.SetPredictor(fixedPredictor{})
+	empty := p.Start(ctx, "hello")
+	if _, ok := empty.Take(ctx, "web_fetch", nil); ok {
+		t.Error("empty batch should not return results")
+	}
+	empty.Close()
+}
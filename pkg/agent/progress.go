@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	progressSilent     = "silent"
+	progressMilestones = "milestones"
+	progressVerbose    = "verbose"
+)
+
+// progressPreviewLen bounds the arguments and errors shown in updates
+const progressPreviewLen = 80
+
+// progressReporter picks the tool events of a task that are sent to the
+// user as progress updates, by the verbosity of the task's channel
+type progressReporter struct {
+	verbosity string
+	channels  map[string]string
+}
+
+// newProgressReporter returns nil when every channel is silent
+func newProgressReporter(cfg config.ProgressConfig) *progressReporter {
+	p := &progressReporter{
+		verbosity: progressVerbosity(cfg.Verbosity, ""),
+		channels:  make(map[string]string, len(cfg.Channels)),
+	}
+	loud := p.verbosity != progressSilent
+	for channel, verbosity := range cfg.Channels {
+		p.channels[channel] = progressVerbosity(verbosity, channel)
+		loud = loud || p.channels[channel] != progressSilent
+	}
+	if !loud {
+		return nil
+	}
+	return p
+}
+
+// progressVerbosity validates a configured verbosity; unknown ones are silent
+func progressVerbosity(verbosity, channel string) string {
+	switch verbosity {
+	case "", progressSilent:
+		return progressSilent
+	case progressMilestones, progressVerbose:
+		return verbosity
+	}
+	logger.WarnCF("agent", "Unknown progress verbosity, staying silent", map[string]interface{}{
+		"verbosity": verbosity,
+		"channel":   channel,
+	})
+	return progressSilent
+}
+
+// start returns the progress of a task answering on channel, or nil when
+// the channel is silent
+func (p *progressReporter) start(channel string) *taskProgress {
+	verbosity, ok := p.channels[channel]
+	if !ok {
+		verbosity = p.verbosity
+	}
+	if verbosity == progressSilent {
+		return nil
+	}
+	return &taskProgress{verbose: verbosity == progressVerbose, used: make(map[string]bool)}
+}
+
+// taskProgress turns the tool events of one task into update lines
+type taskProgress struct {
+	verbose bool
+	used    map[string]bool // Tools reported so far
+}
+
+// toolStarted returns the update for a tool call, or "" when it is not
+// reported. Milestones report each tool once per task.
+func (t *taskProgress) toolStarted(name string, args map[string]interface{}) string {
+	if name == "message" {
+		// The user sees what the message tool sends
+		return ""
+	}
+	if t.verbose {
+		argsJSON, _ := json.Marshal(args)
+		return fmt.Sprintf("⏳ %s %s", name, utils.Truncate(string(argsJSON), progressPreviewLen))
+	}
+	if t.used[name] {
+		return ""
+	}
+	t.used[name] = true
+	return fmt.Sprintf("⏳ Using %s…", name)
+}
+
+// toolFailed returns the update for a failed tool call; only verbose
+// progress reports failures
+func (t *taskProgress) toolFailed(name, reason string) string {
+	if !t.verbose {
+		return ""
+	}
+	return fmt.Sprintf("⚠️ %s failed: %s", name, utils.Truncate(reason, progressPreviewLen))
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestNewProgressReporter(t *testing.T) {
+	if p := newProgressReporter(config.ProgressConfig{}); p != nil {
+		t.Error("progress should be disabled by default")
+	}
+	if p := newProgressReporter(config.ProgressConfig{Verbosity: "chatty"}); p != nil {
+		t.Error("an unknown verbosity should stay silent")
+	}
+
+	p := newProgressReporter(config.ProgressConfig{Channels: map[string]string{"telegram": progressVerbose}})
+	if p == nil {
+		t.Fatal("a channel with updates should enable progress")
+	}
+	if p.start("slack") != nil {
+		t.Error("channels without their own verbosity should use the silent default")
+	}
+	if task := p.start("telegram"); task == nil || !task.verbose {
+		t.Errorf("telegram progress = %+v, want verbose", task)
+	}
+}
+
+func TestTaskProgressMilestones(t *testing.T) {
+	task := newProgressReporter(config.ProgressConfig{Verbosity: progressMilestones}).start("telegram")
+
+	if got := task.toolStarted("web_search", map[string]interface{}{"query": "weather"}); got != "⏳ Using web_search…" {
+		t.Errorf("first call = %q", got)
+	}
+	if got := task.toolStarted("web_search", nil); got != "" {
+		t.Errorf("repeated tools should not be reported, got %q", got)
+	}
+	if got := task.toolStarted("message", nil); got != "" {
+		t.Errorf("the message tool should not be reported, got %q", got)
+	}
+	if got := task.toolFailed("web_search", "timeout"); got != "" {
+		t.Errorf("milestones should not report failures, got %q", got)
+	}
+}
+
+func TestTaskProgressVerbose(t *testing.T) {
+	task := newProgressReporter(config.ProgressConfig{Verbosity: progressVerbose}).start("telegram")
+
+	args := map[string]interface{}{"path": "notes.md"}
+	for i := 0; i < 2; i++ {
+		if got := task.toolStarted("read_file", args); got != `⏳ read_file {"path":"notes.md"}` {
+			t.Errorf("call %d = %q", i, got)
+		}
+	}
+	if got := task.toolFailed("read_file", "file not found"); got != "⚠️ read_file failed: file not found" {
+		t.Errorf("failure = %q", got)
+	}
+}
@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adhocore/gronx"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	quietPolicyQueue = "queue"
+	quietPolicyDrop  = "drop"
+)
+
+// quietHours holds back messages that arrive during a configured quiet
+// window. Queued messages are processed once their window has ended;
+// dropped messages are discarded.
+type quietHours struct {
+	rules []config.QuietHoursRule
+	loc   *time.Location
+	gron  *gronx.Gronx
+
+	mu       sync.Mutex
+	queued   []bus.InboundMessage
+	awaySent map[string]bus.InboundMessage // channel:chat_id -> message that got the away reply
+	now      func() time.Time
+}
+
+// newQuietHours returns nil when quiet hours are disabled or no rule has a
+// valid schedule.
+func newQuietHours(cfg config.QuietHoursConfig) *quietHours {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	loc := time.Local
+	if cfg.Timezone != "" {
+		l, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			logger.WarnCF("agent", "Invalid quiet hours timezone, using local time", map[string]interface{}{
+				"timezone": cfg.Timezone,
+				"error":    err.Error(),
+			})
+		} else {
+			loc = l
+		}
+	}
+
+	gron := gronx.New()
+	rules := make([]config.QuietHoursRule, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		if !gron.IsValid(rule.When) {
+			logger.WarnCF("agent", "Ignoring quiet hours rule with invalid schedule", map[string]interface{}{
+				"when": rule.When,
+			})
+			continue
+		}
+		if rule.Policy == "" {
+			rule.Policy = quietPolicyQueue
+		}
+		if rule.Policy != quietPolicyQueue && rule.Policy != quietPolicyDrop {
+			logger.WarnCF("agent", "Ignoring quiet hours rule with unknown policy", map[string]interface{}{
+				"policy": rule.Policy,
+			})
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	return &quietHours{
+		rules:    rules,
+		loc:      loc,
+		gron:     gron,
+		awaySent: make(map[string]bus.InboundMessage),
+		now:      time.Now,
+	}
+}
+
+// match returns the first rule that covers msg and whose window is active
+func (q *quietHours) match(msg bus.InboundMessage) (config.QuietHoursRule, bool) {
+	// gronx checks schedules with second precision, so look at the start of
+	// the current minute
+	ref := q.now().In(q.loc).Truncate(time.Minute)
+	id, _, _ := strings.Cut(msg.SenderID, "|")
+
+	for _, rule := range q.rules {
+		if rule.Channel != "" && rule.Channel != msg.Channel {
+			continue
+		}
+		if rule.Contact != "" && rule.Contact != msg.ChatID && rule.Contact != msg.SenderID && rule.Contact != id {
+			continue
+		}
+		if due, err := q.gron.IsDue(rule.When, ref); err == nil && due {
+			return rule, true
+		}
+	}
+	return config.QuietHoursRule{}, false
+}
+
+// Hold queues or drops msg when it falls inside a quiet window. It returns
+// the away message to send, which is only sent once per chat and window.
+func (q *quietHours) Hold(msg bus.InboundMessage) (string, bool) {
+	rule, ok := q.match(msg)
+	if !ok {
+		return "", false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if rule.Policy == quietPolicyQueue {
+		q.queued = append(q.queued, msg)
+	}
+
+	key := msg.Channel + ":" + msg.ChatID
+	if _, sent := q.awaySent[key]; rule.AwayMessage == "" || sent {
+		return "", true
+	}
+	q.awaySent[key] = msg
+	return rule.AwayMessage, true
+}
+
+// Release returns the queued messages whose quiet window has ended
+func (q *quietHours) Release() []bus.InboundMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var released []bus.InboundMessage
+	kept := q.queued[:0]
+	for _, msg := range q.queued {
+		if _, quiet := q.match(msg); quiet {
+			kept = append(kept, msg)
+			continue
+		}
+		released = append(released, msg)
+	}
+	q.queued = kept
+
+	// A chat whose window is over gets the away message again next time
+	for key, msg := range q.awaySent {
+		if _, quiet := q.match(msg); !quiet {
+			delete(q.awaySent, key)
+		}
+	}
+	return released
+}
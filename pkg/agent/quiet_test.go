@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestQuietHours(t *testing.T, rules ...config.QuietHoursRule) (*quietHours, *time.Time) {
+	t.Helper()
+	q := newQuietHours(config.QuietHoursConfig{Enabled: true, Timezone: "UTC", Rules: rules})
+	if q == nil {
+		t.Fatal("expected quiet hours to be enabled")
+	}
+	now := time.Date(2026, 3, 2, 23, 30, 15, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	return q, &now
+}
+
+func TestNewQuietHoursDisabled(t *testing.T) {
+	rule := config.QuietHoursRule{When: "* 22-23 * * *"}
+	if newQuietHours(config.QuietHoursConfig{Rules: []config.QuietHoursRule{rule}}) != nil {
+		t.Error("disabled config should return nil")
+	}
+	invalid := config.QuietHoursConfig{Enabled: true, Rules: []config.QuietHoursRule{{When: "not a schedule"}, {When: "* * * * *", Policy: "snooze"}}}
+	if newQuietHours(invalid) != nil {
+		t.Error("config without valid rules should return nil")
+	}
+}
+
+func TestQuietHoursQueueAndRelease(t *testing.T) {
+	q, now := newTestQuietHours(t, config.QuietHoursRule{
+		Channel:     "whatsapp",
+		When:        "* 22-23,0-6 * * *",
+		AwayMessage: "Away until morning",
+	})
+	msg := bus.InboundMessage{Channel: "whatsapp", SenderID: "alice", ChatID: "chat1", Content: "hi"}
+
+	reply, held := q.Hold(msg)
+	if !held || reply != "Away until morning" {
+		t.Fatalf("Hold() = %q, %v; want away message", reply, held)
+	}
+	if reply, held := q.Hold(msg); !held || reply != "" {
+		t.Errorf("second Hold() = %q, %v; away message should be sent once", reply, held)
+	}
+	if _, held := q.Hold(bus.InboundMessage{Channel: "telegram", ChatID: "chat1"}); held {
+		t.Error("other channels should not be held")
+	}
+
+	if released := q.Release(); len(released) != 0 {
+		t.Fatalf("released %d messages during the quiet window", len(released))
+	}
+
+	*now = time.Date(2026, 3, 3, 7, 0, 0, 0, time.UTC)
+	released := q.Release()
+	if len(released) != 2 || released[0].Content != "hi" {
+		t.Fatalf("expected both queued messages after the window, got %+v", released)
+	}
+	if len(q.Release()) != 0 {
+		t.Error("messages should only be released once")
+	}
+
+	*now = time.Date(2026, 3, 3, 22, 5, 0, 0, time.UTC)
+	if reply, _ := q.Hold(msg); reply != "Away until morning" {
+		t.Errorf("away message should be sent again in the next window, got %q", reply)
+	}
+}
+
+func TestQuietHoursDropPerContact(t *testing.T) {
+	q, _ := newTestQuietHours(t, config.QuietHoursRule{
+		Contact: "bob",
+		When:    "* 23 * * *",
+		Policy:  "drop",
+	})
+
+	if _, held := q.Hold(bus.InboundMessage{Channel: "telegram", SenderID: "bob|bobby", ChatID: "42"}); !held {
+		t.Error("message from bob should be dropped")
+	}
+	if _, held := q.Hold(bus.InboundMessage{Channel: "telegram", SenderID: "carol", ChatID: "43"}); held {
+		t.Error("message from carol should pass")
+	}
+	if len(q.queued) != 0 {
+		t.Errorf("dropped messages should not be queued, got %d", len(q.queued))
+	}
+}
+
+func TestQuietHoursTimezone(t *testing.T) {
+	q := newQuietHours(config.QuietHoursConfig{
+		Enabled:  true,
+		Timezone: "Asia/Tokyo",
+		Rules:    []config.QuietHoursRule{{When: "* 0-6 * * *"}},
+	})
+	if q == nil {
+		t.Fatal("expected quiet hours to be enabled")
+	}
+	// 23:30 UTC is 08:30 in Tokyo
+	q.now = func() time.Time { return time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC) }
+	if _, held := q.Hold(bus.InboundMessage{Channel: "telegram", ChatID: "1"}); held {
+		t.Error("message outside the Tokyo quiet window should pass")
+	}
+	// 18:00 UTC is 03:00 in Tokyo
+	q.now = func() time.Time { return time.Date(2026, 3, 2, 18, 0, 0, 0, time.UTC) }
+	if _, held := q.Hold(bus.InboundMessage{Channel: "telegram", ChatID: "1"}); !held {
+		t.Error("message inside the Tokyo quiet window should be held")
+	}
+}
@@ -0,0 +1,338 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/smtp"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/s3"
+)
+
+const (
+	defaultTranscriptFlush = 10 * time.Second
+	defaultSMTPPort        = 587
+	// maxTranscriptBacklog bounds the entries kept per destination while it
+	// is failing; the oldest are dropped first
+	maxTranscriptBacklog = 5000
+)
+
+// transcriptEntry is one archived message
+type transcriptEntry struct {
+	Time       time.Time `json:"time"`
+	SessionKey string    `json:"session_key"`
+	Channel    string    `json:"channel"`
+	ChatID     string    `json:"chat_id"`
+	SenderID   string    `json:"sender_id,omitempty"`
+	Role       string    `json:"role"`
+	Content    string    `json:"content"`
+}
+
+// transcriptSink is an archive destination. write gets the entries of one
+// session, oldest first.
+type transcriptSink interface {
+	name() string
+	write(ctx context.Context, entries []transcriptEntry) error
+}
+
+// transcriptArchive mirrors conversations to archive destinations. Entries
+// are redacted when recorded and sent in batches; a destination that fails
+// gets its batch again on the next flush.
+type transcriptArchive struct {
+	sinks    []transcriptSink
+	redact   func(string) string // nil when redaction is disabled
+	patterns []*regexp.Regexp
+	interval time.Duration
+	skip     string // channel:chat_id of the archive chat, which is not archived itself
+
+	mu     sync.Mutex
+	queues [][]transcriptEntry // Pending entries per sink
+	now    func() time.Time
+}
+
+// newTranscriptArchive returns nil when the archive is disabled or has no
+// usable destination.
+func newTranscriptArchive(cfg config.TranscriptArchiveConfig, msgBus *bus.MessageBus, redact func(string) string) *transcriptArchive {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	a := &transcriptArchive{
+		interval: time.Duration(cfg.FlushSeconds) * time.Second,
+		now:      time.Now,
+	}
+	if a.interval <= 0 {
+		a.interval = defaultTranscriptFlush
+	}
+	if !cfg.DisableRedaction {
+		a.redact = redact
+	}
+	for _, pattern := range cfg.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.WarnCF("agent", "Ignoring invalid transcript redaction pattern", map[string]interface{}{
+				"pattern": pattern,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		a.patterns = append(a.patterns, re)
+	}
+
+	if ch := cfg.Channel; ch.Channel != "" && ch.ChatID != "" {
+		a.sinks = append(a.sinks, &channelTranscriptSink{bus: msgBus, channel: ch.Channel, chatID: ch.ChatID})
+		a.skip = ch.Channel + ":" + ch.ChatID
+	}
+	if email := cfg.Email; email.SMTPHost != "" {
+		if email.From == "" || len(email.To) == 0 {
+			logger.WarnCF("agent", "Transcript email destination needs from and to", nil)
+		} else {
+			a.sinks = append(a.sinks, newEmailTranscriptSink(email))
+		}
+	}
+	if cfg.S3.Bucket != "" {
+		client, err := s3.New(cfg.S3)
+		if err != nil {
+			logger.WarnCF("agent", "Transcript S3 destination disabled", map[string]interface{}{"error": err.Error()})
+		} else {
+			a.sinks = append(a.sinks, &s3TranscriptSink{client: client, prefix: cfg.S3.Prefix})
+		}
+	}
+	if len(a.sinks) == 0 {
+		logger.WarnCF("agent", "Transcript archive enabled without a destination", nil)
+		return nil
+	}
+	a.queues = make([][]transcriptEntry, len(a.sinks))
+	return a
+}
+
+// Record queues a message of the conversation in opts. Messages on
+// internal channels and in the archive chat are not archived.
+func (a *transcriptArchive) Record(opts processOptions, role, content string) {
+	if constants.IsInternalChannel(opts.Channel) || opts.Channel+":"+opts.ChatID == a.skip {
+		return
+	}
+	if a.redact != nil {
+		content = a.redact(content)
+	}
+	for _, re := range a.patterns {
+		content = re.ReplaceAllString(content, "[REDACTED]")
+	}
+
+	entry := transcriptEntry{
+		Time:       a.now(),
+		SessionKey: opts.SessionKey,
+		Channel:    opts.Channel,
+		ChatID:     opts.ChatID,
+		Role:       role,
+		Content:    content,
+	}
+	if role == "user" {
+		entry.SenderID = opts.SenderID
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := range a.queues {
+		a.queues[i] = appendBacklog(a.queues[i], entry)
+	}
+}
+
+// Run flushes the archive every interval until ctx is done, then once more
+func (a *transcriptArchive) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			a.Flush(final)
+			cancel()
+			return
+		case <-ticker.C:
+			a.Flush(ctx)
+		}
+	}
+}
+
+// Flush sends the pending entries to every destination, one write per
+// session. Sessions a destination failed to take stay queued for it.
+func (a *transcriptArchive) Flush(ctx context.Context) {
+	for i, sink := range a.sinks {
+		a.mu.Lock()
+		pending := a.queues[i]
+		a.queues[i] = nil
+		a.mu.Unlock()
+
+		var failed []transcriptEntry
+		for _, session := range groupBySession(pending) {
+			if err := sink.write(ctx, session); err != nil {
+				logger.WarnCF("agent", "Transcript archive write failed", map[string]interface{}{
+					"destination": sink.name(),
+					"session_key": session[0].SessionKey,
+					"entries":     len(session),
+					"error":       err.Error(),
+				})
+				failed = append(failed, session...)
+			}
+		}
+		if len(failed) == 0 {
+			continue
+		}
+
+		a.mu.Lock()
+		queue := failed
+		for _, entry := range a.queues[i] {
+			queue = appendBacklog(queue, entry)
+		}
+		a.queues[i] = queue
+		a.mu.Unlock()
+	}
+}
+
+// appendBacklog appends entry, dropping the oldest entries beyond
+// maxTranscriptBacklog
+func appendBacklog(queue []transcriptEntry, entry transcriptEntry) []transcriptEntry {
+	queue = append(queue, entry)
+	if over := len(queue) - maxTranscriptBacklog; over > 0 {
+		queue = append(queue[:0:0], queue[over:]...)
+	}
+	return queue
+}
+
+// groupBySession splits entries by session, keeping their order
+func groupBySession(entries []transcriptEntry) [][]transcriptEntry {
+	var groups [][]transcriptEntry
+	index := make(map[string]int)
+	for _, entry := range entries {
+		i, ok := index[entry.SessionKey]
+		if !ok {
+			i = len(groups)
+			index[entry.SessionKey] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], entry)
+	}
+	return groups
+}
+
+// transcriptText renders the entries of one session for reading
+func transcriptText(entries []transcriptEntry) string {
+	var sb strings.Builder
+	first := entries[0]
+	fmt.Fprintf(&sb, "📁 %s:%s\n", first.Channel, first.ChatID)
+	for _, e := range entries {
+		who := e.Role
+		if e.SenderID != "" {
+			who += " (" + e.SenderID + ")"
+		}
+		fmt.Fprintf(&sb, "[%s] %s: %s\n", e.Time.Format("2006-01-02 15:04:05"), who, e.Content)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// channelTranscriptSink posts transcripts to a chat through the bus
+type channelTranscriptSink struct {
+	bus     *bus.MessageBus
+	channel string
+	chatID  string
+}
+
+func (s *channelTranscriptSink) name() string {
+	return s.channel
+}
+
+func (s *channelTranscriptSink) write(ctx context.Context, entries []transcriptEntry) error {
+	s.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: s.channel,
+		ChatID:  s.chatID,
+		Content: transcriptText(entries),
+	})
+	return nil
+}
+
+// emailTranscriptSink mails transcripts over SMTP
+type emailTranscriptSink struct {
+	addr string
+	auth smtp.Auth // nil without a username
+	from string
+	to   []string
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func newEmailTranscriptSink(cfg config.TranscriptEmailConfig) *emailTranscriptSink {
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	s := &emailTranscriptSink{
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port)),
+		from: cfg.From,
+		to:   cfg.To,
+		send: smtp.SendMail,
+	}
+	if cfg.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)
+	}
+	return s
+}
+
+func (s *emailTranscriptSink) name() string {
+	return "email"
+}
+
+func (s *emailTranscriptSink) write(ctx context.Context, entries []transcriptEntry) error {
+	first := entries[0]
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: Transcript %s:%s %s\r\n", first.Channel, first.ChatID, first.Time.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&msg, "Date: %s\r\n", first.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(transcriptText(entries), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return s.send(s.addr, s.auth, s.from, s.to, []byte(msg.String()))
+}
+
+// s3TranscriptSink writes each batch of a session as a new JSON Lines
+// object, so archived objects are never rewritten
+type s3TranscriptSink struct {
+	client *s3.Client
+	prefix string
+}
+
+func (s *s3TranscriptSink) name() string {
+	return "s3"
+}
+
+func (s *s3TranscriptSink) write(ctx context.Context, entries []transcriptEntry) error {
+	var body []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		body = append(append(body, line...), '\n')
+	}
+	_, err := s.client.Put(ctx, transcriptObjectKey(s.prefix, entries[0]), body, "application/x-ndjson")
+	return err
+}
+
+// transcriptObjectKey names the object of a batch after its chat and the
+// time of its first entry
+func transcriptObjectKey(prefix string, first transcriptEntry) string {
+	t := first.Time.UTC()
+	return path.Join(prefix, first.Channel, first.ChatID, t.Format("2006-01-02"), t.Format("150405.000000000")+".jsonl")
+}
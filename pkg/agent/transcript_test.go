@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeTranscriptSink records writes and fails while err is set
+type fakeTranscriptSink struct {
+	writes [][]transcriptEntry
+	err    error
+}
+
+func (s *fakeTranscriptSink) name() string { return "fake" }
+
+func (s *fakeTranscriptSink) write(ctx context.Context, entries []transcriptEntry) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.writes = append(s.writes, entries)
+	return nil
+}
+
+func newTestTranscriptArchive(cfg config.TranscriptArchiveConfig) (*transcriptArchive, *fakeTranscriptSink) {
+	cfg.Enabled = true
+	cfg.Channel = config.TranscriptChannelConfig{Channel: "telegram", ChatID: "-100archive"}
+	redactEmail := func(s string) string { return strings.ReplaceAll(s, "alice@example.com", "[EMAIL]") }
+	a := newTranscriptArchive(cfg, bus.NewMessageBus(), redactEmail)
+	sink := &fakeTranscriptSink{}
+	a.sinks = []transcriptSink{sink}
+	a.queues = make([][]transcriptEntry, 1)
+	a.now = func() time.Time { return time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC) }
+	return a, sink
+}
+
+func TestNewTranscriptArchiveDisabled(t *testing.T) {
+	if newTranscriptArchive(config.TranscriptArchiveConfig{
+		Channel: config.TranscriptChannelConfig{Channel: "telegram", ChatID: "1"},
+	}, nil, nil) != nil {
+		t.Error("disabled config should return nil")
+	}
+	if newTranscriptArchive(config.TranscriptArchiveConfig{Enabled: true}, nil, nil) != nil {
+		t.Error("config without destinations should return nil")
+	}
+	if newTranscriptArchive(config.TranscriptArchiveConfig{
+		Enabled: true,
+		S3:      config.S3Config{Bucket: "archive"},
+		Email:   config.TranscriptEmailConfig{SMTPHost: "smtp.example.com"},
+	}, nil, nil) != nil {
+		t.Error("misconfigured destinations should be skipped")
+	}
+}
+
+func TestTranscriptArchiveRecordAndFlush(t *testing.T) {
+	a, sink := newTestTranscriptArchive(config.TranscriptArchiveConfig{
+		RedactPatterns: config.FlexibleStringSlice{`ORDER-\d+`, `(`},
+	})
+	alice := processOptions{SessionKey: "telegram:1", Channel: "telegram", ChatID: "1", SenderID: "alice"}
+	bob := processOptions{SessionKey: "whatsapp:2", Channel: "whatsapp", ChatID: "2", SenderID: "bob"}
+
+	a.Record(alice, "user", "mail me at alice@example.com about ORDER-1234")
+	a.Record(bob, "user", "hi")
+	a.Record(alice, "assistant", "Done")
+	a.Record(processOptions{SessionKey: "cli", Channel: "cli", ChatID: "direct"}, "user", "internal")
+	a.Record(processOptions{Channel: "telegram", ChatID: "-100archive"}, "user", "archive chat")
+	a.Flush(context.Background())
+
+	if len(sink.writes) != 2 {
+		t.Fatalf("got %d writes, want one per session: %+v", len(sink.writes), sink.writes)
+	}
+	first := sink.writes[0]
+	if len(first) != 2 || first[0].SessionKey != "telegram:1" || first[1].Role != "assistant" {
+		t.Fatalf("first write = %+v", first)
+	}
+	if got := first[0].Content; got != "mail me at [EMAIL] about [REDACTED]" {
+		t.Errorf("content = %q, want it redacted", got)
+	}
+	if first[0].SenderID != "alice" || first[1].SenderID != "" {
+		t.Errorf("sender IDs = %q, %q; want only the user's", first[0].SenderID, first[1].SenderID)
+	}
+
+	a.Flush(context.Background())
+	if len(sink.writes) != 2 {
+		t.Error("flushed entries should not be written again")
+	}
+}
+
+func TestTranscriptArchiveDisableRedaction(t *testing.T) {
+	a, sink := newTestTranscriptArchive(config.TranscriptArchiveConfig{DisableRedaction: true})
+	a.Record(processOptions{SessionKey: "s", Channel: "telegram", ChatID: "1"}, "user", "alice@example.com")
+	a.Flush(context.Background())
+	if got := sink.writes[0][0].Content; got != "alice@example.com" {
+		t.Errorf("content = %q, want it unredacted", got)
+	}
+}
+
+func TestTranscriptArchiveRetriesFailedWrites(t *testing.T) {
+	a, sink := newTestTranscriptArchive(config.TranscriptArchiveConfig{})
+	opts := processOptions{SessionKey: "s", Channel: "telegram", ChatID: "1"}
+
+	sink.err = errors.New("store unavailable")
+	a.Record(opts, "user", "one")
+	a.Flush(context.Background())
+	a.Record(opts, "assistant", "two")
+
+	sink.err = nil
+	a.Flush(context.Background())
+	if len(sink.writes) != 1 || len(sink.writes[0]) != 2 || sink.writes[0][0].Content != "one" {
+		t.Fatalf("writes = %+v, want the failed entry retried before the new one", sink.writes)
+	}
+}
+
+func TestAppendBacklogDropsOldest(t *testing.T) {
+	var queue []transcriptEntry
+	for i := 0; i < maxTranscriptBacklog+2; i++ {
+		queue = appendBacklog(queue, transcriptEntry{Content: string(rune('a' + i%26))})
+	}
+	if len(queue) != maxTranscriptBacklog || queue[0].Content != "c" {
+		t.Errorf("backlog has %d entries starting with %q", len(queue), queue[0].Content)
+	}
+}
+
+func TestChannelTranscriptSink(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	sink := &channelTranscriptSink{bus: msgBus, channel: "telegram", chatID: "-100archive"}
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	err := sink.write(context.Background(), []transcriptEntry{
+		{Time: at, Channel: "whatsapp", ChatID: "2", SenderID: "bob", Role: "user", Content: "hi"},
+		{Time: at, Channel: "whatsapp", ChatID: "2", Role: "assistant", Content: "hello"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok {
+		t.Fatal("no outbound message")
+	}
+	want := "📁 whatsapp:2\n[2026-03-02 09:30:00] user (bob): hi\n[2026-03-02 09:30:00] assistant: hello"
+	if msg.Channel != "telegram" || msg.ChatID != "-100archive" || msg.Content != want {
+		t.Errorf("message = %+v", msg)
+	}
+}
+
+func TestEmailTranscriptSink(t *testing.T) {
+	sink := newEmailTranscriptSink(config.TranscriptEmailConfig{
+		SMTPHost: "smtp.example.com",
+		From:     "bot@example.com",
+		To:       config.FlexibleStringSlice{"me@example.com"},
+	})
+	var addr string
+	var sent []byte
+	sink.send = func(a string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		addr, sent = a, msg
+		return nil
+	}
+
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	err := sink.write(context.Background(), []transcriptEntry{{Time: at, Channel: "telegram", ChatID: "1", Role: "user", Content: "hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "smtp.example.com:587" {
+		t.Errorf("addr = %q, want the default port", addr)
+	}
+	for _, want := range []string{"To: me@example.com\r\n", "Subject: Transcript telegram:1 2026-03-02 09:30\r\n", "\r\n\r\n📁 telegram:1\r\n[2026-03-02 09:30:00] user: hi\r\n"} {
+		if !strings.Contains(string(sent), want) {
+			t.Errorf("mail lacks %q:\n%s", want, sent)
+		}
+	}
+}
+
+func TestTranscriptObjectKey(t *testing.T) {
+	entry := transcriptEntry{Time: time.Date(2026, 3, 2, 9, 30, 5, 120, time.UTC), Channel: "telegram", ChatID: "-100/7"}
+	if got, want := transcriptObjectKey("picoclaw/", entry), "picoclaw/telegram/-100/7/2026-03-02/093005.000000120.jsonl"; got != want {
+		t.Errorf("key = %q, want %q", got, want)
+	}
+}
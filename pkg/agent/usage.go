@@ -0,0 +1,434 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// usageCheckInterval is how often the ledger looks for a month to export
+const usageCheckInterval = time.Hour
+
+// usageRecord is one model call in the ledger
+type usageRecord struct {
+	Time         time.Time `json:"time"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	Chat         string    `json:"chat"` // channel:chat_id, or the session key for summaries
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+}
+
+// usageLine is the usage of one model in one chat over a month
+type usageLine struct {
+	Provider     string  `json:"provider"`
+	Chat         string  `json:"chat"`
+	Model        string  `json:"model"`
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+	Priced       bool    `json:"priced"` // False when the model has no pricing entry
+}
+
+// usageReport is the export of one month
+type usageReport struct {
+	Month        string      `json:"month"` // YYYY-MM
+	Currency     string      `json:"currency"`
+	InputTokens  int         `json:"input_tokens"`
+	OutputTokens int         `json:"output_tokens"`
+	Cost         float64     `json:"cost"` // Of the priced lines only
+	Lines        []usageLine `json:"lines"`
+
+	CSVPath  string `json:"-"`
+	JSONPath string `json:"-"`
+}
+
+// usageLedger appends the tokens of every model call to a monthly JSON Lines
+// file in workspace/usage and exports each month as CSV and JSON once it is
+// over. Exports are sent to the owner chat and mailed when configured.
+type usageLedger struct {
+	dir      string
+	provider string         // Default provider, for models named without one
+	prices   *costEstimator // Pricing table and currency of cost_estimate
+	bus      *bus.MessageBus
+	channel  string
+	chatID   string
+	email    *usageMailer // nil without an SMTP host
+
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// newUsageLedger returns nil when the ledger is disabled
+func newUsageLedger(cfg *config.Config, workspace string, msgBus *bus.MessageBus) *usageLedger {
+	if !cfg.Usage.Enabled {
+		return nil
+	}
+	u := &usageLedger{
+		dir:      filepath.Join(workspace, "usage"),
+		provider: strings.ToLower(cfg.AI.DefaultProvider),
+		prices:   newCostEstimator(cfg.CostEstimate),
+		bus:      msgBus,
+		channel:  cfg.Usage.Channel,
+		chatID:   cfg.Usage.ChatID,
+		now:      time.Now,
+	}
+	if cfg.Usage.Email.SMTPHost != "" {
+		u.email = newUsageMailer(cfg.Usage.Email)
+	}
+	return u
+}
+
+// Record adds a model call to the ledger of the current month
+func (u *usageLedger) Record(model, chat string, inputTokens, outputTokens int) {
+	rec := usageRecord{
+		Time:         u.now(),
+		Provider:     u.providerOf(model),
+		Model:        model,
+		Chat:         chat,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.append(rec.Time.Format("2006-01"), append(data, '\n')); err != nil {
+		logger.WarnCF("agent", "Failed to record usage", map[string]interface{}{
+			"model": model,
+			"error": err.Error(),
+		})
+	}
+}
+
+func (u *usageLedger) append(month string, line []byte) error {
+	if err := os.MkdirAll(u.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(u.ledgerPath(month), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// providerOf names the provider of a call from the prefix of the model name
+// (e.g. "openrouter/gpt-4o" -> "openrouter"), else the default provider
+func (u *usageLedger) providerOf(model string) string {
+	if idx := strings.Index(model, "/"); idx != -1 {
+		return model[:idx]
+	}
+	if u.provider != "" {
+		return u.provider
+	}
+	return "default"
+}
+
+func (u *usageLedger) ledgerPath(month string) string {
+	return filepath.Join(u.dir, "ledger-"+month+".jsonl")
+}
+
+func (u *usageLedger) exportPath(month, ext string) string {
+	return filepath.Join(u.dir, "usage-"+month+"."+ext)
+}
+
+// Export totals the ledger of month (YYYY-MM) per provider, chat and model
+// and writes the report next to it as CSV and JSON
+func (u *usageLedger) Export(month string) (*usageReport, error) {
+	if _, err := time.Parse("2006-01", month); err != nil {
+		return nil, fmt.Errorf("invalid month %q, expected YYYY-MM", month)
+	}
+
+	u.mu.Lock()
+	records, err := readUsageRecords(u.ledgerPath(month))
+	u.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(u.dir, 0755); err != nil {
+		return nil, err
+	}
+	report := u.totals(month, records)
+	report.CSVPath = u.exportPath(month, "csv")
+	report.JSONPath = u.exportPath(month, "json")
+	if err := writeUsageCSV(report.CSVPath, report); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(report.JSONPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write usage export: %w", err)
+	}
+	return report, nil
+}
+
+func readUsageRecords(path string) ([]usageRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read usage ledger: %w", err)
+	}
+	defer f.Close()
+
+	var records []usageRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec usageRecord
+		// A line cut short by a crash is skipped rather than failing the month
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err == nil {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// totals groups records per provider, chat and model and prices them
+func (u *usageLedger) totals(month string, records []usageRecord) *usageReport {
+	report := &usageReport{Month: month, Currency: u.prices.cfg.Currency, Lines: []usageLine{}}
+	index := make(map[[3]string]int)
+	for _, rec := range records {
+		key := [3]string{rec.Provider, rec.Chat, rec.Model}
+		i, ok := index[key]
+		if !ok {
+			i = len(report.Lines)
+			index[key] = i
+			report.Lines = append(report.Lines, usageLine{Provider: rec.Provider, Chat: rec.Chat, Model: rec.Model})
+		}
+		line := &report.Lines[i]
+		line.Calls++
+		line.InputTokens += rec.InputTokens
+		line.OutputTokens += rec.OutputTokens
+	}
+
+	for i := range report.Lines {
+		line := &report.Lines[i]
+		if price, ok := u.prices.pricing(line.Model); ok {
+			line.Priced = true
+			line.Cost = float64(line.InputTokens)/1e6*price.InputPerMillion +
+				float64(line.OutputTokens)/1e6*price.OutputPerMillion
+		}
+		report.InputTokens += line.InputTokens
+		report.OutputTokens += line.OutputTokens
+		report.Cost += line.Cost
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		a, b := report.Lines[i], report.Lines[j]
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		if a.Chat != b.Chat {
+			return a.Chat < b.Chat
+		}
+		return a.Model < b.Model
+	})
+	return report
+}
+
+func writeUsageCSV(path string, report *usageReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write usage export: %w", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"month", "provider", "chat", "model", "calls", "input_tokens", "output_tokens", "cost", "currency"})
+	for _, line := range report.Lines {
+		cost := ""
+		if line.Priced {
+			cost = strconv.FormatFloat(line.Cost, 'f', 6, 64)
+		}
+		w.Write([]string{
+			report.Month, line.Provider, line.Chat, line.Model,
+			strconv.Itoa(line.Calls), strconv.Itoa(line.InputTokens), strconv.Itoa(line.OutputTokens),
+			cost, report.Currency,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write usage export: %w", err)
+	}
+	return f.Close()
+}
+
+// Run exports the previous month once it is over, checking at start and
+// then every hour until ctx is done
+func (u *usageLedger) Run(ctx context.Context) {
+	u.exportDue()
+	ticker := time.NewTicker(usageCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.exportDue()
+		}
+	}
+}
+
+// exportDue exports and delivers the previous month unless that was done
+// already. Months without any recorded call are skipped.
+func (u *usageLedger) exportDue() {
+	now := u.now()
+	month := now.AddDate(0, 0, -now.Day()).Format("2006-01")
+	if _, err := os.Stat(u.exportPath(month, "csv")); err == nil {
+		return
+	}
+	if _, err := os.Stat(u.ledgerPath(month)); err != nil {
+		return
+	}
+
+	report, err := u.Export(month)
+	if err != nil {
+		logger.WarnCF("agent", "Usage export failed", map[string]interface{}{
+			"month": month,
+			"error": err.Error(),
+		})
+		return
+	}
+	logger.InfoCF("agent", "Usage exported", map[string]interface{}{
+		"month": month,
+		"lines": len(report.Lines),
+		"path":  report.CSVPath,
+	})
+	u.deliver(report)
+}
+
+// deliver sends the export to the owner chat and mails it
+func (u *usageLedger) deliver(report *usageReport) {
+	if u.channel != "" && u.chatID != "" {
+		u.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: u.channel,
+			ChatID:  u.chatID,
+			Content: usageSummary(report),
+			Attachments: []bus.Attachment{{
+				Path:     report.CSVPath,
+				MimeType: "text/csv",
+			}},
+		})
+	}
+	if u.email != nil {
+		if err := u.email.send(report); err != nil {
+			logger.WarnCF("agent", "Failed to mail usage export", map[string]interface{}{
+				"month": report.Month,
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// usageSummary renders the totals of a report per provider
+func usageSummary(report *usageReport) string {
+	type total struct{ input, output, calls int }
+	var providers []string
+	totals := make(map[string]*total)
+	for _, line := range report.Lines {
+		t, ok := totals[line.Provider]
+		if !ok {
+			t = &total{}
+			totals[line.Provider] = t
+			providers = append(providers, line.Provider)
+		}
+		t.input += line.InputTokens
+		t.output += line.OutputTokens
+		t.calls += line.Calls
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📊 Usage for %s\n", report.Month)
+	for _, name := range providers {
+		t := totals[name]
+		fmt.Fprintf(&sb, "%s: %d calls, %d input + %d output tokens\n", name, t.calls, t.input, t.output)
+	}
+	fmt.Fprintf(&sb, "Total: %d input + %d output tokens, ~%.2f %s", report.InputTokens, report.OutputTokens, report.Cost, report.Currency)
+	return sb.String()
+}
+
+// usageMailer mails exports over SMTP with the CSV attached
+type usageMailer struct {
+	addr     string
+	auth     smtp.Auth // nil without a username
+	from     string
+	to       []string
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func newUsageMailer(cfg config.UsageEmailConfig) *usageMailer {
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	m := &usageMailer{
+		addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port)),
+		from:     cfg.From,
+		to:       cfg.To,
+		sendMail: smtp.SendMail,
+	}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)
+	}
+	return m
+}
+
+func (m *usageMailer) send(report *usageReport) error {
+	attachment, err := os.ReadFile(report.CSVPath)
+	if err != nil {
+		return err
+	}
+	const boundary = "picoclaw-usage-export"
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&msg, "Subject: PicoClaw usage %s\r\n", report.Month)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&msg, "--%s\r\n", boundary)
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(usageSummary(report), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	fmt.Fprintf(&msg, "--%s\r\n", boundary)
+	msg.WriteString("Content-Type: text/csv; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "Content-Disposition: attachment; filename=%q\r\n", filepath.Base(report.CSVPath))
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString(attachment)
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	fmt.Fprintf(&msg, "--%s--\r\n", boundary)
+
+	return m.sendMail(m.addr, m.auth, m.from, m.to, []byte(msg.String()))
+}
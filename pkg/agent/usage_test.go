@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"encoding/csv"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestUsageLedger(t *testing.T, now time.Time) *usageLedger {
+	cfg := &config.Config{}
+	cfg.Usage.Enabled = true
+	cfg.AI.DefaultProvider = "openai"
+	cfg.CostEstimate.Pricing = map[string]config.ModelPricing{
+		"gpt-4o": {InputPerMillion: 2.5, OutputPerMillion: 10},
+	}
+	u := newUsageLedger(cfg, t.TempDir(), bus.NewMessageBus())
+	u.now = func() time.Time { return now }
+	return u
+}
+
+func TestUsageLedgerExport(t *testing.T) {
+	u := newTestUsageLedger(t, time.Date(2026, 9, 14, 12, 0, 0, 0, time.UTC))
+	u.Record("gpt-4o", "telegram:1", 1000000, 100000)
+	u.Record("gpt-4o", "telegram:1", 1000000, 100000)
+	u.Record("openrouter/llama-3", "telegram:2", 500, 50)
+
+	report, err := u.Export("2026-09")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %+v", len(report.Lines), report.Lines)
+	}
+	gpt := report.Lines[0]
+	if gpt.Provider != "openai" || gpt.Calls != 2 || gpt.InputTokens != 2000000 || !gpt.Priced || gpt.Cost != 7 {
+		t.Errorf("unexpected gpt-4o line %+v", gpt)
+	}
+	llama := report.Lines[1]
+	if llama.Provider != "openrouter" || llama.Priced || llama.Cost != 0 {
+		t.Errorf("unexpected llama line %+v", llama)
+	}
+	if report.Cost != 7 || report.Currency != "USD" {
+		t.Errorf("report total = %v %s, want 7 USD", report.Cost, report.Currency)
+	}
+
+	f, err := os.Open(report.CSVPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][7] != "7.000000" || rows[2][7] != "" {
+		t.Errorf("unexpected CSV %v", rows)
+	}
+	if _, err := os.Stat(report.JSONPath); err != nil {
+		t.Errorf("JSON export missing: %v", err)
+	}
+
+	if _, err := u.Export("September"); err == nil {
+		t.Error("invalid months should be rejected")
+	}
+}
+
+func TestUsageLedgerExportDue(t *testing.T) {
+	now := time.Date(2026, 9, 30, 23, 0, 0, 0, time.UTC)
+	u := newTestUsageLedger(t, now)
+	u.channel, u.chatID = "telegram", "owner"
+	var mails []string
+	u.email = newUsageMailer(config.UsageEmailConfig{SMTPHost: "smtp.example.com", From: "a@example.com", To: []string{"b@example.com"}})
+	u.email.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mails = append(mails, string(msg))
+		return nil
+	}
+	u.Record("gpt-4o", "telegram:1", 100, 10)
+
+	// September is not over yet
+	u.exportDue()
+	if len(mails) != 0 {
+		t.Fatal("exported a month that is not over")
+	}
+
+	u.now = func() time.Time { return now.Add(2 * time.Hour) }
+	u.exportDue()
+	u.exportDue()
+	if len(mails) != 1 {
+		t.Fatalf("sent %d mails, want 1", len(mails))
+	}
+	if !strings.Contains(mails[0], "Subject: PicoClaw usage 2026-09") || !strings.Contains(mails[0], `filename="usage-2026-09.csv"`) {
+		t.Errorf("unexpected mail:\n%s", mails[0])
+	}
+	if _, err := os.Stat(filepath.Join(u.dir, "usage-2026-09.csv")); err != nil {
+		t.Errorf("export missing: %v", err)
+	}
+
+	out, ok := u.bus.SubscribeOutbound(t.Context())
+	if !ok || out.ChatID != "owner" || len(out.Attachments) != 1 || !strings.Contains(out.Content, "Usage for 2026-09") {
+		t.Errorf("unexpected owner message %+v", out)
+	}
+}
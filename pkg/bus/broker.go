@@ -0,0 +1,268 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Broker is an external message server carrying the bus messages, so that
+// several picoclaw instances share one logical bus: each message published
+// on any of them is taken by exactly one instance consuming its stream.
+type Broker interface {
+	// Publish appends data to stream
+	Publish(ctx context.Context, stream string, data []byte) error
+	// Consume passes the messages of stream to handle, one at a time,
+	// until ctx is done or the connection fails. Instances consuming with
+	// the same group share the messages. A message not acknowledged with
+	// ack is delivered again, to this consumer after a restart. Consume
+	// stops with the error handle returns.
+	Consume(ctx context.Context, stream, group string, handle func(data []byte, ack func() error) error) error
+	Close() error
+}
+
+// Broker roles, selecting which messages an instance takes from the broker
+const (
+	RoleAll     = "all"     // Inbound and outbound messages (default)
+	RoleGateway = "gateway" // Outbound messages: the instance runs the channels
+	RoleWorker  = "worker"  // Inbound messages: the instance runs the agent
+)
+
+// DefaultBrokerPrefix starts the names of the broker streams
+const DefaultBrokerPrefix = "picoclaw"
+
+// Consumer groups of the broker streams
+const (
+	groupAgents   = "agents"
+	groupChannels = "channels"
+)
+
+// brokerRetry is how long the bus waits before consuming again after the
+// broker connection failed
+const brokerRetry = 5 * time.Second
+
+var errBusClosed = errors.New("bus closed")
+
+// brokerLink is the state of a bus backed by a broker
+type brokerLink struct {
+	broker Broker
+	prefix string
+	// channels is set when the instance takes outbound messages, running
+	// the channels
+	channels bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu sync.Mutex
+	// Acknowledgements of the messages taken from the broker and not yet
+	// marked done, keyed by the seq given to the message
+	acks    map[uint64]func() error
+	nextSeq uint64
+}
+
+func (l *brokerLink) stream(name string) string {
+	return l.prefix + ":" + name
+}
+
+// hold keeps ack until the message is marked done and returns the seq that
+// identifies it
+func (l *brokerLink) hold(ack func() error) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextSeq++
+	l.acks[l.nextSeq] = ack
+	return l.nextSeq
+}
+
+func (l *brokerLink) take(seq uint64) func() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ack := l.acks[seq]
+	delete(l.acks, seq)
+	return ack
+}
+
+// useBroker makes the bus publish to broker and take the messages of role
+// from it until the bus is closed
+func (mb *MessageBus) useBroker(broker Broker, prefix, role string) {
+	if prefix == "" {
+		prefix = DefaultBrokerPrefix
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &brokerLink{
+		broker:   broker,
+		prefix:   prefix,
+		channels: role != RoleWorker,
+		cancel:   cancel,
+		acks:     make(map[uint64]func() error),
+	}
+	mb.broker = l
+
+	if role != RoleGateway {
+		l.wg.Add(1)
+		go mb.consumeBroker(ctx, l.stream("inbound"), groupAgents, mb.takeInbound)
+	}
+	if role != RoleWorker {
+		l.wg.Add(1)
+		go mb.consumeBroker(ctx, l.stream("outbound"), groupChannels, mb.takeOutbound)
+	}
+}
+
+// consumeBroker passes the messages of stream to take, reconnecting after
+// failures until ctx is done
+func (mb *MessageBus) consumeBroker(ctx context.Context, stream, group string, take func(context.Context, []byte, func() error) error) {
+	defer mb.broker.wg.Done()
+	handle := func(data []byte, ack func() error) error {
+		return take(ctx, data, ack)
+	}
+	for {
+		err := mb.broker.broker.Consume(ctx, stream, group, handle)
+		if ctx.Err() != nil || errors.Is(err, errBusClosed) {
+			return
+		}
+		logger.ErrorCF("bus", "Consuming from the broker failed, retrying", map[string]interface{}{
+			"stream": stream,
+			"error":  errorString(err),
+		})
+		select {
+		case <-time.After(brokerRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// takeInbound queues an inbound message taken from the broker. It is
+// acknowledged once the agent marks it done.
+func (mb *MessageBus) takeInbound(ctx context.Context, data []byte, ack func() error) error {
+	var msg InboundMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		mb.dropUndecodable("inbound", err, ack)
+		return nil
+	}
+
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	if mb.closed {
+		return errBusClosed
+	}
+	msg.seq = mb.broker.hold(ack)
+	mb.pendingInbound.Add(1)
+	if mb.overflow == OverflowBlock {
+		select {
+		case mb.inbound <- msg:
+			mb.stats.inbound.push()
+		case <-ctx.Done():
+			// Left unacknowledged, so the broker delivers it again
+			mb.pendingInbound.Add(-1)
+			mb.broker.take(msg.seq)
+			return ctx.Err()
+		}
+	} else if err := mb.enqueueInbound(msg); err != nil {
+		// Rejected messages are acknowledged like dropped ones; their
+		// senders were not told, so they are logged
+		logger.WarnCF("bus", "Inbound queue full, dropped message from the broker", map[string]interface{}{
+			"channel":  msg.Channel,
+			"trace_id": msg.TraceID,
+		})
+	}
+	mb.checkHighWatermark()
+	return nil
+}
+
+// takeOutbound queues an outbound message taken from the broker. It is
+// acknowledged once its channel manager marks it done.
+func (mb *MessageBus) takeOutbound(ctx context.Context, data []byte, ack func() error) error {
+	var msg OutboundMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		mb.dropUndecodable("outbound", err, ack)
+		return nil
+	}
+	if mb.answer(msg) {
+		if err := ack(); err != nil {
+			logBrokerAckError(msg.TraceID, err)
+		}
+		return nil
+	}
+
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	if mb.closed {
+		return errBusClosed
+	}
+	msg.seq = mb.broker.hold(ack)
+	mb.pendingOutbound.Add(1)
+	select {
+	case mb.outboundQueue(msg.EffectivePriority()) <- msg:
+		mb.queuedOutbound(msg.EffectivePriority())
+		return nil
+	case <-ctx.Done():
+		mb.pendingOutbound.Add(-1)
+		mb.broker.take(msg.seq)
+		return ctx.Err()
+	}
+}
+
+// dropUndecodable acknowledges a broker message that is not a bus message,
+// so it is not delivered again and again
+func (mb *MessageBus) dropUndecodable(kind string, err error, ack func() error) {
+	logger.ErrorCF("bus", "Dropping undecodable message from the broker", map[string]interface{}{
+		"kind":  kind,
+		"error": err.Error(),
+	})
+	if err := ack(); err != nil {
+		logBrokerAckError("", err)
+	}
+}
+
+// publishToBroker sends msg to the broker stream name
+func (mb *MessageBus) publishToBroker(name string, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return mb.broker.broker.Publish(ctx, mb.broker.stream(name), data)
+}
+
+// ackBroker acknowledges the broker message behind seq
+func (mb *MessageBus) ackBroker(seq uint64, traceID string) {
+	ack := mb.broker.take(seq)
+	if ack == nil {
+		return
+	}
+	if err := ack(); err != nil {
+		logBrokerAckError(traceID, err)
+	}
+}
+
+func logBrokerAckError(traceID string, err error) {
+	// The broker delivers the message again, repeating it
+	logger.ErrorCF("bus", "Failed to acknowledge message to the broker", map[string]interface{}{
+		"error":    err.Error(),
+		"trace_id": traceID,
+	})
+}
+
+// closeBroker stops consuming from the broker and closes it
+func (mb *MessageBus) closeBroker() {
+	mb.broker.cancel()
+	mb.broker.wg.Wait()
+	if err := mb.broker.broker.Close(); err != nil {
+		logger.WarnCF("bus", "Failed to close the broker connection", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return "connection closed"
+	}
+	return err.Error()
+}
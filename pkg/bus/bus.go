@@ -2,61 +2,366 @@ package bus
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/trace"
 )
 
+// DefaultQueueSize is how many messages each queue buffers when the
+// options set no size
+const DefaultQueueSize = 100
+
 type MessageBus struct {
-	inbound  chan InboundMessage
-	outbound chan OutboundMessage
+	inbound chan InboundMessage
+	// One queue per priority, the highest first
+	outbound [PriorityHigh]chan OutboundMessage
 	handlers map[string]MessageHandler
 	closed   bool
 	mu       sync.RWMutex
+
+	// Messages published and not yet marked done by their consumer
+	pendingInbound  atomic.Int64
+	pendingOutbound atomic.Int64
+
+	events eventSubscribers
+
+	// journal keeps the messages until they are marked done; nil keeps
+	// them in memory only
+	journal *journal
+
+	// Outbound messages that could not be delivered
+	dead   []DeadLetter
+	deadMu sync.Mutex
+
+	overflow   OverflowPolicy
+	watermarks watermarks
+	dropped    atomic.Uint64 // Inbound messages dropped or rejected
+
+	// broker carries the messages between instances; nil keeps them in
+	// this process
+	broker *brokerLink
+
+	requests requests
+	stats    busStats
 }
 
 func NewMessageBus() *MessageBus {
-	return &MessageBus{
-		inbound:  make(chan InboundMessage, 100),
-		outbound: make(chan OutboundMessage, 100),
+	return newMessageBus(Options{}, 0)
+}
+
+// newMessageBus returns a bus whose queues have room for extra messages
+// beyond the configured size
+func newMessageBus(opts Options, extra int) *MessageBus {
+	opts = opts.withDefaults()
+	size := opts.QueueSize + extra
+	mb := &MessageBus{
+		inbound:  make(chan InboundMessage, size),
 		handlers: make(map[string]MessageHandler),
+		overflow: opts.Overflow,
+		stats:    busStats{since: time.Now()},
 	}
+	for i := range mb.outbound {
+		mb.outbound[i] = make(chan OutboundMessage, size)
+	}
+	mb.watermarks.high = max(1, int(opts.HighWatermark*float64(opts.QueueSize)))
+	mb.watermarks.low = int(opts.LowWatermark * float64(opts.QueueSize))
+	return mb
+}
+
+// outboundQueue returns the queue for messages of priority p
+func (mb *MessageBus) outboundQueue(p Priority) chan OutboundMessage {
+	return mb.outbound[PriorityHigh-p]
+}
+
+// NewPersistentMessageBus returns a bus that writes every message to the
+// journal at path until its consumer marks it done, and queues the messages
+// left in the journal by the last run again. Delivery is at least once: a
+// message handled right before a crash is delivered again. With syncWrites
+// every record is flushed to the disk, which survives power loss but slows
+// down publishing on SD cards.
+func NewPersistentMessageBus(path string, syncWrites bool) (*MessageBus, error) {
+	return NewMessageBusWithOptions(Options{JournalPath: path, SyncWrites: syncWrites})
 }
 
-func (mb *MessageBus) PublishInbound(msg InboundMessage) {
+// NewMessageBusWithOptions returns a bus configured by opts, persistent
+// when opts has a journal path
+func NewMessageBusWithOptions(opts Options) (*MessageBus, error) {
+	if opts.Broker != nil {
+		if opts.JournalPath != "" {
+			// The broker keeps the messages until they are acknowledged
+			return nil, errors.New("a bus backed by a broker has no journal")
+		}
+		mb := newMessageBus(opts, 0)
+		mb.useBroker(opts.Broker, opts.BrokerPrefix, opts.BrokerRole)
+		return mb, nil
+	}
+	if opts.JournalPath == "" {
+		return newMessageBus(opts, 0), nil
+	}
+	path := opts.JournalPath
+	j, replay, err := openJournal(path, opts.SyncWrites)
+	if err != nil {
+		return nil, err
+	}
+	// The messages of the last run always fit
+	mb := newMessageBus(opts, len(replay))
+	mb.journal = j
+
+	dead := 0
+	for _, rec := range replay {
+		switch {
+		case rec.Dead != nil:
+			dl := *rec.Dead
+			dl.seq = rec.Seq
+			mb.dead = append(mb.dead, dl)
+			dead++
+		case rec.Inbound != nil:
+			msg := *rec.Inbound
+			msg.seq = rec.Seq
+			mb.pendingInbound.Add(1)
+			mb.inbound <- msg
+			mb.stats.inbound.push()
+		case rec.Outbound != nil:
+			msg := *rec.Outbound
+			msg.seq = rec.Seq
+			mb.pendingOutbound.Add(1)
+			mb.outboundQueue(msg.EffectivePriority()) <- msg
+			mb.queuedOutbound(msg.EffectivePriority())
+		}
+	}
+	mb.checkHighWatermark()
+	if len(replay) > dead {
+		logger.InfoCF("bus", "Replaying messages not handled before the last shutdown", map[string]interface{}{
+			"messages":     len(replay) - dead,
+			"dead_letters": dead,
+			"journal":      path,
+		})
+	}
+	return mb, nil
+}
+
+// PublishInbound queues msg for the agent. When the queue is full it
+// waits for room, drops a message or returns ErrQueueFull, as the overflow
+// policy says. A bus backed by a broker sends msg to the broker instead.
+func (mb *MessageBus) PublishInbound(msg InboundMessage) error {
+	if msg.TraceID == "" {
+		msg.TraceID = trace.NewID()
+	}
+	mb.stats.count(msg.Channel, true)
+	if mb.broker != nil {
+		return mb.publishToBroker("inbound", msg)
+	}
+
 	mb.mu.RLock()
 	defer mb.mu.RUnlock()
 	if mb.closed {
-		return
+		return nil
+	}
+	if mb.journal != nil {
+		seq, err := mb.journal.append(journalRecord{Op: opInbound, Inbound: &msg})
+		if err != nil {
+			logJournalError("Failed to journal inbound message", msg.TraceID, err)
+		}
+		msg.seq = seq
 	}
-	mb.inbound <- msg
+	mb.pendingInbound.Add(1)
+	err := mb.enqueueInbound(msg)
+	mb.checkHighWatermark()
+	return err
 }
 
 func (mb *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, bool) {
 	select {
-	case msg := <-mb.inbound:
-		return msg, true
+	case msg, ok := <-mb.inbound:
+		if ok {
+			mb.stats.inbound.pop()
+			mb.checkLowWatermark()
+		}
+		return msg, ok
 	case <-ctx.Done():
 		return InboundMessage{}, false
 	}
 }
 
-func (mb *MessageBus) PublishOutbound(msg OutboundMessage) {
+// PublishOutbound queues msg for sending and returns its delivery ID, which
+// the delivery status events published by the channel manager carry
+func (mb *MessageBus) PublishOutbound(msg OutboundMessage) string {
+	if msg.DeliveryID == "" {
+		msg.DeliveryID = NewDeliveryID()
+	}
+	if mb.answer(msg) {
+		return msg.DeliveryID
+	}
+	if len(msg.Broadcast) > 0 {
+		mb.stats.count("broadcast", false)
+	} else {
+		mb.stats.count(msg.Channel, false)
+	}
+	if mb.broker != nil && msg.sensitive() && !mb.broker.channels {
+		// Secrets are not handed to the broker, and this instance cannot
+		// send them itself
+		logger.ErrorCF("bus", "Dropping sensitive outbound message: a worker cannot send it without the broker", map[string]interface{}{
+			"channel":     msg.Channel,
+			"delivery_id": msg.DeliveryID,
+			"trace_id":    msg.TraceID,
+		})
+		return msg.DeliveryID
+	}
+	if mb.broker != nil && !msg.sensitive() {
+		if err := mb.publishToBroker("outbound", msg); err != nil {
+			// Kept for a retry from the admin endpoints rather than lost
+			logger.ErrorCF("bus", "Failed to publish outbound message to the broker", map[string]interface{}{
+				"error":       err.Error(),
+				"delivery_id": msg.DeliveryID,
+				"trace_id":    msg.TraceID,
+			})
+			mb.AddDeadLetter(msg, err, 0)
+		}
+		return msg.DeliveryID
+	}
+
 	mb.mu.RLock()
 	defer mb.mu.RUnlock()
 	if mb.closed {
-		return
+		return msg.DeliveryID
 	}
-	mb.outbound <- msg
+	if mb.journal != nil && !msg.sensitive() {
+		seq, err := mb.journal.append(journalRecord{Op: opOutbound, Outbound: &msg})
+		if err != nil {
+			logJournalError("Failed to journal outbound message", msg.TraceID, err)
+		}
+		msg.seq = seq
+	}
+	mb.pendingOutbound.Add(1)
+	mb.outboundQueue(msg.EffectivePriority()) <- msg
+	mb.queuedOutbound(msg.EffectivePriority())
+	return msg.DeliveryID
 }
 
+// NewDeliveryID returns a random delivery ID
+func NewDeliveryID() string {
+	return "d-" + trace.NewID()
+}
+
+// SubscribeOutbound returns the next outbound message, taking those of
+// higher priority first
 func (mb *MessageBus) SubscribeOutbound(ctx context.Context) (OutboundMessage, bool) {
-	select {
-	case msg := <-mb.outbound:
-		return msg, true
-	case <-ctx.Done():
-		return OutboundMessage{}, false
+	// A nil queue is closed and drained; receiving from it blocks
+	queues := mb.outbound
+	for {
+		open := false
+		for i, q := range queues {
+			if q == nil {
+				continue
+			}
+			select {
+			case msg, ok := <-q:
+				if ok {
+					mb.stats.outbound[i].pop()
+					return msg, true
+				}
+				queues[i] = nil
+				continue
+			default:
+			}
+			open = true
+		}
+		if !open {
+			return OutboundMessage{}, false
+		}
+
+		select {
+		case msg, ok := <-queues[0]:
+			if ok {
+				mb.stats.outbound[0].pop()
+				return msg, true
+			}
+			queues[0] = nil
+		case msg, ok := <-queues[1]:
+			if ok {
+				mb.stats.outbound[1].pop()
+				return msg, true
+			}
+			queues[1] = nil
+		case msg, ok := <-queues[2]:
+			if ok {
+				mb.stats.outbound[2].pop()
+				return msg, true
+			}
+			queues[2] = nil
+		case <-ctx.Done():
+			return OutboundMessage{}, false
+		}
 	}
 }
 
+// InboundDone marks an inbound message returned by ConsumeInbound as
+// handled, which acknowledges it to the journal of a persistent bus
+func (mb *MessageBus) InboundDone(msg InboundMessage) {
+	mb.pendingInbound.Add(-1)
+	mb.ack(msg.seq, msg.TraceID)
+}
+
+// InboundReleased gives up an inbound message returned by ConsumeInbound
+// without handling it, on shutdown. It is not acknowledged, so a persistent
+// bus or the broker delivers it again after the restart.
+func (mb *MessageBus) InboundReleased(msg InboundMessage) {
+	mb.pendingInbound.Add(-1)
+	if mb.broker != nil && msg.seq != 0 {
+		mb.broker.take(msg.seq)
+	}
+}
+
+// OutboundDone marks an outbound message returned by SubscribeOutbound as
+// sent, which acknowledges it to the journal of a persistent bus
+func (mb *MessageBus) OutboundDone(msg OutboundMessage) {
+	mb.pendingOutbound.Add(-1)
+	mb.ack(msg.seq, msg.TraceID)
+}
+
+// OutboundReleased gives up an outbound message returned by
+// SubscribeOutbound without sending it, on shutdown. It is not
+// acknowledged, so a persistent bus or the broker delivers it again after
+// the restart.
+func (mb *MessageBus) OutboundReleased(msg OutboundMessage) {
+	mb.pendingOutbound.Add(-1)
+	if mb.broker != nil && msg.seq != 0 {
+		mb.broker.take(msg.seq)
+	}
+}
+
+func (mb *MessageBus) ack(seq uint64, traceID string) {
+	if mb.broker != nil && seq != 0 {
+		mb.ackBroker(seq, traceID)
+		return
+	}
+	if mb.journal == nil || seq == 0 {
+		return
+	}
+	if err := mb.journal.ack(seq); err != nil {
+		logJournalError("Failed to acknowledge message in the journal", traceID, err)
+	}
+}
+
+// logJournalError logs a journal failure. The message still goes through,
+// it is only not kept for a restart.
+func logJournalError(msg, traceID string, err error) {
+	logger.ErrorCF("bus", msg, map[string]interface{}{
+		"error":    err.Error(),
+		"trace_id": traceID,
+	})
+}
+
+// Pending returns the number of inbound and outbound messages published and
+// not yet marked done, including those being handled
+func (mb *MessageBus) Pending() (inbound, outbound int64) {
+	return mb.pendingInbound.Load(), mb.pendingOutbound.Load()
+}
+
 func (mb *MessageBus) RegisterHandler(channel string, handler MessageHandler) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
@@ -71,6 +376,10 @@ func (mb *MessageBus) GetHandler(channel string) (MessageHandler, bool) {
 }
 
 func (mb *MessageBus) Close() {
+	if mb.broker != nil {
+		// Messages taken and not yet handled stay with the broker
+		mb.closeBroker()
+	}
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
 	if mb.closed {
@@ -78,5 +387,11 @@ func (mb *MessageBus) Close() {
 	}
 	mb.closed = true
 	close(mb.inbound)
-	close(mb.outbound)
+	for _, q := range mb.outbound {
+		close(q)
+	}
+	if mb.journal != nil {
+		// Messages still queued stay in the journal for the next start
+		mb.journal.close()
+	}
 }
@@ -0,0 +1,53 @@
+package bus
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOutboundPriority(t *testing.T) {
+	mb := NewMessageBus()
+	mb.PublishOutbound(OutboundMessage{Content: "reminder", Notification: NotificationReminder})
+	mb.PublishOutbound(OutboundMessage{Content: "reply 1"})
+	mb.PublishOutbound(OutboundMessage{Content: "alert", Notification: NotificationAlert})
+	mb.PublishOutbound(OutboundMessage{Content: "reply 2"})
+	mb.PublishOutbound(OutboundMessage{Content: "admin", Priority: PriorityHigh})
+	mb.PublishOutbound(OutboundMessage{Content: "low reply", Priority: PriorityLow})
+	mb.Close()
+
+	var got []string
+	for {
+		msg, ok := mb.SubscribeOutbound(context.Background())
+		if !ok {
+			break
+		}
+		got = append(got, msg.Content)
+	}
+	want := []string{"alert", "admin", "reply 1", "reply 2", "reminder", "low reply"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestEffectivePriority(t *testing.T) {
+	for _, tt := range []struct {
+		msg  OutboundMessage
+		want Priority
+	}{
+		{OutboundMessage{}, PriorityNormal},
+		{OutboundMessage{Notification: NotificationError}, PriorityHigh},
+		{OutboundMessage{Notification: NotificationHeartbeat}, PriorityLow},
+		{OutboundMessage{Broadcast: []BroadcastTarget{{Channel: "telegram"}}}, PriorityLow},
+		{OutboundMessage{Notification: NotificationAlert, Priority: PriorityLow}, PriorityLow},
+		{OutboundMessage{Priority: 7}, PriorityHigh},
+	} {
+		if got := tt.msg.EffectivePriority(); got != tt.want {
+			t.Errorf("%+v: priority %d, want %d", tt.msg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package bus
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/trace"
+)
+
+// maxDeadLetters is how many failed messages the dead-letter queue keeps;
+// the oldest are dropped beyond that
+const maxDeadLetters = 1000
+
+// ErrDeadLetterNotFound is returned for dead-letter IDs not in the queue
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is an outbound message its channel could not deliver. It stays
+// in the dead-letter queue until it is requeued or discarded; on a
+// persistent bus it survives restarts.
+type DeadLetter struct {
+	ID       string          `json:"id"`
+	Message  OutboundMessage `json:"message"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+
+	// seq is the dead letter's place in the journal of a persistent bus
+	seq uint64
+}
+
+// AddDeadLetter puts msg in the dead-letter queue after its last delivery
+// attempt failed with err, and returns the entry
+func (mb *MessageBus) AddDeadLetter(msg OutboundMessage, err error, attempts int) DeadLetter {
+	msg.seq = 0
+	dl := DeadLetter{
+		ID:       "dl-" + trace.NewID(),
+		Message:  msg,
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}
+	if err != nil {
+		dl.Error = err.Error()
+	}
+
+	mb.mu.RLock()
+	if mb.journal != nil && !mb.closed && !msg.sensitive() {
+		seq, err := mb.journal.append(journalRecord{Op: opDead, Dead: &dl})
+		if err != nil {
+			logJournalError("Failed to journal dead letter", msg.TraceID, err)
+		}
+		dl.seq = seq
+	}
+	mb.mu.RUnlock()
+
+	mb.deadMu.Lock()
+	mb.dead = append(mb.dead, dl)
+	var dropped []DeadLetter
+	if over := len(mb.dead) - maxDeadLetters; over > 0 {
+		dropped = append(dropped, mb.dead[:over]...)
+		mb.dead = append([]DeadLetter(nil), mb.dead[over:]...)
+	}
+	mb.deadMu.Unlock()
+
+	for _, old := range dropped {
+		logger.WarnCF("bus", "Dead-letter queue full, dropping oldest entry", map[string]interface{}{
+			"dead_letter_id": old.ID,
+			"channel":        old.Message.Channel,
+			"chat_id":        old.Message.ChatID,
+			"trace_id":       old.Message.TraceID,
+		})
+		mb.ack(old.seq, old.Message.TraceID)
+	}
+	return dl
+}
+
+// DeadLetters returns the entries of the dead-letter queue, oldest first
+func (mb *MessageBus) DeadLetters() []DeadLetter {
+	mb.deadMu.Lock()
+	defer mb.deadMu.Unlock()
+	return append([]DeadLetter(nil), mb.dead...)
+}
+
+// RequeueDeadLetter takes the entry id out of the dead-letter queue and
+// publishes its message again with the same delivery ID, which it returns
+func (mb *MessageBus) RequeueDeadLetter(id string) (string, error) {
+	dl, ok := mb.takeDeadLetter(id)
+	if !ok {
+		return "", ErrDeadLetterNotFound
+	}
+	// Published before the entry is acknowledged, so a crash in between
+	// repeats the message rather than losing it
+	deliveryID := mb.PublishOutbound(dl.Message)
+	mb.ack(dl.seq, dl.Message.TraceID)
+	return deliveryID, nil
+}
+
+// DiscardDeadLetter removes the entry id from the dead-letter queue without
+// sending it
+func (mb *MessageBus) DiscardDeadLetter(id string) error {
+	dl, ok := mb.takeDeadLetter(id)
+	if !ok {
+		return ErrDeadLetterNotFound
+	}
+	mb.ack(dl.seq, dl.Message.TraceID)
+	return nil
+}
+
+func (mb *MessageBus) takeDeadLetter(id string) (DeadLetter, bool) {
+	mb.deadMu.Lock()
+	defer mb.deadMu.Unlock()
+	for i, dl := range mb.dead {
+		if dl.ID == id {
+			mb.dead = append(mb.dead[:i:i], mb.dead[i+1:]...)
+			return dl, true
+		}
+	}
+	return DeadLetter{}, false
+}
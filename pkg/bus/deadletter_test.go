@@ -0,0 +1,63 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeadLetters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.db")
+	mb, err := NewPersistentMessageBus(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := mb.AddDeadLetter(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "lost", DeliveryID: "d-1"}, errors.New("chat not found"), 3)
+	second := mb.AddDeadLetter(OutboundMessage{Channel: "slack", ChatID: "2", Content: "spam"}, nil, 1)
+	mb.Close()
+
+	// The queue survives a restart
+	mb, err = NewPersistentMessageBus(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Close()
+	dead := mb.DeadLetters()
+	if len(dead) != 2 || dead[0].ID != first.ID || dead[0].Error != "chat not found" || dead[0].Attempts != 3 {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+	if inbound, outbound := mb.Pending(); inbound != 0 || outbound != 0 {
+		t.Errorf("dead letters replayed as messages: %d inbound, %d outbound", inbound, outbound)
+	}
+
+	deliveryID, err := mb.RequeueDeadLetter(first.ID)
+	if err != nil || deliveryID != "d-1" {
+		t.Fatalf("requeue: %q, %v", deliveryID, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if msg, _ := mb.SubscribeOutbound(ctx); msg.Content != "lost" {
+		t.Errorf("unexpected requeued message %+v", msg)
+	}
+	if err := mb.DiscardDeadLetter(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := mb.DiscardDeadLetter(second.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("discarding twice: %v", err)
+	}
+	if dead := mb.DeadLetters(); len(dead) != 0 {
+		t.Errorf("queue not empty: %+v", dead)
+	}
+}
+
+func TestDeadLettersLimit(t *testing.T) {
+	mb := NewMessageBus()
+	for i := 0; i < maxDeadLetters+1; i++ {
+		mb.AddDeadLetter(OutboundMessage{Content: "x"}, nil, 1)
+	}
+	if n := len(mb.DeadLetters()); n != maxDeadLetters {
+		t.Errorf("queue holds %d entries, want %d", n, maxDeadLetters)
+	}
+}
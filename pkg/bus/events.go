@@ -0,0 +1,84 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// eventBuffer is how many events a slow subscriber may fall behind by
+// before further events are dropped for it
+const eventBuffer = 32
+
+// Event is a state change announced on the bus, such as a channel losing
+// its connection. Events are not messages: they never reach the agent, and
+// subscribers that fall behind miss them rather than blocking publishers.
+type Event struct {
+	Type   string            `json:"type"`   // The topic, e.g. TopicChannelHealth
+	Source string            `json:"source"` // Who published it, e.g. the channel name
+	Data   map[string]string `json:"data,omitempty"`
+	// Payload is the typed form of the event, such as a ChannelHealthEvent
+	// for TopicChannelHealth. Data carries the same as strings.
+	Payload interface{} `json:"payload,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+type eventSubscribers struct {
+	mu sync.Mutex
+	// Topics of each subscriber; nil for all
+	subs map[chan Event]map[string]bool
+}
+
+// PublishEvent sends ev to every current subscriber
+func (mb *MessageBus) PublishEvent(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	mb.events.mu.Lock()
+	defer mb.events.mu.Unlock()
+	for ch, topics := range mb.events.subs {
+		if topics != nil && !topics[ev.Type] {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// SubscribeEvents returns a channel receiving the events published from now
+// on. The channel is closed when ctx is done.
+func (mb *MessageBus) SubscribeEvents(ctx context.Context) <-chan Event {
+	return mb.SubscribeTopics(ctx)
+}
+
+// SubscribeTopics is SubscribeEvents for the events of the given topics
+// only; without topics it receives all events
+func (mb *MessageBus) SubscribeTopics(ctx context.Context, topics ...string) <-chan Event {
+	ch := make(chan Event, eventBuffer)
+	var filter map[string]bool
+	if len(topics) > 0 {
+		filter = make(map[string]bool, len(topics))
+		for _, topic := range topics {
+			filter[topic] = true
+		}
+	}
+
+	mb.events.mu.Lock()
+	if mb.events.subs == nil {
+		mb.events.subs = make(map[chan Event]map[string]bool)
+	}
+	mb.events.subs[ch] = filter
+	mb.events.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		mb.events.mu.Lock()
+		delete(mb.events.subs, ch)
+		mb.events.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
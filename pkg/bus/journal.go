@@ -0,0 +1,234 @@
+package bus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Persistence modes of the message bus
+const (
+	PersistenceMemory = "memory" // Messages are lost when the process ends
+	PersistenceFile   = "file"   // Messages are kept in a journal until acknowledged
+)
+
+// journalBucket holds the records of the messages not acknowledged yet,
+// keyed by their sequence number in big endian, so in publishing order
+var journalBucket = []byte("messages")
+
+// journalLockTimeout is how long opening waits for another process holding
+// the journal
+const journalLockTimeout = 5 * time.Second
+
+// journalMaxRecord is the largest line read back from the JSONL journal of
+// older versions
+const journalMaxRecord = 16 * 1024 * 1024
+
+// Journal record operations
+const (
+	opInbound  = "in"
+	opOutbound = "out"
+	opAck      = "ack" // Only in the JSONL journal of older versions
+	opDead     = "dead"
+)
+
+// journalRecord is a message of the journal
+type journalRecord struct {
+	Op       string           `json:"op"`
+	Seq      uint64           `json:"seq"`
+	Inbound  *InboundMessage  `json:"in,omitempty"`
+	Outbound *OutboundMessage `json:"out,omitempty"`
+	Dead     *DeadLetter      `json:"dead,omitempty"`
+}
+
+// sensitive reports whether the record holds a message that must not be
+// stored
+func (rec journalRecord) sensitive() bool {
+	return (rec.Outbound != nil && rec.Outbound.sensitive()) ||
+		(rec.Dead != nil && rec.Dead.Message.sensitive())
+}
+
+// journal keeps the messages published on a bus and the dead letters in an
+// embedded bbolt database until they are acknowledged. Every record and
+// acknowledgement is a transaction of its own, so a crash leaves the
+// journal as it was before or after it, never half written. The records
+// left are the messages to deliver again after a restart.
+type journal struct {
+	path string
+	db   *bolt.DB
+}
+
+// openJournal opens the journal at path, creating it if needed, and returns
+// the records of the messages not acknowledged yet, oldest first. The
+// messages left in a JSONL journal of an older version next to it, with
+// the same name and the .jsonl extension, are moved into it.
+func openJournal(path string, syncWrites bool) (*journal, []journalRecord, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: journalLockTimeout, NoSync: !syncWrites})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening message journal %s: %w", path, err)
+	}
+	j := &journal{path: path, db: db}
+
+	legacy := strings.TrimSuffix(path, filepath.Ext(path)) + ".jsonl"
+	if legacy == path {
+		legacy = ""
+	}
+	var imported []journalRecord
+	if legacy != "" {
+		if imported, err = readJSONLJournal(legacy); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+	}
+
+	var replay []journalRecord
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(journalBucket)
+		if err != nil {
+			return err
+		}
+		for _, rec := range imported {
+			value, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(journalKey(rec.Seq), value); err != nil {
+				return err
+			}
+			if rec.Seq > b.Sequence() {
+				if err := b.SetSequence(rec.Seq); err != nil {
+					return err
+				}
+			}
+		}
+
+		var drop [][]byte
+		err = b.ForEach(func(k, v []byte) error {
+			var rec journalRecord
+			if err := json.Unmarshal(v, &rec); err != nil || rec.sensitive() {
+				// Unreadable, or a sensitive message stored by an older
+				// version: not delivered again
+				drop = append(drop, k)
+				return nil
+			}
+			rec.Seq = binary.BigEndian.Uint64(k)
+			replay = append(replay, rec)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range drop {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("reading message journal %s: %w", path, err)
+	}
+	if legacy != "" {
+		// Its messages are in the database now
+		if err := os.Remove(legacy); err != nil && !os.IsNotExist(err) {
+			db.Close()
+			return nil, nil, err
+		}
+	}
+	return j, replay, nil
+}
+
+// readJSONLJournal returns the messages not acknowledged in the JSONL
+// journal at path of an older version, oldest first; none when there is no
+// such file
+func readJSONLJournal(path string) ([]journalRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pending := make(map[uint64]journalRecord)
+	var order []uint64
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), journalMaxRecord)
+	for scanner.Scan() {
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A crash can leave the last line half written
+			continue
+		}
+		if rec.Op == opAck || rec.sensitive() {
+			delete(pending, rec.Seq)
+			continue
+		}
+		if _, ok := pending[rec.Seq]; !ok {
+			order = append(order, rec.Seq)
+		}
+		pending[rec.Seq] = rec
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading message journal %s: %w", path, err)
+	}
+
+	records := make([]journalRecord, 0, len(pending))
+	for _, seq := range order {
+		if rec, ok := pending[seq]; ok {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+// journalKey is the key of the record with sequence number seq
+func journalKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// append records a published message and returns its sequence number
+func (j *journal) append(rec journalRecord) (uint64, error) {
+	err := j.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(journalBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		rec.Seq = seq
+		value, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return b.Put(journalKey(seq), value)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rec.Seq, nil
+}
+
+// ack removes the message with sequence number seq, which was handled
+func (j *journal) ack(seq uint64) error {
+	return j.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(journalBucket).Delete(journalKey(seq))
+	})
+}
+
+func (j *journal) close() error {
+	return j.db.Close()
+}
@@ -0,0 +1,238 @@
+package bus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// journalContents returns the records left in the journal at path
+func journalContents(t *testing.T, path string) []journalRecord {
+	t.Helper()
+	j, records, err := openJournal(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.close()
+	return records
+}
+
+func TestPersistentMessageBusReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bus", "journal.db")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mb, err := NewPersistentMessageBus(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "handled"})
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "in flight"})
+	id := mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "reply"})
+
+	msg, _ := mb.ConsumeInbound(ctx)
+	mb.InboundDone(msg)
+	// Taken by the agent, but the process dies before it is handled
+	mb.ConsumeInbound(ctx)
+	mb.Close()
+
+	mb, err = NewPersistentMessageBus(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inbound, outbound := mb.Pending(); inbound != 1 || outbound != 1 {
+		t.Fatalf("expected one message each way again, got %d and %d", inbound, outbound)
+	}
+	msg, _ = mb.ConsumeInbound(ctx)
+	if msg.Content != "in flight" || msg.TraceID == "" {
+		t.Errorf("unexpected replayed message %+v", msg)
+	}
+	out, _ := mb.SubscribeOutbound(ctx)
+	if out.Content != "reply" || out.DeliveryID != id {
+		t.Errorf("unexpected replayed reply %+v", out)
+	}
+	mb.InboundDone(msg)
+	mb.OutboundDone(out)
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "new"})
+	mb.Close()
+
+	mb, err = NewPersistentMessageBus(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := mb.ConsumeInbound(ctx); msg.Content != "new" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	mb.Close()
+	if records := journalContents(t, path); len(records) != 1 || records[0].Seq != 4 {
+		t.Errorf("journal holds %+v, want the new message only", records)
+	}
+}
+
+func TestJournalDropsAcknowledgedMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.db")
+	mb, err := NewPersistentMessageBus(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 1000; i++ {
+		mb.PublishInbound(InboundMessage{Content: "hi"})
+		msg, _ := mb.ConsumeInbound(ctx)
+		mb.InboundDone(msg)
+	}
+	mb.PublishInbound(InboundMessage{Content: "pending"})
+	mb.Close()
+
+	records := journalContents(t, path)
+	if len(records) != 1 || records[0].Inbound.Content != "pending" || records[0].Seq != 1001 {
+		t.Errorf("expected only the pending message, got %+v", records)
+	}
+}
+
+// TestJournalSurvivesKill kills a process while it publishes to a
+// persistent bus: every message it had published is delivered again, in
+// order, from a journal that opens cleanly
+func TestJournalSurvivesKill(t *testing.T) {
+	if path := os.Getenv("BUS_JOURNAL_KILL_TEST"); path != "" {
+		mb, err := NewPersistentMessageBus(path, false)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for i := 1; ; i++ {
+			mb.PublishInbound(InboundMessage{Channel: "test", ChatID: "1", Content: strconv.Itoa(i)})
+			fmt.Println(i)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "journal.db")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestJournalSurvivesKill$")
+	cmd.Env = append(os.Environ(), "BUS_JOURNAL_KILL_TEST="+path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Killed while publishing, with the queue not full yet
+	published := 0
+	scanner := bufio.NewScanner(stdout)
+	for published < DefaultQueueSize/2 && scanner.Scan() {
+		n, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			t.Fatalf("child: %s", scanner.Text())
+		}
+		published = n
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	if published < DefaultQueueSize/2 {
+		t.Fatalf("child published %d messages before it stopped", published)
+	}
+
+	mb, err := NewPersistentMessageBus(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Close()
+	inbound, _ := mb.Pending()
+	if inbound < int64(published) {
+		t.Fatalf("%d messages published, %d delivered again", published, inbound)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for i := 1; i <= int(inbound); i++ {
+		if msg, _ := mb.ConsumeInbound(ctx); msg.Content != strconv.Itoa(i) {
+			t.Fatalf("message %d replayed as %q", i, msg.Content)
+		}
+	}
+}
+
+func TestJournalImportsJSONLJournal(t *testing.T) {
+	dir := t.TempDir()
+	// The journal of an older version, with a line a crash left half written
+	legacy := `{"op":"in","seq":1,"in":{"channel":"telegram","chat_id":"1","content":"handled"}}
+{"op":"in","seq":2,"in":{"channel":"telegram","chat_id":"1","content":"pending"}}
+{"op":"ack","seq":1}
+{"op":"in","seq":3,"in":{"chan`
+	if err := os.WriteFile(filepath.Join(dir, "journal.jsonl"), []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mb, err := NewPersistentMessageBus(filepath.Join(dir, "journal.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inbound, _ := mb.Pending(); inbound != 1 {
+		t.Fatalf("imported %d messages, want 1", inbound)
+	}
+	msg, _ := mb.ConsumeInbound(context.Background())
+	if msg.Content != "pending" {
+		t.Errorf("unexpected imported message %+v", msg)
+	}
+	// New messages come after the imported ones
+	mb.PublishInbound(InboundMessage{Content: "new"})
+	mb.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "journal.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("old journal left behind: %v", err)
+	}
+	records := journalContents(t, filepath.Join(dir, "journal.db"))
+	if len(records) != 2 || records[0].Seq != 2 || records[1].Seq != 3 {
+		t.Errorf("journal holds %+v", records)
+	}
+}
+
+func TestJournalSkipsSensitiveMessages(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.db")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// A code journaled by an older version
+	os.WriteFile(filepath.Join(dir, "journal.jsonl"), []byte(`{"op":"out","seq":1,"out":{"channel":"telegram","chat_id":"1","content":"old 123456","ttl_seconds":60}}`+"\n"), 0600)
+	mb, err := NewPersistentMessageBus(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, outbound := mb.Pending(); outbound != 0 {
+		t.Errorf("replayed %d sensitive messages", outbound)
+	}
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "code 654321", TTLSeconds: 60})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "hello"})
+	out, _ := mb.SubscribeOutbound(ctx)
+	mb.AddDeadLetter(out, errors.New("blocked"), 3)
+	mb.Close()
+
+	data, _ := os.ReadFile(path)
+	for _, secret := range []string{"123456", "654321"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("journal holds %s", secret)
+		}
+	}
+	if !bytes.Contains(data, []byte("hello")) {
+		t.Error("journal lost the plain message")
+	}
+}
+
+func TestMessageBusClosed(t *testing.T) {
+	mb := NewMessageBus()
+	mb.Close()
+	if _, ok := mb.ConsumeInbound(context.Background()); ok {
+		t.Error("closed bus returned an inbound message")
+	}
+	if _, ok := mb.SubscribeOutbound(context.Background()); ok {
+		t.Error("closed bus returned an outbound message")
+	}
+}
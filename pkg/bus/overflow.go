@@ -0,0 +1,176 @@
+package bus
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// OverflowPolicy is what publishing to a full inbound queue does. Outbound
+// queues always wait for room, so replies are never dropped.
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"       // Wait for room (default)
+	OverflowDropOldest OverflowPolicy = "drop_oldest" // Drop the message waiting longest
+	OverflowDropNewest OverflowPolicy = "drop_newest" // Drop the message being published
+	OverflowReject     OverflowPolicy = "reject"      // Return ErrQueueFull to the publisher
+)
+
+// ErrQueueFull is returned by PublishInbound when the queue is full and the
+// overflow policy is OverflowReject
+var ErrQueueFull = errors.New("inbound queue full")
+
+// Watermark defaults, as fractions of the queue size
+const (
+	DefaultHighWatermark = 0.8
+	DefaultLowWatermark  = 0.5
+)
+
+// Options configure a MessageBus
+type Options struct {
+	QueueSize int            // Messages each queue holds; 0 selects DefaultQueueSize
+	Overflow  OverflowPolicy // Empty selects OverflowBlock
+	// Fill of the inbound queue (0-1) at which the bus reports overload,
+	// and at which it reports that the overload is over; 0 selects the
+	// defaults
+	HighWatermark float64
+	LowWatermark  float64
+	// Journal keeping messages until they are handled, see
+	// NewPersistentMessageBus; empty keeps them in memory only
+	JournalPath string
+	SyncWrites  bool
+	// Broker carrying the messages between instances instead of the
+	// in-process queues alone, see Broker. BrokerRole selects the
+	// messages this instance takes from it (RoleAll when empty), and
+	// BrokerPrefix starts the stream names (DefaultBrokerPrefix when
+	// empty).
+	Broker       Broker
+	BrokerRole   string
+	BrokerPrefix string
+}
+
+func (o Options) withDefaults() Options {
+	if o.QueueSize <= 0 {
+		o.QueueSize = DefaultQueueSize
+	}
+	if o.Overflow == "" {
+		o.Overflow = OverflowBlock
+	}
+	if o.HighWatermark <= 0 || o.HighWatermark > 1 {
+		o.HighWatermark = DefaultHighWatermark
+	}
+	if o.LowWatermark <= 0 || o.LowWatermark >= o.HighWatermark {
+		o.LowWatermark = min(DefaultLowWatermark, o.HighWatermark/2)
+	}
+	return o
+}
+
+// enqueueInbound puts msg in the inbound queue following the overflow
+// policy
+func (mb *MessageBus) enqueueInbound(msg InboundMessage) error {
+	if mb.overflow == OverflowBlock {
+		mb.inbound <- msg
+		mb.stats.inbound.push()
+		return nil
+	}
+	for {
+		select {
+		case mb.inbound <- msg:
+			mb.stats.inbound.push()
+			return nil
+		default:
+		}
+
+		switch mb.overflow {
+		case OverflowDropOldest:
+			select {
+			case old := <-mb.inbound:
+				mb.stats.inbound.pop()
+				mb.dropInbound(old, "Inbound queue full, dropping oldest message")
+			default:
+				// Taken by the agent meanwhile
+			}
+		case OverflowDropNewest:
+			mb.dropInbound(msg, "Inbound queue full, dropping message")
+			return nil
+		default:
+			mb.dropInbound(msg, "Inbound queue full, rejecting message")
+			return ErrQueueFull
+		}
+	}
+}
+
+// dropInbound gives up on a queued or published inbound message
+func (mb *MessageBus) dropInbound(msg InboundMessage, reason string) {
+	mb.dropped.Add(1)
+	mb.pendingInbound.Add(-1)
+	mb.ack(msg.seq, msg.TraceID)
+	logger.WarnCF("bus", reason, map[string]interface{}{
+		"channel":  msg.Channel,
+		"chat_id":  msg.ChatID,
+		"trace_id": msg.TraceID,
+		"policy":   string(mb.overflow),
+	})
+}
+
+// DroppedInbound returns how many inbound messages the overflow policy
+// dropped or rejected
+func (mb *MessageBus) DroppedInbound() uint64 {
+	return mb.dropped.Load()
+}
+
+// watermarks tracks whether the inbound queue is overloaded
+type watermarks struct {
+	high, low  int // Queue lengths
+	overloaded atomic.Bool
+
+	mu        sync.Mutex
+	callbacks []func(overloaded bool)
+}
+
+// OnWatermark registers fn to be called with true when the inbound queue
+// fills up to the high watermark, and with false once the agent has worked
+// it down to the low watermark. Channels use it to stop reading from their
+// connections while the agent is overloaded, leaving the messages with the
+// platform instead of in memory. fn must not block.
+func (mb *MessageBus) OnWatermark(fn func(overloaded bool)) {
+	mb.watermarks.mu.Lock()
+	defer mb.watermarks.mu.Unlock()
+	mb.watermarks.callbacks = append(mb.watermarks.callbacks, fn)
+}
+
+// Overloaded reports whether the inbound queue is above its high watermark
+// and has not yet drained to the low one
+func (mb *MessageBus) Overloaded() bool {
+	return mb.watermarks.overloaded.Load()
+}
+
+func (mb *MessageBus) checkHighWatermark() {
+	if len(mb.inbound) >= mb.watermarks.high && mb.watermarks.overloaded.CompareAndSwap(false, true) {
+		logger.WarnCF("bus", "Inbound queue above high watermark, pausing channels", map[string]interface{}{
+			"queued": len(mb.inbound),
+		})
+		mb.notifyWatermark(true)
+	}
+}
+
+func (mb *MessageBus) checkLowWatermark() {
+	if len(mb.inbound) <= mb.watermarks.low && mb.watermarks.overloaded.CompareAndSwap(true, false) {
+		logger.InfoCF("bus", "Inbound queue back at low watermark, resuming channels", map[string]interface{}{
+			"queued": len(mb.inbound),
+		})
+		mb.notifyWatermark(false)
+	}
+}
+
+func (mb *MessageBus) notifyWatermark(overloaded bool) {
+	mb.watermarks.mu.Lock()
+	callbacks := append([]func(bool){}, mb.watermarks.callbacks...)
+	mb.watermarks.mu.Unlock()
+	for _, fn := range callbacks {
+		fn(overloaded)
+	}
+}
@@ -0,0 +1,73 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		err    error
+		want   []string
+	}{
+		{OverflowDropOldest, nil, []string{"2", "3"}},
+		{OverflowDropNewest, nil, []string{"1", "2"}},
+		{OverflowReject, ErrQueueFull, []string{"1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			mb, err := NewMessageBusWithOptions(Options{QueueSize: 2, Overflow: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mb.PublishInbound(InboundMessage{Content: "1"})
+			mb.PublishInbound(InboundMessage{Content: "2"})
+			if err := mb.PublishInbound(InboundMessage{Content: "3"}); !errors.Is(err, tt.err) {
+				t.Errorf("publishing to a full queue: %v, want %v", err, tt.err)
+			}
+			if mb.DroppedInbound() != 1 {
+				t.Errorf("dropped %d messages, want 1", mb.DroppedInbound())
+			}
+			if inbound, _ := mb.Pending(); inbound != 2 {
+				t.Errorf("%d messages pending, want 2", inbound)
+			}
+			mb.Close()
+			var got []string
+			for {
+				msg, ok := mb.ConsumeInbound(context.Background())
+				if !ok {
+					break
+				}
+				got = append(got, msg.Content)
+			}
+			if len(got) != 2 || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("queue holds %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatermarks(t *testing.T) {
+	mb, _ := NewMessageBusWithOptions(Options{QueueSize: 10, HighWatermark: 0.5, LowWatermark: 0.2})
+	var calls []bool
+	mb.OnWatermark(func(overloaded bool) { calls = append(calls, overloaded) })
+
+	for i := 0; i < 6; i++ {
+		mb.PublishInbound(InboundMessage{})
+	}
+	if !mb.Overloaded() || len(calls) != 1 || !calls[0] {
+		t.Fatalf("not overloaded at 6 of 10 messages: %v", calls)
+	}
+	for i := 0; i < 3; i++ {
+		mb.ConsumeInbound(context.Background())
+	}
+	if !mb.Overloaded() {
+		t.Error("overload ended above the low watermark")
+	}
+	mb.ConsumeInbound(context.Background())
+	if mb.Overloaded() || len(calls) != 2 || calls[1] {
+		t.Errorf("overload not ended at the low watermark: %v", calls)
+	}
+}
@@ -0,0 +1,172 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/redis"
+)
+
+const (
+	// redisBlock is how long a read waits for new messages before checking
+	// whether the consumer was stopped
+	redisBlock = 2 * time.Second
+	// redisMaxLen is roughly how many messages a stream keeps, handled or
+	// not; older ones are trimmed
+	redisMaxLen = 10000
+	redisBatch  = 16
+)
+
+// RedisBroker is a Broker on Redis Streams (Redis 5 or later). Each stream
+// is a Redis stream, each group a consumer group on it, and each instance a
+// consumer named after its host, so that after a restart it gets the
+// messages it had taken and not acknowledged.
+type RedisBroker struct {
+	client   *redis.Client
+	consumer string
+}
+
+// NewRedisBroker returns a broker for the server at rawURL, written as
+// redis://[user:password@]host[:port][/db], or rediss:// for TLS. consumer
+// names this instance in the consumer groups; empty selects the host name.
+// Connections are opened when first needed.
+func NewRedisBroker(rawURL, consumer string) (*RedisBroker, error) {
+	client, err := redis.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	b := &RedisBroker{client: client, consumer: consumer}
+	if b.consumer == "" {
+		if b.consumer, err = os.Hostname(); err != nil || b.consumer == "" {
+			b.consumer = "picoclaw"
+		}
+	}
+	return b, nil
+}
+
+// Publish adds data to stream, trimming the oldest messages beyond
+// redisMaxLen
+func (b *RedisBroker) Publish(ctx context.Context, stream string, data []byte) error {
+	_, err := b.client.Do(ctx, "XADD", stream, "MAXLEN", "~", strconv.Itoa(redisMaxLen), "*", "data", string(data))
+	return err
+}
+
+// Consume reads stream as consumer b.consumer of group, creating both when
+// missing. It first goes through the messages the consumer took before
+// and did not acknowledge, then waits for new ones.
+func (b *RedisBroker) Consume(ctx context.Context, stream, group string, handle func(data []byte, ack func() error) error) error {
+	// Blocking reads hold their connection, so every consumer has its own
+	conn, err := b.client.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// Starting at 0, a new group also gets the messages published before
+	// any instance consumed
+	if _, err := conn.Do("XGROUP", "CREATE", stream, group, "0", "MKSTREAM"); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	ack := func(id string) func() error {
+		return func() error {
+			_, err := b.client.Do(context.Background(), "XACK", stream, group, id)
+			return err
+		}
+	}
+	// "0" reads this consumer's pending messages, ">" new ones
+	from := "0"
+	for ctx.Err() == nil {
+		reply, err := conn.Do("XREADGROUP", "GROUP", group, b.consumer, "COUNT", strconv.Itoa(redisBatch),
+			"BLOCK", strconv.Itoa(int(redisBlock/time.Millisecond)), "STREAMS", stream, from)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		entries, err := redisStreamEntries(reply)
+		if err != nil {
+			return err
+		}
+		if from == "0" && len(entries) == 0 {
+			from = ">"
+			continue
+		}
+		for _, e := range entries {
+			if e.data == nil {
+				// Trimmed from the stream while pending
+				if err := ack(e.id)(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := handle(e.data, ack(e.id)); err != nil {
+				return err
+			}
+		}
+		if from == "0" && len(entries) > 0 {
+			// Pending messages are read again until none is left; those
+			// handled meanwhile are skipped by starting after the last
+			from = entries[len(entries)-1].id
+		}
+	}
+	return ctx.Err()
+}
+
+// Close closes the connection used for publishing. Consumers stop with
+// their contexts.
+func (b *RedisBroker) Close() error {
+	return b.client.Close()
+}
+
+// redisEntry is a stream entry; data is nil for entries deleted from the
+// stream while pending
+type redisEntry struct {
+	id   string
+	data []byte
+}
+
+// redisStreamEntries takes the entries of the one stream out of an
+// XREADGROUP reply: [[stream, [[id, [field, value, ...]], ...]]]
+func redisStreamEntries(reply interface{}) ([]redisEntry, error) {
+	if reply == nil {
+		return nil, nil // Timed out
+	}
+	streams, ok := reply.([]interface{})
+	if !ok || len(streams) == 0 {
+		return nil, fmt.Errorf("redis: unexpected XREADGROUP reply %v", reply)
+	}
+	stream, ok := streams[0].([]interface{})
+	if !ok || len(stream) != 2 {
+		return nil, fmt.Errorf("redis: unexpected XREADGROUP reply %v", reply)
+	}
+	items, _ := stream[1].([]interface{})
+
+	entries := make([]redisEntry, 0, len(items))
+	for _, item := range items {
+		parts, ok := item.([]interface{})
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("redis: unexpected stream entry %v", item)
+		}
+		id, _ := parts[0].([]byte)
+		entry := redisEntry{id: string(id)}
+		fields, _ := parts[1].([]interface{})
+		for i := 0; i+1 < len(fields); i += 2 {
+			if name, _ := fields[i].([]byte); string(name) == "data" {
+				entry.data, _ = fields[i+1].([]byte)
+			}
+		}
+		if entry.data == nil && fields != nil {
+			entry.data = []byte{} // Not ours; decoding it fails and drops it
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,72 @@
+package bus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/trace"
+)
+
+// requests are the callers of Request waiting for replies, keyed by
+// correlation ID
+type requests struct {
+	mu      sync.Mutex
+	waiting map[string]chan OutboundMessage
+}
+
+// NewCorrelationID returns a random correlation ID
+func NewCorrelationID() string {
+	return "c-" + trace.NewID()
+}
+
+// Request publishes msg to the agent and waits for its reply, for surfaces
+// that answer synchronously such as HTTP APIs. The reply is returned instead
+// of being queued for a channel; progress updates are sent as usual. msg
+// gets a correlation ID when it has none, which the agent copies to its
+// reply. On a bus backed by a broker, the reply reaches the caller when the
+// caller's instance consumes outbound messages and is the only one doing so.
+func (mb *MessageBus) Request(ctx context.Context, msg InboundMessage) (OutboundMessage, error) {
+	if msg.CorrelationID == "" {
+		msg.CorrelationID = NewCorrelationID()
+	}
+	id := msg.CorrelationID
+	reply := make(chan OutboundMessage, 1)
+
+	mb.requests.mu.Lock()
+	if mb.requests.waiting == nil {
+		mb.requests.waiting = make(map[string]chan OutboundMessage)
+	}
+	mb.requests.waiting[id] = reply
+	mb.requests.mu.Unlock()
+	defer func() {
+		mb.requests.mu.Lock()
+		delete(mb.requests.waiting, id)
+		mb.requests.mu.Unlock()
+	}()
+
+	if err := mb.PublishInbound(msg); err != nil {
+		return OutboundMessage{}, err
+	}
+	select {
+	case out := <-reply:
+		return out, nil
+	case <-ctx.Done():
+		return OutboundMessage{}, ctx.Err()
+	}
+}
+
+// answer hands msg to the Request waiting for it and reports whether there
+// was one
+func (mb *MessageBus) answer(msg OutboundMessage) bool {
+	if msg.CorrelationID == "" || msg.Progress {
+		return false
+	}
+	mb.requests.mu.Lock()
+	reply, ok := mb.requests.waiting[msg.CorrelationID]
+	delete(mb.requests.waiting, msg.CorrelationID)
+	mb.requests.mu.Unlock()
+	if ok {
+		reply <- msg
+	}
+	return ok
+}
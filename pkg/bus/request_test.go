@@ -0,0 +1,106 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// answerInbound replies to each inbound message like the agent does
+func answerInbound(ctx context.Context, mb *MessageBus) {
+	for {
+		msg, ok := mb.ConsumeInbound(ctx)
+		if !ok {
+			return
+		}
+		mb.PublishOutbound(OutboundMessage{
+			Channel:  msg.Channel,
+			ChatID:   msg.ChatID,
+			Content:  "progress",
+			Progress: true,
+			// Progress updates are not the reply
+			CorrelationID: msg.CorrelationID,
+		})
+		mb.PublishOutbound(OutboundMessage{
+			Channel:       msg.Channel,
+			ChatID:        msg.ChatID,
+			Content:       "echo: " + msg.Content,
+			CorrelationID: msg.CorrelationID,
+		})
+		mb.InboundDone(msg)
+	}
+}
+
+func TestRequestReturnsReply(t *testing.T) {
+	mb := NewMessageBus()
+	defer mb.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go answerInbound(ctx, mb)
+
+	results := make(chan string, 2)
+	for _, content := range []string{"one", "two"} {
+		go func() {
+			reply, err := mb.Request(ctx, InboundMessage{Channel: "api", ChatID: content, Content: content})
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- reply.ChatID + "=" + reply.Content
+		}()
+	}
+	got := map[string]bool{<-results: true, <-results: true}
+	if !got["one=echo: one"] || !got["two=echo: two"] {
+		t.Errorf("replies = %v", got)
+	}
+
+	// Only the progress updates are queued for channels
+	for i := 0; i < 2; i++ {
+		msg, ok := mb.SubscribeOutbound(ctx)
+		if !ok || !msg.Progress {
+			t.Fatalf("queued %+v, %v", msg, ok)
+		}
+	}
+	if _, outbound := mb.Pending(); outbound != 2 {
+		t.Errorf("pending outbound = %d, want 2", outbound)
+	}
+}
+
+func TestRequestTimesOut(t *testing.T) {
+	mb := NewMessageBus()
+	defer mb.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := mb.Request(ctx, InboundMessage{Channel: "api", Content: "hi"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	msg, _ := mb.ConsumeInbound(context.Background())
+	if msg.CorrelationID == "" {
+		t.Fatal("request published without correlation ID")
+	}
+
+	// A late reply is sent like any other message
+	mb.PublishOutbound(OutboundMessage{Channel: "api", Content: "late", CorrelationID: msg.CorrelationID})
+	if out, ok := mb.SubscribeOutbound(context.Background()); !ok || out.Content != "late" {
+		t.Errorf("late reply = %+v, %v", out, ok)
+	}
+}
+
+func TestRequestOverBroker(t *testing.T) {
+	f := newFakeRedis(t)
+	gateway := newRedisBus(t, f, RoleGateway, "gateway")
+	defer gateway.Close()
+	worker := newRedisBus(t, f, RoleWorker, "worker")
+	defer worker.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go answerInbound(ctx, worker)
+
+	reply, err := gateway.Request(ctx, InboundMessage{Channel: "api", ChatID: "s", Content: "hi"})
+	if err != nil || reply.Content != "echo: hi" {
+		t.Fatalf("reply = %+v, %v", reply, err)
+	}
+}
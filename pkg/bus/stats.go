@@ -0,0 +1,192 @@
+package bus
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of the bus, for seeing where messages pile up
+type Stats struct {
+	Inbound  QueueStats `json:"inbound"`
+	Outbound QueueStats `json:"outbound"`
+	// Outbound queue depths by priority
+	OutboundByPriority map[string]int `json:"outbound_by_priority"`
+	// Messages published and not yet marked done by their consumer,
+	// queued or being handled: the consumer lag
+	PendingInbound  int64 `json:"pending_inbound"`
+	PendingOutbound int64 `json:"pending_outbound"`
+	// Inbound messages dropped or rejected by the overflow policy
+	Dropped     uint64 `json:"dropped"`
+	DeadLetters int    `json:"dead_letters"`
+	Overloaded  bool   `json:"overloaded"`
+	// Messages published per channel
+	Channels map[string]ChannelStats `json:"channels"`
+	Since    time.Time               `json:"since"`
+}
+
+// QueueStats describe a queue
+type QueueStats struct {
+	Depth    int `json:"depth"`
+	Capacity int `json:"capacity"`
+	// Age of the message queued longest; 0 when the queue is empty
+	OldestAgeMS int64 `json:"oldest_age_ms"`
+}
+
+// ChannelStats count the messages of a channel. The per-minute counts are
+// those of the last full minute.
+type ChannelStats struct {
+	Inbound            uint64 `json:"inbound"`
+	Outbound           uint64 `json:"outbound"`
+	InboundLastMinute  uint64 `json:"inbound_last_minute"`
+	OutboundLastMinute uint64 `json:"outbound_last_minute"`
+}
+
+// busStats is what the bus records for Stats
+type busStats struct {
+	since    time.Time
+	inbound  ageQueue
+	outbound [PriorityHigh]ageQueue // In the order of MessageBus.outbound
+
+	mu       sync.Mutex
+	channels map[string]*channelCounter
+}
+
+// channelCounter counts the messages of a channel in total and per minute
+type channelCounter struct {
+	minute                    int64 // Unix minute of the current counts
+	inbound, outbound         uint64
+	inboundNow, outboundNow   uint64 // In the current minute
+	inboundLast, outboundLast uint64 // In the minute before
+}
+
+// roll moves the counts on to the minute now
+func (c *channelCounter) roll(now int64) {
+	if now == c.minute {
+		return
+	}
+	if now == c.minute+1 {
+		c.inboundLast, c.outboundLast = c.inboundNow, c.outboundNow
+	} else {
+		c.inboundLast, c.outboundLast = 0, 0
+	}
+	c.inboundNow, c.outboundNow = 0, 0
+	c.minute = now
+}
+
+// count records a message published to or from channel
+func (s *busStats) count(channel string, inbound bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.channels == nil {
+		s.channels = make(map[string]*channelCounter)
+	}
+	c := s.channels[channel]
+	if c == nil {
+		c = &channelCounter{}
+		s.channels[channel] = c
+	}
+	c.roll(time.Now().Unix() / 60)
+	if inbound {
+		c.inbound++
+		c.inboundNow++
+	} else {
+		c.outbound++
+		c.outboundNow++
+	}
+}
+
+// ageQueue mirrors a queue with the times its messages were queued, so
+// that the age of the oldest can be read without taking it. A message may
+// be taken before its time is recorded; the time is then not recorded.
+type ageQueue struct {
+	mu    sync.Mutex
+	times []time.Time
+	owed  int // Messages taken before their times were recorded
+}
+
+func (q *ageQueue) push() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.owed > 0 {
+		q.owed--
+		return
+	}
+	q.times = append(q.times, time.Now())
+}
+
+func (q *ageQueue) pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.times) == 0 {
+		q.owed++
+		return
+	}
+	q.times[0] = time.Time{}
+	q.times = q.times[1:]
+}
+
+// oldest returns when the longest queued message was queued, or the zero
+// time when the queue is empty
+func (q *ageQueue) oldest() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.times) == 0 {
+		return time.Time{}
+	}
+	return q.times[0]
+}
+
+func (mb *MessageBus) queuedOutbound(p Priority) {
+	mb.stats.outbound[PriorityHigh-p].push()
+}
+
+// Stats returns the current state of the queues and the message counts
+func (mb *MessageBus) Stats() Stats {
+	now := time.Now()
+	age := func(since time.Time) int64 {
+		if since.IsZero() {
+			return 0
+		}
+		return now.Sub(since).Milliseconds()
+	}
+
+	s := Stats{
+		Inbound: QueueStats{
+			Depth:       len(mb.inbound),
+			Capacity:    cap(mb.inbound),
+			OldestAgeMS: age(mb.stats.inbound.oldest()),
+		},
+		OutboundByPriority: make(map[string]int, len(mb.outbound)),
+		Dropped:            mb.DroppedInbound(),
+		Overloaded:         mb.Overloaded(),
+		Channels:           make(map[string]ChannelStats),
+		Since:              mb.stats.since,
+	}
+	s.PendingInbound, s.PendingOutbound = mb.Pending()
+	for i, q := range mb.outbound {
+		s.Outbound.Depth += len(q)
+		s.Outbound.Capacity += cap(q)
+		s.OutboundByPriority[(PriorityHigh - Priority(i)).String()] = len(q)
+		if oldest := age(mb.stats.outbound[i].oldest()); oldest > s.Outbound.OldestAgeMS {
+			s.Outbound.OldestAgeMS = oldest
+		}
+	}
+
+	mb.deadMu.Lock()
+	s.DeadLetters = len(mb.dead)
+	mb.deadMu.Unlock()
+
+	minute := now.Unix() / 60
+	mb.stats.mu.Lock()
+	for name, c := range mb.stats.channels {
+		c.roll(minute)
+		s.Channels[name] = ChannelStats{
+			Inbound:            c.inbound,
+			Outbound:           c.outbound,
+			InboundLastMinute:  c.inboundLast,
+			OutboundLastMinute: c.outboundLast,
+		}
+	}
+	mb.stats.mu.Unlock()
+	return s
+}
@@ -0,0 +1,77 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	mb := newMessageBus(Options{QueueSize: 4}, 0)
+	defer mb.Close()
+	ctx := context.Background()
+
+	mb.PublishInbound(InboundMessage{Channel: "telegram", Content: "one"})
+	mb.PublishInbound(InboundMessage{Channel: "telegram", Content: "two"})
+	mb.PublishInbound(InboundMessage{Channel: "slack", Content: "three"})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", Content: "reply"})
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", Content: "alert", Notification: NotificationAlert})
+	time.Sleep(20 * time.Millisecond)
+
+	s := mb.Stats()
+	if s.Inbound.Depth != 3 || s.Inbound.Capacity != 4 || s.Inbound.OldestAgeMS < 20 {
+		t.Errorf("inbound = %+v", s.Inbound)
+	}
+	if s.Outbound.Depth != 2 || s.OutboundByPriority["high"] != 1 || s.OutboundByPriority["normal"] != 1 {
+		t.Errorf("outbound = %+v, by priority %v", s.Outbound, s.OutboundByPriority)
+	}
+	if s.PendingInbound != 3 || s.PendingOutbound != 2 {
+		t.Errorf("pending = %d, %d", s.PendingInbound, s.PendingOutbound)
+	}
+	if tg := s.Channels["telegram"]; tg.Inbound != 2 || tg.Outbound != 1 {
+		t.Errorf("telegram = %+v", tg)
+	}
+	if sl := s.Channels["slack"]; sl.Inbound != 1 || sl.Outbound != 1 {
+		t.Errorf("slack = %+v", sl)
+	}
+
+	// Taken but not done: no longer queued, still pending
+	for i := 0; i < 3; i++ {
+		mb.ConsumeInbound(ctx)
+	}
+	mb.SubscribeOutbound(ctx)
+	mb.SubscribeOutbound(ctx)
+	s = mb.Stats()
+	if s.Inbound.Depth != 0 || s.Inbound.OldestAgeMS != 0 || s.Outbound.OldestAgeMS != 0 {
+		t.Errorf("after taking: inbound %+v, outbound %+v", s.Inbound, s.Outbound)
+	}
+	if s.PendingInbound != 3 {
+		t.Errorf("pending inbound = %d", s.PendingInbound)
+	}
+}
+
+func TestAgeQueueTakenBeforeRecorded(t *testing.T) {
+	var q ageQueue
+	q.pop() // Taken before push recorded it
+	q.push()
+	if !q.oldest().IsZero() {
+		t.Error("message taken early is still counted")
+	}
+	q.push()
+	if q.oldest().IsZero() {
+		t.Error("queued message not counted")
+	}
+}
+
+func TestChannelCounterRoll(t *testing.T) {
+	c := channelCounter{minute: 10, inboundNow: 5, outboundNow: 2}
+	c.roll(11)
+	if c.inboundLast != 5 || c.outboundLast != 2 || c.inboundNow != 0 {
+		t.Errorf("after a minute: %+v", c)
+	}
+	c.inboundNow = 3
+	c.roll(13)
+	if c.inboundLast != 0 || c.inboundNow != 0 {
+		t.Errorf("after idle minutes: %+v", c)
+	}
+}
@@ -0,0 +1,82 @@
+package bus
+
+import "context"
+
+// Topics of the events published on the bus, with the type of their
+// payload
+const (
+	TopicChannelHealth  = "channel_health"    // ChannelHealthEvent
+	TopicDelivery       = "message_delivery"  // DeliveryEvent
+	TopicBroadcast      = "message_broadcast" // BroadcastEvent
+	TopicAgentLifecycle = "agent_lifecycle"   // AgentLifecycleEvent
+	TopicConfigReload   = "config_reload"     // ConfigReloadEvent
+)
+
+// ChannelHealthEvent is published when a channel changes connection state
+type ChannelHealthEvent struct {
+	Channel  string `json:"channel"`
+	State    string `json:"state"`
+	Previous string `json:"previous"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// DeliveryEvent is published when an outbound message is sent, fails or is
+// retried
+type DeliveryEvent struct {
+	DeliveryID string `json:"delivery_id"`
+	Channel    string `json:"channel"`
+	ChatID     string `json:"chat_id"`
+	Status     string `json:"status"`
+	Attempts   int    `json:"attempts"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BroadcastEvent is published when a broadcast taken from the bus is done
+type BroadcastEvent struct {
+	BroadcastID   string            `json:"broadcast_id"`
+	Delivered     int               `json:"delivered"`
+	FailedTargets []BroadcastTarget `json:"failed_targets,omitempty"`
+}
+
+// States of the agent loop in AgentLifecycleEvent
+const (
+	AgentStarted = "started"
+	AgentStopped = "stopped"
+)
+
+// AgentLifecycleEvent is published when the agent loop starts or stops
+type AgentLifecycleEvent struct {
+	State string `json:"state"`
+	Model string `json:"model,omitempty"`
+}
+
+// ConfigReloadEvent is published after the configuration is read again.
+// Err is set when the new configuration was rejected and the old one kept.
+type ConfigReloadEvent struct {
+	Path    string   `json:"path"`
+	Changed []string `json:"changed,omitempty"` // Top-level sections that changed
+	Err     string   `json:"error,omitempty"`
+}
+
+// Subscribe returns a channel receiving the payloads of type T published on
+// topic from now on; events with other payloads are skipped. The channel is
+// closed when ctx is done.
+func Subscribe[T any](ctx context.Context, mb *MessageBus, topic string) <-chan T {
+	events := mb.SubscribeTopics(ctx, topic)
+	out := make(chan T, eventBuffer)
+	go func() {
+		defer close(out)
+		for ev := range events {
+			payload, ok := ev.Payload.(T)
+			if !ok {
+				continue
+			}
+			select {
+			case out <- payload:
+			default:
+				// Falls behind like any other subscriber
+			}
+		}
+	}()
+	return out
+}
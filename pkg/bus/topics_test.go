@@ -0,0 +1,50 @@
+package bus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribeTopics(t *testing.T) {
+	mb := NewMessageBus()
+	health := mb.SubscribeTopics(t.Context(), TopicChannelHealth)
+	deliveries := Subscribe[DeliveryEvent](t.Context(), mb, TopicDelivery)
+	all := mb.SubscribeEvents(t.Context())
+
+	mb.PublishEvent(Event{Type: TopicDelivery, Payload: DeliveryEvent{DeliveryID: "d-1", Status: "sent"}})
+	// Wrong payload type for the topic, skipped by typed subscribers
+	mb.PublishEvent(Event{Type: TopicDelivery, Data: map[string]string{"delivery_id": "d-2"}})
+	mb.PublishEvent(Event{Type: TopicChannelHealth, Source: "telegram", Payload: ChannelHealthEvent{Channel: "telegram", State: "connected"}})
+
+	select {
+	case ev := <-health:
+		if ev.Source != "telegram" || ev.Payload.(ChannelHealthEvent).State != "connected" {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("missing channel health event")
+	}
+	select {
+	case ev := <-health:
+		t.Errorf("event of another topic received: %+v", ev)
+	default:
+	}
+
+	select {
+	case d := <-deliveries:
+		if d.DeliveryID != "d-1" {
+			t.Errorf("unexpected delivery %+v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("missing delivery event")
+	}
+	select {
+	case d := <-deliveries:
+		t.Errorf("event without payload received: %+v", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if n := len(all); n != 3 {
+		t.Errorf("subscriber to all topics got %d events, want 3", n)
+	}
+}
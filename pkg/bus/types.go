@@ -1,5 +1,7 @@
 package bus
 
+import "fmt"
+
 type InboundMessage struct {
 	Channel    string            `json:"channel"`
 	SenderID   string            `json:"sender_id"`
@@ -8,12 +10,194 @@ type InboundMessage struct {
 	Media      []string          `json:"media,omitempty"`
 	SessionKey string            `json:"session_key"`
 	Metadata   map[string]string `json:"metadata,omitempty"`
+	// TraceID follows the message through the agent, provider and tool
+	// logs into the replies it causes. Assigned on publish when empty.
+	TraceID string `json:"trace_id,omitempty"`
+	// CorrelationID marks a message sent with Request; the agent copies it
+	// to its reply
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// seq is the message's place in the journal of a persistent bus
+	seq uint64
 }
 
 type OutboundMessage struct {
 	Channel string `json:"channel"`
 	ChatID  string `json:"chat_id"`
 	Content string `json:"content"`
+	// ReplyTo is the platform message ID to quote. Channels without
+	// reply support ignore it.
+	ReplyTo string `json:"reply_to,omitempty"`
+	// Reaction is an emoji to react to ReplyTo with instead of sending Content.
+	Reaction string `json:"reaction,omitempty"`
+	// AccountID selects the account to send from on channels serving
+	// several accounts (the inbound "account_id" metadata).
+	AccountID string `json:"account_id,omitempty"`
+	// Attachments are files sent after Content. Channels without media
+	// support ignore them.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Notification is the kind of system notification the message carries
+	// (one of the Notification constants); empty for conversation replies.
+	Notification string `json:"notification,omitempty"`
+	// Formatted marks Content as already in the channel's native markup, so
+	// channels send it without converting Markdown.
+	Formatted bool `json:"formatted,omitempty"`
+	// Card is structured content sent after Content. Channels render it
+	// natively where they can and as text otherwise.
+	Card *Card `json:"card,omitempty"`
+	// Keyboard is rows of buttons shown under Content. Channels without
+	// inline keyboards show the buttons as those of Card.
+	Keyboard [][]CardButton `json:"keyboard,omitempty"`
+	// Poll asks the chat to vote, after Content. Channels with native polls
+	// show one; others list numbered options that are answered by number.
+	Poll *Poll `json:"poll,omitempty"`
+	// Contact shares a contact card, after Content. Channels without
+	// contact cards send it as text.
+	Contact *Contact `json:"contact,omitempty"`
+	// TTLSeconds deletes the message that long after it is sent, for
+	// sensitive replies. Channels that cannot delete messages keep it.
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+	// Progress marks an update sent while the agent is still working.
+	// Channels that can edit messages show the updates of a task in one
+	// message, which the next reply to the chat replaces.
+	Progress bool `json:"progress,omitempty"`
+	// TraceID is the trace ID of the inbound message this replies to
+	TraceID string `json:"trace_id,omitempty"`
+	// DeliveryID identifies the message in delivery status events.
+	// Assigned on publish when empty.
+	DeliveryID string `json:"delivery_id,omitempty"`
+	// CorrelationID is that of the inbound message this replies to, for
+	// messages sent with Request
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// IdempotencyKey, when set, sends the message to a chat at most once:
+	// a message published again with the same key, by a retried agent turn
+	// or a bus replay after a crash, is skipped. Keys are remembered for a
+	// day.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Broadcast sends the message to each of these chats instead of
+	// Channel and ChatID. Channel BroadcastAdmins sends it to the admins.
+	Broadcast []BroadcastTarget `json:"broadcast,omitempty"`
+	// Priority decides which queued messages are sent first. Unset, it
+	// follows from the message, see EffectivePriority.
+	Priority Priority `json:"priority,omitempty"`
+
+	// seq is the message's place in the journal of a persistent bus
+	seq uint64
+}
+
+// Priority of an outbound message. Messages of higher priority are sent
+// before queued messages of lower priority; messages to the same chat are
+// always sent in the order they were published.
+type Priority int
+
+const (
+	PriorityAuto   Priority = iota // Derived from the message
+	PriorityLow                    // Scheduled messages and broadcasts
+	PriorityNormal                 // Replies to users
+	PriorityHigh                   // System and admin messages
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityAuto:
+		return "auto"
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+// sensitive reports whether the message must not be stored: messages
+// with a TTL carry secrets and one-time codes, and are kept only in memory
+func (m OutboundMessage) sensitive() bool {
+	return m.TTLSeconds > 0
+}
+
+// EffectivePriority returns the priority of the message: Priority if set,
+// otherwise high for alerts and errors, low for reminders, heartbeats and
+// broadcasts, and normal for everything else
+func (m OutboundMessage) EffectivePriority() Priority {
+	if m.Priority > PriorityAuto {
+		return min(m.Priority, PriorityHigh)
+	}
+	switch {
+	case m.Notification == NotificationAlert || m.Notification == NotificationError:
+		return PriorityHigh
+	case m.Notification == NotificationReminder || m.Notification == NotificationHeartbeat || len(m.Broadcast) > 0:
+		return PriorityLow
+	}
+	return PriorityNormal
+}
+
+// BroadcastAdmins as the channel of an outbound message sends it to every
+// admin listed as "channel:sender_id"
+const BroadcastAdmins = "admins"
+
+// BroadcastTarget is a chat a broadcast message is sent to
+type BroadcastTarget struct {
+	Channel   string `json:"channel"`
+	ChatID    string `json:"chat_id"`
+	AccountID string `json:"account_id,omitempty"`
+}
+
+// Kinds of system notifications, used to pick outbound templates
+const (
+	NotificationAlert     = "alert"      // Incident alerts
+	NotificationRepoEvent = "repo_event" // Repository webhook events
+	NotificationReminder  = "reminder"   // Scheduled messages and command results
+	NotificationDevice    = "device"     // Device events
+	NotificationHeartbeat = "heartbeat"  // Heartbeat results
+	NotificationError     = "error"      // Problems of the agent itself
+)
+
+// Attachment is a file sent with an outbound message
+type Attachment struct {
+	Path     string `json:"path,omitempty"` // Local file; takes precedence over URL
+	URL      string `json:"url,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+}
+
+// Card is a structured reply: a title, fields, buttons and an image
+type Card struct {
+	Title    string       `json:"title,omitempty"`
+	Text     string       `json:"text,omitempty"` // Markdown
+	Fields   []CardField  `json:"fields,omitempty"`
+	Buttons  []CardButton `json:"buttons,omitempty"`
+	ImageURL string       `json:"image_url,omitempty"`
+}
+
+// CardField is a labelled value shown on a card
+type CardField struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// CardButton opens URL, or sends Reply back as the user's message when
+// pressed on channels that support it
+type CardButton struct {
+	Label string `json:"label"`
+	URL   string `json:"url,omitempty"`
+	Reply string `json:"reply,omitempty"`
+}
+
+// Poll is a question the chat votes on
+type Poll struct {
+	ID              string   `json:"id"`
+	Question        string   `json:"question"`
+	Options         []string `json:"options"`
+	MultipleAnswers bool     `json:"multiple_answers,omitempty"`
+}
+
+// Contact is a person's contact card
+type Contact struct {
+	Name   string   `json:"name"`
+	Phones []string `json:"phones,omitempty"`
+	Emails []string `json:"emails,omitempty"`
 }
 
 type MessageHandler func(InboundMessage) error
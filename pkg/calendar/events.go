@@ -0,0 +1,198 @@
+package calendar
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxCalendarSize bounds the ICS documents read by Events
+const maxCalendarSize = 4 << 20
+
+// Event is a calendar event read from an ICS document
+type Event struct {
+	Summary string
+	Start   time.Time
+	AllDay  bool
+}
+
+// Events lists today's events from subscribed ICS calendars, such as the
+// secret address of a Google or Nextcloud calendar. It is a context provider
+// for scheduled digests. Recurring events only show up on their first date.
+type Events struct {
+	urls     []string
+	location *time.Location
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewEvents creates a provider for the calendars at urls. Dates are taken in
+// loc, local time when nil.
+func NewEvents(urls []string, loc *time.Location) *Events {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Events{
+		urls:     urls,
+		location: loc,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}
+}
+
+// Context returns today's events, one per line, ordered by start time
+func (e *Events) Context(ctx context.Context, since time.Time) (string, error) {
+	now := e.now().In(e.location)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, e.location)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	var today []Event
+	for _, url := range e.urls {
+		events, err := e.fetch(ctx, url)
+		if err != nil {
+			return "", err
+		}
+		for _, ev := range events {
+			if !ev.Start.Before(dayStart) && ev.Start.Before(dayEnd) {
+				today = append(today, ev)
+			}
+		}
+	}
+	if len(today) == 0 {
+		return "No events today", nil
+	}
+
+	sort.SliceStable(today, func(i, j int) bool {
+		if today[i].AllDay != today[j].AllDay {
+			return today[i].AllDay
+		}
+		return today[i].Start.Before(today[j].Start)
+	})
+	var b strings.Builder
+	for _, ev := range today {
+		if ev.AllDay {
+			fmt.Fprintf(&b, "All day: %s\n", ev.Summary)
+		} else {
+			fmt.Fprintf(&b, "%s %s\n", ev.Start.In(e.location).Format("15:04"), ev.Summary)
+		}
+	}
+	return b.String(), nil
+}
+
+func (e *Events) fetch(ctx context.Context, url string) ([]Event, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar url: %w", err)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch calendar: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch calendar: HTTP %d", resp.StatusCode)
+	}
+	return ParseEvents(io.LimitReader(resp.Body, maxCalendarSize), e.location)
+}
+
+// ParseEvents reads the events of an ICS document. Floating and all-day
+// times are taken in loc.
+func ParseEvents(r io.Reader, loc *time.Location) ([]Event, error) {
+	var events []Event
+	var current *Event
+	for _, line := range unfoldLines(r) {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(name, ";")
+
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				current = &Event{}
+			}
+		case "END":
+			if strings.EqualFold(value, "VEVENT") && current != nil {
+				if !current.Start.IsZero() {
+					events = append(events, *current)
+				}
+				current = nil
+			}
+		case "SUMMARY":
+			if current != nil {
+				current.Summary = unescapeText(value)
+			}
+		case "DTSTART":
+			if current != nil {
+				start, allDay, err := parseDateTime(value, params, loc)
+				if err != nil {
+					return nil, err
+				}
+				current.Start, current.AllDay = start, allDay
+			}
+		}
+	}
+	return events, nil
+}
+
+// unfoldLines joins folded content lines (RFC 5545 section 3.1)
+func unfoldLines(r io.Reader) []string {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxCalendarSize)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseDateTime parses a DATE or DATE-TIME value, honouring a TZID parameter
+func parseDateTime(value, params string, loc *time.Location) (time.Time, bool, error) {
+	for _, param := range strings.Split(params, ";") {
+		key, val, _ := strings.Cut(param, "=")
+		switch strings.ToUpper(key) {
+		case "TZID":
+			if tz, err := time.LoadLocation(strings.Trim(val, `"`)); err == nil {
+				loc = tz
+			}
+		case "VALUE":
+			if strings.EqualFold(val, "DATE") {
+				t, err := time.ParseInLocation("20060102", value, loc)
+				return t, true, err
+			}
+		}
+	}
+
+	if len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icsTimestampForm, value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// unescapeText reverses escapeText
+func unescapeText(s string) string {
+	return strings.NewReplacer(
+		`\\`, `\`,
+		`\;`, ";",
+		`\,`, ",",
+		`\n`, "\n",
+		`\N`, "\n",
+	).Replace(s)
+}
@@ -0,0 +1,60 @@
+package calendar
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testICS = "BEGIN:VCALENDAR\r\n" +
+	"BEGIN:VEVENT\r\nSUMMARY:Standup\r\nDTSTART;TZID=Europe/Berlin:20260301T093000\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nSUMMARY:Lunch with Sam\\, Alex\r\nDTSTART:20260301T110000Z\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nSUMMARY:Public\r\n  holiday\r\nDTSTART;VALUE=DATE:20260301\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nSUMMARY:Tomorrow\r\nDTSTART:20260302T080000\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseEvents(t *testing.T) {
+	events, err := ParseEvents(strings.NewReader(testICS), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %+v", events)
+	}
+	if events[1].Summary != "Lunch with Sam, Alex" {
+		t.Errorf("summary = %q", events[1].Summary)
+	}
+	if events[2].Summary != "Public holiday" || !events[2].AllDay {
+		t.Errorf("unexpected all-day event %+v", events[2])
+	}
+	if want := time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC); !events[0].Start.Equal(want) {
+		t.Errorf("TZID start = %v, want %v", events[0].Start, want)
+	}
+}
+
+func TestEventsContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testICS))
+	}))
+	defer srv.Close()
+
+	events := NewEvents([]string{srv.URL}, time.UTC)
+	events.now = func() time.Time { return time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC) }
+
+	got, err := events.Context(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "All day: Public holiday\n08:30 Standup\n11:00 Lunch with Sam, Alex\n"
+	if got != want {
+		t.Errorf("Context() = %q, want %q", got, want)
+	}
+
+	events.now = func() time.Time { return time.Date(2026, 3, 5, 7, 0, 0, 0, time.UTC) }
+	if got, _ := events.Context(context.Background(), time.Time{}); got != "No events today" {
+		t.Errorf("Context() = %q on an empty day", got)
+	}
+}
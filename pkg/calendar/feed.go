@@ -0,0 +1,204 @@
+package calendar
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adhocore/gronx"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+// PathPrefix is the gateway route under which the feed is served.
+const PathPrefix = "/calendar/"
+
+const (
+	defaultHorizon   = 30 * 24 * time.Hour
+	maxEventsPerJob  = 200
+	eventDuration    = 15 * time.Minute
+	icsTimestampForm = "20060102T150405Z"
+)
+
+// JobSource lists the scheduled jobs to publish.
+type JobSource interface {
+	ListJobs(includeDisabled bool) []cron.CronJob
+}
+
+// Feed serves the agent's reminders and scheduled jobs as a read-only ICS
+// calendar. The feed URL contains an HMAC token so it can be subscribed to
+// from a phone without exposing the gateway's other endpoints.
+type Feed struct {
+	jobs    JobSource
+	token   string
+	horizon time.Duration
+	now     func() time.Time
+}
+
+// NewFeed creates a new calendar feed. Recurring jobs are expanded up to
+// horizon into the future.
+func NewFeed(jobs JobSource, secret string, horizon time.Duration) (*Feed, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("calendar feed requires a secret")
+	}
+	if horizon <= 0 {
+		horizon = defaultHorizon
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("picoclaw-calendar-feed"))
+
+	return &Feed{
+		jobs:    jobs,
+		token:   hex.EncodeToString(mac.Sum(nil))[:32],
+		horizon: horizon,
+		now:     time.Now,
+	}, nil
+}
+
+// Path returns the signed path of the feed, to be appended to the gateway URL.
+func (f *Feed) Path() string {
+	return PathPrefix + f.token + ".ics"
+}
+
+func (f *Feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !hmac.Equal([]byte(r.URL.Path), []byte(f.Path())) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(f.Render()))
+}
+
+// Render builds the ICS document for the currently scheduled jobs.
+func (f *Feed) Render() string {
+	now := f.now().UTC()
+	until := now.Add(f.horizon)
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//picoclaw//agent schedule//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:PicoClaw",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT15M",
+	}
+
+	for _, job := range f.jobs.ListJobs(false) {
+		summary := job.Name
+		if summary == "" {
+			summary = job.Payload.Message
+		}
+		for _, start := range occurrences(job, now, until) {
+			lines = append(lines,
+				"BEGIN:VEVENT",
+				fmt.Sprintf("UID:%s-%d@picoclaw", job.ID, start.Unix()),
+				"DTSTAMP:"+now.Format(icsTimestampForm),
+				"DTSTART:"+start.UTC().Format(icsTimestampForm),
+				"DTEND:"+start.Add(eventDuration).UTC().Format(icsTimestampForm),
+				"SUMMARY:"+escapeText(summary),
+				"DESCRIPTION:"+escapeText(job.Payload.Message),
+				"END:VEVENT",
+			)
+		}
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(foldLine(line))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// occurrences expands a job's schedule into run times within [from, until).
+func occurrences(job cron.CronJob, from, until time.Time) []time.Time {
+	s := job.Schedule
+	var runs []time.Time
+
+	switch s.Kind {
+	case "at":
+		if s.AtMS != nil {
+			at := time.UnixMilli(*s.AtMS)
+			if !at.Before(from) && at.Before(until) {
+				runs = append(runs, at)
+			}
+		}
+
+	case "every":
+		if s.EveryMS == nil || *s.EveryMS <= 0 {
+			return nil
+		}
+		every := time.Duration(*s.EveryMS) * time.Millisecond
+		next := from.Add(every)
+		if job.State.NextRunAtMS != nil {
+			next = time.UnixMilli(*job.State.NextRunAtMS)
+		}
+		for ; next.Before(until) && len(runs) < maxEventsPerJob; next = next.Add(every) {
+			if !next.Before(from) {
+				runs = append(runs, next)
+			}
+		}
+
+	case "cron":
+		if s.Expr == "" {
+			return nil
+		}
+		next := from
+		for len(runs) < maxEventsPerJob {
+			t, err := gronx.NextTickAfter(s.Expr, next, false)
+			if err != nil || !t.Before(until) {
+				break
+			}
+			runs = append(runs, t)
+			next = t
+		}
+	}
+
+	return runs
+}
+
+// escapeText escapes a TEXT property value (RFC 5545 section 3.3.11).
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// foldLine splits content lines longer than 75 octets (RFC 5545 section 3.1)
+// without breaking UTF-8 sequences.
+func foldLine(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package calendar
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+type staticJobs []cron.CronJob
+
+func (s staticJobs) ListJobs(includeDisabled bool) []cron.CronJob {
+	return s
+}
+
+func newTestFeed(t *testing.T, jobs ...cron.CronJob) *Feed {
+	t.Helper()
+	feed, err := NewFeed(staticJobs(jobs), "s3cret", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("NewFeed: %v", err)
+	}
+	feed.now = func() time.Time { return time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC) }
+	return feed
+}
+
+func TestFeedRender(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC).UnixMilli()
+	feed := newTestFeed(t,
+		cron.CronJob{
+			ID:       "once",
+			Name:     "Call dentist",
+			Schedule: cron.CronSchedule{Kind: "at", AtMS: &at},
+			Payload:  cron.CronPayload{Message: "Call the dentist, ask about Tuesday; bring card"},
+		},
+		cron.CronJob{
+			ID:       "daily",
+			Name:     "Standup",
+			Schedule: cron.CronSchedule{Kind: "cron", Expr: "0 9 * * *"},
+		},
+	)
+
+	ics := feed.Render()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:once-",
+		"DTSTART:20260301T123000Z",
+		`Call the dentist\, ask about Tuesday\; bring card`,
+		"DTSTART:20260301T090000Z",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("feed missing %q:\n%s", want, ics)
+		}
+	}
+	if n := strings.Count(ics, "SUMMARY:Standup"); n != 1 {
+		t.Errorf("expected one standup within the 24h horizon, got %d", n)
+	}
+}
+
+func TestFeedSignedURL(t *testing.T) {
+	feed := newTestFeed(t)
+
+	rec := httptest.NewRecorder()
+	feed.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, feed.Path(), nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") {
+		t.Errorf("expected calendar response, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	feed.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PathPrefix+"guess.ics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected unsigned path to be rejected, got %d", rec.Code)
+	}
+
+	if _, err := NewFeed(staticJobs(nil), "", 0); err == nil {
+		t.Error("expected missing secret to be rejected")
+	}
+}
+
+func TestFoldLine(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("é", 60)
+	folded := foldLine(line)
+	for _, part := range strings.Split(folded, "\r\n") {
+		if len(part) > 75 {
+			t.Errorf("folded line exceeds 75 octets: %d", len(part))
+		}
+	}
+	if strings.ReplaceAll(folded, "\r\n ", "") != line {
+		t.Error("unfolding should restore the original line")
+	}
+}
@@ -0,0 +1,186 @@
+package channels
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// accessList matches senders or chats against allow or deny list entries.
+// An entry is an exact ID, a glob using * and ? (e.g. "+49*"), or a
+// regular expression written as "re:<expr>".
+type accessList []accessEntry
+
+type accessEntry struct {
+	value   string
+	pattern *regexp.Regexp // nil for exact entries
+}
+
+// newAccessList compiles entries. Invalid regular expressions are logged
+// and skipped rather than matching everything.
+func newAccessList(channel string, entries []string) accessList {
+	list := make(accessList, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var expr string
+		switch {
+		case strings.HasPrefix(entry, "re:"):
+			expr = "^(?:" + strings.TrimPrefix(entry, "re:") + ")$"
+		case strings.ContainsAny(entry, "*?"):
+			expr = globToRegexp(entry)
+		default:
+			list = append(list, accessEntry{value: entry})
+			continue
+		}
+
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			logger.WarnCF(channel, "Ignoring invalid access pattern", map[string]interface{}{
+				"pattern": entry,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		list = append(list, accessEntry{value: entry, pattern: pattern})
+	}
+	return list
+}
+
+// globToRegexp converts a glob where * matches any run of characters and ?
+// matches one character into an anchored regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// matchesSender reports whether senderID matches an entry. Compound
+// "id|username" senders match on either part.
+func (l accessList) matchesSender(senderID string) bool {
+	idPart, userPart := senderID, ""
+	if idx := strings.Index(senderID, "|"); idx > 0 {
+		idPart = senderID[:idx]
+		userPart = senderID[idx+1:]
+	}
+
+	for _, entry := range l {
+		if entry.pattern == nil {
+			if senderMatchesEntry(senderID, idPart, userPart, entry.value) {
+				return true
+			}
+			continue
+		}
+		if entry.pattern.MatchString(senderID) || entry.pattern.MatchString(idPart) ||
+			(userPart != "" && entry.pattern.MatchString(userPart)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesChat reports whether chatID matches an entry. Threads and topics
+// ("<chat>/<thread>") also match the entries of their chat.
+func (l accessList) matchesChat(chatID string) bool {
+	base, _, _ := strings.Cut(chatID, "/")
+	for _, entry := range l {
+		if entry.pattern == nil {
+			if chatID == entry.value || base == entry.value {
+				return true
+			}
+		} else if entry.pattern.MatchString(chatID) || entry.pattern.MatchString(base) {
+			return true
+		}
+	}
+	return false
+}
+
+// senderMatchesEntry matches a sender against an exact allowlist entry.
+func senderMatchesEntry(senderID, idPart, userPart, allowed string) bool {
+	// Strip leading "@" from allowed value for username matching
+	trimmed := strings.TrimPrefix(allowed, "@")
+	allowedID := trimmed
+	allowedUser := ""
+	if idx := strings.Index(trimmed, "|"); idx > 0 {
+		allowedID = trimmed[:idx]
+		allowedUser = trimmed[idx+1:]
+	}
+
+	// Support either side using "id|username" compound form.
+	// This keeps backward compatibility with legacy Telegram allowlist entries.
+	return senderID == allowed ||
+		idPart == allowed ||
+		senderID == trimmed ||
+		idPart == trimmed ||
+		idPart == allowedID ||
+		(allowedUser != "" && senderID == allowedUser) ||
+		(userPart != "" && (userPart == allowed || userPart == trimmed || userPart == allowedUser))
+}
+
+// without returns the list minus the exact entry value
+func (l accessList) without(value string) accessList {
+	kept := make(accessList, 0, len(l))
+	for _, entry := range l {
+		if entry.pattern != nil || entry.value != value {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// configureAccess sets the deny list and chat lists of the channel
+func (c *BaseChannel) configureAccess(cfg config.ChannelAccessConfig) {
+	c.accessMu.Lock()
+	defer c.accessMu.Unlock()
+	c.denyList = newAccessList(c.name, cfg.DenyFrom)
+	c.allowChats = newAccessList(c.name, cfg.AllowChats)
+	c.denyChats = newAccessList(c.name, cfg.DenyChats)
+}
+
+// AllowSender removes senderID from the deny list and, when the channel
+// has an allowlist, adds it there. Deny patterns still apply.
+func (c *BaseChannel) AllowSender(senderID string) {
+	c.accessMu.Lock()
+	defer c.accessMu.Unlock()
+	c.denyList = c.denyList.without(senderID)
+	if len(c.allowList) > 0 && !c.allowList.matchesSender(senderID) {
+		c.allowList = append(c.allowList, accessEntry{value: senderID})
+	}
+}
+
+// DenySender adds senderID to the deny list and removes it from the allowlist
+func (c *BaseChannel) DenySender(senderID string) {
+	c.accessMu.Lock()
+	defer c.accessMu.Unlock()
+	if !c.denyList.matchesSender(senderID) {
+		c.denyList = append(c.denyList, accessEntry{value: senderID})
+	}
+	c.allowList = c.allowList.without(senderID)
+}
+
+// IsChatAllowed reports whether messages from chatID are accepted. Deny
+// entries are checked first; an empty chat allowlist accepts every chat.
+func (c *BaseChannel) IsChatAllowed(chatID string) bool {
+	c.accessMu.RLock()
+	defer c.accessMu.RUnlock()
+	if c.denyChats.matchesChat(chatID) {
+		return false
+	}
+	return len(c.allowChats) == 0 || c.allowChats.matchesChat(chatID)
+}
@@ -0,0 +1,500 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/trace"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Incident platforms supported by the alert webhook channel.
+const (
+	IncidentPlatformPagerDuty = "pagerduty"
+	IncidentPlatformOpsgenie  = "opsgenie"
+)
+
+// maxTrackedIncidents bounds the number of open incidents remembered for /ack and /resolve.
+const maxTrackedIncidents = 100
+
+// IncidentResponder is implemented by channels that can acknowledge and resolve
+// incidents on the platform that raised them.
+type IncidentResponder interface {
+	AcknowledgeIncident(ctx context.Context, ref, channel, chatID string) (string, error)
+	ResolveIncident(ctx context.Context, ref, channel, chatID string) (string, error)
+}
+
+// incident is a provider-neutral summary of an alert.
+type incident struct {
+	Platform string
+	ID       string
+	Title    string
+	Details  string
+}
+
+// Ref returns the identifier used in /ack and /resolve commands.
+func (i *incident) Ref() string {
+	return i.Platform + ":" + i.ID
+}
+
+// AlertWebhookChannel ingests PagerDuty/Opsgenie alerts, asks the agent for an
+// incident summary and forwards it to the on-call owner, who can then
+// acknowledge or resolve the incident from chat.
+type AlertWebhookChannel struct {
+	*BaseChannel
+	config     config.AlertWebhookConfig
+	httpServer *http.Server
+	client     *http.Client
+
+	mu        sync.Mutex
+	incidents map[string]*incident // ref -> incident
+	order     []string             // refs, oldest first
+}
+
+// NewAlertWebhookChannel creates a new alert webhook channel.
+func NewAlertWebhookChannel(cfg config.AlertWebhookConfig, messageBus *bus.MessageBus) (*AlertWebhookChannel, error) {
+	if cfg.PagerDutySecret == "" && cfg.OpsgenieToken == "" {
+		return nil, fmt.Errorf("alert webhook requires pagerduty_secret or opsgenie_token")
+	}
+	if cfg.NotifyChannel == "" || cfg.NotifyChatID == "" {
+		return nil, fmt.Errorf("alert webhook requires notify_channel and notify_chat_id")
+	}
+
+	return &AlertWebhookChannel{
+		BaseChannel: NewBaseChannel("alert_webhook", cfg, messageBus, nil),
+		config:      cfg,
+		client:      &http.Client{Timeout: 15 * time.Second},
+		incidents:   make(map[string]*incident),
+	}, nil
+}
+
+// Start launches the webhook HTTP server.
+func (c *AlertWebhookChannel) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	path := strings.TrimSuffix(c.config.WebhookPath, "/")
+	if path == "" {
+		path = "/webhook/alerts"
+	}
+	mux.HandleFunc(path+"/pagerduty", c.pagerDutyHandler)
+	mux.HandleFunc(path+"/opsgenie", c.opsgenieHandler)
+
+	addr := fmt.Sprintf("%s:%d", c.config.WebhookHost, c.config.WebhookPort)
+	c.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.InfoCF("alert_webhook", "Alert webhook server listening", map[string]interface{}{
+			"addr": addr,
+			"path": path,
+		})
+		if err := c.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("alert_webhook", "Webhook server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	c.setRunning(true)
+	return nil
+}
+
+// Stop gracefully shuts down the HTTP server.
+func (c *AlertWebhookChannel) Stop(ctx context.Context) error {
+	if c.httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := c.httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.ErrorCF("alert_webhook", "Webhook server shutdown error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	c.setRunning(false)
+	return nil
+}
+
+// Send forwards the agent's incident summary to the on-call owner, followed by
+// the commands that acknowledge or resolve the incident.
+func (c *AlertWebhookChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+	content := fmt.Sprintf("%s\n\nReply /ack %s or /resolve %s", msg.Content, msg.ChatID, msg.ChatID)
+	c.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:      c.config.NotifyChannel,
+		ChatID:       c.config.NotifyChatID,
+		Content:      content,
+		Notification: bus.NotificationAlert,
+	})
+	return nil
+}
+
+// AcknowledgeIncident acknowledges an incident on its platform. An empty ref
+// selects the most recent open incident.
+func (c *AlertWebhookChannel) AcknowledgeIncident(ctx context.Context, ref, channel, chatID string) (string, error) {
+	inc, err := c.lookup(ref, channel, chatID)
+	if err != nil {
+		return "", err
+	}
+	if err := c.updateIncident(ctx, inc, false); err != nil {
+		return "", err
+	}
+	c.audit("Incident acknowledged", inc, channel, chatID)
+	return fmt.Sprintf("Acknowledged %s: %s", inc.Ref(), inc.Title), nil
+}
+
+// ResolveIncident resolves an incident on its platform and stops tracking it.
+// An empty ref selects the most recent open incident.
+func (c *AlertWebhookChannel) ResolveIncident(ctx context.Context, ref, channel, chatID string) (string, error) {
+	inc, err := c.lookup(ref, channel, chatID)
+	if err != nil {
+		return "", err
+	}
+	if err := c.updateIncident(ctx, inc, true); err != nil {
+		return "", err
+	}
+	c.forget(inc.Ref())
+	c.audit("Incident resolved", inc, channel, chatID)
+	return fmt.Sprintf("Resolved %s: %s", inc.Ref(), inc.Title), nil
+}
+
+// lookup finds a tracked incident. Only the configured notification chat may
+// act on incidents.
+func (c *AlertWebhookChannel) lookup(ref, channel, chatID string) (*incident, error) {
+	if channel != c.config.NotifyChannel || chatID != c.config.NotifyChatID {
+		return nil, fmt.Errorf("incident commands are only accepted from the on-call chat")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ref == "" {
+		if len(c.order) == 0 {
+			return nil, fmt.Errorf("no open incidents")
+		}
+		return c.incidents[c.order[len(c.order)-1]], nil
+	}
+	if inc, ok := c.incidents[ref]; ok {
+		return inc, nil
+	}
+	// Accept a bare ID when it is unambiguous
+	var match *incident
+	for _, inc := range c.incidents {
+		if inc.ID == ref {
+			if match != nil {
+				return nil, fmt.Errorf("incident %q is ambiguous, use <platform>:<id>", ref)
+			}
+			match = inc
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("unknown incident %q", ref)
+	}
+	return match, nil
+}
+
+func (c *AlertWebhookChannel) track(inc *incident) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ref := inc.Ref()
+	if _, exists := c.incidents[ref]; !exists {
+		c.order = append(c.order, ref)
+	}
+	c.incidents[ref] = inc
+	for len(c.order) > maxTrackedIncidents {
+		delete(c.incidents, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+func (c *AlertWebhookChannel) forget(ref string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.incidents, ref)
+	for i, r := range c.order {
+		if r == ref {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *AlertWebhookChannel) audit(msg string, inc *incident, channel, chatID string) {
+	logger.InfoCF("alert_webhook", msg, map[string]interface{}{
+		"incident": inc.Ref(),
+		"channel":  channel,
+		"chat_id":  chatID,
+	})
+}
+
+func (c *AlertWebhookChannel) pagerDutyHandler(w http.ResponseWriter, r *http.Request) {
+	body, ok := c.readWebhook(w, r)
+	if !ok {
+		return
+	}
+	if !c.verifyPagerDutySignature(body, r.Header.Get("X-PagerDuty-Signature")) {
+		logger.WarnC("alert_webhook", "Invalid PagerDuty webhook signature")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	inc, resolved, err := parsePagerDutyEvent(body)
+	c.finishWebhook(w, trace.FromRequest(r), inc, resolved, err)
+}
+
+func (c *AlertWebhookChannel) opsgenieHandler(w http.ResponseWriter, r *http.Request) {
+	body, ok := c.readWebhook(w, r)
+	if !ok {
+		return
+	}
+	if c.config.OpsgenieToken == "" ||
+		subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Webhook-Token")), []byte(c.config.OpsgenieToken)) != 1 {
+		logger.WarnC("alert_webhook", "Invalid Opsgenie webhook token")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	inc, resolved, err := parseOpsgenieEvent(body)
+	c.finishWebhook(w, trace.FromRequest(r), inc, resolved, err)
+}
+
+func (c *AlertWebhookChannel) readWebhook(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+func (c *AlertWebhookChannel) finishWebhook(w http.ResponseWriter, traceID string, inc *incident, resolved bool, err error) {
+	if err != nil {
+		logger.ErrorCF("alert_webhook", "Failed to parse webhook payload", map[string]interface{}{
+			"error": err.Error(),
+		})
+		errs.WriteHTTP(w, fmt.Errorf("%w: %w", errs.ErrValidation, err))
+		return
+	}
+
+	w.Header().Set(trace.Header, traceID)
+	w.WriteHeader(http.StatusOK)
+
+	if inc == nil || inc.ID == "" {
+		return
+	}
+	if resolved {
+		c.forget(inc.Ref())
+		return
+	}
+	c.track(inc)
+	c.publishIncident(inc, traceID)
+}
+
+func (c *AlertWebhookChannel) publishIncident(inc *incident, traceID string) {
+	logger.InfoCF("alert_webhook", "Incident received", map[string]interface{}{
+		"incident": inc.Ref(),
+		"title":    inc.Title,
+		"trace_id": traceID,
+	})
+
+	prompt := fmt.Sprintf("New %s incident %s:\n%s\n\n"+
+		"Write a short incident summary for the on-call engineer: what is affected, "+
+		"how severe it looks, and one or two first things to check.",
+		inc.Platform, inc.Ref(), inc.Details)
+
+	metadata := map[string]string{
+		"platform":    inc.Platform,
+		"incident_id": inc.ID,
+		"trace_id":    traceID,
+	}
+
+	c.HandleMessage(inc.Platform, inc.Ref(), prompt, nil, metadata)
+}
+
+// verifyPagerDutySignature validates the X-PagerDuty-Signature header, which may
+// carry several comma-separated signatures during secret rotation.
+func (c *AlertWebhookChannel) verifyPagerDutySignature(body []byte, header string) bool {
+	if c.config.PagerDutySecret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(c.config.PagerDutySecret))
+	mac.Write(body)
+	expected := "v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, sig := range strings.Split(header, ",") {
+		if hmac.Equal([]byte(expected), []byte(strings.TrimSpace(sig))) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateIncident acknowledges or resolves an incident through the platform API.
+func (c *AlertWebhookChannel) updateIncident(ctx context.Context, inc *incident, resolve bool) error {
+	switch inc.Platform {
+	case IncidentPlatformPagerDuty:
+		if c.config.PagerDutyAPIKey == "" {
+			return fmt.Errorf("pagerduty_api_key is not configured")
+		}
+		status := "acknowledged"
+		if resolve {
+			status = "resolved"
+		}
+		payload := map[string]interface{}{
+			"incident": map[string]string{"type": "incident_reference", "status": status},
+		}
+		headers := map[string]string{
+			"Authorization": "Token token=" + c.config.PagerDutyAPIKey,
+			"Accept":        "application/vnd.pagerduty+json;version=2",
+			"From":          c.config.PagerDutyFrom,
+		}
+		endpoint := fmt.Sprintf("%s/incidents/%s", apiBase(c.config.PagerDutyAPIBase, "https://api.pagerduty.com"), url.PathEscape(inc.ID))
+		return c.callPlatform(ctx, http.MethodPut, endpoint, headers, payload)
+
+	case IncidentPlatformOpsgenie:
+		if c.config.OpsgenieAPIKey == "" {
+			return fmt.Errorf("opsgenie_api_key is not configured")
+		}
+		action, note := "acknowledge", "Acknowledged from chat"
+		if resolve {
+			action, note = "close", "Closed from chat"
+		}
+		payload := map[string]string{"source": "picoclaw", "note": note}
+		headers := map[string]string{"Authorization": "GenieKey " + c.config.OpsgenieAPIKey}
+		endpoint := fmt.Sprintf("%s/v2/alerts/%s/%s?identifierType=id", apiBase(c.config.OpsgenieAPIBase, "https://api.opsgenie.com"), url.PathEscape(inc.ID), action)
+		return c.callPlatform(ctx, http.MethodPost, endpoint, headers, payload)
+	}
+
+	return fmt.Errorf("unsupported incident platform: %s", inc.Platform)
+}
+
+func (c *AlertWebhookChannel) callPlatform(ctx context.Context, method, endpoint string, headers map[string]string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func apiBase(configured, fallback string) string {
+	if configured == "" {
+		return fallback
+	}
+	return strings.TrimSuffix(configured, "/")
+}
+
+// parsePagerDutyEvent parses a PagerDuty v3 webhook. It returns a nil incident
+// for events that need no action, and resolved=true when the incident was
+// resolved on the platform.
+func parsePagerDutyEvent(body []byte) (*incident, bool, error) {
+	var payload struct {
+		Event struct {
+			EventType string `json:"event_type"`
+			Data      struct {
+				ID      string `json:"id"`
+				Number  int    `json:"number"`
+				Title   string `json:"title"`
+				Status  string `json:"status"`
+				Urgency string `json:"urgency"`
+				HTMLURL string `json:"html_url"`
+				Service struct {
+					Summary string `json:"summary"`
+				} `json:"service"`
+			} `json:"data"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, false, err
+	}
+
+	data := payload.Event.Data
+	inc := &incident{Platform: IncidentPlatformPagerDuty, ID: data.ID, Title: data.Title}
+
+	switch payload.Event.EventType {
+	case "incident.triggered", "incident.escalated", "incident.reopened":
+		inc.Details = fmt.Sprintf("#%d %s\nService: %s\nUrgency: %s\nStatus: %s\n%s",
+			data.Number, data.Title, data.Service.Summary, data.Urgency, data.Status, data.HTMLURL)
+		return inc, false, nil
+	case "incident.resolved":
+		return inc, true, nil
+	}
+	return nil, false, nil
+}
+
+// parseOpsgenieEvent parses an Opsgenie webhook integration payload.
+func parseOpsgenieEvent(body []byte) (*incident, bool, error) {
+	var payload struct {
+		Action string `json:"action"`
+		Alert  struct {
+			AlertID     string   `json:"alertId"`
+			TinyID      string   `json:"tinyId"`
+			Message     string   `json:"message"`
+			Description string   `json:"description"`
+			Priority    string   `json:"priority"`
+			Source      string   `json:"source"`
+			Entity      string   `json:"entity"`
+			Tags        []string `json:"tags"`
+		} `json:"alert"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, false, err
+	}
+
+	alert := payload.Alert
+	inc := &incident{Platform: IncidentPlatformOpsgenie, ID: alert.AlertID, Title: alert.Message}
+
+	switch payload.Action {
+	case "Create", "Escalate":
+		inc.Details = fmt.Sprintf("#%s %s\nPriority: %s\nSource: %s\nEntity: %s\nTags: %s\n%s",
+			alert.TinyID, alert.Message, alert.Priority, alert.Source, alert.Entity,
+			strings.Join(alert.Tags, ", "), utils.Truncate(alert.Description, 1000))
+		return inc, false, nil
+	case "Close", "Delete":
+		return inc, true, nil
+	}
+	return nil, false, nil
+}
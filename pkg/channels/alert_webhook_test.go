@@ -0,0 +1,137 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestParsePagerDutyEvent(t *testing.T) {
+	body := []byte(`{"event": {
+		"event_type": "incident.triggered",
+		"data": {
+			"id": "Q1ABC", "number": 42, "title": "API latency high", "status": "triggered",
+			"urgency": "high", "html_url": "https://acme.pagerduty.com/incidents/Q1ABC",
+			"service": {"summary": "checkout-api"}
+		}
+	}}`)
+
+	inc, resolved, err := parsePagerDutyEvent(body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inc == nil || resolved {
+		t.Fatalf("expected open incident, got %+v (resolved=%v)", inc, resolved)
+	}
+	if inc.Ref() != "pagerduty:Q1ABC" || !strings.Contains(inc.Details, "checkout-api") {
+		t.Errorf("unexpected incident: %+v", inc)
+	}
+
+	resolvedBody := strings.Replace(string(body), "incident.triggered", "incident.resolved", 1)
+	if inc, resolved, _ = parsePagerDutyEvent([]byte(resolvedBody)); inc == nil || !resolved {
+		t.Errorf("expected resolved incident, got %+v (resolved=%v)", inc, resolved)
+	}
+
+	ackBody := strings.Replace(string(body), "incident.triggered", "incident.acknowledged", 1)
+	if inc, _, _ = parsePagerDutyEvent([]byte(ackBody)); inc != nil {
+		t.Errorf("acknowledged events should be ignored, got %+v", inc)
+	}
+}
+
+func TestParseOpsgenieEvent(t *testing.T) {
+	body := []byte(`{"action": "Create", "alert": {
+		"alertId": "70413a06", "tinyId": "1791", "message": "Disk almost full",
+		"priority": "P2", "source": "prometheus", "entity": "db-1", "tags": ["disk", "prod"]
+	}}`)
+
+	inc, resolved, err := parseOpsgenieEvent(body)
+	if err != nil || inc == nil || resolved {
+		t.Fatalf("expected open incident, got %+v (resolved=%v, err=%v)", inc, resolved, err)
+	}
+	if inc.Ref() != "opsgenie:70413a06" || !strings.Contains(inc.Details, "P2") {
+		t.Errorf("unexpected incident: %+v", inc)
+	}
+}
+
+func TestAlertWebhookPagerDutySignature(t *testing.T) {
+	c := &AlertWebhookChannel{config: config.AlertWebhookConfig{PagerDutySecret: "s3cret"}}
+	body := []byte(`{"event":{}}`)
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	valid := "v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !c.verifyPagerDutySignature(body, valid) {
+		t.Error("expected valid signature to verify")
+	}
+	if !c.verifyPagerDutySignature(body, "v1=deadbeef, "+valid) {
+		t.Error("expected rotated signature list to verify")
+	}
+	if c.verifyPagerDutySignature(body, "v1=deadbeef") {
+		t.Error("expected invalid signature to be rejected")
+	}
+}
+
+func TestAlertWebhookAcknowledge(t *testing.T) {
+	var gotStatus, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/incidents/Q1ABC" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		gotAuth = r.Header.Get("Authorization")
+		var payload struct {
+			Incident struct {
+				Status string `json:"status"`
+			} `json:"incident"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		gotStatus = payload.Incident.Status
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	c, err := NewAlertWebhookChannel(config.AlertWebhookConfig{
+		PagerDutySecret:  "s3cret",
+		PagerDutyAPIKey:  "pd-key",
+		PagerDutyAPIBase: server.URL,
+		NotifyChannel:    "telegram",
+		NotifyChatID:     "42",
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.track(&incident{Platform: IncidentPlatformPagerDuty, ID: "Q1ABC", Title: "API latency high"})
+
+	if _, err := c.AcknowledgeIncident(context.Background(), "Q1ABC", "telegram", "99"); err == nil {
+		t.Error("expected commands from other chats to be rejected")
+	}
+
+	result, err := c.AcknowledgeIncident(context.Background(), "", "telegram", "42")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotStatus != "acknowledged" || gotAuth != "Token token=pd-key" {
+		t.Errorf("unexpected request: status=%q auth=%q", gotStatus, gotAuth)
+	}
+	if !strings.Contains(result, "pagerduty:Q1ABC") {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	if _, err := c.ResolveIncident(context.Background(), "Q1ABC", "telegram", "42"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotStatus != "resolved" {
+		t.Errorf("expected resolved status, got %q", gotStatus)
+	}
+	if _, err := c.ResolveIncident(context.Background(), "Q1ABC", "telegram", "42"); err == nil {
+		t.Error("expected resolved incident to no longer be tracked")
+	}
+}
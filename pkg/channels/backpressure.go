@@ -0,0 +1,86 @@
+package channels
+
+import (
+	"context"
+	"sync"
+)
+
+// busyReply answers messages the bus rejected because the agent is
+// overloaded
+const busyReply = "I'm busy with other messages right now. Please try again in a moment."
+
+// inboundGate holds back a channel's reading while the agent is overloaded,
+// as reported by the bus watermarks
+type inboundGate struct {
+	mu sync.Mutex
+	// open is closed while reading may go on, and replaced by an open
+	// channel while the agent is overloaded
+	open chan struct{}
+}
+
+func newInboundGate() *inboundGate {
+	open := make(chan struct{})
+	close(open)
+	return &inboundGate{open: open}
+}
+
+// set is the watermark callback of the bus
+func (g *inboundGate) set(overloaded bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	select {
+	case <-g.open:
+		if overloaded {
+			g.open = make(chan struct{})
+		}
+	default:
+		if !overloaded {
+			close(g.open)
+		}
+	}
+}
+
+// wait blocks while the agent is overloaded
+func (g *inboundGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	open := g.open
+	g.mu.Unlock()
+
+	select {
+	case <-open:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForAgent blocks while the agent is overloaded. Read loops call it
+// before taking the next message from the platform, so messages wait there
+// instead of piling up in memory.
+func (c *BaseChannel) waitForAgent(ctx context.Context) error {
+	if c.gate == nil {
+		return nil
+	}
+	return c.gate.wait(ctx)
+}
+
+// gateUpdates forwards updates from in while the agent keeps up. A paused
+// forwarder stops the platform client from fetching more.
+func gateUpdates[T any](ctx context.Context, c *BaseChannel, in <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for update := range in {
+			if c.waitForAgent(ctx) != nil {
+				return
+			}
+			select {
+			case out <- update:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
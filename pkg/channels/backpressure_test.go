@@ -0,0 +1,52 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestGateUpdatesPausesWhileOverloaded(t *testing.T) {
+	mb, _ := bus.NewMessageBusWithOptions(bus.Options{QueueSize: 2, HighWatermark: 0.5, LowWatermark: 0.1})
+	ch := NewBaseChannel("telegram", nil, mb, nil)
+	in := make(chan int, 3)
+	out := gateUpdates(t.Context(), ch, in)
+
+	mb.PublishInbound(bus.InboundMessage{Content: "fills the queue"})
+	in <- 1
+	select {
+	case update := <-out:
+		t.Fatalf("update %d forwarded while overloaded", update)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mb.ConsumeInbound(context.Background())
+	select {
+	case update := <-out:
+		if update != 1 {
+			t.Errorf("unexpected update %d", update)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("update not forwarded after the overload")
+	}
+}
+
+func TestHandleMessageRejected(t *testing.T) {
+	mb, _ := bus.NewMessageBusWithOptions(bus.Options{QueueSize: 1, Overflow: bus.OverflowReject})
+	ch := NewBaseChannel("telegram", nil, mb, nil)
+
+	ch.HandleMessage("user", "chat", "first", nil, nil)
+	ch.HandleMessage("user", "chat", "second", nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, ok := mb.SubscribeOutbound(ctx)
+	if !ok || reply.ChatID != "chat" || reply.Content != busyReply {
+		t.Errorf("unexpected reply %+v", reply)
+	}
+	if msg, _ := mb.ConsumeInbound(ctx); msg.Content != "first" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+}
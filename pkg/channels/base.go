@@ -2,10 +2,16 @@ package channels
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/trace"
 )
 
 type Channel interface {
@@ -15,24 +21,45 @@ type Channel interface {
 	Send(ctx context.Context, msg bus.OutboundMessage) error
 	IsRunning() bool
 	IsAllowed(senderID string) bool
+	Health() Health
 }
 
 type BaseChannel struct {
-	config    interface{}
-	bus       *bus.MessageBus
-	running   bool
-	name      string
-	allowList []string
+	config     interface{}
+	bus        *bus.MessageBus
+	running    bool
+	name       string
+	allowList  accessList
+	denyList   accessList // Checked before allowList
+	allowChats accessList
+	denyChats  accessList
+	guests     *GuestPasses   // nil unless guest passes are handed out
+	media      *mediaPipeline // nil unless the manager tracks media storage
+	bridges    *Bridges       // nil unless messages are copied to other channels
+	accessMu   sync.RWMutex   // Guards the access lists, which admins can edit at runtime
+	dedup      *InboundDedup
+	debounce   *inboundDebouncer // nil unless bursts of messages are coalesced
+	draining   atomic.Bool       // Set on shutdown to refuse new inbound messages
+	health     Health
+	ownHealth  bool // Set when the channel reports its connection states itself
+	healthMu   sync.RWMutex
+	gate       *inboundGate // Closed while the agent is overloaded; nil without a bus
 }
 
 func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowList []string) *BaseChannel {
-	return &BaseChannel{
+	c := &BaseChannel{
 		config:    config,
 		bus:       bus,
 		name:      name,
-		allowList: allowList,
+		allowList: newAccessList(name, allowList),
 		running:   false,
+		dedup:     NewInboundDedup(DefaultDedupWindow, DefaultDedupSize),
 	}
+	if bus != nil {
+		c.gate = newInboundGate()
+		bus.OnWatermark(c.gate.set)
+	}
+	return c
 }
 
 func (c *BaseChannel) Name() string {
@@ -43,52 +70,70 @@ func (c *BaseChannel) IsRunning() bool {
 	return c.running
 }
 
+// IsAllowed reports whether senderID may talk to the agent. Deny entries
+// are checked first; an empty allowlist accepts every other sender. Guests
+// with a redeemed pass are let in too.
 func (c *BaseChannel) IsAllowed(senderID string) bool {
-	if len(c.allowList) == 0 {
+	c.accessMu.RLock()
+	defer c.accessMu.RUnlock()
+	if c.denyList.matchesSender(senderID) {
+		return false
+	}
+	if len(c.allowList) == 0 || c.allowList.matchesSender(senderID) {
 		return true
 	}
+	return c.guests != nil && c.guests.IsGuest(c.name, senderID)
+}
 
-	// Extract parts from compound senderID like "123456|username"
-	idPart := senderID
-	userPart := ""
-	if idx := strings.Index(senderID, "|"); idx > 0 {
-		idPart = senderID[:idx]
-		userPart = senderID[idx+1:]
+func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string) {
+	if !c.IsAllowed(senderID) || !c.IsChatAllowed(chatID) {
+		return
 	}
 
-	for _, allowed := range c.allowList {
-		// Strip leading "@" from allowed value for username matching
-		trimmed := strings.TrimPrefix(allowed, "@")
-		allowedID := trimmed
-		allowedUser := ""
-		if idx := strings.Index(trimmed, "|"); idx > 0 {
-			allowedID = trimmed[:idx]
-			allowedUser = trimmed[idx+1:]
-		}
+	if c.draining.Load() {
+		logger.DebugCF(c.name, "Dropping inbound message while shutting down", map[string]interface{}{
+			"chat_id": chatID,
+		})
+		return
+	}
 
-		// Support either side using "id|username" compound form.
-		// This keeps backward compatibility with legacy Telegram allowlist entries.
-		if senderID == allowed ||
-			idPart == allowed ||
-			senderID == trimmed ||
-			idPart == trimmed ||
-			idPart == allowedID ||
-			(allowedUser != "" && senderID == allowedUser) ||
-			(userPart != "" && (userPart == allowed || userPart == trimmed || userPart == allowedUser)) {
-			return true
+	if id := metadata["message_id"]; id != "" {
+		key := strings.Join([]string{metadata["account_id"], chatID, senderID, id}, "|")
+		if c.dedup.Seen(key) {
+			logger.DebugCF(c.name, "Dropping duplicate inbound message", map[string]interface{}{
+				"chat_id":    chatID,
+				"message_id": id,
+			})
+			return
 		}
 	}
 
-	return false
-}
+	// Build session key: channel:chatID, or channel:account:chatID for
+	// channels serving several accounts
+	sessionKey := fmt.Sprintf("%s:%s", c.name, chatID)
+	if account := metadata["account_id"]; account != "" {
+		sessionKey = fmt.Sprintf("%s:%s:%s", c.name, account, chatID)
+	}
 
-func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string) {
-	if !c.IsAllowed(senderID) {
-		return
+	// Guests talk to a constrained persona
+	if c.isGuest(senderID) {
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[MetadataGuest] = "true"
 	}
 
-	// Build session key: channel:chatID
-	sessionKey := fmt.Sprintf("%s:%s", c.name, chatID)
+	// Text-only while incoming files cannot be stored
+	if len(media) > 0 && c.media.Err() != nil {
+		content = dropMedia(media, content)
+		media = nil
+	}
+
+	// Webhook channels pass the trace ID they returned to the caller
+	traceID := metadata["trace_id"]
+	if traceID == "" {
+		traceID = trace.NewID()
+	}
 
 	msg := bus.InboundMessage{
 		Channel:    c.name,
@@ -98,11 +143,110 @@ func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []st
 		Media:      media,
 		SessionKey: sessionKey,
 		Metadata:   metadata,
+		TraceID:    traceID,
+	}
+
+	if !c.bridges.route(msg) {
+		logger.DebugCF(c.name, "Inbound message forwarded to another channel", map[string]interface{}{
+			"chat_id":    chatID,
+			"message_id": metadata["message_id"],
+			"trace_id":   traceID,
+		})
+		return
 	}
 
-	c.bus.PublishInbound(msg)
+	logger.DebugCF(c.name, "Inbound message accepted", map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": metadata["message_id"],
+		"trace_id":   traceID,
+	})
+	if c.debounce != nil {
+		c.debounce.add(msg)
+		return
+	}
+	c.publishInbound(msg)
+}
+
+// publishInbound hands msg to the agent
+func (c *BaseChannel) publishInbound(msg bus.InboundMessage) {
+	if err := c.bus.PublishInbound(msg); errors.Is(err, bus.ErrQueueFull) {
+		// Tell the sender rather than leave them waiting for a reply
+		c.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:      c.name,
+			ChatID:       msg.ChatID,
+			AccountID:    msg.Metadata["account_id"],
+			Content:      busyReply,
+			Notification: bus.NotificationError,
+			TraceID:      msg.TraceID,
+		})
+	}
+}
+
+// configureInboundDedup replaces the inbound dedup cache
+func (c *BaseChannel) configureInboundDedup(cfg config.InboundDedupConfig) {
+	c.dedup = newInboundDedupFromConfig(cfg)
+}
+
+// configureInboundDebounce sets how bursts of inbound messages are
+// coalesced
+func (c *BaseChannel) configureInboundDebounce(cfg config.InboundDebounceConfig) {
+	c.debounce = newInboundDebouncer(cfg, c.name, c.publishInbound)
+}
+
+// DuplicatesDropped returns the number of redelivered inbound messages dropped
+func (c *BaseChannel) DuplicatesDropped() uint64 {
+	return c.dedup.Dropped()
+}
+
+// stopInbound makes the channel drop inbound messages, so shutdown only
+// waits for work already accepted
+func (c *BaseChannel) stopInbound() {
+	c.draining.Store(true)
+	if c.debounce != nil {
+		// Held messages were accepted, so shutdown waits for them too
+		c.debounce.flushAll()
+	}
 }
 
 func (c *BaseChannel) setRunning(running bool) {
 	c.running = running
+
+	c.healthMu.RLock()
+	own := c.ownHealth
+	c.healthMu.RUnlock()
+	switch {
+	case own:
+	case running:
+		c.setHealth(StateConnected, "")
+	default:
+		c.setHealth(StateDisconnected, "stopped")
+	}
+}
+
+// EventChannelGaveUp is the system event published when a channel stops
+// trying to reconnect and needs a restart.
+const EventChannelGaveUp = "channel_gave_up"
+
+// publishGaveUp marks the channel as stopped and announces it on the bus as a
+// system message so supervisors can restart it or alert someone.
+func (c *BaseChannel) publishGaveUp(attempts int, lastErr error) {
+	c.running = false
+
+	reason := "unknown error"
+	if lastErr != nil {
+		reason = lastErr.Error()
+	}
+	c.setHealth(StateGivenUp, reason)
+	c.bus.PublishInbound(bus.InboundMessage{
+		Channel:  "system",
+		SenderID: fmt.Sprintf("channel:%s", c.name),
+		ChatID:   fmt.Sprintf("%s:", c.name),
+		Content:  fmt.Sprintf("Channel '%s' gave up reconnecting after %d attempts: %s", c.name, attempts, reason),
+		Metadata: map[string]string{
+			"event":    EventChannelGaveUp,
+			"channel":  c.name,
+			"attempts": fmt.Sprintf("%d", attempts),
+			"error":    reason,
+		},
+	})
 }
@@ -1,6 +1,12 @@
 package channels
 
-import "testing"
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
 
 func TestBaseChannelIsAllowed(t *testing.T) {
 	tests := []struct {
@@ -50,3 +56,104 @@ func TestBaseChannelIsAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestBaseChannelAccessPatterns(t *testing.T) {
+	ch := NewBaseChannel("test", nil, nil, []string{"+49*", "re:^[0-9]{3}$", "@alice"})
+	ch.configureAccess(config.ChannelAccessConfig{
+		DenyFrom:   []string{"+4915*", "mallory"},
+		AllowChats: []string{"family", "team-*"},
+		DenyChats:  []string{"team-secret"},
+	})
+
+	senders := []struct {
+		senderID string
+		want     bool
+	}{
+		{"+4930123", true},
+		{"+4915123", false}, // denied before allow
+		{"123", true},
+		{"1234", false},
+		{"987|alice", true},
+		{"42|mallory", false},
+		{"+3312345", false},
+	}
+	for _, tt := range senders {
+		if got := ch.IsAllowed(tt.senderID); got != tt.want {
+			t.Errorf("IsAllowed(%q) = %v, want %v", tt.senderID, got, tt.want)
+		}
+	}
+
+	chats := []struct {
+		chatID string
+		want   bool
+	}{
+		{"family", true},
+		{"team-dev", true},
+		{"team-secret", false},
+		{"random", false},
+		{"family/42", true}, // thread of an allowed chat
+		{"team-secret/7", false},
+	}
+	for _, tt := range chats {
+		if got := ch.IsChatAllowed(tt.chatID); got != tt.want {
+			t.Errorf("IsChatAllowed(%q) = %v, want %v", tt.chatID, got, tt.want)
+		}
+	}
+}
+
+func TestBaseChannelDenyWithoutAllowlist(t *testing.T) {
+	ch := NewBaseChannel("test", nil, nil, nil)
+	ch.configureAccess(config.ChannelAccessConfig{DenyFrom: []string{"re:spam.*", "re:("}})
+
+	if ch.IsAllowed("spammer") {
+		t.Error("denied sender was allowed")
+	}
+	if !ch.IsAllowed("friend") || !ch.IsChatAllowed("any") {
+		t.Error("empty allowlists should accept everyone not denied")
+	}
+}
+
+func TestBaseChannelEditAccess(t *testing.T) {
+	ch := NewBaseChannel("test", nil, nil, []string{"123"})
+	ch.configureAccess(config.ChannelAccessConfig{DenyFrom: []string{"666", "+1900*"}})
+
+	ch.AllowSender("456")
+	ch.AllowSender("666")
+	if !ch.IsAllowed("456") || !ch.IsAllowed("666") {
+		t.Error("allowed senders should be accepted")
+	}
+
+	ch.DenySender("123")
+	if ch.IsAllowed("123") {
+		t.Error("denied sender should be rejected")
+	}
+
+	ch.AllowSender("+1900555")
+	if ch.IsAllowed("+1900555") {
+		t.Error("deny patterns should still apply after allowing")
+	}
+
+	open := NewBaseChannel("test", nil, nil, nil)
+	open.AllowSender("789")
+	if !open.IsAllowed("someone-else") {
+		t.Error("allowing a sender should not restrict a channel without an allowlist")
+	}
+}
+
+func TestBaseChannelHandleMessageTraceID(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, mb, nil)
+	ctx := context.Background()
+
+	ch.HandleMessage("alice", "chat1", "hello", nil, map[string]string{"message_id": "1"})
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.TraceID == "" {
+		t.Fatalf("inbound message has no trace ID: %+v", msg)
+	}
+
+	ch.HandleMessage("alice", "chat1", "hello", nil, map[string]string{"message_id": "2", "trace_id": "from-webhook"})
+	msg, _ = mb.ConsumeInbound(ctx)
+	if msg.TraceID != "from-webhook" {
+		t.Errorf("TraceID = %q, want the webhook's trace ID", msg.TraceID)
+	}
+}
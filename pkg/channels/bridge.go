@@ -0,0 +1,199 @@
+package channels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Bridge rule modes
+const (
+	BridgeModeMirror  = "mirror"  // Copy the message; the agent gets it too
+	BridgeModeForward = "forward" // Only copy the message
+)
+
+// defaultBridgeTemplate lays out copies when a rule has no template
+const defaultBridgeTemplate = "[{{.Channel}}] {{.Sender}}: {{.Content}}"
+
+// bridgeData is what bridge templates are executed with
+type bridgeData struct {
+	Channel  string            // Source channel
+	ChatID   string            // Source chat
+	SenderID string            // Sender on the source channel
+	Sender   string            // Display name if the channel knows it, else SenderID
+	Content  string            // Message text
+	Metadata map[string]string // Inbound metadata, e.g. group_subject
+	Time     time.Time         // When the message was copied
+}
+
+// bridgeRule is a parsed config.BridgeRule
+type bridgeRule struct {
+	name     string
+	from     string
+	chats    accessList
+	senders  accessList
+	match    *regexp.Regexp // nil matches all
+	to       string
+	toChat   string
+	forward  bool
+	template *template.Template
+	media    bool
+}
+
+// Bridges copies inbound messages to chats on other channels by rule. Rules
+// are checked in order and every matching rule sends a copy.
+type Bridges struct {
+	rules []bridgeRule
+	bus   *bus.MessageBus
+}
+
+// bridgeKeeper is implemented by channels whose inbound messages can be
+// bridged
+type bridgeKeeper interface {
+	setBridges(bridges *Bridges)
+}
+
+// NewBridges parses the configured rules
+func NewBridges(rules []config.BridgeRule, messageBus *bus.MessageBus) (*Bridges, error) {
+	b := &Bridges{bus: messageBus}
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("bridges[%d]", i)
+		}
+		if rule.From == "" || rule.To == "" || rule.ToChat == "" {
+			return nil, fmt.Errorf("bridge %s needs from, to and to_chat", name)
+		}
+
+		parsed := bridgeRule{
+			name:    name,
+			from:    rule.From,
+			chats:   newAccessList(rule.From, rule.FromChats),
+			senders: newAccessList(rule.From, rule.FromSenders),
+			to:      rule.To,
+			toChat:  rule.ToChat,
+			media:   rule.IncludeMedia,
+		}
+		switch rule.Mode {
+		case "", BridgeModeMirror:
+		case BridgeModeForward:
+			parsed.forward = true
+		default:
+			return nil, fmt.Errorf("bridge %s: unknown mode %q (want mirror or forward)", name, rule.Mode)
+		}
+		if rule.Match != "" {
+			re, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("bridge %s match: %w", name, err)
+			}
+			parsed.match = re
+		}
+		text := rule.Template
+		if text == "" {
+			text = defaultBridgeTemplate
+		}
+		tmpl, err := template.New(name).Funcs(notificationFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("bridge %s template: %w", name, err)
+		}
+		parsed.template = tmpl
+		b.rules = append(b.rules, parsed)
+	}
+	return b, nil
+}
+
+// matches reports whether the rule copies msg
+func (r *bridgeRule) matches(msg bus.InboundMessage) bool {
+	if msg.Channel != r.from {
+		return false
+	}
+	if r.from == r.to && msg.ChatID == r.toChat {
+		// Never copy the destination chat into itself
+		return false
+	}
+	if len(r.chats) > 0 && !r.chats.matchesChat(msg.ChatID) {
+		return false
+	}
+	if len(r.senders) > 0 && !r.senders.matchesSender(msg.SenderID) {
+		return false
+	}
+	return r.match == nil || r.match.MatchString(msg.Content)
+}
+
+// route publishes a copy of msg for every matching rule and reports whether
+// the agent should still get msg, which it does unless a forward rule took it
+func (b *Bridges) route(msg bus.InboundMessage) bool {
+	if b == nil {
+		return true
+	}
+	deliver := true
+	for i := range b.rules {
+		rule := &b.rules[i]
+		if !rule.matches(msg) {
+			continue
+		}
+		out, err := rule.render(msg)
+		if err != nil {
+			logger.WarnCF("channels", "Failed to render bridged message", map[string]interface{}{
+				"bridge": rule.name,
+				"error":  err.Error(),
+			})
+			continue
+		}
+		logger.DebugCF("channels", "Bridging inbound message", map[string]interface{}{
+			"bridge":   rule.name,
+			"from":     msg.Channel + ":" + msg.ChatID,
+			"to":       rule.to + ":" + rule.toChat,
+			"trace_id": msg.TraceID,
+		})
+		b.bus.PublishOutbound(out)
+		if rule.forward {
+			deliver = false
+		}
+	}
+	return deliver
+}
+
+// render lays out the copy of msg sent by the rule
+func (r *bridgeRule) render(msg bus.InboundMessage) (bus.OutboundMessage, error) {
+	sender := msg.Metadata["sender_name"]
+	if sender == "" {
+		sender = msg.SenderID
+	}
+	var sb strings.Builder
+	err := r.template.Execute(&sb, bridgeData{
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		SenderID: msg.SenderID,
+		Sender:   sender,
+		Content:  msg.Content,
+		Metadata: msg.Metadata,
+		Time:     time.Now(),
+	})
+	if err != nil {
+		return bus.OutboundMessage{}, err
+	}
+
+	out := bus.OutboundMessage{
+		Channel: r.to,
+		ChatID:  r.toChat,
+		Content: sb.String(),
+		TraceID: msg.TraceID,
+	}
+	if r.media {
+		for _, path := range msg.Media {
+			out.Attachments = append(out.Attachments, bus.Attachment{Path: path})
+		}
+	}
+	return out, nil
+}
+
+func (c *BaseChannel) setBridges(bridges *Bridges) {
+	c.bridges = bridges
+}
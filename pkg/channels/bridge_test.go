@@ -0,0 +1,79 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestBridges(t *testing.T) {
+	mb := bus.NewMessageBus()
+	bridges, err := NewBridges([]config.BridgeRule{
+		{
+			Name:         "family",
+			From:         "whatsapp",
+			FromChats:    config.FlexibleStringSlice{"family@g.us"},
+			To:           "telegram",
+			ToChat:       "100",
+			Template:     "{{.Metadata.group_subject}} / {{.Sender}}: {{.Content}}",
+			IncludeMedia: true,
+		},
+		{
+			Name:   "alerts",
+			From:   "whatsapp",
+			Match:  "(?i)^alert",
+			To:     "slack",
+			ToChat: "C1",
+			Mode:   BridgeModeForward,
+		},
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := NewBaseChannel("whatsapp", nil, mb, nil)
+	ch.setBridges(bridges)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ch.HandleMessage("491", "family@g.us", "hi all", []string{"/tmp/photo.jpg"}, map[string]string{
+		"sender_name":   "Ana",
+		"group_subject": "Family",
+	})
+	out, ok := mb.SubscribeOutbound(ctx)
+	if !ok || out.Channel != "telegram" || out.ChatID != "100" || out.Content != "Family / Ana: hi all" {
+		t.Fatalf("unexpected copy %+v", out)
+	}
+	if len(out.Attachments) != 1 || out.Attachments[0].Path != "/tmp/photo.jpg" {
+		t.Errorf("media not copied: %+v", out.Attachments)
+	}
+	in, ok := mb.ConsumeInbound(ctx)
+	if !ok || in.Content != "hi all" {
+		t.Errorf("mirrored message should reach the agent, got %+v", in)
+	}
+	mb.InboundDone(in)
+
+	ch.HandleMessage("492", "work@g.us", "ALERT disk full", nil, nil)
+	out, ok = mb.SubscribeOutbound(ctx)
+	if !ok || out.Channel != "slack" || out.Content != "[whatsapp] 492: ALERT disk full" {
+		t.Fatalf("unexpected copy %+v", out)
+	}
+	if inbound, _ := mb.Pending(); inbound != 0 {
+		t.Errorf("forwarded message reached the agent")
+	}
+}
+
+func TestNewBridgesErrors(t *testing.T) {
+	for name, rule := range map[string]config.BridgeRule{
+		"no destination": {From: "whatsapp", To: "telegram"},
+		"unknown mode":   {From: "whatsapp", To: "telegram", ToChat: "1", Mode: "copy"},
+		"bad match":      {From: "whatsapp", To: "telegram", ToChat: "1", Match: "("},
+		"bad template":   {From: "whatsapp", To: "telegram", ToChat: "1", Template: "{{.Content"},
+	} {
+		if _, err := NewBridges([]config.BridgeRule{rule}, bus.NewMessageBus()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package channels
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/trace"
+)
+
+// DefaultBroadcastRate is how many broadcast messages per second go out on
+// a channel when the config sets no rate
+const DefaultBroadcastRate = 1.0
+
+// EventBroadcast is the bus event published when a broadcast taken from the
+// bus is done. Its data holds the "broadcast_id", the "delivered" and
+// "failed" counts and the "failed_targets" as comma-separated
+// channel:chat_id pairs. Its payload is a bus.BroadcastEvent.
+const EventBroadcast = bus.TopicBroadcast
+
+// BroadcastResult is the outcome of a broadcast for one chat
+type BroadcastResult struct {
+	Target     bus.BroadcastTarget
+	DeliveryID string
+	Status     DeliveryStatus // DeliverySent or DeliveryFailed
+	Err        error
+}
+
+// BroadcastReport lists the outcome of a broadcast per chat, in the order
+// of the targets
+type BroadcastReport struct {
+	ID      string
+	Results []BroadcastResult
+}
+
+// Delivered returns the number of chats the message was sent to
+func (r *BroadcastReport) Delivered() int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == DeliverySent {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed returns the results of the chats the message could not be sent to
+func (r *BroadcastReport) Failed() []BroadcastResult {
+	var failed []BroadcastResult
+	for _, result := range r.Results {
+		if result.Status != DeliverySent {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// AdminTargets returns the admins listed as "channel:sender_id", whose
+// direct chats have the sender's ID on the enabled channels
+func (m *Manager) AdminTargets() []bus.BroadcastTarget {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var targets []bus.BroadcastTarget
+	seen := make(map[bus.BroadcastTarget]bool)
+	for _, admin := range m.config.Admins {
+		channel, senderID, ok := strings.Cut(admin, ":")
+		if !ok || senderID == "" {
+			continue
+		}
+		if _, enabled := m.channels[channel]; !enabled {
+			continue
+		}
+		target := bus.BroadcastTarget{Channel: channel, ChatID: senderID}
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// broadcastRate returns the messages per second allowed on a channel
+func (m *Manager) broadcastRate(channel string) float64 {
+	if m.config == nil {
+		return DefaultBroadcastRate
+	}
+	cfg := m.config.Channels.Broadcast
+	if rate := cfg.ChannelRates[channel]; rate > 0 {
+		return rate
+	}
+	if cfg.MessagesPerSecond > 0 {
+		return cfg.MessagesPerSecond
+	}
+	return DefaultBroadcastRate
+}
+
+// Broadcast sends a copy of msg to every target and waits until each copy
+// is sent or has finally failed, retries included. Channels are sent to in
+// parallel, each at its broadcast rate. The report's ID is msg.DeliveryID,
+// the ID PublishOutbound returned for broadcasts taken from the bus.
+func (m *Manager) Broadcast(ctx context.Context, msg bus.OutboundMessage, targets []bus.BroadcastTarget) *BroadcastReport {
+	report := &BroadcastReport{
+		ID:      msg.DeliveryID,
+		Results: make([]BroadcastResult, len(targets)),
+	}
+	if report.ID == "" {
+		report.ID = bus.NewDeliveryID()
+	}
+	byChannel := make(map[string][]int)
+	for i, target := range targets {
+		report.Results[i].Target = target
+		byChannel[target.Channel] = append(byChannel[target.Channel], i)
+	}
+
+	var wg sync.WaitGroup
+	for channel, indexes := range byChannel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			interval := time.Duration(float64(time.Second) / m.broadcastRate(channel))
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			var deliveries []*Delivery
+			for n, i := range indexes {
+				if n > 0 {
+					select {
+					case <-ctx.Done():
+					case <-ticker.C:
+					}
+				}
+				target := report.Results[i].Target
+				out := msg
+				out.Channel = target.Channel
+				out.ChatID = target.ChatID
+				out.AccountID = target.AccountID
+				out.Broadcast = nil
+				out.DeliveryID = ""
+				deliveries = append(deliveries, m.Send(ctx, out))
+			}
+			for n, i := range indexes {
+				d := deliveries[n]
+				d.Wait(ctx)
+				report.Results[i].DeliveryID = d.ID
+				report.Results[i].Status = d.Status()
+				report.Results[i].Err = d.Err()
+				if report.Results[i].Status != DeliverySent {
+					report.Results[i].Status = DeliveryFailed
+					if report.Results[i].Err == nil {
+						report.Results[i].Err = ctx.Err()
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	logger.InfoCF("channels", "Broadcast done", trace.Fields(ctx, map[string]interface{}{
+		"broadcast_id": report.ID,
+		"targets":      len(targets),
+		"delivered":    report.Delivered(),
+		"failed":       len(report.Failed()),
+	}))
+	return report
+}
+
+// isBroadcast reports whether msg is sent to several chats
+func isBroadcast(msg bus.OutboundMessage) bool {
+	return len(msg.Broadcast) > 0 || msg.Channel == bus.BroadcastAdmins
+}
+
+// broadcastOutbound sends a broadcast taken from the bus and announces the
+// report as an EventBroadcast
+func (m *Manager) broadcastOutbound(ctx context.Context, msg bus.OutboundMessage) {
+	targets := msg.Broadcast
+	if len(targets) == 0 && msg.Channel == bus.BroadcastAdmins {
+		targets = m.AdminTargets()
+		if len(targets) == 0 {
+			logger.WarnC("channels", "Broadcast to admins, but no admin is listed as channel:sender_id on an enabled channel")
+		}
+	}
+	ctx = trace.WithID(ctx, msg.TraceID)
+	report := m.Broadcast(ctx, msg, targets)
+
+	failed := report.Failed()
+	pairs := make([]string, len(failed))
+	failedTargets := make([]bus.BroadcastTarget, len(failed))
+	for i, result := range failed {
+		pairs[i] = result.Target.Channel + ":" + result.Target.ChatID
+		failedTargets[i] = result.Target
+	}
+	m.bus.PublishEvent(bus.Event{
+		Type:   EventBroadcast,
+		Source: "channels",
+		Data: map[string]string{
+			"broadcast_id":   report.ID,
+			"delivered":      strconv.Itoa(report.Delivered()),
+			"failed":         strconv.Itoa(len(failed)),
+			"failed_targets": strings.Join(pairs, ","),
+		},
+		Payload: bus.BroadcastEvent{
+			BroadcastID:   report.ID,
+			Delivered:     report.Delivered(),
+			FailedTargets: failedTargets,
+		},
+	})
+}
@@ -0,0 +1,97 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+)
+
+// failingChannel refuses every message
+type failingChannel struct {
+	*recordingChannel
+}
+
+func (c *failingChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	return fmt.Errorf("%w: chat not found", errs.ErrValidation)
+}
+
+func TestManagerBroadcast(t *testing.T) {
+	mb := bus.NewMessageBus()
+	telegram := &recordingChannel{BaseChannel: NewBaseChannel("telegram", nil, mb, nil)}
+	slack := &failingChannel{&recordingChannel{BaseChannel: NewBaseChannel("slack", nil, mb, nil)}}
+	cfg := &config.Config{}
+	cfg.Channels.Broadcast.ChannelRates = map[string]float64{"telegram": 20}
+	m := &Manager{
+		channels: map[string]Channel{"telegram": telegram, "slack": slack},
+		bus:      mb,
+		config:   cfg,
+	}
+
+	started := time.Now()
+	report := m.Broadcast(t.Context(), bus.OutboundMessage{Content: "Maintenance at 22:00", DeliveryID: "d-1"}, []bus.BroadcastTarget{
+		{Channel: "telegram", ChatID: "1"},
+		{Channel: "slack", ChatID: "C1"},
+		{Channel: "telegram", ChatID: "2"},
+		{Channel: "discord", ChatID: "3"},
+	})
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Errorf("telegram messages not paced: %v", elapsed)
+	}
+
+	if report.ID != "d-1" || report.Delivered() != 2 || len(report.Failed()) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for i, want := range []DeliveryStatus{DeliverySent, DeliveryFailed, DeliverySent, DeliveryFailed} {
+		if got := report.Results[i]; got.Status != want || got.DeliveryID == "" {
+			t.Errorf("result %d: %+v, want %s", i, got, want)
+		}
+	}
+	if !errors.Is(report.Results[3].Err, errUnknownChannel) {
+		t.Errorf("unexpected error for a disabled channel: %v", report.Results[3].Err)
+	}
+	if len(telegram.sent) != 2 || telegram.sent[1].ChatID != "2" || telegram.sent[1].Content != "Maintenance at 22:00" {
+		t.Errorf("unexpected telegram messages %+v", telegram.sent)
+	}
+}
+
+func TestManagerBroadcastToAdmins(t *testing.T) {
+	mb := bus.NewMessageBus()
+	telegram := &recordingChannel{BaseChannel: NewBaseChannel("telegram", nil, mb, nil)}
+	cfg := &config.Config{Admins: config.FlexibleStringSlice{"telegram:1", "42", "discord:7", "telegram:2", "telegram:1"}}
+	cfg.Channels.Broadcast.MessagesPerSecond = 50
+	m := &Manager{
+		channels: map[string]Channel{"telegram": telegram},
+		bus:      mb,
+		config:   cfg,
+	}
+	targets := m.AdminTargets()
+	if len(targets) != 2 || targets[0].ChatID != "1" || targets[1].ChatID != "2" {
+		t.Fatalf("unexpected admin targets %+v", targets)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	events := mb.SubscribeEvents(ctx)
+	go m.dispatchOutbound(ctx)
+	id := mb.PublishOutbound(bus.OutboundMessage{Channel: bus.BroadcastAdmins, Content: "Backup done"})
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type != EventBroadcast {
+				continue
+			}
+			if ev.Data["broadcast_id"] != id || ev.Data["delivered"] != "2" || ev.Data["failed"] != "0" {
+				t.Errorf("unexpected event %+v", ev)
+			}
+			return
+		case <-ctx.Done():
+			t.Fatal("no broadcast event")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package channels
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+// Metadata of inbound messages sent by pressing a card reply button. The
+// message content is the button's reply.
+const (
+	MetadataChoice      = "choice"       // Reply of the pressed button
+	MetadataChoiceLabel = "choice_label" // Label of the pressed button, where the platform reports it
+)
+
+// choiceMetadata adds the metadata of a button press to metadata
+func choiceMetadata(metadata map[string]string, reply, label string) map[string]string {
+	metadata[MetadataChoice] = reply
+	if label != "" {
+		metadata[MetadataChoiceLabel] = label
+	}
+	return metadata
+}
+
+// cardChannel is implemented by channels that render bus.Card natively.
+// Cards sent to other channels are flattened to text by the manager.
+type cardChannel interface {
+	RendersCards() bool
+}
+
+// rendersCards reports whether a channel renders cards itself
+func rendersCards(ch Channel) bool {
+	cc, ok := ch.(cardChannel)
+	return ok && cc.RendersCards()
+}
+
+// cardMarkdown renders card as Markdown, the text fallback for channels
+// without native cards. The image is listed as a link if withImage is set.
+func cardMarkdown(card *bus.Card, withImage bool) string {
+	var parts []string
+	if card.Title != "" {
+		parts = append(parts, "**"+card.Title+"**")
+	}
+	if card.Text != "" {
+		parts = append(parts, card.Text)
+	}
+
+	if len(card.Fields) > 0 {
+		lines := make([]string, 0, len(card.Fields))
+		for _, f := range card.Fields {
+			lines = append(lines, fmt.Sprintf("**%s:** %s", f.Label, f.Value))
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+
+	if withImage && card.ImageURL != "" {
+		parts = append(parts, fmt.Sprintf("[Image](%s)", card.ImageURL))
+	}
+
+	if len(card.Buttons) > 0 {
+		lines := make([]string, 0, len(card.Buttons))
+		for _, b := range card.Buttons {
+			lines = append(lines, "- "+cardButtonText(b))
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// cardButtonText describes a button for channels that cannot show it
+func cardButtonText(b bus.CardButton) string {
+	switch {
+	case b.URL != "":
+		return fmt.Sprintf("[%s](%s)", b.Label, b.URL)
+	case b.Reply != "" && b.Reply != b.Label:
+		return fmt.Sprintf("%s: reply %q", b.Label, b.Reply)
+	default:
+		return fmt.Sprintf("Reply %q", b.Label)
+	}
+}
+
+// cardButtonReply returns the message a reply button sends back
+func cardButtonReply(b bus.CardButton) string {
+	if b.Reply != "" {
+		return b.Reply
+	}
+	return b.Label
+}
+
+// flattenCard appends the text fallback of msg.Card to the message content
+// and drops the card. Formatted content gets the fallback in markup.
+func flattenCard(msg bus.OutboundMessage, markup format.Style, withImage bool) bus.OutboundMessage {
+	if msg.Card == nil {
+		return msg
+	}
+	text := cardMarkdown(msg.Card, withImage)
+	if msg.Formatted {
+		text = format.Convert(text, markup)
+	}
+	if strings.TrimSpace(msg.Content) != "" {
+		text = msg.Content + "\n\n" + text
+	}
+	msg.Content = text
+	msg.Card = nil
+	return msg
+}
@@ -0,0 +1,160 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mymmrac/telego"
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+func testCard() *bus.Card {
+	return &bus.Card{
+		Title:    "Build #12",
+		Text:     "All checks **passed**",
+		Fields:   []bus.CardField{{Label: "Branch", Value: "main"}, {Label: "Duration", Value: "3m"}},
+		Buttons:  []bus.CardButton{{Label: "Logs", URL: "https://ci.example.com/12"}, {Label: "Deploy", Reply: "deploy build 12"}},
+		ImageURL: "https://ci.example.com/12.png",
+	}
+}
+
+func TestCardMarkdown(t *testing.T) {
+	want := "**Build #12**\n\nAll checks **passed**\n\n**Branch:** main\n**Duration:** 3m\n\n" +
+		"[Image](https://ci.example.com/12.png)\n\n" +
+		"- [Logs](https://ci.example.com/12)\n- Deploy: reply \"deploy build 12\""
+	if got := cardMarkdown(testCard(), true); got != want {
+		t.Errorf("cardMarkdown() = %q, want %q", got, want)
+	}
+
+	if got := cardMarkdown(&bus.Card{Buttons: []bus.CardButton{{Label: "Yes"}}}, true); got != "- Reply \"Yes\"" {
+		t.Errorf("button without reply = %q", got)
+	}
+}
+
+func TestFlattenCard(t *testing.T) {
+	card := &bus.Card{Title: "Status", Fields: []bus.CardField{{Label: "CPU", Value: "5%"}}}
+	tests := []struct {
+		name string
+		msg  bus.OutboundMessage
+		want string
+	}{
+		{"no content", bus.OutboundMessage{Card: card}, "**Status**\n\n**CPU:** 5%"},
+		{"after content", bus.OutboundMessage{Content: "Here you go", Card: card}, "Here you go\n\n**Status**\n\n**CPU:** 5%"},
+		{"formatted content", bus.OutboundMessage{Content: "*Report*", Formatted: true, Card: card}, "*Report*\n\n*Status*\n\n*CPU:* 5%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := flattenCard(tt.msg, format.WhatsApp, true)
+			if got.Content != tt.want || got.Card != nil {
+				t.Errorf("flattenCard() = %q (card %v), want %q", got.Content, got.Card, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlackCardBlocks(t *testing.T) {
+	blocks := slackCardBlocks(testCard())
+
+	wantTypes := []slack.MessageBlockType{slack.MBTHeader, slack.MBTSection, slack.MBTSection, slack.MBTImage, slack.MBTAction}
+	if len(blocks) != len(wantTypes) {
+		t.Fatalf("expected %d blocks, got %d", len(wantTypes), len(blocks))
+	}
+	for i, block := range blocks {
+		if block.BlockType() != wantTypes[i] {
+			t.Errorf("block %d is %s, want %s", i, block.BlockType(), wantTypes[i])
+		}
+	}
+
+	actions := blocks[4].(*slack.ActionBlock).Elements.ElementSet
+	link := actions[0].(*slack.ButtonBlockElement)
+	reply := actions[1].(*slack.ButtonBlockElement)
+	if link.URL != "https://ci.example.com/12" || link.Value != "" {
+		t.Errorf("link button = %+v", link)
+	}
+	if reply.Value != "deploy build 12" || !strings.HasPrefix(reply.ActionID, slackCardActionPrefix) {
+		t.Errorf("reply button = %+v", reply)
+	}
+}
+
+func TestSlackContentOptionCard(t *testing.T) {
+	_, values, err := slack.UnsafeApplyMsgOptions("", "C1", "https://slack.example.com/api/",
+		slackContentOption(bus.OutboundMessage{Content: "Here you go", Card: testCard()}))
+	if err != nil {
+		t.Fatalf("UnsafeApplyMsgOptions: %v", err)
+	}
+	if values.Get("text") != "Here you go" || !strings.Contains(values.Get("blocks"), `"type":"header"`) {
+		t.Errorf("unexpected message: text %q, blocks %q", values.Get("text"), values.Get("blocks"))
+	}
+}
+
+func TestTelegramCard(t *testing.T) {
+	card := testCard()
+	long := strings.Repeat("x", telegramMaxCallbackData+1)
+	card.Buttons = append(card.Buttons, bus.CardButton{Label: "Long", Reply: long})
+
+	text, keyboard := telegramCard(card)
+	if keyboard == nil || len(keyboard.InlineKeyboard) != 2 {
+		t.Fatalf("expected 2 keyboard rows, got %+v", keyboard)
+	}
+	if got := keyboard.InlineKeyboard[0][0]; got.URL != "https://ci.example.com/12" {
+		t.Errorf("link button = %+v", got)
+	}
+	if got := keyboard.InlineKeyboard[1][0]; got.CallbackData != "deploy build 12" {
+		t.Errorf("reply button = %+v", got)
+	}
+	if !strings.Contains(text, long) || strings.Contains(text, "Deploy") || strings.Contains(text, "[Image]") {
+		t.Errorf("unexpected card text %q", text)
+	}
+
+	if _, keyboard := telegramCard(&bus.Card{Title: "No buttons"}); keyboard != nil {
+		t.Error("expected no keyboard for a card without buttons")
+	}
+}
+
+func TestDiscordCard(t *testing.T) {
+	send := discordCard(testCard(), format.Markdown)
+
+	if len(send.Embeds) != 1 {
+		t.Fatalf("expected one embed, got %d", len(send.Embeds))
+	}
+	embed := send.Embeds[0]
+	if embed.Title != "Build #12" || len(embed.Fields) != 2 || embed.Image == nil {
+		t.Errorf("unexpected embed %+v", embed)
+	}
+
+	if len(send.Components) != 1 {
+		t.Fatalf("expected one row of buttons, got %d", len(send.Components))
+	}
+	buttons := send.Components[0].(discordgo.ActionsRow).Components
+	if link := buttons[0].(discordgo.Button); link.Style != discordgo.LinkButton || link.URL == "" {
+		t.Errorf("link button = %+v", link)
+	}
+	if reply := buttons[1].(discordgo.Button); reply.CustomID != discordCardButtonPrefix+"deploy build 12" {
+		t.Errorf("reply button = %+v", reply)
+	}
+}
+
+func TestButtonLabels(t *testing.T) {
+	send := discordCard(testCard(), format.Markdown)
+	msg := &discordgo.Message{Components: send.Components}
+	if got := discordButtonLabel(msg, "deploy build 12"); got != "Deploy" {
+		t.Errorf("discordButtonLabel() = %q, want Deploy", got)
+	}
+	if got := discordButtonLabel(nil, "deploy build 12"); got != "" {
+		t.Errorf("discordButtonLabel(nil) = %q", got)
+	}
+
+	_, keyboard := telegramCard(testCard())
+	tgMsg := &telego.Message{ReplyMarkup: keyboard}
+	if got := telegramButtonLabel(tgMsg, "deploy build 12"); got != "Deploy" {
+		t.Errorf("telegramButtonLabel() = %q, want Deploy", got)
+	}
+	if got := telegramButtonLabel(&telego.InaccessibleMessage{}, "deploy build 12"); got != "" {
+		t.Errorf("telegramButtonLabel(inaccessible) = %q", got)
+	}
+}
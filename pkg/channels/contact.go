@@ -0,0 +1,105 @@
+package channels
+
+import (
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+// contactChannel is implemented by channels that send contact cards.
+// Contacts sent to other channels are written out by the manager.
+type contactChannel interface {
+	SendsContacts() bool
+}
+
+// sendsContacts reports whether a channel sends contact cards itself
+func sendsContacts(ch Channel) bool {
+	cc, ok := ch.(contactChannel)
+	return ok && cc.SendsContacts()
+}
+
+// contactMarkdown renders a contact as its name followed by its phones
+// and emails
+func contactMarkdown(contact *bus.Contact) string {
+	lines := []string{"**" + contact.Name + "**"}
+	for _, phone := range contact.Phones {
+		lines = append(lines, "Phone: "+phone)
+	}
+	for _, email := range contact.Emails {
+		lines = append(lines, "Email: "+email)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// emulateContact replaces msg.Contact with text after the content, in
+// markup when the content is formatted
+func emulateContact(msg bus.OutboundMessage, markup format.Style) bus.OutboundMessage {
+	contact := msg.Contact
+	if contact == nil {
+		return msg
+	}
+	msg.Contact = nil
+
+	text := contactMarkdown(contact)
+	if msg.Formatted {
+		text = format.Convert(text, markup)
+	}
+	if strings.TrimSpace(msg.Content) != "" {
+		text = msg.Content + "\n\n" + text
+	}
+	msg.Content = text
+	return msg
+}
+
+// vCardEscaper escapes vCard property values
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+
+// vCardUnescaper reverses vCardEscaper
+var vCardUnescaper = strings.NewReplacer(`\\`, `\`, `\,`, ",", `\;`, ";", `\n`, "\n", `\N`, "\n")
+
+// contactVCard writes a contact as a vCard 3.0
+func contactVCard(contact *bus.Contact) string {
+	name := vCardEscaper.Replace(contact.Name)
+	lines := []string{"BEGIN:VCARD", "VERSION:3.0", "FN:" + name, "N:" + name + ";;;;"}
+	for _, phone := range contact.Phones {
+		lines = append(lines, "TEL;TYPE=CELL:"+vCardEscaper.Replace(phone))
+	}
+	for _, email := range contact.Emails {
+		lines = append(lines, "EMAIL:"+vCardEscaper.Replace(email))
+	}
+	lines = append(lines, "END:VCARD")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// parseVCard reads the name, phones and emails of a vCard. Other
+// properties are ignored.
+func parseVCard(vcard string) bus.Contact {
+	var contact bus.Contact
+	// Folded lines continue with a space or tab
+	unfolded := strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(vcard)
+	for _, line := range strings.Split(unfolded, "\n") {
+		property, value, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !ok {
+			continue
+		}
+		// Drop parameters (TEL;TYPE=CELL) and groups (item1.TEL)
+		name, _, _ := strings.Cut(property, ";")
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		value = strings.TrimSpace(vCardUnescaper.Replace(value))
+		if value == "" {
+			continue
+		}
+		switch strings.ToUpper(name) {
+		case "FN":
+			contact.Name = value
+		case "TEL":
+			contact.Phones = append(contact.Phones, value)
+		case "EMAIL":
+			contact.Emails = append(contact.Emails, value)
+		}
+	}
+	return contact
+}
@@ -0,0 +1,36 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+func TestContactVCard(t *testing.T) {
+	contact := &bus.Contact{Name: "Lovelace; Ada", Phones: []string{"+44 1234", "+44 5678"}, Emails: []string{"ada@example.com"}}
+
+	got := parseVCard(contactVCard(contact))
+	if got.Name != contact.Name || len(got.Phones) != 2 || got.Phones[1] != "+44 5678" || len(got.Emails) != 1 {
+		t.Errorf("round trip = %+v, want %+v", got, contact)
+	}
+
+	folded := parseVCard("BEGIN:VCARD\nFN:Ada\n  Lovelace\nTEL;TYPE=CELL:+44 1234\nEND:VCARD")
+	if folded.Name != "Ada Lovelace" || len(folded.Phones) != 1 {
+		t.Errorf("folded vcard = %+v", folded)
+	}
+}
+
+func TestEmulateContact(t *testing.T) {
+	contact := &bus.Contact{Name: "Ada", Emails: []string{"ada@example.com"}}
+
+	got := emulateContact(bus.OutboundMessage{Content: "Her card:", Contact: contact}, format.Markdown)
+	if got.Contact != nil || got.Content != "Her card:\n\n**Ada**\nEmail: ada@example.com" {
+		t.Errorf("emulateContact() = %q (contact %v)", got.Content, got.Contact)
+	}
+
+	got = emulateContact(bus.OutboundMessage{Contact: contact, Formatted: true}, format.Plain)
+	if got.Content != "Ada\nEmail: ada@example.com" {
+		t.Errorf("formatted contact = %q", got.Content)
+	}
+}
@@ -0,0 +1,168 @@
+package channels
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// DefaultDebounceMaxMessages is how many messages are coalesced at most
+// when the configuration sets no limit
+const DefaultDebounceMaxMessages = 10
+
+// MetadataMessageIDs lists the platform IDs of the messages coalesced into
+// one inbound message, comma separated, oldest first. "message_id" is that
+// of the last one.
+const MetadataMessageIDs = "message_ids"
+
+// inboundDebouncer holds inbound messages for a short window and publishes
+// a sender's rapid consecutive messages in a chat as one, so the agent
+// answers them in one turn instead of one by one
+type inboundDebouncer struct {
+	window      time.Duration // Quiet time that ends a burst
+	maxWait     time.Duration // Longest the first message of a burst is held
+	maxMessages int
+	publish     func(bus.InboundMessage)
+
+	mu      sync.Mutex
+	pending map[string]*debouncedBurst // By session and sender
+}
+
+// debouncedBurst is the messages held for a sender in a chat
+type debouncedBurst struct {
+	msgs  []bus.InboundMessage
+	first time.Time
+	timer *time.Timer
+}
+
+// newInboundDebouncer returns the debouncer configured for channel, or nil
+// when debouncing is off for it
+func newInboundDebouncer(cfg config.InboundDebounceConfig, channel string, publish func(bus.InboundMessage)) *inboundDebouncer {
+	windowMS := cfg.WindowMS
+	if ms, ok := cfg.ChannelWindowMS[channel]; ok {
+		windowMS = ms
+	}
+	if windowMS <= 0 {
+		return nil
+	}
+	d := &inboundDebouncer{
+		window:      time.Duration(windowMS) * time.Millisecond,
+		maxWait:     time.Duration(cfg.MaxWaitMS) * time.Millisecond,
+		maxMessages: cfg.MaxMessages,
+		publish:     publish,
+		pending:     make(map[string]*debouncedBurst),
+	}
+	if d.maxWait < d.window {
+		d.maxWait = 4 * d.window
+	}
+	if d.maxMessages <= 0 {
+		d.maxMessages = DefaultDebounceMaxMessages
+	}
+	return d
+}
+
+// add holds msg until its sender has been quiet for the window. Commands
+// are published right away, after the messages held before them.
+func (d *inboundDebouncer) add(msg bus.InboundMessage) {
+	key := msg.SessionKey + "|" + msg.SenderID
+	if strings.HasPrefix(strings.TrimSpace(msg.Content), "/") {
+		d.flush(key, nil)
+		d.publish(msg)
+		return
+	}
+
+	d.mu.Lock()
+	burst := d.pending[key]
+	if burst == nil {
+		burst = &debouncedBurst{first: time.Now()}
+		d.pending[key] = burst
+	}
+	burst.msgs = append(burst.msgs, msg)
+
+	delay := min(d.window, d.maxWait-time.Since(burst.first))
+	if burst.timer != nil {
+		burst.timer.Stop()
+	}
+	if len(burst.msgs) >= d.maxMessages || delay <= 0 {
+		d.mu.Unlock()
+		d.flush(key, burst)
+		return
+	}
+	burst.timer = time.AfterFunc(delay, func() { d.flush(key, burst) })
+	d.mu.Unlock()
+}
+
+// flush publishes the messages held for key, if they are those of burst
+// or burst is nil
+func (d *inboundDebouncer) flush(key string, burst *debouncedBurst) {
+	d.mu.Lock()
+	held := d.pending[key]
+	if held == nil || (burst != nil && held != burst) {
+		// Published already
+		d.mu.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	if held.timer != nil {
+		held.timer.Stop()
+	}
+	d.mu.Unlock()
+
+	d.publish(coalesce(held.msgs))
+}
+
+// flushAll publishes every held message, for shutdown
+func (d *inboundDebouncer) flushAll() {
+	d.mu.Lock()
+	keys := make([]string, 0, len(d.pending))
+	for key := range d.pending {
+		keys = append(keys, key)
+	}
+	d.mu.Unlock()
+
+	for _, key := range keys {
+		d.flush(key, nil)
+	}
+}
+
+// coalesce joins msgs into one message: the texts one per line, all media,
+// and the metadata and trace ID of the last message with the IDs of all
+func coalesce(msgs []bus.InboundMessage) bus.InboundMessage {
+	if len(msgs) == 1 {
+		return msgs[0]
+	}
+
+	merged := msgs[len(msgs)-1]
+	var contents, ids []string
+	var media []string
+	for _, msg := range msgs {
+		if msg.Content != "" {
+			contents = append(contents, msg.Content)
+		}
+		media = append(media, msg.Media...)
+		if id := msg.Metadata["message_id"]; id != "" {
+			ids = append(ids, id)
+		}
+	}
+	merged.Content = strings.Join(contents, "\n")
+	merged.Media = media
+	merged.Metadata = make(map[string]string, len(merged.Metadata)+1)
+	for k, v := range msgs[len(msgs)-1].Metadata {
+		merged.Metadata[k] = v
+	}
+	if len(ids) > 0 {
+		merged.Metadata[MetadataMessageIDs] = strings.Join(ids, ",")
+	}
+
+	logger.DebugCF(merged.Channel, "Coalesced inbound messages", map[string]interface{}{
+		"chat_id":     merged.ChatID,
+		"messages":    len(msgs),
+		"message_ids": merged.Metadata[MetadataMessageIDs],
+		"trace_id":    merged.TraceID,
+	})
+	return merged
+}
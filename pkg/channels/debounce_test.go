@@ -0,0 +1,130 @@
+package channels
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// publishRecorder collects what a debouncer publishes
+type publishRecorder struct {
+	mu   sync.Mutex
+	msgs []bus.InboundMessage
+}
+
+func (r *publishRecorder) publish(msg bus.InboundMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+}
+
+func (r *publishRecorder) published() []bus.InboundMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]bus.InboundMessage(nil), r.msgs...)
+}
+
+func debounceMsg(sender, id, content string) bus.InboundMessage {
+	return bus.InboundMessage{
+		Channel:    "telegram",
+		SenderID:   sender,
+		ChatID:     "1",
+		SessionKey: "telegram:1",
+		Content:    content,
+		Metadata:   map[string]string{"message_id": id},
+	}
+}
+
+func TestInboundDebouncerCoalescesBurst(t *testing.T) {
+	var rec publishRecorder
+	d := newInboundDebouncer(config.InboundDebounceConfig{WindowMS: 40}, "telegram", rec.publish)
+
+	d.add(debounceMsg("alice", "1", "hi"))
+	d.add(debounceMsg("bob", "2", "hello"))
+	d.add(debounceMsg("alice", "3", "can you"))
+	d.add(debounceMsg("alice", "4", "check my order?"))
+	if got := rec.published(); len(got) != 0 {
+		t.Fatalf("published before the window: %+v", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	got := rec.published()
+	if len(got) != 2 {
+		t.Fatalf("published %+v", got)
+	}
+	var alice bus.InboundMessage
+	for _, msg := range got {
+		if msg.SenderID == "alice" {
+			alice = msg
+		}
+	}
+	if alice.Content != "hi\ncan you\ncheck my order?" {
+		t.Errorf("content %q", alice.Content)
+	}
+	if alice.Metadata[MetadataMessageIDs] != "1,3,4" || alice.Metadata["message_id"] != "4" {
+		t.Errorf("metadata %v", alice.Metadata)
+	}
+}
+
+func TestInboundDebouncerLimits(t *testing.T) {
+	var rec publishRecorder
+	d := newInboundDebouncer(config.InboundDebounceConfig{WindowMS: 10000, MaxMessages: 2}, "telegram", rec.publish)
+
+	d.add(debounceMsg("alice", "1", "one"))
+	d.add(debounceMsg("alice", "2", "two"))
+	if got := rec.published(); len(got) != 1 || got[0].Content != "one\ntwo" {
+		t.Fatalf("max messages: %+v", got)
+	}
+
+	// Commands go out at once, after what was held before them
+	d.add(debounceMsg("alice", "3", "three"))
+	d.add(debounceMsg("alice", "4", "/reset"))
+	got := rec.published()
+	if len(got) != 3 || got[1].Content != "three" || got[2].Content != "/reset" {
+		t.Fatalf("command: %+v", got)
+	}
+
+	d.add(debounceMsg("alice", "5", "five"))
+	d.flushAll()
+	if got := rec.published(); len(got) != 4 || got[3].Content != "five" {
+		t.Fatalf("flush all: %+v", got)
+	}
+}
+
+func TestInboundDebouncerConfig(t *testing.T) {
+	cfg := config.InboundDebounceConfig{WindowMS: 500, ChannelWindowMS: map[string]int{"slack": 0, "discord": 1000}}
+	if d := newInboundDebouncer(cfg, "slack", nil); d != nil {
+		t.Error("debouncing not disabled for slack")
+	}
+	if d := newInboundDebouncer(cfg, "discord", nil); d == nil || d.window != time.Second || d.maxWait != 4*time.Second {
+		t.Errorf("discord: %+v", d)
+	}
+	if d := newInboundDebouncer(config.InboundDebounceConfig{}, "telegram", nil); d != nil {
+		t.Error("debouncing on by default")
+	}
+}
+
+func TestBaseChannelDebounce(t *testing.T) {
+	mb := bus.NewMessageBus()
+	c := NewBaseChannel("telegram", nil, mb, nil)
+	c.configureInboundDebounce(config.InboundDebounceConfig{WindowMS: 10000})
+
+	c.HandleMessage("alice", "1", "hi", nil, map[string]string{"message_id": "1"})
+	c.HandleMessage("alice", "1", "there", nil, map[string]string{"message_id": "2"})
+	if in, _ := mb.Pending(); in != 0 {
+		t.Fatalf("published %d messages before the window", in)
+	}
+
+	// Shutdown publishes the held messages, so the drain waits for them
+	c.stopInbound()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.Content != "hi\nthere" || msg.SessionKey != "telegram:1" {
+		t.Fatalf("got %+v, %v", msg, ok)
+	}
+}
@@ -0,0 +1,98 @@
+package channels
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Inbound deduplication defaults
+const (
+	DefaultDedupWindow = 10 * time.Minute
+	DefaultDedupSize   = 10000
+)
+
+// dedupEntry is a message identifier and when it was first seen
+type dedupEntry struct {
+	key  string
+	seen time.Time
+}
+
+// InboundDedup drops inbound messages seen before within a time window.
+// Bridges and platforms may redeliver messages, e.g. after a reconnect.
+type InboundDedup struct {
+	window  time.Duration
+	size    int
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front = oldest
+	dropped atomic.Uint64
+	now     func() time.Time
+}
+
+// NewInboundDedup creates a dedup cache remembering up to size identifiers
+// for window. Zero values select the defaults.
+func NewInboundDedup(window time.Duration, size int) *InboundDedup {
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+	if size <= 0 {
+		size = DefaultDedupSize
+	}
+	return &InboundDedup{
+		window:  window,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// newInboundDedupFromConfig creates the cache configured for the channels,
+// or nil when deduplication is disabled
+func newInboundDedupFromConfig(cfg config.InboundDedupConfig) *InboundDedup {
+	if cfg.WindowSeconds < 0 {
+		return nil
+	}
+	return NewInboundDedup(time.Duration(cfg.WindowSeconds)*time.Second, cfg.MaxEntries)
+}
+
+// Seen records key and reports whether it was already recorded within the
+// window, counting the duplicate. A nil cache sees nothing.
+func (d *InboundDedup) Seen(key string) bool {
+	if d == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	// Entries are in insertion order, so expired ones are at the front
+	for front := d.order.Front(); front != nil; front = d.order.Front() {
+		entry := front.Value.(dedupEntry)
+		if now.Sub(entry.seen) < d.window && d.order.Len() < d.size {
+			break
+		}
+		d.order.Remove(front)
+		delete(d.entries, entry.key)
+	}
+
+	if _, ok := d.entries[key]; ok {
+		d.dropped.Add(1)
+		return true
+	}
+	d.entries[key] = d.order.PushBack(dedupEntry{key: key, seen: now})
+	return false
+}
+
+// Dropped returns the number of duplicates seen
+func (d *InboundDedup) Dropped() uint64 {
+	if d == nil {
+		return 0
+	}
+	return d.dropped.Load()
+}
@@ -0,0 +1,69 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestInboundDedup(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := NewInboundDedup(time.Minute, 2)
+	d.now = func() time.Time { return now }
+
+	if d.Seen("a") {
+		t.Fatal("first delivery reported as duplicate")
+	}
+	if !d.Seen("a") {
+		t.Fatal("redelivery not detected")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if d.Seen("a") {
+		t.Error("identifier should expire after the window")
+	}
+
+	d.Seen("b")
+	d.Seen("c") // Evicts "a", the oldest
+	if d.Seen("a") {
+		t.Error("oldest identifier should be evicted when the cache is full")
+	}
+	if d.Dropped() != 1 {
+		t.Errorf("expected 1 dropped duplicate, got %d", d.Dropped())
+	}
+
+	var disabled *InboundDedup
+	if disabled.Seen("a") || disabled.Seen("a") || disabled.Dropped() != 0 {
+		t.Error("nil cache should accept every message")
+	}
+}
+
+func TestHandleMessageDropsDuplicates(t *testing.T) {
+	mb := bus.NewMessageBus()
+	c := NewBaseChannel("telegram", nil, mb, nil)
+
+	c.HandleMessage("42", "chat", "hello", nil, map[string]string{"message_id": "7"})
+	c.HandleMessage("42", "chat", "hello", nil, map[string]string{"message_id": "7"})
+	c.HandleMessage("42", "other", "hello", nil, map[string]string{"message_id": "7"})
+	c.HandleMessage("42", "chat", "no id", nil, nil)
+	c.HandleMessage("42", "chat", "no id", nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	received := 0
+	for {
+		if _, ok := mb.ConsumeInbound(ctx); !ok {
+			break
+		}
+		received++
+	}
+
+	if received != 4 {
+		t.Errorf("expected 4 messages (one duplicate dropped), got %d", received)
+	}
+	if c.DuplicatesDropped() != 1 {
+		t.Errorf("expected 1 dropped duplicate, got %d", c.DuplicatesDropped())
+	}
+}
@@ -0,0 +1,255 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/trace"
+)
+
+// Delivery defaults
+const (
+	DefaultDeliveryAttempts   = 3
+	DefaultDeliveryRetryDelay = 2 * time.Second
+)
+
+// EventDelivery is the bus event published when an outbound message is
+// sent, fails or is retried. Its data holds the "delivery_id", "chat_id",
+// "status", "attempts" and, after a failure, the "error"; its payload is a
+// bus.DeliveryEvent.
+const EventDelivery = bus.TopicDelivery
+
+// DeliveryStatus is where an outbound message is in its delivery
+type DeliveryStatus string
+
+const (
+	DeliveryPending  DeliveryStatus = "pending"
+	DeliverySent     DeliveryStatus = "sent"
+	DeliveryRetrying DeliveryStatus = "retrying" // Failed, another attempt is scheduled
+	DeliveryFailed   DeliveryStatus = "failed"   // Final
+)
+
+// errUnknownChannel is returned for messages to channels that are not
+// enabled; they are not retried
+var errUnknownChannel = fmt.Errorf("%w: unknown channel", errs.ErrChannelDown)
+
+// Delivery is the handle of an outbound message. Its status changes as the
+// message is retried; the same changes are published as EventDelivery
+// events for callers that only hold the delivery ID.
+type Delivery struct {
+	ID      string
+	Channel string
+	ChatID  string
+
+	mu       sync.Mutex
+	status   DeliveryStatus
+	attempts int
+	err      error
+	done     chan struct{}
+}
+
+func newDelivery(msg bus.OutboundMessage) *Delivery {
+	id := msg.DeliveryID
+	if id == "" {
+		id = bus.NewDeliveryID()
+	}
+	return &Delivery{
+		ID:      id,
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		status:  DeliveryPending,
+		done:    make(chan struct{}),
+	}
+}
+
+// Status returns the current status
+func (d *Delivery) Status() DeliveryStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// Attempts returns how often sending was tried
+func (d *Delivery) Attempts() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.attempts
+}
+
+// Err returns the error of the last failed attempt
+func (d *Delivery) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// Done is closed once the message is sent or has finally failed
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Wait blocks until the delivery is final and returns nil if the message
+// was sent, or the last error
+func (d *Delivery) Wait(ctx context.Context) error {
+	select {
+	case <-d.done:
+		return d.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// update records the outcome of an attempt
+func (d *Delivery) update(status DeliveryStatus, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.status == DeliverySent || d.status == DeliveryFailed {
+		return
+	}
+	d.status = status
+	d.err = err
+	if status == DeliverySent || status == DeliveryFailed {
+		close(d.done)
+	}
+}
+
+// deliveryPolicy returns the attempts and first retry delay from config
+// for messages to channel
+func (m *Manager) deliveryPolicy(channel string) (int, time.Duration) {
+	attempts, delay := DefaultDeliveryAttempts, DefaultDeliveryRetryDelay
+	if m.config == nil {
+		return attempts, delay
+	}
+	if cfg := m.config.Channels.Delivery; cfg.ChannelMaxAttempts[channel] > 0 {
+		attempts = cfg.ChannelMaxAttempts[channel]
+	} else if cfg.MaxAttempts > 0 {
+		attempts = cfg.MaxAttempts
+	}
+	if cfg := m.config.Channels.Delivery; cfg.RetryDelaySeconds > 0 {
+		delay = time.Duration(cfg.RetryDelaySeconds) * time.Second
+	}
+	return attempts, delay
+}
+
+// Send sends msg and returns its delivery handle. The first attempt is made
+// before Send returns; failed attempts are retried in the background until
+// ctx is done.
+func (m *Manager) Send(ctx context.Context, msg bus.OutboundMessage) *Delivery {
+	d := newDelivery(msg)
+	msg.DeliveryID = d.ID
+	m.deliver(ctx, d, msg)
+	return d
+}
+
+// deliver makes one attempt to send msg and schedules the next one if it
+// failed and may succeed later
+func (m *Manager) deliver(ctx context.Context, d *Delivery, msg bus.OutboundMessage) {
+	err := m.sendOnce(ctx, msg)
+
+	d.mu.Lock()
+	d.attempts++
+	attempt := d.attempts
+	d.mu.Unlock()
+
+	// Internal channels are not delivered anywhere, so nobody follows them
+	internal := constants.IsInternalChannel(msg.Channel)
+	ctx = trace.WithID(ctx, msg.TraceID)
+
+	if err == nil {
+		d.update(DeliverySent, nil)
+		if !internal {
+			m.publishDelivery(d)
+		}
+		return
+	}
+
+	maxAttempts, baseDelay := m.deliveryPolicy(msg.Channel)
+	retry := attempt < maxAttempts && ctx.Err() == nil &&
+		!errors.Is(err, errUnknownChannel) && !errors.Is(err, errs.ErrValidation)
+	if !retry {
+		d.update(DeliveryFailed, err)
+		logger.ErrorCF("channels", "Error sending message to channel", trace.Fields(ctx, map[string]interface{}{
+			"channel":        msg.Channel,
+			"delivery_id":    d.ID,
+			"attempts":       attempt,
+			"error":          err.Error(),
+			"dead_letter_id": m.deadLetter(msg, err, attempt),
+		}))
+		m.publishDelivery(d)
+		return
+	}
+
+	delay := baseDelay << (attempt - 1)
+	var rateLimit *errs.RateLimitError
+	if errors.As(err, &rateLimit) && rateLimit.RetryAfter > 0 {
+		delay = rateLimit.RetryAfter
+	}
+	d.update(DeliveryRetrying, err)
+	logger.WarnCF("channels", "Sending message failed, retrying", trace.Fields(ctx, map[string]interface{}{
+		"channel":     msg.Channel,
+		"delivery_id": d.ID,
+		"attempt":     attempt,
+		"retry_in":    delay.String(),
+		"error":       err.Error(),
+	}))
+	m.publishDelivery(d)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			err := fmt.Errorf("%w (gave up: %v)", err, ctx.Err())
+			d.update(DeliveryFailed, err)
+			m.deadLetter(msg, err, attempt)
+			m.publishDelivery(d)
+		case <-time.After(delay):
+			m.deliver(ctx, d, msg)
+		}
+	}()
+}
+
+// deadLetter puts msg in the bus's dead-letter queue, from where an admin
+// can requeue it, and returns the entry's ID
+func (m *Manager) deadLetter(msg bus.OutboundMessage, err error, attempts int) string {
+	if m.bus == nil {
+		return ""
+	}
+	return m.bus.AddDeadLetter(msg, err, attempts).ID
+}
+
+// publishDelivery announces the status of d on the bus
+func (m *Manager) publishDelivery(d *Delivery) {
+	if m.bus == nil {
+		return
+	}
+	d.mu.Lock()
+	payload := bus.DeliveryEvent{
+		DeliveryID: d.ID,
+		Channel:    d.Channel,
+		ChatID:     d.ChatID,
+		Status:     string(d.status),
+		Attempts:   d.attempts,
+	}
+	if d.err != nil {
+		payload.Error = d.err.Error()
+	}
+	d.mu.Unlock()
+
+	data := map[string]string{
+		"delivery_id": payload.DeliveryID,
+		"chat_id":     payload.ChatID,
+		"status":      payload.Status,
+		"attempts":    strconv.Itoa(payload.Attempts),
+	}
+	if payload.Error != "" {
+		data["error"] = payload.Error
+	}
+	m.bus.PublishEvent(bus.Event{Type: EventDelivery, Source: d.Channel, Data: data, Payload: payload})
+}
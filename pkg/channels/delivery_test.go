@@ -0,0 +1,167 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+)
+
+// flakyChannel fails its first sends with err
+type flakyChannel struct {
+	*recordingChannel
+	failures int
+	err      error
+}
+
+func (c *flakyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	if c.failures > 0 {
+		c.failures--
+		c.mu.Unlock()
+		return c.err
+	}
+	c.mu.Unlock()
+	return c.recordingChannel.Send(ctx, msg)
+}
+
+func newDeliveryTestManager(ch Channel, attempts int) (*Manager, *bus.MessageBus) {
+	mb := bus.NewMessageBus()
+	cfg := &config.Config{}
+	cfg.Channels.Delivery = config.DeliveryConfig{MaxAttempts: attempts, RetryDelaySeconds: 1}
+	return &Manager{
+		channels: map[string]Channel{"test": ch},
+		bus:      mb,
+		config:   cfg,
+	}, mb
+}
+
+func TestManagerSendRetries(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := &flakyChannel{
+		recordingChannel: &recordingChannel{BaseChannel: NewBaseChannel("test", nil, mb, nil)},
+		failures:         1,
+		err:              &errs.RateLimitError{RetryAfter: 10 * time.Millisecond},
+	}
+	m, mb := newDeliveryTestManager(ch, 3)
+	events := mb.SubscribeEvents(t.Context())
+
+	d := m.Send(t.Context(), bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "hi"})
+	if d.ID == "" || d.Status() != DeliveryRetrying {
+		t.Fatalf("after a failed first attempt: id %q, status %s", d.ID, d.Status())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if d.Status() != DeliverySent || d.Attempts() != 2 || len(ch.sent) != 1 {
+		t.Errorf("status %s after %d attempts, %d sent", d.Status(), d.Attempts(), len(ch.sent))
+	}
+	if ch.sent[0].DeliveryID != d.ID {
+		t.Errorf("sent message carries delivery ID %q, want %q", ch.sent[0].DeliveryID, d.ID)
+	}
+
+	for _, want := range []DeliveryStatus{DeliveryRetrying, DeliverySent} {
+		select {
+		case ev := <-events:
+			if ev.Type != EventDelivery || ev.Data["delivery_id"] != d.ID || ev.Data["status"] != string(want) {
+				t.Errorf("unexpected event %+v, want %s", ev, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("missing %s event", want)
+		}
+	}
+}
+
+func TestManagerSendGivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		channel  string
+		err      error
+		attempts int
+	}{
+		{"validation errors are not retried", "test", fmt.Errorf("%w: empty message", errs.ErrValidation), 1},
+		{"unknown channels are not retried", "missing", nil, 1},
+		{"retries are limited", "test", errors.New("timeout"), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &flakyChannel{
+				recordingChannel: &recordingChannel{BaseChannel: NewBaseChannel("test", nil, nil, nil)},
+				failures:         10,
+				err:              tt.err,
+			}
+			m, mb := newDeliveryTestManager(ch, 2)
+			m.config.Channels.Delivery.RetryDelaySeconds = 0
+
+			// Keep the test fast: a rate limit delay overrides the default
+			if tt.err != nil && !errors.Is(tt.err, errs.ErrValidation) {
+				ch.err = &errs.RateLimitError{RetryAfter: time.Millisecond, Err: tt.err}
+			}
+
+			d := m.Send(t.Context(), bus.OutboundMessage{Channel: tt.channel, ChatID: "chat"})
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := d.Wait(ctx); err == nil {
+				t.Fatal("expected the delivery to fail")
+			}
+			if d.Status() != DeliveryFailed || d.Attempts() != tt.attempts {
+				t.Errorf("status %s after %d attempts, want failed after %d", d.Status(), d.Attempts(), tt.attempts)
+			}
+			if dead := mb.DeadLetters(); len(dead) != 1 || dead[0].Message.DeliveryID != d.ID || dead[0].Attempts != tt.attempts {
+				t.Errorf("unexpected dead letters %+v", dead)
+			}
+		})
+	}
+}
+
+func TestManagerSendChannelAttempts(t *testing.T) {
+	ch := &flakyChannel{
+		recordingChannel: &recordingChannel{BaseChannel: NewBaseChannel("test", nil, nil, nil)},
+		failures:         10,
+		err:              &errs.RateLimitError{RetryAfter: time.Millisecond, Err: errors.New("timeout")},
+	}
+	m, mb := newDeliveryTestManager(ch, 2)
+	m.config.Channels.Delivery.ChannelMaxAttempts = map[string]int{"test": 4, "other": 1}
+
+	d := m.Send(t.Context(), bus.OutboundMessage{Channel: "test", ChatID: "chat"})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	d.Wait(ctx)
+	if d.Attempts() != 4 {
+		t.Errorf("gave up after %d attempts, want the channel's 4", d.Attempts())
+	}
+
+	// Requeued dead letters go through the dispatcher again
+	ch.failures = 0
+	dead := mb.DeadLetters()
+	if len(dead) != 1 {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+	if _, err := mb.RequeueDeadLetter(dead[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := mb.SubscribeOutbound(ctx)
+	if d := m.Send(ctx, msg); d.Status() != DeliverySent || d.ID != dead[0].Message.DeliveryID {
+		t.Errorf("requeued message: status %s, delivery ID %q", d.Status(), d.ID)
+	}
+}
+
+func TestPublishOutboundDeliveryID(t *testing.T) {
+	mb := bus.NewMessageBus()
+	id := mb.PublishOutbound(bus.OutboundMessage{Channel: "test", ChatID: "chat"})
+	msg, ok := mb.SubscribeOutbound(t.Context())
+	if !ok || id == "" || msg.DeliveryID != id {
+		t.Errorf("published delivery ID %q, message has %q", id, msg.DeliveryID)
+	}
+	if id := mb.PublishOutbound(bus.OutboundMessage{DeliveryID: "mine"}); id != "mine" {
+		t.Errorf("existing delivery ID replaced with %q", id)
+	}
+}
@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
@@ -20,12 +23,23 @@ const (
 	sendTimeout          = 10 * time.Second
 )
 
+// Discord has a limit of 2000 characters per message. Text is split at
+// 1500, leaving 500 for natural splits, e.g. of code blocks.
+const (
+	discordMaxContent = 2000
+	discordChunkSize  = 1500
+)
+
 type DiscordChannel struct {
 	*BaseChannel
-	session     *discordgo.Session
-	config      config.DiscordConfig
-	transcriber *voice.GroqTranscriber
-	ctx         context.Context
+	session      *discordgo.Session
+	config       config.DiscordConfig
+	transcriber  voice.Transcriber
+	ctx          context.Context
+	markup       format.Style
+	guilds       discordGuilds
+	mediaDir     string
+	interactions sync.Map // chatID -> pendingInteraction
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -33,19 +47,41 @@ func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordC
 	if err != nil {
 		return nil, fmt.Errorf("failed to create discord session: %w", err)
 	}
+	session.Identify.Intents = discordIntents
 
 	base := NewBaseChannel("discord", cfg, bus, cfg.AllowFrom)
 
+	// Discord renders Markdown itself
+	markup, err := format.ParseStyle(cfg.Format, format.Markdown)
+	if err != nil {
+		logger.WarnCF("discord", "Invalid format, using the default", map[string]interface{}{
+			"error":  err.Error(),
+			"format": string(markup),
+		})
+	}
+
 	return &DiscordChannel{
 		BaseChannel: base,
 		session:     session,
 		config:      cfg,
 		transcriber: nil,
 		ctx:         context.Background(),
+		markup:      markup,
+		guilds:      newDiscordGuilds(cfg.Guilds),
 	}, nil
 }
 
-func (c *DiscordChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+// Markup returns the markup the channel sends
+func (c *DiscordChannel) Markup() format.Style {
+	return c.markup
+}
+
+// RendersCards reports that the channel sends cards as embeds
+func (c *DiscordChannel) RendersCards() bool {
+	return true
+}
+
+func (c *DiscordChannel) SetTranscriber(transcriber voice.Transcriber) {
 	c.transcriber = transcriber
 }
 
@@ -61,6 +97,7 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 
 	c.ctx = ctx
 	c.session.AddHandler(c.handleMessage)
+	c.session.AddHandler(c.handleInteraction)
 
 	if err := c.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
@@ -77,6 +114,14 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 		"user_id":  botUser.ID,
 	})
 
+	if c.config.SlashCommands {
+		if err := c.registerCommands(); err != nil {
+			logger.ErrorCF("discord", "Failed to register slash commands", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
 	return nil
 }
 
@@ -92,29 +137,78 @@ func (c *DiscordChannel) Stop(ctx context.Context) error {
 }
 
 func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	_, err := c.SendMessages(ctx, msg)
+	return err
+}
+
+// SendMessages sends msg and returns the IDs of the Discord messages that
+// carry it, so they can be deleted later
+func (c *DiscordChannel) SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error) {
 	if !c.IsRunning() {
-		return fmt.Errorf("discord bot not running")
+		return nil, fmt.Errorf("%w: discord bot not running", errs.ErrChannelDown)
 	}
 
 	channelID := msg.ChatID
 	if channelID == "" {
-		return fmt.Errorf("channel ID is empty")
+		return nil, fmt.Errorf("channel ID is empty")
 	}
 
-	runes := []rune(msg.Content)
-	if len(runes) == 0 {
-		return nil
+	content := msg.Content
+	if !msg.Formatted {
+		content = format.Convert(content, c.markup)
 	}
 
-	chunks := splitMessage(msg.Content, 1500) // Discord has a limit of 2000 characters per message, leave 500 for natural split e.g. code blocks
+	var ids []string
+	if content != "" {
+		chunks := splitMessage(content, discordChunkSize)
 
-	for _, chunk := range chunks {
-		if err := c.sendChunk(ctx, channelID, chunk); err != nil {
-			return err
+		for _, chunk := range chunks {
+			id, err := c.sendChunk(ctx, channelID, chunk)
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, id)
 		}
 	}
 
-	return nil
+	if msg.Card != nil {
+		id, err := c.sendComplex(ctx, channelID, discordCard(msg.Card, c.markup))
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	for _, att := range msg.Attachments {
+		sent, err := c.sendAttachment(ctx, channelID, att, msg.Formatted)
+		ids = append(ids, sent...)
+		if err != nil {
+			return ids, err
+		}
+	}
+
+	// A slash command answered with only a card or files
+	c.dropCommand(ctx, channelID)
+
+	return ids, nil
+}
+
+// DeleteMessage deletes a message sent by the bot
+func (c *DiscordChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	return c.session.ChannelMessageDelete(chatID, messageID, discordgo.WithContext(ctx))
+}
+
+// EditMessage replaces the text of a message sent by the bot
+func (c *DiscordChannel) EditMessage(ctx context.Context, chatID, messageID string, msg bus.OutboundMessage) error {
+	content := msg.Content
+	if !msg.Formatted {
+		content = format.Convert(content, c.markup)
+	}
+	if len(content) > discordChunkSize {
+		return fmt.Errorf("message of %d characters does not fit one discord message", len(content))
+	}
+	_, err := c.session.ChannelMessageEdit(chatID, messageID, content, discordgo.WithContext(ctx))
+	return err
 }
 
 // splitMessage splits long messages into chunks, preserving code block integrity
@@ -243,25 +337,39 @@ func findLastSpace(s string, searchWindow int) int {
 	return -1
 }
 
-func (c *DiscordChannel) sendChunk(ctx context.Context, channelID, content string) error {
+// sendChunk sends text, replacing the deferred response of a slash command
+// in the chat if there is one
+func (c *DiscordChannel) sendChunk(ctx context.Context, channelID, content string) (string, error) {
+	if id, ok := c.answerCommand(ctx, channelID, content); ok {
+		return id, nil
+	}
+	return c.sendComplex(ctx, channelID, &discordgo.MessageSend{Content: content})
+}
+
+// sendComplex sends a message and returns its ID
+func (c *DiscordChannel) sendComplex(ctx context.Context, channelID string, data *discordgo.MessageSend) (string, error) {
 	// 使用传入的 ctx 进行超时控制
 	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
 	defer cancel()
 
-	done := make(chan error, 1)
+	type result struct {
+		msg *discordgo.Message
+		err error
+	}
+	done := make(chan result, 1)
 	go func() {
-		_, err := c.session.ChannelMessageSend(channelID, content)
-		done <- err
+		msg, err := c.session.ChannelMessageSendComplex(channelID, data)
+		done <- result{msg, err}
 	}()
 
 	select {
-	case err := <-done:
-		if err != nil {
-			return fmt.Errorf("failed to send discord message: %w", err)
+	case res := <-done:
+		if res.err != nil {
+			return "", fmt.Errorf("failed to send discord message: %w", res.err)
 		}
-		return nil
+		return res.msg.ID, nil
 	case <-sendCtx.Done():
-		return fmt.Errorf("send message timeout: %w", sendCtx.Err())
+		return "", fmt.Errorf("send message timeout: %w", sendCtx.Err())
 	}
 }
 
@@ -289,7 +397,7 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 	}
 
 	// 检查白名单，避免为被拒绝的用户下载附件和转录
-	if !c.IsAllowed(m.Author.ID) {
+	if !c.IsAllowed(m.Author.ID) || !c.guildAllows(m.GuildID, m.ChannelID, m.Author.ID) {
 		logger.DebugCF("discord", "Message rejected by allowlist", map[string]any{
 			"user_id": m.Author.ID,
 		})
@@ -306,7 +414,7 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 	mediaPaths := make([]string, 0, len(m.Attachments))
 	localFiles := make([]string, 0, len(m.Attachments))
 
-	// 确保临时文件在函数返回时被清理
+	// 确保临时文件在函数返回时被清理; files in the media directory are kept
 	defer func() {
 		for _, file := range localFiles {
 			if err := os.Remove(file); err != nil {
@@ -324,7 +432,11 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		if isAudio {
 			localPath := c.downloadAttachment(attachment.URL, attachment.Filename)
 			if localPath != "" {
-				localFiles = append(localFiles, localPath)
+				if c.mediaDir == "" {
+					localFiles = append(localFiles, localPath)
+				} else {
+					mediaPaths = append(mediaPaths, localPath)
+				}
 
 				transcribedText := ""
 				if c.transcriber != nil && c.transcriber.IsAvailable() {
@@ -356,6 +468,9 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 				mediaPaths = append(mediaPaths, attachment.URL)
 				content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
 			}
+		} else if localPath := c.keepAttachment(attachment.URL, attachment.Filename); localPath != "" {
+			mediaPaths = append(mediaPaths, localPath)
+			content = appendContent(content, fmt.Sprintf("[attachment: %s]", localPath))
 		} else {
 			mediaPaths = append(mediaPaths, attachment.URL)
 			content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
@@ -386,11 +501,93 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		"is_dm":        fmt.Sprintf("%t", m.GuildID == ""),
 	}
 
-	c.HandleMessage(senderID, m.ChannelID, content, mediaPaths, metadata)
+	// Threads are channels of their own, so replies and sessions follow them
+	chatID := m.ChannelID
+	if c.config.ReplyInThreads && m.GuildID != "" && c.threadParent(m.ChannelID) == "" {
+		if threadID, err := c.startThread(m); err != nil {
+			logger.WarnCF("discord", "Failed to start thread, replying in the channel", map[string]any{
+				"channel_id": m.ChannelID,
+				"error":      err.Error(),
+			})
+		} else {
+			chatID = threadID
+			metadata["thread_id"] = threadID
+		}
+	}
+
+	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+}
+
+// handleInteraction turns presses of card reply buttons into messages from
+// the user who pressed them
+func (c *DiscordChannel) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i == nil {
+		return
+	}
+	if i.Type == discordgo.InteractionApplicationCommand {
+		c.handleCommand(s, i)
+		return
+	}
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	reply, ok := strings.CutPrefix(i.MessageComponentData().CustomID, discordCardButtonPrefix)
+	if !ok || reply == "" {
+		return
+	}
+
+	// Acknowledge the press, the reply arrives as a new message
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		logger.DebugCF("discord", "Failed to acknowledge button press", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return
+	}
+	if !c.IsAllowed(user.ID) || !c.guildAllows(i.GuildID, i.ChannelID, user.ID) {
+		logger.DebugCF("discord", "Button press rejected by allowlist", map[string]any{
+			"user_id": user.ID,
+		})
+		return
+	}
+
+	logger.DebugCF("discord", "Card button pressed", map[string]any{
+		"sender_id": user.ID,
+		"reply":     utils.Truncate(reply, 50),
+	})
+
+	metadata := map[string]string{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"guild_id":   i.GuildID,
+		"channel_id": i.ChannelID,
+		"is_dm":      fmt.Sprintf("%t", i.GuildID == ""),
+	}
+
+	c.HandleMessage(user.ID, i.ChannelID, reply, nil, choiceMetadata(metadata, reply, discordButtonLabel(i.Message, reply)))
 }
 
 func (c *DiscordChannel) downloadAttachment(url, filename string) string {
 	return utils.DownloadFile(url, filename, utils.DownloadOptions{
 		LoggerPrefix: "discord",
+		Dir:          c.mediaDir,
 	})
 }
+
+// keepAttachment downloads an attachment to the media directory and
+// returns its path, or "" without one or when the download fails
+func (c *DiscordChannel) keepAttachment(url, filename string) string {
+	if c.mediaDir == "" {
+		return ""
+	}
+	return c.downloadAttachment(url, filename)
+}
@@ -0,0 +1,110 @@
+package channels
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+// Discord embed and component limits
+const (
+	discordMaxEmbedFields = 25
+	discordButtonsPerRow  = 5
+	discordMaxButtonRows  = 5
+	discordMaxCustomID    = 100
+)
+
+// discordCardButtonPrefix prefixes the custom IDs of card reply buttons,
+// followed by the reply
+const discordCardButtonPrefix = "card:"
+
+// discordCard renders a card as an embed with link and reply buttons. Text
+// is converted to markup; buttons that do not fit are listed in the
+// description.
+func discordCard(card *bus.Card, markup format.Style) *discordgo.MessageSend {
+	embed := &discordgo.MessageEmbed{Title: card.Title}
+	for i, f := range card.Fields {
+		if i == discordMaxEmbedFields {
+			break
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   f.Label,
+			Value:  format.Convert(f.Value, markup),
+			Inline: true,
+		})
+	}
+	if card.ImageURL != "" {
+		embed.Image = &discordgo.MessageEmbedImage{URL: card.ImageURL}
+	}
+
+	var buttons []discordgo.MessageComponent
+	var leftover []string
+	for _, b := range card.Buttons {
+		button := discordgo.Button{Label: b.Label}
+		switch reply := cardButtonReply(b); {
+		case len(buttons) == discordButtonsPerRow*discordMaxButtonRows:
+			leftover = append(leftover, "- "+cardButtonText(b))
+			continue
+		case b.URL != "":
+			button.Style = discordgo.LinkButton
+			button.URL = b.URL
+		case len(discordCardButtonPrefix)+len(reply) <= discordMaxCustomID:
+			button.Style = discordgo.PrimaryButton
+			button.CustomID = discordCardButtonPrefix + reply
+		default:
+			leftover = append(leftover, "- "+cardButtonText(b))
+			continue
+		}
+		buttons = append(buttons, button)
+	}
+
+	description := card.Text
+	if len(leftover) > 0 {
+		description = strings.TrimSpace(description + "\n\n" + strings.Join(leftover, "\n"))
+	}
+	embed.Description = format.Convert(description, markup)
+
+	send := &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}
+	for start := 0; start < len(buttons); start += discordButtonsPerRow {
+		end := min(start+discordButtonsPerRow, len(buttons))
+		send.Components = append(send.Components, discordgo.ActionsRow{Components: buttons[start:end]})
+	}
+	return send
+}
+
+// discordButtonLabel finds the label of the card reply button with reply
+// on msg, or "" if it is not there
+func discordButtonLabel(msg *discordgo.Message, reply string) string {
+	if msg == nil {
+		return ""
+	}
+	for _, component := range msg.Components {
+		var row discordgo.ActionsRow
+		switch r := component.(type) {
+		case *discordgo.ActionsRow:
+			row = *r
+		case discordgo.ActionsRow:
+			row = r
+		default:
+			continue
+		}
+		for _, c := range row.Components {
+			var button discordgo.Button
+			switch b := c.(type) {
+			case *discordgo.Button:
+				button = *b
+			case discordgo.Button:
+				button = b
+			default:
+				continue
+			}
+			if button.CustomID == discordCardButtonPrefix+reply {
+				return button.Label
+			}
+		}
+	}
+	return ""
+}
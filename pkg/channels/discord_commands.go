@@ -0,0 +1,208 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// discordInteractionTTL is how long Discord accepts edits of an
+// interaction response
+const discordInteractionTTL = 15 * time.Minute
+
+// discordCommands are the slash commands registered with slash_commands.
+// /ask sends its prompt to the agent, the others the text command of the
+// same name.
+var discordCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "ask",
+		Description: "Ask the assistant",
+		Options: []*discordgo.ApplicationCommandOption{{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "prompt",
+			Description: "What to ask",
+			Required:    true,
+		}},
+	},
+	{
+		Name:        "show",
+		Description: "Show the current model or channel",
+		Options: []*discordgo.ApplicationCommandOption{{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "target",
+			Description: "What to show",
+			Required:    true,
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "model", Value: "model"},
+				{Name: "channel", Value: "channel"},
+			},
+		}},
+	},
+	{
+		Name:        "list",
+		Description: "List the available models or channels",
+		Options: []*discordgo.ApplicationCommandOption{{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "target",
+			Description: "What to list",
+			Required:    true,
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "models", Value: "models"},
+				{Name: "channels", Value: "channels"},
+			},
+		}},
+	},
+}
+
+// pendingInteraction is a deferred slash command response, which the
+// first reply to its chat replaces
+type pendingInteraction struct {
+	interaction *discordgo.Interaction
+	at          time.Time
+}
+
+// discordCommandContent turns a slash command into the message the agent
+// receives
+func discordCommandContent(data discordgo.ApplicationCommandInteractionData) string {
+	var args []string
+	for _, opt := range data.Options {
+		if opt.Type == discordgo.ApplicationCommandOptionString {
+			args = append(args, opt.StringValue())
+		}
+	}
+	if data.Name == "ask" {
+		return strings.TrimSpace(strings.Join(args, " "))
+	}
+	return strings.TrimSpace("/" + data.Name + " " + strings.Join(args, " "))
+}
+
+// registerCommands registers the slash commands in the configured servers,
+// where they appear at once, or globally when there are none
+func (c *DiscordChannel) registerCommands() error {
+	guildIDs := []string{""}
+	if len(c.config.Guilds) > 0 {
+		guildIDs = guildIDs[:0]
+		for id := range c.config.Guilds {
+			guildIDs = append(guildIDs, id)
+		}
+	}
+	appID := c.session.State.User.ID
+	for _, guildID := range guildIDs {
+		if _, err := c.session.ApplicationCommandBulkOverwrite(appID, guildID, discordCommands); err != nil {
+			return fmt.Errorf("registering slash commands in guild %q: %w", guildID, err)
+		}
+	}
+	return nil
+}
+
+// handleCommand hands a slash command to the agent. The response is
+// deferred until the reply arrives, which then replaces it.
+func (c *DiscordChannel) handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return
+	}
+
+	if !c.IsAllowed(user.ID) || !c.guildAllows(i.GuildID, i.ChannelID, user.ID) {
+		logger.DebugCF("discord", "Slash command rejected by allowlist", map[string]any{
+			"user_id": user.ID,
+		})
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "You are not allowed to use this bot here.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			logger.DebugCF("discord", "Failed to answer slash command", map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	content := discordCommandContent(data)
+	if content == "" {
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		logger.ErrorCF("discord", "Failed to acknowledge slash command", map[string]any{
+			"command": data.Name,
+			"error":   err.Error(),
+		})
+	} else {
+		c.interactions.Store(i.ChannelID, pendingInteraction{interaction: i.Interaction, at: time.Now()})
+	}
+
+	logger.DebugCF("discord", "Slash command", map[string]any{
+		"sender_id": user.ID,
+		"command":   data.Name,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	metadata := map[string]string{
+		"message_id": i.ID,
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"guild_id":   i.GuildID,
+		"channel_id": i.ChannelID,
+		"is_dm":      fmt.Sprintf("%t", i.GuildID == ""),
+		"command":    data.Name,
+	}
+	c.HandleMessage(user.ID, i.ChannelID, content, nil, metadata)
+}
+
+// answerCommand replaces the deferred response of a slash command in the
+// chat with content. It reports false when there is none to replace.
+func (c *DiscordChannel) answerCommand(ctx context.Context, chatID, content string) (string, bool) {
+	v, ok := c.interactions.LoadAndDelete(chatID)
+	if !ok {
+		return "", false
+	}
+	pending := v.(pendingInteraction)
+	if time.Since(pending.at) > discordInteractionTTL {
+		return "", false
+	}
+	msg, err := c.session.InteractionResponseEdit(pending.interaction, &discordgo.WebhookEdit{Content: &content},
+		discordgo.WithContext(ctx))
+	if err != nil {
+		logger.DebugCF("discord", "Failed to answer slash command", map[string]any{
+			"error": err.Error(),
+		})
+		return "", false
+	}
+	return msg.ID, true
+}
+
+// dropCommand deletes the deferred response of a slash command in the chat
+// when the reply had no text to replace it with
+func (c *DiscordChannel) dropCommand(ctx context.Context, chatID string) {
+	v, ok := c.interactions.LoadAndDelete(chatID)
+	if !ok {
+		return
+	}
+	pending := v.(pendingInteraction)
+	if time.Since(pending.at) > discordInteractionTTL {
+		return
+	}
+	if err := c.session.InteractionResponseDelete(pending.interaction, discordgo.WithContext(ctx)); err != nil {
+		logger.DebugCF("discord", "Failed to delete slash command response", map[string]any{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDiscordCommandContent(t *testing.T) {
+	option := func(name, value string) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{
+			Name:  name,
+			Type:  discordgo.ApplicationCommandOptionString,
+			Value: value,
+		}
+	}
+
+	tests := []struct {
+		data discordgo.ApplicationCommandInteractionData
+		want string
+	}{
+		{discordgo.ApplicationCommandInteractionData{Name: "ask", Options: []*discordgo.ApplicationCommandInteractionDataOption{option("prompt", " What's the weather? ")}}, "What's the weather?"},
+		{discordgo.ApplicationCommandInteractionData{Name: "show", Options: []*discordgo.ApplicationCommandInteractionDataOption{option("target", "model")}}, "/show model"},
+		{discordgo.ApplicationCommandInteractionData{Name: "list"}, "/list"},
+	}
+	for _, tt := range tests {
+		if got := discordCommandContent(tt.data); got != tt.want {
+			t.Errorf("discordCommandContent(/%s) = %q, want %q", tt.data.Name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package channels
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// discordIntents are the gateway events the channel needs: server and
+// direct messages with their text, and servers for the channel and
+// thread cache
+const discordIntents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages |
+	discordgo.IntentsDirectMessages | discordgo.IntentsMessageContent
+
+// Discord thread limits
+const (
+	discordMaxThreadName     = 100
+	discordThreadArchiveMins = 1440
+)
+
+// discordGuild is the access config of a server
+type discordGuild struct {
+	allowFrom accessList
+	channels  map[string]bool // Empty allows every channel
+}
+
+// discordGuilds maps guild IDs to their access config. An empty map
+// allows every server.
+type discordGuilds map[string]discordGuild
+
+func newDiscordGuilds(cfg map[string]config.DiscordGuildConfig) discordGuilds {
+	guilds := make(discordGuilds, len(cfg))
+	for id, g := range cfg {
+		guild := discordGuild{
+			allowFrom: newAccessList("discord", g.AllowFrom),
+			channels:  make(map[string]bool, len(g.Channels)),
+		}
+		for _, channel := range g.Channels {
+			guild.channels[strings.TrimSpace(channel)] = true
+		}
+		guilds[id] = guild
+	}
+	return guilds
+}
+
+// allows reports whether userID may use the bot in a channel of guildID.
+// Threads pass their parent channel too, so they inherit its access.
+// Direct messages (no guild) are left to allow_from.
+func (g discordGuilds) allows(guildID, userID string, channelIDs ...string) bool {
+	if guildID == "" || len(g) == 0 {
+		return true
+	}
+	guild, ok := g[guildID]
+	if !ok {
+		return false
+	}
+	if len(guild.channels) > 0 {
+		found := false
+		for _, id := range channelIDs {
+			if guild.channels[id] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return len(guild.allowFrom) == 0 || guild.allowFrom.matchesSender(userID)
+}
+
+// guildAllows applies the server access config to userID in channelID.
+// The parent of a thread is only looked up when channels are restricted.
+func (c *DiscordChannel) guildAllows(guildID, channelID, userID string) bool {
+	if guild, ok := c.guilds[guildID]; ok && len(guild.channels) > 0 && !guild.channels[channelID] {
+		return c.guilds.allows(guildID, userID, c.threadParent(channelID))
+	}
+	return c.guilds.allows(guildID, userID, channelID)
+}
+
+// threadParent returns the channel the thread channelID belongs to, or ""
+// when it is not a thread
+func (c *DiscordChannel) threadParent(channelID string) string {
+	ch, err := c.session.State.Channel(channelID)
+	if err != nil {
+		if ch, err = c.session.Channel(channelID); err != nil {
+			logger.DebugCF("discord", "Failed to look up channel", map[string]any{
+				"channel_id": channelID,
+				"error":      err.Error(),
+			})
+			return ""
+		}
+	}
+	if !ch.IsThread() {
+		return ""
+	}
+	return ch.ParentID
+}
+
+// startThread starts a thread on m, named after its text, and returns its
+// channel ID
+func (c *DiscordChannel) startThread(m *discordgo.MessageCreate) (string, error) {
+	thread, err := c.session.MessageThreadStartComplex(m.ChannelID, m.ID, &discordgo.ThreadStart{
+		Name:                discordThreadName(m.Content),
+		AutoArchiveDuration: discordThreadArchiveMins,
+	})
+	if err != nil {
+		return "", err
+	}
+	return thread.ID, nil
+}
+
+// discordThreadName is the first line of content, shortened to fit
+func discordThreadName(content string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	if name == "" {
+		return "Conversation"
+	}
+	return utils.Truncate(name, discordMaxThreadName)
+}
@@ -0,0 +1,53 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestDiscordGuildsAllows(t *testing.T) {
+	guilds := newDiscordGuilds(map[string]config.DiscordGuildConfig{
+		"g1": {AllowFrom: []string{"alice", "re:^4[0-9]$"}, Channels: []string{"general"}},
+		"g2": {},
+	})
+
+	tests := []struct {
+		name     string
+		guildID  string
+		userID   string
+		channels []string
+		want     bool
+	}{
+		{"direct message", "", "anyone", []string{"dm"}, true},
+		{"allowed user and channel", "g1", "alice", []string{"general"}, true},
+		{"pattern user", "g1", "42", []string{"general"}, true},
+		{"other user", "g1", "bob", []string{"general"}, false},
+		{"other channel", "g1", "alice", []string{"random"}, false},
+		{"thread of allowed channel", "g1", "alice", []string{"thread", "general"}, true},
+		{"open guild", "g2", "bob", []string{"random"}, true},
+		{"unlisted guild", "g3", "alice", []string{"general"}, false},
+	}
+	for _, tt := range tests {
+		if got := guilds.allows(tt.guildID, tt.userID, tt.channels...); got != tt.want {
+			t.Errorf("%s: allows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if !discordGuilds(nil).allows("any", "anyone", "channel") {
+		t.Error("without guild config every server should be allowed")
+	}
+}
+
+func TestDiscordThreadName(t *testing.T) {
+	if got := discordThreadName("  How do I deploy?\nMore details"); got != "How do I deploy?" {
+		t.Errorf("thread name = %q", got)
+	}
+	if got := discordThreadName(""); got != "Conversation" {
+		t.Errorf("empty thread name = %q", got)
+	}
+	if got := discordThreadName(strings.Repeat("x", 300)); len([]rune(got)) != discordMaxThreadName {
+		t.Errorf("long thread name has %d runes, want %d", len([]rune(got)), discordMaxThreadName)
+	}
+}
@@ -0,0 +1,69 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+// SetMediaDir makes the channel download incoming attachments to dir,
+// where the agent can read them later. Without it the agent gets their
+// URLs and only audio is downloaded, to a temporary directory.
+func (c *DiscordChannel) SetMediaDir(dir string) {
+	c.mediaDir = dir
+}
+
+// sendAttachment sends a file with its caption as the message text and
+// returns the IDs of the messages that carry it. Remote files are linked,
+// Discord shows a preview; captions too long for one message go ahead of
+// the file.
+func (c *DiscordChannel) sendAttachment(ctx context.Context, channelID string, att bus.Attachment, formatted bool) ([]string, error) {
+	caption := att.Caption
+	if !formatted {
+		caption = format.Convert(caption, c.markup)
+	}
+
+	var data *discordgo.MessageSend
+	switch {
+	case att.Path != "":
+		f, err := os.Open(att.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: attachment: %v", errs.ErrValidation, err)
+		}
+		defer f.Close()
+		data = &discordgo.MessageSend{Files: []*discordgo.File{{
+			Name:        filepath.Base(att.Path),
+			ContentType: att.MimeType,
+			Reader:      f,
+		}}}
+	case att.URL != "":
+		data = &discordgo.MessageSend{Content: att.URL}
+	default:
+		return nil, fmt.Errorf("%w: attachment has neither path nor url", errs.ErrValidation)
+	}
+
+	var ids []string
+	if content := appendContent(caption, data.Content); len(content) <= discordMaxContent {
+		data.Content = content
+	} else if caption != "" {
+		for _, chunk := range splitMessage(caption, discordChunkSize) {
+			id, err := c.sendChunk(ctx, channelID, chunk)
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, id)
+		}
+	}
+	id, err := c.sendComplex(ctx, channelID, data)
+	if err != nil {
+		return ids, err
+	}
+	return append(ids, id), nil
+}
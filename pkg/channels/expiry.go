@@ -0,0 +1,149 @@
+package channels
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// expiryCheckInterval is how often expired messages are deleted
+const expiryCheckInterval = 15 * time.Second
+
+// deletingChannel is implemented by channels that can delete the messages
+// they send. SendMessages sends like Send and returns the platform IDs of
+// the messages it posted.
+type deletingChannel interface {
+	SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error)
+	DeleteMessage(ctx context.Context, chatID, messageID string) error
+}
+
+// appendID appends id to ids unless it is empty
+func appendID(ids []string, id string) []string {
+	if id == "" {
+		return ids
+	}
+	return append(ids, id)
+}
+
+// expiringMessage is a sent message to delete at a given time
+type expiringMessage struct {
+	channel   string
+	chatID    string
+	messageID string
+	at        time.Time
+}
+
+// expiryQueue holds the sent messages waiting to be deleted. It lives in
+// memory: the manager deletes whatever is left when it stops.
+type expiryQueue struct {
+	mu      sync.Mutex
+	pending []expiringMessage
+}
+
+// add schedules the deletion of messages after ttl
+func (q *expiryQueue) add(channel, chatID string, messageIDs []string, ttl time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	at := time.Now().Add(ttl)
+	for _, id := range messageIDs {
+		q.pending = append(q.pending, expiringMessage{channel: channel, chatID: chatID, messageID: id, at: at})
+	}
+}
+
+// due removes and returns the messages whose time has come by now
+func (q *expiryQueue) due(now time.Time) []expiringMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []expiringMessage
+	kept := q.pending[:0]
+	for _, msg := range q.pending {
+		if msg.at.After(now) {
+			kept = append(kept, msg)
+		} else {
+			due = append(due, msg)
+		}
+	}
+	q.pending = kept
+	return due
+}
+
+// takeAll removes and returns every pending message
+func (q *expiryQueue) takeAll() []expiringMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	all := q.pending
+	q.pending = nil
+	return all
+}
+
+// messageTTL returns how long msg stays up before it is deleted: its own
+// TTL, or else the TTL configured for its chat. Zero keeps it.
+func (m *Manager) messageTTL(msg bus.OutboundMessage) time.Duration {
+	if msg.TTLSeconds > 0 {
+		return time.Duration(msg.TTLSeconds) * time.Second
+	}
+	minutes := m.config.Channels.MessageTTL.Chats[msg.Channel+":"+msg.ChatID]
+	return time.Duration(minutes) * time.Minute
+}
+
+// sendExpiring sends msg through a channel that can delete it and schedules
+// the deletion. Channels without deletion send it as usual, with a warning.
+func (m *Manager) sendExpiring(ctx context.Context, channel Channel, msg bus.OutboundMessage, ttl time.Duration) error {
+	dc, ok := channel.(deletingChannel)
+	if !ok {
+		logger.WarnCF("channels", "Channel cannot delete messages, sending without TTL", map[string]interface{}{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+		})
+		return channel.Send(ctx, msg)
+	}
+
+	// Parts sent before a failure are deleted all the same
+	ids, err := dc.SendMessages(ctx, msg)
+	m.expiry.add(msg.Channel, msg.ChatID, ids, ttl)
+	return err
+}
+
+// runExpiry deletes expired messages until ctx is done
+func (m *Manager) runExpiry(ctx context.Context) {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if due := m.expiry.due(now); len(due) > 0 {
+				m.mu.RLock()
+				m.deleteMessages(ctx, due)
+				m.mu.RUnlock()
+			}
+		}
+	}
+}
+
+// deleteMessages deletes sent messages, logging failures. The caller holds m.mu.
+func (m *Manager) deleteMessages(ctx context.Context, messages []expiringMessage) {
+	for _, msg := range messages {
+		channel, ok := m.channels[msg.channel]
+		dc, deletes := channel.(deletingChannel)
+		if !ok || !deletes {
+			continue
+		}
+		if err := dc.DeleteMessage(ctx, msg.chatID, msg.messageID); err != nil {
+			logger.WarnCF("channels", "Failed to delete expired message", map[string]interface{}{
+				"channel":    msg.channel,
+				"chat_id":    msg.chatID,
+				"message_id": msg.messageID,
+				"error":      err.Error(),
+			})
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// deletingRecorder is a recordingChannel that can delete what it sent
+type deletingRecorder struct {
+	*recordingChannel
+	deleted []string
+}
+
+func (c *deletingRecorder) SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error) {
+	c.Send(ctx, msg)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return []string{fmt.Sprintf("m%d", len(c.sent))}, nil
+}
+
+func (c *deletingRecorder) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deleted = append(c.deleted, chatID+"/"+messageID)
+	return nil
+}
+
+func TestExpiryQueue(t *testing.T) {
+	var q expiryQueue
+	q.add("telegram", "42", []string{"1", "2"}, time.Minute)
+	q.add("telegram", "42", []string{"3"}, time.Hour)
+
+	if due := q.due(time.Now()); len(due) != 0 {
+		t.Errorf("nothing should be due yet, got %v", due)
+	}
+	due := q.due(time.Now().Add(2 * time.Minute))
+	if len(due) != 2 || due[0].messageID != "1" || due[1].messageID != "2" {
+		t.Errorf("unexpected due messages %v", due)
+	}
+	if rest := q.takeAll(); len(rest) != 1 || rest[0].messageID != "3" {
+		t.Errorf("unexpected pending messages %v", rest)
+	}
+}
+
+func TestManagerMessageTTL(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := &deletingRecorder{recordingChannel: &recordingChannel{BaseChannel: NewBaseChannel("test", nil, mb, nil)}}
+	plain := &recordingChannel{BaseChannel: NewBaseChannel("plain", nil, mb, nil)}
+	cfg := &config.Config{}
+	cfg.Channels.MessageTTL.Chats = map[string]int{"test:vault": 5}
+	m := &Manager{
+		channels: map[string]Channel{"test": ch, "plain": plain},
+		bus:      mb,
+		config:   cfg,
+	}
+
+	ctx := context.Background()
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "hello"})
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "code 1234", TTLSeconds: 60})
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "vault", Content: "secret"})
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "plain", ChatID: "chat", Content: "code 5678", TTLSeconds: 60})
+
+	if len(plain.sent) != 1 {
+		t.Error("channels without deletion should still get the message")
+	}
+
+	due := m.expiry.due(time.Now().Add(2 * time.Minute))
+	if len(due) != 1 || due[0].chatID != "chat" || due[0].messageID != "m2" {
+		t.Fatalf("expected the per-message TTL to expire first, got %v", due)
+	}
+
+	// Stopping deletes what is still pending
+	m.StopAll(ctx)
+	if len(ch.deleted) != 1 || ch.deleted[0] != "vault/m3" {
+		t.Errorf("expected the chat TTL message to be deleted on stop, got %v", ch.deleted)
+	}
+}
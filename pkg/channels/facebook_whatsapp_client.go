@@ -1,22 +1,16 @@
 package channels
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"time"
+	"net/url"
 )
 
 // FacebookWhatsAppClient handles WhatsApp Business API through Facebook Graph API
 type FacebookWhatsAppClient struct {
 	phoneNumberID string
-	accessToken   string
-	apiVersion    string
-	httpClient    *http.Client
-	baseURL       string
+	graph         *graphClient
 }
 
 // FacebookMessageRequest represents the message structure for Facebook WhatsApp API
@@ -30,6 +24,34 @@ type FacebookMessageRequest struct {
 	Audio            *FacebookMediaMessage  `json:"audio,omitempty"`
 	Video            *FacebookMediaMessage  `json:"video,omitempty"`
 	Document         *FacebookMediaMessage  `json:"document,omitempty"`
+	Reaction         *FacebookReaction      `json:"reaction,omitempty"`
+	Location         *FacebookLocation      `json:"location,omitempty"`
+	Contacts         []FacebookContact      `json:"contacts,omitempty"`
+	Context          *FacebookContext       `json:"context,omitempty"`
+}
+
+// FacebookContext references the message being replied to
+type FacebookContext struct {
+	MessageID string `json:"message_id"`
+}
+
+// FacebookReaction represents an emoji reaction to a message
+type FacebookReaction struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// FacebookStatusRequest updates the status of a received message (read receipts, typing)
+type FacebookStatusRequest struct {
+	MessagingProduct string                   `json:"messaging_product"`
+	Status           string                   `json:"status"`
+	MessageID        string                   `json:"message_id"`
+	TypingIndicator  *FacebookTypingIndicator `json:"typing_indicator,omitempty"`
+}
+
+// FacebookTypingIndicator represents a typing indicator attached to a status update
+type FacebookTypingIndicator struct {
+	Type string `json:"type"`
 }
 
 // FacebookTemplate represents a template message
@@ -69,6 +91,41 @@ type FacebookMediaMessage struct {
 	Caption string `json:"caption,omitempty"`
 }
 
+// FacebookLocation represents a location message
+type FacebookLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// FacebookContact represents a contact card of a contacts message
+type FacebookContact struct {
+	Name   FacebookContactName    `json:"name"`
+	Phones []FacebookContactPhone `json:"phones,omitempty"`
+	Emails []FacebookContactEmail `json:"emails,omitempty"`
+}
+
+// FacebookContactName is the name of a contact. The API requires
+// formatted_name and one of the name parts.
+type FacebookContactName struct {
+	FormattedName string `json:"formatted_name"`
+	FirstName     string `json:"first_name,omitempty"`
+	LastName      string `json:"last_name,omitempty"`
+}
+
+// FacebookContactPhone is a phone number of a contact
+type FacebookContactPhone struct {
+	Phone string `json:"phone"`
+	Type  string `json:"type,omitempty"`
+}
+
+// FacebookContactEmail is an email address of a contact
+type FacebookContactEmail struct {
+	Email string `json:"email"`
+	Type  string `json:"type,omitempty"`
+}
+
 // FacebookMessageResponse represents the API response
 type FacebookMessageResponse struct {
 	MessagingProduct string   `json:"messaging_product"`
@@ -103,18 +160,9 @@ type FacebookError struct {
 
 // NewFacebookWhatsAppClient creates a new Facebook WhatsApp client
 func NewFacebookWhatsAppClient(phoneNumberID, accessToken, apiVersion string) *FacebookWhatsAppClient {
-	if apiVersion == "" {
-		apiVersion = "v22.0"
-	}
-	
 	return &FacebookWhatsAppClient{
 		phoneNumberID: phoneNumberID,
-		accessToken:   accessToken,
-		apiVersion:    apiVersion,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		baseURL: "https://graph.facebook.com",
+		graph:         newGraphClient(accessToken, apiVersion),
 	}
 }
 
@@ -148,72 +196,104 @@ func (c *FacebookWhatsAppClient) SendTextMessage(ctx context.Context, to, text s
 	return c.sendMessage(ctx, message)
 }
 
-// sendMessage sends the actual message to Facebook API
-func (c *FacebookWhatsAppClient) sendMessage(ctx context.Context, message FacebookMessageRequest) error {
-	url := fmt.Sprintf("%s/%s/%s/messages", c.baseURL, c.apiVersion, c.phoneNumberID)
-	
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+// SendTextReply sends a text message quoting the message with the given ID
+func (c *FacebookWhatsAppClient) SendTextReply(ctx context.Context, to, text, replyToID string) error {
+	message := FacebookMessageRequest{
+		MessagingProduct: "whatsapp",
+		To:               to,
+		Type:             "text",
+		Text: &FacebookTextMessage{
+			Body: text,
+		},
+		Context: &FacebookContext{
+			MessageID: replyToID,
+		},
 	}
-	
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+
+	return c.sendMessage(ctx, message)
+}
+
+// SendReaction reacts to a message with an emoji. An empty emoji removes the reaction.
+func (c *FacebookWhatsAppClient) SendReaction(ctx context.Context, to, messageID, emoji string) error {
+	message := FacebookMessageRequest{
+		MessagingProduct: "whatsapp",
+		To:               to,
+		Type:             "reaction",
+		Reaction: &FacebookReaction{
+			MessageID: messageID,
+			Emoji:     emoji,
+		},
 	}
-	
-	req.Header.Set("Authorization", "Bearer "+c.accessToken)
-	req.Header.Set("Content-Type", "application/json")
-	
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+
+	return c.sendMessage(ctx, message)
+}
+
+// SendLocation sends a location, quoting replyToID if it is not empty
+func (c *FacebookWhatsAppClient) SendLocation(ctx context.Context, to string, location FacebookLocation, replyToID string) error {
+	message := FacebookMessageRequest{
+		MessagingProduct: "whatsapp",
+		To:               to,
+		Type:             "location",
+		Location:         &location,
 	}
-	defer resp.Body.Close()
-	
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+	if replyToID != "" {
+		message.Context = &FacebookContext{MessageID: replyToID}
 	}
-	
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		var errorResp FacebookErrorResponse
-		if err := json.Unmarshal(body, &errorResp); err != nil {
-			return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
-		}
-		return fmt.Errorf("Facebook API error: %s (type: %s, code: %d)", 
-			errorResp.Error.Message, errorResp.Error.Type, errorResp.Error.Code)
+
+	return c.sendMessage(ctx, message)
+}
+
+// SendContacts sends contact cards, quoting replyToID if it is not empty
+func (c *FacebookWhatsAppClient) SendContacts(ctx context.Context, to string, contacts []FacebookContact, replyToID string) error {
+	message := FacebookMessageRequest{
+		MessagingProduct: "whatsapp",
+		To:               to,
+		Type:             "contacts",
+		Contacts:         contacts,
 	}
-	
-	var successResp FacebookMessageResponse
-	if err := json.Unmarshal(body, &successResp); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+	if replyToID != "" {
+		message.Context = &FacebookContext{MessageID: replyToID}
 	}
-	
-	return nil
+
+	return c.sendMessage(ctx, message)
+}
+
+// MarkRead marks a received message as read
+func (c *FacebookWhatsAppClient) MarkRead(ctx context.Context, messageID string) error {
+	return c.postMessages(ctx, FacebookStatusRequest{
+		MessagingProduct: "whatsapp",
+		Status:           "read",
+		MessageID:        messageID,
+	})
+}
+
+// SendTypingIndicator shows a typing indicator in reply to a received message.
+// WhatsApp also marks the message as read and dismisses the indicator after
+// 25 seconds or when a message is sent.
+func (c *FacebookWhatsAppClient) SendTypingIndicator(ctx context.Context, messageID string) error {
+	return c.postMessages(ctx, FacebookStatusRequest{
+		MessagingProduct: "whatsapp",
+		Status:           "read",
+		MessageID:        messageID,
+		TypingIndicator:  &FacebookTypingIndicator{Type: "text"},
+	})
+}
+
+// sendMessage sends the actual message to Facebook API
+func (c *FacebookWhatsAppClient) sendMessage(ctx context.Context, message FacebookMessageRequest) error {
+	return c.postMessages(ctx, message)
+}
+
+// postMessages posts a payload to the messages endpoint of the phone number
+func (c *FacebookWhatsAppClient) postMessages(ctx context.Context, message interface{}) error {
+	var successResp FacebookMessageResponse
+	return c.graph.call(ctx, http.MethodPost, "/"+url.PathEscape(c.phoneNumberID)+"/messages", message, &successResp)
 }
 
 // ValidateCredentials validates the Facebook credentials
 func (c *FacebookWhatsAppClient) ValidateCredentials(ctx context.Context) error {
-	url := fmt.Sprintf("%s/%s/%s", c.baseURL, c.apiVersion, c.phoneNumberID)
-	
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	
-	req.Header.Set("Authorization", "Bearer "+c.accessToken)
-	
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("credential validation failed (status %d): %s", resp.StatusCode, string(body))
+	if err := c.graph.call(ctx, http.MethodGet, "/"+url.PathEscape(c.phoneNumberID), nil, nil); err != nil {
+		return fmt.Errorf("credential validation failed: %w", err)
 	}
-	
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,164 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/errs"
+)
+
+const (
+	defaultGraphAPIVersion = "v22.0"
+	defaultGraphBaseURL    = "https://graph.facebook.com"
+	graphHTTPTimeout       = 30 * time.Second
+	// graphMaxWebhookBody bounds the body of webhook requests
+	graphMaxWebhookBody = 1 << 20
+)
+
+// Graph API error codes that mean the caller should slow down: app, user
+// and page request limits, and the WhatsApp throughput and pair limits
+var graphRateLimitCodes = map[int]bool{4: true, 17: true, 32: true, 613: true, 130429: true, 131056: true}
+
+// Graph API error codes that retrying cannot fix: invalid parameters,
+// missing permissions (e.g. outside the messaging window) and recipients
+// that cannot be reached
+var graphValidationCodes = map[int]bool{10: true, 100: true, 551: true}
+
+// graphClient calls the Facebook Graph API with an access token. It is
+// shared by the WhatsApp Business client and the Messenger channel.
+type graphClient struct {
+	baseURL     string
+	apiVersion  string
+	accessToken string
+	httpClient  *http.Client
+}
+
+// newGraphClient creates a client for apiVersion, v22.0 if empty
+func newGraphClient(accessToken, apiVersion string) *graphClient {
+	if apiVersion == "" {
+		apiVersion = defaultGraphAPIVersion
+	}
+	return &graphClient{
+		baseURL:     defaultGraphBaseURL,
+		apiVersion:  apiVersion,
+		accessToken: accessToken,
+		httpClient:  &http.Client{Timeout: graphHTTPTimeout},
+	}
+}
+
+// call sends a request with a JSON body, if in is not nil, and decodes the
+// JSON response into out, if it is not nil. path is relative to the
+// versioned API root, e.g. "/me/messages".
+func (g *graphClient) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	return g.request(ctx, method, path, "application/json", body, out)
+}
+
+// request sends an authenticated request. Error responses become errors
+// classified for the delivery retries: rate limits carry the delay asked
+// for and rejected requests are not retried.
+func (g *graphClient) request(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+"/"+g.apiVersion+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+g.accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return graphError(resp.StatusCode, resp.Header, data)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// graphError turns an error response into an error, classified by HTTP
+// status first and Graph error code second
+func graphError(status int, header http.Header, body []byte) error {
+	var errorResp FacebookErrorResponse
+	parsed := json.Unmarshal(body, &errorResp) == nil && errorResp.Error.Message != ""
+	apiErr := errorResp.Error
+
+	err := fmt.Errorf("API error (status %d): %s", status, string(body))
+	if parsed {
+		err = fmt.Errorf("Facebook API error: %s (type: %s, code: %d)", apiErr.Message, apiErr.Type, apiErr.Code)
+	}
+	retryAfter := header.Get("Retry-After")
+	if classified := errs.FromHTTPStatus(status, retryAfter, err); classified != nil {
+		return classified
+	}
+	switch {
+	case !parsed:
+	case graphRateLimitCodes[apiErr.Code]:
+		return &errs.RateLimitError{RetryAfter: errs.ParseRetryAfter(retryAfter, time.Now()), Err: err}
+	case graphValidationCodes[apiErr.Code]:
+		return fmt.Errorf("%w: %w", errs.ErrValidation, err)
+	}
+	return err
+}
+
+// verifyGraphSubscription answers the GET request Facebook sends when a
+// webhook is subscribed, echoing the challenge if the verify token matches
+func verifyGraphSubscription(w http.ResponseWriter, query url.Values, verifyToken string) {
+	if verifyToken == "" || query.Get("hub.mode") != "subscribe" ||
+		!hmac.Equal([]byte(query.Get("hub.verify_token")), []byte(verifyToken)) {
+		http.Error(w, "verification failed", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, query.Get("hub.challenge"))
+}
+
+// verifyGraphSignature checks the X-Hub-Signature-256 header Facebook puts
+// on webhook events, an HMAC-SHA256 of the body keyed with the app secret
+func verifyGraphSignature(body []byte, signature, appSecret string) error {
+	hexSum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return errors.New("missing sha256 signature")
+	}
+	sum, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
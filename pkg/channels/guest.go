@@ -0,0 +1,164 @@
+package channels
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MetadataGuest marks inbound messages from senders let in by a guest pass
+const MetadataGuest = "guest"
+
+// guestPass is an invitation that has not been used yet
+type guestPass struct {
+	channel string
+	expires time.Time
+}
+
+// GuestPasses hands out disposable invitations that let someone outside a
+// channel's allowlist chat with the agent until the invitation expires. Each
+// pass admits the first sender who redeems it.
+type GuestPasses struct {
+	mu     sync.Mutex
+	passes map[string]guestPass // Token -> unused pass
+	guests map[string]time.Time // channel|sender -> end of access
+	now    func() time.Time
+}
+
+func NewGuestPasses() *GuestPasses {
+	return &GuestPasses{
+		passes: make(map[string]guestPass),
+		guests: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Issue creates a pass for channel that is valid for ttl, both to redeem and
+// for the access it grants
+func (g *GuestPasses) Issue(channel string, ttl time.Duration) (string, time.Time, error) {
+	raw := make([]byte, 18)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create guest pass: %w", err)
+	}
+	// Telegram start parameters allow letters, digits, '_' and '-'
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	expires := g.now().Add(ttl)
+	g.passes[token] = guestPass{channel: channel, expires: expires}
+	return token, expires, nil
+}
+
+// Redeem admits senderID on channel with the pass token and returns when the
+// access ends. The pass is used up.
+func (g *GuestPasses) Redeem(channel, token, senderID string) (time.Time, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	pass, ok := g.passes[token]
+	if !ok || pass.channel != channel {
+		return time.Time{}, false
+	}
+	delete(g.passes, token)
+	if !g.now().Before(pass.expires) {
+		return time.Time{}, false
+	}
+	g.guests[channel+"|"+senderID] = pass.expires
+	return pass.expires, true
+}
+
+// IsGuest reports whether senderID has guest access on channel
+func (g *GuestPasses) IsGuest(channel, senderID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := channel + "|" + senderID
+	expires, ok := g.guests[key]
+	if !ok {
+		return false
+	}
+	if !g.now().Before(expires) {
+		delete(g.guests, key)
+		return false
+	}
+	return true
+}
+
+// RevokeAll drops every unused pass and ends every guest's access. It
+// returns the number of guests that were admitted.
+func (g *GuestPasses) RevokeAll() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := len(g.guests)
+	g.passes = make(map[string]guestPass)
+	g.guests = make(map[string]time.Time)
+	return n
+}
+
+// guestKeeper is implemented by channels that admit guests
+type guestKeeper interface {
+	setGuestPasses(passes *GuestPasses)
+}
+
+// guestLinker is implemented by channels that can turn a pass into a link
+// the guest opens to start chatting
+type guestLinker interface {
+	GuestLink(token string) string
+}
+
+func (c *BaseChannel) setGuestPasses(passes *GuestPasses) {
+	c.accessMu.Lock()
+	defer c.accessMu.Unlock()
+	c.guests = passes
+}
+
+// isGuest reports whether senderID is only let in by a guest pass
+func (c *BaseChannel) isGuest(senderID string) bool {
+	c.accessMu.RLock()
+	guests := c.guests
+	onAllowlist := len(c.allowList) > 0 && c.allowList.matchesSender(senderID)
+	c.accessMu.RUnlock()
+	return guests != nil && !onAllowlist && guests.IsGuest(c.name, senderID)
+}
+
+// RedeemGuestPass admits senderID with a pass token received through the
+// channel and returns when the access ends
+func (c *BaseChannel) RedeemGuestPass(senderID, token string) (time.Time, bool) {
+	c.accessMu.RLock()
+	guests := c.guests
+	c.accessMu.RUnlock()
+	if guests == nil {
+		return time.Time{}, false
+	}
+	return guests.Redeem(c.name, token, senderID)
+}
+
+// IssueGuestPass creates a pass for the named channel and returns the link
+// that redeems it and when it expires
+func (m *Manager) IssueGuestPass(channelName string, ttl time.Duration) (string, time.Time, error) {
+	m.mu.RLock()
+	channel, ok := m.channels[channelName]
+	m.mu.RUnlock()
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("channel %s is not enabled", channelName)
+	}
+	linker, ok := channel.(guestLinker)
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("channel %s has no guest links", channelName)
+	}
+
+	token, expires, err := m.guests.Issue(channelName, ttl)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return linker.GuestLink(token), expires, nil
+}
+
+// RevokeGuests ends all guest access and invalidates unused links
+func (m *Manager) RevokeGuests() int {
+	return m.guests.RevokeAll()
+}
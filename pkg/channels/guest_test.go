@@ -0,0 +1,82 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestGuestPasses(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g := NewGuestPasses()
+	g.now = func() time.Time { return now }
+
+	token, expires, err := g.Issue("telegram", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("expires = %v", expires)
+	}
+
+	if _, ok := g.Redeem("discord", token, "42"); ok {
+		t.Error("a pass should only work on its channel")
+	}
+	if _, ok := g.Redeem("telegram", token, "42"); !ok {
+		t.Fatal("expected the pass to be redeemed")
+	}
+	if _, ok := g.Redeem("telegram", token, "43"); ok {
+		t.Error("a pass should only be used once")
+	}
+	if !g.IsGuest("telegram", "42") || g.IsGuest("telegram", "43") {
+		t.Error("only the sender who redeemed the pass is a guest")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if g.IsGuest("telegram", "42") {
+		t.Error("guest access should end when the pass expires")
+	}
+
+	late, _, _ := g.Issue("telegram", time.Hour)
+	now = now.Add(2 * time.Hour)
+	if _, ok := g.Redeem("telegram", late, "44"); ok {
+		t.Error("expired passes should not be redeemed")
+	}
+}
+
+func TestBaseChannelGuests(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := NewBaseChannel("telegram", nil, mb, []string{"1"})
+	passes := NewGuestPasses()
+	ch.setGuestPasses(passes)
+
+	if ch.IsAllowed("42") {
+		t.Fatal("strangers should not be allowed")
+	}
+	token, _, _ := passes.Issue("telegram", time.Hour)
+	if _, ok := ch.RedeemGuestPass("42", token); !ok {
+		t.Fatal("expected the pass to be redeemed")
+	}
+	if !ch.IsAllowed("42") {
+		t.Fatal("guests should be allowed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ch.HandleMessage("42", "42", "hi", nil, nil)
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.Metadata[MetadataGuest] != "true" {
+		t.Errorf("guest messages should be marked, got %+v", msg)
+	}
+	ch.HandleMessage("1", "1", "hi", nil, map[string]string{})
+	msg, ok = mb.ConsumeInbound(ctx)
+	if !ok || msg.Metadata[MetadataGuest] != "" {
+		t.Errorf("allowed senders are not guests, got %+v", msg)
+	}
+
+	if passes.RevokeAll() != 1 || ch.IsAllowed("42") {
+		t.Error("revoking should end guest access")
+	}
+}
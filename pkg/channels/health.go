@@ -0,0 +1,106 @@
+package channels
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// HealthState is the connection state of a channel
+type HealthState string
+
+// Channel connection states. A channel starts Disconnected, moves through
+// Connecting to Connected, may be Degraded while its connection is alive
+// but unreliable, and ends in GivenUp when it stops reconnecting.
+const (
+	StateDisconnected HealthState = "disconnected"
+	StateConnecting   HealthState = "connecting"
+	StateConnected    HealthState = "connected"
+	StateDegraded     HealthState = "degraded"
+	StateGivenUp      HealthState = "given_up"
+)
+
+// Ready reports whether a channel in this state can deliver messages
+func (s HealthState) Ready() bool {
+	return s == StateConnected || s == StateDegraded
+}
+
+// Health is a channel's connection state and why it entered it
+type Health struct {
+	State  HealthState `json:"state"`
+	Reason string      `json:"reason,omitempty"`
+	Since  time.Time   `json:"since"`
+}
+
+func (h Health) String() string {
+	if h.Reason == "" {
+		return string(h.State)
+	}
+	return fmt.Sprintf("%s (%s)", h.State, h.Reason)
+}
+
+// EventChannelHealth is the bus event published when a channel changes
+// connection state. Its data holds the new "state", the "previous" state
+// and the "reason"; its payload is a bus.ChannelHealthEvent.
+const EventChannelHealth = bus.TopicChannelHealth
+
+// Health returns the channel's connection state
+func (c *BaseChannel) Health() Health {
+	c.healthMu.RLock()
+	defer c.healthMu.RUnlock()
+	if c.health.State == "" {
+		return Health{State: StateDisconnected}
+	}
+	return c.health
+}
+
+// reportsHealth marks the channel as tracking its connection itself, so
+// starting and stopping it no longer sets the state
+func (c *BaseChannel) reportsHealth() {
+	c.healthMu.Lock()
+	c.ownHealth = true
+	c.healthMu.Unlock()
+}
+
+// setHealth moves the channel to state and announces the transition on the
+// bus. Setting the current state again only updates the reason.
+func (c *BaseChannel) setHealth(state HealthState, reason string) {
+	c.healthMu.Lock()
+	previous := c.health.State
+	if previous == "" {
+		previous = StateDisconnected
+	}
+	if previous == state {
+		c.health.Reason = reason
+		c.healthMu.Unlock()
+		return
+	}
+	c.health = Health{State: state, Reason: reason, Since: time.Now()}
+	c.healthMu.Unlock()
+
+	logger.InfoCF(c.name, "Channel state changed", map[string]interface{}{
+		"from":   string(previous),
+		"to":     string(state),
+		"reason": reason,
+	})
+	if c.bus == nil {
+		return
+	}
+	c.bus.PublishEvent(bus.Event{
+		Type:   EventChannelHealth,
+		Source: c.name,
+		Data: map[string]string{
+			"state":    string(state),
+			"previous": string(previous),
+			"reason":   reason,
+		},
+		Payload: bus.ChannelHealthEvent{
+			Channel:  c.name,
+			State:    string(state),
+			Previous: string(previous),
+			Reason:   reason,
+		},
+	})
+}
@@ -0,0 +1,129 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// nextHealthEvent waits for the next channel health event
+func nextHealthEvent(t *testing.T, events <-chan bus.Event) bus.Event {
+	t.Helper()
+	select {
+	case ev := <-events:
+		if ev.Type != EventChannelHealth {
+			t.Fatalf("unexpected event type %s", ev.Type)
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a channel health event")
+		return bus.Event{}
+	}
+}
+
+func TestBaseChannelHealthTransitions(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	events := msgBus.SubscribeEvents(t.Context())
+	ch := NewBaseChannel("telegram", nil, msgBus, nil)
+
+	if h := ch.Health(); h.State != StateDisconnected || h.State.Ready() {
+		t.Errorf("new channel health = %v, want disconnected", h)
+	}
+
+	ch.setRunning(true)
+	ev := nextHealthEvent(t, events)
+	if ev.Source != "telegram" || ev.Data["previous"] != "disconnected" || ev.Data["state"] != "connected" {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+	if payload, ok := ev.Payload.(bus.ChannelHealthEvent); !ok || payload.Channel != "telegram" || payload.State != "connected" {
+		t.Errorf("unexpected payload: %+v", ev.Payload)
+	}
+	if !ch.Health().State.Ready() {
+		t.Error("running channel should be ready")
+	}
+
+	// Repeating the state only updates the reason
+	ch.setHealth(StateConnected, "still here")
+	ch.setHealth(StateDegraded, "slow")
+	if ev := nextHealthEvent(t, events); ev.Data["state"] != "degraded" || ev.Data["reason"] != "slow" {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	ch.setRunning(false)
+	if ev := nextHealthEvent(t, events); ev.Data["state"] != "disconnected" {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+}
+
+func TestBaseChannelReportsHealth(t *testing.T) {
+	ch := NewBaseChannel("whatsapp", nil, bus.NewMessageBus(), nil)
+	ch.reportsHealth()
+
+	ch.setRunning(true)
+	if h := ch.Health(); h.State != StateDisconnected {
+		t.Errorf("starting should leave self-reported health alone, got %v", h)
+	}
+	ch.setHealth(StateConnecting, "")
+	if h := ch.Health(); h.State != StateConnecting || h.Since.IsZero() {
+		t.Errorf("health = %+v, want connecting", h)
+	}
+}
+
+func TestWhatsAppBridgeHealth(t *testing.T) {
+	url, _ := newRecordingBridge(t)
+	msgBus := bus.NewMessageBus()
+	events := msgBus.SubscribeEvents(t.Context())
+
+	channel, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: url}, msgBus)
+	if err != nil {
+		t.Fatalf("NewWhatsAppChannel: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := channel.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	for _, want := range []string{"connecting", "connected"} {
+		if ev := nextHealthEvent(t, events); ev.Data["state"] != want {
+			t.Errorf("state = %s, want %s", ev.Data["state"], want)
+		}
+	}
+
+	channel.Stop(ctx)
+	if h := channel.Health(); h.State != StateDisconnected {
+		t.Errorf("stopped channel health = %v, want disconnected", h)
+	}
+}
+
+func TestWhatsAppAccountsHealth(t *testing.T) {
+	accounts, err := NewWhatsAppAccounts(config.WhatsAppConfig{
+		Instances: []config.WhatsAppInstanceConfig{
+			{AccountID: "sales", BridgeURL: "ws://localhost:3002"},
+			{AccountID: "support", BridgeURL: "ws://localhost:3003"},
+		},
+	}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewWhatsAppAccounts: %v", err)
+	}
+	sales, _ := accounts.Account("sales")
+	support, _ := accounts.Account("support")
+
+	if h := accounts.Health(); h.State != StateDisconnected {
+		t.Errorf("health = %v, want disconnected", h)
+	}
+
+	sales.setHealth(StateConnected, "")
+	support.setHealth(StateGivenUp, "bridge refused")
+	if h := accounts.Health(); h.State != StateDegraded || h.Reason != "accounts support: given_up (bridge refused)" {
+		t.Errorf("health = %v, want degraded", h)
+	}
+
+	support.setHealth(StateConnected, "")
+	if h := accounts.Health(); h.State != StateConnected {
+		t.Errorf("health = %v, want connected", h)
+	}
+}
@@ -0,0 +1,172 @@
+package channels
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// sentKeyTTL is how long the idempotency key of a sent message is
+	// remembered
+	sentKeyTTL = 24 * time.Hour
+	// maxSentKeys bounds the keys remembered; the oldest are forgotten
+	maxSentKeys = 10000
+)
+
+// sentKey is a line of the sent key file
+type sentKey struct {
+	Key string    `json:"key"`
+	At  time.Time `json:"at"`
+}
+
+// sentKeys remembers the idempotency keys of the messages sent, so a
+// message published again, by a retried agent turn or a bus replay after a
+// crash, is not sent twice. With a file the keys survive restarts; the
+// file is appended to and compacted when it is opened.
+type sentKeys struct {
+	mu   sync.Mutex
+	keys map[string]time.Time
+	file *os.File // nil keeps the keys in memory only
+	now  func() time.Time
+}
+
+func newSentKeys() *sentKeys {
+	return &sentKeys{keys: make(map[string]time.Time), now: time.Now}
+}
+
+// sentKeyScope is the key of msg in the store: idempotency keys are unique
+// per destination chat, so the targets of a broadcast are told apart
+func sentKeyScope(msg bus.OutboundMessage) string {
+	return msg.Channel + "|" + msg.AccountID + "|" + msg.ChatID + "|" + msg.IdempotencyKey
+}
+
+// open loads the keys kept at path and appends new ones to it
+func (s *sentKeys) open(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var k sentKey
+			if json.Unmarshal(scanner.Bytes(), &k) == nil && k.Key != "" {
+				s.keys[k.Key] = k.At
+			}
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	s.prune()
+
+	// Rewritten with the keys still remembered, then appended to
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for key, at := range s.keys {
+		line, _ := json.Marshal(sentKey{Key: key, At: at})
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = f
+	return nil
+}
+
+// prune forgets expired keys and the oldest beyond maxSentKeys
+func (s *sentKeys) prune() {
+	cutoff := s.now().Add(-sentKeyTTL)
+	for key, at := range s.keys {
+		if at.Before(cutoff) {
+			delete(s.keys, key)
+		}
+	}
+	if over := len(s.keys) - maxSentKeys; over > 0 {
+		byAge := make([]string, 0, len(s.keys))
+		for key := range s.keys {
+			byAge = append(byAge, key)
+		}
+		sort.Slice(byAge, func(i, j int) bool { return s.keys[byAge[i]].Before(s.keys[byAge[j]]) })
+		for _, key := range byAge[:over] {
+			delete(s.keys, key)
+		}
+	}
+}
+
+// sent reports whether a message with the idempotency key of msg was sent
+// to its chat. A nil store remembers nothing.
+func (s *sentKeys) sent(msg bus.OutboundMessage) bool {
+	if s == nil || msg.IdempotencyKey == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.keys[sentKeyScope(msg)]
+	return ok && s.now().Sub(at) < sentKeyTTL
+}
+
+// record remembers that msg was sent
+func (s *sentKeys) record(msg bus.OutboundMessage) {
+	if s == nil || msg.IdempotencyKey == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := sentKey{Key: sentKeyScope(msg), At: s.now()}
+	s.keys[k.Key] = k.At
+	if len(s.keys) > maxSentKeys {
+		s.prune()
+	}
+	if s.file == nil {
+		return
+	}
+	line, _ := json.Marshal(k)
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		// Still remembered until the restart
+		logger.WarnCF("channels", "Failed to store idempotency key", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+func (s *sentKeys) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// SetIdempotencyFile keeps the idempotency keys of sent messages in the file
+// at path, so messages published again after a restart are not sent twice
+func (m *Manager) SetIdempotencyFile(path string) error {
+	return m.sentKeys.open(path)
+}
@@ -0,0 +1,70 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestManagerSkipsSentIdempotencyKey(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := &recordingChannel{BaseChannel: NewBaseChannel("test", nil, mb, nil)}
+	m := &Manager{channels: map[string]Channel{"test": ch}, bus: mb, config: &config.Config{}, sentKeys: newSentKeys()}
+	ctx := context.Background()
+
+	msg := bus.OutboundMessage{Channel: "test", ChatID: "1", Content: "done", IdempotencyKey: "reply:t1"}
+	for i := 0; i < 2; i++ {
+		if err := m.sendOnce(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The key is per chat, and messages without one are always sent
+	other := msg
+	other.ChatID = "2"
+	m.sendOnce(ctx, other)
+	m.sendOnce(ctx, bus.OutboundMessage{Channel: "test", ChatID: "1", Content: "hi"})
+	m.sendOnce(ctx, bus.OutboundMessage{Channel: "test", ChatID: "1", Content: "hi"})
+
+	if len(ch.sent) != 4 {
+		t.Errorf("sent %+v", ch.sent)
+	}
+}
+
+func TestSentKeysPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels", "sent_keys.jsonl")
+	msg := bus.OutboundMessage{Channel: "test", ChatID: "1", IdempotencyKey: "k"}
+	old := bus.OutboundMessage{Channel: "test", ChatID: "1", IdempotencyKey: "old"}
+
+	s := newSentKeys()
+	if err := s.open(path); err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return time.Now().Add(-25 * time.Hour) }
+	s.record(old)
+	s.now = time.Now
+	s.record(msg)
+	s.close()
+
+	// After a restart the key is remembered, the expired one is dropped
+	reopened := newSentKeys()
+	if err := reopened.open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.close()
+	if !reopened.sent(msg) || reopened.sent(old) {
+		t.Errorf("after restart: %v", reopened.keys)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("file not compacted:\n%s", data)
+	}
+}
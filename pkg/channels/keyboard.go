@@ -0,0 +1,33 @@
+package channels
+
+import "github.com/sipeed/picoclaw/pkg/bus"
+
+// keyboardChannel is implemented by channels that show the keyboard of
+// outbound messages natively. The manager moves the keyboard of messages
+// to other channels onto their card.
+type keyboardChannel interface {
+	SendsKeyboards() bool
+}
+
+// sendsKeyboards reports whether a channel shows keyboards itself
+func sendsKeyboards(ch Channel) bool {
+	kc, ok := ch.(keyboardChannel)
+	return ok && kc.SendsKeyboards()
+}
+
+// emulateKeyboard appends the keyboard buttons of msg, row by row, to the
+// buttons of its card, creating one if needed
+func emulateKeyboard(msg bus.OutboundMessage) bus.OutboundMessage {
+	card := bus.Card{}
+	if msg.Card != nil {
+		card = *msg.Card
+	}
+	buttons := append([]bus.CardButton(nil), card.Buttons...)
+	for _, row := range msg.Keyboard {
+		buttons = append(buttons, row...)
+	}
+	card.Buttons = buttons
+	msg.Card = &card
+	msg.Keyboard = nil
+	return msg
+}
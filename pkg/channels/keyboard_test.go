@@ -0,0 +1,57 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestEmulateKeyboard(t *testing.T) {
+	card := &bus.Card{Title: "Deploy?", Buttons: []bus.CardButton{{Label: "Logs", URL: "https://ci.example.com"}}}
+	msg := emulateKeyboard(bus.OutboundMessage{
+		Content: "Build passed",
+		Card:    card,
+		Keyboard: [][]bus.CardButton{
+			{{Label: "Yes", Reply: "deploy"}, {Label: "No"}},
+			{{Label: "Later"}},
+		},
+	})
+
+	if msg.Keyboard != nil {
+		t.Error("keyboard should be moved to the card")
+	}
+	var labels []string
+	for _, b := range msg.Card.Buttons {
+		labels = append(labels, b.Label)
+	}
+	if got := strings.Join(labels, ","); got != "Logs,Yes,No,Later" {
+		t.Errorf("card buttons = %s", got)
+	}
+	if len(card.Buttons) != 1 {
+		t.Error("the original card should not change")
+	}
+
+	if msg := emulateKeyboard(bus.OutboundMessage{Keyboard: [][]bus.CardButton{{{Label: "OK"}}}}); msg.Card == nil || len(msg.Card.Buttons) != 1 {
+		t.Errorf("expected a card with the keyboard button, got %+v", msg.Card)
+	}
+}
+
+func TestManagerSendKeyboardFallback(t *testing.T) {
+	ch := &recordingChannel{BaseChannel: NewBaseChannel("test", nil, nil, nil)}
+	m, _ := newDeliveryTestManager(ch, 1)
+
+	m.Send(t.Context(), bus.OutboundMessage{
+		Channel:  "test",
+		ChatID:   "chat",
+		Content:  "Deploy?",
+		Keyboard: [][]bus.CardButton{{{Label: "Yes", Reply: "deploy"}}},
+	})
+	if len(ch.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(ch.sent))
+	}
+	sent := ch.sent[0]
+	if sent.Keyboard != nil || sent.Card != nil || !strings.Contains(sent.Content, `Yes: reply "deploy"`) {
+		t.Errorf("keyboard should be sent as text, got %+v", sent)
+	}
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
@@ -29,6 +30,7 @@ const (
 	lineContentEndpoint  = lineDataAPIBase + "/message/%s/content"
 	lineBotInfoEndpoint  = lineAPIBase + "/info"
 	lineLoadingEndpoint  = lineAPIBase + "/chat/loading/start"
+	lineWebhookEndpoint  = lineAPIBase + "/channel/webhook/endpoint"
 	lineReplyTokenMaxAge = 25 * time.Second
 )
 
@@ -483,7 +485,7 @@ func (c *LINEChannel) resolveChatID(source lineSource) string {
 // using a cached reply token, then falls back to the Push API.
 func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
-		return fmt.Errorf("line channel not running")
+		return fmt.Errorf("%w: line channel not running", errs.ErrChannelDown)
 	}
 
 	// Load and consume quote token for this chat
@@ -556,14 +558,64 @@ func (c *LINEChannel) sendLoading(chatID string) {
 	}
 }
 
+// WantedWebhook returns the configured public URL of the webhook server,
+// which LINE reaches directly rather than through the gateway
+func (c *LINEChannel) WantedWebhook(baseURL string) string {
+	return c.config.WebhookURL
+}
+
+// RegisteredWebhook returns the webhook endpoint set for the channel
+func (c *LINEChannel) RegisteredWebhook(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, lineWebhookEndpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.ChannelAccessToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("webhook endpoint API returned status %d", resp.StatusCode)
+	}
+
+	var info struct {
+		Endpoint string `json:"endpoint"`
+		Active   bool   `json:"active"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", err
+	}
+	if !info.Active {
+		// Only the console can turn it on
+		logger.WarnC("line", "Webhook is turned off; enable \"Use webhook\" in the LINE Developers console")
+	}
+	return info.Endpoint, nil
+}
+
+// RegisterWebhook sets the channel's webhook endpoint
+func (c *LINEChannel) RegisterWebhook(ctx context.Context, webhookURL string) error {
+	return c.callAPIMethod(ctx, http.MethodPut, lineWebhookEndpoint, map[string]string{"endpoint": webhookURL})
+}
+
 // callAPI makes an authenticated POST request to the LINE API.
 func (c *LINEChannel) callAPI(ctx context.Context, endpoint string, payload interface{}) error {
+	return c.callAPIMethod(ctx, http.MethodPost, endpoint, payload)
+}
+
+// callAPIMethod makes an authenticated request with a JSON body to the
+// LINE API.
+func (c *LINEChannel) callAPIMethod(ctx context.Context, method, endpoint string, payload interface{}) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
 	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
@@ -203,7 +204,7 @@ func (c *MaixCamChannel) Stop(ctx context.Context) error {
 
 func (c *MaixCamChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
-		return fmt.Errorf("maixcam channel not running")
+		return fmt.Errorf("%w: maixcam channel not running", errs.ErrChannelDown)
 	}
 
 	c.clientsMux.RLock()
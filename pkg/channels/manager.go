@@ -9,22 +9,72 @@ package channels
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/errs"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/pipeline"
+	"github.com/sipeed/picoclaw/pkg/trace"
 )
 
 type Manager struct {
 	channels     map[string]Channel
 	bus          *bus.MessageBus
 	config       *config.Config
+	templates    *NotificationTemplates
+	pipeline     *pipeline.Pipeline
 	dispatchTask *asyncTask
+	expiry       expiryQueue
+	sentKeys     *sentKeys
+	progress     progressTracker
+	order        chatOrder
+	guests       *GuestPasses
+	media        *mediaPipeline
+	webhooks     webhookRegistry
 	mu           sync.RWMutex
 }
 
+// inboundDeduper is implemented by channels that drop redelivered messages
+type inboundDeduper interface {
+	configureInboundDedup(cfg config.InboundDedupConfig)
+}
+
+// inboundDebouncerConfigurer is implemented by channels that can coalesce
+// bursts of inbound messages
+type inboundDebouncerConfigurer interface {
+	configureInboundDebounce(cfg config.InboundDebounceConfig)
+}
+
+// accessConfigurer is implemented by channels with deny lists and chat
+// allowlists
+type accessConfigurer interface {
+	configureAccess(cfg config.ChannelAccessConfig)
+}
+
+// accessEditor is implemented by channels whose allow and deny lists can
+// be changed at runtime
+type accessEditor interface {
+	AllowSender(senderID string)
+	DenySender(senderID string)
+}
+
+// inboundStopper is implemented by channels that can refuse inbound
+// messages while the gateway drains
+type inboundStopper interface {
+	stopInbound()
+}
+
+// DefaultDrainTimeout bounds Drain when no timeout is configured
+const DefaultDrainTimeout = 30 * time.Second
+
+// drainPollInterval is how often Drain checks for pending messages
+const drainPollInterval = 100 * time.Millisecond
+
 type asyncTask struct {
 	cancel context.CancelFunc
 }
@@ -34,12 +84,61 @@ func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error
 		channels: make(map[string]Channel),
 		bus:      messageBus,
 		config:   cfg,
+		guests:   NewGuestPasses(),
+		media:    &mediaPipeline{},
+		sentKeys: newSentKeys(),
+	}
+
+	templates, err := NewNotificationTemplates(cfg.Notifications)
+	if err != nil {
+		return nil, err
+	}
+	m.templates = templates
+
+	if m.pipeline, err = pipeline.New(cfg.Pipeline); err != nil {
+		return nil, err
+	}
+
+	bridges, err := NewBridges(cfg.Channels.Bridges, messageBus)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := m.initChannels(); err != nil {
 		return nil, err
 	}
 
+	for name, channel := range m.channels {
+		if d, ok := channel.(inboundDeduper); ok {
+			d.configureInboundDedup(cfg.Channels.InboundDedup)
+		}
+		if d, ok := channel.(inboundDebouncerConfigurer); ok {
+			d.configureInboundDebounce(cfg.Channels.InboundDebounce)
+		}
+		if a, ok := channel.(accessConfigurer); ok {
+			a.configureAccess(cfg.Channels.Access[name])
+		}
+		if g, ok := channel.(guestKeeper); ok {
+			g.setGuestPasses(m.guests)
+		}
+		if mk, ok := channel.(mediaKeeper); ok {
+			mk.setMediaPipeline(m.media)
+		}
+		if b, ok := channel.(bridgeKeeper); ok {
+			b.setBridges(bridges)
+		}
+	}
+	for _, rule := range cfg.Channels.Bridges {
+		for _, name := range []string{rule.From, rule.To} {
+			if _, ok := m.channels[name]; !ok {
+				logger.WarnCF("channels", "Bridge refers to a channel that is not enabled", map[string]interface{}{
+					"bridge":  rule.Name,
+					"channel": name,
+				})
+			}
+		}
+	}
+
 	return m, nil
 }
 
@@ -59,7 +158,20 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
-	if m.config.Channels.WhatsApp.Enabled && m.config.Channels.WhatsApp.BridgeURL != "" {
+	if m.config.Channels.WhatsApp.Enabled && len(m.config.Channels.WhatsApp.Instances) > 0 {
+		logger.DebugC("channels", "Attempting to initialize WhatsApp accounts")
+		whatsapp, err := NewWhatsAppAccounts(m.config.Channels.WhatsApp, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize WhatsApp accounts", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["whatsapp"] = whatsapp
+			logger.InfoCF("channels", "WhatsApp channel enabled successfully", map[string]interface{}{
+				"accounts": whatsapp.AccountIDs(),
+			})
+		}
+	} else if m.config.Channels.WhatsApp.Enabled && m.config.Channels.WhatsApp.BridgeURL != "" {
 		logger.DebugC("channels", "Attempting to initialize WhatsApp channel")
 		whatsapp, err := NewWhatsAppChannel(m.config.Channels.WhatsApp, m.bus)
 		if err != nil {
@@ -176,6 +288,110 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
+	if m.config.Channels.Matrix.Enabled && m.config.Channels.Matrix.AccessToken != "" {
+		logger.DebugC("channels", "Attempting to initialize Matrix channel")
+		matrix, err := NewMatrixChannel(m.config.Channels.Matrix, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Matrix channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["matrix"] = matrix
+			logger.InfoC("channels", "Matrix channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.MQTT.Enabled && m.config.Channels.MQTT.Broker != "" {
+		logger.DebugC("channels", "Attempting to initialize MQTT channel")
+		mqtt, err := NewMQTTChannel(m.config.Channels.MQTT, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize MQTT channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["mqtt"] = mqtt
+			logger.InfoC("channels", "MQTT channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Mattermost.Enabled && m.config.Channels.Mattermost.URL != "" {
+		logger.DebugC("channels", "Attempting to initialize Mattermost channel")
+		mattermost, err := NewMattermostChannel(m.config.Channels.Mattermost, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Mattermost channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["mattermost"] = mattermost
+			logger.InfoC("channels", "Mattermost channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Messenger.Enabled && m.config.Channels.Messenger.PageAccessToken != "" {
+		logger.DebugC("channels", "Attempting to initialize Messenger channel")
+		messenger, err := NewMessengerChannel(m.config.Channels.Messenger, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Messenger channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["messenger"] = messenger
+			logger.InfoC("channels", "Messenger channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Terminal.Enabled {
+		logger.DebugC("channels", "Attempting to initialize terminal channel")
+		terminal, err := NewTerminalChannel(m.config.Channels.Terminal, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize terminal channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["terminal"] = terminal
+			logger.InfoC("channels", "Terminal channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.WebChat.Enabled {
+		logger.DebugC("channels", "Attempting to initialize web chat channel")
+		webChat, err := NewWebChatChannel(m.config.Channels.WebChat, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize web chat channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["webchat"] = webChat
+			logger.InfoC("channels", "Web chat channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.RepoWebhook.Enabled {
+		logger.DebugC("channels", "Attempting to initialize repository webhook channel")
+		repoWebhook, err := NewRepoWebhookChannel(m.config.Channels.RepoWebhook, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize repository webhook channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["repo_webhook"] = repoWebhook
+			logger.InfoC("channels", "Repository webhook channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.AlertWebhook.Enabled {
+		logger.DebugC("channels", "Attempting to initialize alert webhook channel")
+		alertWebhook, err := NewAlertWebhookChannel(m.config.Channels.AlertWebhook, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize alert webhook channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["alert_webhook"] = alertWebhook
+			logger.InfoC("channels", "Alert webhook channel enabled successfully")
+		}
+	}
+
 	logger.InfoCF("channels", "Channel initialization completed", map[string]interface{}{
 		"enabled_channels": len(m.channels),
 	})
@@ -198,6 +414,8 @@ func (m *Manager) StartAll(ctx context.Context) error {
 	m.dispatchTask = &asyncTask{cancel: cancel}
 
 	go m.dispatchOutbound(dispatchCtx)
+	go m.runExpiry(dispatchCtx)
+	go m.media.run(dispatchCtx)
 
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Starting channel", map[string]interface{}{
@@ -226,6 +444,14 @@ func (m *Manager) StopAll(ctx context.Context) error {
 		m.dispatchTask = nil
 	}
 
+	// Sensitive replies are not left behind once nobody tracks them
+	if pending := m.expiry.takeAll(); len(pending) > 0 {
+		logger.InfoCF("channels", "Deleting expiring messages before stopping", map[string]interface{}{
+			"count": len(pending),
+		})
+		m.deleteMessages(ctx, pending)
+	}
+
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Stopping channel", map[string]interface{}{
 			"channel": name,
@@ -238,10 +464,64 @@ func (m *Manager) StopAll(ctx context.Context) error {
 		}
 	}
 
+	m.sentKeys.close()
+
 	logger.InfoC("channels", "All channels stopped")
 	return nil
 }
 
+// Drain prepares the channels for shutdown. They stop accepting inbound
+// messages, then Drain waits until messages already accepted have been
+// processed by the agent and their replies sent, bounded by the configured
+// drain timeout. Call it before stopping the agent loop and StopAll.
+func (m *Manager) Drain(ctx context.Context) error {
+	timeout := time.Duration(m.config.Channels.DrainTimeoutSeconds) * time.Second
+	if timeout < 0 {
+		return nil
+	}
+	if timeout == 0 {
+		timeout = DefaultDrainTimeout
+	}
+
+	m.mu.RLock()
+	for _, channel := range m.channels {
+		if s, ok := channel.(inboundStopper); ok {
+			s.stopInbound()
+		}
+	}
+	// Without a dispatcher nothing sends outbound messages
+	dispatching := m.dispatchTask != nil
+	m.mu.RUnlock()
+
+	logger.InfoC("channels", "Draining channels")
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		inbound, outbound := m.bus.Pending()
+		if !dispatching {
+			outbound = 0
+		}
+		if inbound <= 0 && outbound <= 0 {
+			logger.InfoC("channels", "Channels drained")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.WarnCF("channels", "Drain timed out, dropping pending messages", map[string]interface{}{
+				"inbound":  inbound,
+				"outbound": outbound,
+			})
+			return fmt.Errorf("drain channels: %d inbound and %d outbound messages pending: %w", inbound, outbound, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
 func (m *Manager) dispatchOutbound(ctx context.Context) {
 	logger.InfoC("channels", "Outbound dispatcher started")
 
@@ -255,31 +535,106 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 			if !ok {
 				continue
 			}
-
-			// Silently skip internal channels
-			if constants.IsInternalChannel(msg.Channel) {
+			if isBroadcast(msg) {
+				// Paced per channel, so it must not hold up other messages
+				go func() {
+					m.broadcastOutbound(ctx, msg)
+					m.bus.OutboundDone(msg)
+				}()
 				continue
 			}
+			m.sendInOrder(ctx, msg)
+		}
+	}
+}
 
-			m.mu.RLock()
-			channel, exists := m.channels[msg.Channel]
-			m.mu.RUnlock()
+// sendOutbound sends a message taken from the bus
+func (m *Manager) sendOutbound(ctx context.Context, msg bus.OutboundMessage) *Delivery {
+	return m.Send(ctx, msg)
+}
 
-			if !exists {
-				logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
-					"channel": msg.Channel,
-				})
-				continue
-			}
+// sendOnce renders msg for its channel and sends it
+func (m *Manager) sendOnce(ctx context.Context, msg bus.OutboundMessage) error {
+	// Silently skip internal channels
+	if constants.IsInternalChannel(msg.Channel) {
+		return nil
+	}
+	if m.sentKeys.sent(msg) {
+		logger.InfoCF("channels", "Skipping message sent already", map[string]interface{}{
+			"channel":         msg.Channel,
+			"chat_id":         msg.ChatID,
+			"idempotency_key": msg.IdempotencyKey,
+			"trace_id":        msg.TraceID,
+		})
+		return nil
+	}
 
-			if err := channel.Send(ctx, msg); err != nil {
-				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
-					"channel": msg.Channel,
-					"error":   err.Error(),
-				})
-			}
-		}
+	m.mu.RLock()
+	channel, exists := m.channels[msg.Channel]
+	m.mu.RUnlock()
+
+	// Channels can read the trace ID of the message being answered from ctx
+	ctx = trace.WithID(ctx, msg.TraceID)
+
+	if !exists {
+		return fmt.Errorf("%w %s", errUnknownChannel, msg.Channel)
+	}
+
+	// The configured filters see the text before it is laid out for the
+	// channel; reactions have none
+	if msg.Content != "" {
+		msg.Content = m.pipeline.Apply(pipeline.Message{Channel: msg.Channel, ChatID: msg.ChatID, Content: msg.Content})
+	}
+
+	msg, err := m.templates.Render(msg, channelMarkup(channel))
+	if err != nil {
+		logger.WarnCF("channels", "Failed to render notification template", trace.Fields(ctx, map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		}))
+	}
+
+	if msg.Poll != nil && !sendsPolls(channel) {
+		msg = emulatePoll(msg, rendersCards(channel), channelMarkup(channel))
+	}
+	if msg.Contact != nil && !sendsContacts(channel) {
+		msg = emulateContact(msg, channelMarkup(channel))
+	}
+	if len(msg.Keyboard) > 0 && !sendsKeyboards(channel) {
+		msg = emulateKeyboard(msg)
+	}
+	if msg.Card != nil && !rendersCards(channel) {
+		msg = flattenCard(msg, channelMarkup(channel), true)
 	}
+
+	// Progress updates are gathered in one message where the channel can
+	// edit it, which the task's reply then replaces
+	switch {
+	case msg.Progress:
+		err = m.sendProgress(ctx, channel, msg)
+	case m.replaceProgress(ctx, channel, msg):
+		// Delivered in place of the task's progress message
+	default:
+		err = m.sendOne(ctx, channel, msg)
+	}
+	if err != nil {
+		return err
+	}
+	m.sentKeys.record(msg)
+	logger.DebugCF("channels", "Outbound message sent", trace.Fields(ctx, map[string]interface{}{
+		"channel":     msg.Channel,
+		"chat_id":     msg.ChatID,
+		"delivery_id": msg.DeliveryID,
+	}))
+	return nil
+}
+
+// sendOne sends msg, scheduling its deletion if it has a TTL
+func (m *Manager) sendOne(ctx context.Context, channel Channel, msg bus.OutboundMessage) error {
+	if ttl := m.messageTTL(msg); ttl > 0 {
+		return m.sendExpiring(ctx, channel, msg, ttl)
+	}
+	return channel.Send(ctx, msg)
 }
 
 func (m *Manager) GetChannel(name string) (Channel, bool) {
@@ -289,20 +644,92 @@ func (m *Manager) GetChannel(name string) (Channel, bool) {
 	return channel, ok
 }
 
+// DuplicatesDropped returns the redelivered inbound messages each channel
+// dropped
+func (m *Manager) DuplicatesDropped() map[string]uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dropped := make(map[string]uint64, len(m.channels))
+	for name, channel := range m.channels {
+		if d, ok := channel.(interface{ DuplicatesDropped() uint64 }); ok {
+			dropped[name] = d.DuplicatesDropped()
+		}
+	}
+	return dropped
+}
+
 func (m *Manager) GetStatus() map[string]interface{} {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	status := make(map[string]interface{})
 	for name, channel := range m.channels {
-		status[name] = map[string]interface{}{
+		entry := map[string]interface{}{
 			"enabled": true,
 			"running": channel.IsRunning(),
 		}
+		if d, ok := channel.(interface{ DuplicatesDropped() uint64 }); ok {
+			entry["duplicates_dropped"] = d.DuplicatesDropped()
+		}
+		switch wa := channel.(type) {
+		case *WhatsAppChannel:
+			entry["validator"] = wa.ValidatorStats()
+		case *WhatsAppAccounts:
+			accounts := make(map[string]interface{})
+			for _, id := range wa.AccountIDs() {
+				account, _ := wa.Account(id)
+				accounts[id] = map[string]interface{}{
+					"running":            account.IsRunning(),
+					"validator":          account.ValidatorStats(),
+					"duplicates_dropped": account.DuplicatesDropped(),
+				}
+			}
+			entry["accounts"] = accounts
+		}
+		status[name] = entry
 	}
 	return status
 }
 
+// AllowSender lets senderID reach the agent on the named channel until
+// restart. It fails if a deny pattern still blocks the sender.
+func (m *Manager) AllowSender(channelName, senderID string) error {
+	editor, err := m.accessEditor(channelName)
+	if err != nil {
+		return err
+	}
+	editor.AllowSender(senderID)
+	if ch, ok := editor.(Channel); ok && !ch.IsAllowed(senderID) {
+		return fmt.Errorf("%s is still blocked by a deny_from pattern", senderID)
+	}
+	return nil
+}
+
+// DenySender blocks senderID on the named channel until restart
+func (m *Manager) DenySender(channelName, senderID string) error {
+	editor, err := m.accessEditor(channelName)
+	if err != nil {
+		return err
+	}
+	editor.DenySender(senderID)
+	return nil
+}
+
+func (m *Manager) accessEditor(channelName string) (accessEditor, error) {
+	m.mu.RLock()
+	channel, ok := m.channels[channelName]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: channel %s not found", errs.ErrChannelDown, channelName)
+	}
+	editor, ok := channel.(accessEditor)
+	if !ok {
+		return nil, fmt.Errorf("channel %s has no editable allowlist", channelName)
+	}
+	return editor, nil
+}
+
 func (m *Manager) GetEnabledChannels() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -314,6 +741,21 @@ func (m *Manager) GetEnabledChannels() []string {
 	return names
 }
 
+// WebhookHandlers returns the handlers of channels that receive messages
+// through the gateway HTTP server, keyed by path
+func (m *Manager) WebhookHandlers() map[string]http.Handler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	handlers := make(map[string]http.Handler)
+	for _, channel := range m.channels {
+		if receiver, ok := channel.(WebhookReceiver); ok && receiver.WebhookPath() != "" {
+			handlers[receiver.WebhookPath()] = receiver
+		}
+	}
+	return handlers
+}
+
 func (m *Manager) RegisterChannel(name string, channel Channel) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -326,20 +768,11 @@ func (m *Manager) UnregisterChannel(name string) {
 	delete(m.channels, name)
 }
 
-func (m *Manager) SendToChannel(ctx context.Context, channelName, chatID, content string) error {
-	m.mu.RLock()
-	channel, exists := m.channels[channelName]
-	m.mu.RUnlock()
-
-	if !exists {
-		return fmt.Errorf("channel %s not found", channelName)
-	}
-
-	msg := bus.OutboundMessage{
+// SendToChannel sends content to a chat and returns the delivery handle
+func (m *Manager) SendToChannel(ctx context.Context, channelName, chatID, content string) *Delivery {
+	return m.Send(ctx, bus.OutboundMessage{
 		Channel: channelName,
 		ChatID:  chatID,
 		Content: content,
-	}
-
-	return channel.Send(ctx, msg)
+	})
 }
@@ -0,0 +1,187 @@
+package channels
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/pipeline"
+)
+
+// recordingChannel records what it is asked to send
+type recordingChannel struct {
+	*BaseChannel
+	mu   sync.Mutex
+	sent []bus.OutboundMessage
+}
+
+func (c *recordingChannel) Start(ctx context.Context) error { return nil }
+func (c *recordingChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *recordingChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func newDrainTestManager(t *testing.T) (*Manager, *recordingChannel, *bus.MessageBus) {
+	mb := bus.NewMessageBus()
+	ch := &recordingChannel{BaseChannel: NewBaseChannel("test", nil, mb, nil)}
+	m := &Manager{
+		channels: map[string]Channel{"test": ch},
+		bus:      mb,
+		config:   &config.Config{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	m.dispatchTask = &asyncTask{cancel: cancel}
+	go m.dispatchOutbound(ctx)
+	return m, ch, mb
+}
+
+func TestManagerDrain(t *testing.T) {
+	m, ch, mb := newDrainTestManager(t)
+
+	// A slow agent turn that replies after drain has started
+	go func() {
+		msg, _ := mb.ConsumeInbound(context.Background())
+		time.Sleep(150 * time.Millisecond)
+		mb.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: "done"})
+		mb.InboundDone(msg)
+	}()
+	ch.HandleMessage("42", "chat", "work", nil, nil)
+
+	if err := m.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	ch.mu.Lock()
+	sent := len(ch.sent)
+	ch.mu.Unlock()
+	if sent != 1 {
+		t.Errorf("expected the reply to be sent before Drain returned, got %d messages", sent)
+	}
+
+	ch.HandleMessage("42", "chat", "late", nil, nil)
+	if inbound, _ := mb.Pending(); inbound != 0 {
+		t.Errorf("expected inbound messages to be refused while draining, %d pending", inbound)
+	}
+}
+
+func TestManagerDrainTimeout(t *testing.T) {
+	m, ch, _ := newDrainTestManager(t)
+
+	// Nothing consumes the inbound message
+	ch.HandleMessage("42", "chat", "stuck", nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := m.Drain(ctx); err == nil {
+		t.Error("expected an error when messages are still pending")
+	}
+}
+
+func TestManagerDrainDisabled(t *testing.T) {
+	m, ch, _ := newDrainTestManager(t)
+	m.config.Channels.DrainTimeoutSeconds = -1
+
+	ch.HandleMessage("42", "chat", "stuck", nil, nil)
+	if err := m.Drain(context.Background()); err != nil {
+		t.Errorf("disabled drain should return immediately, got %v", err)
+	}
+}
+
+// webhookChannel receives webhooks and registers its URL itself, on a
+// platform that delivers to remote
+type webhookChannel struct {
+	recordingChannel
+	remote     string
+	registered []string
+}
+
+func (c *webhookChannel) ServeHTTP(http.ResponseWriter, *http.Request) {}
+func (c *webhookChannel) WebhookPath() string                          { return "/hook" }
+
+func (c *webhookChannel) WantedWebhook(baseURL string) string {
+	if baseURL == "" {
+		return ""
+	}
+	return baseURL + "/hook"
+}
+
+func (c *webhookChannel) RegisteredWebhook(ctx context.Context) (string, error) {
+	return c.remote, nil
+}
+
+func (c *webhookChannel) RegisterWebhook(ctx context.Context, webhookURL string) error {
+	c.remote = webhookURL
+	c.registered = append(c.registered, webhookURL)
+	return nil
+}
+
+func TestManagerWebhookRegistration(t *testing.T) {
+	mb := bus.NewMessageBus()
+	hook := &webhookChannel{recordingChannel: recordingChannel{BaseChannel: NewBaseChannel("hook", nil, mb, nil)}}
+	hook.setRunning(true)
+	m := &Manager{
+		channels: map[string]Channel{
+			"hook":  hook,
+			"plain": &recordingChannel{BaseChannel: NewBaseChannel("plain", nil, mb, nil)},
+		},
+		bus:    mb,
+		config: &config.Config{},
+	}
+	ctx := context.Background()
+
+	m.CheckWebhooks(ctx)
+	if len(hook.registered) != 0 {
+		t.Fatalf("registered without a public URL: %v", hook.registered)
+	}
+	m.SetPublicURL(ctx, "https://run-1.trycloudflare.com/")
+	m.CheckWebhooks(ctx)
+	if len(hook.registered) != 1 || hook.registered[0] != "https://run-1.trycloudflare.com/hook" {
+		t.Fatalf("unexpected registrations %v", hook.registered)
+	}
+
+	// Changed on the platform, e.g. by another deployment of the bot
+	hook.remote = "https://old.example.org/hook"
+	m.CheckWebhooks(ctx)
+	if len(hook.registered) != 2 || hook.remote != "https://run-1.trycloudflare.com/hook" {
+		t.Errorf("drifted webhook not repaired: %v", hook.registered)
+	}
+
+	hook.setRunning(false)
+	m.SetPublicURL(ctx, "https://run-2.trycloudflare.com")
+	if len(hook.registered) != 2 {
+		t.Errorf("stopped channel registered: %v", hook.registered)
+	}
+}
+
+func TestManagerPipeline(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := &recordingChannel{BaseChannel: NewBaseChannel("test", nil, mb, nil)}
+	p, err := pipeline.New(config.PipelineConfig{
+		Channels:  map[string][]string{"test": {pipeline.StageRedactSecrets, pipeline.StageCapLength}},
+		MaxLength: 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{channels: map[string]Channel{"test": ch}, bus: mb, config: &config.Config{}, pipeline: p}
+
+	if err := m.sendOnce(context.Background(), bus.OutboundMessage{Channel: "test", ChatID: "1", Content: "Use token=abc123 to log in to the dashboard"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.sendOnce(context.Background(), bus.OutboundMessage{Channel: "test", ChatID: "1", ReplyTo: "9", Reaction: "👍"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch.sent) != 2 || ch.sent[0].Content != "Use token=[REDACTED] to log…" || ch.sent[1].Content != "" {
+		t.Errorf("sent %+v", ch.sent)
+	}
+}
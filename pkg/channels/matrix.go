@@ -0,0 +1,643 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// What the Matrix channel does with messages in encrypted rooms
+const (
+	MatrixEncryptedIgnore = "ignore"
+	MatrixEncryptedNotice = "notice"
+)
+
+const (
+	matrixSyncTimeout   = 30 * time.Second // How long the homeserver holds a /sync open
+	matrixRetryDelay    = 5 * time.Second  // Pause after a failed /sync
+	matrixTypingTimeout = 30 * time.Second
+	matrixChunkSize     = 16000 // Characters per message, well within the 64 KiB event limit
+)
+
+// matrixEncryptedNotice is sent once to each encrypted room in "notice" mode
+const matrixEncryptedNotice = "I can't read encrypted messages. Please talk to me in an unencrypted room."
+
+// matrixFilter keeps /sync responses to the room events the channel uses
+const matrixFilter = `{"presence":{"types":[]},"account_data":{"types":[]},"room":{"account_data":{"types":[]},"ephemeral":{"types":[]},"state":{"lazy_load_members":true}}}`
+
+// matrixInitialFilter only fetches the sync token, so messages sent while
+// the bot was away are not answered on start
+const matrixInitialFilter = `{"presence":{"types":[]},"account_data":{"types":[]},"room":{"timeline":{"limit":1},"state":{"types":[]},"ephemeral":{"types":[]},"account_data":{"types":[]}}}`
+
+// MatrixChannel talks to a Matrix homeserver through the client-server API.
+// A long-polling /sync loop receives messages and replies are sent as room
+// events. Chat IDs are room IDs.
+type MatrixChannel struct {
+	*BaseChannel
+	config     config.MatrixConfig
+	homeserver string // Without the trailing slash
+	client     *http.Client
+	markup     format.Style
+	mediaDir   string // Where incoming files are kept; empty uses temp files
+
+	userID  string          // The bot's own user ID, from whoami
+	rooms   map[string]bool // Allowed room IDs; empty allows every room
+	noticed sync.Map        // Encrypted rooms already told the bot cannot read them
+	txnBase string
+	txnSeq  atomic.Uint64
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewMatrixChannel creates a Matrix channel logged in with an access token
+func NewMatrixChannel(cfg config.MatrixConfig, messageBus *bus.MessageBus) (*MatrixChannel, error) {
+	if cfg.Homeserver == "" || cfg.AccessToken == "" {
+		return nil, fmt.Errorf("matrix homeserver and access_token are required")
+	}
+	switch cfg.EncryptedRooms {
+	case "", MatrixEncryptedIgnore, MatrixEncryptedNotice:
+	default:
+		return nil, fmt.Errorf("unknown matrix encrypted_rooms %q (want ignore or notice)", cfg.EncryptedRooms)
+	}
+
+	markup, err := format.ParseStyle(cfg.Format, format.HTML)
+	if err != nil {
+		logger.WarnCF("matrix", "Invalid format, using the default", map[string]interface{}{
+			"error":  err.Error(),
+			"format": string(markup),
+		})
+	}
+
+	return &MatrixChannel{
+		BaseChannel: NewBaseChannel("matrix", cfg, messageBus, cfg.AllowFrom),
+		config:      cfg,
+		homeserver:  strings.TrimRight(cfg.Homeserver, "/"),
+		client:      &http.Client{Timeout: matrixSyncTimeout + 30*time.Second},
+		markup:      markup,
+		txnBase:     fmt.Sprintf("picoclaw-%d", time.Now().UnixNano()),
+	}, nil
+}
+
+// Start logs in, resolves the allowed rooms and starts the sync loop
+func (c *MatrixChannel) Start(ctx context.Context) error {
+	logger.InfoC("matrix", "Starting Matrix channel")
+
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, &whoami); err != nil {
+		return fmt.Errorf("matrix login failed: %w", err)
+	}
+	c.userID = whoami.UserID
+	c.rooms = c.resolveRooms(ctx, c.config.AllowRooms)
+
+	// Skip the backlog: only messages sent from now on are answered
+	since, err := c.syncOnce(ctx, "", matrixInitialFilter, 0)
+	if err != nil {
+		return fmt.Errorf("matrix initial sync failed: %w", err)
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.done = make(chan struct{})
+	go c.syncLoop(since)
+
+	c.setRunning(true)
+	logger.InfoCF("matrix", "Matrix channel started", map[string]interface{}{
+		"user_id": c.userID,
+		"rooms":   len(c.rooms),
+	})
+	return nil
+}
+
+// Stop ends the sync loop
+func (c *MatrixChannel) Stop(ctx context.Context) error {
+	logger.InfoC("matrix", "Stopping Matrix channel")
+	c.setRunning(false)
+	if c.cancel != nil {
+		c.cancel()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+		}
+	}
+	logger.InfoC("matrix", "Matrix channel stopped")
+	return nil
+}
+
+// Markup returns the markup the channel sends
+func (c *MatrixChannel) Markup() format.Style {
+	return c.markup
+}
+
+// resolveRooms turns room IDs and aliases into a set of room IDs. Aliases
+// that cannot be resolved are left out, with a warning.
+func (c *MatrixChannel) resolveRooms(ctx context.Context, entries []string) map[string]bool {
+	rooms := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.HasPrefix(entry, "#") {
+			rooms[entry] = true
+			continue
+		}
+		var resolved struct {
+			RoomID string `json:"room_id"`
+		}
+		if err := c.call(ctx, http.MethodGet, "/_matrix/client/v3/directory/room/"+url.PathEscape(entry), nil, &resolved); err != nil {
+			logger.WarnCF("matrix", "Failed to resolve room alias, leaving it out", map[string]interface{}{
+				"alias": entry,
+				"error": err.Error(),
+			})
+			continue
+		}
+		rooms[resolved.RoomID] = true
+	}
+	return rooms
+}
+
+// roomAllowed reports whether the bot answers in roomID
+func (c *MatrixChannel) roomAllowed(roomID string) bool {
+	return len(c.config.AllowRooms) == 0 || c.rooms[roomID]
+}
+
+// Matrix /sync response, reduced to what the channel reads
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct {
+			InviteState struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"invite_state"`
+		} `json:"invite"`
+	} `json:"rooms"`
+}
+
+type matrixEvent struct {
+	Type     string          `json:"type"`
+	EventID  string          `json:"event_id"`
+	Sender   string          `json:"sender"`
+	StateKey *string         `json:"state_key,omitempty"`
+	Content  json.RawMessage `json:"content"`
+}
+
+type matrixMessageContent struct {
+	MsgType    string `json:"msgtype"`
+	Body       string `json:"body"`
+	FileName   string `json:"filename"`
+	URL        string `json:"url"` // mxc:// URI of media
+	Membership string `json:"membership"`
+	Info       struct {
+		MimeType string `json:"mimetype"`
+	} `json:"info"`
+	RelatesTo *struct {
+		RelType   string `json:"rel_type"`
+		InReplyTo *struct {
+			EventID string `json:"event_id"`
+		} `json:"m.in_reply_to"`
+	} `json:"m.relates_to"`
+}
+
+// syncOnce runs one /sync and returns the token to continue from
+func (c *MatrixChannel) syncOnce(ctx context.Context, since, filter string, timeout time.Duration) (string, error) {
+	query := url.Values{
+		"filter":  {filter},
+		"timeout": {fmt.Sprintf("%d", timeout.Milliseconds())},
+	}
+	if since != "" {
+		query.Set("since", since)
+	}
+	var resp matrixSyncResponse
+	if err := c.call(ctx, http.MethodGet, "/_matrix/client/v3/sync?"+query.Encode(), nil, &resp); err != nil {
+		return since, err
+	}
+	if since != "" {
+		c.handleSync(ctx, &resp)
+	}
+	return resp.NextBatch, nil
+}
+
+// syncLoop receives events until the channel stops
+func (c *MatrixChannel) syncLoop(since string) {
+	defer close(c.done)
+	for c.ctx.Err() == nil {
+		next, err := c.syncOnce(c.ctx, since, matrixFilter, matrixSyncTimeout)
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			logger.WarnCF("matrix", "Sync failed, retrying", map[string]interface{}{
+				"error": err.Error(),
+			})
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(matrixRetryDelay):
+			}
+			continue
+		}
+		since = next
+	}
+}
+
+// handleSync handles the invites and room messages of a sync response
+func (c *MatrixChannel) handleSync(ctx context.Context, resp *matrixSyncResponse) {
+	for roomID, room := range resp.Rooms.Invite {
+		c.handleInvite(ctx, roomID, room.InviteState.Events)
+	}
+	for roomID, room := range resp.Rooms.Join {
+		for _, ev := range room.Timeline.Events {
+			c.handleEvent(ctx, roomID, ev)
+		}
+	}
+}
+
+// handleInvite joins a room the bot was invited to, with AutoJoin, when
+// both the inviter and the room are allowed
+func (c *MatrixChannel) handleInvite(ctx context.Context, roomID string, events []matrixEvent) {
+	if !c.config.AutoJoin {
+		return
+	}
+	inviter := ""
+	for _, ev := range events {
+		var content matrixMessageContent
+		if ev.Type != "m.room.member" || ev.StateKey == nil || *ev.StateKey != c.userID || json.Unmarshal(ev.Content, &content) != nil {
+			continue
+		}
+		if content.Membership == "invite" {
+			inviter = ev.Sender
+		}
+	}
+	if inviter == "" || !c.IsAllowed(inviter) || !c.roomAllowed(roomID) {
+		logger.DebugCF("matrix", "Ignoring room invite", map[string]interface{}{
+			"room_id": roomID,
+			"inviter": inviter,
+		})
+		return
+	}
+
+	if err := c.call(ctx, http.MethodPost, "/_matrix/client/v3/join/"+url.PathEscape(roomID), struct{}{}, nil); err != nil {
+		logger.WarnCF("matrix", "Failed to join room", map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+		return
+	}
+	logger.InfoCF("matrix", "Joined room", map[string]interface{}{
+		"room_id": roomID,
+		"inviter": inviter,
+	})
+}
+
+// handleEvent passes a room message from an allowed user to the agent
+func (c *MatrixChannel) handleEvent(ctx context.Context, roomID string, ev matrixEvent) {
+	if ev.Sender == c.userID || !c.roomAllowed(roomID) {
+		return
+	}
+	switch ev.Type {
+	case "m.room.encrypted":
+		c.handleEncrypted(ctx, roomID, ev.Sender)
+		return
+	case "m.room.message":
+	default:
+		return
+	}
+
+	var msg matrixMessageContent
+	if err := json.Unmarshal(ev.Content, &msg); err != nil {
+		logger.DebugCF("matrix", "Ignoring malformed message", map[string]interface{}{
+			"event_id": ev.EventID,
+			"error":    err.Error(),
+		})
+		return
+	}
+	// Edits repeat a message already handled; notices come from other bots
+	if (msg.RelatesTo != nil && msg.RelatesTo.RelType == "m.replace") || msg.MsgType == "m.notice" {
+		return
+	}
+	if !c.IsAllowed(ev.Sender) {
+		logger.DebugCF("matrix", "Message rejected by allowlist", map[string]interface{}{
+			"sender_id": ev.Sender,
+		})
+		return
+	}
+
+	var content string
+	var mediaPaths []string
+	var localFiles []string
+	defer func() {
+		for _, file := range localFiles {
+			if err := os.Remove(file); err != nil {
+				logger.DebugCF("matrix", "Failed to cleanup temp file", map[string]interface{}{
+					"file":  file,
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+
+	switch msg.MsgType {
+	case "m.text", "m.emote":
+		content = stripMatrixReplyFallback(msg.Body)
+	case "m.image", "m.audio", "m.video", "m.file":
+		name, caption := msg.Body, ""
+		if msg.FileName != "" && msg.FileName != msg.Body {
+			name, caption = msg.FileName, msg.Body
+		}
+		if localPath := c.downloadMedia(msg.URL, name); localPath != "" {
+			if c.mediaDir == "" {
+				localFiles = append(localFiles, localPath)
+			}
+			mediaPaths = append(mediaPaths, localPath)
+		}
+		content = fmt.Sprintf("[%s: %s]", strings.TrimPrefix(msg.MsgType, "m."), name)
+		if caption != "" {
+			content = caption + "\n" + content
+		}
+	default:
+		content = fmt.Sprintf("[%s]", strings.TrimPrefix(msg.MsgType, "m."))
+	}
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	metadata := map[string]string{
+		"platform":   "matrix",
+		"message_id": ev.EventID,
+		"room_id":    roomID,
+	}
+	if msg.RelatesTo != nil && msg.RelatesTo.InReplyTo != nil {
+		metadata["reply_to"] = msg.RelatesTo.InReplyTo.EventID
+	}
+
+	logger.DebugCF("matrix", "Received message", map[string]interface{}{
+		"sender_id": ev.Sender,
+		"chat_id":   roomID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.setTyping(ctx, roomID, true)
+	c.HandleMessage(ev.Sender, roomID, content, mediaPaths, metadata)
+}
+
+// handleEncrypted deals with a message the bot cannot decrypt
+func (c *MatrixChannel) handleEncrypted(ctx context.Context, roomID, sender string) {
+	logger.DebugCF("matrix", "Ignoring encrypted message", map[string]interface{}{
+		"room_id":   roomID,
+		"sender_id": sender,
+	})
+	if c.config.EncryptedRooms != MatrixEncryptedNotice || !c.IsAllowed(sender) {
+		return
+	}
+	if _, told := c.noticed.LoadOrStore(roomID, true); told {
+		return
+	}
+	notice := map[string]interface{}{"msgtype": "m.notice", "body": matrixEncryptedNotice}
+	if _, err := c.sendEvent(ctx, roomID, "m.room.message", notice); err != nil {
+		logger.WarnCF("matrix", "Failed to send encrypted room notice", map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// stripMatrixReplyFallback removes the quote of the replied-to message
+// that clients put ahead of a reply
+func stripMatrixReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, ">") {
+			return strings.TrimSpace(strings.Join(lines[i:], "\n"))
+		}
+	}
+	return body
+}
+
+// Send sends msg to its room
+func (c *MatrixChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	_, err := c.SendMessages(ctx, msg)
+	return err
+}
+
+// SendMessages sends msg and returns the event IDs of the messages that
+// carry it, so they can be edited or redacted later
+func (c *MatrixChannel) SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error) {
+	if !c.IsRunning() {
+		return nil, fmt.Errorf("%w: matrix channel not running", errs.ErrChannelDown)
+	}
+	roomID := msg.ChatID
+	if roomID == "" {
+		return nil, fmt.Errorf("%w: matrix room ID is empty", errs.ErrValidation)
+	}
+	if !msg.Progress {
+		defer c.setTyping(ctx, roomID, false)
+	}
+
+	if msg.Reaction != "" {
+		if msg.ReplyTo == "" {
+			return nil, fmt.Errorf("%w: reaction requires a message to react to", errs.ErrValidation)
+		}
+		id, err := c.sendEvent(ctx, roomID, "m.reaction", map[string]interface{}{
+			"m.relates_to": map[string]string{"rel_type": "m.annotation", "event_id": msg.ReplyTo, "key": msg.Reaction},
+		})
+		return appendID(nil, id), err
+	}
+
+	var ids []string
+	if strings.TrimSpace(msg.Content) != "" || len(msg.Attachments) == 0 {
+		for i, chunk := range splitMessage(msg.Content, matrixChunkSize) {
+			content := c.textContent(chunk, msg.Formatted, "m.text")
+			if i == 0 && msg.ReplyTo != "" {
+				content["m.relates_to"] = map[string]interface{}{
+					"m.in_reply_to": map[string]string{"event_id": msg.ReplyTo},
+				}
+			}
+			id, err := c.sendEvent(ctx, roomID, "m.room.message", content)
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	for _, att := range msg.Attachments {
+		id, err := c.sendAttachment(ctx, roomID, att, msg.Formatted)
+		ids = appendID(ids, id)
+		if err != nil {
+			return ids, err
+		}
+	}
+	return ids, nil
+}
+
+// EditMessage replaces the text of a message sent by the bot
+func (c *MatrixChannel) EditMessage(ctx context.Context, chatID, messageID string, msg bus.OutboundMessage) error {
+	if len(msg.Content) > matrixChunkSize {
+		return fmt.Errorf("message of %d characters does not fit one matrix message", len(msg.Content))
+	}
+	newContent := c.textContent(msg.Content, msg.Formatted, "m.text")
+	content := map[string]interface{}{
+		"msgtype":       "m.text",
+		"body":          "* " + newContent["body"].(string),
+		"m.new_content": newContent,
+		"m.relates_to":  map[string]string{"rel_type": "m.replace", "event_id": messageID},
+	}
+	if html, ok := newContent["formatted_body"].(string); ok {
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = "* " + html
+	}
+	_, err := c.sendEvent(ctx, chatID, "m.room.message", content)
+	return err
+}
+
+// DeleteMessage redacts a message sent by the bot
+func (c *MatrixChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/redact/%s/%s",
+		url.PathEscape(chatID), url.PathEscape(messageID), c.nextTxnID())
+	return c.call(ctx, http.MethodPut, path, struct{}{}, nil)
+}
+
+var (
+	reHTMLBreak = regexp.MustCompile(`(?i)<br\s*/?>`)
+	reHTMLTag   = regexp.MustCompile(`<[^>]+>`)
+)
+
+// textContent builds the content of a text message. HTML goes in
+// formatted_body, with the text without markup as body for clients that
+// show no HTML.
+func (c *MatrixChannel) textContent(text string, formatted bool, msgType string) map[string]interface{} {
+	content := map[string]interface{}{"msgtype": msgType, "body": text}
+	switch {
+	case c.markup == format.HTML && formatted:
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = text
+		plain := reHTMLTag.ReplaceAllString(reHTMLBreak.ReplaceAllString(text, "\n"), "")
+		content["body"] = htmlUnescaper.Replace(plain)
+	case c.markup == format.HTML:
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = format.ToHTML(text)
+	case !formatted:
+		content["body"] = format.Convert(text, c.markup)
+	}
+	return content
+}
+
+// htmlUnescaper undoes the escaping of format.ToHTML
+var htmlUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'", "&amp;", "&")
+
+// setTyping shows or hides the typing notification in a room. Failures
+// are only logged.
+func (c *MatrixChannel) setTyping(ctx context.Context, roomID string, typing bool) {
+	body := map[string]interface{}{"typing": typing}
+	if typing {
+		body["timeout"] = matrixTypingTimeout.Milliseconds()
+	}
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/typing/%s", url.PathEscape(roomID), url.PathEscape(c.userID))
+	if err := c.call(ctx, http.MethodPut, path, body, nil); err != nil {
+		logger.DebugCF("matrix", "Failed to set typing notification", map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// sendEvent sends a room event and returns its ID
+func (c *MatrixChannel) sendEvent(ctx context.Context, roomID, eventType string, content interface{}) (string, error) {
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/%s/%s",
+		url.PathEscape(roomID), url.PathEscape(eventType), c.nextTxnID())
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.call(ctx, http.MethodPut, path, content, &resp); err != nil {
+		return "", fmt.Errorf("failed to send matrix event: %w", err)
+	}
+	return resp.EventID, nil
+}
+
+// nextTxnID returns a transaction ID, unique across restarts, that lets
+// the homeserver drop retried requests
+func (c *MatrixChannel) nextTxnID() string {
+	return fmt.Sprintf("%s-%d", c.txnBase, c.txnSeq.Add(1))
+}
+
+// call sends a client-server API request with a JSON body, if in is not
+// nil, and decodes the JSON response into out, if it is not nil
+func (c *MatrixChannel) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	return c.request(ctx, method, path, "application/json", body, out)
+}
+
+// request sends an authenticated request to the homeserver. Error
+// responses become errors; rate limits carry the delay the server asks for.
+func (c *MatrixChannel) request(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.homeserver+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			ErrCode      string `json:"errcode"`
+			Error        string `json:"error"`
+			RetryAfterMS int64  `json:"retry_after_ms"`
+		}
+		json.Unmarshal(data, &apiErr)
+		err := fmt.Errorf("matrix API %s returned status %d: %s %s", strings.SplitN(path, "?", 2)[0], resp.StatusCode, apiErr.ErrCode, apiErr.Error)
+		if resp.StatusCode == http.StatusTooManyRequests && apiErr.RetryAfterMS > 0 {
+			return &errs.RateLimitError{RetryAfter: time.Duration(apiErr.RetryAfterMS) * time.Millisecond, Err: err}
+		}
+		if classified := errs.FromHTTPStatus(resp.StatusCode, resp.Header.Get("Retry-After"), err); classified != nil {
+			return classified
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
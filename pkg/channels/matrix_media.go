@@ -0,0 +1,116 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// SetMediaDir makes the channel keep incoming files in dir, where the agent
+// can read them later. Without it files are downloaded to a temporary
+// directory and deleted once the message is handed over.
+func (c *MatrixChannel) SetMediaDir(dir string) {
+	c.mediaDir = dir
+}
+
+// parseMXC splits an mxc://server/media-id URI
+func parseMXC(uri string) (server, mediaID string, ok bool) {
+	rest, found := strings.CutPrefix(uri, "mxc://")
+	if !found {
+		return "", "", false
+	}
+	server, mediaID, found = strings.Cut(rest, "/")
+	if !found || server == "" || mediaID == "" || strings.Contains(mediaID, "/") {
+		return "", "", false
+	}
+	return server, mediaID, true
+}
+
+// downloadMedia downloads a file from the content repository and returns
+// its local path, or "" on failure. Homeservers older than Matrix 1.11
+// only serve the unauthenticated endpoint, which is tried second.
+func (c *MatrixChannel) downloadMedia(uri, name string) string {
+	server, mediaID, ok := parseMXC(uri)
+	if !ok {
+		return ""
+	}
+	ref := url.PathEscape(server) + "/" + url.PathEscape(mediaID)
+	opts := utils.DownloadOptions{
+		LoggerPrefix: "matrix",
+		Dir:          c.mediaDir,
+		ExtraHeaders: map[string]string{"Authorization": "Bearer " + c.config.AccessToken},
+	}
+	if path := utils.DownloadFile(c.homeserver+"/_matrix/client/v1/media/download/"+ref, name, opts); path != "" {
+		return path
+	}
+	return utils.DownloadFile(c.homeserver+"/_matrix/media/v3/download/"+ref, name, opts)
+}
+
+// matrixMsgType returns the message type for a file of the given MIME type
+func matrixMsgType(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "m.image"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "m.audio"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "m.video"
+	default:
+		return "m.file"
+	}
+}
+
+// sendAttachment uploads a file to the content repository and sends it to
+// the room, with its caption as the message body, and returns the event
+// ID. Remote files are sent as links.
+func (c *MatrixChannel) sendAttachment(ctx context.Context, roomID string, att bus.Attachment, formatted bool) (string, error) {
+	switch {
+	case att.Path != "":
+		data, err := os.ReadFile(att.Path)
+		if err != nil {
+			return "", fmt.Errorf("%w: attachment: %v", errs.ErrValidation, err)
+		}
+
+		name := filepath.Base(att.Path)
+		mimeType := att.MimeType
+		if mimeType == "" {
+			mimeType = mime.TypeByExtension(filepath.Ext(name))
+		}
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+
+		var uploaded struct {
+			ContentURI string `json:"content_uri"`
+		}
+		path := "/_matrix/media/v3/upload?filename=" + url.QueryEscape(name)
+		if err := c.request(ctx, http.MethodPost, path, mimeType, bytes.NewReader(data), &uploaded); err != nil {
+			return "", fmt.Errorf("failed to upload matrix file: %w", err)
+		}
+
+		content := map[string]interface{}{"body": name}
+		if strings.TrimSpace(att.Caption) != "" {
+			content = c.textContent(att.Caption, formatted, "")
+		}
+		content["msgtype"] = matrixMsgType(mimeType)
+		content["filename"] = name
+		content["url"] = uploaded.ContentURI
+		content["info"] = map[string]interface{}{"mimetype": mimeType, "size": len(data)}
+		return c.sendEvent(ctx, roomID, "m.room.message", content)
+	case att.URL != "":
+		content := c.textContent(appendContent(att.Caption, att.URL), formatted, "m.text")
+		return c.sendEvent(ctx, roomID, "m.room.message", content)
+	default:
+		return "", fmt.Errorf("%w: attachment has neither path nor url", errs.ErrValidation)
+	}
+}
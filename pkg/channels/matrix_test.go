@@ -0,0 +1,257 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeHomeserver answers the client-server API calls of the channel. Each
+// /sync after the first returns the next queued response.
+type fakeHomeserver struct {
+	mu       sync.Mutex
+	syncs    []string // Queued /sync responses
+	requests []string // "METHOD path" of every request but /sync
+	bodies   []map[string]interface{}
+}
+
+func (h *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"errcode":"M_UNKNOWN_TOKEN","error":"bad token"}`)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/_matrix/client/v3/account/whoami":
+		io.WriteString(w, `{"user_id":"@bot:example.org"}`)
+		return
+	case r.URL.Path == "/_matrix/client/v3/directory/room/#ops:example.org":
+		io.WriteString(w, `{"room_id":"!ops:example.org"}`)
+		return
+	case r.URL.Path == "/_matrix/client/v3/sync":
+		if r.URL.Query().Get("since") == "" {
+			io.WriteString(w, `{"next_batch":"s1"}`)
+			return
+		}
+		if len(h.syncs) == 0 {
+			// A long poll that times out
+			h.mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			h.mu.Lock()
+			io.WriteString(w, `{"next_batch":"s1"}`)
+			return
+		}
+		io.WriteString(w, h.syncs[0])
+		h.syncs = h.syncs[1:]
+		return
+	}
+
+	h.requests = append(h.requests, r.Method+" "+r.URL.Path)
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	h.bodies = append(h.bodies, body)
+	io.WriteString(w, `{"event_id":"$sent"}`)
+}
+
+// sent returns the requests whose path contains part, with their bodies
+func (h *fakeHomeserver) sent(part string) []map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var bodies []map[string]interface{}
+	for i, req := range h.requests {
+		if strings.Contains(req, part) {
+			bodies = append(bodies, h.bodies[i])
+		}
+	}
+	return bodies
+}
+
+func newTestMatrixChannel(t *testing.T, cfg config.MatrixConfig) (*MatrixChannel, *fakeHomeserver, *bus.MessageBus) {
+	t.Helper()
+	hs := &fakeHomeserver{}
+	srv := httptest.NewServer(hs)
+	t.Cleanup(srv.Close)
+
+	cfg.Homeserver = srv.URL + "/"
+	cfg.AccessToken = "token"
+	mb := bus.NewMessageBus()
+	ch, err := NewMatrixChannel(cfg, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch, hs, mb
+}
+
+func TestMatrixChannelReceivesMessages(t *testing.T) {
+	ch, hs, mb := newTestMatrixChannel(t, config.MatrixConfig{
+		AllowFrom:  config.FlexibleStringSlice{"@alice:example.org"},
+		AllowRooms: config.FlexibleStringSlice{"#ops:example.org"},
+	})
+	hs.syncs = []string{`{"next_batch":"s2","rooms":{"join":{
+		"!ops:example.org":{"timeline":{"events":[
+			{"type":"m.room.message","event_id":"$1","sender":"@bot:example.org","content":{"msgtype":"m.text","body":"my own reply"}},
+			{"type":"m.room.message","event_id":"$2","sender":"@mallory:example.org","content":{"msgtype":"m.text","body":"not allowed"}},
+			{"type":"m.room.message","event_id":"$3","sender":"@alice:example.org","content":{"msgtype":"m.text","body":"> <@bob:example.org> earlier\n\nwhat's up?","m.relates_to":{"m.in_reply_to":{"event_id":"$0"}}}},
+			{"type":"m.room.message","event_id":"$4","sender":"@alice:example.org","content":{"msgtype":"m.text","body":"* fixed","m.relates_to":{"rel_type":"m.replace","event_id":"$3"}}}
+		]}},
+		"!other:example.org":{"timeline":{"events":[
+			{"type":"m.room.message","event_id":"$5","sender":"@alice:example.org","content":{"msgtype":"m.text","body":"wrong room"}}
+		]}}
+	}}}`}
+
+	ctx := context.Background()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer ch.Stop(ctx)
+
+	recvCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(recvCtx)
+	if !ok {
+		t.Fatal("expected a message from alice")
+	}
+	if msg.ChatID != "!ops:example.org" || msg.SenderID != "@alice:example.org" || msg.Content != "what's up?" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if msg.Metadata["message_id"] != "$3" || msg.Metadata["reply_to"] != "$0" {
+		t.Errorf("unexpected metadata %v", msg.Metadata)
+	}
+	if typing := hs.sent("/typing/"); len(typing) == 0 || typing[0]["typing"] != true {
+		t.Errorf("expected a typing notification, got %v", typing)
+	}
+
+	// Nothing else gets through
+	shortCtx, cancelShort := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancelShort()
+	if extra, ok := mb.ConsumeInbound(shortCtx); ok {
+		t.Errorf("unexpected extra message %+v", extra)
+	}
+}
+
+func TestMatrixChannelSend(t *testing.T) {
+	ch, hs, _ := newTestMatrixChannel(t, config.MatrixConfig{})
+	ctx := context.Background()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Stop(ctx)
+
+	ids, err := ch.SendMessages(ctx, bus.OutboundMessage{ChatID: "!room:example.org", Content: "**done**", ReplyTo: "$3"})
+	if err != nil || len(ids) != 1 || ids[0] != "$sent" {
+		t.Fatalf("SendMessages() = %v, %v", ids, err)
+	}
+	sent := hs.sent("/send/m.room.message/")
+	if len(sent) != 1 {
+		t.Fatalf("expected one message, got %v", sent)
+	}
+	if sent[0]["body"] != "**done**" || sent[0]["formatted_body"] != "<b>done</b>" || sent[0]["format"] != "org.matrix.custom.html" {
+		t.Errorf("unexpected content %v", sent[0])
+	}
+	if relates, _ := sent[0]["m.relates_to"].(map[string]interface{}); relates["m.in_reply_to"] == nil {
+		t.Errorf("expected a reply relation, got %v", sent[0])
+	}
+
+	if err := ch.EditMessage(ctx, "!room:example.org", "$sent", bus.OutboundMessage{Content: "final"}); err != nil {
+		t.Fatal(err)
+	}
+	edit := hs.sent("/send/m.room.message/")[1]
+	newContent, _ := edit["m.new_content"].(map[string]interface{})
+	relates, _ := edit["m.relates_to"].(map[string]interface{})
+	if edit["body"] != "* final" || newContent["body"] != "final" || relates["rel_type"] != "m.replace" || relates["event_id"] != "$sent" {
+		t.Errorf("unexpected edit %v", edit)
+	}
+
+	if err := ch.DeleteMessage(ctx, "!room:example.org", "$sent"); err != nil {
+		t.Fatal(err)
+	}
+	if len(hs.sent("/redact/$sent/")) != 1 {
+		t.Error("expected a redaction")
+	}
+}
+
+func TestMatrixEncryptedNotice(t *testing.T) {
+	ch, hs, _ := newTestMatrixChannel(t, config.MatrixConfig{EncryptedRooms: MatrixEncryptedNotice})
+	ch.userID = "@bot:example.org"
+
+	var resp matrixSyncResponse
+	json.Unmarshal([]byte(`{"rooms":{"join":{"!secret:example.org":{"timeline":{"events":[
+		{"type":"m.room.encrypted","event_id":"$1","sender":"@alice:example.org","content":{}},
+		{"type":"m.room.encrypted","event_id":"$2","sender":"@alice:example.org","content":{}}
+	]}}}}}`), &resp)
+	ch.handleSync(context.Background(), &resp)
+
+	notices := hs.sent("/rooms/!secret:example.org/send/")
+	if len(notices) != 1 || notices[0]["msgtype"] != "m.notice" {
+		t.Errorf("expected a single notice, got %v", notices)
+	}
+}
+
+func TestMatrixAutoJoin(t *testing.T) {
+	ch, hs, _ := newTestMatrixChannel(t, config.MatrixConfig{
+		AutoJoin:  true,
+		AllowFrom: config.FlexibleStringSlice{"@alice:example.org"},
+	})
+	ch.userID = "@bot:example.org"
+
+	var resp matrixSyncResponse
+	json.Unmarshal([]byte(`{"rooms":{"invite":{
+		"!a:example.org":{"invite_state":{"events":[{"type":"m.room.member","sender":"@alice:example.org","state_key":"@bot:example.org","content":{"membership":"invite"}}]}},
+		"!b:example.org":{"invite_state":{"events":[{"type":"m.room.member","sender":"@mallory:example.org","state_key":"@bot:example.org","content":{"membership":"invite"}}]}}
+	}}}`), &resp)
+	ch.handleSync(context.Background(), &resp)
+
+	if joined := hs.sent("/join/"); len(joined) != 1 || len(hs.sent("/join/!a:example.org")) != 1 {
+		t.Errorf("expected to join only alice's room, got %v", hs.requests)
+	}
+}
+
+func TestStripMatrixReplyFallback(t *testing.T) {
+	tests := map[string]string{
+		"plain":                            "plain",
+		"> <@a:x> quoted\n> more\n\nreply": "reply",
+		"> only a quote":                   "> only a quote",
+	}
+	for in, want := range tests {
+		if got := stripMatrixReplyFallback(in); got != want {
+			t.Errorf("stripMatrixReplyFallback(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseMXC(t *testing.T) {
+	server, id, ok := parseMXC("mxc://example.org/abc123")
+	if !ok || server != "example.org" || id != "abc123" {
+		t.Errorf("parseMXC() = %q, %q, %v", server, id, ok)
+	}
+	for _, bad := range []string{"https://example.org/abc", "mxc://example.org", "mxc:///abc", "mxc://example.org/a/b"} {
+		if _, _, ok := parseMXC(bad); ok {
+			t.Errorf("parseMXC(%q) should fail", bad)
+		}
+	}
+}
+
+func TestMatrixMsgType(t *testing.T) {
+	for mimeType, want := range map[string]string{
+		"image/png":       "m.image",
+		"audio/ogg":       "m.audio",
+		"video/mp4":       "m.video",
+		"application/pdf": "m.file",
+	} {
+		if got := matrixMsgType(mimeType); got != want {
+			t.Errorf("matrixMsgType(%q) = %q, want %q", mimeType, got, want)
+		}
+	}
+}
@@ -0,0 +1,574 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	mattermostDialTimeout  = 10 * time.Second
+	mattermostPingInterval = 30 * time.Second
+	mattermostReadTimeout  = 2 * mattermostPingInterval // Without a message or pong the connection is dead
+	mattermostHTTPTimeout  = 60 * time.Second
+	mattermostChunkSize    = 16000 // Characters per post, within the 16383 limit
+)
+
+// MattermostChannel talks to a Mattermost server with a personal access
+// token. Posts arrive over the WebSocket API and replies are created through
+// the REST API. Chat IDs are channel IDs, or channelID/rootID for threads.
+type MattermostChannel struct {
+	*BaseChannel
+	config   config.MattermostConfig
+	server   string // Without the trailing slash
+	wsURL    string
+	client   *http.Client
+	markup   format.Style
+	mediaDir string // Where incoming files are kept; empty uses temp files
+
+	userID   string          // The bot's own user ID
+	channels map[string]bool // Allowed channel IDs; empty allows every channel
+	retry    *ConnectionRetry
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewMattermostChannel creates a Mattermost channel for the server at cfg.URL
+func NewMattermostChannel(cfg config.MattermostConfig, messageBus *bus.MessageBus) (*MattermostChannel, error) {
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("mattermost url and token are required")
+	}
+	server, err := url.Parse(strings.TrimRight(cfg.URL, "/"))
+	if err != nil || server.Host == "" {
+		return nil, fmt.Errorf("invalid mattermost url %q", cfg.URL)
+	}
+	ws := *server
+	switch server.Scheme {
+	case "https":
+		ws.Scheme = "wss"
+	case "http":
+		ws.Scheme = "ws"
+	default:
+		return nil, fmt.Errorf("mattermost url %q must be http or https", cfg.URL)
+	}
+	ws.Path += "/api/v4/websocket"
+
+	markup, err := format.ParseStyle(cfg.Format, format.Markdown)
+	if err != nil {
+		logger.WarnCF("mattermost", "Invalid format, using the default", map[string]interface{}{
+			"error":  err.Error(),
+			"format": string(markup),
+		})
+	}
+
+	c := &MattermostChannel{
+		BaseChannel: NewBaseChannel("mattermost", cfg, messageBus, cfg.AllowFrom),
+		config:      cfg,
+		server:      server.String(),
+		wsURL:       ws.String(),
+		client:      &http.Client{Timeout: mattermostHTTPTimeout},
+		markup:      markup,
+		retry:       NewConnectionRetryWithPolicy(RetryPolicy{MaxAttempts: UnlimitedRetries, Jitter: 0.2}),
+		stopCh:      make(chan struct{}),
+	}
+	// The WebSocket comes and goes while the channel runs
+	c.reportsHealth()
+	return c, nil
+}
+
+// Start checks the token, resolves the allowed channels and connects the
+// WebSocket. If the WebSocket cannot connect the channel still starts and
+// keeps reconnecting in the background.
+func (c *MattermostChannel) Start(ctx context.Context) error {
+	logger.InfoC("mattermost", "Starting Mattermost channel")
+
+	var me struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/api/v4/users/me", nil, &me); err != nil {
+		return fmt.Errorf("mattermost login failed: %w", err)
+	}
+	c.userID = me.ID
+	c.channels = c.resolveChannels(ctx, c.config.AllowChannels)
+
+	conn, err := c.connect(ctx)
+	if err != nil {
+		logger.WarnCF("mattermost", "Mattermost WebSocket connection failed, retrying in background", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	c.setRunning(true)
+	c.wg.Add(1)
+	go c.connectLoop(ctx, conn)
+	logger.InfoCF("mattermost", "Mattermost channel started", map[string]interface{}{
+		"username": me.Username,
+		"channels": len(c.channels),
+	})
+	return nil
+}
+
+// Stop closes the WebSocket
+func (c *MattermostChannel) Stop(ctx context.Context) error {
+	logger.InfoC("mattermost", "Stopping Mattermost channel")
+	c.stopOnce.Do(func() { close(c.stopCh) })
+
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+	c.setRunning(false)
+	c.setHealth(StateDisconnected, "stopped")
+	return nil
+}
+
+// Markup returns the markup the channel sends
+func (c *MattermostChannel) Markup() format.Style {
+	return c.markup
+}
+
+// resolveChannels turns channel IDs and team/channel names into a set of
+// channel IDs. Names that cannot be resolved are left out, with a warning.
+func (c *MattermostChannel) resolveChannels(ctx context.Context, entries []string) map[string]bool {
+	channels := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		team, name, ok := strings.Cut(entry, "/")
+		if !ok {
+			channels[entry] = true
+			continue
+		}
+		var resolved struct {
+			ID string `json:"id"`
+		}
+		path := fmt.Sprintf("/api/v4/teams/name/%s/channels/name/%s", url.PathEscape(team), url.PathEscape(name))
+		if err := c.call(ctx, http.MethodGet, path, nil, &resolved); err != nil {
+			logger.WarnCF("mattermost", "Failed to resolve channel name, leaving it out", map[string]interface{}{
+				"channel": entry,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		channels[resolved.ID] = true
+	}
+	return channels
+}
+
+// channelAllowed reports whether the bot answers in channelID
+func (c *MattermostChannel) channelAllowed(channelID string) bool {
+	return len(c.config.AllowChannels) == 0 || c.channels[channelID]
+}
+
+// connect opens the WebSocket, authenticated by the token header
+func (c *MattermostChannel) connect(ctx context.Context) (*websocket.Conn, error) {
+	c.setHealth(StateConnecting, "")
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: mattermostDialTimeout,
+	}
+	header := http.Header{"Authorization": {"Bearer " + c.config.Token}}
+	conn, _, err := dialer.DialContext(ctx, c.wsURL, header)
+	if err != nil {
+		c.setHealth(StateDisconnected, err.Error())
+		return nil, fmt.Errorf("failed to connect to mattermost websocket: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.stopped(ctx) {
+		c.mu.Unlock()
+		conn.Close()
+		return nil, fmt.Errorf("mattermost channel stopped")
+	}
+	c.conn = conn
+	c.mu.Unlock()
+	c.retry.Connected()
+	c.setHealth(StateConnected, "")
+	logger.InfoCF("mattermost", "Mattermost WebSocket connected", map[string]interface{}{
+		"server": c.server,
+	})
+	return conn, nil
+}
+
+// connectLoop reads from the WebSocket and reconnects whenever it drops,
+// until the channel stops
+func (c *MattermostChannel) connectLoop(ctx context.Context, conn *websocket.Conn) {
+	defer c.wg.Done()
+	for {
+		if conn != nil {
+			err := c.readLoop(ctx, conn)
+			conn.Close()
+			c.mu.Lock()
+			if c.conn == conn {
+				c.conn = nil
+			}
+			c.mu.Unlock()
+			if c.stopped(ctx) {
+				return
+			}
+			c.retry.Disconnected()
+			c.setHealth(StateDisconnected, err.Error())
+		}
+
+		select {
+		case <-time.After(c.retry.NextDelay()):
+		case <-ctx.Done():
+			return
+		case <-c.stopCh:
+			return
+		}
+
+		var err error
+		if conn, err = c.connect(ctx); err != nil {
+			logger.WarnCF("mattermost", "Mattermost reconnection failed", map[string]interface{}{
+				"attempt": c.retry.GetAttempts(),
+				"error":   err.Error(),
+			})
+		}
+	}
+}
+
+// stopped reports whether the channel is shutting down
+func (c *MattermostChannel) stopped(ctx context.Context) bool {
+	select {
+	case <-c.stopCh:
+		return true
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// Mattermost WebSocket event, reduced to what the channel reads
+type mattermostEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type mattermostPostedData struct {
+	Post        string `json:"post"` // The post, JSON encoded
+	ChannelType string `json:"channel_type"`
+	SenderName  string `json:"sender_name"`
+}
+
+type mattermostPost struct {
+	ID        string   `json:"id"`
+	ChannelID string   `json:"channel_id"`
+	UserID    string   `json:"user_id"`
+	RootID    string   `json:"root_id"`
+	Message   string   `json:"message"`
+	Type      string   `json:"type"` // Empty for user posts, system_* otherwise
+	FileIDs   []string `json:"file_ids"`
+}
+
+// readLoop handles events until the connection fails. Pings keep it alive
+// and detect a dead server.
+func (c *MattermostChannel) readLoop(ctx context.Context, conn *websocket.Conn) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(mattermostPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(mattermostDialTimeout)); err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(mattermostReadTimeout))
+	})
+
+	for {
+		// Leave posts with the server while the agent is overloaded
+		if err := c.waitForAgent(ctx); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(mattermostReadTimeout))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var ev mattermostEvent
+		if err := json.Unmarshal(data, &ev); err != nil || ev.Event != "posted" {
+			continue
+		}
+		var posted mattermostPostedData
+		var post mattermostPost
+		if json.Unmarshal(ev.Data, &posted) != nil || json.Unmarshal([]byte(posted.Post), &post) != nil {
+			logger.DebugCF("mattermost", "Ignoring malformed post event", nil)
+			continue
+		}
+		c.handlePost(ctx, &post, posted.ChannelType, strings.TrimPrefix(posted.SenderName, "@"))
+	}
+}
+
+// isDirectChannel reports whether a channel type is a direct or group
+// message, which are answered wherever allowed senders write
+func isDirectChannel(channelType string) bool {
+	return channelType == "D" || channelType == "G"
+}
+
+// handlePost passes a post from an allowed user to the agent
+func (c *MattermostChannel) handlePost(ctx context.Context, post *mattermostPost, channelType, username string) {
+	if post.UserID == c.userID || post.Type != "" {
+		return
+	}
+	direct := isDirectChannel(channelType)
+	if !direct && !c.channelAllowed(post.ChannelID) {
+		return
+	}
+	// Usernames match allow_from entries such as "@alice"
+	senderID := post.UserID
+	if username != "" {
+		senderID += "|" + username
+	}
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("mattermost", "Message rejected by allowlist", map[string]interface{}{
+			"sender_id": senderID,
+		})
+		return
+	}
+
+	chatID := post.ChannelID
+	rootID := post.RootID
+	if rootID == "" && c.config.ReplyInThreads && !direct {
+		rootID = post.ID
+	}
+	if rootID != "" {
+		chatID = post.ChannelID + "/" + rootID
+	}
+
+	content := post.Message
+	var mediaPaths []string
+	var localFiles []string
+	defer func() {
+		for _, file := range localFiles {
+			if err := os.Remove(file); err != nil {
+				logger.DebugCF("mattermost", "Failed to cleanup temp file", map[string]interface{}{
+					"file":  file,
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+	for _, fileID := range post.FileIDs {
+		name, localPath := c.downloadFile(ctx, fileID)
+		if localPath != "" {
+			if c.mediaDir == "" {
+				localFiles = append(localFiles, localPath)
+			}
+			mediaPaths = append(mediaPaths, localPath)
+		}
+		content = appendContent(content, fmt.Sprintf("[file: %s]", name))
+	}
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	metadata := map[string]string{
+		"platform":   "mattermost",
+		"message_id": post.ID,
+		"channel_id": post.ChannelID,
+		"root_id":    post.RootID,
+	}
+
+	logger.DebugCF("mattermost", "Received message", map[string]interface{}{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.setTyping(ctx, post.ChannelID, rootID)
+	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+}
+
+// setTyping shows the typing indicator in a channel or thread. Failures
+// are only logged.
+func (c *MattermostChannel) setTyping(ctx context.Context, channelID, rootID string) {
+	body := map[string]string{"channel_id": channelID, "parent_id": rootID}
+	if err := c.call(ctx, http.MethodPost, "/api/v4/users/"+url.PathEscape(c.userID)+"/typing", body, nil); err != nil {
+		logger.DebugCF("mattermost", "Failed to set typing indicator", map[string]interface{}{
+			"channel_id": channelID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// parseMattermostChatID splits a chat ID into channel and thread root
+func parseMattermostChatID(chatID string) (channelID, rootID string) {
+	channelID, rootID, _ = strings.Cut(chatID, "/")
+	return channelID, rootID
+}
+
+// Send sends msg to its channel or thread
+func (c *MattermostChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	_, err := c.SendMessages(ctx, msg)
+	return err
+}
+
+// SendMessages sends msg and returns the IDs of the posts that carry it, so
+// they can be edited or deleted later. Files are posted into the same
+// thread, one post each with its caption.
+func (c *MattermostChannel) SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error) {
+	if !c.IsRunning() {
+		return nil, fmt.Errorf("%w: mattermost channel not running", errs.ErrChannelDown)
+	}
+	channelID, rootID := parseMattermostChatID(msg.ChatID)
+	if channelID == "" {
+		return nil, fmt.Errorf("%w: mattermost channel ID is empty", errs.ErrValidation)
+	}
+
+	if msg.Reaction != "" {
+		if msg.ReplyTo == "" {
+			return nil, fmt.Errorf("%w: reaction requires a message to react to", errs.ErrValidation)
+		}
+		return nil, c.call(ctx, http.MethodPost, "/api/v4/reactions", map[string]string{
+			"user_id":    c.userID,
+			"post_id":    msg.ReplyTo,
+			"emoji_name": strings.Trim(msg.Reaction, ":"),
+		}, nil)
+	}
+
+	if !msg.Formatted {
+		msg.Content = format.Convert(msg.Content, c.markup)
+	}
+
+	var ids []string
+	if strings.TrimSpace(msg.Content) != "" || len(msg.Attachments) == 0 {
+		for _, chunk := range splitMessage(msg.Content, mattermostChunkSize) {
+			id, err := c.createPost(ctx, channelID, rootID, chunk, nil)
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	for _, att := range msg.Attachments {
+		id, err := c.sendAttachment(ctx, channelID, rootID, att, msg.Formatted)
+		ids = appendID(ids, id)
+		if err != nil {
+			return ids, err
+		}
+	}
+	return ids, nil
+}
+
+// EditMessage replaces the text of a post made by the bot
+func (c *MattermostChannel) EditMessage(ctx context.Context, chatID, messageID string, msg bus.OutboundMessage) error {
+	if !msg.Formatted {
+		msg.Content = format.Convert(msg.Content, c.markup)
+	}
+	if len(msg.Content) > mattermostChunkSize {
+		return fmt.Errorf("message of %d characters does not fit one mattermost post", len(msg.Content))
+	}
+	return c.call(ctx, http.MethodPut, "/api/v4/posts/"+url.PathEscape(messageID)+"/patch",
+		map[string]string{"message": msg.Content}, nil)
+}
+
+// DeleteMessage deletes a post made by the bot
+func (c *MattermostChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	return c.call(ctx, http.MethodDelete, "/api/v4/posts/"+url.PathEscape(messageID), nil, nil)
+}
+
+// createPost creates a post and returns its ID
+func (c *MattermostChannel) createPost(ctx context.Context, channelID, rootID, message string, fileIDs []string) (string, error) {
+	post := map[string]interface{}{
+		"channel_id": channelID,
+		"root_id":    rootID,
+		"message":    message,
+	}
+	if len(fileIDs) > 0 {
+		post["file_ids"] = fileIDs
+	}
+	var created mattermostPost
+	if err := c.call(ctx, http.MethodPost, "/api/v4/posts", post, &created); err != nil {
+		return "", fmt.Errorf("failed to send mattermost post: %w", err)
+	}
+	return created.ID, nil
+}
+
+// call sends a REST API request with a JSON body, if in is not nil, and
+// decodes the JSON response into out, if it is not nil
+func (c *MattermostChannel) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	return c.request(ctx, method, path, "application/json", body, out)
+}
+
+// request sends an authenticated request to the server. Error responses
+// become errors; rate limits carry the delay the server asks for.
+func (c *MattermostChannel) request(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			ID      string `json:"id"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		err := fmt.Errorf("mattermost API %s returned status %d: %s", path, resp.StatusCode, apiErr.Message)
+		if classified := errs.FromHTTPStatus(resp.StatusCode, resp.Header.Get("Retry-After"), err); classified != nil {
+			return classified
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,101 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// SetMediaDir makes the channel keep incoming files in dir, where the agent
+// can read them later. Without it files are downloaded to a temporary
+// directory and deleted once the message is handed over.
+func (c *MattermostChannel) SetMediaDir(dir string) {
+	c.mediaDir = dir
+}
+
+// downloadFile downloads an attached file and returns its name and local
+// path, or "" as path on failure
+func (c *MattermostChannel) downloadFile(ctx context.Context, fileID string) (string, string) {
+	var info struct {
+		Name string `json:"name"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/api/v4/files/"+url.PathEscape(fileID)+"/info", nil, &info); err != nil {
+		logger.WarnCF("mattermost", "Failed to get file info", map[string]interface{}{
+			"file_id": fileID,
+			"error":   err.Error(),
+		})
+		return fileID, ""
+	}
+	path := utils.DownloadFile(c.server+"/api/v4/files/"+url.PathEscape(fileID), info.Name, utils.DownloadOptions{
+		LoggerPrefix: "mattermost",
+		Dir:          c.mediaDir,
+		ExtraHeaders: map[string]string{"Authorization": "Bearer " + c.config.Token},
+	})
+	return info.Name, path
+}
+
+// sendAttachment uploads a file and posts it with its caption, and returns
+// the post ID. Remote files are posted as links.
+func (c *MattermostChannel) sendAttachment(ctx context.Context, channelID, rootID string, att bus.Attachment, formatted bool) (string, error) {
+	caption := att.Caption
+	if !formatted {
+		caption = format.Convert(caption, c.markup)
+	}
+	switch {
+	case att.Path != "":
+		data, err := os.ReadFile(att.Path)
+		if err != nil {
+			return "", fmt.Errorf("%w: attachment: %v", errs.ErrValidation, err)
+		}
+		fileID, err := c.uploadFile(ctx, channelID, filepath.Base(att.Path), data)
+		if err != nil {
+			return "", err
+		}
+		return c.createPost(ctx, channelID, rootID, strings.TrimSpace(caption), []string{fileID})
+	case att.URL != "":
+		return c.createPost(ctx, channelID, rootID, appendContent(caption, att.URL), nil)
+	default:
+		return "", fmt.Errorf("%w: attachment has neither path nor url", errs.ErrValidation)
+	}
+}
+
+// uploadFile uploads a file to a channel and returns its ID, to be
+// attached to a post
+func (c *MattermostChannel) uploadFile(ctx context.Context, channelID, name string, data []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("channel_id", channelID)
+	part, err := form.CreateFormFile("files", name)
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	var uploaded struct {
+		FileInfos []struct {
+			ID string `json:"id"`
+		} `json:"file_infos"`
+	}
+	if err := c.request(ctx, http.MethodPost, "/api/v4/files", form.FormDataContentType(), &body, &uploaded); err != nil {
+		return "", fmt.Errorf("failed to upload mattermost file: %w", err)
+	}
+	if len(uploaded.FileInfos) == 0 {
+		return "", fmt.Errorf("mattermost upload of %s returned no file", name)
+	}
+	return uploaded.FileInfos[0].ID, nil
+}
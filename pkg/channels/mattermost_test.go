@@ -0,0 +1,247 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeMattermost answers the REST calls of the channel and pushes events
+// queued on events to its WebSocket
+type fakeMattermost struct {
+	mu       sync.Mutex
+	requests []string // "METHOD path" of every REST request
+	posts    []map[string]interface{}
+	uploads  []string // Names of uploaded files
+	sockets  int      // WebSocket connections accepted
+	events   chan string
+}
+
+func (s *fakeMattermost) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"id":"api.context.session_expired.app_error","message":"Invalid or expired session"}`)
+		return
+	}
+	if r.URL.Path == "/api/v4/websocket" {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.mu.Lock()
+		s.sockets++
+		s.mu.Unlock()
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"hello","data":{"server_version":"9.11"}}`))
+		for {
+			select {
+			case <-closed:
+				return
+			case ev, ok := <-s.events:
+				if !ok || conn.WriteMessage(websocket.TextMessage, []byte(ev)) != nil {
+					return
+				}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	switch {
+	case r.URL.Path == "/api/v4/users/me":
+		io.WriteString(w, `{"id":"bot","username":"picoclaw"}`)
+	case r.URL.Path == "/api/v4/teams/name/eng/channels/name/ops":
+		io.WriteString(w, `{"id":"ops"}`)
+	case r.URL.Path == "/api/v4/files/f1/info":
+		io.WriteString(w, `{"id":"f1","name":"notes.txt"}`)
+	case r.URL.Path == "/api/v4/files/f1":
+		io.WriteString(w, "file contents")
+	case r.URL.Path == "/api/v4/files" && r.Method == http.MethodPost:
+		_, header, err := r.FormFile("files")
+		if err != nil || r.FormValue("channel_id") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.uploads = append(s.uploads, header.Filename)
+		io.WriteString(w, `{"file_infos":[{"id":"up1"}]}`)
+	case r.URL.Path == "/api/v4/posts" && r.Method == http.MethodPost:
+		var post map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&post)
+		s.posts = append(s.posts, post)
+		io.WriteString(w, `{"id":"p`+string(rune('0'+len(s.posts)))+`"}`)
+	default:
+		io.WriteString(w, `{}`)
+	}
+}
+
+// postedEvent builds a "posted" WebSocket event
+func postedEvent(t *testing.T, post mattermostPost, channelType, sender string) string {
+	t.Helper()
+	encoded, _ := json.Marshal(post)
+	data, _ := json.Marshal(mattermostPostedData{Post: string(encoded), ChannelType: channelType, SenderName: sender})
+	ev, _ := json.Marshal(map[string]interface{}{"event": "posted", "data": json.RawMessage(data)})
+	return string(ev)
+}
+
+func startTestMattermost(t *testing.T, cfg config.MattermostConfig) (*MattermostChannel, *fakeMattermost, *bus.MessageBus) {
+	t.Helper()
+	fake := &fakeMattermost{events: make(chan string, 10)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(fake.events) })
+
+	cfg.URL = server.URL
+	cfg.Token = "token"
+	msgBus := bus.NewMessageBus()
+	c, err := NewMattermostChannel(cfg, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.retry = NewConnectionRetryWithPolicy(RetryPolicy{MaxAttempts: UnlimitedRetries, InitialDelay: 10 * time.Millisecond})
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Stop(context.Background()) })
+	return c, fake, msgBus
+}
+
+func TestMattermostChannelRoundTrip(t *testing.T) {
+	c, fake, msgBus := startTestMattermost(t, config.MattermostConfig{
+		AllowFrom:      []string{"@alice"},
+		AllowChannels:  []string{"eng/ops"},
+		ReplyInThreads: true,
+	})
+	c.SetMediaDir(t.TempDir())
+	if !c.Health().State.Ready() {
+		t.Errorf("health = %v, want connected", c.Health())
+	}
+
+	// Ignored: another channel, another user, the bot itself and system posts
+	fake.events <- postedEvent(t, mattermostPost{ID: "a", ChannelID: "random", UserID: "u1", Message: "hi"}, "O", "@alice")
+	fake.events <- postedEvent(t, mattermostPost{ID: "b", ChannelID: "ops", UserID: "u2", Message: "hi"}, "O", "@mallory")
+	fake.events <- postedEvent(t, mattermostPost{ID: "c", ChannelID: "ops", UserID: "bot", Message: "hi"}, "O", "@picoclaw")
+	fake.events <- postedEvent(t, mattermostPost{ID: "d", ChannelID: "ops", UserID: "u1", Type: "system_join_channel"}, "O", "@alice")
+	fake.events <- postedEvent(t, mattermostPost{ID: "e", ChannelID: "ops", UserID: "u1", Message: "summarize this", FileIDs: []string{"f1"}}, "O", "@alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	in, ok := msgBus.ConsumeInbound(ctx)
+	if !ok || in.SenderID != "u1|alice" || in.ChatID != "ops/e" || in.Content != "summarize this\n[file: notes.txt]" {
+		t.Fatalf("unexpected inbound %+v", in)
+	}
+	if len(in.Media) != 1 {
+		t.Fatalf("media = %v", in.Media)
+	}
+	if data, _ := os.ReadFile(in.Media[0]); string(data) != "file contents" {
+		t.Errorf("downloaded %q", data)
+	}
+
+	// Direct messages are answered whatever the channel allowlist
+	fake.events <- postedEvent(t, mattermostPost{ID: "f", ChannelID: "dm", UserID: "u1", Message: "hello"}, "D", "@alice")
+	if in, _ := msgBus.ConsumeInbound(ctx); in.ChatID != "dm" || in.Content != "hello" {
+		t.Errorf("unexpected direct message %+v", in)
+	}
+
+	attachment := filepath.Join(t.TempDir(), "report.csv")
+	os.WriteFile(attachment, []byte("a,b"), 0644)
+	err := c.Send(ctx, bus.OutboundMessage{
+		ChatID:      "ops/e",
+		Content:     "Done **quickly**",
+		Attachments: []bus.Attachment{{Path: attachment, Caption: "The report"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.posts) != 2 {
+		t.Fatalf("got %d posts, want 2: %v", len(fake.posts), fake.posts)
+	}
+	text, file := fake.posts[0], fake.posts[1]
+	if text["channel_id"] != "ops" || text["root_id"] != "e" || text["message"] != "Done **quickly**" {
+		t.Errorf("unexpected text post %v", text)
+	}
+	if file["root_id"] != "e" || file["message"] != "The report" || len(fake.uploads) != 1 || fake.uploads[0] != "report.csv" {
+		t.Errorf("unexpected file post %v, uploads %v", file, fake.uploads)
+	}
+	if !strings.Contains(strings.Join(fake.requests, "\n"), "POST /api/v4/users/bot/typing") {
+		t.Error("typing indicator was not shown")
+	}
+}
+
+func TestMattermostChannelReconnects(t *testing.T) {
+	c, fake, msgBus := startTestMattermost(t, config.MattermostConfig{})
+
+	// Dropping the connection from the client side forces a reconnect
+	c.mu.Lock()
+	c.conn.Close()
+	c.mu.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fake.mu.Lock()
+		sockets := fake.sockets
+		fake.mu.Unlock()
+		if sockets == 2 && c.Health().State.Ready() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("did not reconnect: %v", c.Health())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	fake.events <- postedEvent(t, mattermostPost{ID: "a", ChannelID: "town", UserID: "u1", Message: "still there?"}, "O", "@alice")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if in, ok := msgBus.ConsumeInbound(ctx); !ok || in.Content != "still there?" {
+		t.Errorf("unexpected inbound %+v", in)
+	}
+}
+
+func TestNewMattermostChannelValidation(t *testing.T) {
+	c, err := NewMattermostChannel(config.MattermostConfig{URL: "https://chat.example.org/", Token: "t"}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.wsURL != "wss://chat.example.org/api/v4/websocket" {
+		t.Errorf("wsURL = %q", c.wsURL)
+	}
+	for _, cfg := range []config.MattermostConfig{
+		{URL: "https://chat.example.org"},
+		{URL: "ftp://chat.example.org", Token: "t"},
+		{URL: "chat.example.org", Token: "t"},
+	} {
+		if _, err := NewMattermostChannel(cfg, bus.NewMessageBus()); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+	if channelID, rootID := parseMattermostChatID("abc/def"); channelID != "abc" || rootID != "def" {
+		t.Errorf("parseMattermostChatID = %q, %q", channelID, rootID)
+	}
+}
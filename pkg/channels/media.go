@@ -0,0 +1,140 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// mediaCheckInterval is how often the media directory is probed
+const mediaCheckInterval = time.Minute
+
+// mediaDroppedNote replaces attachments received while media is down
+const mediaDroppedNote = "[attachments dropped: media storage is unavailable]"
+
+// mediaPipeline tracks whether incoming files can be stored. While it is
+// down, channels run text-only: attachments are dropped and a note is
+// added to the message instead.
+type mediaPipeline struct {
+	root string
+	mu   sync.RWMutex
+	err  error
+}
+
+// mediaKeeper is implemented by channels that receive attachments
+type mediaKeeper interface {
+	setMediaPipeline(media *mediaPipeline)
+}
+
+// Err returns why the media pipeline is down, or nil when it works
+func (p *mediaPipeline) Err() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.err
+}
+
+// check probes the media directory and logs changes of state
+func (p *mediaPipeline) check() {
+	p.mu.RLock()
+	root := p.root
+	p.mu.RUnlock()
+	if root == "" {
+		return
+	}
+
+	err := probeMediaDir(root)
+
+	p.mu.Lock()
+	was := p.err
+	p.err = err
+	p.mu.Unlock()
+
+	switch {
+	case err != nil && was == nil:
+		logger.WarnCF("channels", "Media storage unavailable, running text-only", map[string]interface{}{
+			"dir":   root,
+			"error": err.Error(),
+		})
+	case err == nil && was != nil:
+		logger.InfoCF("channels", "Media storage recovered", map[string]interface{}{
+			"dir": root,
+		})
+	}
+}
+
+// run re-probes the media directory until ctx is done
+func (p *mediaPipeline) run(ctx context.Context) {
+	ticker := time.NewTicker(mediaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.check()
+		}
+	}
+}
+
+// probeMediaDir checks that files can be created under dir
+func probeMediaDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "probe-*.tmp")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// SetMediaDir makes the channels keep incoming files under root, one
+// directory per channel, where the agent can use them after the message is
+// handled. The directory is probed periodically; while it cannot be written
+// the channels run text-only.
+func (m *Manager) SetMediaDir(root string) {
+	m.mu.RLock()
+	for name, channel := range m.channels {
+		if mc, ok := channel.(interface{ SetMediaDir(string) }); ok {
+			mc.SetMediaDir(filepath.Join(root, name))
+		}
+	}
+	m.mu.RUnlock()
+
+	m.media.mu.Lock()
+	m.media.root = root
+	m.media.mu.Unlock()
+	m.media.check()
+}
+
+// MediaErr returns why incoming attachments are being dropped, or nil when
+// the media pipeline works
+func (m *Manager) MediaErr() error {
+	return m.media.Err()
+}
+
+func (c *BaseChannel) setMediaPipeline(media *mediaPipeline) {
+	c.media = media
+}
+
+// dropMedia removes attachments that cannot be kept and notes it in content
+func dropMedia(media []string, content string) string {
+	for _, path := range media {
+		if filepath.IsAbs(path) {
+			os.Remove(path)
+		}
+	}
+	if content == "" {
+		return mediaDroppedNote
+	}
+	return content + "\n" + mediaDroppedNote
+}
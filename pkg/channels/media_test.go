@@ -0,0 +1,50 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestMediaPipelineTextOnly(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, mb, nil)
+	m := &Manager{channels: map[string]Channel{}, bus: mb, media: &mediaPipeline{}}
+	ch.setMediaPipeline(m.media)
+	ctx := context.Background()
+
+	// A file where the media directory should be makes it unwritable
+	root := filepath.Join(t.TempDir(), "media")
+	if err := os.WriteFile(root, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.SetMediaDir(root)
+	if m.MediaErr() == nil {
+		t.Fatal("MediaErr() = nil for an unwritable media directory")
+	}
+
+	photo := filepath.Join(t.TempDir(), "photo.jpg")
+	os.WriteFile(photo, []byte("jpeg"), 0644)
+	ch.HandleMessage("alice", "chat1", "look", []string{photo}, nil)
+	msg, _ := mb.ConsumeInbound(ctx)
+	if len(msg.Media) != 0 || msg.Content != "look\n"+mediaDroppedNote {
+		t.Errorf("text-only message = %q with media %v", msg.Content, msg.Media)
+	}
+	if _, err := os.Stat(photo); !os.IsNotExist(err) {
+		t.Error("dropped attachment was not removed")
+	}
+
+	// Once the directory is usable again attachments pass through
+	os.Remove(root)
+	m.media.check()
+	if err := m.MediaErr(); err != nil {
+		t.Fatalf("MediaErr() after recovery = %v", err)
+	}
+	ch.HandleMessage("alice", "chat1", "look", []string{"/tmp/photo.jpg"}, nil)
+	if msg, _ := mb.ConsumeInbound(ctx); len(msg.Media) != 1 || msg.Content != "look" {
+		t.Errorf("message after recovery = %q with media %v", msg.Content, msg.Media)
+	}
+}
@@ -0,0 +1,619 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// DefaultMessengerWebhookPath is where Facebook posts to when webhook_path
+// is not set
+const DefaultMessengerWebhookPath = "/messenger/webhook"
+
+// Send API limits
+const (
+	messengerChunkSize             = 2000 // Characters per text message
+	messengerMaxQuickReplies       = 13
+	messengerQuickReplyTitleRunes  = 20
+	messengerQuickReplyPayloadSize = 1000
+)
+
+// Messaging types of the Send API
+const (
+	messengerResponse   = "RESPONSE"    // Reply within the 24 hour window
+	messengerUpdate     = "UPDATE"      // Proactive message within the window
+	messengerMessageTag = "MESSAGE_TAG" // Tagged message, allowed after the window
+)
+
+// MessengerChannel serves a Facebook Page on Messenger. Message events
+// arrive through the page webhook on the gateway HTTP server and replies go
+// out through the Send API. Chat IDs are page-scoped user IDs (PSIDs).
+type MessengerChannel struct {
+	*BaseChannel
+	config   config.MessengerConfig
+	graph    *graphClient
+	app      *graphClient // Calls with the app token; nil without app_id
+	markup   format.Style
+	mediaDir string // Where incoming files are kept; empty uses temp files
+
+	pageID    string
+	personaID string // Replies are sent as this persona when set
+}
+
+// NewMessengerChannel creates a Messenger channel for the page of
+// cfg.PageAccessToken
+func NewMessengerChannel(cfg config.MessengerConfig, messageBus *bus.MessageBus) (*MessengerChannel, error) {
+	if cfg.PageAccessToken == "" || cfg.AppSecret == "" || cfg.VerifyToken == "" {
+		return nil, fmt.Errorf("messenger page_access_token, app_secret and verify_token are required")
+	}
+	markup, err := format.ParseStyle(cfg.Format, format.WhatsApp)
+	if err != nil {
+		logger.WarnCF("messenger", "Invalid format, using the default", map[string]interface{}{
+			"error":  err.Error(),
+			"format": string(markup),
+		})
+	}
+	c := &MessengerChannel{
+		BaseChannel: NewBaseChannel("messenger", cfg, messageBus, cfg.AllowFrom),
+		config:      cfg,
+		graph:       newGraphClient(cfg.PageAccessToken, cfg.APIVersion),
+		markup:      markup,
+	}
+	if cfg.AppID != "" {
+		c.app = newGraphClient(cfg.AppID+"|"+cfg.AppSecret, cfg.APIVersion)
+	}
+	return c, nil
+}
+
+// Start checks the page token and sets up the persona
+func (c *MessengerChannel) Start(ctx context.Context) error {
+	logger.InfoC("messenger", "Starting Messenger channel")
+
+	var page struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := c.graph.call(ctx, http.MethodGet, "/me?fields=id,name", nil, &page); err != nil {
+		return fmt.Errorf("messenger page token check failed: %w", err)
+	}
+	c.pageID = page.ID
+
+	if c.config.PersonaName != "" {
+		personaID, err := c.ensurePersona(ctx, c.config.PersonaName, c.config.PersonaPictureURL)
+		if err != nil {
+			// Replies still go out, as the page
+			logger.WarnCF("messenger", "Failed to set up persona, replying as the page", map[string]interface{}{
+				"persona": c.config.PersonaName,
+				"error":   err.Error(),
+			})
+		}
+		c.personaID = personaID
+	}
+
+	c.setRunning(true)
+	logger.InfoCF("messenger", "Messenger channel started", map[string]interface{}{
+		"page":    page.Name,
+		"path":    c.WebhookPath(),
+		"persona": c.personaID,
+	})
+	return nil
+}
+
+// Stop stops handing webhook events to the agent
+func (c *MessengerChannel) Stop(ctx context.Context) error {
+	logger.InfoC("messenger", "Stopping Messenger channel")
+	c.setRunning(false)
+	return nil
+}
+
+// Markup returns the markup the channel sends
+func (c *MessengerChannel) Markup() format.Style {
+	return c.markup
+}
+
+// RendersCards reports that the channel lays out cards itself, with reply
+// buttons as quick replies
+func (c *MessengerChannel) RendersCards() bool {
+	return true
+}
+
+// ensurePersona returns the ID of the page's persona called name, creating
+// it if there is none
+func (c *MessengerChannel) ensurePersona(ctx context.Context, name, pictureURL string) (string, error) {
+	var personas struct {
+		Data []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if err := c.graph.call(ctx, http.MethodGet, "/me/personas", nil, &personas); err != nil {
+		return "", fmt.Errorf("failed to list personas: %w", err)
+	}
+	for _, p := range personas.Data {
+		if p.Name == name {
+			return p.ID, nil
+		}
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	body := map[string]string{"name": name, "profile_picture_url": pictureURL}
+	if err := c.graph.call(ctx, http.MethodPost, "/me/personas", body, &created); err != nil {
+		return "", fmt.Errorf("failed to create persona: %w", err)
+	}
+	logger.InfoCF("messenger", "Created persona", map[string]interface{}{
+		"persona": name,
+		"id":      created.ID,
+	})
+	return created.ID, nil
+}
+
+// WebhookPath returns the gateway path Facebook posts page events to
+func (c *MessengerChannel) WebhookPath() string {
+	if c.config.WebhookPath == "" {
+		return DefaultMessengerWebhookPath
+	}
+	return c.config.WebhookPath
+}
+
+// messengerWebhookFields are the page webhook fields the channel handles
+const messengerWebhookFields = "messages,messaging_postbacks"
+
+// WantedWebhook returns the webhook URL under baseURL, or "" without an
+// app ID to subscribe it with
+func (c *MessengerChannel) WantedWebhook(baseURL string) string {
+	if c.app == nil || baseURL == "" {
+		return ""
+	}
+	return baseURL + c.WebhookPath()
+}
+
+// RegisteredWebhook returns the callback URL of the app's page
+// subscription, or "" when the page is not subscribed to the app
+func (c *MessengerChannel) RegisteredWebhook(ctx context.Context) (string, error) {
+	var subscriptions struct {
+		Data []struct {
+			Object      string `json:"object"`
+			CallbackURL string `json:"callback_url"`
+			Active      bool   `json:"active"`
+		} `json:"data"`
+	}
+	if err := c.app.call(ctx, http.MethodGet, "/"+c.config.AppID+"/subscriptions", nil, &subscriptions); err != nil {
+		return "", fmt.Errorf("failed to get app subscriptions: %w", err)
+	}
+	callbackURL := ""
+	for _, subscription := range subscriptions.Data {
+		if subscription.Object == "page" && subscription.Active {
+			callbackURL = subscription.CallbackURL
+		}
+	}
+	if callbackURL == "" {
+		return "", nil
+	}
+
+	var apps struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := c.graph.call(ctx, http.MethodGet, "/me/subscribed_apps", nil, &apps); err != nil {
+		return "", fmt.Errorf("failed to get subscribed apps: %w", err)
+	}
+	for _, app := range apps.Data {
+		if app.ID == c.config.AppID {
+			return callbackURL, nil
+		}
+	}
+	return "", nil
+}
+
+// RegisterWebhook subscribes the app to page events at webhookURL, which
+// Facebook checks with the verify token first, and the page to the app
+func (c *MessengerChannel) RegisterWebhook(ctx context.Context, webhookURL string) error {
+	if c.app == nil {
+		return fmt.Errorf("messenger app_id is not set")
+	}
+	subscription := map[string]interface{}{
+		"object":       "page",
+		"callback_url": webhookURL,
+		"fields":       messengerWebhookFields,
+		"verify_token": c.config.VerifyToken,
+	}
+	if err := c.app.call(ctx, http.MethodPost, "/"+c.config.AppID+"/subscriptions", subscription, nil); err != nil {
+		return fmt.Errorf("failed to subscribe app: %w", err)
+	}
+	page := map[string]string{"subscribed_fields": messengerWebhookFields}
+	if err := c.graph.call(ctx, http.MethodPost, "/me/subscribed_apps", page, nil); err != nil {
+		return fmt.Errorf("failed to subscribe page: %w", err)
+	}
+	return nil
+}
+
+// messengerWebhook is the body of a page webhook request
+type messengerWebhook struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID        string           `json:"id"`
+		Messaging []messengerEvent `json:"messaging"`
+	} `json:"entry"`
+}
+
+// messengerEvent is one messaging event of a webhook entry
+type messengerEvent struct {
+	Sender    messengerUser `json:"sender"`
+	Recipient messengerUser `json:"recipient"`
+	Timestamp int64         `json:"timestamp"`
+	Message   *struct {
+		MID        string `json:"mid"`
+		Text       string `json:"text"`
+		IsEcho     bool   `json:"is_echo"`
+		QuickReply *struct {
+			Payload string `json:"payload"`
+		} `json:"quick_reply"`
+		ReplyTo *struct {
+			MID string `json:"mid"`
+		} `json:"reply_to"`
+		Attachments []messengerInboundAttachment `json:"attachments"`
+	} `json:"message"`
+	Postback *struct {
+		MID     string `json:"mid"`
+		Title   string `json:"title"`
+		Payload string `json:"payload"`
+	} `json:"postback"`
+}
+
+// messengerUser identifies the sender or recipient of a message
+type messengerUser struct {
+	ID string `json:"id"`
+}
+
+// messengerInboundAttachment is a file, location or link sent by a user
+type messengerInboundAttachment struct {
+	Type    string `json:"type"` // image, audio, video, file, location or fallback
+	Title   string `json:"title"`
+	Payload struct {
+		URL         string `json:"url"`
+		Title       string `json:"title"`
+		Coordinates *struct {
+			Lat  float64 `json:"lat"`
+			Long float64 `json:"long"`
+		} `json:"coordinates"`
+	} `json:"payload"`
+}
+
+// ServeHTTP answers the subscription check and receives page events, which
+// must carry a valid signature. Events are acknowledged at once and handled
+// in the background, since Facebook retries slow deliveries.
+func (c *MessengerChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		verifyGraphSubscription(w, r.URL.Query(), c.config.VerifyToken)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !c.IsRunning() {
+		http.Error(w, "messenger channel not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, graphMaxWebhookBody))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if err := verifyGraphSignature(body, r.Header.Get("X-Hub-Signature-256"), c.config.AppSecret); err != nil {
+		logger.WarnCF("messenger", "Rejected request with invalid signature", map[string]interface{}{
+			"remote": r.RemoteAddr,
+			"error":  err.Error(),
+		})
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var hook messengerWebhook
+	if err := json.Unmarshal(body, &hook); err != nil || hook.Object != "page" {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	go func() {
+		for _, entry := range hook.Entry {
+			for _, event := range entry.Messaging {
+				c.handleEvent(context.Background(), event)
+			}
+		}
+	}()
+}
+
+// handleEvent passes a message or postback from an allowed user to the
+// agent. Echoes of the page's own messages are skipped.
+func (c *MessengerChannel) handleEvent(ctx context.Context, event messengerEvent) {
+	senderID := event.Sender.ID
+	if senderID == "" || senderID == c.pageID {
+		return
+	}
+	if event.Message == nil && event.Postback == nil {
+		return
+	}
+	if event.Message != nil && event.Message.IsEcho {
+		return
+	}
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("messenger", "Message rejected by allowlist", map[string]interface{}{
+			"sender_id": senderID,
+		})
+		return
+	}
+
+	metadata := map[string]string{
+		"platform": "messenger",
+		"page_id":  event.Recipient.ID,
+	}
+	var content string
+	var mediaPaths []string
+	var localFiles []string
+	defer func() {
+		for _, file := range localFiles {
+			if err := os.Remove(file); err != nil {
+				logger.DebugCF("messenger", "Failed to cleanup temp file", map[string]interface{}{
+					"file":  file,
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+
+	switch {
+	case event.Postback != nil:
+		// A button of a template or the persistent menu
+		metadata["message_id"] = event.Postback.MID
+		content = event.Postback.Payload
+		if content == "" {
+			content = event.Postback.Title
+		}
+		choiceMetadata(metadata, content, event.Postback.Title)
+	case event.Message.QuickReply != nil:
+		metadata["message_id"] = event.Message.MID
+		content = event.Message.QuickReply.Payload
+		choiceMetadata(metadata, content, event.Message.Text)
+	default:
+		msg := event.Message
+		metadata["message_id"] = msg.MID
+		if msg.ReplyTo != nil {
+			metadata["reply_to"] = msg.ReplyTo.MID
+		}
+		content = msg.Text
+		for _, att := range msg.Attachments {
+			description, localPath := c.receiveAttachment(att)
+			if localPath != "" {
+				if c.mediaDir == "" {
+					localFiles = append(localFiles, localPath)
+				}
+				mediaPaths = append(mediaPaths, localPath)
+			}
+			content = appendContent(content, description)
+		}
+	}
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	logger.DebugCF("messenger", "Received message", map[string]interface{}{
+		"sender_id": senderID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.sendAction(ctx, senderID, "typing_on")
+	c.HandleMessage(senderID, senderID, content, mediaPaths, metadata)
+}
+
+// sendAction shows a sender action, such as the typing indicator, in a
+// conversation. Failures are only logged.
+func (c *MessengerChannel) sendAction(ctx context.Context, psid, action string) {
+	req := messengerSendRequest{
+		Recipient:    messengerUser{ID: psid},
+		SenderAction: action,
+		PersonaID:    c.personaID,
+	}
+	if err := c.graph.call(ctx, http.MethodPost, "/me/messages", req, nil); err != nil {
+		logger.DebugCF("messenger", "Failed to send sender action", map[string]interface{}{
+			"action": action,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// messengerSendRequest is the body of a Send API request
+type messengerSendRequest struct {
+	Recipient     messengerUser     `json:"recipient"`
+	MessagingType string            `json:"messaging_type,omitempty"`
+	Tag           string            `json:"tag,omitempty"`
+	Message       *messengerMessage `json:"message,omitempty"`
+	SenderAction  string            `json:"sender_action,omitempty"`
+	PersonaID     string            `json:"persona_id,omitempty"`
+}
+
+// messengerMessage is a text or attachment message of the Send API
+type messengerMessage struct {
+	Text         string                `json:"text,omitempty"`
+	Attachment   *messengerAttachment  `json:"attachment,omitempty"`
+	QuickReplies []messengerQuickReply `json:"quick_replies,omitempty"`
+	ReplyTo      *messengerReplyTo     `json:"reply_to,omitempty"`
+}
+
+// messengerAttachment is a file sent by URL, or uploaded with the request
+// when the payload URL is empty
+type messengerAttachment struct {
+	Type    string `json:"type"` // image, audio, video or file
+	Payload struct {
+		URL        string `json:"url,omitempty"`
+		IsReusable bool   `json:"is_reusable,omitempty"`
+	} `json:"payload"`
+}
+
+// messengerQuickReply is a button shown under a message until the user
+// answers
+type messengerQuickReply struct {
+	ContentType string `json:"content_type"`
+	Title       string `json:"title"`
+	Payload     string `json:"payload"`
+}
+
+// messengerReplyTo quotes a message of the conversation
+type messengerReplyTo struct {
+	MID string `json:"mid"`
+}
+
+// messagingType returns the messaging type and tag to send msg with.
+// Notifications are not replies, and need the configured tag to reach users
+// who have not written in the last 24 hours.
+func (c *MessengerChannel) messagingType(msg bus.OutboundMessage) (string, string) {
+	switch {
+	case msg.Notification == "":
+		return messengerResponse, ""
+	case c.config.MessageTag != "":
+		return messengerMessageTag, c.config.MessageTag
+	default:
+		return messengerUpdate, ""
+	}
+}
+
+// Send sends msg to the user of its chat. Text is sent in chunks, followed
+// by the attachments; card reply buttons become quick replies on the last
+// message.
+func (c *MessengerChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("%w: messenger channel not running", errs.ErrChannelDown)
+	}
+	if msg.ChatID == "" {
+		return fmt.Errorf("%w: messenger recipient is empty", errs.ErrValidation)
+	}
+	if msg.Reaction != "" {
+		return fmt.Errorf("%w: messenger pages cannot react to messages", errs.ErrValidation)
+	}
+
+	msg, quick := c.formatOutbound(msg)
+	messagingType, tag := c.messagingType(msg)
+
+	var messages []*messengerMessage
+	if strings.TrimSpace(msg.Content) != "" || len(msg.Attachments) == 0 {
+		for _, chunk := range splitMessage(msg.Content, messengerChunkSize) {
+			messages = append(messages, &messengerMessage{Text: chunk})
+		}
+	}
+	if len(messages) > 0 && msg.ReplyTo != "" {
+		messages[0].ReplyTo = &messengerReplyTo{MID: msg.ReplyTo}
+	}
+
+	// Quick replies go on the last message, since any later one hides them
+	lastText := len(messages) - 1
+	if len(msg.Attachments) == 0 && lastText >= 0 {
+		messages[lastText].QuickReplies = quick
+	}
+	for i, message := range messages {
+		if _, err := c.sendMessage(ctx, msg.ChatID, messagingType, tag, message); err != nil {
+			return fmt.Errorf("failed to send messenger message %d/%d: %w", i+1, len(messages), err)
+		}
+	}
+
+	for i, att := range msg.Attachments {
+		var replies []messengerQuickReply
+		if i == len(msg.Attachments)-1 {
+			replies = quick
+		}
+		if err := c.sendAttachment(ctx, msg.ChatID, messagingType, tag, att, replies); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendMessage sends one message through the Send API and returns its ID
+func (c *MessengerChannel) sendMessage(ctx context.Context, psid, messagingType, tag string, message *messengerMessage) (string, error) {
+	req := messengerSendRequest{
+		Recipient:     messengerUser{ID: psid},
+		MessagingType: messagingType,
+		Tag:           tag,
+		Message:       message,
+		PersonaID:     c.personaID,
+	}
+	var sent struct {
+		MessageID string `json:"message_id"`
+	}
+	if err := c.graph.call(ctx, http.MethodPost, "/me/messages", req, &sent); err != nil {
+		return "", err
+	}
+	return sent.MessageID, nil
+}
+
+// formatOutbound converts the Markdown of msg to the configured markup and
+// lays out its card: the image is sent as an attachment, reply buttons that
+// fit become quick replies and the rest is flattened to text
+func (c *MessengerChannel) formatOutbound(msg bus.OutboundMessage) (bus.OutboundMessage, []messengerQuickReply) {
+	var quick []messengerQuickReply
+	if card := msg.Card; card != nil {
+		msg.Card, quick = messengerQuickReplies(card)
+		msg = flattenCard(msg, c.markup, false)
+		if len(quick) > 0 && strings.TrimSpace(msg.Content) == "" && len(msg.Attachments) == 0 {
+			msg.Content = quickReplyPrompt
+		}
+		if card.ImageURL != "" {
+			attachments := make([]bus.Attachment, 0, len(msg.Attachments)+1)
+			attachments = append(attachments, bus.Attachment{URL: card.ImageURL})
+			msg.Attachments = append(attachments, msg.Attachments...)
+		}
+	}
+	if msg.Formatted {
+		return msg, quick
+	}
+	msg.Content = format.Convert(msg.Content, c.markup)
+	if len(msg.Attachments) > 0 {
+		attachments := make([]bus.Attachment, len(msg.Attachments))
+		for i, att := range msg.Attachments {
+			att.Caption = format.Convert(att.Caption, c.markup)
+			attachments[i] = att
+		}
+		msg.Attachments = attachments
+	}
+	return msg, quick
+}
+
+// messengerQuickReplies moves the reply buttons of card that fit the quick
+// reply limits out of a copy of it. Cards with more reply buttons than fit
+// keep them all as text.
+func messengerQuickReplies(card *bus.Card) (*bus.Card, []messengerQuickReply) {
+	rest := *card
+	rest.Buttons = nil
+	var quick []messengerQuickReply
+	for _, b := range card.Buttons {
+		reply := cardButtonReply(b)
+		fits := b.URL == "" &&
+			utf8.RuneCountInString(b.Label) <= messengerQuickReplyTitleRunes &&
+			len(reply) <= messengerQuickReplyPayloadSize
+		if fits {
+			quick = append(quick, messengerQuickReply{ContentType: "text", Title: b.Label, Payload: reply})
+		} else {
+			rest.Buttons = append(rest.Buttons, b)
+		}
+	}
+	if len(quick) > messengerMaxQuickReplies {
+		return card, nil
+	}
+	return &rest, quick
+}
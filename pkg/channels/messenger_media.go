@@ -0,0 +1,152 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// SetMediaDir makes the channel keep incoming files in dir, where the agent
+// can read them later. Without it files are downloaded to a temporary
+// directory and deleted once the message is handed over.
+func (c *MessengerChannel) SetMediaDir(dir string) {
+	c.mediaDir = dir
+}
+
+// receiveAttachment downloads an attachment sent by a user and returns its
+// description for the message content and its local path, or "" as path
+// for locations, links and failed downloads
+func (c *MessengerChannel) receiveAttachment(att messengerInboundAttachment) (string, string) {
+	switch att.Type {
+	case "location":
+		if coords := att.Payload.Coordinates; coords != nil {
+			return fmt.Sprintf("[location: %.6f, %.6f]", coords.Lat, coords.Long), ""
+		}
+		return "[location]", ""
+	case "fallback":
+		// A shared link
+		title := att.Title
+		if title == "" {
+			title = att.Payload.Title
+		}
+		return strings.TrimSpace(fmt.Sprintf("[link: %s %s]", title, att.Payload.URL)), ""
+	}
+	if att.Payload.URL == "" {
+		return fmt.Sprintf("[%s]", att.Type), ""
+	}
+
+	name := att.Type
+	if u, err := url.Parse(att.Payload.URL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		name = path.Base(u.Path)
+	}
+	localPath := utils.DownloadFile(att.Payload.URL, name, utils.DownloadOptions{
+		LoggerPrefix: "messenger",
+		Dir:          c.mediaDir,
+	})
+	return fmt.Sprintf("[%s: %s]", att.Type, name), localPath
+}
+
+// messengerAttachmentType maps a MIME type to a Send API attachment type
+func messengerAttachmentType(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	}
+	return "file"
+}
+
+// sendAttachment sends a file, preceded by its caption since attachments
+// have none. Local files are uploaded with the message and remote files
+// are fetched by Facebook.
+func (c *MessengerChannel) sendAttachment(ctx context.Context, psid, messagingType, tag string, att bus.Attachment, quick []messengerQuickReply) error {
+	if strings.TrimSpace(att.Caption) != "" {
+		if _, err := c.sendMessage(ctx, psid, messagingType, tag, &messengerMessage{Text: att.Caption}); err != nil {
+			return fmt.Errorf("failed to send messenger caption: %w", err)
+		}
+	}
+
+	mimeType := att.MimeType
+	switch {
+	case att.Path != "":
+		if mimeType == "" {
+			mimeType = mime.TypeByExtension(filepath.Ext(att.Path))
+		}
+		data, err := os.ReadFile(att.Path)
+		if err != nil {
+			return fmt.Errorf("%w: attachment: %v", errs.ErrValidation, err)
+		}
+		message := &messengerMessage{Attachment: &messengerAttachment{Type: messengerAttachmentType(mimeType)}, QuickReplies: quick}
+		if err := c.uploadAttachment(ctx, psid, messagingType, tag, message, filepath.Base(att.Path), mimeType, data); err != nil {
+			return fmt.Errorf("failed to upload messenger attachment: %w", err)
+		}
+	case att.URL != "":
+		if mimeType == "" {
+			if u, err := url.Parse(att.URL); err == nil {
+				mimeType = mime.TypeByExtension(path.Ext(u.Path))
+			}
+		}
+		attachment := &messengerAttachment{Type: messengerAttachmentType(mimeType)}
+		attachment.Payload.URL = att.URL
+		if _, err := c.sendMessage(ctx, psid, messagingType, tag, &messengerMessage{Attachment: attachment, QuickReplies: quick}); err != nil {
+			return fmt.Errorf("failed to send messenger attachment: %w", err)
+		}
+	default:
+		return fmt.Errorf("%w: attachment has neither path nor url", errs.ErrValidation)
+	}
+	return nil
+}
+
+// uploadAttachment sends message with data as its attachment, in a
+// multipart request
+func (c *MessengerChannel) uploadAttachment(ctx context.Context, psid, messagingType, tag string, message *messengerMessage, name, mimeType string, data []byte) error {
+	recipient, _ := json.Marshal(messengerUser{ID: psid})
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("recipient", string(recipient))
+	form.WriteField("message", string(encoded))
+	form.WriteField("messaging_type", messagingType)
+	if tag != "" {
+		form.WriteField("tag", tag)
+	}
+	if c.personaID != "" {
+		form.WriteField("persona_id", c.personaID)
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="filedata"; filename=%q`, name))
+	header.Set("Content-Type", mimeType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return err
+	}
+	return c.graph.request(ctx, http.MethodPost, "/me/messages", form.FormDataContentType(), &body, nil)
+}
@@ -0,0 +1,412 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+)
+
+// fakeGraph answers the Graph API calls of the Messenger channel
+type fakeGraph struct {
+	mu       sync.Mutex
+	sent     []map[string]interface{} // Bodies of JSON Send API requests
+	uploads  []map[string]string      // Form fields of multipart Send API requests
+	personas []string                 // Names of created personas
+
+	callbackURL    string // Of the app's page subscription
+	pageSubscribed bool   // Whether the page is subscribed to the app
+}
+
+func (s *fakeGraph) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v22.0/app1/subscriptions" {
+		s.serveAppSubscriptions(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer page-token" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"message":"Invalid OAuth access token.","type":"OAuthException","code":190}}`)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v22.0/me":
+		io.WriteString(w, `{"id":"page1","name":"Pico"}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/v22.0/me/personas":
+		io.WriteString(w, `{"data":[{"id":"p-old","name":"Other"}]}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/v22.0/me/personas":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		s.personas = append(s.personas, body["name"])
+		io.WriteString(w, `{"id":"p-new"}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/v22.0/me/subscribed_apps":
+		if s.pageSubscribed {
+			io.WriteString(w, `{"data":[{"id":"app1","name":"Pico","subscribed_fields":["messages"]}]}`)
+		} else {
+			io.WriteString(w, `{"data":[]}`)
+		}
+	case r.Method == http.MethodPost && r.URL.Path == "/v22.0/me/subscribed_apps":
+		s.pageSubscribed = true
+		io.WriteString(w, `{"success":true}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/v22.0/me/messages":
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			r.ParseMultipartForm(1 << 20)
+			fields := map[string]string{}
+			for name, values := range r.MultipartForm.Value {
+				fields[name] = values[0]
+			}
+			if files := r.MultipartForm.File["filedata"]; len(files) == 1 {
+				fields["filename"] = files[0].Filename
+			}
+			s.uploads = append(s.uploads, fields)
+		} else {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if text, _ := body["message"].(map[string]interface{}); text != nil && text["text"] == "too fast" {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error":{"message":"Calls to this api have exceeded the rate limit.","type":"OAuthException","code":613}}`)
+				return
+			}
+			s.sent = append(s.sent, body)
+		}
+		io.WriteString(w, `{"recipient_id":"u1","message_id":"m_out"}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":{"message":"Unknown path","type":"GraphMethodException","code":100}}`)
+	}
+}
+
+// serveAppSubscriptions answers the app's webhook subscription calls,
+// which are made with the app token
+func (s *fakeGraph) serveAppSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer app1|app-secret" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"message":"Invalid OAuth access token.","type":"OAuthException","code":190}}`)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method == http.MethodPost {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["object"] != "page" || body["verify_token"] != "verify-me" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":{"message":"Callback verification failed","type":"OAuthException","code":2200}}`)
+			return
+		}
+		s.callbackURL = body["callback_url"]
+		io.WriteString(w, `{"success":true}`)
+		return
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"data": []map[string]interface{}{{"object": "page", "callback_url": s.callbackURL, "active": s.callbackURL != ""}},
+	})
+	w.Write(data)
+}
+
+// messages returns the Send API requests that carried a message
+func (s *fakeGraph) messages() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var messages []map[string]interface{}
+	for _, body := range s.sent {
+		if body["message"] != nil {
+			messages = append(messages, body)
+		}
+	}
+	return messages
+}
+
+func startMessenger(t *testing.T, cfg config.MessengerConfig) (*MessengerChannel, *fakeGraph, *bus.MessageBus) {
+	t.Helper()
+	fake := &fakeGraph{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg.PageAccessToken = "page-token"
+	cfg.AppSecret = "app-secret"
+	cfg.VerifyToken = "verify-me"
+	msgBus := bus.NewMessageBus()
+	channel, err := NewMessengerChannel(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewMessengerChannel: %v", err)
+	}
+	channel.graph.baseURL = server.URL
+	if channel.app != nil {
+		channel.app.baseURL = server.URL
+	}
+	if err := channel.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return channel, fake, msgBus
+}
+
+// postEvent posts a signed webhook request and returns the status
+func postEvent(t *testing.T, channel *MessengerChannel, body, secret string) int {
+	t.Helper()
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest(http.MethodPost, channel.WebhookPath(), strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	channel.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestMessengerWebhookVerification(t *testing.T) {
+	channel, _, _ := startMessenger(t, config.MessengerConfig{})
+	if channel.WebhookPath() != DefaultMessengerWebhookPath {
+		t.Errorf("WebhookPath() = %q", channel.WebhookPath())
+	}
+
+	tests := []struct {
+		query string
+		code  int
+		body  string
+	}{
+		{"hub.mode=subscribe&hub.verify_token=verify-me&hub.challenge=1158201444", http.StatusOK, "1158201444"},
+		{"hub.mode=subscribe&hub.verify_token=wrong&hub.challenge=1158201444", http.StatusForbidden, ""},
+		{"hub.mode=unsubscribe&hub.verify_token=verify-me&hub.challenge=1158201444", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		channel.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/messenger/webhook?"+tt.query, nil))
+		if rec.Code != tt.code || (tt.body != "" && rec.Body.String() != tt.body) {
+			t.Errorf("%s: got %d %q", tt.query, rec.Code, rec.Body.String())
+		}
+	}
+
+	event := `{"object":"page","entry":[]}`
+	if code := postEvent(t, channel, event, "wrong-secret"); code != http.StatusUnauthorized {
+		t.Errorf("bad signature: got %d", code)
+	}
+	if code := postEvent(t, channel, event, "app-secret"); code != http.StatusOK {
+		t.Errorf("good signature: got %d", code)
+	}
+	if code := postEvent(t, channel, `{"object":"instagram","entry":[]}`, "app-secret"); code != http.StatusBadRequest {
+		t.Errorf("other object: got %d", code)
+	}
+}
+
+func TestMessengerWebhookRegistration(t *testing.T) {
+	channel, fake, _ := startMessenger(t, config.MessengerConfig{})
+	if channel.WantedWebhook("https://bot.example.org") != "" {
+		t.Error("wanted a webhook without an app ID")
+	}
+
+	channel, fake, _ = startMessenger(t, config.MessengerConfig{AppID: "app1"})
+	ctx := context.Background()
+	wanted := channel.WantedWebhook("https://bot.example.org")
+	if wanted != "https://bot.example.org"+DefaultMessengerWebhookPath {
+		t.Fatalf("WantedWebhook = %q", wanted)
+	}
+	if registered, err := channel.RegisteredWebhook(ctx); err != nil || registered != "" {
+		t.Fatalf("RegisteredWebhook = %q, %v", registered, err)
+	}
+	if err := channel.RegisterWebhook(ctx, wanted); err != nil {
+		t.Fatalf("RegisterWebhook: %v", err)
+	}
+	if registered, err := channel.RegisteredWebhook(ctx); err != nil || registered != wanted {
+		t.Errorf("RegisteredWebhook = %q, %v", registered, err)
+	}
+
+	// The app subscription alone does not deliver the page's events
+	fake.mu.Lock()
+	fake.pageSubscribed = false
+	fake.mu.Unlock()
+	if registered, _ := channel.RegisteredWebhook(ctx); registered != "" {
+		t.Errorf("unsubscribed page reported as registered at %q", registered)
+	}
+}
+
+func TestMessengerInbound(t *testing.T) {
+	image := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "png")
+	}))
+	defer image.Close()
+
+	channel, fake, msgBus := startMessenger(t, config.MessengerConfig{AllowFrom: config.FlexibleStringSlice{"u1"}})
+	channel.SetMediaDir(t.TempDir())
+
+	events := []string{
+		// Echo of the page's own reply, and a stranger
+		`{"sender":{"id":"page1"},"recipient":{"id":"u1"},"message":{"mid":"m0","text":"echo","is_echo":true}}`,
+		`{"sender":{"id":"u2"},"recipient":{"id":"page1"},"message":{"mid":"m1","text":"hi"}}`,
+		`{"sender":{"id":"u1"},"recipient":{"id":"page1"},"message":{"mid":"m2","text":"look","attachments":[{"type":"image","payload":{"url":"` + image.URL + `/cat.png"}}]}}`,
+		`{"sender":{"id":"u1"},"recipient":{"id":"page1"},"message":{"mid":"m3","text":"Yes","quick_reply":{"payload":"confirm"}}}`,
+		`{"sender":{"id":"u1"},"recipient":{"id":"page1"},"postback":{"mid":"m4","title":"Get started","payload":"start"}}`,
+	}
+	body := `{"object":"page","entry":[{"id":"page1","messaging":[` + strings.Join(events, ",") + `]}]}`
+	if code := postEvent(t, channel, body, "app-secret"); code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	want := []struct{ content, choice, label string }{
+		{"look\n[image: cat.png]", "", ""},
+		{"confirm", "confirm", "Yes"},
+		{"start", "start", "Get started"},
+	}
+	for i, w := range want {
+		in, ok := msgBus.ConsumeInbound(ctx)
+		if !ok {
+			t.Fatalf("message %d not received", i)
+		}
+		if in.SenderID != "u1" || in.ChatID != "u1" || in.Content != w.content ||
+			in.Metadata[MetadataChoice] != w.choice || in.Metadata[MetadataChoiceLabel] != w.label {
+			t.Errorf("message %d: unexpected %+v", i, in)
+		}
+		if i == 0 {
+			if len(in.Media) != 1 {
+				t.Fatalf("expected one media file, got %v", in.Media)
+			}
+			if data, err := os.ReadFile(in.Media[0]); err != nil || string(data) != "png" {
+				t.Errorf("media file: %q, %v", data, err)
+			}
+		}
+	}
+
+	// Typing indicators for the three accepted messages
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.sent) != 3 || fake.sent[0]["sender_action"] != "typing_on" {
+		t.Errorf("unexpected sender actions %v", fake.sent)
+	}
+}
+
+func TestMessengerSend(t *testing.T) {
+	channel, fake, _ := startMessenger(t, config.MessengerConfig{PersonaName: "Pico Bot", MessageTag: "ACCOUNT_UPDATE"})
+	fake.mu.Lock()
+	if len(fake.personas) != 1 || fake.personas[0] != "Pico Bot" || channel.personaID != "p-new" {
+		t.Errorf("persona not created: %v, %q", fake.personas, channel.personaID)
+	}
+	fake.mu.Unlock()
+
+	ctx := context.Background()
+	err := channel.Send(ctx, bus.OutboundMessage{
+		ChatID:  "u1",
+		Content: "Deploy **now**?",
+		ReplyTo: "m2",
+		Card: &bus.Card{Buttons: []bus.CardButton{
+			{Label: "Yes", Reply: "deploy"},
+			{Label: "No"},
+			{Label: "Docs", URL: "https://example.org/docs"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	messages := fake.messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected one message, got %v", messages)
+	}
+	sent := messages[0]
+	message := sent["message"].(map[string]interface{})
+	if sent["messaging_type"] != "RESPONSE" || sent["persona_id"] != "p-new" || sent["recipient"].(map[string]interface{})["id"] != "u1" {
+		t.Errorf("unexpected request %v", sent)
+	}
+	if text := message["text"].(string); !strings.HasPrefix(text, "Deploy *now*?") || !strings.Contains(text, "https://example.org/docs") {
+		t.Errorf("unexpected text %q", text)
+	}
+	if message["reply_to"].(map[string]interface{})["mid"] != "m2" {
+		t.Errorf("reply_to missing: %v", message)
+	}
+	quick, _ := message["quick_replies"].([]interface{})
+	if len(quick) != 2 || quick[0].(map[string]interface{})["payload"] != "deploy" || quick[1].(map[string]interface{})["title"] != "No" {
+		t.Errorf("unexpected quick replies %v", quick)
+	}
+
+	// Notifications are tagged, and local files are uploaded
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	os.WriteFile(path, []byte("%PDF"), 0644)
+	err = channel.Send(ctx, bus.OutboundMessage{
+		ChatID:       "u1",
+		Notification: bus.NotificationReminder,
+		Content:      "Your report",
+		Attachments:  []bus.Attachment{{Path: path}},
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	messages = fake.messages()
+	if last := messages[len(messages)-1]; last["messaging_type"] != "MESSAGE_TAG" || last["tag"] != "ACCOUNT_UPDATE" {
+		t.Errorf("notification not tagged: %v", last)
+	}
+	fake.mu.Lock()
+	if len(fake.uploads) != 1 || fake.uploads[0]["filename"] != "report.pdf" || fake.uploads[0]["persona_id"] != "p-new" ||
+		!strings.Contains(fake.uploads[0]["message"], `"type":"file"`) || fake.uploads[0]["recipient"] != `{"id":"u1"}` {
+		t.Errorf("unexpected uploads %v", fake.uploads)
+	}
+	fake.mu.Unlock()
+
+	err = channel.Send(ctx, bus.OutboundMessage{ChatID: "u1", Content: "too fast"})
+	if !errors.Is(err, errs.ErrRateLimited) {
+		t.Errorf("expected a rate limit error, got %v", err)
+	}
+	if err := channel.Send(ctx, bus.OutboundMessage{ChatID: "u1", Reaction: "👍", ReplyTo: "m2"}); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("reaction: got %v", err)
+	}
+}
+
+func TestMessengerQuickReplyLimits(t *testing.T) {
+	buttons := make([]bus.CardButton, messengerMaxQuickReplies+1)
+	for i := range buttons {
+		buttons[i] = bus.CardButton{Label: "Option"}
+	}
+	card := &bus.Card{Buttons: buttons}
+	if rest, quick := messengerQuickReplies(card); rest != card || quick != nil {
+		t.Errorf("too many buttons should stay on the card")
+	}
+
+	long := &bus.Card{Buttons: []bus.CardButton{{Label: "A label far too long for a quick reply"}, {Label: "Ok"}}}
+	rest, quick := messengerQuickReplies(long)
+	if len(quick) != 1 || quick[0].Title != "Ok" || len(rest.Buttons) != 1 {
+		t.Errorf("unexpected split %v, %v", rest.Buttons, quick)
+	}
+}
+
+func TestGraphError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusBadRequest, `{"error":{"message":"(#613) Calls exceeded","type":"OAuthException","code":613}}`, errs.ErrRateLimited},
+		{http.StatusBadRequest, `{"error":{"message":"(#131056) Pair rate limit hit","type":"OAuthException","code":131056}}`, errs.ErrRateLimited},
+		{http.StatusBadRequest, `{"error":{"message":"(#100) Invalid parameter","type":"OAuthException","code":100}}`, errs.ErrValidation},
+		{http.StatusTooManyRequests, `not json`, errs.ErrRateLimited},
+		{http.StatusInternalServerError, `{"error":{"message":"An unknown error occurred","type":"OAuthException","code":1}}`, nil},
+	}
+	for _, tt := range tests {
+		err := graphError(tt.status, http.Header{}, []byte(tt.body))
+		if tt.want == nil {
+			if errors.Is(err, errs.ErrRateLimited) || errors.Is(err, errs.ErrValidation) {
+				t.Errorf("%s: unexpected classification %v", tt.body, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.body, err, tt.want)
+		}
+	}
+	if err := graphError(http.StatusBadRequest, http.Header{}, []byte(`{"error":{"message":"Bad","type":"OAuthException","code":100}}`)); !strings.Contains(err.Error(), "Facebook API error: Bad (type: OAuthException, code: 100)") {
+		t.Errorf("unexpected message %v", err)
+	}
+}
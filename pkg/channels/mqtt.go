@@ -0,0 +1,412 @@
+package channels
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Payload formats of MQTT replies
+const (
+	MQTTPayloadText = "text"
+	MQTTPayloadJSON = "json"
+)
+
+const (
+	mqttDevicePlaceholder = "{device}"
+	defaultMQTTKeepAlive  = 60 * time.Second
+)
+
+// mqttPayload is the JSON form of MQTT messages
+type mqttPayload struct {
+	Text   string `json:"text"`
+	Device string `json:"device,omitempty"`
+	Sender string `json:"sender,omitempty"`
+}
+
+// MQTTChannel exchanges messages with devices through an MQTT broker. Chat
+// IDs are device IDs, or the inbound topic when InboundTopic has no {device}
+// segment.
+type MQTTChannel struct {
+	*BaseChannel
+	config   config.MQTTConfig
+	broker   *url.URL
+	tls      *tls.Config // nil for plain TCP
+	opts     mqttOptions
+	filter   string // Subscription derived from InboundTopic
+	deviceAt int    // Topic segment holding the device ID; -1 without {device}
+	qos      byte
+	retry    *ConnectionRetry
+
+	mu       sync.RWMutex
+	client   *mqttClient // nil while disconnected
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewMQTTChannel creates an MQTT channel from its configuration
+func NewMQTTChannel(cfg config.MQTTConfig, messageBus *bus.MessageBus) (*MQTTChannel, error) {
+	broker, err := url.Parse(cfg.Broker)
+	if err != nil || broker.Host == "" {
+		return nil, fmt.Errorf("invalid mqtt broker %q", cfg.Broker)
+	}
+	var tlsConfig *tls.Config
+	switch broker.Scheme {
+	case "tcp", "mqtt":
+		if broker.Port() == "" {
+			broker.Host = net.JoinHostPort(broker.Hostname(), "1883")
+		}
+	case "ssl", "tls", "mqtts":
+		if broker.Port() == "" {
+			broker.Host = net.JoinHostPort(broker.Hostname(), "8883")
+		}
+		if tlsConfig, err = mqttTLSConfig(cfg, broker.Hostname()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported mqtt broker scheme %q (want tcp or ssl)", broker.Scheme)
+	}
+
+	filter, deviceAt, err := mqttInboundFilter(cfg.InboundTopic)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.OutboundTopic == "" || strings.ContainsAny(cfg.OutboundTopic, "+#") {
+		return nil, fmt.Errorf("mqtt outbound_topic must be set and must not contain wildcards")
+	}
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		return nil, fmt.Errorf("mqtt qos must be 0, 1 or 2, got %d", cfg.QoS)
+	}
+	switch cfg.PayloadFormat {
+	case "", MQTTPayloadText, MQTTPayloadJSON:
+	default:
+		return nil, fmt.Errorf("unknown mqtt payload_format %q (want text or json)", cfg.PayloadFormat)
+	}
+
+	opts := mqttOptions{
+		clientID:  cfg.ClientID,
+		username:  cfg.Username,
+		password:  cfg.Password,
+		keepAlive: time.Duration(cfg.KeepAliveSeconds) * time.Second,
+	}
+	if opts.keepAlive <= 0 {
+		opts.keepAlive = defaultMQTTKeepAlive
+	}
+	if opts.clientID == "" {
+		raw := make([]byte, 4)
+		rand.Read(raw)
+		opts.clientID = "picoclaw-" + hex.EncodeToString(raw)
+	}
+
+	c := &MQTTChannel{
+		BaseChannel: NewBaseChannel("mqtt", cfg, messageBus, cfg.AllowFrom),
+		config:      cfg,
+		broker:      broker,
+		tls:         tlsConfig,
+		opts:        opts,
+		filter:      filter,
+		deviceAt:    deviceAt,
+		qos:         byte(cfg.QoS),
+		retry:       NewConnectionRetryWithPolicy(RetryPolicy{MaxAttempts: UnlimitedRetries, Jitter: 0.2}),
+		stopCh:      make(chan struct{}),
+	}
+	// The broker connection comes and goes while the channel runs
+	c.reportsHealth()
+	return c, nil
+}
+
+// mqttInboundFilter turns the inbound topic into a subscription, replacing
+// a {device} segment with a single-level wildcard
+func mqttInboundFilter(topic string) (string, int, error) {
+	if topic == "" {
+		return "", -1, fmt.Errorf("mqtt inbound_topic is required")
+	}
+	deviceAt := -1
+	segments := strings.Split(topic, "/")
+	for i, segment := range segments {
+		if !strings.Contains(segment, mqttDevicePlaceholder) {
+			continue
+		}
+		if segment != mqttDevicePlaceholder || deviceAt != -1 {
+			return "", -1, fmt.Errorf("mqtt inbound_topic %q must have at most one {device} segment", topic)
+		}
+		deviceAt = i
+		segments[i] = "+"
+	}
+	return strings.Join(segments, "/"), deviceAt, nil
+}
+
+func mqttTLSConfig(cfg config.MQTTConfig, serverName string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mqtt CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in mqtt CA file %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load mqtt client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Start connects to the broker. If it is unreachable the channel still
+// starts and keeps reconnecting in the background.
+func (c *MQTTChannel) Start(ctx context.Context) error {
+	logger.InfoCF("mqtt", "Starting MQTT channel", map[string]interface{}{
+		"broker": c.broker.Host,
+		"topic":  c.filter,
+	})
+
+	client, err := c.connect(ctx)
+	if err != nil {
+		logger.WarnCF("mqtt", "MQTT connection failed, retrying in background", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	c.setRunning(true)
+	c.wg.Add(1)
+	go c.connectLoop(ctx, client)
+	return nil
+}
+
+// Stop disconnects from the broker
+func (c *MQTTChannel) Stop(ctx context.Context) error {
+	logger.InfoC("mqtt", "Stopping MQTT channel")
+	c.stopOnce.Do(func() { close(c.stopCh) })
+
+	c.mu.Lock()
+	client := c.client
+	c.client = nil
+	c.mu.Unlock()
+	if client != nil {
+		client.Close()
+	}
+	c.wg.Wait()
+	c.setRunning(false)
+	c.setHealth(StateDisconnected, "stopped")
+	return nil
+}
+
+// Markup returns the markup the channel sends: devices get plain text
+func (c *MQTTChannel) Markup() format.Style {
+	return format.Plain
+}
+
+// connect opens a session with the broker and subscribes to the inbound
+// topic
+func (c *MQTTChannel) connect(ctx context.Context) (*mqttClient, error) {
+	c.setHealth(StateConnecting, "")
+
+	dialer := &net.Dialer{Timeout: mqttDialTimeout}
+	var conn net.Conn
+	var err error
+	if c.tls != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: c.tls}).DialContext(ctx, "tcp", c.broker.Host)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.broker.Host)
+	}
+	if err != nil {
+		c.setHealth(StateDisconnected, err.Error())
+		return nil, fmt.Errorf("failed to connect to mqtt broker: %w", err)
+	}
+	return c.open(ctx, conn)
+}
+
+// open starts a session over conn
+func (c *MQTTChannel) open(ctx context.Context, conn net.Conn) (*mqttClient, error) {
+	client, err := dialMQTT(ctx, conn, c.opts, c.handleMessage)
+	if err != nil {
+		c.setHealth(StateDisconnected, err.Error())
+		return nil, err
+	}
+	if err := client.Subscribe(ctx, c.qos, c.filter); err != nil {
+		client.Close()
+		c.setHealth(StateDisconnected, err.Error())
+		return nil, fmt.Errorf("mqtt subscribe failed: %w", err)
+	}
+
+	c.mu.Lock()
+	c.client = client
+	c.mu.Unlock()
+	c.retry.Connected()
+	c.setHealth(StateConnected, "")
+	logger.InfoCF("mqtt", "MQTT broker connected", map[string]interface{}{
+		"broker":    c.broker.Host,
+		"client_id": c.opts.clientID,
+	})
+	return client, nil
+}
+
+// connectLoop reconnects whenever the session ends, until the channel stops
+func (c *MQTTChannel) connectLoop(ctx context.Context, client *mqttClient) {
+	defer c.wg.Done()
+	for {
+		if client != nil {
+			select {
+			case <-client.Done():
+			case <-ctx.Done():
+				return
+			case <-c.stopCh:
+				return
+			}
+			c.mu.Lock()
+			if c.client == client {
+				c.client = nil
+			}
+			c.mu.Unlock()
+			c.retry.Disconnected()
+			reason := "connection lost"
+			if err := client.Err(); err != nil {
+				reason = err.Error()
+			}
+			c.setHealth(StateDisconnected, reason)
+		}
+
+		select {
+		case <-time.After(c.retry.NextDelay()):
+		case <-ctx.Done():
+			return
+		case <-c.stopCh:
+			return
+		}
+
+		var err error
+		if client, err = c.connect(ctx); err != nil {
+			logger.WarnCF("mqtt", "MQTT reconnection failed", map[string]interface{}{
+				"attempt": c.retry.GetAttempts(),
+				"error":   err.Error(),
+			})
+		}
+	}
+}
+
+// deviceOf returns the chat ID of a message received on topic
+func (c *MQTTChannel) deviceOf(topic string) string {
+	if c.deviceAt < 0 {
+		return topic
+	}
+	segments := strings.Split(topic, "/")
+	if c.deviceAt >= len(segments) {
+		return ""
+	}
+	return segments[c.deviceAt]
+}
+
+// replyTopic returns the topic replies to chatID are published on
+func (c *MQTTChannel) replyTopic(chatID string) string {
+	return strings.ReplaceAll(c.config.OutboundTopic, mqttDevicePlaceholder, chatID)
+}
+
+// handleMessage passes a message from an allowed device to the agent
+func (c *MQTTChannel) handleMessage(topic string, payload []byte) {
+	device := c.deviceOf(topic)
+	// Replies published under the inbound filter come back to us
+	if device == "" || topic == c.replyTopic(device) {
+		return
+	}
+
+	text, sender := string(payload), device
+	var msg mqttPayload
+	if json.Unmarshal(payload, &msg) == nil && msg.Text != "" {
+		text = msg.Text
+		if msg.Sender != "" {
+			sender = msg.Sender
+		}
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	if !c.IsAllowed(sender) {
+		logger.DebugCF("mqtt", "Message rejected by allowlist", map[string]interface{}{
+			"sender_id": sender,
+			"topic":     topic,
+		})
+		return
+	}
+
+	logger.DebugCF("mqtt", "Received message", map[string]interface{}{
+		"sender_id": sender,
+		"chat_id":   device,
+		"preview":   utils.Truncate(text, 50),
+	})
+	c.HandleMessage(sender, device, text, nil, map[string]string{
+		"platform": "mqtt",
+		"topic":    topic,
+	})
+}
+
+// Send publishes a reply on the device's outbound topic. Progress updates,
+// reactions and attachments are not sent to devices.
+func (c *MQTTChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("%w: mqtt channel not running", errs.ErrChannelDown)
+	}
+	if msg.Progress || msg.Reaction != "" || strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+	if msg.ChatID == "" || strings.ContainsAny(msg.ChatID, "+#") {
+		return fmt.Errorf("%w: invalid mqtt chat ID %q", errs.ErrValidation, msg.ChatID)
+	}
+	if c.deviceAt >= 0 && strings.Contains(msg.ChatID, "/") {
+		return fmt.Errorf("%w: mqtt device ID %q contains '/'", errs.ErrValidation, msg.ChatID)
+	}
+
+	c.mu.RLock()
+	client := c.client
+	c.mu.RUnlock()
+	if client == nil {
+		return fmt.Errorf("%w: mqtt broker not connected", errs.ErrChannelDown)
+	}
+
+	text := msg.Content
+	if !msg.Formatted {
+		text = format.Convert(text, format.Plain)
+	}
+	payload := []byte(text)
+	if c.config.PayloadFormat == MQTTPayloadJSON {
+		var err error
+		if payload, err = json.Marshal(mqttPayload{Text: text, Device: msg.ChatID}); err != nil {
+			return err
+		}
+	}
+
+	topic := c.replyTopic(msg.ChatID)
+	if err := client.Publish(ctx, topic, payload, c.qos, false); err != nil {
+		return fmt.Errorf("mqtt publish to %s failed: %w", topic, err)
+	}
+	return nil
+}
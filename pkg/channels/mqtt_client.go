@@ -0,0 +1,455 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types, in the high nibble of the first byte
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPubrec     = 5
+	mqttPubrel     = 6
+	mqttPubcomp    = 7
+	mqttSubscribe  = 8
+	mqttSuback     = 9
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+const (
+	mqttMaxPacket   = 1 << 20 // Larger packets are refused
+	mqttAckTimeout  = 30 * time.Second
+	mqttDialTimeout = 15 * time.Second
+)
+
+var errMQTTClosed = errors.New("mqtt connection closed")
+
+// mqttConnackErrors explains the CONNACK return codes
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttOptions are the CONNECT parameters
+type mqttOptions struct {
+	clientID  string
+	username  string
+	password  string
+	keepAlive time.Duration
+}
+
+// mqttClient is a minimal MQTT 3.1.1 client: one session over one
+// connection, with QoS 0, 1 and 2 in both directions. Messages arrive on
+// onMessage from the read loop; done is closed when the connection ends.
+type mqttClient struct {
+	conn      net.Conn
+	onMessage func(topic string, payload []byte)
+
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	nextID   uint16
+	acks     map[uint16]chan byte // Packet ID -> waiter for its next ack type
+	received map[uint16]bool      // QoS 2 packet IDs delivered but not released
+	done     chan struct{}
+	err      error
+}
+
+// dialMQTT opens conn as an MQTT session. The client owns conn from here on.
+func dialMQTT(ctx context.Context, conn net.Conn, opts mqttOptions, onMessage func(string, []byte)) (*mqttClient, error) {
+	c := &mqttClient{
+		conn:      conn,
+		onMessage: onMessage,
+		acks:      make(map[uint16]chan byte),
+		received:  make(map[uint16]bool),
+		done:      make(chan struct{}),
+	}
+
+	deadline := time.Now().Add(mqttDialTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	if err := c.write(mqttConnectPacket(opts)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	kind, body, err := readMQTTPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt handshake failed: %w", err)
+	}
+	if kind>>4 != mqttConnack || len(body) < 2 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt handshake failed: unexpected packet type %d", kind>>4)
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		reason, ok := mqttConnackErrors[code]
+		if !ok {
+			reason = fmt.Sprintf("code %d", code)
+		}
+		return nil, fmt.Errorf("mqtt broker refused connection: %s", reason)
+	}
+	conn.SetDeadline(time.Time{})
+
+	go c.readLoop(r, opts.keepAlive)
+	if opts.keepAlive > 0 {
+		go c.pingLoop(opts.keepAlive)
+	}
+	return c, nil
+}
+
+// Done is closed when the connection ends
+func (c *mqttClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended
+func (c *mqttClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Subscribe subscribes to topic filters and waits for the broker to accept
+// them
+func (c *mqttClient) Subscribe(ctx context.Context, qos byte, filters ...string) error {
+	id, ack := c.expect()
+	defer c.forget(id)
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, filter := range filters {
+		body = appendMQTTString(body, filter)
+		body = append(body, qos)
+	}
+	if err := c.write(mqttPacket(mqttSubscribe<<4|0x02, body)); err != nil {
+		return err
+	}
+	granted, err := c.wait(ctx, ack)
+	if err != nil {
+		return err
+	}
+	if granted == 0x80 {
+		return fmt.Errorf("mqtt broker refused subscription to %v", filters)
+	}
+	return nil
+}
+
+// Publish sends payload to topic and, for QoS 1 and 2, waits until the
+// broker has taken it
+func (c *mqttClient) Publish(ctx context.Context, topic string, payload []byte, qos byte, retain bool) error {
+	flags := byte(mqttPublish<<4) | qos<<1
+	if retain {
+		flags |= 0x01
+	}
+	body := appendMQTTString(nil, topic)
+	if qos == 0 {
+		return c.write(mqttPacket(flags, append(body, payload...)))
+	}
+
+	id, ack := c.expect()
+	defer c.forget(id)
+	body = binary.BigEndian.AppendUint16(body, id)
+	if err := c.write(mqttPacket(flags, append(body, payload...))); err != nil {
+		return err
+	}
+	if _, err := c.wait(ctx, ack); err != nil {
+		return err
+	}
+	if qos < 2 {
+		return nil
+	}
+	// PUBREC received: release the message and wait for PUBCOMP
+	if err := c.write(mqttAckPacket(mqttPubrel<<4|0x02, id)); err != nil {
+		return err
+	}
+	_, err := c.wait(ctx, ack)
+	return err
+}
+
+// Close sends DISCONNECT and closes the connection
+func (c *mqttClient) Close() error {
+	c.write(mqttPacket(mqttDisconnect<<4, nil))
+	return c.conn.Close()
+}
+
+// expect reserves a packet ID and the channel its acks arrive on
+func (c *mqttClient) expect() (uint16, chan byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+		if _, busy := c.acks[c.nextID]; !busy {
+			break
+		}
+	}
+	ack := make(chan byte, 2)
+	c.acks[c.nextID] = ack
+	return c.nextID, ack
+}
+
+func (c *mqttClient) forget(id uint16) {
+	c.mu.Lock()
+	delete(c.acks, id)
+	c.mu.Unlock()
+}
+
+// wait returns the value carried by the next ack: the granted QoS of a
+// SUBACK, zero otherwise
+func (c *mqttClient) wait(ctx context.Context, ack chan byte) (byte, error) {
+	timer := time.NewTimer(mqttAckTimeout)
+	defer timer.Stop()
+	select {
+	case v := <-ack:
+		return v, nil
+	case <-c.done:
+		return 0, errMQTTClosed
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-timer.C:
+		return 0, fmt.Errorf("mqtt broker did not acknowledge in %s", mqttAckTimeout)
+	}
+}
+
+func (c *mqttClient) ack(id uint16, value byte) {
+	c.mu.Lock()
+	ack, ok := c.acks[id]
+	c.mu.Unlock()
+	if ok {
+		select {
+		case ack <- value:
+		default:
+		}
+	}
+}
+
+func (c *mqttClient) write(packet []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(mqttAckTimeout))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// readLoop dispatches incoming packets until the connection fails. The
+// broker must send something at least every 1.5 keepalive periods.
+func (c *mqttClient) readLoop(r *bufio.Reader, keepAlive time.Duration) {
+	var err error
+	defer func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		c.conn.Close()
+		close(c.done)
+	}()
+
+	for {
+		if keepAlive > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		}
+		var kind byte
+		var body []byte
+		if kind, body, err = readMQTTPacket(r); err != nil {
+			return
+		}
+		if err = c.handle(kind, body); err != nil {
+			return
+		}
+	}
+}
+
+func (c *mqttClient) handle(kind byte, body []byte) error {
+	switch kind >> 4 {
+	case mqttPublish:
+		return c.handlePublish(kind, body)
+	case mqttPuback, mqttPubrec, mqttPubcomp:
+		if len(body) < 2 {
+			return fmt.Errorf("malformed mqtt ack")
+		}
+		c.ack(binary.BigEndian.Uint16(body), 0)
+	case mqttPubrel:
+		if len(body) < 2 {
+			return fmt.Errorf("malformed mqtt pubrel")
+		}
+		id := binary.BigEndian.Uint16(body)
+		c.mu.Lock()
+		delete(c.received, id)
+		c.mu.Unlock()
+		return c.write(mqttAckPacket(mqttPubcomp<<4, id))
+	case mqttSuback:
+		if len(body) < 3 {
+			return fmt.Errorf("malformed mqtt suback")
+		}
+		c.ack(binary.BigEndian.Uint16(body), body[len(body)-1])
+	case mqttPingresp:
+	default:
+		return fmt.Errorf("unexpected mqtt packet type %d", kind>>4)
+	}
+	return nil
+}
+
+// handlePublish delivers an incoming message and acknowledges it. QoS 2
+// messages are delivered once, even when the broker resends them before
+// the release.
+func (c *mqttClient) handlePublish(kind byte, body []byte) error {
+	qos := (kind >> 1) & 0x03
+	topic, rest, err := readMQTTString(body)
+	if err != nil {
+		return err
+	}
+	var id uint16
+	if qos > 0 {
+		if len(rest) < 2 {
+			return fmt.Errorf("malformed mqtt publish")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+
+	switch qos {
+	case 0:
+		c.onMessage(topic, rest)
+	case 1:
+		c.onMessage(topic, rest)
+		return c.write(mqttAckPacket(mqttPuback<<4, id))
+	case 2:
+		c.mu.Lock()
+		seen := c.received[id]
+		c.received[id] = true
+		c.mu.Unlock()
+		if !seen {
+			c.onMessage(topic, rest)
+		}
+		return c.write(mqttAckPacket(mqttPubrec<<4, id))
+	default:
+		return fmt.Errorf("invalid mqtt qos %d", qos)
+	}
+	return nil
+}
+
+// pingLoop keeps the session alive while the connection is idle
+func (c *mqttClient) pingLoop(keepAlive time.Duration) {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write(mqttPacket(mqttPingreq<<4, nil)); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func mqttConnectPacket(opts mqttOptions) []byte {
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4) // Protocol level 3.1.1
+	flags := byte(0x02)    // Clean session
+	if opts.username != "" {
+		flags |= 0x80
+		if opts.password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.keepAlive/time.Second))
+	body = appendMQTTString(body, opts.clientID)
+	if opts.username != "" {
+		body = appendMQTTString(body, opts.username)
+		if opts.password != "" {
+			body = appendMQTTString(body, opts.password)
+		}
+	}
+	return mqttPacket(mqttConnect<<4, body)
+}
+
+func mqttAckPacket(header byte, id uint16) []byte {
+	return mqttPacket(header, binary.BigEndian.AppendUint16(nil, id))
+}
+
+// mqttPacket frames body with its fixed header
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// readMQTTPacket reads one packet and returns its first byte and body
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("malformed mqtt packet length")
+		}
+		multiplier *= 128
+	}
+	if length > mqttMaxPacket {
+		return 0, nil, fmt.Errorf("mqtt packet of %d bytes exceeds the limit", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readMQTTString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, fmt.Errorf("malformed mqtt string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, fmt.Errorf("malformed mqtt string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
@@ -0,0 +1,248 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeMQTTBroker is the broker end of a pipe to an mqttClient
+type fakeMQTTBroker struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (b *fakeMQTTBroker) expect(kind byte) []byte {
+	b.t.Helper()
+	b.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header, body, err := readMQTTPacket(b.r)
+	if err != nil {
+		b.t.Fatalf("broker read: %v", err)
+	}
+	if header>>4 != kind {
+		b.t.Fatalf("broker got packet type %d, want %d", header>>4, kind)
+	}
+	return body
+}
+
+func (b *fakeMQTTBroker) send(packet []byte) {
+	b.t.Helper()
+	b.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := b.conn.Write(packet); err != nil {
+		b.t.Fatalf("broker write: %v", err)
+	}
+}
+
+func (b *fakeMQTTBroker) publish(topic, payload string, qos byte, id uint16) {
+	body := appendMQTTString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	b.send(mqttPacket(mqttPublish<<4|qos<<1, append(body, payload...)))
+}
+
+// connectTestMQTT opens a session of c with a fake broker and returns the
+// broker
+func connectTestMQTT(t *testing.T, c *MQTTChannel) *fakeMQTTBroker {
+	clientConn, brokerConn := net.Pipe()
+	t.Cleanup(func() { brokerConn.Close() })
+	broker := &fakeMQTTBroker{t: t, conn: brokerConn, r: bufio.NewReader(brokerConn)}
+
+	opened := make(chan error, 1)
+	go func() {
+		_, err := c.open(context.Background(), clientConn)
+		opened <- err
+	}()
+
+	connect := broker.expect(mqttConnect)
+	if !strings.Contains(string(connect), c.opts.clientID) || !strings.Contains(string(connect), "secret") {
+		t.Errorf("CONNECT lacks the client ID or password: %q", connect)
+	}
+	broker.send([]byte{mqttConnack << 4, 2, 0, 0})
+	subscribe := broker.expect(mqttSubscribe)
+	if filter, _, _ := readMQTTString(subscribe[2:]); filter != "home/+/ask" {
+		t.Errorf("subscribed to %q, want home/+/ask", filter)
+	}
+	broker.send(mqttPacket(mqttSuback<<4, []byte{subscribe[0], subscribe[1], 1}))
+
+	if err := <-opened; err != nil {
+		t.Fatalf("open() = %v", err)
+	}
+	c.setRunning(true)
+	return broker
+}
+
+func newTestMQTTChannel(t *testing.T, format string) (*MQTTChannel, *bus.MessageBus) {
+	msgBus := bus.NewMessageBus()
+	c, err := NewMQTTChannel(config.MQTTConfig{
+		Broker:        "tcp://broker.local",
+		Username:      "picoclaw",
+		Password:      "secret",
+		InboundTopic:  "home/{device}/ask",
+		OutboundTopic: "home/{device}/reply",
+		QoS:           1,
+		PayloadFormat: format,
+		AllowFrom:     []string{"kitchen", "alice"},
+	}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, msgBus
+}
+
+func TestMQTTChannelRoundTrip(t *testing.T) {
+	c, msgBus := newTestMQTTChannel(t, MQTTPayloadJSON)
+	if c.broker.Host != "broker.local:1883" {
+		t.Errorf("broker host = %q, want the default port", c.broker.Host)
+	}
+	broker := connectTestMQTT(t, c)
+	if !c.Health().State.Ready() {
+		t.Errorf("health = %v, want connected", c.Health())
+	}
+
+	broker.publish("home/kitchen/ask", "turn on the **lights**", 1, 42)
+	if ack := broker.expect(mqttPuback); binary.BigEndian.Uint16(ack) != 42 {
+		t.Errorf("PUBACK for packet %d, want 42", binary.BigEndian.Uint16(ack))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	in, ok := msgBus.ConsumeInbound(ctx)
+	if !ok || in.ChatID != "kitchen" || in.SenderID != "kitchen" || in.Content != "turn on the **lights**" {
+		t.Fatalf("unexpected inbound %+v", in)
+	}
+
+	// JSON payloads may name the sender; unknown senders are dropped
+	broker.publish("home/hall/ask", `{"text":"who is home?","sender":"mallory"}`, 0, 0)
+	broker.publish("home/hall/ask", `{"text":"who is home?","sender":"alice"}`, 0, 0)
+	if in, _ := msgBus.ConsumeInbound(ctx); in.SenderID != "alice" || in.ChatID != "hall" || in.Content != "who is home?" {
+		t.Errorf("unexpected inbound %+v", in)
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- c.Send(ctx, bus.OutboundMessage{Channel: "mqtt", ChatID: "kitchen", Content: "Lights are **on**"})
+	}()
+	publish := broker.expect(mqttPublish)
+	topic, rest, _ := readMQTTString(publish)
+	if topic != "home/kitchen/reply" {
+		t.Errorf("reply topic = %q", topic)
+	}
+	if payload := string(rest[2:]); payload != `{"text":"Lights are on","device":"kitchen"}` {
+		t.Errorf("reply payload = %s", payload)
+	}
+	broker.send(mqttAckPacket(mqttPuback<<4, binary.BigEndian.Uint16(rest)))
+	if err := <-sent; err != nil {
+		t.Errorf("Send() = %v", err)
+	}
+
+	if err := c.Send(ctx, bus.OutboundMessage{ChatID: "home/#", Content: "x"}); err == nil {
+		t.Error("wildcard chat IDs should be rejected")
+	}
+}
+
+func TestMQTTChannelQoS2(t *testing.T) {
+	c, msgBus := newTestMQTTChannel(t, "")
+	broker := connectTestMQTT(t, c)
+
+	// A QoS 2 message resent before its release is delivered once
+	broker.publish("home/kitchen/ask", "hello", 2, 7)
+	broker.expect(mqttPubrec)
+	broker.publish("home/kitchen/ask", "hello", 2, 7)
+	broker.expect(mqttPubrec)
+	broker.send(mqttAckPacket(mqttPubrel<<4|0x02, 7))
+	broker.expect(mqttPubcomp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if in, ok := msgBus.ConsumeInbound(ctx); !ok || in.Content != "hello" {
+		t.Fatalf("unexpected inbound %+v", in)
+	}
+	short, cancelShort := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShort()
+	if in, ok := msgBus.ConsumeInbound(short); ok {
+		t.Errorf("duplicate delivered: %+v", in)
+	}
+
+	c.qos = 2
+	sent := make(chan error, 1)
+	go func() {
+		sent <- c.Send(ctx, bus.OutboundMessage{ChatID: "kitchen", Content: "hi"})
+	}()
+	publish := broker.expect(mqttPublish)
+	_, rest, _ := readMQTTString(publish)
+	id := binary.BigEndian.Uint16(rest)
+	if string(rest[2:]) != "hi" {
+		t.Errorf("text payload = %q", rest[2:])
+	}
+	broker.send(mqttAckPacket(mqttPubrec<<4, id))
+	broker.expect(mqttPubrel)
+	broker.send(mqttAckPacket(mqttPubcomp<<4, id))
+	if err := <-sent; err != nil {
+		t.Errorf("Send() = %v", err)
+	}
+}
+
+func TestMQTTInboundFilter(t *testing.T) {
+	tests := []struct {
+		topic    string
+		filter   string
+		deviceAt int
+		wantErr  bool
+	}{
+		{"picoclaw/{device}/in", "picoclaw/+/in", 1, false},
+		{"{device}", "+", 0, false},
+		{"picoclaw/in", "picoclaw/in", -1, false},
+		{"picoclaw/dev-{device}/in", "", -1, true},
+		{"{device}/{device}", "", -1, true},
+		{"", "", -1, true},
+	}
+	for _, tt := range tests {
+		filter, deviceAt, err := mqttInboundFilter(tt.topic)
+		if (err != nil) != tt.wantErr || filter != tt.filter || deviceAt != tt.deviceAt {
+			t.Errorf("mqttInboundFilter(%q) = %q, %d, %v", tt.topic, filter, deviceAt, err)
+		}
+	}
+}
+
+func TestMQTTPacketLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 300000} {
+		packet := mqttPacket(mqttPublish<<4, make([]byte, n))
+		_, body, err := readMQTTPacket(bufio.NewReader(strings.NewReader(string(packet))))
+		if err != nil || len(body) != n {
+			t.Errorf("length %d: got %d, %v", n, len(body), err)
+		}
+	}
+}
+
+func TestNewMQTTChannelValidation(t *testing.T) {
+	valid := config.MQTTConfig{Broker: "ssl://broker.local", InboundTopic: "a/{device}", OutboundTopic: "b/{device}"}
+	c, err := NewMQTTChannel(valid, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.tls == nil || c.broker.Host != "broker.local:8883" {
+		t.Errorf("ssl broker: tls=%v host=%q", c.tls != nil, c.broker.Host)
+	}
+
+	for name, mutate := range map[string]func(*config.MQTTConfig){
+		"scheme":   func(cfg *config.MQTTConfig) { cfg.Broker = "ws://broker.local" },
+		"outbound": func(cfg *config.MQTTConfig) { cfg.OutboundTopic = "b/+" },
+		"qos":      func(cfg *config.MQTTConfig) { cfg.QoS = 3 },
+		"format":   func(cfg *config.MQTTConfig) { cfg.PayloadFormat = "xml" },
+		"ca":       func(cfg *config.MQTTConfig) { cfg.TLSCAFile = "/nonexistent/ca.pem" },
+	} {
+		cfg := valid
+		mutate(&cfg)
+		if _, err := NewMQTTChannel(cfg, bus.NewMessageBus()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package channels
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+// defaultTemplateChannel is the template key used for channels without a
+// template of their own
+const defaultTemplateChannel = "default"
+
+// markupChannel is implemented by channels that convert Markdown to their
+// own markup
+type markupChannel interface {
+	Markup() format.Style
+}
+
+// channelMarkup returns the markup a channel sends
+func channelMarkup(ch Channel) format.Style {
+	if mc, ok := ch.(markupChannel); ok {
+		return mc.Markup()
+	}
+	return format.Markdown
+}
+
+// notificationData is what notification templates are executed with
+type notificationData struct {
+	Type    string    // Notification type, e.g. "alert"
+	Channel string    // Channel name
+	ChatID  string    // Destination chat
+	Content string    // Notification text in the channel's markup
+	Time    time.Time // When the notification was rendered
+}
+
+var notificationFuncs = template.FuncMap{
+	// json quotes a string for use inside JSON, such as Slack blocks
+	"json": func(s string) (string, error) {
+		data, err := json.Marshal(s)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+}
+
+// NotificationTemplates lays out system notifications (alerts, reminders,
+// errors, ...) per notification type and channel
+type NotificationTemplates struct {
+	templates map[string]map[string]*template.Template // type -> channel -> template
+}
+
+// NewNotificationTemplates parses the configured templates
+func NewNotificationTemplates(cfg config.NotificationsConfig) (*NotificationTemplates, error) {
+	t := &NotificationTemplates{templates: make(map[string]map[string]*template.Template)}
+	for kind, byChannel := range cfg.Templates {
+		t.templates[kind] = make(map[string]*template.Template, len(byChannel))
+		for channel, text := range byChannel {
+			tmpl, err := template.New(kind + "/" + channel).Funcs(notificationFuncs).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("notification template %s for %s: %w", kind, channel, err)
+			}
+			t.templates[kind][channel] = tmpl
+		}
+	}
+	return t, nil
+}
+
+// Render lays out msg with the template for its notification type and
+// channel. The content is converted to the channel's markup before it is
+// placed in the template, and the result is marked as formatted.
+// Messages without a matching template are returned unchanged.
+func (t *NotificationTemplates) Render(msg bus.OutboundMessage, markup format.Style) (bus.OutboundMessage, error) {
+	if t == nil || msg.Notification == "" || msg.Formatted {
+		return msg, nil
+	}
+	byChannel := t.templates[msg.Notification]
+	tmpl, ok := byChannel[msg.Channel]
+	if !ok {
+		if tmpl, ok = byChannel[defaultTemplateChannel]; !ok {
+			return msg, nil
+		}
+	}
+
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, notificationData{
+		Type:    msg.Notification,
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: format.Convert(msg.Content, markup),
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return msg, fmt.Errorf("notification template %s: %w", tmpl.Name(), err)
+	}
+
+	msg.Content = sb.String()
+	msg.Formatted = true
+	return msg, nil
+}
@@ -0,0 +1,77 @@
+package channels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+func TestNotificationTemplates(t *testing.T) {
+	templates, err := NewNotificationTemplates(config.NotificationsConfig{
+		Templates: map[string]map[string]string{
+			bus.NotificationAlert: {
+				"whatsapp": "🚨 *INCIDENT*\n\n{{.Content}}",
+				"slack":    `[{"type": "section", "text": {"type": "mrkdwn", "text": {{json .Content}}}}]`,
+				"default":  "[{{upper .Type}}] {{.Content}}",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewNotificationTemplates: %v", err)
+	}
+
+	alert := bus.OutboundMessage{Content: "**DB down**", Notification: bus.NotificationAlert}
+	tests := []struct {
+		name          string
+		msg           bus.OutboundMessage
+		markup        format.Style
+		want          string
+		wantFormatted bool
+	}{
+		{"channel template in channel markup", withChannel(alert, "whatsapp"), format.WhatsApp, "🚨 *INCIDENT*\n\n*DB down*", true},
+		{"default template", withChannel(alert, "telegram"), format.Plain, "[ALERT] DB down", true},
+		{"no template for type", bus.OutboundMessage{Channel: "whatsapp", Content: "**hi**", Notification: bus.NotificationDevice}, format.WhatsApp, "**hi**", false},
+		{"conversation reply", bus.OutboundMessage{Channel: "whatsapp", Content: "**hi**"}, format.WhatsApp, "**hi**", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := templates.Render(tt.msg, tt.markup)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got.Content != tt.want || got.Formatted != tt.wantFormatted {
+				t.Errorf("Render() = %q (formatted %v), want %q (formatted %v)", got.Content, got.Formatted, tt.want, tt.wantFormatted)
+			}
+		})
+	}
+
+	// Slack blocks: quoted content must keep the JSON valid
+	got, err := templates.Render(withChannel(bus.OutboundMessage{Content: `"quoted" \ text`, Notification: bus.NotificationAlert}, "slack"), format.Markdown)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	var blocks slack.Blocks
+	if err := json.Unmarshal([]byte(got.Content), &blocks); err != nil || len(blocks.BlockSet) != 1 {
+		t.Errorf("expected one Slack block, got %q: %v", got.Content, err)
+	}
+}
+
+func TestNotificationTemplatesInvalid(t *testing.T) {
+	_, err := NewNotificationTemplates(config.NotificationsConfig{
+		Templates: map[string]map[string]string{"alert": {"default": "{{.Content"}},
+	})
+	if err == nil {
+		t.Error("expected an error for an unparsable template")
+	}
+}
+
+func withChannel(msg bus.OutboundMessage, channel string) bus.OutboundMessage {
+	msg.Channel = channel
+	return msg
+}
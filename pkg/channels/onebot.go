@@ -13,6 +13,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
 	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
@@ -209,7 +210,7 @@ func (c *OneBotChannel) Stop(ctx context.Context) error {
 
 func (c *OneBotChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
-		return fmt.Errorf("OneBot channel not running")
+		return fmt.Errorf("%w: OneBot channel not running", errs.ErrChannelDown)
 	}
 
 	c.mu.Lock()
@@ -217,7 +218,7 @@ func (c *OneBotChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	c.mu.Unlock()
 
 	if conn == nil {
-		return fmt.Errorf("OneBot WebSocket not connected")
+		return fmt.Errorf("%w: OneBot WebSocket not connected", errs.ErrChannelDown)
 	}
 
 	action, params, err := c.buildSendRequest(msg)
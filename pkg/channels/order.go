@@ -0,0 +1,112 @@
+package channels
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// chatOrder keeps the messages to a chat in the order they were published.
+// While a message of a chat waits for a retry, the chat's next messages are
+// held back, so the parts of a long reply never arrive out of order.
+type chatOrder struct {
+	mu sync.Mutex
+	// Chats with a message being delivered, and the messages waiting for
+	// it, keyed by chatOrderKey
+	busy map[string][]bus.OutboundMessage
+}
+
+// chatOrderKey identifies the chat a message goes to
+func chatOrderKey(msg bus.OutboundMessage) string {
+	return msg.Channel + ":" + msg.AccountID + ":" + msg.ChatID
+}
+
+// start marks the chat of msg busy and reports true, or queues msg behind
+// the message being delivered to the chat and reports false
+func (o *chatOrder) start(msg bus.OutboundMessage) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	key := chatOrderKey(msg)
+	if waiting, busy := o.busy[key]; busy {
+		o.busy[key] = append(waiting, msg)
+		return false
+	}
+	if o.busy == nil {
+		o.busy = make(map[string][]bus.OutboundMessage)
+	}
+	o.busy[key] = nil
+	return true
+}
+
+// next returns the message waiting longest for the chat key, or marks the
+// chat idle and reports false
+func (o *chatOrder) next(key string) (bus.OutboundMessage, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	waiting := o.busy[key]
+	if len(waiting) == 0 {
+		delete(o.busy, key)
+		return bus.OutboundMessage{}, false
+	}
+	o.busy[key] = waiting[1:]
+	return waiting[0], true
+}
+
+// sendInOrder sends msg, a message taken from the bus, once the messages
+// published before it to the same chat are delivered or have failed
+func (m *Manager) sendInOrder(ctx context.Context, msg bus.OutboundMessage) {
+	if m.order.start(msg) {
+		m.sendChat(ctx, chatOrderKey(msg), msg)
+	}
+}
+
+// sendChat sends msg and then the messages held back for its chat
+func (m *Manager) sendChat(ctx context.Context, key string, msg bus.OutboundMessage) {
+	for {
+		d := m.sendOutbound(ctx, msg)
+
+		select {
+		case <-d.Done():
+			m.bus.OutboundDone(msg)
+		default:
+			// Retrying: the chat's next messages wait for the outcome
+			// without holding up other chats. The message stays in the
+			// journal until it is sent or dead-lettered.
+			go func() {
+				<-d.Done()
+				m.bus.OutboundDone(msg)
+				if next, ok := m.order.next(key); ok {
+					m.sendHeldBack(ctx, key, next)
+				}
+			}()
+			return
+		}
+
+		var ok bool
+		if msg, ok = m.order.next(key); !ok {
+			return
+		}
+	}
+}
+
+// sendHeldBack sends the messages held back behind a retried message,
+// starting with msg
+func (m *Manager) sendHeldBack(ctx context.Context, key string, msg bus.OutboundMessage) {
+	if ctx.Err() == nil {
+		m.sendChat(ctx, key, msg)
+		return
+	}
+	// Shutting down; a persistent bus sends them after the restart
+	fields := map[string]interface{}{"channel": msg.Channel, "chat_id": msg.ChatID}
+	n := 0
+	for ok := true; ok; msg, ok = m.order.next(key) {
+		m.bus.OutboundReleased(msg)
+		n++
+	}
+	fields["messages"] = n
+	logger.WarnCF("channels", "Dropping messages held back for chat order", fields)
+}
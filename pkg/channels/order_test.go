@@ -0,0 +1,118 @@
+package channels
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+)
+
+func TestManagerKeepsChatOrder(t *testing.T) {
+	ch := &flakyChannel{
+		recordingChannel: &recordingChannel{BaseChannel: NewBaseChannel("test", nil, nil, nil)},
+		failures:         1,
+		err:              &errs.RateLimitError{RetryAfter: 50 * time.Millisecond},
+	}
+	m, mb := newDeliveryTestManager(ch, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.dispatchOutbound(ctx)
+
+	// The first part fails once; the second must still arrive after it
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "test", ChatID: "a", Content: "part 1"})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "test", ChatID: "a", Content: "part 2"})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "test", ChatID: "b", Content: "other chat"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, outbound := mb.Pending(); outbound == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("messages not sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	var got []string
+	for _, msg := range ch.sent {
+		got = append(got, msg.Content)
+	}
+	// The other chat is not held up by the retry
+	want := []string{"other chat", "part 1", "part 2"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestManagerChatOrderAcknowledgesFinalDeliveries(t *testing.T) {
+	ch := &flakyChannel{
+		recordingChannel: &recordingChannel{BaseChannel: NewBaseChannel("test", nil, nil, nil)},
+		failures:         1,
+		err:              &errs.RateLimitError{RetryAfter: time.Minute},
+	}
+	path := filepath.Join(t.TempDir(), "journal")
+	mb, err := bus.NewPersistentMessageBus(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Channels.Delivery = config.DeliveryConfig{MaxAttempts: 3}
+	m := &Manager{channels: map[string]Channel{"test": ch}, bus: mb, config: cfg}
+	ctx, cancel := context.WithCancel(context.Background())
+	go m.dispatchOutbound(ctx)
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "test", ChatID: "a", Content: "part 1"})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "test", ChatID: "a", Content: "part 2"})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.order.mu.Lock()
+		held := len(m.order.busy["test::a"])
+		m.order.mu.Unlock()
+		if held == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("second part not held back")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Both wait: the first for its retry, the second behind it
+	if _, outbound := mb.Pending(); outbound != 2 {
+		t.Errorf("pending while retrying = %d, want 2", outbound)
+	}
+
+	// Shutdown dead-letters the first part and releases the second
+	cancel()
+	for {
+		if _, outbound := mb.Pending(); outbound == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pending outbound messages did not drain")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mb.Close()
+
+	mb, err = bus.NewPersistentMessageBus(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Close()
+	if dead := mb.DeadLetters(); len(dead) != 1 || dead[0].Message.Content != "part 1" {
+		t.Errorf("dead letters after restart = %+v", dead)
+	}
+	if _, outbound := mb.Pending(); outbound != 1 {
+		t.Fatalf("replayed %d messages, want the held back one", outbound)
+	}
+	if msg, _ := mb.SubscribeOutbound(context.Background()); msg.Content != "part 2" {
+		t.Errorf("replayed %q", msg.Content)
+	}
+}
@@ -0,0 +1,105 @@
+package channels
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+// Metadata of inbound votes on native polls. The message content lists the
+// chosen options.
+const (
+	MetadataPollID    = "poll_id"    // ID of the bus.Poll voted on
+	MetadataPollVotes = "poll_votes" // Comma-separated 0-based option indexes, empty when the vote is retracted
+)
+
+// pollVoteMetadata adds a native poll vote to metadata
+func pollVoteMetadata(metadata map[string]string, pollID string, options []int) map[string]string {
+	votes := make([]string, len(options))
+	for i, option := range options {
+		votes[i] = strconv.Itoa(option)
+	}
+	metadata[MetadataPollID] = pollID
+	metadata[MetadataPollVotes] = strings.Join(votes, ",")
+	return metadata
+}
+
+// PollVote returns the poll and the 0-based options of an inbound native
+// poll vote; ok is false for other messages
+func PollVote(metadata map[string]string) (pollID string, options []int, ok bool) {
+	pollID, ok = metadata[MetadataPollID]
+	if !ok {
+		return "", nil, false
+	}
+	for _, vote := range strings.Split(metadata[MetadataPollVotes], ",") {
+		if option, err := strconv.Atoi(strings.TrimSpace(vote)); err == nil {
+			options = append(options, option)
+		}
+	}
+	return pollID, options, true
+}
+
+// pollChannel is implemented by channels with native polls. Polls sent to
+// other channels are emulated by the manager.
+type pollChannel interface {
+	SendsPolls() bool
+}
+
+// sendsPolls reports whether a channel sends polls itself
+func sendsPolls(ch Channel) bool {
+	pc, ok := ch.(pollChannel)
+	return ok && pc.SendsPolls()
+}
+
+// pollMarkdown renders poll as a question with numbered options, answered
+// by replying with the numbers
+func pollMarkdown(poll *bus.Poll) string {
+	lines := make([]string, 0, len(poll.Options))
+	for i, option := range poll.Options {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, option))
+	}
+	instructions := "Reply with the number of your choice."
+	if poll.MultipleAnswers {
+		instructions = "Reply with the numbers of your choices, e.g. 1,3."
+	}
+	return fmt.Sprintf("**%s**\n\n%s\n\n%s", poll.Question, strings.Join(lines, "\n"), instructions)
+}
+
+// pollCard renders a single-answer poll as a card with one button per
+// option, which replies with the option's number
+func pollCard(poll *bus.Poll) *bus.Card {
+	card := &bus.Card{Title: poll.Question, Text: "Pick an option or reply with its number."}
+	for i, option := range poll.Options {
+		card.Buttons = append(card.Buttons, bus.CardButton{Label: option, Reply: strconv.Itoa(i + 1)})
+	}
+	return card
+}
+
+// emulatePoll replaces msg.Poll with numbered options. Channels that render
+// cards get buttons for single-answer polls; the rest get text, in markup
+// when the content is formatted.
+func emulatePoll(msg bus.OutboundMessage, cards bool, markup format.Style) bus.OutboundMessage {
+	poll := msg.Poll
+	if poll == nil {
+		return msg
+	}
+	msg.Poll = nil
+
+	if cards && !poll.MultipleAnswers && msg.Card == nil {
+		msg.Card = pollCard(poll)
+		return msg
+	}
+
+	text := pollMarkdown(poll)
+	if msg.Formatted {
+		text = format.Convert(text, markup)
+	}
+	if strings.TrimSpace(msg.Content) != "" {
+		text = msg.Content + "\n\n" + text
+	}
+	msg.Content = text
+	return msg
+}
@@ -0,0 +1,67 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+func TestEmulatePoll(t *testing.T) {
+	poll := &bus.Poll{ID: "poll-1", Question: "Lunch?", Options: []string{"Pizza", "Sushi"}}
+
+	got := emulatePoll(bus.OutboundMessage{Content: "Quick vote", Poll: poll}, false, format.Markdown)
+	want := "Quick vote\n\n**Lunch?**\n\n1. Pizza\n2. Sushi\n\nReply with the number of your choice."
+	if got.Content != want || got.Poll != nil || got.Card != nil {
+		t.Errorf("text poll = %q (poll %v, card %v), want %q", got.Content, got.Poll, got.Card, want)
+	}
+
+	got = emulatePoll(bus.OutboundMessage{Poll: poll}, true, format.Markdown)
+	if got.Card == nil || got.Card.Title != "Lunch?" || len(got.Card.Buttons) != 2 || got.Card.Buttons[1].Reply != "2" {
+		t.Errorf("card poll = %+v", got.Card)
+	}
+
+	multi := *poll
+	multi.MultipleAnswers = true
+	got = emulatePoll(bus.OutboundMessage{Poll: &multi}, true, format.Markdown)
+	if got.Card != nil || !strings.Contains(got.Content, "numbers of your choices") {
+		t.Errorf("multiple-answer polls should be sent as text, got %q (card %v)", got.Content, got.Card)
+	}
+}
+
+func TestPollVote(t *testing.T) {
+	metadata := pollVoteMetadata(map[string]string{}, "poll-1", []int{0, 2})
+	pollID, options, ok := PollVote(metadata)
+	if !ok || pollID != "poll-1" || len(options) != 2 || options[1] != 2 {
+		t.Errorf("PollVote() = %q, %v, %v", pollID, options, ok)
+	}
+
+	if _, options, ok := PollVote(pollVoteMetadata(map[string]string{}, "poll-1", nil)); !ok || len(options) != 0 {
+		t.Errorf("retracted vote = %v, %v", options, ok)
+	}
+	if _, _, ok := PollVote(map[string]string{"message_id": "1"}); ok {
+		t.Error("expected no vote on a normal message")
+	}
+}
+
+func TestTelegramPollFits(t *testing.T) {
+	tests := []struct {
+		name string
+		poll bus.Poll
+		want bool
+	}{
+		{"fits", bus.Poll{Question: "Lunch?", Options: []string{"Pizza", "Sushi"}}, true},
+		{"one option", bus.Poll{Question: "Lunch?", Options: []string{"Pizza"}}, false},
+		{"too many options", bus.Poll{Question: "Lunch?", Options: make([]string, telegramMaxPollOptions+1)}, false},
+		{"long option", bus.Poll{Question: "Lunch?", Options: []string{"Pizza", strings.Repeat("x", telegramMaxPollOptionRunes+1)}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := telegramPollFits(&tt.poll); got != tt.want {
+				t.Errorf("telegramPollFits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
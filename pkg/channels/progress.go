@@ -0,0 +1,154 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// maxProgressLines is how many updates a progress message shows; older
+// ones are dropped so the message stays within platform limits
+const maxProgressLines = 15
+
+// progressStale is how long a progress message waits for its task's reply.
+// Older ones are left as they are instead of being replaced by whatever
+// reaches the chat next.
+const progressStale = 15 * time.Minute
+
+// editingChannel is implemented by channels that can change the text of
+// the messages they send. EditMessage replaces the text of a message with
+// msg.Content, converted like Send does; it fails when the content does not
+// fit one message.
+type editingChannel interface {
+	SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error)
+	EditMessage(ctx context.Context, chatID, messageID string, msg bus.OutboundMessage) error
+}
+
+// progressMessage is the message showing the updates of a running task
+type progressMessage struct {
+	messageID string
+	lines     []string
+	updated   time.Time
+}
+
+// progressTracker holds the progress message of each chat
+type progressTracker struct {
+	mu       sync.Mutex
+	messages map[string]*progressMessage // channel:chat_id -> message
+	now      func() time.Time
+}
+
+// take removes and returns the progress message of a chat, if it is recent
+func (t *progressTracker) take(key string) *progressMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pm := t.messages[key]
+	delete(t.messages, key)
+	if pm == nil || t.clock().Sub(pm.updated) > progressStale {
+		return nil
+	}
+	return pm
+}
+
+// put stores the progress message of a chat
+func (t *progressTracker) put(key string, pm *progressMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.messages == nil {
+		t.messages = make(map[string]*progressMessage)
+	}
+	pm.updated = t.clock()
+	t.messages[key] = pm
+}
+
+func (t *progressTracker) clock() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// sendProgress shows a progress update. Channels that can edit messages
+// append it to the chat's progress message; others send it on its own.
+func (m *Manager) sendProgress(ctx context.Context, channel Channel, msg bus.OutboundMessage) error {
+	ec, ok := channel.(editingChannel)
+	if !ok {
+		return channel.Send(ctx, msg)
+	}
+
+	key := msg.Channel + ":" + msg.ChatID
+	pm := m.progress.take(key)
+	if pm != nil {
+		pm.lines = append(pm.lines, msg.Content)
+		if len(pm.lines) > maxProgressLines {
+			pm.lines = pm.lines[len(pm.lines)-maxProgressLines:]
+		}
+		update := msg
+		update.Content = strings.Join(pm.lines, "\n")
+		err := ec.EditMessage(ctx, msg.ChatID, pm.messageID, update)
+		if err == nil {
+			m.progress.put(key, pm)
+			return nil
+		}
+		logger.DebugCF("channels", "Failed to edit progress message, sending a new one", map[string]interface{}{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+			"error":   err.Error(),
+		})
+	}
+
+	ids, err := ec.SendMessages(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		m.progress.put(key, &progressMessage{messageID: ids[len(ids)-1], lines: []string{msg.Content}})
+	}
+	return nil
+}
+
+// replaceProgress ends the progress message of the chat msg goes to, if
+// any, and reports whether msg was delivered by editing it. Replies that
+// fit one plain message take its place; for others it is deleted, where
+// the channel can, and msg is left to be sent.
+func (m *Manager) replaceProgress(ctx context.Context, channel Channel, msg bus.OutboundMessage) bool {
+	if msg.Reaction != "" || (msg.Notification != "" && msg.Notification != bus.NotificationError) {
+		// Reactions and unrelated notifications leave the task's updates alone
+		return false
+	}
+	pm := m.progress.take(msg.Channel + ":" + msg.ChatID)
+	if pm == nil {
+		return false
+	}
+
+	plain := strings.TrimSpace(msg.Content) != "" && len(msg.Attachments) == 0 && msg.Card == nil &&
+		len(msg.Keyboard) == 0 && msg.Poll == nil && msg.Contact == nil && m.messageTTL(msg) == 0
+	if ec, ok := channel.(editingChannel); ok && plain {
+		err := ec.EditMessage(ctx, msg.ChatID, pm.messageID, msg)
+		if err == nil {
+			return true
+		}
+		logger.DebugCF("channels", "Failed to replace progress message", map[string]interface{}{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+			"error":   err.Error(),
+		})
+	}
+
+	if dc, ok := channel.(deletingChannel); ok {
+		if err := dc.DeleteMessage(ctx, msg.ChatID, pm.messageID); err != nil {
+			logger.DebugCF("channels", "Failed to delete progress message", map[string]interface{}{
+				"channel": msg.Channel,
+				"chat_id": msg.ChatID,
+				"error":   err.Error(),
+			})
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// editingRecorder is a deletingRecorder that can edit what it sent
+type editingRecorder struct {
+	*deletingRecorder
+	edits   map[string]string // message ID -> current text
+	failing bool              // Edits fail, as for text too long to fit
+}
+
+func (c *editingRecorder) EditMessage(ctx context.Context, chatID, messageID string, msg bus.OutboundMessage) error {
+	if c.failing {
+		return errors.New("message too long")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.edits == nil {
+		c.edits = make(map[string]string)
+	}
+	c.edits[messageID] = msg.Content
+	return nil
+}
+
+func newProgressManager(channels map[string]Channel) *Manager {
+	return &Manager{channels: channels, bus: bus.NewMessageBus(), config: &config.Config{}}
+}
+
+func TestManagerProgressEditsOneMessage(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := &editingRecorder{deletingRecorder: &deletingRecorder{recordingChannel: &recordingChannel{BaseChannel: NewBaseChannel("test", nil, mb, nil)}}}
+	m := newProgressManager(map[string]Channel{"test": ch})
+
+	ctx := context.Background()
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "Running web_search", Progress: true})
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "Running read_file", Progress: true})
+	if len(ch.sent) != 1 {
+		t.Fatalf("progress updates should share one message, sent %d", len(ch.sent))
+	}
+	if got := ch.edits["m1"]; got != "Running web_search\nRunning read_file" {
+		t.Errorf("progress message = %q", got)
+	}
+
+	// A reminder for the chat leaves the progress message alone
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "Stand-up", Notification: bus.NotificationReminder})
+	if len(ch.sent) != 2 {
+		t.Fatalf("the reminder should be sent on its own, sent %d", len(ch.sent))
+	}
+
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "Here is the answer"})
+	if len(ch.sent) != 2 || ch.edits["m1"] != "Here is the answer" {
+		t.Errorf("the reply should replace the progress message, sent %d, edits %v", len(ch.sent), ch.edits)
+	}
+
+	// The next task starts a new progress message
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "Running exec", Progress: true})
+	if len(ch.sent) != 3 {
+		t.Errorf("expected a new progress message, sent %d", len(ch.sent))
+	}
+}
+
+func TestManagerProgressReplacedByDeletion(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := &editingRecorder{deletingRecorder: &deletingRecorder{recordingChannel: &recordingChannel{BaseChannel: NewBaseChannel("test", nil, mb, nil)}}}
+	m := newProgressManager(map[string]Channel{"test": ch})
+
+	ctx := context.Background()
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "Running exec", Progress: true})
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "Done", Attachments: []bus.Attachment{{Path: "/tmp/report.pdf"}}})
+	if len(ch.sent) != 2 || len(ch.deleted) != 1 || ch.deleted[0] != "chat/m1" {
+		t.Errorf("a reply with files should be sent and the progress message deleted, sent %d, deleted %v", len(ch.sent), ch.deleted)
+	}
+
+	ch.failing = true
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "Running exec", Progress: true})
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "test", ChatID: "chat", Content: "A very long answer"})
+	if len(ch.sent) != 4 || len(ch.deleted) != 2 || ch.deleted[1] != "chat/m3" {
+		t.Errorf("a reply that cannot be edited in should be sent, sent %d, deleted %v", len(ch.sent), ch.deleted)
+	}
+}
+
+func TestManagerProgressWithoutEdits(t *testing.T) {
+	mb := bus.NewMessageBus()
+	plain := &recordingChannel{BaseChannel: NewBaseChannel("plain", nil, mb, nil)}
+	m := newProgressManager(map[string]Channel{"plain": plain})
+
+	ctx := context.Background()
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "plain", ChatID: "chat", Content: "Running exec", Progress: true})
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "plain", ChatID: "chat", Content: "Running read_file", Progress: true})
+	m.sendOutbound(ctx, bus.OutboundMessage{Channel: "plain", ChatID: "chat", Content: "Done"})
+	if len(plain.sent) != 3 || plain.sent[1].Content != "Running read_file" {
+		t.Errorf("channels without edits should get every update on its own, got %v", plain.sent)
+	}
+}
+
+func TestProgressTrackerForgetsStaleMessages(t *testing.T) {
+	now := time.Now()
+	tr := progressTracker{now: func() time.Time { return now }}
+	tr.put("test:chat", &progressMessage{messageID: "1"})
+	now = now.Add(progressStale + time.Minute)
+	if pm := tr.take("test:chat"); pm != nil {
+		t.Errorf("stale progress message should be forgotten, got %+v", pm)
+	}
+}
@@ -0,0 +1,399 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/trace"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Repository event kinds that can be selected with the "events" config option.
+const (
+	RepoEventCIFailure   = "ci_failure"
+	RepoEventPullRequest = "pull_request"
+	RepoEventIssue       = "issue"
+)
+
+var defaultRepoEvents = []string{RepoEventCIFailure, RepoEventPullRequest, RepoEventIssue}
+
+// repoEvent is a provider-neutral summary of a webhook delivery.
+type repoEvent struct {
+	Provider string
+	Repo     string
+	Kind     string
+	Details  string
+}
+
+// RepoWebhookChannel ingests GitHub/GitLab webhooks and turns relevant repository
+// events into agent prompts. The agent's reply is forwarded to the configured
+// owner notification target.
+type RepoWebhookChannel struct {
+	*BaseChannel
+	config     config.RepoWebhookConfig
+	events     map[string]bool
+	httpServer *http.Server
+}
+
+// NewRepoWebhookChannel creates a new repository webhook channel.
+func NewRepoWebhookChannel(cfg config.RepoWebhookConfig, messageBus *bus.MessageBus) (*RepoWebhookChannel, error) {
+	if cfg.GitHubSecret == "" && cfg.GitLabToken == "" {
+		return nil, fmt.Errorf("repo webhook requires github_secret or gitlab_token")
+	}
+	if cfg.NotifyChannel == "" || cfg.NotifyChatID == "" {
+		return nil, fmt.Errorf("repo webhook requires notify_channel and notify_chat_id")
+	}
+
+	selected := cfg.Events
+	if len(selected) == 0 {
+		selected = defaultRepoEvents
+	}
+	events := make(map[string]bool, len(selected))
+	for _, e := range selected {
+		events[e] = true
+	}
+
+	return &RepoWebhookChannel{
+		BaseChannel: NewBaseChannel("repo_webhook", cfg, messageBus, nil),
+		config:      cfg,
+		events:      events,
+	}, nil
+}
+
+// Start launches the webhook HTTP server.
+func (c *RepoWebhookChannel) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	path := c.config.WebhookPath
+	if path == "" {
+		path = "/webhook/repo"
+	}
+	mux.HandleFunc(path, c.webhookHandler)
+
+	addr := fmt.Sprintf("%s:%d", c.config.WebhookHost, c.config.WebhookPort)
+	c.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.InfoCF("repo_webhook", "Repository webhook server listening", map[string]interface{}{
+			"addr": addr,
+			"path": path,
+		})
+		if err := c.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("repo_webhook", "Webhook server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	c.setRunning(true)
+	return nil
+}
+
+// Stop gracefully shuts down the HTTP server.
+func (c *RepoWebhookChannel) Stop(ctx context.Context) error {
+	if c.httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := c.httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.ErrorCF("repo_webhook", "Webhook server shutdown error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	c.setRunning(false)
+	return nil
+}
+
+// Send forwards the agent's summary to the owner's notification channel.
+func (c *RepoWebhookChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+	c.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:      c.config.NotifyChannel,
+		ChatID:       c.config.NotifyChatID,
+		Content:      msg.Content,
+		Notification: bus.NotificationRepoEvent,
+	})
+	return nil
+}
+
+func (c *RepoWebhookChannel) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 5<<20))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	var event *repoEvent
+	switch {
+	case r.Header.Get("X-GitHub-Event") != "":
+		if !c.verifyGitHubSignature(body, r.Header.Get("X-Hub-Signature-256")) {
+			logger.WarnC("repo_webhook", "Invalid GitHub webhook signature")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		event, err = parseGitHubEvent(r.Header.Get("X-GitHub-Event"), body)
+	case r.Header.Get("X-Gitlab-Event") != "":
+		if !c.verifyGitLabToken(r.Header.Get("X-Gitlab-Token")) {
+			logger.WarnC("repo_webhook", "Invalid GitLab webhook token")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		event, err = parseGitLabEvent(r.Header.Get("X-Gitlab-Event"), body)
+	default:
+		http.Error(w, "Unsupported webhook source", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		logger.ErrorCF("repo_webhook", "Failed to parse webhook payload", map[string]interface{}{
+			"error": err.Error(),
+		})
+		errs.WriteHTTP(w, fmt.Errorf("%w: %w", errs.ErrValidation, err))
+		return
+	}
+
+	traceID := trace.FromRequest(r)
+	w.Header().Set(trace.Header, traceID)
+	w.WriteHeader(http.StatusOK)
+
+	if event == nil || !c.events[event.Kind] {
+		return
+	}
+	c.publishEvent(event, traceID)
+}
+
+func (c *RepoWebhookChannel) publishEvent(event *repoEvent, traceID string) {
+	logger.InfoCF("repo_webhook", "Repository event received", map[string]interface{}{
+		"provider": event.Provider,
+		"repo":     event.Repo,
+		"kind":     event.Kind,
+		"trace_id": traceID,
+	})
+
+	prompt := fmt.Sprintf("Repository event from %s for %s:\n%s\n\n"+
+		"Write a short notification for the repository owner (one or two sentences). "+
+		"For CI failures, lead with what failed and the most likely cause.",
+		event.Provider, event.Repo, event.Details)
+
+	metadata := map[string]string{
+		"platform": event.Provider,
+		"repo":     event.Repo,
+		"event":    event.Kind,
+		"trace_id": traceID,
+	}
+
+	chatID := fmt.Sprintf("%s:%s", event.Provider, event.Repo)
+	c.HandleMessage(event.Provider, chatID, prompt, nil, metadata)
+}
+
+// verifyGitHubSignature validates the X-Hub-Signature-256 header.
+func (c *RepoWebhookChannel) verifyGitHubSignature(body []byte, signature string) bool {
+	if c.config.GitHubSecret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(c.config.GitHubSecret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// verifyGitLabToken validates the X-Gitlab-Token header.
+func (c *RepoWebhookChannel) verifyGitLabToken(token string) bool {
+	if c.config.GitLabToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.config.GitLabToken)) == 1
+}
+
+func parseGitHubEvent(eventType string, body []byte) (*repoEvent, error) {
+	var payload struct {
+		Action     string `json:"action"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		WorkflowRun struct {
+			Name       string `json:"name"`
+			HeadBranch string `json:"head_branch"`
+			HeadSHA    string `json:"head_sha"`
+			Conclusion string `json:"conclusion"`
+			HTMLURL    string `json:"html_url"`
+			HeadCommit struct {
+				Message string `json:"message"`
+				Author  struct {
+					Name string `json:"name"`
+				} `json:"author"`
+			} `json:"head_commit"`
+		} `json:"workflow_run"`
+		PullRequest struct {
+			Number  int    `json:"number"`
+			Title   string `json:"title"`
+			Body    string `json:"body"`
+			HTMLURL string `json:"html_url"`
+			User    struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"pull_request"`
+		Issue struct {
+			Number  int    `json:"number"`
+			Title   string `json:"title"`
+			Body    string `json:"body"`
+			HTMLURL string `json:"html_url"`
+			User    struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"issue"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	event := &repoEvent{Provider: "github", Repo: payload.Repository.FullName}
+
+	switch eventType {
+	case "workflow_run":
+		run := payload.WorkflowRun
+		if payload.Action != "completed" || (run.Conclusion != "failure" && run.Conclusion != "timed_out") {
+			return nil, nil
+		}
+		event.Kind = RepoEventCIFailure
+		event.Details = fmt.Sprintf("CI workflow %q %s on branch %s (commit %s by %s: %q)\n%s",
+			run.Name, run.Conclusion, run.HeadBranch, shortSHA(run.HeadSHA),
+			run.HeadCommit.Author.Name, firstLine(run.HeadCommit.Message), run.HTMLURL)
+	case "pull_request":
+		if payload.Action != "opened" && payload.Action != "reopened" && payload.Action != "ready_for_review" {
+			return nil, nil
+		}
+		pr := payload.PullRequest
+		event.Kind = RepoEventPullRequest
+		event.Details = fmt.Sprintf("Pull request #%d %s by %s: %q\n%s\n%s",
+			pr.Number, payload.Action, pr.User.Login, pr.Title, utils.Truncate(pr.Body, 500), pr.HTMLURL)
+	case "issues":
+		if payload.Action != "opened" && payload.Action != "reopened" {
+			return nil, nil
+		}
+		issue := payload.Issue
+		event.Kind = RepoEventIssue
+		event.Details = fmt.Sprintf("Issue #%d %s by %s: %q\n%s\n%s",
+			issue.Number, payload.Action, issue.User.Login, issue.Title, utils.Truncate(issue.Body, 500), issue.HTMLURL)
+	default:
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+func parseGitLabEvent(eventType string, body []byte) (*repoEvent, error) {
+	var payload struct {
+		User struct {
+			Username string `json:"username"`
+		} `json:"user"`
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+			WebURL            string `json:"web_url"`
+		} `json:"project"`
+		ObjectAttributes struct {
+			ID          int    `json:"id"`
+			IID         int    `json:"iid"`
+			Action      string `json:"action"`
+			Status      string `json:"status"`
+			Ref         string `json:"ref"`
+			SHA         string `json:"sha"`
+			Title       string `json:"title"`
+			Description string `json:"description"`
+			URL         string `json:"url"`
+		} `json:"object_attributes"`
+		Commit struct {
+			Message string `json:"message"`
+			Author  struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"commit"`
+		Builds []struct {
+			Name   string `json:"name"`
+			Stage  string `json:"stage"`
+			Status string `json:"status"`
+		} `json:"builds"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	attrs := payload.ObjectAttributes
+	event := &repoEvent{Provider: "gitlab", Repo: payload.Project.PathWithNamespace}
+
+	switch eventType {
+	case "Pipeline Hook":
+		if attrs.Status != "failed" {
+			return nil, nil
+		}
+		var failed []string
+		for _, b := range payload.Builds {
+			if b.Status == "failed" {
+				failed = append(failed, fmt.Sprintf("%s (%s)", b.Name, b.Stage))
+			}
+		}
+		link := attrs.URL
+		if link == "" {
+			link = fmt.Sprintf("%s/-/pipelines/%d", payload.Project.WebURL, attrs.ID)
+		}
+		event.Kind = RepoEventCIFailure
+		event.Details = fmt.Sprintf("Pipeline #%d failed on %s (commit %s by %s: %q)\nFailed jobs: %s\n%s",
+			attrs.ID, attrs.Ref, shortSHA(attrs.SHA), payload.Commit.Author.Name,
+			firstLine(payload.Commit.Message), strings.Join(failed, ", "), link)
+	case "Merge Request Hook":
+		if attrs.Action != "open" && attrs.Action != "reopen" {
+			return nil, nil
+		}
+		event.Kind = RepoEventPullRequest
+		event.Details = fmt.Sprintf("Merge request !%d %sed by %s: %q\n%s\n%s",
+			attrs.IID, attrs.Action, payload.User.Username, attrs.Title, utils.Truncate(attrs.Description, 500), attrs.URL)
+	case "Issue Hook":
+		if attrs.Action != "open" && attrs.Action != "reopen" {
+			return nil, nil
+		}
+		event.Kind = RepoEventIssue
+		event.Details = fmt.Sprintf("Issue #%d %sed by %s: %q\n%s\n%s",
+			attrs.IID, attrs.Action, payload.User.Username, attrs.Title, utils.Truncate(attrs.Description, 500), attrs.URL)
+	default:
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func firstLine(s string) string {
+	if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+		return s[:idx]
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package channels
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestParseGitHubWorkflowFailure(t *testing.T) {
+	body := []byte(`{
+		"action": "completed",
+		"repository": {"full_name": "acme/app"},
+		"workflow_run": {
+			"name": "CI",
+			"head_branch": "main",
+			"head_sha": "0123456789abcdef",
+			"conclusion": "failure",
+			"html_url": "https://github.com/acme/app/actions/runs/1",
+			"head_commit": {"message": "Bump deps\n\nlong body", "author": {"name": "Alice"}}
+		}
+	}`)
+
+	event, err := parseGitHubEvent("workflow_run", body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event == nil || event.Kind != RepoEventCIFailure {
+		t.Fatalf("expected ci_failure event, got %+v", event)
+	}
+	if event.Repo != "acme/app" {
+		t.Errorf("Repo = %q, want acme/app", event.Repo)
+	}
+	if !strings.Contains(event.Details, "0123456") || strings.Contains(event.Details, "long body") {
+		t.Errorf("unexpected details: %s", event.Details)
+	}
+
+	success := strings.Replace(string(body), `"failure"`, `"success"`, 1)
+	event, err = parseGitHubEvent("workflow_run", []byte(success))
+	if err != nil || event != nil {
+		t.Errorf("successful runs should be ignored, got %+v, %v", event, err)
+	}
+}
+
+func TestParseGitLabPipelineFailure(t *testing.T) {
+	body := []byte(`{
+		"project": {"path_with_namespace": "group/project", "web_url": "https://gitlab.com/group/project"},
+		"object_attributes": {"id": 99, "status": "failed", "ref": "main", "sha": "abcdef0123"},
+		"commit": {"message": "Refactor", "author": {"name": "Bob"}},
+		"builds": [
+			{"name": "unit", "stage": "test", "status": "failed"},
+			{"name": "lint", "stage": "test", "status": "success"}
+		]
+	}`)
+
+	event, err := parseGitLabEvent("Pipeline Hook", body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event == nil || event.Kind != RepoEventCIFailure {
+		t.Fatalf("expected ci_failure event, got %+v", event)
+	}
+	if !strings.Contains(event.Details, "unit (test)") || strings.Contains(event.Details, "lint") {
+		t.Errorf("expected only failed jobs in details: %s", event.Details)
+	}
+	if !strings.Contains(event.Details, "/-/pipelines/99") {
+		t.Errorf("expected pipeline link in details: %s", event.Details)
+	}
+}
+
+func TestRepoWebhookSignatureVerification(t *testing.T) {
+	ch := &RepoWebhookChannel{config: config.RepoWebhookConfig{GitHubSecret: "s3cret", GitLabToken: "tok"}}
+
+	body := []byte(`{"zen": "hi"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	valid := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !ch.verifyGitHubSignature(body, valid) {
+		t.Error("valid GitHub signature rejected")
+	}
+	if ch.verifyGitHubSignature(body, "sha256=deadbeef") {
+		t.Error("invalid GitHub signature accepted")
+	}
+	if !ch.verifyGitLabToken("tok") || ch.verifyGitLabToken("nope") {
+		t.Error("GitLab token verification mismatch")
+	}
+}
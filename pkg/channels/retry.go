@@ -0,0 +1,156 @@
+package channels
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// UnlimitedRetries makes a RetryPolicy retry forever
+const UnlimitedRetries = -1
+
+// RetryPolicy configures how a channel reconnects after losing its connection
+type RetryPolicy struct {
+	MaxAttempts  int           // UnlimitedRetries to never give up
+	InitialDelay time.Duration // Delay before the first retry
+	MaxDelay     time.Duration // Cap for the exponential backoff
+	Jitter       float64       // Fraction (0-1) by which each delay is randomized
+	ResetAfter   time.Duration // How long a connection must stay up to reset the backoff
+}
+
+// DefaultRetryPolicy returns the policy used when nothing is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  MaxReconnectAttempts,
+		InitialDelay: InitialReconnectDelay,
+		MaxDelay:     MaxReconnectDelay,
+	}
+}
+
+// withDefaults fills unset fields from DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	def := DefaultRetryPolicy()
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = def.MaxAttempts
+	} else if p.MaxAttempts < 0 {
+		p.MaxAttempts = UnlimitedRetries
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = def.InitialDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = def.MaxDelay
+	}
+	if p.MaxDelay < p.InitialDelay {
+		p.MaxDelay = p.InitialDelay
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	return p
+}
+
+// ConnectionRetry implementa backoff exponencial para reconexiones
+type ConnectionRetry struct {
+	policy       RetryPolicy
+	attempts     int
+	currentDelay time.Duration
+	connectedAt  time.Time
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	now  func() time.Time
+}
+
+// NewConnectionRetry creates a reconnection manager with the default policy
+func NewConnectionRetry() *ConnectionRetry {
+	return NewConnectionRetryWithPolicy(DefaultRetryPolicy())
+}
+
+// NewConnectionRetryWithPolicy creates a reconnection manager. Unset policy
+// fields take their default values.
+func NewConnectionRetryWithPolicy(policy RetryPolicy) *ConnectionRetry {
+	policy = policy.withDefaults()
+	return &ConnectionRetry{
+		policy:       policy,
+		currentDelay: policy.InitialDelay,
+		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:          time.Now,
+	}
+}
+
+// NextDelay returns the next delay for reconnection
+func (r *ConnectionRetry) NextDelay() time.Duration {
+	if !r.ShouldRetry() {
+		return 0 // No more retries
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts++
+	delay := r.currentDelay
+
+	// Exponential backoff
+	r.currentDelay *= 2
+	if r.currentDelay > r.policy.MaxDelay {
+		r.currentDelay = r.policy.MaxDelay
+	}
+
+	// Spread reconnections so many clients do not hit the server in lockstep
+	if r.policy.Jitter > 0 {
+		delta := (r.rand.Float64()*2 - 1) * r.policy.Jitter * float64(delay)
+		delay += time.Duration(delta)
+	}
+	return delay
+}
+
+// Reset reinicia el contador de intentos
+func (r *ConnectionRetry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = 0
+	r.currentDelay = r.policy.InitialDelay
+}
+
+// Connected records a successful connection. The backoff is only reset once
+// the connection has stayed up for the policy's ResetAfter window, so a
+// server that accepts and immediately drops connections still backs off.
+func (r *ConnectionRetry) Connected() {
+	r.mu.Lock()
+	r.connectedAt = r.now()
+	r.mu.Unlock()
+
+	if r.policy.ResetAfter == 0 {
+		r.Reset()
+	}
+}
+
+// Disconnected records the loss of a connection opened with Connected.
+func (r *ConnectionRetry) Disconnected() {
+	r.mu.Lock()
+	stable := !r.connectedAt.IsZero() && r.now().Sub(r.connectedAt) >= r.policy.ResetAfter
+	r.connectedAt = time.Time{}
+	r.mu.Unlock()
+
+	if stable {
+		r.Reset()
+	}
+}
+
+// ShouldRetry indica si se debe intentar reconectar
+func (r *ConnectionRetry) ShouldRetry() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.policy.MaxAttempts == UnlimitedRetries || r.attempts < r.policy.MaxAttempts
+}
+
+// GetAttempts returns the number of attempts made
+func (r *ConnectionRetry) GetAttempts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts
+}
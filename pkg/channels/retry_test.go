@@ -0,0 +1,94 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestConnectionRetryBackoff(t *testing.T) {
+	r := NewConnectionRetryWithPolicy(RetryPolicy{
+		MaxAttempts:  4,
+		InitialDelay: time.Second,
+		MaxDelay:     3 * time.Second,
+	})
+
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+	for i, w := range want {
+		if got := r.NextDelay(); got != w {
+			t.Errorf("attempt %d: delay = %v, want %v", i+1, got, w)
+		}
+	}
+	if r.ShouldRetry() || r.NextDelay() != 0 {
+		t.Error("expected retries to be exhausted")
+	}
+}
+
+func TestConnectionRetryUnlimitedWithJitter(t *testing.T) {
+	r := NewConnectionRetryWithPolicy(RetryPolicy{
+		MaxAttempts:  UnlimitedRetries,
+		InitialDelay: time.Second,
+		MaxDelay:     time.Second,
+		Jitter:       0.5,
+	})
+
+	for i := 0; i < 100; i++ {
+		if !r.ShouldRetry() {
+			t.Fatalf("unlimited policy gave up after %d attempts", i)
+		}
+		if d := r.NextDelay(); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("jittered delay %v outside ±50%% of 1s", d)
+		}
+	}
+}
+
+func TestConnectionRetryResetAfter(t *testing.T) {
+	r := NewConnectionRetryWithPolicy(RetryPolicy{MaxAttempts: 5, ResetAfter: time.Minute})
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	r.NextDelay()
+	r.NextDelay()
+
+	// A connection dropped right away keeps the backoff
+	r.Connected()
+	r.Disconnected()
+	if r.GetAttempts() != 2 {
+		t.Errorf("short-lived connection reset attempts to %d", r.GetAttempts())
+	}
+
+	// A connection that stayed up past the window resets it
+	r.Connected()
+	now = now.Add(2 * time.Minute)
+	r.Disconnected()
+	if r.GetAttempts() != 0 {
+		t.Errorf("stable connection should reset attempts, got %d", r.GetAttempts())
+	}
+}
+
+func TestPublishGaveUp(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("whatsapp", nil, msgBus, nil)
+	ch.setRunning(true)
+
+	ch.publishGaveUp(5, errors.New("connection refused"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected a system event")
+	}
+	if msg.Channel != "system" || msg.Metadata["event"] != EventChannelGaveUp || msg.Metadata["channel"] != "whatsapp" {
+		t.Errorf("unexpected event: %+v", msg)
+	}
+	if ch.IsRunning() {
+		t.Error("channel should no longer be running")
+	}
+	if h := ch.Health(); h.State != StateGivenUp || h.Reason != "connection refused" {
+		t.Errorf("health = %v, want given up", h)
+	}
+}
@@ -2,6 +2,7 @@ package channels
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -14,6 +15,8 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
@@ -25,10 +28,12 @@ type SlackChannel struct {
 	api          *slack.Client
 	socketClient *socketmode.Client
 	botUserID    string
-	transcriber  *voice.GroqTranscriber
+	transcriber  voice.Transcriber
 	ctx          context.Context
 	cancel       context.CancelFunc
 	pendingAcks  sync.Map
+	markup       format.Style
+	mediaDir     string
 }
 
 type slackMessageRef struct {
@@ -37,8 +42,17 @@ type slackMessageRef struct {
 }
 
 func NewSlackChannel(cfg config.SlackConfig, messageBus *bus.MessageBus) (*SlackChannel, error) {
-	if cfg.BotToken == "" || cfg.AppToken == "" {
-		return nil, fmt.Errorf("slack bot_token and app_token are required")
+	switch cfg.Mode {
+	case "", SlackModeSocket:
+		if cfg.BotToken == "" || cfg.AppToken == "" {
+			return nil, fmt.Errorf("slack bot_token and app_token are required")
+		}
+	case SlackModeEvents:
+		if cfg.BotToken == "" || cfg.SigningSecret == "" {
+			return nil, fmt.Errorf("slack bot_token and signing_secret are required in events mode")
+		}
+	default:
+		return nil, fmt.Errorf("unknown slack mode %q (want socket or events)", cfg.Mode)
 	}
 
 	api := slack.New(
@@ -46,24 +60,43 @@ func NewSlackChannel(cfg config.SlackConfig, messageBus *bus.MessageBus) (*Slack
 		slack.OptionAppLevelToken(cfg.AppToken),
 	)
 
-	socketClient := socketmode.New(api)
+	var socketClient *socketmode.Client
+	if cfg.Mode != SlackModeEvents {
+		socketClient = socketmode.New(api)
+	}
 
 	base := NewBaseChannel("slack", cfg, messageBus, cfg.AllowFrom)
 
+	markup, err := format.ParseStyle(cfg.Format, format.Slack)
+	if err != nil {
+		logger.WarnCF("slack", "Invalid format, using the default", map[string]interface{}{
+			"error":  err.Error(),
+			"format": string(markup),
+		})
+	}
+
 	return &SlackChannel{
 		BaseChannel:  base,
 		config:       cfg,
 		api:          api,
 		socketClient: socketClient,
+		markup:       markup,
 	}, nil
 }
 
-func (c *SlackChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+// RendersCards reports that the channel sends cards as Block Kit blocks
+func (c *SlackChannel) RendersCards() bool {
+	return true
+}
+
+func (c *SlackChannel) SetTranscriber(transcriber voice.Transcriber) {
 	c.transcriber = transcriber
 }
 
 func (c *SlackChannel) Start(ctx context.Context) error {
-	logger.InfoC("slack", "Starting Slack channel (Socket Mode)")
+	logger.InfoCF("slack", "Starting Slack channel", map[string]interface{}{
+		"mode": c.mode(),
+	})
 
 	c.ctx, c.cancel = context.WithCancel(ctx)
 
@@ -78,20 +111,25 @@ func (c *SlackChannel) Start(ctx context.Context) error {
 		"team":        authResp.Team,
 	})
 
-	go c.eventLoop()
+	// In events mode Slack posts to ServeHTTP instead
+	if c.socketClient != nil {
+		go c.eventLoop()
 
-	go func() {
-		if err := c.socketClient.RunContext(c.ctx); err != nil {
-			if c.ctx.Err() == nil {
-				logger.ErrorCF("slack", "Socket Mode connection error", map[string]interface{}{
-					"error": err.Error(),
-				})
+		go func() {
+			if err := c.socketClient.RunContext(c.ctx); err != nil {
+				if c.ctx.Err() == nil {
+					logger.ErrorCF("slack", "Socket Mode connection error", map[string]interface{}{
+						"error": err.Error(),
+					})
+				}
 			}
-		}
-	}()
+		}()
+	}
 
 	c.setRunning(true)
-	logger.InfoC("slack", "Slack channel started (Socket Mode)")
+	logger.InfoCF("slack", "Slack channel started", map[string]interface{}{
+		"mode": c.mode(),
+	})
 	return nil
 }
 
@@ -108,26 +146,50 @@ func (c *SlackChannel) Stop(ctx context.Context) error {
 }
 
 func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	_, err := c.SendMessages(ctx, msg)
+	return err
+}
+
+// SendMessages sends msg and returns the timestamps identifying the posted
+// Slack messages, so they can be deleted later. Attachments are uploaded
+// into the same thread.
+func (c *SlackChannel) SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error) {
 	if !c.IsRunning() {
-		return fmt.Errorf("slack channel not running")
+		return nil, fmt.Errorf("%w: slack channel not running", errs.ErrChannelDown)
 	}
 
 	channelID, threadTS := parseSlackChatID(msg.ChatID)
 	if channelID == "" {
-		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
+		return nil, fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
 	}
 
-	opts := []slack.MsgOption{
-		slack.MsgOptionText(msg.Content, false),
+	if !msg.Formatted {
+		msg.Content = format.Convert(msg.Content, c.markup)
 	}
 
-	if threadTS != "" {
-		opts = append(opts, slack.MsgOptionTS(threadTS))
+	var ids []string
+	if strings.TrimSpace(msg.Content) != "" || msg.Card != nil || len(msg.Attachments) == 0 {
+		opts := []slack.MsgOption{
+			slackContentOption(msg),
+		}
+
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
+
+		_, ts, err := c.api.PostMessageContext(ctx, channelID, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send slack message: %w", err)
+		}
+		ids = append(ids, ts)
 	}
 
-	_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
-	if err != nil {
-		return fmt.Errorf("failed to send slack message: %w", err)
+	for _, att := range msg.Attachments {
+		ts, err := c.uploadAttachment(ctx, channelID, threadTS, att, msg.Formatted)
+		ids = appendID(ids, ts)
+		if err != nil {
+			return ids, err
+		}
 	}
 
 	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
@@ -143,7 +205,67 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		"thread_ts":  threadTS,
 	})
 
-	return nil
+	return ids, nil
+}
+
+// DeleteMessage deletes a message posted by the bot
+func (c *SlackChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	channelID, _ := parseSlackChatID(chatID)
+	_, _, err := c.api.DeleteMessageContext(ctx, channelID, messageID)
+	return err
+}
+
+// EditMessage replaces the text of a message sent by the bot
+func (c *SlackChannel) EditMessage(ctx context.Context, chatID, messageID string, msg bus.OutboundMessage) error {
+	channelID, _ := parseSlackChatID(chatID)
+	if !msg.Formatted {
+		msg.Content = format.Convert(msg.Content, c.markup)
+	}
+	_, _, _, err := c.api.UpdateMessageContext(ctx, channelID, messageID, slackContentOption(msg))
+	return err
+}
+
+// slackContentOption sends formatted content holding a JSON array of blocks,
+// as notification templates may produce, as Block Kit blocks. Other
+// replies go in section blocks, formatted content as text. Cards are
+// appended as blocks, with the content as text fallback for notifications.
+func slackContentOption(msg bus.OutboundMessage) slack.MsgOption {
+	var blocks []slack.Block
+	content := strings.TrimSpace(msg.Content)
+	if msg.Formatted && strings.HasPrefix(content, "[") {
+		var parsed slack.Blocks
+		err := json.Unmarshal([]byte(content), &parsed)
+		if err == nil {
+			if msg.Card == nil {
+				return slack.MsgOptionBlocks(parsed.BlockSet...)
+			}
+			blocks = parsed.BlockSet
+		} else {
+			logger.WarnCF("slack", "Invalid blocks in formatted message, sending as text", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	if msg.Card == nil {
+		if msg.Formatted || content == "" {
+			return slack.MsgOptionText(msg.Content, false)
+		}
+		return slack.MsgOptionCompose(
+			slack.MsgOptionText(msg.Content, false),
+			slack.MsgOptionBlocks(slackTextBlocks(msg.Content)...),
+		)
+	}
+
+	fallback := msg.Card.Title
+	if blocks == nil && content != "" {
+		fallback = msg.Content
+		blocks = append(blocks, slackTextBlocks(msg.Content)...)
+	}
+	blocks = append(blocks, slackCardBlocks(msg.Card)...)
+	return slack.MsgOptionCompose(
+		slack.MsgOptionText(fallback, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
 }
 
 func (c *SlackChannel) eventLoop() {
@@ -161,9 +283,7 @@ func (c *SlackChannel) eventLoop() {
 			case socketmode.EventTypeSlashCommand:
 				c.handleSlashCommand(event)
 			case socketmode.EventTypeInteractive:
-				if event.Request != nil {
-					c.socketClient.Ack(*event.Request)
-				}
+				c.handleInteractive(event)
 			}
 		}
 	}
@@ -178,7 +298,11 @@ func (c *SlackChannel) handleEventsAPI(event socketmode.Event) {
 	if !ok {
 		return
 	}
+	c.handleInnerEvent(eventsAPIEvent)
+}
 
+// handleInnerEvent handles an Events API event from either mode
+func (c *SlackChannel) handleInnerEvent(eventsAPIEvent slackevents.EventsAPIEvent) {
 	switch ev := eventsAPIEvent.InnerEvent.Data.(type) {
 	case *slackevents.MessageEvent:
 		c.handleMessageEvent(ev)
@@ -214,6 +338,8 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 	chatID := channelID
 	if threadTS != "" {
 		chatID = channelID + "/" + threadTS
+	} else if c.config.ReplyInThreads && ev.ChannelType != "im" {
+		chatID = channelID + "/" + messageTS
 	}
 
 	c.api.AddReaction("eyes", slack.ItemRef{
@@ -250,7 +376,9 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 			if localPath == "" {
 				continue
 			}
-			localFiles = append(localFiles, localPath)
+			if c.mediaDir == "" {
+				localFiles = append(localFiles, localPath)
+			}
 			mediaPaths = append(mediaPaths, localPath)
 
 			if utils.IsAudioFile(file.Name, file.Mimetype) && c.transcriber != nil && c.transcriber.IsAvailable() {
@@ -342,6 +470,63 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 	c.HandleMessage(senderID, chatID, content, nil, metadata)
 }
 
+// handleInteractive turns presses of card reply buttons into messages from
+// the user who pressed them
+func (c *SlackChannel) handleInteractive(event socketmode.Event) {
+	if event.Request != nil {
+		c.socketClient.Ack(*event.Request)
+	}
+
+	callback, ok := event.Data.(slack.InteractionCallback)
+	if !ok {
+		return
+	}
+	c.handleInteraction(callback)
+}
+
+// handleInteraction handles an interaction from either mode
+func (c *SlackChannel) handleInteraction(callback slack.InteractionCallback) {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+
+	if !c.IsAllowed(callback.User.ID) {
+		logger.DebugCF("slack", "Button press rejected by allowlist", map[string]interface{}{
+			"user_id": callback.User.ID,
+		})
+		return
+	}
+
+	channelID := callback.Container.ChannelID
+	if channelID == "" {
+		channelID = callback.Channel.ID
+	}
+	chatID := channelID
+	if threadTS := callback.Container.ThreadTs; threadTS != "" {
+		chatID = channelID + "/" + threadTS
+	}
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		// URL buttons have no value, the link opens client-side
+		if !strings.HasPrefix(action.ActionID, slackCardActionPrefix) || action.Value == "" {
+			continue
+		}
+
+		logger.DebugCF("slack", "Card button pressed", map[string]interface{}{
+			"sender_id": callback.User.ID,
+			"chat_id":   chatID,
+			"reply":     utils.Truncate(action.Value, 50),
+		})
+
+		metadata := map[string]string{
+			"channel_id": channelID,
+			"thread_ts":  callback.Container.ThreadTs,
+			"platform":   "slack",
+		}
+		c.HandleMessage(callback.User.ID, chatID, action.Value, nil, choiceMetadata(metadata, action.Value, action.Text.Text))
+	}
+}
+
 func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 	cmd, ok := event.Data.(slack.SlashCommand)
 	if !ok {
@@ -351,7 +536,11 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 	if event.Request != nil {
 		c.socketClient.Ack(*event.Request)
 	}
+	c.handleCommand(cmd)
+}
 
+// handleCommand handles a slash command from either mode
+func (c *SlackChannel) handleCommand(cmd slack.SlashCommand) {
 	if !c.IsAllowed(cmd.UserID) {
 		logger.DebugCF("slack", "Slash command rejected by allowlist", map[string]interface{}{
 			"user_id": cmd.UserID,
@@ -396,6 +585,7 @@ func (c *SlackChannel) downloadSlackFile(file slack.File) string {
 
 	return utils.DownloadFile(downloadURL, file.Name, utils.DownloadOptions{
 		LoggerPrefix: "slack",
+		Dir:          c.mediaDir,
 		ExtraHeaders: map[string]string{
 			"Authorization": "Bearer " + c.config.BotToken,
 		},
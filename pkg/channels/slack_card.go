@@ -0,0 +1,67 @@
+package channels
+
+import (
+	"fmt"
+
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// Block Kit limits
+const (
+	slackMaxSectionFields = 10
+	slackMaxActions       = 25
+)
+
+// slackCardActionPrefix prefixes the action IDs of card buttons, so the
+// interaction handler can tell them from other actions
+const slackCardActionPrefix = "card_button_"
+
+// slackCardBlocks renders a card as Block Kit blocks. Reply buttons carry
+// the reply as their value.
+func slackCardBlocks(card *bus.Card) []slack.Block {
+	var blocks []slack.Block
+	if card.Title != "" {
+		blocks = append(blocks, slack.NewHeaderBlock(
+			slack.NewTextBlockObject(slack.PlainTextType, card.Title, true, false)))
+	}
+	if card.Text != "" {
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, card.Text, false, false), nil, nil))
+	}
+
+	for start := 0; start < len(card.Fields); start += slackMaxSectionFields {
+		end := min(start+slackMaxSectionFields, len(card.Fields))
+		fields := make([]*slack.TextBlockObject, 0, end-start)
+		for _, f := range card.Fields[start:end] {
+			fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType,
+				fmt.Sprintf("*%s*\n%s", f.Label, f.Value), false, false))
+		}
+		blocks = append(blocks, slack.NewSectionBlock(nil, fields, nil))
+	}
+
+	if card.ImageURL != "" {
+		blocks = append(blocks, slack.NewImageBlock(card.ImageURL, card.Title, "", nil))
+	}
+
+	if len(card.Buttons) > 0 {
+		elements := make([]slack.BlockElement, 0, len(card.Buttons))
+		for i, b := range card.Buttons {
+			if i == slackMaxActions {
+				break
+			}
+			text := slack.NewTextBlockObject(slack.PlainTextType, b.Label, true, false)
+			button := slack.NewButtonBlockElement(fmt.Sprintf("%s%d", slackCardActionPrefix, i), "", text)
+			if b.URL != "" {
+				button = button.WithURL(b.URL)
+			} else {
+				button.Value = cardButtonReply(b)
+			}
+			elements = append(elements, button)
+		}
+		blocks = append(blocks, slack.NewActionBlock("", elements...))
+	}
+
+	return blocks
+}
@@ -0,0 +1,147 @@
+package channels
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Slack connection modes
+const (
+	SlackModeSocket = "socket"
+	SlackModeEvents = "events"
+)
+
+// DefaultSlackWebhookPath is where Slack posts to in events mode when
+// webhook_path is not set
+const DefaultSlackWebhookPath = "/slack/events"
+
+// slackMaxRequestBody caps the size of requests from Slack
+const slackMaxRequestBody = 1 << 20
+
+// mode returns the configured connection mode
+func (c *SlackChannel) mode() string {
+	if c.config.Mode == "" {
+		return SlackModeSocket
+	}
+	return c.config.Mode
+}
+
+// WebhookPath returns the gateway path Slack posts to in events mode, or ""
+// in Socket Mode
+func (c *SlackChannel) WebhookPath() string {
+	if c.mode() != SlackModeEvents {
+		return ""
+	}
+	if c.config.WebhookPath == "" {
+		return DefaultSlackWebhookPath
+	}
+	return c.config.WebhookPath
+}
+
+// ServeHTTP receives Events API events, interactions and slash commands.
+// Requests must carry a valid Slack signature. They are acknowledged at
+// once and handled in the background, since Slack waits only 3 seconds.
+func (c *SlackChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !c.IsRunning() {
+		http.Error(w, "slack channel not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, slackMaxRequestBody))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if err := verifySlackRequest(r.Header, body, c.config.SigningSecret); err != nil {
+		logger.WarnCF("slack", "Rejected request with invalid signature", map[string]interface{}{
+			"remote": r.RemoteAddr,
+			"error":  err.Error(),
+		})
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	// Retries only follow requests that were not acknowledged in time,
+	// which were handled anyway
+	if r.Header.Get("X-Slack-Retry-Num") != "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+		c.serveForm(w, body)
+		return
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+	if event.Type == slackevents.URLVerification {
+		if v, ok := event.Data.(*slackevents.EventsAPIURLVerificationEvent); ok {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(v.Challenge))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	if event.Type == slackevents.CallbackEvent {
+		go c.handleInnerEvent(event)
+	}
+}
+
+// serveForm handles interactions, which carry a JSON payload, and slash
+// commands, which are plain form posts
+func (c *SlackChannel) serveForm(w http.ResponseWriter, body []byte) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	if payload := form.Get("payload"); payload != "" {
+		var callback slack.InteractionCallback
+		if err := json.Unmarshal([]byte(payload), &callback); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		go c.handleInteraction(callback)
+		return
+	}
+
+	req := &http.Request{Method: http.MethodPost, Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(body))}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	cmd, err := slack.SlashCommandParse(req)
+	if err != nil || cmd.Command == "" {
+		http.Error(w, "invalid slash command", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	go c.handleCommand(cmd)
+}
+
+// verifySlackRequest checks the signature Slack puts on its requests
+func verifySlackRequest(header http.Header, body []byte, signingSecret string) error {
+	verifier, err := slack.NewSecretsVerifier(header, signingSecret)
+	if err != nil {
+		return err
+	}
+	if _, err := verifier.Write(body); err != nil {
+		return err
+	}
+	return verifier.Ensure()
+}
@@ -0,0 +1,94 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestNewSlackChannelModes(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	tests := []struct {
+		name    string
+		cfg     config.SlackConfig
+		path    string
+		wantErr bool
+	}{
+		{"socket mode", config.SlackConfig{BotToken: "xoxb", AppToken: "xapp"}, "", false},
+		{"events mode", config.SlackConfig{Mode: "events", BotToken: "xoxb", SigningSecret: "s"}, DefaultSlackWebhookPath, false},
+		{"custom path", config.SlackConfig{Mode: "events", BotToken: "xoxb", SigningSecret: "s", WebhookPath: "/hooks/slack"}, "/hooks/slack", false},
+		{"events without secret", config.SlackConfig{Mode: "events", BotToken: "xoxb", AppToken: "xapp"}, "", true},
+		{"unknown mode", config.SlackConfig{Mode: "rtm", BotToken: "xoxb", AppToken: "xapp"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, err := NewSlackChannel(tt.cfg, msgBus)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ch.WebhookPath() != tt.path {
+				t.Errorf("WebhookPath() = %q, want %q", ch.WebhookPath(), tt.path)
+			}
+		})
+	}
+}
+
+func signedSlackRequest(secret, contentType, body string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":" + body))
+
+	req := httptest.NewRequest(http.MethodPost, DefaultSlackWebhookPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestSlackEventsServeHTTP(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch, err := NewSlackChannel(config.SlackConfig{Mode: "events", BotToken: "xoxb", SigningSecret: "shh"}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.setRunning(true)
+
+	challenge := `{"type": "url_verification", "token": "t", "challenge": "abc123"}`
+
+	rec := httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedSlackRequest("wrong", "application/json", challenge))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("bad signature: status %d, want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedSlackRequest("shh", "application/json", challenge))
+	if rec.Code != http.StatusOK || rec.Body.String() != "abc123" {
+		t.Errorf("url verification: status %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	form := url.Values{"command": {"/ask"}, "text": {"status?"}, "user_id": {"U1"}, "channel_id": {"C1"}}
+	rec = httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedSlackRequest("shh", "application/x-www-form-urlencoded", form.Encode()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("slash command: status %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok || msg.Content != "status?" || msg.ChatID != "C1" || msg.SenderID != "U1" {
+		t.Errorf("inbound = %+v, %v", msg, ok)
+	}
+}
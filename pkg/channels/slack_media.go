@@ -0,0 +1,87 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+// slackSectionChunk is where text is split into section blocks, which
+// hold up to 3000 characters, leaving room for code blocks kept whole
+const slackSectionChunk = 2500
+
+// SetMediaDir makes the channel keep incoming files in dir, where the agent
+// can read them later. Without it files are downloaded to a temporary
+// directory and deleted once the message is handed over.
+func (c *SlackChannel) SetMediaDir(dir string) {
+	c.mediaDir = dir
+}
+
+// Markup returns the markup the channel sends
+func (c *SlackChannel) Markup() format.Style {
+	return c.markup
+}
+
+// slackTextBlocks puts mrkdwn text into section blocks
+func slackTextBlocks(text string) []slack.Block {
+	var blocks []slack.Block
+	for _, chunk := range splitMessage(text, slackSectionChunk) {
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, chunk, false, false), nil, nil))
+	}
+	return blocks
+}
+
+// uploadAttachment uploads a file to the chat, with its caption as the
+// comment. Remote files are posted as links, which Slack unfurls; the
+// timestamp of that message is returned, uploads have none.
+func (c *SlackChannel) uploadAttachment(ctx context.Context, channelID, threadTS string, att bus.Attachment, formatted bool) (string, error) {
+	caption := att.Caption
+	if !formatted {
+		caption = format.Convert(caption, c.markup)
+	}
+
+	switch {
+	case att.Path != "":
+		f, err := os.Open(att.Path)
+		if err != nil {
+			return "", fmt.Errorf("%w: attachment: %v", errs.ErrValidation, err)
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return "", fmt.Errorf("%w: attachment: %v", errs.ErrValidation, err)
+		}
+		_, err = c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+			Reader:          f,
+			FileSize:        int(info.Size()),
+			Filename:        filepath.Base(att.Path),
+			InitialComment:  caption,
+			Channel:         channelID,
+			ThreadTimestamp: threadTS,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to upload slack file: %w", err)
+		}
+		return "", nil
+	case att.URL != "":
+		opts := []slack.MsgOption{slack.MsgOptionText(appendContent(caption, att.URL), false)}
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
+		_, ts, err := c.api.PostMessageContext(ctx, channelID, opts...)
+		if err != nil {
+			return "", fmt.Errorf("failed to send slack message: %w", err)
+		}
+		return ts, nil
+	default:
+		return "", fmt.Errorf("%w: attachment has neither path nor url", errs.ErrValidation)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,6 +19,8 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
@@ -30,9 +32,13 @@ type TelegramChannel struct {
 	commands     TelegramCommander
 	config       *config.Config
 	chatIDs      map[string]int64
-	transcriber  *voice.GroqTranscriber
+	transcriber  voice.Transcriber
 	placeholders sync.Map // chatID -> messageID
 	stopThinking sync.Map // chatID -> thinkingCancel
+	polls        sync.Map // Telegram poll ID -> telegramPoll
+	markup       format.Style
+	webhook      *telegramWebhook // nil in polling mode
+	mediaDir     string           // Where incoming files are kept; empty uses temp files
 }
 
 type thinkingCancel struct {
@@ -61,6 +67,11 @@ func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus) (*TelegramChann
 		}))
 	}
 
+	webhook, err := newTelegramWebhook(telegramCfg)
+	if err != nil {
+		return nil, err
+	}
+
 	bot, err := telego.NewBot(telegramCfg.Token, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create telegram bot: %w", err)
@@ -68,6 +79,14 @@ func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus) (*TelegramChann
 
 	base := NewBaseChannel("telegram", telegramCfg, bus, telegramCfg.AllowFrom)
 
+	markup, err := format.ParseStyle(telegramCfg.Format, format.TelegramHTML)
+	if err != nil {
+		logger.WarnCF("telegram", "Invalid format, using the default", map[string]interface{}{
+			"error":  err.Error(),
+			"format": string(markup),
+		})
+	}
+
 	return &TelegramChannel{
 		BaseChannel:  base,
 		commands:     NewTelegramCommands(bot, cfg),
@@ -77,24 +96,23 @@ func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus) (*TelegramChann
 		transcriber:  nil,
 		placeholders: sync.Map{},
 		stopThinking: sync.Map{},
+		markup:       markup,
+		webhook:      webhook,
 	}, nil
 }
 
-func (c *TelegramChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+func (c *TelegramChannel) SetTranscriber(transcriber voice.Transcriber) {
 	c.transcriber = transcriber
 }
 
 func (c *TelegramChannel) Start(ctx context.Context) error {
-	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
-
-	updates, err := c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
-		Timeout: 30,
-	})
+	updates, err := c.receiveUpdates(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to start long polling: %w", err)
+		return err
 	}
 
-	bh, err := telegohandler.NewBotHandler(c.bot, updates)
+	// Stop fetching updates while the agent is overloaded
+	bh, err := telegohandler.NewBotHandler(c.bot, gateUpdates(ctx, c.BaseChannel, updates))
 	if err != nil {
 		return fmt.Errorf("failed to create bot handler: %w", err)
 	}
@@ -103,6 +121,9 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		c.commands.Help(ctx, message)
 		return nil
 	}, th.CommandEqual("help"))
+	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
+		return c.handleGuestStart(ctx, message)
+	}, th.CommandEqualArgc("start", 1))
 	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
 		return c.commands.Start(ctx, message)
 	}, th.CommandEqual("start"))
@@ -119,9 +140,18 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return c.handleMessage(ctx, &message)
 	}, th.AnyMessage())
 
+	bh.HandleCallbackQuery(func(ctx *th.Context, query telego.CallbackQuery) error {
+		return c.handleCallbackQuery(ctx, query)
+	}, th.AnyCallbackQueryWithMessage())
+
+	bh.HandlePollAnswer(func(ctx *th.Context, answer telego.PollAnswer) error {
+		return c.handlePollAnswer(answer)
+	}, th.AnyPollAnswer())
+
 	c.setRunning(true)
 	logger.InfoCF("telegram", "Telegram bot connected", map[string]interface{}{
 		"username": c.bot.Username(),
+		"mode":     c.mode(),
 	})
 
 	go bh.Start()
@@ -136,17 +166,78 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 func (c *TelegramChannel) Stop(ctx context.Context) error {
 	logger.InfoC("telegram", "Stopping Telegram bot...")
 	c.setRunning(false)
+	if c.webhook != nil {
+		c.webhook.unregister()
+	}
 	return nil
 }
 
+func (c *TelegramChannel) mode() string {
+	if c.webhook != nil {
+		return TelegramModeWebhook
+	}
+	return TelegramModePolling
+}
+
+// receiveUpdates starts long polling, or registers the webhook with Telegram
+// and receives updates through ServeHTTP
+func (c *TelegramChannel) receiveUpdates(ctx context.Context) (<-chan telego.Update, error) {
+	logger.InfoCF("telegram", "Starting Telegram bot", map[string]interface{}{
+		"mode": c.mode(),
+	})
+
+	if c.webhook == nil {
+		// Telegram refuses to poll while a webhook is set, e.g. after
+		// switching modes
+		if err := c.bot.DeleteWebhook(ctx, nil); err != nil {
+			logger.WarnCF("telegram", "Failed to delete webhook", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		updates, err := c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
+			Timeout: 30,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to start long polling: %w", err)
+		}
+		return updates, nil
+	}
+
+	// telego closes the update channel when updatesCtx ends, which must
+	// not happen while a request is handing over an update
+	updatesCtx, stopUpdates := context.WithCancel(context.WithoutCancel(ctx))
+	updates, err := c.bot.UpdatesViaWebhook(updatesCtx, c.webhook.register,
+		telego.WithWebhookSet(ctx, &telego.SetWebhookParams{
+			URL:         c.webhook.currentURL(),
+			SecretToken: c.webhook.secret,
+		}))
+	if err != nil {
+		stopUpdates()
+		return nil, fmt.Errorf("failed to set webhook: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		c.webhook.unregister()
+		stopUpdates()
+	}()
+	return updates, nil
+}
+
 func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	_, err := c.SendMessages(ctx, msg)
+	return err
+}
+
+// SendMessages sends msg and returns the IDs of the Telegram messages that
+// carry it, so they can be deleted later
+func (c *TelegramChannel) SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error) {
 	if !c.IsRunning() {
-		return fmt.Errorf("telegram bot not running")
+		return nil, fmt.Errorf("%w: telegram bot not running", errs.ErrChannelDown)
 	}
 
-	chatID, err := parseChatID(msg.ChatID)
+	chat, err := parseTelegramChat(msg.ChatID)
 	if err != nil {
-		return fmt.Errorf("invalid chat ID: %w", err)
+		return nil, fmt.Errorf("invalid chat ID: %w", err)
 	}
 
 	// Stop thinking animation
@@ -157,32 +248,284 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		c.stopThinking.Delete(msg.ChatID)
 	}
 
-	htmlContent := markdownToTelegramHTML(msg.Content)
+	var ids []string
+	if poll := msg.Poll; poll != nil {
+		if !telegramPollFits(poll) {
+			msg = emulatePoll(msg, false, c.markup)
+		} else {
+			// The poll follows the rest of the message
+			msg.Poll = nil
+			if strings.TrimSpace(msg.Content) != "" || msg.Card != nil {
+				if ids, err = c.SendMessages(ctx, msg); err != nil {
+					return ids, err
+				}
+			}
+			id, err := c.sendPoll(ctx, chat, poll)
+			return appendID(ids, id), err
+		}
+	}
+
+	content := msg.Content
+	var keyboard *telego.InlineKeyboardMarkup
+	if msg.Card != nil {
+		var cardText string
+		cardText, keyboard = telegramCard(msg.Card)
+		if msg.Formatted {
+			cardText = format.Convert(cardText, c.markup)
+		}
+		if strings.TrimSpace(content) != "" {
+			cardText = content + "\n\n" + cardText
+		}
+		content = cardText
+		ids = appendID(ids, c.sendCardImage(ctx, chat, msg.Card))
+	}
+	if len(msg.Keyboard) > 0 {
+		rows, rest := telegramKeyboard(msg.Keyboard)
+		if rows != nil {
+			if keyboard == nil {
+				keyboard = rows
+			} else {
+				keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, rows.InlineKeyboard...)
+			}
+		}
+		if len(rest) > 0 {
+			restText := cardMarkdown(&bus.Card{Buttons: rest}, false)
+			if msg.Formatted {
+				restText = format.Convert(restText, c.markup)
+			}
+			content = strings.TrimSpace(content + "\n\n" + restText)
+		}
+	}
+	if !msg.Formatted {
+		content = format.Convert(content, c.markup)
+	}
+	parseMode := ""
+	if c.markup == format.TelegramHTML {
+		parseMode = telego.ModeHTML
+	}
+
+	switch {
+	case strings.TrimSpace(content) != "" || len(msg.Attachments) == 0:
+		if keyboard != nil && strings.TrimSpace(content) == "" {
+			content = quickReplyPrompt
+		}
+		id, err := c.sendText(ctx, chat, content, parseMode, keyboard)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	default:
+		// Only files: the "Thinking..." placeholder has nothing to show
+		c.dropPlaceholder(ctx, chat)
+	}
+
+	for _, att := range msg.Attachments {
+		sent, err := c.sendAttachment(ctx, chat, att, msg.Formatted, parseMode)
+		ids = append(ids, sent...)
+		if err != nil {
+			return ids, err
+		}
+	}
+	return ids, nil
+}
 
+// sendText sends content, replacing the "Thinking..." placeholder of the
+// chat if there is one, and returns the message ID
+func (c *TelegramChannel) sendText(ctx context.Context, chat telegramChat, content, parseMode string, keyboard *telego.InlineKeyboardMarkup) (string, error) {
 	// Try to edit placeholder
-	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
-		c.placeholders.Delete(msg.ChatID)
-		editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
-		editMsg.ParseMode = telego.ModeHTML
+	if pID, ok := c.placeholders.LoadAndDelete(chat.String()); ok {
+		editMsg := tu.EditMessageText(tu.ID(chat.ID), pID.(int), content)
+		editMsg.ParseMode = parseMode
+		editMsg.ReplyMarkup = keyboard
 
-		if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
-			return nil
+		if _, err := c.bot.EditMessageText(ctx, editMsg); err == nil {
+			return strconv.Itoa(pID.(int)), nil
 		}
 		// Fallback to new message if edit fails
 	}
 
-	tgMsg := tu.Message(tu.ID(chatID), htmlContent)
-	tgMsg.ParseMode = telego.ModeHTML
+	tgMsg := tu.Message(tu.ID(chat.ID), content)
+	tgMsg.MessageThreadID = chat.Thread
+	tgMsg.ParseMode = parseMode
+	if keyboard != nil {
+		tgMsg.ReplyMarkup = keyboard
+	}
 
-	if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+	sent, err := c.bot.SendMessage(ctx, tgMsg)
+	if err != nil && parseMode != "" {
 		logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
 			"error": err.Error(),
 		})
 		tgMsg.ParseMode = ""
-		_, err = c.bot.SendMessage(ctx, tgMsg)
-		return err
+		sent, err = c.bot.SendMessage(ctx, tgMsg)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(sent.MessageID), nil
+}
+
+// dropPlaceholder deletes the "Thinking..." placeholder of the chat, if any
+func (c *TelegramChannel) dropPlaceholder(ctx context.Context, chat telegramChat) {
+	pID, ok := c.placeholders.LoadAndDelete(chat.String())
+	if !ok {
+		return
+	}
+	if err := c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(chat.ID), pID.(int))); err != nil {
+		logger.DebugCF("telegram", "Failed to delete placeholder", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// DeleteMessage deletes a message sent by the bot
+func (c *TelegramChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	chat, err := parseTelegramChat(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID: %w", err)
 	}
+	return c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(chat.ID), id))
+}
 
+// EditMessage replaces the text of a message sent by the bot
+func (c *TelegramChannel) EditMessage(ctx context.Context, chatID, messageID string, msg bus.OutboundMessage) error {
+	chat, err := parseTelegramChat(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID: %w", err)
+	}
+
+	content := msg.Content
+	if !msg.Formatted {
+		content = format.Convert(content, c.markup)
+	}
+	parseMode := ""
+	if c.markup == format.TelegramHTML {
+		parseMode = telego.ModeHTML
+	}
+
+	editMsg := tu.EditMessageText(tu.ID(chat.ID), id, content)
+	editMsg.ParseMode = parseMode
+	_, err = c.bot.EditMessageText(ctx, editMsg)
+	if err != nil && parseMode != "" {
+		editMsg.ParseMode = ""
+		_, err = c.bot.EditMessageText(ctx, editMsg)
+	}
+	return err
+}
+
+// sendCardImage sends the image of a card ahead of its text and returns its
+// message ID. Failures are logged, the text is sent regardless.
+func (c *TelegramChannel) sendCardImage(ctx context.Context, chat telegramChat, card *bus.Card) string {
+	if card.ImageURL == "" {
+		return ""
+	}
+	photo := tu.Photo(tu.ID(chat.ID), tu.FileFromURL(card.ImageURL)).WithMessageThreadID(chat.Thread)
+	sent, err := c.bot.SendPhoto(ctx, photo)
+	if err != nil {
+		logger.WarnCF("telegram", "Failed to send card image", map[string]interface{}{
+			"url":   card.ImageURL,
+			"error": err.Error(),
+		})
+		return ""
+	}
+	return strconv.Itoa(sent.MessageID)
+}
+
+// handleCallbackQuery turns presses of card reply buttons into messages from
+// the user who pressed them
+// GuestLink returns the deep link that redeems a guest pass
+func (c *TelegramChannel) GuestLink(token string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", c.bot.Username(), token)
+}
+
+// handleGuestStart redeems the guest pass of a deep link. Senders who are
+// already allowed get the usual greeting.
+func (c *TelegramChannel) handleGuestStart(ctx context.Context, message telego.Message) error {
+	if message.From == nil {
+		return nil
+	}
+	senderID := fmt.Sprintf("%d", message.From.ID)
+	if message.From.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", message.From.ID, message.From.Username)
+	}
+
+	if c.IsAllowed(senderID) {
+		// Passes are for people who could not talk to the agent otherwise
+		return c.commands.Start(ctx, message)
+	}
+
+	text := "This invitation has expired or was already used."
+	fields := strings.Fields(message.Text)
+	if expires, ok := c.RedeemGuestPass(senderID, fields[len(fields)-1]); ok {
+		logger.InfoCF("telegram", "Guest pass redeemed", map[string]interface{}{
+			"sender_id": senderID,
+			"expires":   expires.Format(time.RFC3339),
+		})
+		text = fmt.Sprintf("Hello! You've been invited to chat with me until %s. I can't use tools, and I forget our chat when the invitation ends.",
+			expires.Format("Jan 2 15:04 MST"))
+	}
+
+	_, err := c.bot.SendMessage(ctx, &telego.SendMessageParams{
+		ChatID: telego.ChatID{ID: message.Chat.ID},
+		Text:   text,
+	})
+	return err
+}
+
+func (c *TelegramChannel) handleCallbackQuery(ctx context.Context, query telego.CallbackQuery) error {
+	if err := c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID)); err != nil {
+		logger.DebugCF("telegram", "Failed to answer callback query", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	user := query.From
+	senderID := fmt.Sprintf("%d", user.ID)
+	if user.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", user.ID, user.Username)
+	}
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("telegram", "Button press rejected by allowlist", map[string]interface{}{
+			"user_id": senderID,
+		})
+		return nil
+	}
+	if query.Data == "" {
+		return nil
+	}
+
+	chat := telegramChat{ID: query.Message.GetChat().ID}
+	if m, ok := query.Message.(*telego.Message); ok {
+		chat = telegramMessageChat(m)
+	}
+	chatIDStr := chat.String()
+
+	logger.DebugCF("telegram", "Card button pressed", map[string]interface{}{
+		"sender_id": senderID,
+		"chat_id":   chatIDStr,
+		"reply":     utils.Truncate(query.Data, 50),
+	})
+
+	metadata := map[string]string{
+		"user_id":    fmt.Sprintf("%d", user.ID),
+		"username":   user.Username,
+		"first_name": user.FirstName,
+		"is_group":   fmt.Sprintf("%t", query.Message.GetChat().Type != "private"),
+	}
+	if chat.Thread != 0 {
+		metadata["thread_id"] = strconv.Itoa(chat.Thread)
+	}
+	label := telegramButtonLabel(query.Message, query.Data)
+
+	c.HandleMessage(fmt.Sprintf("%d", user.ID), chatIDStr, query.Data, nil, choiceMetadata(metadata, query.Data, label))
 	return nil
 }
 
@@ -215,6 +558,12 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	content := ""
 	mediaPaths := []string{}
 	localFiles := []string{} // 跟踪需要清理的本地文件
+	addMedia := func(path string) {
+		mediaPaths = append(mediaPaths, path)
+		if c.mediaDir == "" {
+			localFiles = append(localFiles, path)
+		}
+	}
 
 	// 确保临时文件在函数返回时被清理
 	defer func() {
@@ -243,8 +592,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		photo := message.Photo[len(message.Photo)-1]
 		photoPath := c.downloadPhoto(ctx, photo.FileID)
 		if photoPath != "" {
-			localFiles = append(localFiles, photoPath)
-			mediaPaths = append(mediaPaths, photoPath)
+			addMedia(photoPath)
 			if content != "" {
 				content += "\n"
 			}
@@ -255,8 +603,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	if message.Voice != nil {
 		voicePath := c.downloadFile(ctx, message.Voice.FileID, ".ogg")
 		if voicePath != "" {
-			localFiles = append(localFiles, voicePath)
-			mediaPaths = append(mediaPaths, voicePath)
+			addMedia(voicePath)
 
 			transcribedText := ""
 			if c.transcriber != nil && c.transcriber.IsAvailable() {
@@ -290,8 +637,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	if message.Audio != nil {
 		audioPath := c.downloadFile(ctx, message.Audio.FileID, ".mp3")
 		if audioPath != "" {
-			localFiles = append(localFiles, audioPath)
-			mediaPaths = append(mediaPaths, audioPath)
+			addMedia(audioPath)
 			if content != "" {
 				content += "\n"
 			}
@@ -302,8 +648,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	if message.Document != nil {
 		docPath := c.downloadFile(ctx, message.Document.FileID, "")
 		if docPath != "" {
-			localFiles = append(localFiles, docPath)
-			mediaPaths = append(mediaPaths, docPath)
+			addMedia(docPath)
 			if content != "" {
 				content += "\n"
 			}
@@ -322,7 +667,8 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	})
 
 	// Thinking indicator
-	err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping))
+	chat := telegramMessageChat(message)
+	err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping).WithMessageThreadID(chat.Thread))
 	if err != nil {
 		logger.ErrorCF("telegram", "Failed to send chat action", map[string]interface{}{
 			"error": err.Error(),
@@ -330,7 +676,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	}
 
 	// Stop any previous thinking animation
-	chatIDStr := fmt.Sprintf("%d", chatID)
+	chatIDStr := chat.String()
 	if prevStop, ok := c.stopThinking.Load(chatIDStr); ok {
 		if cf, ok := prevStop.(*thinkingCancel); ok && cf != nil {
 			cf.Cancel()
@@ -341,7 +687,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	_, thinkCancel := context.WithTimeout(ctx, 5*time.Minute)
 	c.stopThinking.Store(chatIDStr, &thinkingCancel{fn: thinkCancel})
 
-	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), "Thinking... 💭"))
+	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), "Thinking... 💭").WithMessageThreadID(chat.Thread))
 	if err == nil {
 		pID := pMsg.MessageID
 		c.placeholders.Store(chatIDStr, pID)
@@ -354,8 +700,11 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		"first_name": user.FirstName,
 		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
 	}
+	if chat.Thread != 0 {
+		metadata["thread_id"] = strconv.Itoa(chat.Thread)
+	}
 
-	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chatID), content, mediaPaths, metadata)
+	c.HandleMessage(fmt.Sprintf("%d", user.ID), chatIDStr, content, mediaPaths, metadata)
 	return nil
 }
 
@@ -383,6 +732,7 @@ func (c *TelegramChannel) downloadFileWithInfo(file *telego.File, ext string) st
 	filename := file.FilePath + ext
 	return utils.DownloadFile(url, filename, utils.DownloadOptions{
 		LoggerPrefix: "telegram",
+		Dir:          c.mediaDir,
 	})
 }
 
@@ -398,112 +748,12 @@ func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext string)
 	return c.downloadFileWithInfo(file, ext)
 }
 
-func parseChatID(chatIDStr string) (int64, error) {
-	var id int64
-	_, err := fmt.Sscanf(chatIDStr, "%d", &id)
-	return id, err
-}
-
-func markdownToTelegramHTML(text string) string {
-	if text == "" {
-		return ""
-	}
-
-	codeBlocks := extractCodeBlocks(text)
-	text = codeBlocks.text
-
-	inlineCodes := extractInlineCodes(text)
-	text = inlineCodes.text
-
-	text = regexp.MustCompile(`^#{1,6}\s+(.+)$`).ReplaceAllString(text, "$1")
-
-	text = regexp.MustCompile(`^>\s*(.*)$`).ReplaceAllString(text, "$1")
-
-	text = escapeHTML(text)
-
-	text = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`).ReplaceAllString(text, `<a href="$2">$1</a>`)
-
-	text = regexp.MustCompile(`\*\*(.+?)\*\*`).ReplaceAllString(text, "<b>$1</b>")
-
-	text = regexp.MustCompile(`__(.+?)__`).ReplaceAllString(text, "<b>$1</b>")
-
-	reItalic := regexp.MustCompile(`_([^_]+)_`)
-	text = reItalic.ReplaceAllStringFunc(text, func(s string) string {
-		match := reItalic.FindStringSubmatch(s)
-		if len(match) < 2 {
-			return s
-		}
-		return "<i>" + match[1] + "</i>"
-	})
-
-	text = regexp.MustCompile(`~~(.+?)~~`).ReplaceAllString(text, "<s>$1</s>")
-
-	text = regexp.MustCompile(`^[-*]\s+`).ReplaceAllString(text, "• ")
-
-	for i, code := range inlineCodes.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(text, fmt.Sprintf("\x00IC%d\x00", i), fmt.Sprintf("<code>%s</code>", escaped))
-	}
-
-	for i, code := range codeBlocks.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(text, fmt.Sprintf("\x00CB%d\x00", i), fmt.Sprintf("<pre><code>%s</code></pre>", escaped))
-	}
-
-	return text
-}
-
-type codeBlockMatch struct {
-	text  string
-	codes []string
-}
-
-func extractCodeBlocks(text string) codeBlockMatch {
-	re := regexp.MustCompile("```[\\w]*\\n?([\\s\\S]*?)```")
-	matches := re.FindAllStringSubmatch(text, -1)
-
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
-	}
-
-	i := 0
-	text = re.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00CB%d\x00", i)
-		i++
-		return placeholder
-	})
-
-	return codeBlockMatch{text: text, codes: codes}
-}
-
-type inlineCodeMatch struct {
-	text  string
-	codes []string
-}
-
-func extractInlineCodes(text string) inlineCodeMatch {
-	re := regexp.MustCompile("`([^`]+)`")
-	matches := re.FindAllStringSubmatch(text, -1)
-
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
-	}
-
-	i := 0
-	text = re.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00IC%d\x00", i)
-		i++
-		return placeholder
-	})
-
-	return inlineCodeMatch{text: text, codes: codes}
+// Markup returns the markup the channel sends
+func (c *TelegramChannel) Markup() format.Style {
+	return c.markup
 }
 
-func escapeHTML(text string) string {
-	text = strings.ReplaceAll(text, "&", "&amp;")
-	text = strings.ReplaceAll(text, "<", "&lt;")
-	text = strings.ReplaceAll(text, ">", "&gt;")
-	return text
+// RendersCards reports that the channel sends cards with inline keyboards
+func (c *TelegramChannel) RendersCards() bool {
+	return true
 }
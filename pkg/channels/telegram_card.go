@@ -0,0 +1,76 @@
+package channels
+
+import (
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// telegramMaxCallbackData is the size limit of inline button callback data
+const telegramMaxCallbackData = 64
+
+// telegramCard splits a card into Markdown text and an inline keyboard with
+// one button per row. Reply buttons whose reply does not fit in callback
+// data are listed in the text instead.
+func telegramCard(card *bus.Card) (string, *telego.InlineKeyboardMarkup) {
+	textCard := *card
+	textCard.Buttons = nil
+
+	rows := make([][]bus.CardButton, len(card.Buttons))
+	for i, b := range card.Buttons {
+		rows[i] = []bus.CardButton{b}
+	}
+	keyboard, rest := telegramKeyboard(rows)
+	textCard.Buttons = rest
+	return cardMarkdown(&textCard, false), keyboard
+}
+
+// telegramKeyboard converts rows of buttons to an inline keyboard. Reply
+// buttons whose reply does not fit in callback data are returned instead;
+// the keyboard is nil when no button fits.
+func telegramKeyboard(rows [][]bus.CardButton) (*telego.InlineKeyboardMarkup, []bus.CardButton) {
+	var keyboard [][]telego.InlineKeyboardButton
+	var rest []bus.CardButton
+	for _, row := range rows {
+		var buttons []telego.InlineKeyboardButton
+		for _, b := range row {
+			button := tu.InlineKeyboardButton(b.Label)
+			switch reply := cardButtonReply(b); {
+			case b.URL != "":
+				button = button.WithURL(b.URL)
+			case len(reply) <= telegramMaxCallbackData:
+				button = button.WithCallbackData(reply)
+			default:
+				rest = append(rest, b)
+				continue
+			}
+			buttons = append(buttons, button)
+		}
+		if len(buttons) > 0 {
+			keyboard = append(keyboard, tu.InlineKeyboardRow(buttons...))
+		}
+	}
+
+	if len(keyboard) == 0 {
+		return nil, rest
+	}
+	return tu.InlineKeyboard(keyboard...), rest
+}
+
+// telegramButtonLabel finds the label of the inline button with callback
+// data on msg, or "" if it is not there
+func telegramButtonLabel(msg telego.MaybeInaccessibleMessage, data string) string {
+	m, ok := msg.(*telego.Message)
+	if !ok || m.ReplyMarkup == nil {
+		return ""
+	}
+	for _, row := range m.ReplyMarkup.InlineKeyboard {
+		for _, button := range row {
+			if button.CallbackData == data {
+				return button.Text
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// telegramMaxCaption is the caption limit of media messages. Longer
+// captions follow their file as a text message.
+const telegramMaxCaption = 1024
+
+// Kinds of Telegram media messages
+const (
+	telegramPhoto    = "photo"
+	telegramVideo    = "video"
+	telegramVoice    = "voice"
+	telegramAudio    = "audio"
+	telegramDocument = "document"
+)
+
+// SetMediaDir makes the channel keep incoming files in dir, where the agent
+// can read them later. Without it files are downloaded to a temporary
+// directory and deleted once the message is handed over.
+func (c *TelegramChannel) SetMediaDir(dir string) {
+	c.mediaDir = dir
+}
+
+// SendsKeyboards reports that the channel shows keyboards as inline keyboards
+func (c *TelegramChannel) SendsKeyboards() bool {
+	return true
+}
+
+// telegramMediaKind picks how an attachment is sent from its MIME type,
+// or its file extension when the type is not set
+func telegramMediaKind(att bus.Attachment) string {
+	mimeType := strings.ToLower(att.MimeType)
+	if mimeType == "" {
+		name := att.Path
+		if name == "" {
+			if u, err := url.Parse(att.URL); err == nil {
+				name = u.Path
+			}
+		}
+		mimeType = mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+		if strings.HasSuffix(strings.ToLower(name), ".opus") {
+			mimeType = "audio/ogg"
+		}
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+
+	switch {
+	case mimeType == "image/gif":
+		// Photos lose the animation
+		return telegramDocument
+	case strings.HasPrefix(mimeType, "image/"):
+		return telegramPhoto
+	case strings.HasPrefix(mimeType, "video/"):
+		return telegramVideo
+	case mimeType == "audio/ogg" || mimeType == "audio/opus":
+		return telegramVoice
+	case strings.HasPrefix(mimeType, "audio/"):
+		return telegramAudio
+	default:
+		return telegramDocument
+	}
+}
+
+// sendAttachment sends a file with its caption and returns the IDs of the
+// messages that carry it
+func (c *TelegramChannel) sendAttachment(ctx context.Context, chat telegramChat, att bus.Attachment, formatted bool, parseMode string) ([]string, error) {
+	var file telego.InputFile
+	var local *os.File
+	switch {
+	case att.Path != "":
+		f, err := os.Open(att.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: attachment: %v", errs.ErrValidation, err)
+		}
+		defer f.Close()
+		local = f
+		file = tu.File(f)
+	case att.URL != "":
+		file = tu.FileFromURL(att.URL)
+	default:
+		return nil, fmt.Errorf("%w: attachment has neither path nor url", errs.ErrValidation)
+	}
+
+	caption := att.Caption
+	if !formatted {
+		caption = format.Convert(caption, c.markup)
+	}
+	var longCaption string
+	if utf8.RuneCountInString(caption) > telegramMaxCaption {
+		longCaption, caption = caption, ""
+	}
+
+	kind := telegramMediaKind(att)
+	send := func(parseMode string) (*telego.Message, error) {
+		id := tu.ID(chat.ID)
+		switch kind {
+		case telegramPhoto:
+			return c.bot.SendPhoto(ctx, tu.Photo(id, file).WithMessageThreadID(chat.Thread).WithCaption(caption).WithParseMode(parseMode))
+		case telegramVideo:
+			return c.bot.SendVideo(ctx, tu.Video(id, file).WithMessageThreadID(chat.Thread).WithCaption(caption).WithParseMode(parseMode))
+		case telegramVoice:
+			return c.bot.SendVoice(ctx, tu.Voice(id, file).WithMessageThreadID(chat.Thread).WithCaption(caption).WithParseMode(parseMode))
+		case telegramAudio:
+			return c.bot.SendAudio(ctx, tu.Audio(id, file).WithMessageThreadID(chat.Thread).WithCaption(caption).WithParseMode(parseMode))
+		default:
+			return c.bot.SendDocument(ctx, tu.Document(id, file).WithMessageThreadID(chat.Thread).WithCaption(caption).WithParseMode(parseMode))
+		}
+	}
+
+	sent, err := send(parseMode)
+	if err != nil && parseMode != "" && caption != "" {
+		logger.ErrorCF("telegram", "HTML caption parse failed, falling back to plain text", map[string]interface{}{
+			"error": err.Error(),
+		})
+		if local != nil {
+			// The upload consumed the file
+			if _, err := local.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		sent, err = send("")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{strconv.Itoa(sent.MessageID)}
+	if longCaption != "" {
+		id, err := c.sendText(ctx, chat, longCaption, parseMode, nil)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,56 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestTelegramMediaKind(t *testing.T) {
+	tests := []struct {
+		att  bus.Attachment
+		want string
+	}{
+		{bus.Attachment{Path: "/tmp/chart.png"}, telegramPhoto},
+		{bus.Attachment{URL: "https://example.com/clip.mp4?sig=1"}, telegramVideo},
+		{bus.Attachment{Path: "note.ogg"}, telegramVoice},
+		{bus.Attachment{Path: "note.opus"}, telegramVoice},
+		{bus.Attachment{Path: "song.mp3"}, telegramAudio},
+		{bus.Attachment{Path: "report.pdf"}, telegramDocument},
+		{bus.Attachment{Path: "party.gif"}, telegramDocument},
+		{bus.Attachment{URL: "https://example.com/download", MimeType: "image/jpeg; q=1"}, telegramPhoto},
+		{bus.Attachment{Path: "data"}, telegramDocument},
+	}
+	for _, tt := range tests {
+		if got := telegramMediaKind(tt.att); got != tt.want {
+			t.Errorf("telegramMediaKind(%+v) = %s, want %s", tt.att, got, tt.want)
+		}
+	}
+}
+
+func TestTelegramKeyboard(t *testing.T) {
+	long := strings.Repeat("x", telegramMaxCallbackData+1)
+	keyboard, rest := telegramKeyboard([][]bus.CardButton{
+		{{Label: "Yes", Reply: "yes"}, {Label: "No"}},
+		{{Label: "Docs", URL: "https://example.com"}, {Label: "Long", Reply: long}},
+		{{Label: "Too long", Reply: long}},
+	})
+
+	if keyboard == nil || len(keyboard.InlineKeyboard) != 2 {
+		t.Fatalf("expected 2 rows, got %+v", keyboard)
+	}
+	if row := keyboard.InlineKeyboard[0]; len(row) != 2 || row[0].CallbackData != "yes" || row[1].CallbackData != "No" {
+		t.Errorf("first row = %+v", row)
+	}
+	if row := keyboard.InlineKeyboard[1]; len(row) != 1 || row[0].URL != "https://example.com" {
+		t.Errorf("second row = %+v", row)
+	}
+	if len(rest) != 2 {
+		t.Errorf("expected the 2 long reply buttons back, got %+v", rest)
+	}
+
+	if keyboard, _ := telegramKeyboard(nil); keyboard != nil {
+		t.Error("expected no keyboard without buttons")
+	}
+}
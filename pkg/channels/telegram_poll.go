@@ -0,0 +1,115 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Telegram poll limits
+const (
+	telegramMinPollOptions     = 2
+	telegramMaxPollOptions     = 12
+	telegramMaxPollQuestion    = 300
+	telegramMaxPollOptionRunes = 100
+)
+
+// telegramPoll is a native poll sent by the channel, keyed by Telegram's
+// poll ID, which is all a poll answer carries
+type telegramPoll struct {
+	poll   bus.Poll
+	chatID string
+}
+
+// telegramPollFits reports whether poll can be sent as a native poll
+func telegramPollFits(poll *bus.Poll) bool {
+	if len(poll.Options) < telegramMinPollOptions || len(poll.Options) > telegramMaxPollOptions {
+		return false
+	}
+	if poll.Question == "" || utf8.RuneCountInString(poll.Question) > telegramMaxPollQuestion {
+		return false
+	}
+	for _, option := range poll.Options {
+		if option == "" || utf8.RuneCountInString(option) > telegramMaxPollOptionRunes {
+			return false
+		}
+	}
+	return true
+}
+
+// sendPoll sends a non-anonymous native poll so that votes are reported,
+// and returns its message ID
+func (c *TelegramChannel) sendPoll(ctx context.Context, chat telegramChat, poll *bus.Poll) (string, error) {
+	options := make([]telego.InputPollOption, len(poll.Options))
+	for i, option := range poll.Options {
+		options[i] = tu.PollOption(option)
+	}
+	params := tu.Poll(tu.ID(chat.ID), poll.Question, options...)
+	params.MessageThreadID = chat.Thread
+	params.IsAnonymous = telego.ToPtr(false)
+	params.AllowsMultipleAnswers = poll.MultipleAnswers
+
+	sent, err := c.bot.SendPoll(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("sending poll: %w", err)
+	}
+	if sent.Poll != nil {
+		c.polls.Store(sent.Poll.ID, telegramPoll{poll: *poll, chatID: chat.String()})
+	}
+	return strconv.Itoa(sent.MessageID), nil
+}
+
+// handlePollAnswer turns a vote on one of the channel's polls into a
+// message from the voter
+func (c *TelegramChannel) handlePollAnswer(answer telego.PollAnswer) error {
+	value, ok := c.polls.Load(answer.PollID)
+	if !ok || answer.User == nil {
+		return nil
+	}
+	sent := value.(telegramPoll)
+
+	user := answer.User
+	senderID := fmt.Sprintf("%d", user.ID)
+	if user.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", user.ID, user.Username)
+	}
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("telegram", "Poll vote rejected by allowlist", map[string]interface{}{
+			"user_id": senderID,
+		})
+		return nil
+	}
+
+	var chosen []string
+	for _, id := range answer.OptionIDs {
+		if id >= 0 && id < len(sent.poll.Options) {
+			chosen = append(chosen, sent.poll.Options[id])
+		}
+	}
+	content := "Retracted vote"
+	if len(chosen) > 0 {
+		content = "Voted " + strings.Join(chosen, ", ")
+	}
+
+	metadata := map[string]string{
+		"user_id":    fmt.Sprintf("%d", user.ID),
+		"username":   user.Username,
+		"first_name": user.FirstName,
+	}
+	c.HandleMessage(fmt.Sprintf("%d", user.ID), sent.chatID, content, nil,
+		pollVoteMetadata(metadata, sent.poll.ID, answer.OptionIDs))
+	return nil
+}
+
+// SendsPolls reports that the channel sends native polls
+func (c *TelegramChannel) SendsPolls() bool {
+	return true
+}
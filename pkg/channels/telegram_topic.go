@@ -0,0 +1,52 @@
+package channels
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mymmrac/telego"
+)
+
+// telegramChat is where a message goes: a chat and, in forum supergroups,
+// a topic. Topic messages use the chat ID "<chat>/<topic>", like Slack
+// threads, so every topic keeps its own session.
+type telegramChat struct {
+	ID     int64
+	Thread int // Forum topic; 0 outside topics
+}
+
+// String returns the chat ID used on the bus
+func (c telegramChat) String() string {
+	if c.Thread == 0 {
+		return strconv.FormatInt(c.ID, 10)
+	}
+	return fmt.Sprintf("%d/%d", c.ID, c.Thread)
+}
+
+// parseTelegramChat parses a chat ID made by telegramChat.String
+func parseTelegramChat(chatID string) (telegramChat, error) {
+	base, thread, hasThread := strings.Cut(chatID, "/")
+	id, err := strconv.ParseInt(base, 10, 64)
+	if err != nil {
+		return telegramChat{}, err
+	}
+	chat := telegramChat{ID: id}
+	if hasThread {
+		if chat.Thread, err = strconv.Atoi(thread); err != nil {
+			return telegramChat{}, err
+		}
+	}
+	return chat, nil
+}
+
+// telegramMessageChat returns the chat of msg, with its topic when it was
+// sent to one. Replies in ordinary groups also carry a thread ID, which
+// is not a topic and is ignored.
+func telegramMessageChat(msg *telego.Message) telegramChat {
+	chat := telegramChat{ID: msg.Chat.ID}
+	if msg.IsTopicMessage {
+		chat.Thread = msg.MessageThreadID
+	}
+	return chat
+}
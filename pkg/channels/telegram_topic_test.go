@@ -0,0 +1,45 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/mymmrac/telego"
+)
+
+func TestTelegramChatRoundTrip(t *testing.T) {
+	tests := []struct {
+		chatID string
+		want   telegramChat
+	}{
+		{"123", telegramChat{ID: 123}},
+		{"-1001234/42", telegramChat{ID: -1001234, Thread: 42}},
+	}
+	for _, tt := range tests {
+		got, err := parseTelegramChat(tt.chatID)
+		if err != nil || got != tt.want {
+			t.Errorf("parseTelegramChat(%q) = %+v, %v; want %+v", tt.chatID, got, err, tt.want)
+		}
+		if s := got.String(); s != tt.chatID {
+			t.Errorf("String() = %q, want %q", s, tt.chatID)
+		}
+	}
+
+	for _, bad := range []string{"", "abc", "123/", "123/x"} {
+		if _, err := parseTelegramChat(bad); err == nil {
+			t.Errorf("parseTelegramChat(%q) should fail", bad)
+		}
+	}
+}
+
+func TestTelegramMessageChat(t *testing.T) {
+	topic := &telego.Message{Chat: telego.Chat{ID: -100}, MessageThreadID: 7, IsTopicMessage: true}
+	if got := telegramMessageChat(topic).String(); got != "-100/7" {
+		t.Errorf("topic message chat = %q, want -100/7", got)
+	}
+
+	// Replies in groups without topics have a thread ID too
+	reply := &telego.Message{Chat: telego.Chat{ID: -100}, MessageThreadID: 7}
+	if got := telegramMessageChat(reply).String(); got != "-100" {
+		t.Errorf("reply chat = %q, want -100", got)
+	}
+}
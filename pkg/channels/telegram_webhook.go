@@ -0,0 +1,221 @@
+package channels
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Telegram receive modes
+const (
+	TelegramModePolling = "polling"
+	TelegramModeWebhook = "webhook"
+)
+
+// DefaultTelegramWebhookPath is served when the webhook URL has no path
+const DefaultTelegramWebhookPath = "/telegram/webhook"
+
+// maxTelegramUpdateSize bounds the body of webhook requests
+const maxTelegramUpdateSize = 1 << 20
+
+// telegramSecretPattern is the character set Telegram accepts for secret tokens
+var telegramSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// WebhookReceiver is implemented by channels that receive messages through
+// the gateway HTTP server. WebhookPath is empty when the channel polls.
+type WebhookReceiver interface {
+	http.Handler
+	WebhookPath() string
+}
+
+// telegramWebhook receives the updates Telegram posts to the gateway
+type telegramWebhook struct {
+	url    string
+	path   string
+	secret string
+
+	// mu guards url and is held while an update is handed over, so
+	// unregister can wait for requests in flight before telego closes its
+	// update channel
+	mu      sync.RWMutex
+	handler telego.WebhookHandler
+	ctx     context.Context // Canceled by unregister
+	cancel  context.CancelFunc
+}
+
+// newTelegramWebhook returns nil in polling mode
+func newTelegramWebhook(cfg config.TelegramConfig) (*telegramWebhook, error) {
+	switch cfg.Mode {
+	case "", TelegramModePolling:
+		return nil, nil
+	case TelegramModeWebhook:
+	default:
+		return nil, fmt.Errorf("unknown telegram mode %q", cfg.Mode)
+	}
+
+	u, err := url.Parse(cfg.WebhookURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("telegram webhook mode needs an https webhook_url, got %q", cfg.WebhookURL)
+	}
+	path := u.Path
+	if path == "" || path == "/" {
+		path = DefaultTelegramWebhookPath
+		u.Path = path
+	}
+
+	secret := cfg.WebhookSecret
+	if secret == "" {
+		// Stable across restarts and replicas, unlike a random token
+		sum := sha256.Sum256([]byte("picoclaw-telegram-webhook:" + cfg.Token))
+		secret = hex.EncodeToString(sum[:16])
+	}
+	if !telegramSecretPattern.MatchString(secret) {
+		return nil, fmt.Errorf("telegram webhook_secret may only contain A-Z, a-z, 0-9, _ and -")
+	}
+
+	return &telegramWebhook{url: u.String(), path: path, secret: secret}, nil
+}
+
+// currentURL returns the URL registered with Telegram
+func (w *telegramWebhook) currentURL() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.url
+}
+
+// register is passed to telego, which hands over the function that decodes
+// updates once the webhook is set
+func (w *telegramWebhook) register(handler telego.WebhookHandler) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handler = handler
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	return nil
+}
+
+// unregister stops handing over updates; requests get 503 until the next
+// register
+func (w *telegramWebhook) unregister() {
+	w.mu.RLock()
+	cancel := w.cancel
+	w.mu.RUnlock()
+	if cancel != nil {
+		cancel()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handler = nil
+}
+
+func (w *telegramWebhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.Header.Get(telego.WebhookSecretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(w.secret)) != 1 {
+		logger.WarnCF("telegram", "Rejected webhook request with a bad secret token", map[string]interface{}{
+			"remote_addr": r.RemoteAddr,
+		})
+		http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxTelegramUpdateSize))
+	if err != nil {
+		http.Error(rw, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.handler == nil {
+		http.Error(rw, "Telegram channel not running", http.StatusServiceUnavailable)
+		return
+	}
+	// Updates are handled after the request returns, so they get the
+	// channel's context rather than the request's
+	if err := w.handler(w.ctx, body); err != nil {
+		logger.WarnCF("telegram", "Failed to handle webhook update", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(rw, "Bad request", http.StatusBadRequest)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+// WebhookPath returns the gateway path Telegram posts updates to, or ""
+// in polling mode
+func (c *TelegramChannel) WebhookPath() string {
+	if c.webhook == nil {
+		return ""
+	}
+	return c.webhook.path
+}
+
+// WantedWebhook returns the webhook URL under baseURL, or the configured
+// one while the public URL is unknown; "" in polling mode
+func (c *TelegramChannel) WantedWebhook(baseURL string) string {
+	if c.webhook == nil {
+		return ""
+	}
+	if baseURL == "" {
+		return c.webhook.currentURL()
+	}
+	return baseURL + c.webhook.path
+}
+
+// RegisteredWebhook returns the URL Telegram posts updates to
+func (c *TelegramChannel) RegisteredWebhook(ctx context.Context) (string, error) {
+	info, err := c.bot.GetWebhookInfo(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get webhook info: %w", err)
+	}
+	return info.URL, nil
+}
+
+// RegisterWebhook points the webhook at webhookURL, e.g. under a new
+// tunnel URL, with the channel's secret token
+func (c *TelegramChannel) RegisterWebhook(ctx context.Context, webhookURL string) error {
+	if c.webhook == nil {
+		return fmt.Errorf("telegram channel is polling")
+	}
+	if u, err := url.Parse(webhookURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("telegram webhooks need an https URL, got %q", webhookURL)
+	}
+	err := c.bot.SetWebhook(ctx, &telego.SetWebhookParams{
+		URL:         webhookURL,
+		SecretToken: c.webhook.secret,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	c.webhook.mu.Lock()
+	c.webhook.url = webhookURL
+	c.webhook.mu.Unlock()
+	return nil
+}
+
+// ServeHTTP receives webhook updates
+func (c *TelegramChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.webhook == nil {
+		http.NotFound(w, r)
+		return
+	}
+	c.webhook.ServeHTTP(w, r)
+}
@@ -0,0 +1,115 @@
+package channels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestNewTelegramWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.TelegramConfig
+		path    string
+		wantErr bool
+	}{
+		{"polling by default", config.TelegramConfig{}, "", false},
+		{"explicit polling", config.TelegramConfig{Mode: "polling", WebhookURL: "https://bot.example.com/tg"}, "", false},
+		{"webhook path from URL", config.TelegramConfig{Mode: "webhook", WebhookURL: "https://bot.example.com/tg/hook"}, "/tg/hook", false},
+		{"default path", config.TelegramConfig{Mode: "webhook", WebhookURL: "https://bot.example.com"}, DefaultTelegramWebhookPath, false},
+		{"https required", config.TelegramConfig{Mode: "webhook", WebhookURL: "http://bot.example.com/tg"}, "", true},
+		{"URL required", config.TelegramConfig{Mode: "webhook"}, "", true},
+		{"bad secret", config.TelegramConfig{Mode: "webhook", WebhookURL: "https://bot.example.com", WebhookSecret: "not secret!"}, "", true},
+		{"unknown mode", config.TelegramConfig{Mode: "push"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh, err := newTelegramWebhook(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			path := ""
+			if wh != nil {
+				path = wh.path
+			}
+			if path != tt.path {
+				t.Errorf("path = %q, want %q", path, tt.path)
+			}
+		})
+	}
+}
+
+func TestTelegramWebhookSecretIsStable(t *testing.T) {
+	cfg := config.TelegramConfig{Mode: "webhook", WebhookURL: "https://bot.example.com", Token: "123:abc"}
+	a, _ := newTelegramWebhook(cfg)
+	b, _ := newTelegramWebhook(cfg)
+	if a.secret == "" || a.secret != b.secret {
+		t.Errorf("derived secrets %q and %q should match", a.secret, b.secret)
+	}
+	cfg.Token = "456:def"
+	if c, _ := newTelegramWebhook(cfg); c.secret == a.secret {
+		t.Error("bots with different tokens should get different secrets")
+	}
+}
+
+func TestTelegramWebhookServeHTTP(t *testing.T) {
+	wh, err := newTelegramWebhook(config.TelegramConfig{
+		Mode: "webhook", WebhookURL: "https://bot.example.com/tg", WebhookSecret: "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("newTelegramWebhook: %v", err)
+	}
+
+	post := func(secret, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/tg", strings.NewReader(body))
+		if secret != "" {
+			req.Header.Set(telego.WebhookSecretTokenHeader, secret)
+		}
+		rec := httptest.NewRecorder()
+		wh.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post("s3cret", `{"update_id":1}`); code != http.StatusServiceUnavailable {
+		t.Errorf("before registering: status %d, want 503", code)
+	}
+
+	var received []string
+	wh.register(func(ctx context.Context, data []byte) error {
+		received = append(received, string(data))
+		return nil
+	})
+
+	if code := post("wrong", `{"update_id":2}`); code != http.StatusUnauthorized {
+		t.Errorf("bad secret: status %d, want 401", code)
+	}
+	if code := post("", `{"update_id":3}`); code != http.StatusUnauthorized {
+		t.Errorf("missing secret: status %d, want 401", code)
+	}
+	if code := post("s3cret", `{"update_id":4}`); code != http.StatusOK {
+		t.Errorf("valid update: status %d, want 200", code)
+	}
+	if len(received) != 1 || received[0] != `{"update_id":4}` {
+		t.Errorf("received %v, want only update 4", received)
+	}
+
+	rec := httptest.NewRecorder()
+	wh.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tg", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", rec.Code)
+	}
+
+	wh.unregister()
+	if code := post("s3cret", `{"update_id":5}`); code != http.StatusServiceUnavailable {
+		t.Errorf("after unregistering: status %d, want 503", code)
+	}
+}
@@ -0,0 +1,297 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// The terminal has a single user talking in a single chat
+const (
+	TerminalSenderID = "local"
+	TerminalChatID   = "local"
+)
+
+// ANSI escape sequences used when coloring is on
+const (
+	ansiReset   = "\033[0m"
+	ansiBold    = "\033[1m"
+	ansiDim     = "\033[2m"
+	ansiRed     = "\033[31m"
+	ansiGreen   = "\033[32m"
+	ansiYellow  = "\033[33m"
+	ansiCyan    = "\033[36m"
+	ansiClearLn = "\r\033[K"
+)
+
+// TerminalChannel talks to the agent from the console: lines typed on
+// stdin reach the agent and replies are printed to stdout. Progress updates
+// stream in below the message that started the task, so prompts and tools
+// can be tried without setting up a messaging platform.
+type TerminalChannel struct {
+	*BaseChannel
+	config config.TerminalConfig
+	in     io.Reader
+	out    io.Writer
+	markup format.Style
+	color  bool
+	prompt bool // Show an input prompt; only when reading from a terminal
+
+	mu          sync.Mutex // Serializes output
+	nextID      int
+	lastID      string // Message shown last, which edits extend
+	lastText    string
+	promptShown bool
+}
+
+// NewTerminalChannel creates a terminal channel on stdin and stdout
+func NewTerminalChannel(cfg config.TerminalConfig, messageBus *bus.MessageBus) (*TerminalChannel, error) {
+	color, err := terminalColor(cfg.Color, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	markup, err := format.ParseStyle(cfg.Format, format.Markdown)
+	if err != nil {
+		logger.WarnCF("terminal", "Invalid format, using the default", map[string]interface{}{
+			"error":  err.Error(),
+			"format": string(markup),
+		})
+	}
+	return &TerminalChannel{
+		// Whoever has the console may talk to the agent
+		BaseChannel: NewBaseChannel("terminal", cfg, messageBus, nil),
+		config:      cfg,
+		in:          os.Stdin,
+		out:         os.Stdout,
+		markup:      markup,
+		color:       color,
+		prompt:      isCharDevice(os.Stdin),
+	}, nil
+}
+
+// terminalColor decides whether to color output written to out: "always",
+// "never", or "auto" (default) for terminals unless NO_COLOR is set
+func terminalColor(mode string, out *os.File) (bool, error) {
+	switch mode {
+	case "", "auto":
+		return os.Getenv("NO_COLOR") == "" && isCharDevice(out), nil
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid terminal color %q (want auto, always or never)", mode)
+	}
+}
+
+// isCharDevice reports whether f is a terminal rather than a file or pipe
+func isCharDevice(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Start reads lines from the console until it is closed or ctx ends
+func (c *TerminalChannel) Start(ctx context.Context) error {
+	logger.InfoC("terminal", "Starting terminal channel")
+	c.setRunning(true)
+	go c.readLoop(ctx)
+	c.showPrompt()
+	return nil
+}
+
+// Stop stops handing typed lines to the agent. A pending read of stdin
+// ends with the process.
+func (c *TerminalChannel) Stop(ctx context.Context) error {
+	logger.InfoC("terminal", "Stopping terminal channel")
+	c.setRunning(false)
+	return nil
+}
+
+// Markup returns the markup the channel prints
+func (c *TerminalChannel) Markup() format.Style {
+	return c.markup
+}
+
+// readLoop hands each non-empty line to the agent
+func (c *TerminalChannel) readLoop(ctx context.Context) {
+	scanner := bufio.NewScanner(c.in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if ctx.Err() != nil || !c.IsRunning() {
+			return
+		}
+		c.mu.Lock()
+		c.promptShown = false // Enter moved the cursor past it
+		c.mu.Unlock()
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			c.showPrompt()
+			continue
+		}
+		c.HandleMessage(TerminalSenderID, TerminalChatID, line, nil, nil)
+	}
+	if err := scanner.Err(); err != nil {
+		logger.WarnCF("terminal", "Failed to read the console", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	logger.InfoC("terminal", "Console input closed, no longer reading messages")
+}
+
+// Send prints msg
+func (c *TerminalChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	_, err := c.SendMessages(ctx, msg)
+	return err
+}
+
+// SendMessages prints msg and returns the ID it can be edited by
+func (c *TerminalChannel) SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error) {
+	if !c.IsRunning() {
+		return nil, fmt.Errorf("%w: terminal channel not running", errs.ErrChannelDown)
+	}
+	if !msg.Formatted {
+		msg.Content = format.Convert(msg.Content, c.markup)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if msg.Reaction != "" {
+		c.printLocked(ansiDim, "(reacted "+msg.Reaction+")", false)
+		return nil, nil
+	}
+
+	c.nextID++
+	id := strconv.Itoa(c.nextID)
+	c.lastID, c.lastText = id, msg.Content
+	if strings.TrimSpace(msg.Content) != "" || len(msg.Attachments) == 0 {
+		c.printMessageLocked(msg, msg.Content)
+	}
+	for _, att := range msg.Attachments {
+		location := att.Path
+		if location == "" {
+			location = att.URL
+		}
+		c.printLocked(ansiCyan, strings.TrimSpace("[attachment: "+location+"] "+att.Caption), false)
+	}
+	if !msg.Progress {
+		c.showPromptLocked()
+	}
+	return []string{id}, nil
+}
+
+// EditMessage shows the new text of a printed message. Output cannot be
+// changed once printed, so progress updates to the last message shown only
+// print the lines added since, which streams them as they come; anything
+// else, like the reply replacing them, is printed in full.
+func (c *TerminalChannel) EditMessage(ctx context.Context, chatID, messageID string, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("%w: terminal channel not running", errs.ErrChannelDown)
+	}
+	if !msg.Formatted {
+		msg.Content = format.Convert(msg.Content, c.markup)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	text := msg.Content
+	if msg.Progress && messageID == c.lastID {
+		if added, ok := addedLines(c.lastText, msg.Content); ok {
+			text = added
+		}
+	}
+	c.lastID, c.lastText = messageID, msg.Content
+	if text != "" {
+		c.printMessageLocked(msg, text)
+	}
+	if !msg.Progress {
+		c.showPromptLocked()
+	}
+	return nil
+}
+
+// addedLines returns the lines of next that follow the end of prev, for
+// text that grew at its end and possibly lost lines at its start, as
+// progress messages do
+func addedLines(prev, next string) (string, bool) {
+	prevLines, nextLines := strings.Split(prev, "\n"), strings.Split(next, "\n")
+	for k := min(len(prevLines), len(nextLines)); k > 0; k-- {
+		if slices.Equal(prevLines[len(prevLines)-k:], nextLines[:k]) {
+			return strings.Join(nextLines[k:], "\n"), true
+		}
+	}
+	return "", false
+}
+
+// printMessageLocked prints text of msg styled by its kind: progress
+// updates dimmed, notifications in yellow, errors in red and replies after
+// the agent's name
+func (c *TerminalChannel) printMessageLocked(msg bus.OutboundMessage, text string) {
+	switch {
+	case msg.Progress:
+		for _, line := range strings.Split(text, "\n") {
+			c.printLocked(ansiDim, "  · "+line, false)
+		}
+	case msg.Notification == bus.NotificationError:
+		c.printLocked(ansiRed, "["+msg.Notification+"] "+text, false)
+	case msg.Notification != "":
+		c.printLocked(ansiYellow, "["+msg.Notification+"] "+text, false)
+	default:
+		c.printLocked(ansiBold+ansiCyan, "picoclaw: ", true)
+		c.printLocked("", text, false)
+	}
+}
+
+// printLocked writes text in the given style, followed by a newline unless
+// inline is set. A prompt waiting for input is cleared first.
+func (c *TerminalChannel) printLocked(style, text string, inline bool) {
+	if c.promptShown {
+		if c.color {
+			io.WriteString(c.out, ansiClearLn)
+		} else {
+			io.WriteString(c.out, "\n")
+		}
+		c.promptShown = false
+	}
+	if c.color && style != "" {
+		text = style + text + ansiReset
+	}
+	if !inline {
+		text += "\n"
+	}
+	io.WriteString(c.out, text)
+}
+
+func (c *TerminalChannel) showPrompt() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.showPromptLocked()
+}
+
+// showPromptLocked asks for the next message, when reading from a terminal
+func (c *TerminalChannel) showPromptLocked() {
+	if !c.prompt || c.promptShown {
+		return
+	}
+	prompt := "you> "
+	if c.color {
+		prompt = ansiBold + ansiGreen + prompt + ansiReset
+	}
+	io.WriteString(c.out, prompt)
+	c.promptShown = true
+}
@@ -0,0 +1,89 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestTerminal(t *testing.T, input string, color bool) (*TerminalChannel, *bus.MessageBus, *bytes.Buffer) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	c, err := NewTerminalChannel(config.TerminalConfig{Enabled: true, Color: "never"}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	c.in, c.out, c.color, c.prompt = strings.NewReader(input), &out, color, false
+	return c, msgBus, &out
+}
+
+func TestTerminalInbound(t *testing.T) {
+	c, msgBus, _ := newTestTerminal(t, "hello\n\n  /status  \n", false)
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, want := range []string{"hello", "/status"} {
+		in, ok := msgBus.ConsumeInbound(ctx)
+		if !ok {
+			t.Fatalf("no inbound message for %q", want)
+		}
+		if in.Content != want || in.SenderID != TerminalSenderID || in.ChatID != TerminalChatID || in.SessionKey != "terminal:local" {
+			t.Errorf("unexpected inbound %+v", in)
+		}
+	}
+}
+
+func TestTerminalSendAndStream(t *testing.T) {
+	c, _, out := newTestTerminal(t, "", false)
+	if _, err := c.SendMessages(context.Background(), bus.OutboundMessage{ChatID: TerminalChatID, Content: "hi"}); err == nil {
+		t.Error("send before start should fail")
+	}
+	c.Start(context.Background())
+	ctx := context.Background()
+
+	ids, err := c.SendMessages(ctx, bus.OutboundMessage{ChatID: TerminalChatID, Content: "Searching", Progress: true})
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("SendMessages: %v, %v", ids, err)
+	}
+	// Updates print only what was added, also when old lines are dropped
+	c.EditMessage(ctx, TerminalChatID, ids[0], bus.OutboundMessage{Content: "Searching\nReading a.txt", Progress: true})
+	c.EditMessage(ctx, TerminalChatID, ids[0], bus.OutboundMessage{Content: "Reading a.txt\nReading b.txt", Progress: true})
+	// The reply takes the progress message's place
+	c.EditMessage(ctx, TerminalChatID, ids[0], bus.OutboundMessage{Content: "Done"})
+	c.Send(ctx, bus.OutboundMessage{ChatID: TerminalChatID, Content: "Disk almost full", Notification: bus.NotificationAlert})
+	c.Send(ctx, bus.OutboundMessage{ChatID: TerminalChatID, Attachments: []bus.Attachment{{Path: "/tmp/report.pdf", Caption: "Report"}}})
+
+	want := "  · Searching\n  · Reading a.txt\n  · Reading b.txt\npicoclaw: Done\n[alert] Disk almost full\n[attachment: /tmp/report.pdf] Report\n"
+	if out.String() != want {
+		t.Errorf("unexpected output:\n%q\nwant:\n%q", out.String(), want)
+	}
+}
+
+func TestTerminalColorAndPrompt(t *testing.T) {
+	c, _, out := newTestTerminal(t, "", true)
+	c.prompt = true
+	c.Start(context.Background())
+	c.Send(context.Background(), bus.OutboundMessage{ChatID: TerminalChatID, Content: "oops", Notification: bus.NotificationError})
+
+	// The prompt is cleared before output and shown again after it
+	want := ansiBold + ansiGreen + "you> " + ansiReset + ansiClearLn +
+		ansiRed + "[error] oops" + ansiReset + "\n" +
+		ansiBold + ansiGreen + "you> " + ansiReset
+	if out.String() != want {
+		t.Errorf("unexpected output:\n%q\nwant:\n%q", out.String(), want)
+	}
+
+	if _, err := NewTerminalChannel(config.TerminalConfig{Color: "rainbow"}, bus.NewMessageBus()); err == nil {
+		t.Error("invalid color mode should fail")
+	}
+}
@@ -0,0 +1,70 @@
+package channels
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// MetadataAudioPath holds the original audio of a transcribed voice note.
+// Several voice notes are separated by newlines.
+const MetadataAudioPath = "audio_path"
+
+// voiceTranscribeTimeout bounds the transcription of one voice note
+const voiceTranscribeTimeout = 30 * time.Second
+
+// hasAudio reports whether media holds an audio file
+func hasAudio(media []string) bool {
+	for _, path := range media {
+		if utils.IsAudioFile(filepath.Base(path), "") {
+			return true
+		}
+	}
+	return false
+}
+
+// transcribeVoiceNotes turns the audio files of an inbound message into
+// text: transcriptions are appended to content, and transcribed files move
+// from media to metadata. Audio that fails to transcribe stays in media.
+func transcribeVoiceNotes(ctx context.Context, transcriber voice.Transcriber, channel, content string, media []string, metadata map[string]string) (string, []string) {
+	if transcriber == nil || !transcriber.IsAvailable() || !hasAudio(media) {
+		return content, media
+	}
+
+	var kept, audioPaths, texts []string
+	if strings.TrimSpace(content) != "" {
+		texts = append(texts, content)
+	}
+	for _, path := range media {
+		if !utils.IsAudioFile(filepath.Base(path), "") {
+			kept = append(kept, path)
+			continue
+		}
+
+		tctx, cancel := context.WithTimeout(ctx, voiceTranscribeTimeout)
+		result, err := transcriber.Transcribe(tctx, path)
+		cancel()
+		if err != nil {
+			logger.WarnCF(channel, "Voice transcription failed", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			kept = append(kept, path)
+			continue
+		}
+		if text := strings.TrimSpace(result.Text); text != "" {
+			texts = append(texts, text)
+		}
+		audioPaths = append(audioPaths, path)
+	}
+
+	if len(audioPaths) > 0 {
+		metadata[MetadataAudioPath] = strings.Join(audioPaths, "\n")
+	}
+	return strings.Join(texts, "\n"), kept
+}
@@ -0,0 +1,79 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// fakeTranscriber transcribes every file to a fixed text, failing on failPath
+type fakeTranscriber struct {
+	text     string
+	failPath string
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, path string) (*voice.TranscriptionResponse, error) {
+	if path == f.failPath {
+		return nil, errors.New("service unavailable")
+	}
+	return &voice.TranscriptionResponse{Text: f.text}, nil
+}
+
+func (f *fakeTranscriber) IsAvailable() bool {
+	return true
+}
+
+func TestTranscribeVoiceNotes(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		media       []string
+		failPath    string
+		wantContent string
+		wantMedia   int
+		wantAudio   string
+	}{
+		{"voice note", "", []string{"/tmp/voice.ogg"}, "", "call me back", 0, "/tmp/voice.ogg"},
+		{"with caption", "listen", []string{"/tmp/voice.opus", "/tmp/photo.jpg"}, "", "listen\ncall me back", 1, "/tmp/voice.opus"},
+		{"failure keeps the audio", "", []string{"/tmp/voice.ogg"}, "/tmp/voice.ogg", "", 1, ""},
+		{"no audio", "hi", []string{"/tmp/photo.jpg"}, "", "hi", 1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := map[string]string{}
+			transcriber := &fakeTranscriber{text: " call me back ", failPath: tt.failPath}
+			content, media := transcribeVoiceNotes(context.Background(), transcriber, "test", tt.content, tt.media, metadata)
+			if content != tt.wantContent || len(media) != tt.wantMedia || metadata[MetadataAudioPath] != tt.wantAudio {
+				t.Errorf("got %q, %v, %q; want %q, %d media, %q", content, media, metadata[MetadataAudioPath], tt.wantContent, tt.wantMedia, tt.wantAudio)
+			}
+		})
+	}
+}
+
+func TestWhatsAppVoiceNoteTranscription(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	channel, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: "ws://localhost:3001"}, msgBus)
+	if err != nil {
+		t.Fatalf("NewWhatsAppChannel: %v", err)
+	}
+	channel.SetTranscriber(&fakeTranscriber{text: "call me back"})
+
+	channel.handleMessage(&IncomingMessage{Type: MessageTypeMessage, ID: "m1", From: "+1234567890", Media: []string{"/tmp/voice.ogg"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected an inbound message")
+	}
+	if msg.Content != "call me back" || len(msg.Media) != 0 || msg.Metadata[MetadataAudioPath] != "/tmp/voice.ogg" {
+		t.Errorf("unexpected inbound message: %+v", msg)
+	}
+	channel.wg.Wait()
+}
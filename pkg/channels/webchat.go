@@ -0,0 +1,534 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// DefaultWebChatPath is where the web chat is served when path is not set
+const DefaultWebChatPath = "/chat"
+
+const (
+	webChatPingInterval = 30 * time.Second
+	webChatReadTimeout  = 2 * webChatPingInterval // Without a message or pong the visitor is gone
+	webChatWriteTimeout = 10 * time.Second
+	webChatMaxFrame     = 64 << 10
+	webChatMaxRunes     = 4000 // Longest message a visitor may send
+	webChatBacklog      = 50   // Frames kept for a chat while nobody is connected
+	webChatBacklogAge   = 24 * time.Hour
+	webChatDefaultTTL   = 30 * 24 * time.Hour
+)
+
+//go:embed webchat_widget.js
+var webChatWidget []byte
+
+// webChatFrame is a message of the web chat protocol, in either direction.
+// Visitors send "message" (Text, optional ID) and "ping"; the gateway sends
+// "session" once connected, then "message", "edit", "attachment",
+// "reaction", "pong" and "error".
+type webChatFrame struct {
+	Type         string `json:"type"`
+	ID           string `json:"id,omitempty"`
+	Text         string `json:"text,omitempty"`
+	ReplyTo      string `json:"reply_to,omitempty"`
+	Progress     bool   `json:"progress,omitempty"`
+	Notification string `json:"notification,omitempty"`
+	Reaction     string `json:"reaction,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Caption      string `json:"caption,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	Token        string `json:"token,omitempty"`
+	UserID       string `json:"user_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// webChatConn is a visitor's WebSocket; writes are serialized
+type webChatConn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (wc *webChatConn) write(frame webChatFrame) error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.ws.SetWriteDeadline(time.Now().Add(webChatWriteTimeout))
+	return wc.ws.WriteJSON(frame)
+}
+
+// WebChatChannel serves a chat widget that websites embed. Visitors talk to
+// the agent over a WebSocket on the gateway HTTP server, identified by
+// session tokens: tokens signed by the embedding site for its users, or
+// anonymous ones the channel issues itself. Chat IDs are the user IDs of
+// the tokens, so every visitor has their own session and all their open
+// pages get the replies.
+type WebChatChannel struct {
+	*BaseChannel
+	config   config.WebChatConfig
+	path     string
+	secret   []byte
+	ttl      time.Duration
+	origins  map[string]bool // Empty allows any
+	markup   format.Style
+	upgrader websocket.Upgrader
+	nextID   atomic.Uint64
+
+	mu      sync.Mutex
+	conns   map[string]map[*webChatConn]struct{} // chat ID -> open connections
+	backlog map[string]*webChatBacklogEntry      // chat ID -> frames sent while nobody was connected
+}
+
+// NewWebChatChannel creates a web chat channel
+func NewWebChatChannel(cfg config.WebChatConfig, messageBus *bus.MessageBus) (*WebChatChannel, error) {
+	path := strings.TrimSuffix(cfg.Path, "/")
+	if path == "" {
+		path = DefaultWebChatPath
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("webchat path must start with /, got %q", cfg.Path)
+	}
+
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		if !cfg.AllowAnonymous {
+			return nil, fmt.Errorf("webchat needs a secret to check the tokens of signed-in users, or allow_anonymous")
+		}
+		// Anonymous sessions then end with a restart
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	ttl := webChatDefaultTTL
+	if cfg.SessionTTLHours > 0 {
+		ttl = time.Duration(cfg.SessionTTLHours) * time.Hour
+	}
+
+	markup, err := format.ParseStyle(cfg.Format, format.Markdown)
+	if err != nil {
+		logger.WarnCF("webchat", "Invalid format, using the default", map[string]interface{}{
+			"error":  err.Error(),
+			"format": string(markup),
+		})
+	}
+
+	c := &WebChatChannel{
+		BaseChannel: NewBaseChannel("webchat", cfg, messageBus, cfg.AllowFrom),
+		config:      cfg,
+		path:        path,
+		secret:      secret,
+		ttl:         ttl,
+		origins:     make(map[string]bool),
+		markup:      markup,
+		conns:       make(map[string]map[*webChatConn]struct{}),
+		backlog:     make(map[string]*webChatBacklogEntry),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		c.origins[strings.TrimSuffix(origin, "/")] = true
+	}
+	c.upgrader = websocket.Upgrader{CheckOrigin: c.checkOrigin}
+	return c, nil
+}
+
+// NewWebChatToken signs a session token for userID that is valid for ttl.
+// Sites whose visitors sign in give them such tokens, made with the same
+// secret: base64url(user ID), the expiry in Unix seconds and
+// base64url(HMAC-SHA256(secret, "<base64url user ID>.<expiry>")), joined
+// by dots.
+func NewWebChatToken(secret, userID string, ttl time.Duration) string {
+	return signWebChatToken([]byte(secret), userID, time.Now().Add(ttl))
+}
+
+func signWebChatToken(secret []byte, userID string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(userID)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyToken returns the user ID of a valid, unexpired token
+func (c *WebChatChannel) verifyToken(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed token")
+	}
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return "", fmt.Errorf("bad token signature")
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", fmt.Errorf("token expired")
+	}
+	userID, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(userID) == 0 {
+		return "", fmt.Errorf("malformed token")
+	}
+	return string(userID), nil
+}
+
+// checkOrigin lets pages of the allowed sites open the WebSocket
+func (c *WebChatChannel) checkOrigin(r *http.Request) bool {
+	if len(c.origins) == 0 {
+		return true
+	}
+	return c.origins[r.Header.Get("Origin")]
+}
+
+// Start accepts visitors
+func (c *WebChatChannel) Start(ctx context.Context) error {
+	logger.InfoC("webchat", "Starting web chat channel")
+	c.setRunning(true)
+	logger.InfoCF("webchat", "Web chat channel started", map[string]interface{}{
+		"socket":    c.path + "/ws",
+		"widget":    c.path + "/widget.js",
+		"anonymous": c.config.AllowAnonymous,
+	})
+	return nil
+}
+
+// Stop closes the visitors' connections
+func (c *WebChatChannel) Stop(ctx context.Context) error {
+	logger.InfoC("webchat", "Stopping web chat channel")
+	c.setRunning(false)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conns := range c.conns {
+		for wc := range conns {
+			wc.mu.Lock()
+			wc.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(time.Second))
+			wc.mu.Unlock()
+			wc.ws.Close()
+		}
+	}
+	return nil
+}
+
+// Markup returns the markup the channel sends
+func (c *WebChatChannel) Markup() format.Style {
+	return c.markup
+}
+
+// WebhookPath returns the path the WebSocket and the widget script are
+// served under
+func (c *WebChatChannel) WebhookPath() string {
+	return c.path + "/"
+}
+
+// ServeHTTP serves the WebSocket at <path>/ws and the widget script at
+// <path>/widget.js
+func (c *WebChatChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, c.path) {
+	case "/ws":
+		c.serveSocket(w, r)
+	case "/widget.js":
+		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(webChatWidget)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveSocket connects a visitor. A valid token resumes its user's
+// session; without one visitors get an anonymous session, if allowed.
+func (c *WebChatChannel) serveSocket(w http.ResponseWriter, r *http.Request) {
+	if !c.IsRunning() {
+		http.Error(w, "Web chat not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	var userID string
+	if token != "" {
+		var err error
+		if userID, err = c.verifyToken(token); err != nil {
+			logger.DebugCF("webchat", "Rejected session token", map[string]interface{}{
+				"remote_addr": r.RemoteAddr,
+				"error":       err.Error(),
+			})
+		}
+	}
+	anonymous := userID == "" || strings.HasPrefix(userID, "anon-")
+	if userID == "" {
+		if !c.config.AllowAnonymous {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		userID = "anon-" + randomWebChatID()
+	}
+	if !c.IsAllowed(userID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if anonymous {
+		// Anonymous sessions last as long as they are used
+		token = signWebChatToken(c.secret, userID, time.Now().Add(c.ttl))
+	}
+
+	ws, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered the request
+		return
+	}
+	wc := &webChatConn{ws: ws}
+	defer ws.Close()
+
+	if err := wc.write(webChatFrame{Type: "session", Token: token, UserID: userID}); err != nil {
+		return
+	}
+	if !c.addConn(userID, wc) {
+		return
+	}
+	defer c.removeConn(userID, wc)
+	logger.DebugCF("webchat", "Visitor connected", map[string]interface{}{
+		"user_id":   userID,
+		"anonymous": anonymous,
+	})
+	c.readLoop(userID, wc)
+}
+
+func randomWebChatID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// addConn registers a connection and hands it the frames its chat missed.
+// It fails when they cannot be written.
+func (c *WebChatChannel) addConn(chatID string, wc *webChatConn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry := c.backlog[chatID]; entry != nil {
+		for _, frame := range entry.frames {
+			if wc.write(frame) != nil {
+				return false
+			}
+		}
+		delete(c.backlog, chatID)
+	}
+	if c.conns[chatID] == nil {
+		c.conns[chatID] = make(map[*webChatConn]struct{})
+	}
+	c.conns[chatID][wc] = struct{}{}
+	return true
+}
+
+func (c *WebChatChannel) removeConn(chatID string, wc *webChatConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.conns[chatID], wc)
+	if len(c.conns[chatID]) == 0 {
+		delete(c.conns, chatID)
+	}
+}
+
+// readLoop hands the visitor's messages to the agent until the connection
+// closes. Pings detect visitors that are gone.
+func (c *WebChatChannel) readLoop(userID string, wc *webChatConn) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(webChatPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				wc.mu.Lock()
+				err := wc.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(webChatWriteTimeout))
+				wc.mu.Unlock()
+				if err != nil {
+					wc.ws.Close()
+					return
+				}
+			}
+		}
+	}()
+	wc.ws.SetReadLimit(webChatMaxFrame)
+	wc.ws.SetPongHandler(func(string) error {
+		return wc.ws.SetReadDeadline(time.Now().Add(webChatReadTimeout))
+	})
+
+	for {
+		wc.ws.SetReadDeadline(time.Now().Add(webChatReadTimeout))
+		_, data, err := wc.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var frame webChatFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			wc.write(webChatFrame{Type: "error", Error: "frames must be JSON objects"})
+			continue
+		}
+		switch frame.Type {
+		case "ping":
+			wc.write(webChatFrame{Type: "pong"})
+		case "message":
+			text := strings.TrimSpace(frame.Text)
+			if text == "" {
+				continue
+			}
+			if utf8.RuneCountInString(text) > webChatMaxRunes {
+				wc.write(webChatFrame{Type: "error", ID: frame.ID, Error: fmt.Sprintf("messages are limited to %d characters", webChatMaxRunes)})
+				continue
+			}
+			metadata := map[string]string{}
+			if frame.ID != "" {
+				// Lets a page resend after reconnecting without duplicates
+				metadata["message_id"] = frame.ID
+			}
+			c.HandleMessage(userID, userID, text, nil, metadata)
+		default:
+			wc.write(webChatFrame{Type: "error", Error: fmt.Sprintf("unknown frame type %q", frame.Type)})
+		}
+	}
+}
+
+// Send delivers msg to the visitor's open pages
+func (c *WebChatChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	_, err := c.SendMessages(ctx, msg)
+	return err
+}
+
+// SendMessages delivers msg and returns the ID it can be edited by. Frames
+// for visitors without an open page are kept until they come back. Local
+// files cannot be fetched by the browser and are announced by name.
+func (c *WebChatChannel) SendMessages(ctx context.Context, msg bus.OutboundMessage) ([]string, error) {
+	if !c.IsRunning() {
+		return nil, fmt.Errorf("%w: web chat not running", errs.ErrChannelDown)
+	}
+	if msg.ChatID == "" {
+		return nil, fmt.Errorf("%w: web chat user ID is empty", errs.ErrValidation)
+	}
+
+	if msg.Reaction != "" {
+		c.deliver(msg.ChatID, webChatFrame{Type: "reaction", ReplyTo: msg.ReplyTo, Reaction: msg.Reaction})
+		return nil, nil
+	}
+
+	if !msg.Formatted {
+		msg.Content = format.Convert(msg.Content, c.markup)
+	}
+	var frames []webChatFrame
+	var ids []string
+	if strings.TrimSpace(msg.Content) != "" || len(msg.Attachments) == 0 {
+		id := c.newMessageID()
+		ids = append(ids, id)
+		frames = append(frames, webChatFrame{
+			Type:         "message",
+			ID:           id,
+			Text:         msg.Content,
+			ReplyTo:      msg.ReplyTo,
+			Progress:     msg.Progress,
+			Notification: msg.Notification,
+		})
+	}
+	for _, att := range msg.Attachments {
+		frame := webChatFrame{Type: "attachment", Caption: att.Caption, MimeType: att.MimeType}
+		if att.Path != "" {
+			frame.Name = filepath.Base(att.Path)
+		} else {
+			frame.URL = att.URL
+		}
+		frames = append(frames, frame)
+	}
+	c.deliver(msg.ChatID, frames...)
+	return ids, nil
+}
+
+// EditMessage replaces the text of a message on the visitor's pages
+func (c *WebChatChannel) EditMessage(ctx context.Context, chatID, messageID string, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("%w: web chat not running", errs.ErrChannelDown)
+	}
+	if !msg.Formatted {
+		msg.Content = format.Convert(msg.Content, c.markup)
+	}
+	c.deliver(chatID, webChatFrame{Type: "edit", ID: messageID, Text: msg.Content, Progress: msg.Progress})
+	return nil
+}
+
+func (c *WebChatChannel) newMessageID() string {
+	return "m" + strconv.FormatUint(c.nextID.Add(1), 10)
+}
+
+// deliver writes frames to every open page of a chat, or keeps them for
+// the next one if there is none. Pages that fail to take them are closed.
+func (c *WebChatChannel) deliver(chatID string, frames ...webChatFrame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conns := c.conns[chatID]
+	if len(conns) == 0 {
+		c.keepLocked(chatID, frames)
+		return
+	}
+	for wc := range conns {
+		for _, frame := range frames {
+			if err := wc.write(frame); err != nil {
+				logger.DebugCF("webchat", "Failed to write to visitor, closing", map[string]interface{}{
+					"user_id": chatID,
+					"error":   err.Error(),
+				})
+				// The read loop ends and unregisters it
+				wc.ws.Close()
+				break
+			}
+		}
+	}
+}
+
+// webChatBacklogEntry holds the frames of a chat nobody has open
+type webChatBacklogEntry struct {
+	frames  []webChatFrame
+	updated time.Time
+}
+
+// keepLocked adds frames to the backlog of a chat, dropping its oldest
+// frames and the backlogs of visitors that did not come back for a day
+func (c *WebChatChannel) keepLocked(chatID string, frames []webChatFrame) {
+	now := time.Now()
+	for id, entry := range c.backlog {
+		if now.Sub(entry.updated) > webChatBacklogAge {
+			delete(c.backlog, id)
+		}
+	}
+	entry := c.backlog[chatID]
+	if entry == nil {
+		entry = &webChatBacklogEntry{}
+		c.backlog[chatID] = entry
+	}
+	entry.frames = append(entry.frames, frames...)
+	if len(entry.frames) > webChatBacklog {
+		entry.frames = entry.frames[len(entry.frames)-webChatBacklog:]
+	}
+	entry.updated = now
+}
@@ -0,0 +1,174 @@
+package channels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestWebChat(t *testing.T, cfg config.WebChatConfig) (*WebChatChannel, *bus.MessageBus, string) {
+	t.Helper()
+	cfg.Enabled = true
+	msgBus := bus.NewMessageBus()
+	c, err := NewWebChatChannel(cfg, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start(context.Background())
+	server := httptest.NewServer(c)
+	t.Cleanup(func() {
+		c.Stop(context.Background())
+		server.Close()
+	})
+	return c, msgBus, "ws" + strings.TrimPrefix(server.URL, "http") + "/chat/ws"
+}
+
+// dialWebChat connects and returns the session frame
+func dialWebChat(t *testing.T, url string, header http.Header) (*websocket.Conn, webChatFrame) {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial %s: %v (%d)", url, err, status)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, readWebChatFrame(t, conn)
+}
+
+func readWebChatFrame(t *testing.T, conn *websocket.Conn) webChatFrame {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var frame webChatFrame
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	return frame
+}
+
+func TestWebChatAnonymousSession(t *testing.T) {
+	c, msgBus, url := newTestWebChat(t, config.WebChatConfig{AllowAnonymous: true})
+	conn, session := dialWebChat(t, url, nil)
+	if session.Type != "session" || !strings.HasPrefix(session.UserID, "anon-") || session.Token == "" {
+		t.Fatalf("unexpected session frame %+v", session)
+	}
+
+	conn.WriteJSON(webChatFrame{Type: "message", ID: "1", Text: " hello "})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	in, ok := msgBus.ConsumeInbound(ctx)
+	if !ok || in.Content != "hello" || in.ChatID != session.UserID || in.SenderID != session.UserID || in.Metadata["message_id"] != "1" {
+		t.Fatalf("unexpected inbound %+v", in)
+	}
+
+	ids, err := c.SendMessages(ctx, bus.OutboundMessage{ChatID: session.UserID, Content: "Working", Progress: true})
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("SendMessages: %v, %v", ids, err)
+	}
+	c.EditMessage(ctx, session.UserID, ids[0], bus.OutboundMessage{Content: "Done"})
+	if frame := readWebChatFrame(t, conn); frame.Type != "message" || frame.ID != ids[0] || !frame.Progress || frame.Text != "Working" {
+		t.Errorf("unexpected message frame %+v", frame)
+	}
+	if frame := readWebChatFrame(t, conn); frame.Type != "edit" || frame.ID != ids[0] || frame.Progress || frame.Text != "Done" {
+		t.Errorf("unexpected edit frame %+v", frame)
+	}
+
+	conn.WriteJSON(webChatFrame{Type: "ping"})
+	if frame := readWebChatFrame(t, conn); frame.Type != "pong" {
+		t.Errorf("unexpected ping reply %+v", frame)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+	if frame := readWebChatFrame(t, conn); frame.Type != "error" {
+		t.Errorf("non-JSON frame not refused: %+v", frame)
+	}
+
+	// The token resumes the session; replies sent meanwhile are delivered
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.mu.Lock()
+		open := len(c.conns[session.UserID])
+		c.mu.Unlock()
+		if open == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Send(ctx, bus.OutboundMessage{ChatID: session.UserID, Content: "While you were away"})
+	conn, resumed := dialWebChat(t, url+"?token="+session.Token, nil)
+	if resumed.UserID != session.UserID {
+		t.Errorf("session not resumed: %+v", resumed)
+	}
+	if frame := readWebChatFrame(t, conn); frame.Text != "While you were away" {
+		t.Errorf("unexpected backlog frame %+v", frame)
+	}
+}
+
+func TestWebChatSignedTokens(t *testing.T) {
+	_, msgBus, url := newTestWebChat(t, config.WebChatConfig{
+		Secret:         "s3cret",
+		AllowFrom:      config.FlexibleStringSlice{"user-1", "user-2"},
+		AllowedOrigins: config.FlexibleStringSlice{"https://example.org"},
+	})
+
+	for name, tc := range map[string]struct {
+		token  string
+		origin string
+		status int
+	}{
+		"no token":      {"", "https://example.org", http.StatusUnauthorized},
+		"wrong secret":  {NewWebChatToken("other", "user-1", time.Hour), "https://example.org", http.StatusUnauthorized},
+		"expired":       {NewWebChatToken("s3cret", "user-1", -time.Minute), "https://example.org", http.StatusUnauthorized},
+		"not allowed":   {NewWebChatToken("s3cret", "user-3", time.Hour), "https://example.org", http.StatusForbidden},
+		"foreign site":  {NewWebChatToken("s3cret", "user-1", time.Hour), "https://evil.example", http.StatusForbidden},
+		"tampered user": {"dXNlci0y" + NewWebChatToken("s3cret", "user-1", time.Hour)[len("dXNlci0x"):], "https://example.org", http.StatusUnauthorized},
+	} {
+		header := http.Header{"Origin": {tc.origin}}
+		_, resp, err := websocket.DefaultDialer.Dial(url+"?token="+tc.token, header)
+		if err == nil || resp == nil || resp.StatusCode != tc.status {
+			t.Errorf("%s: expected status %d, got %v", name, tc.status, resp)
+		}
+	}
+
+	token := NewWebChatToken("s3cret", "user-1", time.Hour)
+	conn, session := dialWebChat(t, url+"?token="+token, http.Header{"Origin": {"https://example.org"}})
+	if session.UserID != "user-1" || session.Token != token {
+		t.Fatalf("unexpected session %+v", session)
+	}
+	conn.WriteJSON(webChatFrame{Type: "message", Text: strings.Repeat("x", webChatMaxRunes+1)})
+	if frame := readWebChatFrame(t, conn); frame.Type != "error" {
+		t.Errorf("long message not refused: %+v", frame)
+	}
+	conn.WriteJSON(webChatFrame{Type: "message", Text: "hi"})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if in, ok := msgBus.ConsumeInbound(ctx); !ok || in.SenderID != "user-1" || in.Content != "hi" {
+		t.Errorf("unexpected inbound %+v", in)
+	}
+}
+
+func TestWebChatWidget(t *testing.T) {
+	c, _, _ := newTestWebChat(t, config.WebChatConfig{AllowAnonymous: true, Path: "/support/"})
+	if c.WebhookPath() != "/support/" {
+		t.Errorf("unexpected path %q", c.WebhookPath())
+	}
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/support/widget.js", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Type"), "javascript") || !strings.Contains(rec.Body.String(), "WebSocket") {
+		t.Errorf("unexpected widget response %d %v", rec.Code, rec.Header())
+	}
+
+	if _, err := NewWebChatChannel(config.WebChatConfig{}, bus.NewMessageBus()); err == nil {
+		t.Error("signed-in users only need a secret")
+	}
+}
@@ -0,0 +1,112 @@
+// PicoClaw web chat widget. Embed it with
+//   <script src="https://gateway.example.org/chat/widget.js" async></script>
+// and, for signed-in users, data-token="<session token>". Without a token the
+// widget asks for an anonymous session and keeps it in localStorage.
+(function () {
+  "use strict";
+  var script = document.currentScript;
+  var socketURL = script.src.replace(/^http/, "ws").replace(/\/widget\.js(\?.*)?$/, "/ws");
+  var storageKey = "picoclaw-webchat-token";
+  var title = script.getAttribute("data-title") || "Chat";
+  var token = script.getAttribute("data-token") || localStorage.getItem(storageKey) || "";
+  var signed = script.hasAttribute("data-token");
+
+  var css = ".pcw-button{position:fixed;right:20px;bottom:20px;z-index:2147483000;border:0;border-radius:24px;padding:12px 18px;background:#1f6feb;color:#fff;font:14px sans-serif;cursor:pointer}" +
+    ".pcw-panel{position:fixed;right:20px;bottom:72px;z-index:2147483000;width:340px;max-width:calc(100vw - 40px);height:460px;display:none;flex-direction:column;background:#fff;border:1px solid #ddd;border-radius:8px;box-shadow:0 4px 16px rgba(0,0,0,.15);font:14px sans-serif}" +
+    ".pcw-panel.pcw-open{display:flex}.pcw-title{padding:10px 12px;border-bottom:1px solid #eee;font-weight:bold}" +
+    ".pcw-log{flex:1;overflow-y:auto;padding:8px 12px}.pcw-msg{margin:6px 0;white-space:pre-wrap;word-wrap:break-word}" +
+    ".pcw-you{text-align:right;color:#1f6feb}.pcw-progress{color:#888;font-size:12px}.pcw-note{color:#b36b00}" +
+    ".pcw-form{display:flex;border-top:1px solid #eee}.pcw-input{flex:1;border:0;padding:10px 12px;font:inherit;outline:none}";
+  var style = document.createElement("style");
+  style.textContent = css;
+  document.head.appendChild(style);
+
+  var button = document.createElement("button");
+  button.className = "pcw-button";
+  button.textContent = title;
+  var panel = document.createElement("div");
+  panel.className = "pcw-panel";
+  panel.innerHTML = '<div class="pcw-title"></div><div class="pcw-log"></div>' +
+    '<form class="pcw-form"><input class="pcw-input" maxlength="4000" placeholder="Type a message"></form>';
+  panel.querySelector(".pcw-title").textContent = title;
+  var log = panel.querySelector(".pcw-log");
+  var input = panel.querySelector(".pcw-input");
+  document.body.appendChild(panel);
+  document.body.appendChild(button);
+  button.onclick = function () {
+    panel.classList.toggle("pcw-open");
+    if (panel.classList.contains("pcw-open")) {
+      connect();
+      input.focus();
+    }
+  };
+
+  var messages = {};
+  function show(text, className, id) {
+    var el = id && messages[id];
+    if (!el) {
+      el = document.createElement("div");
+      log.appendChild(el);
+      if (id) messages[id] = el;
+    }
+    el.className = "pcw-msg " + (className || "");
+    el.textContent = text;
+    log.scrollTop = log.scrollHeight;
+  }
+
+  var socket = null;
+  var delay = 1000;
+  var sent = 0;
+  function connect() {
+    if (socket) return;
+    socket = new WebSocket(socketURL + (token ? "?token=" + encodeURIComponent(token) : ""));
+    socket.onmessage = function (event) {
+      var frame = JSON.parse(event.data);
+      switch (frame.type) {
+        case "session":
+          delay = 1000;
+          if (!signed) {
+            token = frame.token;
+            localStorage.setItem(storageKey, token);
+          }
+          break;
+        case "message":
+        case "edit":
+          show(frame.text, frame.progress ? "pcw-progress" : (frame.notification ? "pcw-note" : ""), frame.id);
+          break;
+        case "attachment":
+          var el = document.createElement("div");
+          el.className = "pcw-msg";
+          if (frame.url) {
+            var link = document.createElement("a");
+            link.href = frame.url;
+            link.target = "_blank";
+            link.rel = "noopener";
+            link.textContent = frame.caption || frame.url;
+            el.appendChild(link);
+          } else {
+            el.textContent = "[" + frame.name + "] " + (frame.caption || "");
+          }
+          log.appendChild(el);
+          break;
+        case "error":
+          show(frame.error, "pcw-note");
+          break;
+      }
+    };
+    socket.onclose = function () {
+      socket = null;
+      setTimeout(connect, delay);
+      delay = Math.min(delay * 2, 30000);
+    };
+  }
+
+  panel.querySelector(".pcw-form").onsubmit = function (event) {
+    event.preventDefault();
+    var text = input.value.trim();
+    if (!text || !socket || socket.readyState !== WebSocket.OPEN) return;
+    socket.send(JSON.stringify({ type: "message", id: Date.now() + "-" + (++sent), text: text }));
+    show(text, "pcw-you");
+    input.value = "";
+  };
+})();
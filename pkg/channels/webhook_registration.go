@@ -0,0 +1,146 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// DefaultWebhookCheckInterval is how often registered webhook URLs are
+// compared with the wanted ones when the config leaves it at 0
+const DefaultWebhookCheckInterval = 15 * time.Minute
+
+// webhookRegistrar is implemented by channels that set their webhook URL on
+// the platform themselves and can read it back, so it can be repaired when
+// someone or something else changes it
+type webhookRegistrar interface {
+	// WantedWebhook returns the URL the platform should deliver to while
+	// the gateway is reachable at baseURL, which is empty when unknown.
+	// It returns "" when there is nothing to register.
+	WantedWebhook(baseURL string) string
+	// RegisteredWebhook returns the URL the platform delivers to, "" if none
+	RegisteredWebhook(ctx context.Context) (string, error)
+	RegisterWebhook(ctx context.Context, webhookURL string) error
+}
+
+// webhookRegistry keeps the gateway's public URL for the webhook checks
+type webhookRegistry struct {
+	// mu is held during a check, so checks never overlap
+	mu      sync.Mutex
+	baseURL string
+	// manual holds the URLs already logged for channels whose webhook is
+	// set up by hand, by channel
+	manual map[string]string
+}
+
+// SetPublicURL tells the webhook channels that the gateway is reachable at
+// baseURL, e.g. through a tunnel whose URL changed, and checks their
+// webhooks at once
+func (m *Manager) SetPublicURL(ctx context.Context, baseURL string) {
+	m.webhooks.mu.Lock()
+	defer m.webhooks.mu.Unlock()
+	m.webhooks.baseURL = strings.TrimSuffix(baseURL, "/")
+	m.checkWebhooksLocked(ctx)
+}
+
+// CheckWebhooks registers the webhook URL of every running channel whose
+// platform delivers somewhere else, including nowhere
+func (m *Manager) CheckWebhooks(ctx context.Context) {
+	m.webhooks.mu.Lock()
+	defer m.webhooks.mu.Unlock()
+	m.checkWebhooksLocked(ctx)
+}
+
+// RunWebhookChecks repeats CheckWebhooks at the configured interval until
+// ctx is done. It returns at once when the checks are turned off.
+func (m *Manager) RunWebhookChecks(ctx context.Context) {
+	interval := time.Duration(m.config.Channels.WebhookCheckIntervalMinutes) * time.Minute
+	if interval < 0 {
+		return
+	}
+	if interval == 0 {
+		interval = DefaultWebhookCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.CheckWebhooks(ctx)
+		}
+	}
+}
+
+func (m *Manager) checkWebhooksLocked(ctx context.Context) {
+	m.mu.RLock()
+	channels := make(map[string]Channel, len(m.channels))
+	for name, channel := range m.channels {
+		channels[name] = channel
+	}
+	m.mu.RUnlock()
+
+	baseURL := m.webhooks.baseURL
+	for name, channel := range channels {
+		if !channel.IsRunning() {
+			// Channels register their webhook when they start
+			continue
+		}
+		if registrar, ok := channel.(webhookRegistrar); ok {
+			if wanted := registrar.WantedWebhook(baseURL); wanted != "" {
+				repairWebhook(ctx, name, registrar, wanted)
+				continue
+			}
+		}
+		receiver, ok := channel.(WebhookReceiver)
+		if !ok || receiver.WebhookPath() == "" || baseURL == "" {
+			continue
+		}
+		webhookURL := baseURL + receiver.WebhookPath()
+		if m.webhooks.manual[name] == webhookURL {
+			continue
+		}
+		if m.webhooks.manual == nil {
+			m.webhooks.manual = make(map[string]string)
+		}
+		m.webhooks.manual[name] = webhookURL
+		logger.InfoCF("channels", "Webhook URL to set up with the platform", map[string]interface{}{
+			"channel": name,
+			"url":     webhookURL,
+		})
+	}
+}
+
+// repairWebhook registers wanted unless the platform already delivers there
+func repairWebhook(ctx context.Context, name string, registrar webhookRegistrar, wanted string) {
+	fields := map[string]interface{}{
+		"channel": name,
+		"url":     wanted,
+	}
+	registered, err := registrar.RegisteredWebhook(ctx)
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.WarnCF("channels", "Failed to read the registered webhook URL", fields)
+		return
+	}
+	if registered == wanted {
+		logger.DebugCF("channels", "Webhook URL up to date", fields)
+		return
+	}
+	if registered != "" {
+		fields["registered"] = registered
+		logger.WarnCF("channels", "Platform delivers webhooks elsewhere, registering again", fields)
+	}
+
+	if err := registrar.RegisterWebhook(ctx, wanted); err != nil {
+		fields["error"] = err.Error()
+		logger.ErrorCF("channels", "Failed to register webhook URL", fields)
+		return
+	}
+	logger.InfoCF("channels", "Webhook URL registered", fields)
+}
@@ -2,12 +2,15 @@ package channels
 
 import (
 	"context"
+	"crypto/ecdh"
+	"crypto/rand"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,9 +18,15 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/format"
 	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
+// bridgeTLSConfig is used when dialing wss:// bridges
+var bridgeTLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
 // WhatsAppChannel represents the WhatsApp channel with enhanced security.
 type WhatsAppChannel struct {
 	*BaseChannel
@@ -25,35 +34,88 @@ type WhatsAppChannel struct {
 	validator    *MessageValidator
 	retryManager *ConnectionRetry
 	conn         *websocket.Conn
+	writer       *wsWriter // Sole writer of conn
 	connMu       sync.RWMutex
 	connected    bool
 	connecting   bool
 	url          string
 	authToken    string
+	accountID    string // Set when the channel is one of several bridge accounts
+	markup       format.Style
 	hmacKey      string
-	pingInterval time.Duration
-	pongTimeout  time.Duration
+	keepalive    keepaliveSettings
 	lastPing     time.Time
+	lastPong     time.Time
+	protocol     *bridgeProtocol  // Negotiated by the hello handshake, nil until the bridge answers
+	refused      error            // Why the bridge was refused as incompatible
+	encryption   string           // Payload encryption mode
+	kex          *ecdh.PrivateKey // Key exchange key of the current connection, nil with encryption off
+	cipher       *bridgeCipher    // Payload cipher, nil until the key exchange completes
+	transcriber  voice.Transcriber
 	stopCh       chan struct{}
+	stopOnce     sync.Once
 	wg           sync.WaitGroup
-	
+
 	// Facebook WhatsApp Business API client
 	facebookClient *FacebookWhatsAppClient
 	useFacebookAPI bool
+
+	// lastInbound tracks the latest inbound message ID per chat (chatID -> messageID)
+	lastInbound sync.Map
 }
 
 // NewWhatsAppChannel creates a new WhatsApp channel with enhanced security.
-func NewWhatsAppChannel(base *BaseChannel, cfg config.WhatsAppConfig) *WhatsAppChannel {
+func NewWhatsAppChannel(cfg config.WhatsAppConfig, messageBus *bus.MessageBus) (*WhatsAppChannel, error) {
+	keepalive, err := newKeepaliveSettings(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid whatsapp keepalive configuration: %w", err)
+	}
+
+	encryption, err := parseEncryptionMode(cfg.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("invalid whatsapp encryption configuration: %w", err)
+	}
+
+	keys, err := newWhatsAppKeyProvider(cfg)
+	if err != nil {
+		log.Printf("Invalid WhatsApp HMAC key configuration: %v", err)
+		keys = &StaticKeyProvider{}
+	}
+	if encryption != EncryptionOff {
+		// Unsigned hellos let whoever sits in the middle swap the keys
+		if signing, _ := keys.Keys(); len(signing) == 0 {
+			if encryption == EncryptionRequire {
+				return nil, fmt.Errorf("whatsapp encryption %q needs HMAC keys to authenticate the key exchange", encryption)
+			}
+			log.Printf("WhatsApp payload encryption is on without HMAC keys: the key exchange is not authenticated")
+		}
+	}
+
 	channel := &WhatsAppChannel{
-		BaseChannel:  base,
+		BaseChannel:  NewBaseChannel("whatsapp", cfg, messageBus, cfg.AllowFrom),
 		config:       cfg,
-		validator:    NewMessageValidator(cfg.BridgeURL),
-		retryManager: NewConnectionRetry(5, 30*time.Second),
+		validator:    NewMessageValidatorWithKeys(keys, cfg.HMACMissingKey),
+		retryManager: NewConnectionRetryWithPolicy(RetryPolicy{
+			MaxAttempts:  cfg.ReconnectMaxAttempts,
+			MaxDelay:     time.Duration(cfg.ReconnectMaxDelaySeconds) * time.Second,
+			Jitter:       cfg.ReconnectJitter,
+			ResetAfter:   time.Duration(cfg.ReconnectResetAfterSeconds) * time.Second,
+		}),
 		stopCh:       make(chan struct{}),
-		pingInterval: 30 * time.Second,
-		pongTimeout:  60 * time.Second,
+		keepalive:    keepalive,
+		encryption:   encryption,
 	}
 	
+	channel.markup, err = format.ParseStyle(cfg.Format, format.WhatsApp)
+	if err != nil {
+		log.Printf("Invalid WhatsApp format, using %s: %v", channel.markup, err)
+	}
+
+	channel.validator.SetReplayProtection(time.Duration(cfg.ReplayWindowSeconds)*time.Second, cfg.NonceCacheSize)
+	if cfg.LegacySignatures {
+		channel.validator.SetSignatureVersion(SignatureVersionLegacy)
+	}
+
 	// Determine which API to use
 	if cfg.FBPhoneNumberID != "" && cfg.FBAccessToken != "" {
 		channel.useFacebookAPI = true
@@ -65,10 +127,13 @@ func NewWhatsAppChannel(base *BaseChannel, cfg config.WhatsAppConfig) *WhatsAppC
 		log.Printf("WhatsApp channel configured to use Facebook Business API (phone: %s)", cfg.FBPhoneNumberID)
 	} else if cfg.BridgeURL != "" {
 		channel.url = cfg.BridgeURL
+		channel.authToken = cfg.AuthToken
+		// The bridge connection comes and goes while the channel runs
+		channel.reportsHealth()
 		log.Printf("WhatsApp channel configured to use WebSocket bridge: %s", cfg.BridgeURL)
 	}
 	
-	return channel
+	return channel, nil
 }
 
 // Start starts the WhatsApp channel
@@ -79,28 +144,42 @@ func (c *WhatsAppChannel) Start(ctx context.Context) error {
 			return fmt.Errorf("facebook api credential validation failed: %w", err)
 		}
 		log.Printf("Facebook WhatsApp Business API credentials validated successfully")
+		c.setRunning(true)
 		return nil
 	}
 	
-	// Start WebSocket connection
-	go c.connectLoop(ctx)
+	// The first attempt is synchronous so the channel can send right away;
+	// if the bridge is down, connectLoop keeps retrying in the background.
+	done, err := c.connect(ctx)
+	if err != nil {
+		log.Printf("WhatsApp bridge connection failed, retrying in background: %v", err)
+	}
+
+	c.setRunning(true)
+	c.wg.Add(1)
+	go c.connectLoop(ctx, done)
 	return nil
 }
 
 // Stop stops the WhatsApp channel
 func (c *WhatsAppChannel) Stop(ctx context.Context) error {
-	close(c.stopCh)
-	c.wg.Wait()
+	c.stopOnce.Do(func() { close(c.stopCh) })
 	
 	if !c.useFacebookAPI {
 		c.disconnect()
 	}
+	c.wg.Wait()
+	c.setRunning(false)
+	if !c.useFacebookAPI {
+		c.setHealth(StateDisconnected, "stopped")
+	}
 	
 	return nil
 }
 
 // Send sends a message through WhatsApp
 func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	msg = c.formatOutbound(msg)
 	if c.useFacebookAPI {
 		return c.sendViaFacebook(ctx, msg)
 	}
@@ -116,33 +195,100 @@ func (c *WhatsAppChannel) sendViaFacebook(ctx context.Context, msg bus.OutboundM
 		phoneNumber = phoneNumber[1:]
 	}
 	
+	if msg.Reaction != "" {
+		if msg.ReplyTo == "" {
+			return fmt.Errorf("reaction requires a message to react to")
+		}
+		if err := c.facebookClient.SendReaction(ctx, phoneNumber, msg.ReplyTo, msg.Reaction); err != nil {
+			return fmt.Errorf("failed to send Facebook WhatsApp reaction: %w", err)
+		}
+		log.Printf("Facebook WhatsApp reaction %s sent to %s (message %s)", msg.Reaction, phoneNumber, msg.ReplyTo)
+		return nil
+	}
+
+	if len(msg.Attachments) > 0 {
+		log.Printf("Facebook WhatsApp channel does not send attachments, skipping %d for %s", len(msg.Attachments), phoneNumber)
+	}
+
 	// Send as text message (you can extend this to support templates)
-	err := c.facebookClient.SendTextMessage(ctx, phoneNumber, msg.Content)
-	if err != nil {
-		return fmt.Errorf("failed to send Facebook WhatsApp message: %w", err)
+	replyTo := msg.ReplyTo
+	if msg.Content != "" || msg.Contact == nil {
+		var err error
+		if replyTo != "" {
+			err = c.facebookClient.SendTextReply(ctx, phoneNumber, msg.Content, replyTo)
+		} else {
+			err = c.facebookClient.SendTextMessage(ctx, phoneNumber, msg.Content)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to send Facebook WhatsApp message: %w", err)
+		}
+		replyTo = ""
+		log.Printf("Facebook WhatsApp message sent to %s: %s...", phoneNumber, utils.Truncate(msg.Content, 50))
+	}
+
+	if msg.Contact != nil {
+		contacts := []FacebookContact{facebookContact(msg.Contact)}
+		if err := c.facebookClient.SendContacts(ctx, phoneNumber, contacts, replyTo); err != nil {
+			return fmt.Errorf("failed to send Facebook WhatsApp contact: %w", err)
+		}
+		log.Printf("Facebook WhatsApp contact %s sent to %s", msg.Contact.Name, phoneNumber)
 	}
-	
-	log.Printf("Facebook WhatsApp message sent to %s: %s...", phoneNumber, utils.Truncate(msg.Content, 50))
 	return nil
 }
 
 // sendViaWebSocket sends a message using WebSocket bridge
 func (c *WhatsAppChannel) sendViaWebSocket(ctx context.Context, msg bus.OutboundMessage) error {
-	c.connMu.RLock()
-	conn := c.conn
-	connected := c.connected
-	c.connMu.RUnlock()
+	writer, err := c.bridgeWriter()
+	if err != nil {
+		return err
+	}
 
-	if !connected || conn == nil {
-		return fmt.Errorf("whatsapp connection not established")
+	if strings.HasSuffix(msg.ChatID, whatsappGroupSuffix) {
+		if err := c.requireCapability(CapabilityGroups); err != nil {
+			return err
+		}
+	}
+
+	if msg.Reaction != "" {
+		if msg.ReplyTo == "" {
+			return fmt.Errorf("reaction requires a message to react to")
+		}
+		if err := c.requireCapability(CapabilityReactions); err != nil {
+			return err
+		}
+		return c.writeOutgoing(ctx, writer, &OutgoingMessage{
+			Type:     MessageTypeReaction,
+			To:       msg.ChatID,
+			Reaction: &MessageReaction{MessageID: msg.ReplyTo, Emoji: msg.Reaction},
+		})
+	}
+
+	if len(msg.Attachments) > 0 && !c.bridgeSupports(CapabilityMedia) {
+		log.Printf("WhatsApp bridge does not support media, sending %d attachments to %s as text", len(msg.Attachments), msg.ChatID)
+		msg = attachmentsAsText(msg)
 	}
 
-	outgoing := &OutgoingMessage{
-		Type:    MessageTypeMessage,
-		To:      msg.ChatID,
-		Content: msg.Content,
+	messages, err := outgoingMessages(msg)
+	if err != nil {
+		return err
+	}
+	for i, outgoing := range messages {
+		if err := c.writeOutgoing(ctx, writer, outgoing); err != nil {
+			if len(messages) > 1 {
+				return fmt.Errorf("part %d of %d: %w", i+1, len(messages), err)
+			}
+			return err
+		}
 	}
 
+	log.Printf("WhatsApp message sent to %s (%d parts, %d attachments): %s...",
+		msg.ChatID, len(messages), len(msg.Attachments), utils.Truncate(msg.Content, 50))
+	return nil
+}
+
+// writeOutgoing validates, signs, encrypts and writes a message to the
+// bridge connection
+func (c *WhatsAppChannel) writeOutgoing(ctx context.Context, writer *wsWriter, outgoing *OutgoingMessage) error {
 	if err := c.validator.ValidateOutgoing(outgoing); err != nil {
 		return fmt.Errorf("message validation failed: %w", err)
 	}
@@ -151,21 +297,266 @@ func (c *WhatsAppChannel) sendViaWebSocket(ctx context.Context, msg bus.Outbound
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
-
-	deadline := time.Now().Add(10 * time.Second)
-	if err := conn.SetWriteDeadline(deadline); err != nil {
-		return fmt.Errorf("failed to set write deadline: %w", err)
+	if data, err = c.sealPayload(outgoing.Type, data); err != nil {
+		return err
 	}
 
-	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		c.handleConnectionError()
+	if err := writer.Write(ctx, websocket.TextMessage, data); err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
 
-	log.Printf("WhatsApp message sent to %s: %s...", outgoing.To, utils.Truncate(outgoing.Content, 50))
 	return nil
 }
 
+// bridgeWriter returns the writer of the current bridge connection, or an
+// error if not connected
+func (c *WhatsAppChannel) bridgeWriter() (*wsWriter, error) {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+
+	if !c.connected || c.writer == nil {
+		return nil, fmt.Errorf("%w: whatsapp connection not established", errs.ErrChannelDown)
+	}
+	return c.writer, nil
+}
+
+// connect dials the bridge and starts the reader and keepalive goroutines.
+// The returned channel is closed when the connection is lost.
+func (c *WhatsAppChannel) connect(ctx context.Context) (<-chan struct{}, error) {
+	c.connMu.Lock()
+	if c.connected || c.connecting {
+		c.connMu.Unlock()
+		return nil, fmt.Errorf("whatsapp connection already in progress")
+	}
+	c.connecting = true
+	c.connMu.Unlock()
+	c.setHealth(StateConnecting, "")
+
+	defer func() {
+		c.connMu.Lock()
+		c.connecting = false
+		c.connMu.Unlock()
+	}()
+
+	u, err := url.Parse(c.url)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") {
+		c.setHealth(StateDisconnected, "invalid bridge url")
+		return nil, fmt.Errorf("invalid bridge url %q", c.url)
+	}
+
+	// A fresh key per connection keeps earlier sessions unreadable
+	var kex *ecdh.PrivateKey
+	if c.encryption != EncryptionOff {
+		if kex, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+			c.setHealth(StateDisconnected, err.Error())
+			return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+		}
+	}
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:  bridgeTLSConfig,
+	}
+	header := http.Header{}
+	if c.authToken != "" {
+		header.Set("Authorization", "Bearer "+c.authToken)
+	}
+
+	conn, _, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		c.setHealth(StateDisconnected, err.Error())
+		return nil, fmt.Errorf("failed to connect to bridge: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(c.keepalive.readTimeout))
+	conn.SetPongHandler(func(string) error {
+		c.recordPong(conn)
+		return nil
+	})
+
+	done := make(chan struct{})
+	writer := newWSWriter(conn, done)
+	c.connMu.Lock()
+	c.conn = conn
+	c.writer = writer
+	c.connected = true
+	c.lastPing = time.Time{}
+	c.lastPong = time.Time{}
+	c.protocol = nil
+	c.kex = kex
+	c.cipher = nil
+	c.connMu.Unlock()
+	c.retryManager.Connected()
+	c.setHealth(StateConnected, "")
+
+	c.wg.Add(3)
+	go func() {
+		defer c.wg.Done()
+		writer.run()
+	}()
+	go c.readLoop(conn, done)
+	go c.pingLoop(writer)
+
+	// Bridges that predate the handshake ignore the hello and keep the legacy protocol
+	helloCtx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+	hello := helloMessage()
+	if kex != nil {
+		hello.Key = encodePublicKey(kex)
+	}
+	if err := c.writeOutgoing(helloCtx, writer, hello); err != nil {
+		log.Printf("Failed to send WhatsApp bridge hello: %v", err)
+	}
+
+	log.Printf("WhatsApp bridge connected: %s", u.Host)
+	return done, nil
+}
+
+// connectLoop reconnects to the bridge whenever the connection is lost
+func (c *WhatsAppChannel) connectLoop(ctx context.Context, done <-chan struct{}) {
+	defer c.wg.Done()
+
+	var lastErr error
+	for {
+		if done != nil {
+			select {
+			case <-done:
+				c.retryManager.Disconnected()
+				lastErr = fmt.Errorf("connection lost")
+				c.setHealth(StateDisconnected, lastErr.Error())
+				if err := c.bridgeRefusal(); err != nil {
+					c.publishGaveUp(c.retryManager.GetAttempts(), err)
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-c.stopCh:
+				return
+			}
+		}
+
+		if !c.retryManager.ShouldRetry() {
+			attempts := c.retryManager.GetAttempts()
+			log.Printf("WhatsApp bridge reconnection gave up after %d attempts", attempts)
+			c.publishGaveUp(attempts, lastErr)
+			return
+		}
+		delay := c.retryManager.NextDelay()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		case <-c.stopCh:
+			return
+		}
+
+		if done, lastErr = c.connect(ctx); lastErr != nil {
+			log.Printf("WhatsApp bridge reconnection attempt %d failed: %v", c.retryManager.GetAttempts(), lastErr)
+		}
+	}
+}
+
+// readLoop reads bridge messages until the connection fails or read deadline expires
+func (c *WhatsAppChannel) readLoop(conn *websocket.Conn, done chan struct{}) {
+	defer c.wg.Done()
+	defer close(done)
+	defer c.dropConn(conn)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-c.stopCh:
+			default:
+				log.Printf("WhatsApp bridge connection lost: %v", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(c.keepalive.readTimeout))
+		c.HandleInboundMessage(data)
+	}
+}
+
+// dropConn forgets conn if it is still the current connection and closes it
+func (c *WhatsAppChannel) dropConn(conn *websocket.Conn) {
+	c.connMu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+		c.writer = nil
+		c.connected = false
+	}
+	c.connMu.Unlock()
+	conn.Close()
+}
+
+// disconnect closes the bridge connection
+func (c *WhatsAppChannel) disconnect() {
+	c.connMu.RLock()
+	conn, writer := c.conn, c.writer
+	c.connMu.RUnlock()
+
+	if conn == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), controlWriteTimeout)
+	defer cancel()
+	writer.Write(ctx, websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.dropConn(conn)
+}
+
+// ValidatorStats returns counters of bridge messages rejected by the validator
+func (c *WhatsAppChannel) ValidatorStats() ValidatorStats {
+	return c.validator.Stats()
+}
+
+// SendTyping shows a typing indicator in the given chat
+func (c *WhatsAppChannel) SendTyping(ctx context.Context, chatID string) error {
+	if c.useFacebookAPI {
+		// The Cloud API attaches typing indicators to the message being answered
+		messageID, ok := c.lastInbound.Load(chatID)
+		if !ok {
+			return fmt.Errorf("no inbound message to attach typing indicator to for chat %s", chatID)
+		}
+		return c.facebookClient.SendTypingIndicator(ctx, messageID.(string))
+	}
+
+	if err := c.requireCapability(CapabilityTyping); err != nil {
+		return err
+	}
+	writer, err := c.bridgeWriter()
+	if err != nil {
+		return err
+	}
+	return c.writeOutgoing(ctx, writer, &OutgoingMessage{
+		Type: MessageTypeTyping,
+		To:   chatID,
+	})
+}
+
+// MarkRead sends a read receipt for the given message
+func (c *WhatsAppChannel) MarkRead(ctx context.Context, messageID string) error {
+	if messageID == "" {
+		return fmt.Errorf("message id is required")
+	}
+
+	if c.useFacebookAPI {
+		return c.facebookClient.MarkRead(ctx, messageID)
+	}
+
+	if err := c.requireCapability(CapabilityReceipts); err != nil {
+		return err
+	}
+	writer, err := c.bridgeWriter()
+	if err != nil {
+		return err
+	}
+	return c.writeOutgoing(ctx, writer, &OutgoingMessage{
+		Type:      MessageTypeRead,
+		MessageID: messageID,
+	})
+}
+
 // HandleInboundMessage processes incoming messages
 func (c *WhatsAppChannel) HandleInboundMessage(data []byte) {
 	if c.useFacebookAPI {
@@ -175,6 +566,11 @@ func (c *WhatsAppChannel) HandleInboundMessage(data []byte) {
 	}
 	
 	// Handle WebSocket messages
+	data, err := c.openPayload(data)
+	if err != nil {
+		log.Printf("Rejected WhatsApp bridge message: %v", err)
+		return
+	}
 	msg, err := c.validator.ValidateIncoming(data)
 	if err != nil {
 		log.Printf("Failed to validate incoming message: %v", err)
@@ -182,7 +578,7 @@ func (c *WhatsAppChannel) HandleInboundMessage(data []byte) {
 	}
 
 	switch msg.Type {
-	case MessageTypeMessage:
+	case MessageTypeMessage, MessageTypeLocation, MessageTypeContact:
 		c.handleMessage(msg)
 	case MessageTypeStatus:
 		c.handleStatusMessage(msg)
@@ -192,11 +588,136 @@ func (c *WhatsAppChannel) HandleInboundMessage(data []byte) {
 		c.handlePong(msg)
 	case MessageTypeError:
 		c.handleErrorMessage(msg)
+	case MessageTypeHello:
+		c.handleHello(msg)
 	default:
 		log.Printf("Unknown message type: %s", msg.Type)
 	}
 }
 
+// handleMessage publishes a validated bridge message to the bus
+func (c *WhatsAppChannel) handleMessage(msg *IncomingMessage) {
+	chatID := msg.Chat
+	if chatID == "" {
+		chatID = msg.From
+	}
+
+	metadata := map[string]string{
+		"platform": "whatsapp",
+	}
+	if c.accountID != "" {
+		metadata["account_id"] = c.accountID
+	}
+	if msg.ID != "" {
+		metadata["message_id"] = msg.ID
+	}
+	if msg.FromName != "" {
+		metadata["sender_name"] = msg.FromName
+	}
+	if msg.Context != nil && msg.Context.MessageID != "" {
+		metadata["reply_to_message_id"] = msg.Context.MessageID
+	}
+
+	content := sharedContent(msg, metadata)
+	if reply := msg.ButtonReply; reply != nil {
+		content = reply.ID
+		choiceMetadata(metadata, reply.ID, reply.Title)
+	}
+	if isGroupMessage(msg) {
+		if !c.groupAllowed(msg.Chat, msg.From) {
+			log.Printf("Ignoring WhatsApp group message from %s in %s: not allowed", msg.From, msg.Chat)
+			return
+		}
+		mentioned := c.isMentioned(msg)
+		// Pressing one of our buttons answers the bot like a mention
+		if c.config.RespondOnlyWhenMentioned && !mentioned && msg.ButtonReply == nil {
+			return
+		}
+		if mentioned {
+			content = c.stripSelfMention(content)
+		}
+		addGroupMetadata(metadata, msg, mentioned)
+	}
+
+	if msg.ID != "" {
+		c.lastInbound.Store(chatID, msg.ID)
+	}
+
+	if c.transcriber != nil && c.IsAllowed(msg.From) && hasAudio(msg.Media) {
+		// Transcribing takes a while: keep reading the bridge meanwhile
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				select {
+				case <-c.stopCh:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			content, media := transcribeVoiceNotes(ctx, c.transcriber, "whatsapp", content, msg.Media, metadata)
+			c.publishInbound(msg.From, chatID, content, media, metadata)
+		}()
+		return
+	}
+	c.publishInbound(msg.From, chatID, content, msg.Media, metadata)
+}
+
+// publishInbound hands an inbound message to the agent and shows it typing
+func (c *WhatsAppChannel) publishInbound(senderID, chatID, content string, media []string, metadata map[string]string) {
+	c.HandleMessage(senderID, chatID, content, media, metadata)
+
+	if c.config.SendTypingIndicators && c.IsAllowed(senderID) && c.bridgeSupports(CapabilityTyping) {
+		if err := c.SendTyping(context.Background(), chatID); err != nil {
+			log.Printf("Failed to send WhatsApp typing indicator to %s: %v", chatID, err)
+		}
+	}
+}
+
+// SetTranscriber sets how voice notes are turned into text
+func (c *WhatsAppChannel) SetTranscriber(transcriber voice.Transcriber) {
+	c.transcriber = transcriber
+}
+
+// handleStatusMessage logs delivery status updates from the bridge
+func (c *WhatsAppChannel) handleStatusMessage(msg *IncomingMessage) {
+	log.Printf("WhatsApp message %s status: %s", msg.ID, msg.Status)
+}
+
+// handlePing answers an application-level ping from the bridge
+func (c *WhatsAppChannel) handlePing(msg *IncomingMessage) {
+	writer, err := c.bridgeWriter()
+	if err != nil {
+		return
+	}
+	// Queue the pong without waiting: this runs on the read goroutine
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		defer cancel()
+		if err := c.writeOutgoing(ctx, writer, &OutgoingMessage{Type: MessageTypePong}); err != nil {
+			log.Printf("Failed to answer WhatsApp bridge ping: %v", err)
+		}
+	}()
+}
+
+// handlePong records an application-level pong from the bridge
+func (c *WhatsAppChannel) handlePong(msg *IncomingMessage) {
+	c.connMu.RLock()
+	conn := c.conn
+	c.connMu.RUnlock()
+
+	if conn != nil {
+		c.recordPong(conn)
+	}
+}
+
+// handleErrorMessage logs errors reported by the bridge
+func (c *WhatsAppChannel) handleErrorMessage(msg *IncomingMessage) {
+	log.Printf("WhatsApp bridge error: %s", msg.Error)
+}
+
 // SendTemplate sends a template message via Facebook API
 func (c *WhatsAppChannel) SendTemplate(ctx context.Context, to, templateName, languageCode string, components []TemplateComponent) error {
 	if !c.useFacebookAPI {
@@ -0,0 +1,279 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// DefaultWhatsAppAccount is the account ID of the section's own bridge_url
+// when instances are configured next to it.
+const DefaultWhatsAppAccount = "default"
+
+// WhatsAppAccounts serves several WhatsApp bridge accounts as the single
+// "whatsapp" channel. Inbound messages carry the account in their
+// "account_id" metadata; Send routes by OutboundMessage.AccountID, falling
+// back to the account the chat last wrote to, then to the first account.
+type WhatsAppAccounts struct {
+	accounts map[string]*WhatsAppChannel
+	order    []string // Account IDs in config order
+}
+
+// NewWhatsAppAccounts creates one bridge channel per configured account.
+func NewWhatsAppAccounts(cfg config.WhatsAppConfig, messageBus *bus.MessageBus) (*WhatsAppAccounts, error) {
+	instances := cfg.Instances
+	if cfg.BridgeURL != "" {
+		instances = append([]config.WhatsAppInstanceConfig{{
+			AccountID: DefaultWhatsAppAccount,
+			BridgeURL: cfg.BridgeURL,
+			AuthToken: cfg.AuthToken,
+			AllowFrom: cfg.AllowFrom,
+		}}, instances...)
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no whatsapp bridge accounts configured")
+	}
+
+	w := &WhatsAppAccounts{accounts: make(map[string]*WhatsAppChannel, len(instances))}
+	for _, inst := range instances {
+		if _, dup := w.accounts[inst.AccountID]; dup {
+			return nil, fmt.Errorf("duplicate whatsapp account %q", inst.AccountID)
+		}
+
+		accountCfg := cfg
+		accountCfg.Instances = nil
+		accountCfg.BridgeURL = inst.BridgeURL
+		accountCfg.AuthToken = inst.AuthToken
+		if len(inst.AllowFrom) > 0 {
+			accountCfg.AllowFrom = inst.AllowFrom
+		}
+		// Accounts are bridge connections; the Business API is not multiplexed
+		accountCfg.FBPhoneNumberID = ""
+		accountCfg.FBAccessToken = ""
+
+		channel, err := NewWhatsAppChannel(accountCfg, messageBus)
+		if err != nil {
+			return nil, fmt.Errorf("whatsapp account %q: %w", inst.AccountID, err)
+		}
+		channel.accountID = inst.AccountID
+
+		w.accounts[inst.AccountID] = channel
+		w.order = append(w.order, inst.AccountID)
+	}
+	return w, nil
+}
+
+// Name returns the channel name shared by all accounts
+func (w *WhatsAppAccounts) Name() string {
+	return "whatsapp"
+}
+
+// Start starts every account. It only fails if no account could start.
+func (w *WhatsAppAccounts) Start(ctx context.Context) error {
+	var errs []error
+	for _, id := range w.order {
+		if err := w.accounts[id].Start(ctx); err != nil {
+			log.Printf("Failed to start WhatsApp account %s: %v", id, err)
+			errs = append(errs, fmt.Errorf("account %s: %w", id, err))
+		}
+	}
+	if len(errs) == len(w.order) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// Stop stops every account
+func (w *WhatsAppAccounts) Stop(ctx context.Context) error {
+	var errs []error
+	for _, id := range w.order {
+		if err := w.accounts[id].Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// configureInboundDedup gives every account its own inbound dedup cache
+func (w *WhatsAppAccounts) configureInboundDedup(cfg config.InboundDedupConfig) {
+	for _, id := range w.order {
+		w.accounts[id].configureInboundDedup(cfg)
+	}
+}
+
+// configureInboundDebounce coalesces bursts of messages on every account
+func (w *WhatsAppAccounts) configureInboundDebounce(cfg config.InboundDebounceConfig) {
+	for _, id := range w.order {
+		w.accounts[id].configureInboundDebounce(cfg)
+	}
+}
+
+// configureAccess applies the deny list and chat lists to every account
+func (w *WhatsAppAccounts) configureAccess(cfg config.ChannelAccessConfig) {
+	for _, id := range w.order {
+		w.accounts[id].configureAccess(cfg)
+	}
+}
+
+// setBridges copies the inbound messages of every account by the bridge
+// rules
+func (w *WhatsAppAccounts) setBridges(bridges *Bridges) {
+	for _, id := range w.order {
+		w.accounts[id].setBridges(bridges)
+	}
+}
+
+// AllowSender allows senderID on every account
+func (w *WhatsAppAccounts) AllowSender(senderID string) {
+	for _, id := range w.order {
+		w.accounts[id].AllowSender(senderID)
+	}
+}
+
+// DenySender denies senderID on every account
+func (w *WhatsAppAccounts) DenySender(senderID string) {
+	for _, id := range w.order {
+		w.accounts[id].DenySender(senderID)
+	}
+}
+
+// stopInbound makes every account drop inbound messages
+func (w *WhatsAppAccounts) stopInbound() {
+	for _, id := range w.order {
+		w.accounts[id].stopInbound()
+	}
+}
+
+// SetTranscriber sets how every account turns voice notes into text
+func (w *WhatsAppAccounts) SetTranscriber(transcriber voice.Transcriber) {
+	for _, id := range w.order {
+		w.accounts[id].SetTranscriber(transcriber)
+	}
+}
+
+// DuplicatesDropped returns the redelivered messages dropped by all accounts
+func (w *WhatsAppAccounts) DuplicatesDropped() uint64 {
+	var total uint64
+	for _, id := range w.order {
+		total += w.accounts[id].DuplicatesDropped()
+	}
+	return total
+}
+
+// Markup returns the markup of the accounts, which share one configuration
+func (w *WhatsAppAccounts) Markup() format.Style {
+	return w.accounts[w.order[0]].Markup()
+}
+
+// RendersCards reports that the accounts lay out cards themselves
+func (w *WhatsAppAccounts) RendersCards() bool {
+	return true
+}
+
+// SendsContacts reports that the accounts send contact cards themselves
+func (w *WhatsAppAccounts) SendsContacts() bool {
+	return true
+}
+
+// Send sends a message from the account selected for it
+func (w *WhatsAppAccounts) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	account, err := w.route(msg)
+	if err != nil {
+		return err
+	}
+	return account.Send(ctx, msg)
+}
+
+// route picks the account that sends msg
+func (w *WhatsAppAccounts) route(msg bus.OutboundMessage) (*WhatsAppChannel, error) {
+	if msg.AccountID != "" {
+		account, ok := w.accounts[msg.AccountID]
+		if !ok {
+			return nil, fmt.Errorf("unknown whatsapp account %q", msg.AccountID)
+		}
+		return account, nil
+	}
+
+	for _, id := range w.order {
+		if _, ok := w.accounts[id].lastInbound.Load(msg.ChatID); ok {
+			return w.accounts[id], nil
+		}
+	}
+	return w.accounts[w.order[0]], nil
+}
+
+// IsRunning reports whether any account is running
+func (w *WhatsAppAccounts) IsRunning() bool {
+	for _, account := range w.accounts {
+		if account.IsRunning() {
+			return true
+		}
+	}
+	return false
+}
+
+// Health combines the states of the accounts: connected when all are,
+// degraded when only some can deliver, and otherwise the state of the first
+// account that cannot
+func (w *WhatsAppAccounts) Health() Health {
+	var down []string
+	var worst Health
+	ready := 0
+	for _, id := range w.order {
+		h := w.accounts[id].Health()
+		if h.State.Ready() {
+			ready++
+			if h.State == StateDegraded && worst.State == "" {
+				worst = h
+			}
+			continue
+		}
+		down = append(down, id)
+		if worst.State == "" || worst.State.Ready() {
+			worst = h
+		}
+	}
+
+	switch {
+	case len(down) == 0 && worst.State == "":
+		return w.accounts[w.order[0]].Health()
+	case len(down) == 0:
+		return worst
+	case ready > 0:
+		return Health{
+			State:  StateDegraded,
+			Reason: fmt.Sprintf("accounts %s: %s", strings.Join(down, ", "), worst),
+			Since:  worst.Since,
+		}
+	default:
+		return worst
+	}
+}
+
+// IsAllowed reports whether any account accepts the sender
+func (w *WhatsAppAccounts) IsAllowed(senderID string) bool {
+	for _, account := range w.accounts {
+		if account.IsAllowed(senderID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Account returns the channel of one account
+func (w *WhatsAppAccounts) Account(id string) (*WhatsAppChannel, bool) {
+	account, ok := w.accounts[id]
+	return account, ok
+}
+
+// AccountIDs returns the account IDs in config order
+func (w *WhatsAppAccounts) AccountIDs() []string {
+	return append([]string(nil), w.order...)
+}
@@ -0,0 +1,163 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// newRecordingBridge starts a bridge that forwards the recipient of every
+// outgoing message it receives.
+func newRecordingBridge(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	recipients := make(chan string, 10)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg OutgoingMessage
+			if json.Unmarshal(data, &msg) == nil && msg.Type == MessageTypeMessage {
+				recipients <- msg.To
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return strings.Replace(server.URL, "https://", "wss://", 1), recipients
+}
+
+func TestNewWhatsAppAccounts(t *testing.T) {
+	accounts, err := NewWhatsAppAccounts(config.WhatsAppConfig{
+		BridgeURL: "ws://localhost:3001",
+		AuthToken: "main-token",
+		AllowFrom: []string{"+1111111111"},
+		Instances: []config.WhatsAppInstanceConfig{
+			{AccountID: "sales", BridgeURL: "ws://localhost:3002", AuthToken: "sales-token"},
+			{AccountID: "support", BridgeURL: "ws://localhost:3003", AllowFrom: []string{"+2222222222"}},
+		},
+	}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewWhatsAppAccounts: %v", err)
+	}
+
+	if got := strings.Join(accounts.AccountIDs(), ","); got != "default,sales,support" {
+		t.Errorf("AccountIDs() = %s", got)
+	}
+
+	sales, _ := accounts.Account("sales")
+	if sales.url != "ws://localhost:3002" || sales.authToken != "sales-token" || !sales.IsAllowed("+1111111111") {
+		t.Errorf("sales should use its own bridge and inherit allow_from: %s %s", sales.url, sales.authToken)
+	}
+	support, _ := accounts.Account("support")
+	if support.IsAllowed("+1111111111") || !support.IsAllowed("+2222222222") {
+		t.Error("support should use its own allow_from")
+	}
+
+	if _, err := NewWhatsAppAccounts(config.WhatsAppConfig{
+		Instances: []config.WhatsAppInstanceConfig{
+			{AccountID: "a", BridgeURL: "ws://localhost:3002"},
+			{AccountID: "a", BridgeURL: "ws://localhost:3003"},
+		},
+	}, bus.NewMessageBus()); err == nil {
+		t.Error("expected duplicate account IDs to be rejected")
+	}
+}
+
+func TestWhatsAppAccountsInboundMetadata(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	accounts, err := NewWhatsAppAccounts(config.WhatsAppConfig{
+		Instances: []config.WhatsAppInstanceConfig{
+			{AccountID: "sales", BridgeURL: "ws://localhost:3002"},
+		},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewWhatsAppAccounts: %v", err)
+	}
+
+	sales, _ := accounts.Account("sales")
+	sales.handleMessage(&IncomingMessage{Type: MessageTypeMessage, ID: "m1", From: "+1234567890", Content: "hi"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected an inbound message")
+	}
+	if msg.Channel != "whatsapp" || msg.Metadata["account_id"] != "sales" {
+		t.Errorf("unexpected inbound message: %+v", msg)
+	}
+	if msg.SessionKey != "whatsapp:sales:+1234567890" {
+		t.Errorf("session key should be scoped to the account, got %s", msg.SessionKey)
+	}
+}
+
+func TestWhatsAppAccountsSendRouting(t *testing.T) {
+	mainURL, mainRecv := newRecordingBridge(t)
+	salesURL, salesRecv := newRecordingBridge(t)
+
+	accounts, err := NewWhatsAppAccounts(config.WhatsAppConfig{
+		BridgeURL: mainURL,
+		Instances: []config.WhatsAppInstanceConfig{{AccountID: "sales", BridgeURL: salesURL}},
+	}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewWhatsAppAccounts: %v", err)
+	}
+
+	ctx := t.Context()
+	if err := accounts.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer accounts.Stop(ctx)
+
+	sales, _ := accounts.Account("sales")
+	sales.lastInbound.Store("+2222222222", "m1")
+
+	tests := []struct {
+		name string
+		msg  bus.OutboundMessage
+		want <-chan string
+	}{
+		{"explicit account", bus.OutboundMessage{ChatID: "+1111111111", AccountID: "sales"}, salesRecv},
+		{"account of the chat", bus.OutboundMessage{ChatID: "+2222222222"}, salesRecv},
+		{"first account by default", bus.OutboundMessage{ChatID: "+3333333333"}, mainRecv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.Channel = "whatsapp"
+			tt.msg.Content = "hello"
+			if err := accounts.Send(ctx, tt.msg); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			select {
+			case to := <-tt.want:
+				if to != tt.msg.ChatID {
+					t.Errorf("bridge received message for %s, want %s", to, tt.msg.ChatID)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("message did not reach the expected bridge")
+			}
+		})
+	}
+
+	if err := accounts.Send(ctx, bus.OutboundMessage{ChatID: "+1111111111", AccountID: "nope", Content: "x"}); err == nil {
+		t.Error("expected unknown account to fail")
+	}
+}
@@ -0,0 +1,204 @@
+package channels
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/sipeed/picoclaw/pkg/errs"
+)
+
+// Payload encryption modes. With encryption on, each side sends an X25519
+// public key in its hello and every later message travels inside an
+// "encrypted" envelope sealed with XChaCha20-Poly1305:
+//
+//	{"type":"encrypted","payload":"<base64 of 24-byte nonce || ciphertext>"}
+//
+// The plaintext is the message exactly as it would otherwise be sent,
+// signature included. Each direction has its own key, derived with
+// HKDF-SHA256 from the shared secret, salted with the channel's public key
+// followed by the bridge's.
+const (
+	EncryptionOff     = "off"     // Plaintext payloads (default)
+	EncryptionPrefer  = "prefer"  // Encrypt when the bridge supports it
+	EncryptionRequire = "require" // Refuse bridges that cannot encrypt
+)
+
+// HKDF info strings, one per direction
+const (
+	bridgeKeyInfoSend = "picoclaw-wa/enc/v1 picoclaw->bridge"
+	bridgeKeyInfoRecv = "picoclaw-wa/enc/v1 bridge->picoclaw"
+)
+
+// parseEncryptionMode validates the configured encryption mode
+func parseEncryptionMode(mode string) (string, error) {
+	switch mode {
+	case "", EncryptionOff:
+		return EncryptionOff, nil
+	case EncryptionPrefer, EncryptionRequire:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown encryption mode %q (want off, prefer or require)", mode)
+	}
+}
+
+// encryptedEnvelope wraps a sealed bridge message
+type encryptedEnvelope struct {
+	Type    string `json:"type"`
+	Payload string `json:"payload,omitempty"`
+}
+
+// bridgeCipher seals and opens the payloads of one bridge connection
+type bridgeCipher struct {
+	send cipher.AEAD
+	recv cipher.AEAD
+}
+
+// encodePublicKey returns the key sent in the hello for priv
+func encodePublicKey(priv *ecdh.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes())
+}
+
+// decodePublicKey parses an X25519 public key from a hello
+func decodePublicKey(encoded string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key encoding: %w", err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return key, nil
+}
+
+// deriveBridgeCipher completes the key exchange with the bridge's public key
+func deriveBridgeCipher(priv *ecdh.PrivateKey, peerKey string) (*bridgeCipher, error) {
+	peer, err := decodePublicKey(peerKey)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange failed: %w", err)
+	}
+
+	salt := append(priv.PublicKey().Bytes(), peer.Bytes()...)
+	send, err := newBridgeAEAD(shared, salt, bridgeKeyInfoSend)
+	if err != nil {
+		return nil, err
+	}
+	recv, err := newBridgeAEAD(shared, salt, bridgeKeyInfoRecv)
+	if err != nil {
+		return nil, err
+	}
+	return &bridgeCipher{send: send, recv: recv}, nil
+}
+
+func newBridgeAEAD(shared, salt []byte, info string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, shared, salt, info, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("key derivation failed: %w", err)
+	}
+	return chacha20poly1305.NewX(key)
+}
+
+// seal wraps data in an encrypted envelope
+func (bc *bridgeCipher) seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, chacha20poly1305.NonceSizeX, chacha20poly1305.NonceSizeX+len(data)+chacha20poly1305.Overhead)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := bc.send.Seal(nonce, nonce, data, nil)
+	return json.Marshal(encryptedEnvelope{
+		Type:    MessageTypeEncrypted,
+		Payload: base64.StdEncoding.EncodeToString(sealed),
+	})
+}
+
+// open returns the message inside an encrypted envelope's payload
+func (bc *bridgeCipher) open(payload string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted payload encoding: %w", err)
+	}
+	if len(sealed) < chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return nil, fmt.Errorf("encrypted payload too short")
+	}
+	nonce, ciphertext := sealed[:chacha20poly1305.NonceSizeX], sealed[chacha20poly1305.NonceSizeX:]
+	data, err := bc.recv.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted payload failed authentication")
+	}
+	return data, nil
+}
+
+// sealPayload encrypts an outgoing message once the key exchange is done.
+// In require mode nothing but the hello leaves in plaintext.
+func (c *WhatsAppChannel) sealPayload(msgType string, data []byte) ([]byte, error) {
+	c.connMu.RLock()
+	bc := c.cipher
+	c.connMu.RUnlock()
+
+	if bc != nil {
+		return bc.seal(data)
+	}
+	if c.encryption == EncryptionRequire && msgType != MessageTypeHello {
+		return nil, fmt.Errorf("%w: whatsapp bridge encryption not established", errs.ErrChannelDown)
+	}
+	return data, nil
+}
+
+// openPayload decrypts an incoming message. Once the key exchange is done
+// plaintext messages are rejected, and in require mode only the bridge's
+// hello may arrive in plaintext.
+func (c *WhatsAppChannel) openPayload(data []byte) ([]byte, error) {
+	var envelope encryptedEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		// Left to the validator to report
+		return data, nil
+	}
+
+	c.connMu.RLock()
+	bc := c.cipher
+	c.connMu.RUnlock()
+
+	switch {
+	case envelope.Type == MessageTypeEncrypted && bc == nil:
+		return nil, fmt.Errorf("encrypted message before the key exchange")
+	case envelope.Type == MessageTypeEncrypted:
+		return bc.open(envelope.Payload)
+	case bc != nil:
+		return nil, fmt.Errorf("plaintext %q message on an encrypted connection", envelope.Type)
+	case c.encryption == EncryptionRequire && envelope.Type != MessageTypeHello:
+		return nil, fmt.Errorf("plaintext %q message before the key exchange", envelope.Type)
+	}
+	return data, nil
+}
+
+// negotiateEncryption completes the key exchange announced in the bridge's
+// hello. Without a key from the bridge, require mode fails and prefer mode
+// stays in plaintext.
+func (c *WhatsAppChannel) negotiateEncryption(hello *IncomingMessage) (*bridgeCipher, error) {
+	c.connMu.RLock()
+	kex := c.kex
+	c.connMu.RUnlock()
+
+	if kex == nil {
+		return nil, nil
+	}
+	if hello.Key == "" {
+		if c.encryption == EncryptionRequire {
+			return nil, fmt.Errorf("bridge does not support payload encryption, which is required")
+		}
+		return nil, nil
+	}
+	return deriveBridgeCipher(kex, hello.Key)
+}
@@ -0,0 +1,266 @@
+package channels
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// bridgeSideCipher is the bridge's end of the key exchange with channelKey
+func bridgeSideCipher(t *testing.T, bridge *ecdh.PrivateKey, channelKey string) *bridgeCipher {
+	t.Helper()
+	peer, err := decodePublicKey(channelKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := bridge.ECDH(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := append(peer.Bytes(), bridge.PublicKey().Bytes()...)
+	send, err := newBridgeAEAD(shared, salt, bridgeKeyInfoRecv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv, err := newBridgeAEAD(shared, salt, bridgeKeyInfoSend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &bridgeCipher{send: send, recv: recv}
+}
+
+func TestBridgeCipher(t *testing.T) {
+	channelKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	bridgeKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	channel, err := deriveBridgeCipher(channelKey, encodePublicKey(bridgeKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge := bridgeSideCipher(t, bridgeKey, encodePublicKey(channelKey))
+
+	plain := []byte(`{"type":"message","to":"+1234","content":"secret"}`)
+	sealed, err := channel.seal(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sealed), "secret") {
+		t.Fatalf("envelope leaks the content: %s", sealed)
+	}
+	var envelope encryptedEnvelope
+	if err := json.Unmarshal(sealed, &envelope); err != nil || envelope.Type != MessageTypeEncrypted {
+		t.Fatalf("unexpected envelope %s", sealed)
+	}
+	if opened, err := bridge.open(envelope.Payload); err != nil || string(opened) != string(plain) {
+		t.Fatalf("open() = %q, %v", opened, err)
+	}
+
+	// Each direction has its own key
+	if _, err := channel.open(envelope.Payload); err == nil {
+		t.Error("the channel opened its own message")
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(envelope.Payload)
+	raw[len(raw)-1] ^= 1
+	if _, err := bridge.open(base64.StdEncoding.EncodeToString(raw)); err == nil {
+		t.Error("tampered payload was accepted")
+	}
+	if _, err := bridge.open("c2hvcnQ="); err == nil {
+		t.Error("short payload was accepted")
+	}
+
+	if _, err := deriveBridgeCipher(channelKey, "bm90IGEga2V5"); err == nil {
+		t.Error("invalid peer key was accepted")
+	}
+}
+
+func TestParseEncryptionMode(t *testing.T) {
+	for mode, want := range map[string]string{"": EncryptionOff, "off": EncryptionOff, "prefer": EncryptionPrefer, "require": EncryptionRequire} {
+		if got, err := parseEncryptionMode(mode); err != nil || got != want {
+			t.Errorf("parseEncryptionMode(%q) = %q, %v", mode, got, err)
+		}
+	}
+	if _, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: "ws://localhost", Encryption: "always"}, bus.NewMessageBus()); err == nil {
+		t.Error("unknown encryption mode should be rejected")
+	}
+
+	// Without HMAC keys the key exchange cannot be trusted
+	if _, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: "ws://localhost", Encryption: EncryptionRequire}, bus.NewMessageBus()); err == nil || !strings.Contains(err.Error(), "HMAC keys") {
+		t.Errorf("require without HMAC keys: %v", err)
+	}
+	if _, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: "ws://localhost", Encryption: EncryptionPrefer}, bus.NewMessageBus()); err != nil {
+		t.Errorf("prefer without HMAC keys: %v", err)
+	}
+}
+
+// testBridgeSecret is the HMAC key shared with the test bridges
+const testBridgeSecret = "bridge-secret"
+
+// signedByBridge adds a timestamp and a canonical signature with
+// testBridgeSecret to the fields of a bridge message
+func signedByBridge(t *testing.T, fields map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	fields["sig_version"] = SignatureVersionCanonical
+	if _, ok := fields["timestamp"]; !ok {
+		fields["timestamp"] = time.Now().Unix()
+	}
+	data, _ := json.Marshal(fields)
+	signing, err := signingString(SignatureVersionCanonical, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields["signature"] = computeHMAC([]byte(testBridgeSecret), signing)
+	return fields
+}
+
+// encryptingBridge starts a bridge that completes the key exchange, then
+// forwards every message it decrypts to received and encrypts those queued
+// on send
+func encryptingBridge(t *testing.T, received chan<- map[string]interface{}, send <-chan string) string {
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var hello OutgoingMessage
+		if err := conn.ReadJSON(&hello); err != nil || hello.Type != MessageTypeHello || hello.Key == "" {
+			t.Errorf("expected a hello with a key, got %+v (%v)", hello, err)
+			return
+		}
+		key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+		bc := bridgeSideCipher(t, key, hello.Key)
+		conn.WriteJSON(signedByBridge(t, map[string]interface{}{
+			"type":    "hello",
+			"version": BridgeProtocolVersion,
+			"key":     encodePublicKey(key),
+		}))
+
+		go func() {
+			for data := range send {
+				var fields map[string]interface{}
+				json.Unmarshal([]byte(data), &fields)
+				signed, _ := json.Marshal(signedByBridge(t, fields))
+				sealed, _ := bc.seal(signed)
+				conn.WriteMessage(websocket.TextMessage, sealed)
+			}
+		}()
+		for {
+			var envelope encryptedEnvelope
+			if err := conn.ReadJSON(&envelope); err != nil {
+				return
+			}
+			if envelope.Type != MessageTypeEncrypted {
+				t.Errorf("plaintext %q message after the key exchange", envelope.Type)
+				continue
+			}
+			data, err := bc.open(envelope.Payload)
+			if err != nil {
+				t.Errorf("open: %v", err)
+				continue
+			}
+			var msg map[string]interface{}
+			json.Unmarshal(data, &msg)
+			received <- msg
+		}
+	}))
+	t.Cleanup(server.Close)
+	return strings.Replace(server.URL, "https://", "wss://", 1)
+}
+
+func TestBridgeEncryption(t *testing.T) {
+	received := make(chan map[string]interface{}, 10)
+	send := make(chan string, 10)
+	t.Cleanup(func() { close(send) })
+	url := encryptingBridge(t, received, send)
+
+	msgBus := bus.NewMessageBus()
+	channel, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: url, Encryption: EncryptionRequire, HMACKeys: []string{testBridgeSecret}}, msgBus)
+	if err != nil {
+		t.Fatalf("NewWhatsAppChannel: %v", err)
+	}
+	ctx := t.Context()
+	if err := channel.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer channel.Stop(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		channel.connMu.RLock()
+		established := channel.cipher != nil
+		channel.connMu.RUnlock()
+		if established {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key exchange did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := channel.Send(ctx, bus.OutboundMessage{ChatID: "+1234567890", Content: "hi"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case msg := <-received:
+		if msg["content"] != "hi" {
+			t.Errorf("unexpected message %v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received by the bridge")
+	}
+
+	send <- `{"type":"message","id":"m1","from":"+1234567890","content":"hello"}`
+	consumeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if in, ok := msgBus.ConsumeInbound(consumeCtx); !ok || in.Content != "hello" {
+		t.Errorf("unexpected inbound %+v", in)
+	}
+
+	// Plaintext is refused once the session is encrypted
+	if _, err := channel.openPayload([]byte(`{"type":"message","from":"+1234567890","content":"forged"}`)); err == nil {
+		t.Error("plaintext message accepted on an encrypted connection")
+	}
+}
+
+func TestBridgeEncryptionRequired(t *testing.T) {
+	url := helloBridge(t, signedByBridge(t, map[string]interface{}{
+		"type":    "hello",
+		"version": BridgeProtocolVersion,
+	}), make(chan map[string]interface{}, 10))
+
+	msgBus := bus.NewMessageBus()
+	channel, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: url, Encryption: EncryptionRequire, HMACKeys: []string{testBridgeSecret}}, msgBus)
+	if err != nil {
+		t.Fatalf("NewWhatsAppChannel: %v", err)
+	}
+	ctx := t.Context()
+	if err := channel.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer channel.Stop(ctx)
+
+	consumeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(consumeCtx)
+	if !ok {
+		t.Fatal("expected the channel to give up on a bridge without encryption")
+	}
+	if msg.Metadata["event"] != EventChannelGaveUp || !strings.Contains(msg.Metadata["error"], "encryption") {
+		t.Errorf("unexpected event %+v", msg)
+	}
+}
@@ -0,0 +1,89 @@
+package channels
+
+import (
+	"strconv"
+	"strings"
+)
+
+// whatsappGroupSuffix is the JID server used for WhatsApp group chats.
+const whatsappGroupSuffix = "@g.us"
+
+// isGroupMessage reports whether an inbound message was sent to a group chat,
+// either because the bridge flagged it or because the chat is a group JID.
+func isGroupMessage(msg *IncomingMessage) bool {
+	return msg.IsGroup || strings.HasSuffix(msg.Chat, whatsappGroupSuffix)
+}
+
+// jidUser returns the user part of a JID ("+1234@s.whatsapp.net:3" -> "1234").
+func jidUser(jid string) string {
+	if idx := strings.Index(jid, "@"); idx >= 0 {
+		jid = jid[:idx]
+	}
+	if idx := strings.Index(jid, ":"); idx >= 0 {
+		jid = jid[:idx]
+	}
+	return strings.TrimPrefix(jid, "+")
+}
+
+// groupAllowed checks the group allowlist and the per-group sender allowlist.
+func (c *WhatsAppChannel) groupAllowed(groupID, senderID string) bool {
+	if len(c.config.AllowGroups) > 0 && !containsJID(c.config.AllowGroups, groupID) {
+		return false
+	}
+	if senders := c.config.GroupAllowFrom[groupID]; len(senders) > 0 {
+		return containsJID(senders, senderID)
+	}
+	return true
+}
+
+// isMentioned reports whether the bot was mentioned in a group message. The
+// bridge-provided mention list is preferred; the text is checked as a fallback
+// for bridges that do not resolve mentions.
+func (c *WhatsAppChannel) isMentioned(msg *IncomingMessage) bool {
+	self := jidUser(c.config.SelfID)
+	if self == "" {
+		return false
+	}
+	for _, jid := range msg.Mentions {
+		if jidUser(jid) == self {
+			return true
+		}
+	}
+	return strings.Contains(msg.Content, "@"+self)
+}
+
+// stripSelfMention removes the bot's @mention from group message text.
+func (c *WhatsAppChannel) stripSelfMention(content string) string {
+	self := jidUser(c.config.SelfID)
+	if self == "" {
+		return content
+	}
+	return strings.TrimSpace(strings.ReplaceAll(content, "@"+self, ""))
+}
+
+// addGroupMetadata exposes group details in inbound message metadata.
+func addGroupMetadata(metadata map[string]string, msg *IncomingMessage, mentioned bool) {
+	metadata["is_group"] = "true"
+	metadata["group_id"] = msg.Chat
+	metadata["mentioned"] = strconv.FormatBool(mentioned)
+	if msg.Group == nil {
+		return
+	}
+	if msg.Group.Subject != "" {
+		metadata["group_subject"] = msg.Group.Subject
+	}
+	if len(msg.Group.Participants) > 0 {
+		metadata["group_participants"] = strings.Join(msg.Group.Participants, ",")
+		metadata["group_size"] = strconv.Itoa(len(msg.Group.Participants))
+	}
+}
+
+func containsJID(list []string, jid string) bool {
+	user := jidUser(jid)
+	for _, entry := range list {
+		if entry == jid || jidUser(entry) == user {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestWhatsAppGroupDetection(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  IncomingMessage
+		want bool
+	}{
+		{"direct chat", IncomingMessage{From: "+1234", Chat: "1234@s.whatsapp.net"}, false},
+		{"group JID", IncomingMessage{From: "+1234", Chat: "120363041234@g.us"}, true},
+		{"bridge flag", IncomingMessage{From: "+1234", Chat: "family", IsGroup: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isGroupMessage(&tt.msg); got != tt.want {
+				t.Errorf("isGroupMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhatsAppGroupAllowlists(t *testing.T) {
+	c := &WhatsAppChannel{config: config.WhatsAppConfig{
+		AllowGroups: config.FlexibleStringSlice{"111@g.us", "222@g.us"},
+		GroupAllowFrom: map[string]config.FlexibleStringSlice{
+			"222@g.us": {"+15550001"},
+		},
+	}}
+
+	tests := []struct {
+		group, sender string
+		want          bool
+	}{
+		{"111@g.us", "+15559999", true},
+		{"222@g.us", "15550001@s.whatsapp.net", true},
+		{"222@g.us", "+15559999", false},
+		{"333@g.us", "+15550001", false},
+	}
+	for _, tt := range tests {
+		if got := c.groupAllowed(tt.group, tt.sender); got != tt.want {
+			t.Errorf("groupAllowed(%q, %q) = %v, want %v", tt.group, tt.sender, got, tt.want)
+		}
+	}
+}
+
+func TestWhatsAppMentionDetection(t *testing.T) {
+	c := &WhatsAppChannel{config: config.WhatsAppConfig{SelfID: "+15550100"}}
+
+	viaList := &IncomingMessage{Content: "@Bot help", Mentions: []string{"15550100@s.whatsapp.net"}}
+	if !c.isMentioned(viaList) {
+		t.Error("expected mention from bridge mention list")
+	}
+
+	viaText := &IncomingMessage{Content: "@15550100 what's the weather?"}
+	if !c.isMentioned(viaText) {
+		t.Error("expected mention from message text")
+	}
+	if got := c.stripSelfMention(viaText.Content); got != "what's the weather?" {
+		t.Errorf("stripSelfMention() = %q", got)
+	}
+
+	if c.isMentioned(&IncomingMessage{Content: "hello everyone", Mentions: []string{"15550999@s.whatsapp.net"}}) {
+		t.Error("did not expect a mention")
+	}
+}
+
+func TestWhatsAppGroupMetadataValidation(t *testing.T) {
+	validator := NewMessageValidator("")
+
+	valid := []byte(`{"type":"message","from":"+1234","chat":"120363@g.us","content":"hi",
+		"group":{"subject":"Ops\u0007 team","participants":["+1234","+5678"]},"mentions":["+5678"]}`)
+	msg, err := validator.ValidateIncoming(valid)
+	if err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if msg.Group.Subject != "Ops team" {
+		t.Errorf("expected sanitized subject, got %q", msg.Group.Subject)
+	}
+
+	metadata := map[string]string{}
+	addGroupMetadata(metadata, msg, true)
+	if metadata["group_subject"] != "Ops team" || metadata["group_participants"] != "+1234,+5678" || metadata["mentioned"] != "true" {
+		t.Errorf("unexpected metadata: %v", metadata)
+	}
+
+	invalid := []byte(`{"type":"message","from":"+1234","chat":"120363@g.us","content":"hi","group":{"participants":[""]}}`)
+	if _, err := validator.ValidateIncoming(invalid); err == nil {
+		t.Error("expected empty participant to be rejected")
+	}
+}
@@ -0,0 +1,184 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// Bridge protocol versions. Version 1 is the protocol of bridges that
+// predate the hello handshake; version 2 adds it along with quick replies.
+const (
+	BridgeProtocolVersion    = 2 // Version spoken by this channel
+	MinBridgeProtocolVersion = 1 // Oldest version still accepted
+)
+
+// Bridge capabilities advertised in hello messages
+const (
+	CapabilityMedia     = "media"     // Attachments
+	CapabilityReceipts  = "receipts"  // Read receipts
+	CapabilityGroups    = "groups"    // Group chats
+	CapabilityReactions = "reactions" // Emoji reactions
+	CapabilityTyping    = "typing"    // Typing indicators
+	CapabilityButtons   = "buttons"   // Quick reply buttons
+	CapabilityContacts  = "contacts"  // Contact cards
+)
+
+// MaxCapabilities and MaxCapabilityLength bound the capabilities a bridge may advertise
+const (
+	MaxCapabilities     = 32
+	MaxCapabilityLength = 32
+)
+
+// channelCapabilities are the capabilities this channel offers in its hello
+var channelCapabilities = []string{
+	CapabilityMedia, CapabilityReceipts, CapabilityGroups,
+	CapabilityReactions, CapabilityTyping, CapabilityButtons,
+	CapabilityContacts,
+}
+
+// legacyCapabilities are assumed of bridges that have not answered the
+// hello: everything that worked before the handshake existed
+var legacyCapabilities = []string{
+	CapabilityMedia, CapabilityReceipts, CapabilityGroups,
+	CapabilityReactions, CapabilityTyping,
+}
+
+// bridgeProtocol is what was negotiated with the connected bridge
+type bridgeProtocol struct {
+	version      int
+	capabilities map[string]bool
+}
+
+// newBridgeProtocol returns the protocol for version with the given capabilities
+func newBridgeProtocol(version int, capabilities []string) *bridgeProtocol {
+	p := &bridgeProtocol{version: version, capabilities: make(map[string]bool, len(capabilities))}
+	for _, capability := range capabilities {
+		p.capabilities[capability] = true
+	}
+	return p
+}
+
+// legacyBridgeProtocol is the protocol of a bridge that does not speak hello
+var legacyBridgeProtocol = newBridgeProtocol(MinBridgeProtocolVersion, legacyCapabilities)
+
+// negotiateProtocol picks the highest version both sides speak and the
+// capabilities both support, or fails if the bridge's range of versions
+// does not overlap ours
+func negotiateProtocol(hello *IncomingMessage) (*bridgeProtocol, error) {
+	minVersion := hello.MinVersion
+	if minVersion == 0 {
+		minVersion = hello.Version
+	}
+	if hello.Version < MinBridgeProtocolVersion {
+		return nil, fmt.Errorf("bridge protocol version %d is older than the oldest supported version %d",
+			hello.Version, MinBridgeProtocolVersion)
+	}
+	if minVersion > BridgeProtocolVersion {
+		return nil, fmt.Errorf("bridge requires protocol version %d or newer, this channel speaks version %d",
+			minVersion, BridgeProtocolVersion)
+	}
+
+	var shared []string
+	for _, capability := range hello.Capabilities {
+		if slices.Contains(channelCapabilities, capability) {
+			shared = append(shared, capability)
+		}
+	}
+	return newBridgeProtocol(min(hello.Version, BridgeProtocolVersion), shared), nil
+}
+
+// helloMessage is the hello the channel sends after connecting
+func helloMessage() *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:         MessageTypeHello,
+		Version:      BridgeProtocolVersion,
+		MinVersion:   MinBridgeProtocolVersion,
+		Capabilities: channelCapabilities,
+	}
+}
+
+// bridgeSupports reports whether the bridge supports capability. Until the
+// bridge answers the hello, the legacy capabilities are assumed.
+func (c *WhatsAppChannel) bridgeSupports(capability string) bool {
+	c.connMu.RLock()
+	protocol := c.protocol
+	c.connMu.RUnlock()
+
+	if protocol == nil {
+		protocol = legacyBridgeProtocol
+	}
+	return protocol.capabilities[capability]
+}
+
+// ProtocolVersion returns the protocol version negotiated with the bridge
+func (c *WhatsAppChannel) ProtocolVersion() int {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+
+	if c.protocol == nil {
+		return legacyBridgeProtocol.version
+	}
+	return c.protocol.version
+}
+
+// requireCapability fails if the bridge does not support capability
+func (c *WhatsAppChannel) requireCapability(capability string) error {
+	if !c.bridgeSupports(capability) {
+		return fmt.Errorf("whatsapp bridge does not support %s", capability)
+	}
+	return nil
+}
+
+// handleHello adopts the protocol announced by the bridge and completes the
+// key exchange. A bridge whose versions do not overlap ours, or that cannot
+// encrypt when encryption is required, is refused: the connection is closed
+// and not retried, since reconnecting cannot fix it.
+func (c *WhatsAppChannel) handleHello(msg *IncomingMessage) {
+	reason := "unsupported protocol version"
+	protocol, err := negotiateProtocol(msg)
+	var bc *bridgeCipher
+	if err == nil {
+		reason = "payload encryption unavailable"
+		bc, err = c.negotiateEncryption(msg)
+	}
+
+	c.connMu.Lock()
+	conn, writer := c.conn, c.writer
+	if err != nil {
+		c.refused = err
+	} else {
+		c.protocol = protocol
+		c.cipher = bc
+	}
+	c.connMu.Unlock()
+
+	if err != nil {
+		log.Printf("Refusing incompatible WhatsApp bridge: %v", err)
+		if conn != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), controlWriteTimeout)
+			defer cancel()
+			writer.Write(ctx, websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseProtocolError, reason))
+			c.dropConn(conn)
+		}
+		return
+	}
+
+	log.Printf("WhatsApp bridge speaks protocol version %d with capabilities %v", protocol.version, msg.Capabilities)
+	if bc != nil {
+		log.Printf("WhatsApp bridge payloads are encrypted")
+	} else if c.encryption == EncryptionPrefer {
+		log.Printf("WhatsApp bridge does not support payload encryption, continuing in plaintext")
+	}
+}
+
+// bridgeRefusal returns why the bridge was refused, or nil
+func (c *WhatsAppChannel) bridgeRefusal() error {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.refused
+}
@@ -0,0 +1,191 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	tests := []struct {
+		name        string
+		hello       IncomingMessage
+		wantVersion int
+		wantErr     bool
+	}{
+		{"same version", IncomingMessage{Version: 2, MinVersion: 1}, 2, false},
+		{"older bridge", IncomingMessage{Version: 1}, 1, false},
+		{"newer bridge", IncomingMessage{Version: 5, MinVersion: 2}, 2, false},
+		{"bridge requires newer", IncomingMessage{Version: 5, MinVersion: 3}, 0, true},
+		{"only newer without range", IncomingMessage{Version: 3}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protocol, err := negotiateProtocol(&tt.hello)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("negotiateProtocol() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && protocol.version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", protocol.version, tt.wantVersion)
+			}
+		})
+	}
+
+	protocol, _ := negotiateProtocol(&IncomingMessage{Version: 2, Capabilities: []string{CapabilityMedia, "video_calls"}})
+	if !protocol.capabilities[CapabilityMedia] || protocol.capabilities["video_calls"] || protocol.capabilities[CapabilityReactions] {
+		t.Errorf("unexpected capabilities %v", protocol.capabilities)
+	}
+}
+
+func TestValidateIncomingHello(t *testing.T) {
+	validator := NewMessageValidator("")
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"valid", `{"type":"hello","version":2,"min_version":1,"capabilities":["media","groups"]}`, false},
+		{"missing version", `{"type":"hello","capabilities":["media"]}`, true},
+		{"min above version", `{"type":"hello","version":2,"min_version":3}`, true},
+		{"empty capability", `{"type":"hello","version":2,"capabilities":[""]}`, true},
+		{"long capability", `{"type":"hello","version":2,"capabilities":["` + strings.Repeat("x", MaxCapabilityLength+1) + `"]}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validator.ValidateIncoming([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateIncoming() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := validator.ValidateOutgoing(helloMessage()); err != nil {
+		t.Errorf("hello should validate: %v", err)
+	}
+}
+
+// helloBridge starts a bridge that answers the channel's hello with reply
+// and forwards every other message it receives to received
+func helloBridge(t *testing.T, reply map[string]interface{}, received chan<- map[string]interface{}) string {
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg map[string]interface{}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			if msg["type"] == MessageTypeHello {
+				if msg["version"] != float64(BridgeProtocolVersion) {
+					t.Errorf("hello version = %v, want %d", msg["version"], BridgeProtocolVersion)
+				}
+				conn.WriteJSON(reply)
+				continue
+			}
+			received <- msg
+		}
+	}))
+	t.Cleanup(server.Close)
+	return strings.Replace(server.URL, "https://", "wss://", 1)
+}
+
+func TestBridgeHandshake(t *testing.T) {
+	received := make(chan map[string]interface{}, 10)
+	url := helloBridge(t, map[string]interface{}{
+		"type":         "hello",
+		"version":      BridgeProtocolVersion,
+		"capabilities": []string{CapabilityMedia, CapabilityGroups},
+	}, received)
+
+	channel, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: url}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewWhatsAppChannel: %v", err)
+	}
+	ctx := t.Context()
+	if err := channel.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer channel.Stop(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for channel.bridgeSupports(CapabilityReactions) {
+		if time.Now().After(deadline) {
+			t.Fatal("hello answer was not applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := channel.ProtocolVersion(); got != BridgeProtocolVersion {
+		t.Errorf("ProtocolVersion() = %d, want %d", got, BridgeProtocolVersion)
+	}
+	if err := channel.Send(ctx, bus.OutboundMessage{ChatID: "+1234567890", ReplyTo: "m1", Reaction: "👍"}); err == nil {
+		t.Error("reactions should fail on a bridge without them")
+	}
+	if err := channel.MarkRead(ctx, "m1"); err == nil {
+		t.Error("read receipts should fail on a bridge without them")
+	}
+
+	if err := channel.Send(ctx, bus.OutboundMessage{ChatID: "+1234567890", Content: "hi"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case msg := <-received:
+		if msg["content"] != "hi" {
+			t.Errorf("unexpected message %v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received by the bridge")
+	}
+}
+
+func TestBridgeHandshakeRefused(t *testing.T) {
+	url := helloBridge(t, map[string]interface{}{
+		"type":        "hello",
+		"version":     BridgeProtocolVersion + 2,
+		"min_version": BridgeProtocolVersion + 1,
+	}, make(chan map[string]interface{}, 10))
+
+	msgBus := bus.NewMessageBus()
+	channel, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: url}, msgBus)
+	if err != nil {
+		t.Fatalf("NewWhatsAppChannel: %v", err)
+	}
+	ctx := t.Context()
+	if err := channel.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer channel.Stop(ctx)
+
+	consumeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(consumeCtx)
+	if !ok {
+		t.Fatal("expected the channel to give up on an incompatible bridge")
+	}
+	if msg.Metadata["event"] != EventChannelGaveUp || !strings.Contains(msg.Metadata["error"], "protocol version") {
+		t.Errorf("unexpected event %+v", msg)
+	}
+	if channel.IsRunning() {
+		t.Error("channel should stop after refusing the bridge")
+	}
+}
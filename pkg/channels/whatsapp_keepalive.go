@@ -0,0 +1,136 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Keepalive defaults for the bridge connection
+const (
+	DefaultPingInterval   = 30 * time.Second
+	DefaultPongTimeout    = 10 * time.Second
+	DefaultReadTimeout    = 60 * time.Second
+	DefaultMaxMissedPongs = 3
+
+	// controlWriteTimeout bounds how long writing a ping frame may block
+	controlWriteTimeout = 5 * time.Second
+)
+
+// keepaliveSettings holds the validated keepalive timings of a bridge connection
+type keepaliveSettings struct {
+	pingInterval   time.Duration // Intervalo entre pings
+	pongTimeout    time.Duration // Tiempo máximo de espera de un pong
+	readTimeout    time.Duration // Plazo de lectura, renovado con cada mensaje o pong
+	maxMissedPongs int           // Pongs perdidos antes de forzar la reconexión
+}
+
+// newKeepaliveSettings applies defaults to unset values and rejects
+// combinations that would make the connection flap.
+func newKeepaliveSettings(cfg config.WhatsAppConfig) (keepaliveSettings, error) {
+	ka := keepaliveSettings{
+		pingInterval:   time.Duration(cfg.PingIntervalSeconds) * time.Second,
+		pongTimeout:    time.Duration(cfg.PongTimeoutSeconds) * time.Second,
+		readTimeout:    time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		maxMissedPongs: cfg.MaxMissedPongs,
+	}
+
+	if ka.pingInterval < 0 || ka.pongTimeout < 0 || ka.readTimeout < 0 || ka.maxMissedPongs < 0 {
+		return ka, fmt.Errorf("keepalive settings must not be negative")
+	}
+	if ka.pingInterval == 0 {
+		ka.pingInterval = DefaultPingInterval
+	}
+	if ka.pongTimeout == 0 {
+		ka.pongTimeout = DefaultPongTimeout
+	}
+	if ka.readTimeout == 0 {
+		ka.readTimeout = DefaultReadTimeout
+	}
+	if ka.maxMissedPongs == 0 {
+		ka.maxMissedPongs = DefaultMaxMissedPongs
+	}
+
+	if ka.pingInterval < time.Second {
+		return ka, fmt.Errorf("ping interval must be at least 1s")
+	}
+	if ka.pongTimeout >= ka.pingInterval {
+		return ka, fmt.Errorf("pong timeout (%s) must be shorter than the ping interval (%s)", ka.pongTimeout, ka.pingInterval)
+	}
+	if ka.readTimeout <= ka.pingInterval {
+		return ka, fmt.Errorf("read timeout (%s) must be longer than the ping interval (%s)", ka.readTimeout, ka.pingInterval)
+	}
+	return ka, nil
+}
+
+// pongLate reports whether the pong for the last ping is missing or arrived
+// after the pong timeout.
+func (ka keepaliveSettings) pongLate(lastPing, lastPong time.Time) bool {
+	if lastPing.IsZero() {
+		return false
+	}
+	return lastPong.Before(lastPing) || lastPong.Sub(lastPing) > ka.pongTimeout
+}
+
+// recordPong marks the connection alive and extends its read deadline
+func (c *WhatsAppChannel) recordPong(conn *websocket.Conn) {
+	c.connMu.Lock()
+	c.lastPong = time.Now()
+	c.connMu.Unlock()
+	conn.SetReadDeadline(time.Now().Add(c.keepalive.readTimeout))
+}
+
+// pingLoop sends websocket pings and forces a reconnection once too many
+// pongs have been missed in a row.
+func (c *WhatsAppChannel) pingLoop(writer *wsWriter) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.keepalive.pingInterval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-writer.done:
+			return
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		c.connMu.RLock()
+		late := c.keepalive.pongLate(c.lastPing, c.lastPong)
+		c.connMu.RUnlock()
+
+		if late {
+			missed++
+			if missed >= c.keepalive.maxMissedPongs {
+				log.Printf("WhatsApp bridge missed %d pongs, forcing reconnection", missed)
+				writer.conn.Close()
+				return
+			}
+			c.setHealth(StateDegraded, fmt.Sprintf("missed %d pongs", missed))
+		} else if missed > 0 {
+			missed = 0
+			c.setHealth(StateConnected, "")
+		}
+
+		c.connMu.Lock()
+		c.lastPing = time.Now()
+		c.connMu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), controlWriteTimeout)
+		err := writer.Write(ctx, websocket.PingMessage, nil)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to send WhatsApp bridge ping: %v", err)
+			writer.conn.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package channels
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestMain(m *testing.M) {
+	// The bridge tests run against httptest TLS servers with self-signed certificates
+	bridgeTLSConfig.InsecureSkipVerify = true
+	os.Exit(m.Run())
+}
+
+func TestKeepaliveSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.WhatsAppConfig
+		want    keepaliveSettings
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: keepaliveSettings{30 * time.Second, 10 * time.Second, 60 * time.Second, 3},
+		},
+		{
+			name: "custom",
+			cfg:  config.WhatsAppConfig{PingIntervalSeconds: 10, PongTimeoutSeconds: 5, ReadTimeoutSeconds: 25, MaxMissedPongs: 2},
+			want: keepaliveSettings{10 * time.Second, 5 * time.Second, 25 * time.Second, 2},
+		},
+		{name: "negative", cfg: config.WhatsAppConfig{MaxMissedPongs: -1}, wantErr: true},
+		{name: "pong timeout not below interval", cfg: config.WhatsAppConfig{PingIntervalSeconds: 10, PongTimeoutSeconds: 10, ReadTimeoutSeconds: 30}, wantErr: true},
+		{name: "read timeout not above interval", cfg: config.WhatsAppConfig{PingIntervalSeconds: 60}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newKeepaliveSettings(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newKeepaliveSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("newKeepaliveSettings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewWhatsAppChannel(config.WhatsAppConfig{PingIntervalSeconds: 60}, bus.NewMessageBus()); err == nil {
+		t.Error("expected channel creation to reject invalid keepalive settings")
+	}
+}
+
+func TestPongLate(t *testing.T) {
+	ka := keepaliveSettings{pongTimeout: time.Second}
+	ping := time.Now()
+
+	if ka.pongLate(time.Time{}, time.Time{}) {
+		t.Error("no ping sent yet should not count as missed")
+	}
+	if ka.pongLate(ping, ping.Add(500*time.Millisecond)) {
+		t.Error("pong within timeout should not count as missed")
+	}
+	if !ka.pongLate(ping, ping.Add(-time.Second)) {
+		t.Error("missing pong should count as missed")
+	}
+	if !ka.pongLate(ping, ping.Add(2*time.Second)) {
+		t.Error("late pong should count as missed")
+	}
+}
+
+func TestKeepaliveForcesReconnect(t *testing.T) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	connections := make(chan struct{}, 10)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		connections <- struct{}{}
+
+		// Swallow pings: the client never sees a pong
+		conn.SetPingHandler(func(string) error { return nil })
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	channel, err := NewWhatsAppChannel(config.WhatsAppConfig{
+		BridgeURL:           strings.Replace(server.URL, "https://", "wss://", 1),
+		PingIntervalSeconds: 2,
+		PongTimeoutSeconds:  1,
+		ReadTimeoutSeconds:  30,
+		MaxMissedPongs:      2,
+	}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewWhatsAppChannel: %v", err)
+	}
+
+	ctx := t.Context()
+	if err := channel.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer channel.Stop(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-connections:
+		case <-time.After(15 * time.Second):
+			t.Fatalf("expected connection %d, liveness check did not force a reconnect", i+1)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package channels
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// DefaultHMACKeyEnv is the environment variable read by EnvKeyProvider when no name is given.
+const DefaultHMACKeyEnv = "PICOCLAW_WHATSAPP_HMAC_KEYS"
+
+// Missing-key policies for the WhatsApp bridge validator.
+const (
+	// MissingKeyWarn logs a warning and exchanges unsigned messages.
+	MissingKeyWarn = "warn"
+	// MissingKeyFail rejects every message until a key is available.
+	MissingKeyFail = "fail"
+)
+
+// HMACKey is a signing secret together with the identifier sent in the
+// message's key_id field.
+type HMACKey struct {
+	ID     string
+	Secret []byte
+}
+
+// KeyProvider supplies the HMAC keys used with the WhatsApp bridge. The first
+// key signs outgoing messages; every key is accepted when verifying, so a new
+// key can be rolled out before the old one is retired.
+type KeyProvider interface {
+	Keys() ([]HMACKey, error)
+}
+
+// StaticKeyProvider serves a fixed set of keys, e.g. from config.json.
+type StaticKeyProvider struct {
+	keys []HMACKey
+}
+
+// NewStaticKeyProvider creates a provider from "id:secret" entries.
+func NewStaticKeyProvider(entries []string) (*StaticKeyProvider, error) {
+	keys, err := parseHMACKeys(entries)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticKeyProvider{keys: keys}, nil
+}
+
+func (p *StaticKeyProvider) Keys() ([]HMACKey, error) {
+	return p.keys, nil
+}
+
+// EnvKeyProvider reads comma-separated "id:secret" entries from an environment variable.
+type EnvKeyProvider struct {
+	Var string
+}
+
+func (p *EnvKeyProvider) Keys() ([]HMACKey, error) {
+	name := p.Var
+	if name == "" {
+		name = DefaultHMACKeyEnv
+	}
+	return parseHMACKeys(strings.Split(os.Getenv(name), ","))
+}
+
+// FileKeyProvider reads "id:secret" entries, one per line, from a file. The
+// file is re-read when it changes, so keys can be rotated without a restart.
+type FileKeyProvider struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	keys    []HMACKey
+}
+
+// NewFileKeyProvider creates a provider backed by the given key file.
+func NewFileKeyProvider(path string) *FileKeyProvider {
+	return &FileKeyProvider{path: path}
+}
+
+func (p *FileKeyProvider) Keys() ([]HMACKey, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat key file: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && info.ModTime().Equal(p.modTime) {
+		return p.keys, nil
+	}
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	keys, err := parseHMACKeys(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	p.keys = keys
+	p.modTime = info.ModTime()
+	return keys, nil
+}
+
+// parseHMACKeys parses "id:secret" entries. An entry without a colon is a
+// legacy key with an empty ID.
+func parseHMACKeys(entries []string) ([]HMACKey, error) {
+	keys := make([]HMACKey, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret := "", entry
+		if idx := strings.Index(entry, ":"); idx >= 0 {
+			id, secret = entry[:idx], entry[idx+1:]
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("hmac key %q has an empty secret", id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate hmac key id %q", id)
+		}
+		seen[id] = true
+		keys = append(keys, HMACKey{ID: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+// newWhatsAppKeyProvider selects the key source configured for the channel:
+// a key file, then an environment variable, then keys inlined in the config.
+func newWhatsAppKeyProvider(cfg config.WhatsAppConfig) (KeyProvider, error) {
+	switch {
+	case cfg.HMACKeyFile != "":
+		return NewFileKeyProvider(cfg.HMACKeyFile), nil
+	case cfg.HMACKeyEnv != "":
+		return &EnvKeyProvider{Var: cfg.HMACKeyEnv}, nil
+	default:
+		return NewStaticKeyProvider(cfg.HMACKeys)
+	}
+}
@@ -0,0 +1,116 @@
+package channels
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseHMACKeys(t *testing.T) {
+	keys, err := parseHMACKeys([]string{"k2:new-secret", " k1:old:secret ", ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != "k2" || string(keys[1].Secret) != "old:secret" {
+		t.Errorf("unexpected keys: %+v", keys)
+	}
+
+	if keys, _ := parseHMACKeys([]string{"legacy"}); len(keys) != 1 || keys[0].ID != "" {
+		t.Errorf("expected legacy key without ID, got %+v", keys)
+	}
+
+	for _, bad := range [][]string{{"k1:"}, {"k1:a", "k1:b"}} {
+		if _, err := parseHMACKeys(bad); err == nil {
+			t.Errorf("expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestEnvKeyProvider(t *testing.T) {
+	t.Setenv("TEST_WHATSAPP_KEYS", "k1:one,k2:two")
+
+	keys, err := (&EnvKeyProvider{Var: "TEST_WHATSAPP_KEYS"}).Keys()
+	if err != nil || len(keys) != 2 || keys[1].ID != "k2" {
+		t.Errorf("unexpected keys: %+v (err=%v)", keys, err)
+	}
+}
+
+func TestFileKeyProviderReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte("# active key first\nk1:one\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewFileKeyProvider(path)
+	keys, err := provider.Keys()
+	if err != nil || len(keys) != 1 || keys[0].ID != "k1" {
+		t.Fatalf("unexpected keys: %+v (err=%v)", keys, err)
+	}
+
+	if err := os.WriteFile(path, []byte("k2:two\nk1:one\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+
+	keys, err = provider.Keys()
+	if err != nil || len(keys) != 2 || keys[0].ID != "k2" {
+		t.Errorf("expected rotated keys, got %+v (err=%v)", keys, err)
+	}
+}
+
+func TestMessageValidatorKeyRotation(t *testing.T) {
+	oldKeys, _ := NewStaticKeyProvider([]string{"k1:one"})
+	newKeys, _ := NewStaticKeyProvider([]string{"k2:two", "k1:one"})
+	sender := NewMessageValidatorWithKeys(oldKeys, MissingKeyFail)
+	receiver := NewMessageValidatorWithKeys(newKeys, MissingKeyFail)
+
+	// A bridge still signing with the retiring key is accepted
+	incoming := &IncomingMessage{Type: MessageTypeMessage, From: "+1234", Content: "hi", KeyID: "k1"}
+	data, _ := json.Marshal(incoming)
+	incoming.Signature = computeHMAC([]byte("one"), data)
+	if err := receiver.VerifySignature(incoming); err != nil {
+		t.Errorf("expected message signed with old key to verify: %v", err)
+	}
+
+	incoming.KeyID = "k9"
+	if err := receiver.VerifySignature(incoming); err == nil {
+		t.Error("expected unknown key ID to be rejected")
+	}
+
+	// Outgoing messages are signed with the first (active) key
+	outgoing := &OutgoingMessage{Type: MessageTypeMessage, To: "+1234", Content: "hi"}
+	if err := receiver.ValidateOutgoing(outgoing); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if outgoing.KeyID != "k2" {
+		t.Errorf("expected active key k2, got %q", outgoing.KeyID)
+	}
+
+	if err := sender.ValidateOutgoing(&OutgoingMessage{Type: MessageTypeMessage, To: "+1234", Content: "hi"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMessageValidatorMissingKeyPolicy(t *testing.T) {
+	empty := &StaticKeyProvider{}
+
+	failClosed := NewMessageValidatorWithKeys(empty, MissingKeyFail)
+	if err := failClosed.ValidateOutgoing(&OutgoingMessage{Type: MessageTypeMessage, To: "+1234", Content: "hi"}); err == nil {
+		t.Error("expected fail-closed validator to reject messages without a key")
+	}
+	if err := failClosed.VerifySignature(&IncomingMessage{Type: MessageTypeMessage, From: "+1234"}); err == nil {
+		t.Error("expected fail-closed validator to reject unverifiable messages")
+	}
+
+	warn := NewMessageValidatorWithKeys(empty, "")
+	msg := &OutgoingMessage{Type: MessageTypeMessage, To: "+1234", Content: "hi"}
+	if err := warn.ValidateOutgoing(msg); err != nil {
+		t.Errorf("expected warn validator to pass messages: %v", err)
+	}
+	if msg.Signature != "" {
+		t.Error("expected unsigned message without a key")
+	}
+}
@@ -0,0 +1,197 @@
+package channels
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+// mimeTypePrefixes are the attachment types the bridge can send
+var mimeTypePrefixes = []string{"image/", "video/", "audio/", "application/pdf", "text/plain"}
+
+func validateMimeType(mimeType string) error {
+	lower := strings.ToLower(mimeType)
+	for _, prefix := range mimeTypePrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported media type %q", mimeType)
+}
+
+// outgoingMessages converts an outbound message into the bridge messages
+// that carry it: the content, split to fit MaxContentLength, then one message
+// per attachment. Caption text beyond the first chunk follows its attachment
+// as plain messages. Only the first message quotes msg.ReplyTo.
+func outgoingMessages(msg bus.OutboundMessage) ([]*OutgoingMessage, error) {
+	var out []*OutgoingMessage
+	text := func(content string) {
+		out = append(out, &OutgoingMessage{Type: MessageTypeMessage, To: msg.ChatID, Content: content})
+	}
+
+	if msg.Content != "" || (len(msg.Attachments) == 0 && msg.Contact == nil) {
+		for _, chunk := range splitContent(msg.Content) {
+			text(chunk)
+		}
+		// Quick replies go with the end of the text they answer
+		if msg.Card != nil && len(msg.Card.Buttons) > 0 {
+			out[len(out)-1].Buttons = quickReplies(msg.Card.Buttons)
+		}
+	}
+
+	for i, att := range msg.Attachments {
+		ref := att.Path
+		if ref == "" {
+			ref = att.URL
+		}
+		if ref == "" {
+			return nil, fmt.Errorf("attachment %d has neither path nor url", i+1)
+		}
+
+		captions := splitContent(att.Caption)
+		out = append(out, &OutgoingMessage{
+			Type:     MessageTypeMessage,
+			To:       msg.ChatID,
+			Content:  captions[0],
+			Media:    []string{ref},
+			MimeType: att.MimeType,
+		})
+		for _, chunk := range captions[1:] {
+			text(chunk)
+		}
+	}
+
+	if msg.Contact != nil {
+		out = append(out, &OutgoingMessage{
+			Type:    MessageTypeContact,
+			To:      msg.ChatID,
+			Contact: &ContactCard{VCard: contactVCard(msg.Contact)},
+		})
+	}
+
+	if msg.ReplyTo != "" {
+		out[0].Context = &MessageContext{MessageID: msg.ReplyTo}
+	}
+	return out, nil
+}
+
+// attachmentsAsText replaces the attachments of msg with text, for bridges
+// that cannot send media: each caption, followed by the URL of remote
+// attachments. Local files cannot be shared this way and are dropped.
+func attachmentsAsText(msg bus.OutboundMessage) bus.OutboundMessage {
+	var parts []string
+	if strings.TrimSpace(msg.Content) != "" {
+		parts = append(parts, msg.Content)
+	}
+	for _, att := range msg.Attachments {
+		var lines []string
+		if att.Caption != "" {
+			lines = append(lines, att.Caption)
+		}
+		if att.URL != "" {
+			lines = append(lines, att.URL)
+		}
+		if len(lines) > 0 {
+			parts = append(parts, strings.Join(lines, "\n"))
+		}
+	}
+	msg.Content = strings.Join(parts, "\n\n")
+	msg.Attachments = nil
+	return msg
+}
+
+// quickReplyPrompt is the text of quick replies sent without content, which
+// WhatsApp requires
+const quickReplyPrompt = "Choose an option:"
+
+// splitQuickReplies moves the reply buttons of card that WhatsApp can show
+// as quick replies out of a copy of it. Cards with more reply buttons than
+// fit keep them all as text.
+func splitQuickReplies(card *bus.Card) (*bus.Card, []bus.CardButton) {
+	rest := *card
+	rest.Buttons = nil
+	var quick []bus.CardButton
+	for _, b := range card.Buttons {
+		fits := b.URL == "" &&
+			utf8.RuneCountInString(b.Label) <= MaxQuickReplyTitleRunes &&
+			len(cardButtonReply(b)) <= MaxQuickReplyIDLength
+		if fits {
+			quick = append(quick, b)
+		} else {
+			rest.Buttons = append(rest.Buttons, b)
+		}
+	}
+	if len(quick) > MaxQuickReplies {
+		return card, nil
+	}
+	return &rest, quick
+}
+
+// quickReplies converts card buttons to bridge quick replies
+func quickReplies(buttons []bus.CardButton) []QuickReply {
+	replies := make([]QuickReply, len(buttons))
+	for i, b := range buttons {
+		replies[i] = QuickReply{ID: cardButtonReply(b), Title: b.Label}
+	}
+	return replies
+}
+
+// splitContent splits content into parts the validator accepts. It always
+// returns at least one (possibly empty) part.
+func splitContent(content string) []string {
+	return splitLongMessage(content, MaxContentLength)
+}
+
+// formatOutbound converts the Markdown of the content and captions of msg to
+// the configured markup, unless msg is already formatted. A card is sent as
+// text with its image attached; over the bridge, its reply buttons become
+// quick replies when they fit, and are left on msg.Card.
+func (c *WhatsAppChannel) formatOutbound(msg bus.OutboundMessage) bus.OutboundMessage {
+	if msg.Contact != nil && !c.useFacebookAPI && !c.bridgeSupports(CapabilityContacts) {
+		msg = emulateContact(msg, c.markup)
+	}
+	if card := msg.Card; card != nil {
+		var quick []bus.CardButton
+		if !c.useFacebookAPI && c.bridgeSupports(CapabilityButtons) {
+			msg.Card, quick = splitQuickReplies(card)
+		}
+		msg = flattenCard(msg, c.markup, false)
+		if len(quick) > 0 {
+			if strings.TrimSpace(msg.Content) == "" {
+				msg.Content = quickReplyPrompt
+			}
+			msg.Card = &bus.Card{Buttons: quick}
+		}
+		if card.ImageURL != "" {
+			attachments := make([]bus.Attachment, 0, len(msg.Attachments)+1)
+			attachments = append(attachments, bus.Attachment{URL: card.ImageURL})
+			msg.Attachments = append(attachments, msg.Attachments...)
+		}
+	}
+	if msg.Formatted {
+		return msg
+	}
+	msg.Content = format.Convert(msg.Content, c.markup)
+	if len(msg.Attachments) > 0 {
+		attachments := make([]bus.Attachment, len(msg.Attachments))
+		for i, att := range msg.Attachments {
+			att.Caption = format.Convert(att.Caption, c.markup)
+			attachments[i] = att
+		}
+		msg.Attachments = attachments
+	}
+	return msg
+}
+
+// Markup returns the markup the channel sends
+func (c *WhatsAppChannel) Markup() format.Style {
+	return c.markup
+}
+
+// RendersCards reports that the channel lays out cards itself
+func (c *WhatsAppChannel) RendersCards() bool {
+	return true
+}
@@ -0,0 +1,227 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+func TestOutgoingMessages(t *testing.T) {
+	longCaption := strings.Repeat("word ", MaxContentLength/5+100)
+
+	tests := []struct {
+		name      string
+		msg       bus.OutboundMessage
+		wantMedia []string // Media of each message, "" for text
+		wantErr   bool
+	}{
+		{
+			name:      "text only",
+			msg:       bus.OutboundMessage{ChatID: "+1234567890", Content: "hi", ReplyTo: "m1"},
+			wantMedia: []string{""},
+		},
+		{
+			name: "text and attachments",
+			msg: bus.OutboundMessage{ChatID: "+1234567890", Content: "see these", Attachments: []bus.Attachment{
+				{Path: "/tmp/chart.png", Caption: "chart", MimeType: "image/png"},
+				{URL: "https://example.com/report.pdf"},
+			}},
+			wantMedia: []string{"", "/tmp/chart.png", "https://example.com/report.pdf"},
+		},
+		{
+			name: "attachment only",
+			msg: bus.OutboundMessage{ChatID: "+1234567890", ReplyTo: "m1", Attachments: []bus.Attachment{
+				{Path: "/tmp/chart.png", URL: "https://example.com/ignored.png"},
+			}},
+			wantMedia: []string{"/tmp/chart.png"},
+		},
+		{
+			name: "long caption",
+			msg: bus.OutboundMessage{ChatID: "+1234567890", Attachments: []bus.Attachment{
+				{Path: "/tmp/chart.png", Caption: longCaption},
+			}},
+			wantMedia: []string{"/tmp/chart.png", ""},
+		},
+		{
+			name:    "attachment without source",
+			msg:     bus.OutboundMessage{ChatID: "+1234567890", Attachments: []bus.Attachment{{Caption: "lost"}}},
+			wantErr: true,
+		},
+	}
+
+	validator := NewMessageValidator("")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := outgoingMessages(tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outgoingMessages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.wantMedia) {
+				t.Fatalf("got %d messages, want %d", len(got), len(tt.wantMedia))
+			}
+
+			for i, out := range got {
+				media := strings.Join(out.Media, ",")
+				if media != tt.wantMedia[i] {
+					t.Errorf("message %d media = %q, want %q", i, media, tt.wantMedia[i])
+				}
+				if (out.Context != nil) != (i == 0 && tt.msg.ReplyTo != "") {
+					t.Errorf("message %d context = %+v, only the first should quote the reply", i, out.Context)
+				}
+				if err := validator.ValidateOutgoing(out); err != nil {
+					t.Errorf("message %d rejected by validator: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateOutgoingMedia(t *testing.T) {
+	validator := NewMessageValidator("")
+
+	tests := []struct {
+		name     string
+		media    string
+		mimeType string
+		wantErr  bool
+	}{
+		{"local file", "/tmp/photo.jpg", "image/jpeg", false},
+		{"url with query", "https://cdn.example.com/a/photo.jpg?sig=abc", "", false},
+		{"unsupported scheme", "file:///etc/photo.jpg", "", true},
+		{"traversal in url", "https://example.com/../photo.jpg", "", true},
+		{"bad extension", "https://example.com/run.sh", "", true},
+		{"unsupported mime type", "/tmp/photo.jpg", "application/x-sh", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &OutgoingMessage{Type: MessageTypeMessage, To: "+1234567890", Media: []string{tt.media}, MimeType: tt.mimeType}
+			if err := validator.ValidateOutgoing(msg); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOutgoing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := validator.ValidateOutgoing(&OutgoingMessage{Type: MessageTypeMessage, To: "+1234567890", MimeType: "image/png"}); err == nil {
+		t.Error("mime_type without media should be rejected")
+	}
+}
+
+func TestFormatOutbound(t *testing.T) {
+	c := &WhatsAppChannel{markup: format.WhatsApp}
+	attachments := []bus.Attachment{{Path: "/tmp/chart.png", Caption: "**Sales** by month"}}
+
+	got := c.formatOutbound(bus.OutboundMessage{Content: "## Report\n- *up* 5%", Attachments: attachments})
+	if got.Content != "*Report*\n• _up_ 5%" {
+		t.Errorf("content = %q", got.Content)
+	}
+	if got.Attachments[0].Caption != "*Sales* by month" {
+		t.Errorf("caption = %q", got.Attachments[0].Caption)
+	}
+	if attachments[0].Caption != "**Sales** by month" {
+		t.Error("formatOutbound modified the caller's attachments")
+	}
+
+	passthrough := &WhatsAppChannel{markup: format.Markdown}
+	if got := passthrough.formatOutbound(bus.OutboundMessage{Content: "**x**"}); got.Content != "**x**" {
+		t.Errorf("markdown format should leave content unchanged, got %q", got.Content)
+	}
+
+	card := &bus.Card{Title: "Chart", ImageURL: "https://example.com/chart.png"}
+	got = c.formatOutbound(bus.OutboundMessage{Content: "Done", Card: card, Attachments: attachments})
+	if got.Content != "Done\n\n*Chart*" || got.Card != nil {
+		t.Errorf("card content = %q", got.Content)
+	}
+	if len(got.Attachments) != 2 || got.Attachments[0].URL != card.ImageURL {
+		t.Errorf("card image should be attached first, got %+v", got.Attachments)
+	}
+}
+
+func TestAttachmentsAsText(t *testing.T) {
+	msg := attachmentsAsText(bus.OutboundMessage{Content: "see these", Attachments: []bus.Attachment{
+		{Path: "/tmp/chart.png", Caption: "chart"},
+		{URL: "https://example.com/report.pdf", Caption: "report"},
+		{Path: "/tmp/raw.bin"},
+	}})
+	if want := "see these\n\nchart\n\nreport\nhttps://example.com/report.pdf"; msg.Content != want || msg.Attachments != nil {
+		t.Errorf("attachmentsAsText() = %q (%d attachments), want %q", msg.Content, len(msg.Attachments), want)
+	}
+}
+
+func TestQuickReplies(t *testing.T) {
+	c := &WhatsAppChannel{markup: format.WhatsApp, protocol: newBridgeProtocol(2, []string{CapabilityButtons})}
+	card := &bus.Card{
+		Text: "Deploy **now**?",
+		Buttons: []bus.CardButton{
+			{Label: "Yes", Reply: "deploy"},
+			{Label: "No"},
+			{Label: "Docs", URL: "https://example.com/deploy"},
+		},
+	}
+
+	msg := c.formatOutbound(bus.OutboundMessage{ChatID: "+1234567890", Card: card})
+	if msg.Content != "Deploy *now*?\n\n• Docs (https://example.com/deploy)" {
+		t.Errorf("content = %q", msg.Content)
+	}
+	out, err := outgoingMessages(msg)
+	if err != nil {
+		t.Fatalf("outgoingMessages: %v", err)
+	}
+	want := []QuickReply{{ID: "deploy", Title: "Yes"}, {ID: "No", Title: "No"}}
+	if len(out) != 1 || len(out[0].Buttons) != 2 || out[0].Buttons[0] != want[0] || out[0].Buttons[1] != want[1] {
+		t.Fatalf("unexpected bridge messages %+v", out)
+	}
+	if err := NewMessageValidator("").ValidateOutgoing(out[0]); err != nil {
+		t.Errorf("quick replies should validate: %v", err)
+	}
+
+	// More reply buttons than WhatsApp shows stay in the text
+	many := &bus.Card{Buttons: []bus.CardButton{{Label: "1"}, {Label: "2"}, {Label: "3"}, {Label: "4"}}}
+	msg = c.formatOutbound(bus.OutboundMessage{Card: many})
+	if msg.Card != nil || !strings.Contains(msg.Content, "Reply \"4\"") {
+		t.Errorf("expected all buttons as text, got %q (card %v)", msg.Content, msg.Card)
+	}
+
+	// Legacy bridges get the buttons as text
+	legacy := &WhatsAppChannel{markup: format.WhatsApp}
+	if msg = legacy.formatOutbound(bus.OutboundMessage{Card: card}); msg.Card != nil {
+		t.Error("bridges without buttons should get them as text")
+	}
+
+	// The Facebook API path has no inbound webhook for button replies
+	fb := &WhatsAppChannel{markup: format.WhatsApp, useFacebookAPI: true}
+	if msg = fb.formatOutbound(bus.OutboundMessage{Card: card}); msg.Card != nil {
+		t.Error("Facebook API messages should list buttons as text")
+	}
+}
+
+func TestValidateQuickReplies(t *testing.T) {
+	validator := NewMessageValidator("")
+	tests := []struct {
+		name    string
+		msg     OutgoingMessage
+		wantErr bool
+	}{
+		{"valid", OutgoingMessage{Content: "Pick", Buttons: []QuickReply{{ID: "a", Title: "A"}}}, false},
+		{"too many", OutgoingMessage{Content: "Pick", Buttons: make([]QuickReply, MaxQuickReplies+1)}, true},
+		{"no content", OutgoingMessage{Buttons: []QuickReply{{ID: "a", Title: "A"}}}, true},
+		{"long title", OutgoingMessage{Content: "Pick", Buttons: []QuickReply{{ID: "a", Title: strings.Repeat("x", MaxQuickReplyTitleRunes+1)}}}, true},
+		{"missing id", OutgoingMessage{Content: "Pick", Buttons: []QuickReply{{Title: "A"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := tt.msg
+			msg.Type = MessageTypeMessage
+			msg.To = "+1234567890"
+			if err := validator.ValidateOutgoing(&msg); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOutgoing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package channels
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Replay protection defaults
+const (
+	DefaultReplayWindow   = 5 * time.Minute
+	DefaultNonceCacheSize = 4096
+)
+
+// ValidatorStats counts incoming bridge messages rejected by the validator
+type ValidatorStats struct {
+	Rejected        uint64 `json:"rejected"`         // Todos los mensajes rechazados
+	ReplayDuplicate uint64 `json:"replay_duplicate"` // Nonce o ID ya visto
+	ReplayStale     uint64 `json:"replay_stale"`     // Timestamp demasiado antiguo
+	ReplayFuture    uint64 `json:"replay_future"`    // Timestamp demasiado adelantado
+	ReplayUndated   uint64 `json:"replay_undated"`   // Firmado pero sin timestamp
+}
+
+// validatorCounters holds the live counters behind ValidatorStats
+type validatorCounters struct {
+	rejected        atomic.Uint64
+	replayDuplicate atomic.Uint64
+	replayStale     atomic.Uint64
+	replayFuture    atomic.Uint64
+	replayUndated   atomic.Uint64
+}
+
+func (c *validatorCounters) snapshot() ValidatorStats {
+	return ValidatorStats{
+		Rejected:        c.rejected.Load(),
+		ReplayDuplicate: c.replayDuplicate.Load(),
+		ReplayStale:     c.replayStale.Load(),
+		ReplayFuture:    c.replayFuture.Load(),
+		ReplayUndated:   c.replayUndated.Load(),
+	}
+}
+
+// ReplayGuard rejects bridge messages outside the accepted timestamp window
+// and messages whose nonce (or message ID) has already been seen. Seen
+// identifiers are kept in a bounded LRU cache.
+type ReplayGuard struct {
+	window  time.Duration
+	size    int
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front = most recently seen
+	now     func() time.Time
+}
+
+// NewReplayGuard creates a replay guard. Zero values select the defaults.
+func NewReplayGuard(window time.Duration, cacheSize int) *ReplayGuard {
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+	if cacheSize <= 0 {
+		cacheSize = DefaultNonceCacheSize
+	}
+	return &ReplayGuard{
+		window:  window,
+		size:    cacheSize,
+		entries: make(map[string]*list.Element, cacheSize),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Check validates the message freshness and records its identifier. Signed
+// messages must carry a timestamp; unsigned ones without one are only
+// checked for duplicates. Identifiers are per frame type, and status frames,
+// whose ID is the message they report on, also per status.
+func (g *ReplayGuard) Check(msg *IncomingMessage, signed bool, counters *validatorCounters) error {
+	if msg.Timestamp == 0 && signed {
+		counters.replayUndated.Add(1)
+		return fmt.Errorf("signed message has no timestamp")
+	}
+	if msg.Timestamp != 0 {
+		ts := messageTime(msg.Timestamp)
+		now := g.now()
+		if ts.Before(now.Add(-g.window)) {
+			counters.replayStale.Add(1)
+			return fmt.Errorf("message timestamp outside accepted window")
+		}
+		if ts.After(now.Add(g.window)) {
+			counters.replayFuture.Add(1)
+			return fmt.Errorf("message timestamp is in the future")
+		}
+	}
+
+	key := msg.Nonce
+	if key == "" {
+		key = msg.ID
+	}
+	if key == "" {
+		return nil
+	}
+	key = msg.Type + "|" + msg.From + "|" + key
+	if msg.Type == MessageTypeStatus {
+		key += "|" + msg.Status
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if elem, ok := g.entries[key]; ok {
+		g.order.MoveToFront(elem)
+		counters.replayDuplicate.Add(1)
+		return fmt.Errorf("duplicate message (possible replay)")
+	}
+
+	g.entries[key] = g.order.PushFront(key)
+	if g.order.Len() > g.size {
+		oldest := g.order.Back()
+		g.order.Remove(oldest)
+		delete(g.entries, oldest.Value.(string))
+	}
+	return nil
+}
+
+// messageTime converts a bridge timestamp, which may be in seconds or milliseconds.
+func messageTime(ts int64) time.Time {
+	if ts > 1e12 {
+		return time.UnixMilli(ts)
+	}
+	return time.Unix(ts, 0)
+}
@@ -0,0 +1,125 @@
+package channels
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidatorRejectsReplayedMessages(t *testing.T) {
+	validator := NewMessageValidator("")
+	data := []byte(fmt.Sprintf(`{"type":"message","id":"wamid.1","from":"+1234","content":"hi","timestamp":%d}`, time.Now().Unix()))
+
+	if _, err := validator.ValidateIncoming(data); err != nil {
+		t.Fatalf("first delivery should be accepted: %v", err)
+	}
+	if _, err := validator.ValidateIncoming(data); err == nil {
+		t.Fatal("replayed message should be rejected")
+	}
+
+	stats := validator.Stats()
+	if stats.ReplayDuplicate != 1 || stats.Rejected != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestValidatorRejectsStaleAndFutureMessages(t *testing.T) {
+	validator := NewMessageValidator("")
+	validator.SetReplayProtection(time.Minute, 0)
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		wantErr   bool
+	}{
+		{"fresh seconds", time.Now().Unix(), false},
+		{"fresh milliseconds", time.Now().UnixMilli(), false},
+		{"stale", time.Now().Add(-2 * time.Minute).Unix(), true},
+		{"future", time.Now().Add(2 * time.Minute).Unix(), true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(fmt.Sprintf(`{"type":"message","id":"wamid.%d","from":"+1234","content":"hi","timestamp":%d}`, i, tt.timestamp))
+			_, err := validator.ValidateIncoming(data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateIncoming() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	stats := validator.Stats()
+	if stats.ReplayStale != 1 || stats.ReplayFuture != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestValidatorRejectsReplayedSignedFrames(t *testing.T) {
+	validator := NewMessageValidator("shared-secret")
+	sign := func(body string) []byte {
+		signing, err := signingString(SignatureVersionCanonical, []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []byte(fmt.Sprintf(`{"signature":"%s",%s`, computeHMAC([]byte("shared-secret"), signing), body[1:]))
+	}
+	now := time.Now().Unix()
+
+	// Without a timestamp a captured frame would stay valid for ever
+	for _, body := range []string{
+		`{"sig_version":1,"type":"message","id":"wamid.1","from":"+1234","content":"hi"}`,
+		`{"sig_version":1,"type":"status","id":"wamid.1","status":"read"}`,
+		`{"sig_version":1,"type":"hello","version":1}`,
+	} {
+		if _, err := validator.ValidateIncoming(sign(body)); err == nil {
+			t.Errorf("undated signed frame accepted: %s", body)
+		}
+	}
+
+	frames := []string{
+		fmt.Sprintf(`{"sig_version":1,"type":"status","id":"wamid.1","status":"delivered","timestamp":%d}`, now),
+		fmt.Sprintf(`{"sig_version":1,"type":"hello","version":1,"nonce":"n1","timestamp":%d}`, now),
+	}
+	for _, body := range frames {
+		if _, err := validator.ValidateIncoming(sign(body)); err != nil {
+			t.Fatalf("first delivery of %s: %v", body, err)
+		}
+		if _, err := validator.ValidateIncoming(sign(body)); err == nil {
+			t.Errorf("replayed frame accepted: %s", body)
+		}
+	}
+	stale := fmt.Sprintf(`{"sig_version":1,"type":"hello","version":1,"nonce":"n2","timestamp":%d}`, now-3600)
+	if _, err := validator.ValidateIncoming(sign(stale)); err == nil {
+		t.Error("stale hello accepted")
+	}
+
+	// A later status of the same message is not a replay
+	read := fmt.Sprintf(`{"sig_version":1,"type":"status","id":"wamid.1","status":"read","timestamp":%d}`, now)
+	if _, err := validator.ValidateIncoming(sign(read)); err != nil {
+		t.Errorf("read status after delivered: %v", err)
+	}
+
+	stats := validator.Stats()
+	if stats.ReplayUndated != 3 || stats.ReplayDuplicate != 2 || stats.ReplayStale != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestReplayGuardEvictsOldestNonce(t *testing.T) {
+	guard := NewReplayGuard(time.Minute, 2)
+	counters := &validatorCounters{}
+
+	for _, nonce := range []string{"a", "b", "c"} {
+		if err := guard.Check(&IncomingMessage{From: "+1234", Nonce: nonce}, false, counters); err != nil {
+			t.Fatalf("nonce %s: unexpected error: %v", nonce, err)
+		}
+	}
+
+	// "a" was evicted, "c" is still cached
+	if err := guard.Check(&IncomingMessage{From: "+1234", Nonce: "a"}, false, counters); err != nil {
+		t.Errorf("evicted nonce should be accepted again: %v", err)
+	}
+	if err := guard.Check(&IncomingMessage{From: "+1234", Nonce: "c"}, false, counters); err == nil {
+		t.Error("cached nonce should be rejected")
+	}
+}
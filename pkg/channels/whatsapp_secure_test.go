@@ -275,22 +275,45 @@ func TestWhatsAppHMACSignature(t *testing.T) {
 		t.Error("Should generate HMAC signature")
 	}
 
-	// Verify la firma
-	data, _ := json.Marshal(struct {
+	// Verify la firma sobre la cadena canónica: claves ordenadas, sin campos vacíos
+	fields, _ := json.Marshal(map[string]interface{}{
+		"type":        outgoing.Type,
+		"to":          outgoing.To,
+		"content":     outgoing.Content,
+		"timestamp":   outgoing.Timestamp,
+		"sig_version": SignatureVersionCanonical,
+	})
+	data := append([]byte("picoclaw-wa/v1\n"), fields...)
+
+	expectedSig := validator.calculateSignature(data)
+	if outgoing.Signature != expectedSig {
+		t.Error("Signature verification failed")
+	}
+
+	// Legacy bridges still receive signatures over the raw JSON encoding
+	validator.SetSignatureVersion(SignatureVersionLegacy)
+	legacy := &OutgoingMessage{
+		Type:      "message",
+		To:        "+1234567890",
+		Content:   "Test message",
+		Timestamp: outgoing.Timestamp,
+	}
+	if err := validator.ValidateOutgoing(legacy); err != nil {
+		t.Fatalf("Should validate and sign legacy message: %v", err)
+	}
+	legacyData, _ := json.Marshal(struct {
 		Type      string `json:"type"`
 		To        string `json:"to,omitempty"`
 		Content   string `json:"content,omitempty"`
 		Timestamp int64  `json:"timestamp,omitempty"`
 	}{
-		Type:      outgoing.Type,
-		To:        outgoing.To,
-		Content:   outgoing.Content,
-		Timestamp: outgoing.Timestamp,
+		Type:      legacy.Type,
+		To:        legacy.To,
+		Content:   legacy.Content,
+		Timestamp: legacy.Timestamp,
 	})
-
-	expectedSig := validator.calculateSignature(data)
-	if outgoing.Signature != expectedSig {
-		t.Error("Signature verification failed")
+	if legacy.Signature != validator.calculateSignature(legacyData) {
+		t.Error("Legacy signature verification failed")
 	}
 }
 
@@ -418,3 +441,65 @@ func TestWhatsAppErrorMessage(t *testing.T) {
 		t.Error("Channel should still be running after error message")
 	}
 }
+
+// TestWhatsAppReactionAndReplyValidation tests validation of replies and reactions
+func TestWhatsAppReactionAndReplyValidation(t *testing.T) {
+	validator := NewMessageValidator("")
+
+	reply := &OutgoingMessage{
+		Type:    MessageTypeMessage,
+		To:      "+1234567890",
+		Content: "Replying in thread",
+		Context: &MessageContext{MessageID: "wamid.123"},
+	}
+	if err := validator.ValidateOutgoing(reply); err != nil {
+		t.Fatalf("Should validate reply message: %v", err)
+	}
+
+	reaction := &OutgoingMessage{
+		Type:     MessageTypeReaction,
+		To:       "+1234567890",
+		Reaction: &MessageReaction{MessageID: "wamid.123", Emoji: "👍"},
+	}
+	if err := validator.ValidateOutgoing(reaction); err != nil {
+		t.Fatalf("Should validate reaction message: %v", err)
+	}
+
+	invalid := []*OutgoingMessage{
+		{Type: MessageTypeReaction, To: "+1234567890"},
+		{Type: MessageTypeReaction, To: "+1234567890", Reaction: &MessageReaction{Emoji: "👍"}},
+		{Type: MessageTypeMessage, To: "+1234567890", Content: "hi", Context: &MessageContext{}},
+		{Type: MessageTypeMessage, To: "+1234567890", Content: "hi", Reaction: &MessageReaction{MessageID: "wamid.123", Emoji: "👍"}},
+	}
+	for i, msg := range invalid {
+		if err := validator.ValidateOutgoing(msg); err == nil {
+			t.Errorf("case %d: expected validation error", i)
+		}
+	}
+}
+
+// TestWhatsAppTypingAndReadValidation tests validation of typing indicators and read receipts
+func TestWhatsAppTypingAndReadValidation(t *testing.T) {
+	validator := NewMessageValidator("")
+
+	valid := []*OutgoingMessage{
+		{Type: MessageTypeTyping, To: "+1234567890"},
+		{Type: MessageTypeRead, MessageID: "wamid.123"},
+	}
+	for i, msg := range valid {
+		if err := validator.ValidateOutgoing(msg); err != nil {
+			t.Errorf("case %d: unexpected validation error: %v", i, err)
+		}
+	}
+
+	invalid := []*OutgoingMessage{
+		{Type: MessageTypeTyping},
+		{Type: MessageTypeRead},
+		{Type: "presence", To: "+1234567890"},
+	}
+	for i, msg := range invalid {
+		if err := validator.ValidateOutgoing(msg); err == nil {
+			t.Errorf("case %d: expected validation error", i)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package channels
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// Metadata of inbound shared locations and contact cards. The message
+// content describes them as text.
+const (
+	MetadataLatitude        = "latitude"
+	MetadataLongitude       = "longitude"
+	MetadataLocationName    = "location_name"
+	MetadataLocationAddress = "location_address"
+	MetadataVCard           = "vcard" // The contact card as received
+)
+
+// sharedContent returns the text of a location or contact message: its
+// caption followed by a description of what was shared. The details go in
+// metadata.
+func sharedContent(msg *IncomingMessage, metadata map[string]string) string {
+	var shared string
+	switch {
+	case msg.Location != nil:
+		loc := msg.Location
+		lat := strconv.FormatFloat(loc.Latitude, 'f', -1, 64)
+		lon := strconv.FormatFloat(loc.Longitude, 'f', -1, 64)
+		metadata[MetadataLatitude] = lat
+		metadata[MetadataLongitude] = lon
+		if loc.Name != "" {
+			metadata[MetadataLocationName] = loc.Name
+		}
+		if loc.Address != "" {
+			metadata[MetadataLocationAddress] = loc.Address
+		}
+
+		label := strings.Join(nonEmpty(loc.Name, loc.Address), ", ")
+		if label == "" {
+			shared = fmt.Sprintf("[location: %s, %s]", lat, lon)
+		} else {
+			shared = fmt.Sprintf("[location: %s (%s, %s)]", label, lat, lon)
+		}
+	case msg.Contact != nil:
+		metadata[MetadataVCard] = msg.Contact.VCard
+		contact := parseVCard(msg.Contact.VCard)
+		details := nonEmpty(append(append([]string{contact.Name}, contact.Phones...), contact.Emails...)...)
+		shared = "[contact: " + strings.Join(details, ", ") + "]"
+	default:
+		return msg.Content
+	}
+
+	if msg.Content == "" {
+		return shared
+	}
+	return msg.Content + "\n" + shared
+}
+
+// nonEmpty returns the strings that are not empty
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// facebookContact converts a contact to a Cloud API contact card
+func facebookContact(contact *bus.Contact) FacebookContact {
+	name := FacebookContactName{FormattedName: contact.Name, FirstName: contact.Name}
+	if i := strings.LastIndex(contact.Name, " "); i > 0 {
+		name.FirstName, name.LastName = contact.Name[:i], contact.Name[i+1:]
+	}
+	fc := FacebookContact{Name: name}
+	for _, phone := range contact.Phones {
+		fc.Phones = append(fc.Phones, FacebookContactPhone{Phone: phone, Type: "CELL"})
+	}
+	for _, email := range contact.Emails {
+		fc.Emails = append(fc.Emails, FacebookContactEmail{Email: email})
+	}
+	return fc
+}
+
+// SendsContacts reports that the channel sends contact cards. Bridges
+// without contact support get them as text.
+func (c *WhatsAppChannel) SendsContacts() bool {
+	return true
+}
@@ -0,0 +1,83 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+const testVCard = "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Ada Lovelace\r\nitem1.TEL;waid=441234:+44 1234\r\nEMAIL:ada@example.com\r\nEND:VCARD"
+
+func TestValidateIncomingShared(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"location", `{"type":"location","from":"+1234","location":{"latitude":51.5,"longitude":-0.12,"name":"Office"}}`, false},
+		{"location at origin", `{"type":"location","from":"+1234","location":{"latitude":0,"longitude":0}}`, false},
+		{"contact", `{"type":"contact","from":"+1234","contact":{"vcard":"` + strings.ReplaceAll(testVCard, "\r\n", `\r\n`) + `"}}`, false},
+		{"missing location", `{"type":"location","from":"+1234"}`, true},
+		{"latitude out of range", `{"type":"location","from":"+1234","location":{"latitude":91,"longitude":0}}`, true},
+		{"long location name", `{"type":"location","from":"+1234","location":{"latitude":1,"longitude":1,"name":"` + strings.Repeat("x", MaxLocationTextLength+1) + `"}}`, true},
+		{"not a vcard", `{"type":"contact","from":"+1234","contact":{"vcard":"Ada, +44 1234"}}`, true},
+		{"location on a text message", `{"type":"message","from":"+1234","content":"hi","location":{"latitude":1,"longitude":1}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewMessageValidator("")
+			if _, err := validator.ValidateIncoming([]byte(tt.data)); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateIncoming() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSharedContent(t *testing.T) {
+	metadata := map[string]string{}
+	got := sharedContent(&IncomingMessage{
+		Type:     MessageTypeLocation,
+		Content:  "meet here",
+		Location: &Location{Latitude: 51.5, Longitude: -0.12, Name: "Office", Address: "1 Main St"},
+	}, metadata)
+	if got != "meet here\n[location: Office, 1 Main St (51.5, -0.12)]" {
+		t.Errorf("location content = %q", got)
+	}
+	if metadata[MetadataLatitude] != "51.5" || metadata[MetadataLongitude] != "-0.12" || metadata[MetadataLocationName] != "Office" {
+		t.Errorf("unexpected location metadata %v", metadata)
+	}
+
+	metadata = map[string]string{}
+	got = sharedContent(&IncomingMessage{Type: MessageTypeContact, Contact: &ContactCard{VCard: testVCard}}, metadata)
+	if got != "[contact: Ada Lovelace, +44 1234, ada@example.com]" || metadata[MetadataVCard] != testVCard {
+		t.Errorf("contact content = %q, metadata %v", got, metadata)
+	}
+}
+
+func TestOutgoingContact(t *testing.T) {
+	contact := &bus.Contact{Name: "Ada Lovelace", Phones: []string{"+44 1234"}}
+	validator := NewMessageValidator("")
+
+	got, err := outgoingMessages(bus.OutboundMessage{ChatID: "+1234567890", ReplyTo: "m1", Contact: contact})
+	if err != nil || len(got) != 1 || got[0].Type != MessageTypeContact || got[0].Context == nil {
+		t.Fatalf("outgoingMessages() = %+v, %v", got, err)
+	}
+	if err := validator.ValidateOutgoing(got[0]); err != nil {
+		t.Errorf("contact rejected by validator: %v", err)
+	}
+
+	// Bridges without contact cards get them as text
+	legacy := &WhatsAppChannel{markup: format.WhatsApp, protocol: newBridgeProtocol(1, legacyCapabilities)}
+	msg := legacy.formatOutbound(bus.OutboundMessage{Content: "Here you go", Contact: contact})
+	if msg.Contact != nil || msg.Content != "Here you go\n\n*Ada Lovelace*\nPhone: +44 1234" {
+		t.Errorf("legacy bridge content = %q (contact %v)", msg.Content, msg.Contact)
+	}
+
+	fc := facebookContact(contact)
+	if fc.Name.FormattedName != "Ada Lovelace" || fc.Name.FirstName != "Ada" || fc.Name.LastName != "Lovelace" || fc.Phones[0].Phone != "+44 1234" {
+		t.Errorf("facebookContact() = %+v", fc)
+	}
+}
@@ -0,0 +1,94 @@
+package channels
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Signature protocol versions for bridge messages
+const (
+	// SignatureVersionLegacy signs the raw json.Marshal output of the message.
+	// It breaks whenever signer and verifier serialize fields differently and
+	// is only kept for bridges that have not been upgraded.
+	SignatureVersionLegacy = 0
+	// SignatureVersionCanonical signs a canonical serialization: the message
+	// fields without "signature" and without empty values, with object keys
+	// sorted, prefixed by a version line.
+	SignatureVersionCanonical = 1
+)
+
+// signingString builds the string signed under the canonical protocol from
+// the JSON encoding of a message.
+func signingString(version int, data []byte) ([]byte, error) {
+	if version != SignatureVersionCanonical {
+		return nil, fmt.Errorf("unsupported signature version %d", version)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("invalid message for signing: %w", err)
+	}
+	delete(fields, "signature")
+
+	canonical, ok := pruneEmpty(fields).(map[string]interface{})
+	if !ok {
+		canonical = map[string]interface{}{}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "picoclaw-wa/v%d\n", version)
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// encoding/json writes map keys in sorted order at every level
+	if err := enc.Encode(canonical); err != nil {
+		return nil, fmt.Errorf("failed to encode signing string: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// pruneEmpty drops null, "", 0, false and empty arrays/objects so that a field
+// omitted by one side and sent as its zero value by the other sign the same.
+// It returns nil when the value itself is empty.
+func pruneEmpty(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case string:
+		if val == "" {
+			return nil
+		}
+	case bool:
+		if !val {
+			return nil
+		}
+	case json.Number:
+		if f, err := val.Float64(); err == nil && f == 0 {
+			return nil
+		}
+	case []interface{}:
+		out := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			// Array positions are significant, so empty items are kept as null
+			out = append(out, pruneEmpty(item))
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if pruned := pruneEmpty(item); pruned != nil {
+				out[k] = pruned
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,53 @@
+package channels
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSigningStringIsCanonical(t *testing.T) {
+	a := []byte(`{"type":"message","to":"+1234","content":"a<b","media":[],"timestamp":1700000000,"signature":"x"}`)
+	b := []byte(`{"timestamp":1700000000,"content":"a<b","context":null,"to":"+1234","type":"message","nonce":""}`)
+
+	sa, err := signingString(SignatureVersionCanonical, a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sb, err := signingString(SignatureVersionCanonical, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "picoclaw-wa/v1\n" + `{"content":"a<b","timestamp":1700000000,"to":"+1234","type":"message"}`
+	if string(sa) != want || string(sb) != want {
+		t.Errorf("signing strings differ:\n%s\n%s\nwant:\n%s", sa, sb, want)
+	}
+
+	if _, err := signingString(99, a); err == nil {
+		t.Error("expected unknown version to be rejected")
+	}
+}
+
+func TestCanonicalSignatureRoundTrip(t *testing.T) {
+	validator := NewMessageValidator("shared-secret")
+
+	// The bridge serializes fields in its own order and includes fields this
+	// side does not know about; the signature must still verify.
+	body := fmt.Sprintf(`{"sig_version":1,"timestamp":%d,"from":"+1234","type":"message","content":"hola\u0007","bridge_build":"2.1"}`, time.Now().Unix())
+	signing, _ := signingString(SignatureVersionCanonical, []byte(body))
+	signed := fmt.Sprintf(`{"signature":"%s",%s`, computeHMAC([]byte("shared-secret"), signing), body[1:])
+
+	msg, err := validator.ValidateIncoming([]byte(signed))
+	if err != nil {
+		t.Fatalf("canonical signature should verify: %v", err)
+	}
+	if msg.Content != "hola" {
+		t.Errorf("expected sanitized content, got %q", msg.Content)
+	}
+
+	tampered := fmt.Sprintf(`{"signature":"%s",%s`, computeHMAC([]byte("shared-secret"), signing), body[1:len(body)-1]+`,"chat":"other"}`)
+	if _, err := validator.ValidateIncoming([]byte(tampered)); err == nil {
+		t.Error("tampered message should be rejected")
+	}
+}
@@ -0,0 +1,121 @@
+package channels
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Part numbers are appended as "\n(2/3)"; reserve room for up to 999 parts
+const partNumberReserve = len("\n(999/999)")
+
+const codeFence = "```"
+
+// sentenceEnds are the boundaries tried after paragraphs and lines
+var sentenceEnds = []string{". ", "! ", "? ", "。", "！", "？"}
+
+// splitLongMessage splits content into parts of at most limit bytes. It
+// breaks at paragraph, line, sentence or word boundaries, in that order of
+// preference, and keeps Markdown code blocks valid by closing an open fence
+// at the end of a part and reopening it, with its language, in the next.
+// Parts are numbered "(1/3)" when there is more than one.
+func splitLongMessage(content string, limit int) []string {
+	if len(content) <= limit {
+		return []string{content}
+	}
+
+	var parts []string
+	openFence := "" // Fence line (e.g. "```go") of a code block spanning parts
+	rest := content
+	for rest != "" {
+		prefix := ""
+		if openFence != "" {
+			prefix = openFence + "\n"
+		}
+
+		budget := limit - partNumberReserve - len(prefix)
+		if len(rest) <= budget {
+			parts = append(parts, prefix+rest)
+			break
+		}
+		// Leave room to close a fence left open by this part
+		budget -= len("\n" + codeFence)
+
+		cut := splitPoint(rest, budget)
+		chunk := strings.TrimRight(rest[:cut], " \t\n")
+		rest = strings.TrimLeft(rest[cut:], "\n")
+
+		fence := fenceAfter(openFence, chunk)
+		if fence == "" {
+			// Outside code, leading spaces of the next part carry no meaning
+			rest = strings.TrimLeft(rest, " \t")
+		}
+
+		part := prefix + chunk
+		if fence != "" {
+			part += "\n" + codeFence
+		}
+		parts = append(parts, part)
+		openFence = fence
+	}
+
+	if len(parts) > 1 {
+		for i := range parts {
+			parts[i] = fmt.Sprintf("%s\n(%d/%d)", parts[i], i+1, len(parts))
+		}
+	}
+	return parts
+}
+
+// splitPoint returns where to end a part of s no longer than budget bytes
+func splitPoint(s string, budget int) int {
+	if budget <= 0 {
+		budget = 1
+	}
+	for budget < len(s) && !utf8.RuneStart(s[budget]) {
+		budget--
+	}
+	window := s[:budget]
+	// Boundaries in the first half would make parts needlessly short
+	minCut := budget / 2
+
+	if i := strings.LastIndex(window, "\n\n"); i > minCut {
+		return i
+	}
+	if i := strings.LastIndex(window, "\n"); i > minCut {
+		return i
+	}
+	best := -1
+	for _, end := range sentenceEnds {
+		if i := strings.LastIndex(window, end); i != -1 {
+			// Keep the punctuation, drop the space
+			if cut := i + len(strings.TrimRight(end, " ")); cut > best {
+				best = cut
+			}
+		}
+	}
+	if best > minCut {
+		return best
+	}
+	if i := strings.LastIndex(window, " "); i > minCut {
+		return i
+	}
+	return budget
+}
+
+// fenceAfter returns the fence line of the code block still open at the end
+// of text, given the one open at its start ("" when outside code).
+func fenceAfter(open, text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, codeFence) {
+			continue
+		}
+		if open == "" {
+			open = line
+		} else if line == codeFence {
+			open = ""
+		}
+	}
+	return open
+}
@@ -0,0 +1,122 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestSplitLongMessage(t *testing.T) {
+	paragraph := strings.Repeat("Lorem ipsum dolor sit amet. ", 10) // 280 bytes
+	code := "```go\n" + strings.Repeat("fmt.Println(\"hello\")\n", 30) + "```"
+
+	tests := []struct {
+		name      string
+		content   string
+		limit     int
+		wantParts int
+		check     func(t *testing.T, parts []string)
+	}{
+		{
+			name:      "short message untouched",
+			content:   "hello",
+			limit:     100,
+			wantParts: 1,
+			check: func(t *testing.T, parts []string) {
+				if parts[0] != "hello" {
+					t.Errorf("got %q", parts[0])
+				}
+			},
+		},
+		{
+			name:      "paragraph boundaries",
+			content:   paragraph + "\n\n" + paragraph + "\n\n" + paragraph,
+			limit:     600,
+			wantParts: 2,
+			check: func(t *testing.T, parts []string) {
+				if !strings.HasSuffix(parts[0], "amet.\n(1/2)") {
+					t.Errorf("first part should end at a paragraph: %q", parts[0][len(parts[0])-30:])
+				}
+				if !strings.HasPrefix(parts[1], "Lorem") || !strings.HasSuffix(parts[1], "(2/2)") {
+					t.Errorf("unexpected second part: %q...", parts[1][:20])
+				}
+			},
+		},
+		{
+			name:      "sentence boundaries",
+			content:   paragraph + paragraph,
+			limit:     300,
+			wantParts: 2,
+			check: func(t *testing.T, parts []string) {
+				if !strings.HasSuffix(parts[0], "amet.\n(1/2)") {
+					t.Errorf("first part should end at a sentence: %q", parts[0])
+				}
+			},
+		},
+		{
+			name:      "code fence reopened",
+			content:   "Here is the code:\n\n" + code + "\n\nDone.",
+			limit:     300,
+			wantParts: 3,
+			check: func(t *testing.T, parts []string) {
+				for i, part := range parts {
+					body := part[:strings.LastIndex(part, "\n(")]
+					if strings.Count(body, "```")%2 != 0 {
+						t.Errorf("part %d has an unbalanced code fence:\n%s", i+1, body)
+					}
+					if i > 0 && !strings.HasPrefix(body, "```go\n") {
+						t.Errorf("part %d should reopen the go code block:\n%s", i+1, body)
+					}
+				}
+			},
+		},
+		{
+			name:      "no boundaries",
+			content:   strings.Repeat("ü", 200),
+			limit:     100,
+			wantParts: 5,
+			check: func(t *testing.T, parts []string) {
+				for i, part := range parts {
+					if !utf8.ValidString(part) {
+						t.Errorf("part %d split a character", i+1)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := splitLongMessage(tt.content, tt.limit)
+			if len(parts) != tt.wantParts {
+				t.Fatalf("got %d parts, want %d: %q", len(parts), tt.wantParts, parts)
+			}
+			for i, part := range parts {
+				if len(part) > tt.limit {
+					t.Errorf("part %d is %d bytes, limit %d", i+1, len(part), tt.limit)
+				}
+			}
+			tt.check(t, parts)
+		})
+	}
+}
+
+func TestOutgoingMessagesSplitsLongContent(t *testing.T) {
+	content := strings.Repeat("A sentence that keeps going. ", MaxContentLength/10)
+	got, err := outgoingMessages(bus.OutboundMessage{ChatID: "+1234567890", Content: content})
+	if err != nil {
+		t.Fatalf("outgoingMessages: %v", err)
+	}
+	if len(got) < 3 {
+		t.Fatalf("expected the content to be split, got %d messages", len(got))
+	}
+
+	validator := NewMessageValidator("")
+	for i, out := range got {
+		if err := validator.ValidateOutgoing(out); err != nil {
+			t.Errorf("part %d rejected: %v", i+1, err)
+		}
+	}
+}
@@ -238,6 +238,35 @@ func TestWhatsAppAllowFrom(t *testing.T) {
 	}
 }
 
+// TestWhatsAppButtonReply prueba que la pulsación de un botón llega como elección
+func TestWhatsAppButtonReply(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	channel, err := NewWhatsAppChannel(config.WhatsAppConfig{
+		Enabled:   true,
+		BridgeURL: "ws://localhost:3001",
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("Error creating WhatsApp channel: %v", err)
+	}
+
+	data := `{"type":"message","id":"m1","from":"+1234567890","button_reply":{"id":"deploy","title":"Yes"}}`
+	msg, err := channel.validator.ValidateIncoming([]byte(data))
+	if err != nil {
+		t.Fatalf("button reply without content should validate: %v", err)
+	}
+	channel.handleMessage(msg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	inbound, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("No inbound message")
+	}
+	if inbound.Content != "deploy" || inbound.Metadata[MetadataChoice] != "deploy" || inbound.Metadata[MetadataChoiceLabel] != "Yes" {
+		t.Errorf("unexpected inbound message %+v", inbound)
+	}
+}
+
 // TestWhatsAppConfigDefaultValues prueba los valores por defecto
 func TestWhatsAppConfigDefaultValues(t *testing.T) {
 	cfg := config.DefaultConfig()
@@ -0,0 +1,135 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Bridge writer defaults
+const (
+	writeQueueSize = 64
+	writeTimeout   = 10 * time.Second
+)
+
+// errConnectionClosed is returned for writes that could not complete because
+// the connection went away
+var errConnectionClosed = errors.New("whatsapp connection closed")
+
+// wsFrame is a frame queued for the writer goroutine
+type wsFrame struct {
+	messageType int // websocket.TextMessage, PingMessage, CloseMessage...
+	data        []byte
+	result      chan error // Receives the outcome of the write
+}
+
+// wsWriter owns all writes to a bridge connection. gorilla/websocket allows
+// a single concurrent writer, so Send, keepalive pings and bridge pongs all
+// queue frames here and a single goroutine writes them in order.
+type wsWriter struct {
+	conn  *websocket.Conn
+	queue chan wsFrame
+	done  <-chan struct{} // Closed when the connection is gone
+}
+
+func newWSWriter(conn *websocket.Conn, done <-chan struct{}) *wsWriter {
+	return &wsWriter{
+		conn:  conn,
+		queue: make(chan wsFrame, writeQueueSize),
+		done:  done,
+	}
+}
+
+// Enqueue queues a frame and returns a future that receives the write
+// result. The future receives errConnectionClosed if the connection ends
+// before the frame is written.
+func (w *wsWriter) Enqueue(messageType int, data []byte) <-chan error {
+	frame := wsFrame{messageType: messageType, data: data, result: make(chan error, 1)}
+	select {
+	case <-w.done:
+		frame.result <- errConnectionClosed
+		return frame.result
+	default:
+	}
+
+	select {
+	case w.queue <- frame:
+	case <-w.done:
+		frame.result <- errConnectionClosed
+	}
+	return frame.result
+}
+
+// Write queues a frame and waits for it to be written.
+func (w *wsWriter) Write(ctx context.Context, messageType int, data []byte) error {
+	result := w.Enqueue(messageType, data)
+	select {
+	case err := <-result:
+		return err
+	case <-w.done:
+		// The frame may have been written just before the connection ended
+		select {
+		case err := <-result:
+			return err
+		default:
+			return errConnectionClosed
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run writes queued frames until the connection ends. A failed write closes
+// the connection so the reader notices and the channel reconnects.
+func (w *wsWriter) run() {
+	for {
+		select {
+		case <-w.done:
+			w.drain()
+			return
+		case frame := <-w.queue:
+			// Both cases may be ready at once; never write once done
+			select {
+			case <-w.done:
+				frame.result <- errConnectionClosed
+				w.drain()
+				return
+			default:
+			}
+			frame.result <- w.write(frame)
+		}
+	}
+}
+
+func (w *wsWriter) write(frame wsFrame) error {
+	deadline := time.Now().Add(writeTimeout)
+
+	var err error
+	switch frame.messageType {
+	case websocket.PingMessage, websocket.PongMessage, websocket.CloseMessage:
+		err = w.conn.WriteControl(frame.messageType, frame.data, deadline)
+	default:
+		if err = w.conn.SetWriteDeadline(deadline); err == nil {
+			err = w.conn.WriteMessage(frame.messageType, frame.data)
+		}
+	}
+
+	if err != nil && frame.messageType != websocket.CloseMessage {
+		w.conn.Close()
+	}
+	return err
+}
+
+// drain fails the frames still queued when the connection ended
+func (w *wsWriter) drain() {
+	for {
+		select {
+		case frame := <-w.queue:
+			frame.result <- errConnectionClosed
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newWriterTestConn dials a websocket server that forwards every text frame
+// it receives to the returned channel.
+func newWriterTestConn(t *testing.T) (*websocket.Conn, <-chan string) {
+	t.Helper()
+	received := make(chan string, 256)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, received
+}
+
+func TestWSWriterConcurrentWrites(t *testing.T) {
+	conn, received := newWriterTestConn(t)
+	done := make(chan struct{})
+	w := newWSWriter(conn, done)
+	go w.run()
+	defer close(done)
+
+	const senders, perSender = 8, 25
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < perSender; i++ {
+				if err := w.Write(context.Background(), websocket.TextMessage, []byte(fmt.Sprintf("%d:%d", s, i))); err != nil {
+					t.Errorf("Write: %v", err)
+				}
+				if i%5 == 0 {
+					w.Write(context.Background(), websocket.PingMessage, nil)
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	// Frames from one sender arrive in the order they were written
+	next := make(map[int]int)
+	for n := 0; n < senders*perSender; n++ {
+		select {
+		case msg := <-received:
+			var s, i int
+			fmt.Sscanf(msg, "%d:%d", &s, &i)
+			if i != next[s] {
+				t.Fatalf("sender %d: got frame %d, want %d", s, i, next[s])
+			}
+			next[s]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %d frames", n)
+		}
+	}
+}
+
+func TestWSWriterClosedConnection(t *testing.T) {
+	conn, _ := newWriterTestConn(t)
+	done := make(chan struct{})
+	w := newWSWriter(conn, done)
+
+	// Queued but never written: the writer has not started
+	pending := w.Enqueue(websocket.TextMessage, []byte("queued"))
+
+	close(done)
+	w.run()
+
+	if err := <-pending; !errors.Is(err, errConnectionClosed) {
+		t.Errorf("pending frame: got %v, want errConnectionClosed", err)
+	}
+	if err := w.Write(context.Background(), websocket.TextMessage, []byte("late")); !errors.Is(err, errConnectionClosed) {
+		t.Errorf("write after close: got %v, want errConnectionClosed", err)
+	}
+}
+
+func TestWSWriterFailedWriteClosesConnection(t *testing.T) {
+	conn, _ := newWriterTestConn(t)
+	done := make(chan struct{})
+	w := newWSWriter(conn, done)
+	go w.run()
+	defer close(done)
+
+	conn.UnderlyingConn().Close()
+	if err := w.Write(context.Background(), websocket.TextMessage, []byte("lost")); err == nil {
+		t.Fatal("expected write on a broken connection to fail")
+	}
+	// The writer closed the websocket, so the reader side fails too
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("expected connection to be closed after a failed write")
+	}
+}
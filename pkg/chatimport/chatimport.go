@@ -0,0 +1,205 @@
+// Package chatimport reads the chat exports of WhatsApp and Telegram, so the
+// history of a chat can seed the session and memory of a new agent.
+package chatimport
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Export sources
+const (
+	SourceWhatsApp = "whatsapp"
+	SourceTelegram = "telegram"
+)
+
+// Message is one message of an exported chat
+type Message struct {
+	Time     time.Time
+	Sender   string // Display name, or phone number for unsaved WhatsApp contacts
+	SenderID string // Platform ID when the export has one, e.g. "user123"
+	Text     string // Media show up as placeholders like "[photo]"
+}
+
+// Chat is an exported chat
+type Chat struct {
+	Source   string // SourceWhatsApp or SourceTelegram
+	Title    string
+	Group    bool
+	Owner    string // Sender name or ID of the agent's owner, see SetOwner
+	Messages []Message
+}
+
+// Participant is a sender of an exported chat
+type Participant struct {
+	Name     string
+	ID       string
+	Messages int
+	First    time.Time
+	Last     time.Time
+}
+
+// Turn is a message as it goes into the agent's session history
+type Turn struct {
+	Role    string // "user" or "assistant"
+	Content string
+}
+
+// Load reads the export at path: a WhatsApp .txt or .zip export, or the
+// result.json of a Telegram Desktop export of one chat or of all chats
+func Load(path string) ([]*Chat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zip":
+		chat, err := loadWhatsAppZip(path)
+		if err != nil {
+			return nil, err
+		}
+		return []*Chat{chat}, nil
+	case ".txt":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		chat, err := ParseWhatsApp(f, whatsAppTitle(path))
+		if err != nil {
+			return nil, err
+		}
+		return []*Chat{chat}, nil
+	case ".json":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ParseTelegram(f)
+	default:
+		return nil, fmt.Errorf("unknown export format %q (want a WhatsApp .txt or .zip, or a Telegram .json)", filepath.Ext(path))
+	}
+}
+
+// loadWhatsAppZip reads the chat text of a WhatsApp export with media
+func loadWhatsAppZip(path string) (*Chat, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		name := filepath.Base(f.Name)
+		if name != "_chat.txt" && !strings.HasPrefix(name, "WhatsApp Chat") {
+			continue
+		}
+		if !strings.HasSuffix(name, ".txt") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		title := whatsAppTitle(name)
+		if title == "" {
+			// iOS names the text _chat.txt and the archive after the chat
+			title = whatsAppTitle(path)
+		}
+		return ParseWhatsApp(rc, title)
+	}
+	return nil, fmt.Errorf("%s holds no WhatsApp chat text", path)
+}
+
+var whatsAppTitlePattern = regexp.MustCompile(`^WhatsApp Chat(?: with| -) (.+)$`)
+
+// whatsAppTitle returns the chat name in an export file name such as
+// "WhatsApp Chat with Ana.txt" or "WhatsApp Chat - Ana.zip"
+func whatsAppTitle(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if m := whatsAppTitlePattern.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// isOwner reports whether the owner sent msg
+func (c *Chat) isOwner(msg Message) bool {
+	if c.Owner == "" {
+		return false
+	}
+	return strings.EqualFold(msg.Sender, c.Owner) || (msg.SenderID != "" && msg.SenderID == c.Owner)
+}
+
+// SetOwner marks the messages sent by owner, a sender name or ID, as the
+// owner's. It fails when nobody of that name or ID wrote in the chat.
+func (c *Chat) SetOwner(owner string) error {
+	for _, msg := range c.Messages {
+		if strings.EqualFold(msg.Sender, owner) || (msg.SenderID != "" && msg.SenderID == owner) {
+			c.Owner = owner
+			return nil
+		}
+	}
+	var names []string
+	for _, p := range c.Participants() {
+		names = append(names, p.Name)
+	}
+	return fmt.Errorf("%q wrote nothing in %q; senders are %s", owner, c.Title, strings.Join(names, ", "))
+}
+
+// Participants returns the senders in the order they first wrote
+func (c *Chat) Participants() []Participant {
+	var participants []Participant
+	index := make(map[string]int)
+	for _, msg := range c.Messages {
+		key := msg.SenderID
+		if key == "" {
+			key = msg.Sender
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(participants)
+			index[key] = i
+			participants = append(participants, Participant{
+				Name:  msg.Sender,
+				ID:    msg.SenderID,
+				First: msg.Time,
+			})
+		}
+		participants[i].Messages++
+		participants[i].Last = msg.Time
+		// Telegram keeps the name a sender had when each message was sent
+		participants[i].Name = msg.Sender
+	}
+	return participants
+}
+
+// Turns returns up to the last limit messages as session history, all of
+// them when limit is 0. In a chat between two people the owner is the user
+// and the other person the assistant; in groups every message is the user's,
+// prefixed with the sender. Consecutive messages of a role are joined.
+func (c *Chat) Turns(limit int) []Turn {
+	messages := c.Messages
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+
+	var turns []Turn
+	for _, msg := range messages {
+		turn := Turn{Role: "user", Content: msg.Text}
+		if c.Group {
+			turn.Content = msg.Sender + ": " + msg.Text
+		} else if !c.isOwner(msg) {
+			turn.Role = "assistant"
+		}
+		if n := len(turns); n > 0 && turns[n-1].Role == turn.Role {
+			turns[n-1].Content += "\n" + turn.Content
+			continue
+		}
+		turns = append(turns, turn)
+	}
+	return turns
+}
@@ -0,0 +1,163 @@
+package chatimport
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const androidExport = `12/31/23, 9:41 PM - Messages and calls are end-to-end encrypted.
+12/31/23, 9:41 PM - Ana: Happy new year!
+See you tomorrow?
+12/31/23, 9:42 PM - +49 151 2345678: Sure
+1/1/24, 10:05 AM - Ana: <Media omitted>
+`
+
+const iosExport = "[31/12/2023, 21:41:05] Ana: Happy new year!\n" +
+	"[13/01/2024, 08:00:00] Ben: \u200e<attached: 00000012-PHOTO-2024-01-13.jpg>\n"
+
+func TestParseWhatsApp(t *testing.T) {
+	chat, err := ParseWhatsApp(strings.NewReader(androidExport), "Ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chat.Group || len(chat.Messages) != 3 {
+		t.Fatalf("unexpected chat %+v", chat)
+	}
+	first := chat.Messages[0]
+	if first.Sender != "Ana" || first.Text != "Happy new year!\nSee you tomorrow?" ||
+		!first.Time.Equal(time.Date(2023, 12, 31, 21, 41, 0, 0, time.Local)) {
+		t.Errorf("unexpected first message %+v", first)
+	}
+	if chat.Messages[1].SenderID != "491512345678" {
+		t.Errorf("phone number not taken as ID: %+v", chat.Messages[1])
+	}
+	if chat.Messages[2].Text != "[media]" || chat.Messages[2].Time.Month() != time.January {
+		t.Errorf("unexpected last message %+v", chat.Messages[2])
+	}
+
+	chat, err = ParseWhatsApp(strings.NewReader(iosExport), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chat.Messages[1].Time; !got.Equal(time.Date(2024, 1, 13, 8, 0, 0, 0, time.Local)) {
+		t.Errorf("day-first date read as %v", got)
+	}
+	if chat.Messages[1].Text != "[media]" || chat.Title != "Ana" {
+		t.Errorf("unexpected chat %+v", chat)
+	}
+}
+
+func TestLoadWhatsAppZip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "WhatsApp Chat - Ana.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("_chat.txt")
+	w.Write([]byte(iosExport))
+	zw.Close()
+	f.Close()
+
+	chats, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chats) != 1 || chats[0].Title != "Ana" || len(chats[0].Messages) != 2 {
+		t.Errorf("unexpected chats %+v", chats)
+	}
+}
+
+const telegramExportJSON = `{
+  "personal_information": {"user_id": 1},
+  "chats": {"list": [
+    {"name": "Ana", "type": "personal_chat", "id": 2, "messages": [
+      {"id": 1, "type": "service", "date": "2024-01-01T10:00:00", "action": "phone_call"},
+      {"id": 2, "type": "message", "date": "2024-01-01T10:01:00", "date_unixtime": "1704103260",
+       "from": "Me", "from_id": "user1", "text": "Did you see "},
+      {"id": 3, "type": "message", "date": "2024-01-01T10:02:00", "date_unixtime": "1704103320",
+       "from": "Me", "from_id": "user1", "text": ["the ", {"type": "bold", "text": "photos"}, "?"]},
+      {"id": 4, "type": "message", "date": "2024-01-01T10:03:00", "date_unixtime": "1704103380",
+       "from": "Ana", "from_id": "user2", "photo": "photos/1.jpg", "text": "Yes"}
+    ]},
+    {"name": "Empty", "type": "private_group", "id": 3, "messages": []}
+  ]}
+}`
+
+func TestParseTelegram(t *testing.T) {
+	chats, err := ParseTelegram(strings.NewReader(telegramExportJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chats) != 1 {
+		t.Fatalf("want only the chat with messages, got %d", len(chats))
+	}
+	chat := chats[0]
+	if chat.Owner != "user1" || len(chat.Messages) != 3 {
+		t.Fatalf("unexpected chat %+v", chat)
+	}
+	if chat.Messages[1].Text != "the photos?" || chat.Messages[2].Text != "[photo] Yes" {
+		t.Errorf("unexpected texts %+v", chat.Messages)
+	}
+
+	turns := chat.Turns(0)
+	if len(turns) != 2 || turns[0].Role != "user" || turns[0].Content != "Did you see \nthe photos?" || turns[1].Role != "assistant" {
+		t.Errorf("unexpected turns %+v", turns)
+	}
+	if turns := chat.Turns(1); len(turns) != 1 || turns[0].Role != "assistant" {
+		t.Errorf("limit not applied: %+v", turns)
+	}
+}
+
+func TestSetOwner(t *testing.T) {
+	chat, _ := ParseWhatsApp(strings.NewReader(androidExport), "Ana")
+	if err := chat.SetOwner("Carl"); err == nil || !strings.Contains(err.Error(), "Ana, +49 151 2345678") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := chat.SetOwner("ana"); err != nil {
+		t.Fatal(err)
+	}
+	if turns := chat.Turns(0); turns[0].Role != "user" || turns[1].Role != "assistant" {
+		t.Errorf("unexpected turns %+v", turns)
+	}
+}
+
+func TestWriteMemory(t *testing.T) {
+	workspace := t.TempDir()
+	memoryPath := filepath.Join(workspace, "memory", "MEMORY.md")
+	os.MkdirAll(filepath.Dir(memoryPath), 0755)
+	os.WriteFile(memoryPath, []byte("# Long-term Memory\n\nLikes tea.\n"), 0644)
+
+	chat, _ := ParseWhatsApp(strings.NewReader(androidExport), "Ana")
+	chat.SetOwner("Ana")
+	transcript, err := WriteMemory(workspace, chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(transcript)
+	if !strings.Contains(string(data), "## 2023-12-31\n\n- 21:41 Ana: Happy new year!\n  See you tomorrow?\n") {
+		t.Errorf("unexpected transcript:\n%s", data)
+	}
+
+	// Importing again replaces the sections
+	chat.Messages = chat.Messages[:2]
+	if _, err := WriteMemory(workspace, chat); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(memoryPath)
+	want := "# Long-term Memory\n\nLikes tea.\n\n## Imported chat: Ana (WhatsApp)\n\n" +
+		"- Transcript: memory/imports/whatsapp-ana.md\n- 2 messages, 2023-12-31 to 2023-12-31\n- Participants: memory/CONTACTS.md\n"
+	if string(data) != want {
+		t.Errorf("unexpected memory:\n%s", data)
+	}
+	data, _ = os.ReadFile(filepath.Join(workspace, "memory", ContactsFile))
+	if strings.Count(string(data), "## Ana (WhatsApp)") != 1 ||
+		!strings.Contains(string(data), "- Ana (owner): 1 messages") ||
+		!strings.Contains(string(data), "- +49 151 2345678 (whatsapp 491512345678): 1 messages") {
+		t.Errorf("unexpected contacts:\n%s", data)
+	}
+}
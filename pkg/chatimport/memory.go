@@ -0,0 +1,152 @@
+package chatimport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Files written under the workspace's memory directory
+const (
+	ImportsDir   = "imports"     // One transcript per imported chat
+	ContactsFile = "CONTACTS.md" // The people known from imported chats
+	memoryFile   = "MEMORY.md"
+)
+
+// WriteMemory writes the full transcript of chat to memory/imports, lists
+// its participants in memory/CONTACTS.md and points to both from the
+// long-term memory. Importing a chat again replaces what its earlier import
+// wrote. It returns the path of the transcript.
+func WriteMemory(workspace string, chat *Chat) (string, error) {
+	memoryDir := filepath.Join(workspace, "memory")
+	if err := os.MkdirAll(filepath.Join(memoryDir, ImportsDir), 0755); err != nil {
+		return "", err
+	}
+
+	name := chat.Source + "-" + slug(chat.Title) + ".md"
+	transcript := filepath.Join(memoryDir, ImportsDir, name)
+	if err := os.WriteFile(transcript, []byte(chat.transcript()), 0644); err != nil {
+		return "", err
+	}
+
+	heading := fmt.Sprintf("%s (%s)", chat.Title, sourceName(chat.Source))
+	var contacts strings.Builder
+	for _, p := range chat.Participants() {
+		contacts.WriteString("- " + p.Name)
+		var notes []string
+		if p.ID != "" {
+			notes = append(notes, chat.Source+" "+p.ID)
+		}
+		if chat.isOwner(Message{Sender: p.Name, SenderID: p.ID}) {
+			notes = append(notes, "owner")
+		}
+		if len(notes) > 0 {
+			contacts.WriteString(" (" + strings.Join(notes, ", ") + ")")
+		}
+		fmt.Fprintf(&contacts, ": %d messages, %s to %s\n", p.Messages, day(p.First), day(p.Last))
+	}
+	if err := updateSection(filepath.Join(memoryDir, ContactsFile),
+		"# Contacts\n\nPeople known from imported chats, by chat.\n",
+		"## "+heading, contacts.String()); err != nil {
+		return "", err
+	}
+
+	first, last := chat.Messages[0].Time, chat.Messages[len(chat.Messages)-1].Time
+	summary := fmt.Sprintf("- Transcript: memory/%s/%s\n- %d messages, %s to %s\n- Participants: memory/%s\n",
+		ImportsDir, name, len(chat.Messages), day(first), day(last), ContactsFile)
+	if err := updateSection(filepath.Join(memoryDir, memoryFile), "",
+		"## Imported chat: "+heading, summary); err != nil {
+		return "", err
+	}
+	return transcript, nil
+}
+
+// transcript lays out all messages by day
+func (c *Chat) transcript() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s (%s)\n", c.Title, sourceName(c.Source))
+	current := ""
+	for _, msg := range c.Messages {
+		if d := day(msg.Time); d != current {
+			current = d
+			fmt.Fprintf(&sb, "\n## %s\n\n", d)
+		}
+		text := strings.ReplaceAll(msg.Text, "\n", "\n  ")
+		fmt.Fprintf(&sb, "- %s %s: %s\n", msg.Time.Format("15:04"), msg.Sender, text)
+	}
+	return sb.String()
+}
+
+// updateSection replaces the section under heading in the markdown file at
+// path, up to the next heading of the same level, or appends it. A missing
+// file starts with header.
+func updateSection(path, header, heading, body string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	doc := string(data)
+	if doc == "" {
+		doc = header
+	}
+	section := heading + "\n\n" + body
+
+	lines := strings.SplitAfter(doc, "\n")
+	start, end := -1, len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\n")
+		if start < 0 {
+			if trimmed == heading {
+				start = i
+			}
+		} else if strings.HasPrefix(trimmed, "## ") || strings.HasPrefix(trimmed, "# ") {
+			end = i
+			break
+		}
+	}
+
+	if start < 0 {
+		if doc != "" && !strings.HasSuffix(doc, "\n") {
+			doc += "\n"
+		}
+		if doc != "" {
+			doc += "\n"
+		}
+		doc += section
+	} else {
+		rest := strings.Join(lines[end:], "")
+		if rest != "" {
+			section += "\n"
+		}
+		doc = strings.Join(lines[:start], "") + section + rest
+	}
+	return os.WriteFile(path, []byte(doc), 0644)
+}
+
+var slugPattern = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// slug turns a chat title into a file name
+func slug(title string) string {
+	s := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if s == "" {
+		return "chat"
+	}
+	return s
+}
+
+func sourceName(source string) string {
+	switch source {
+	case SourceWhatsApp:
+		return "WhatsApp"
+	case SourceTelegram:
+		return "Telegram"
+	}
+	return source
+}
+
+func day(t time.Time) string {
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,159 @@
+package chatimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// telegramExport is the result.json of a Telegram Desktop export. An export
+// of one chat is the chat itself; an export of all chats lists them and
+// tells who exported them.
+type telegramExport struct {
+	telegramChat
+	PersonalInformation *struct {
+		UserID int64 `json:"user_id"`
+	} `json:"personal_information"`
+	Chats *struct {
+		List []telegramChat `json:"list"`
+	} `json:"chats"`
+}
+
+type telegramChat struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	ID       int64             `json:"id"`
+	Messages []telegramMessage `json:"messages"`
+}
+
+type telegramMessage struct {
+	Type          string          `json:"type"`
+	Date          string          `json:"date"`
+	DateUnixtime  string          `json:"date_unixtime"`
+	From          *string         `json:"from"`
+	FromID        string          `json:"from_id"`
+	Text          json.RawMessage `json:"text"`
+	Photo         string          `json:"photo"`
+	File          string          `json:"file"`
+	MediaType     string          `json:"media_type"`
+	StickerEmoji  string          `json:"sticker_emoji"`
+	ForwardedFrom string          `json:"forwarded_from"`
+}
+
+// ParseTelegram reads the result.json of a Telegram Desktop export in JSON
+// format. Service messages, like calls and pins, are left out. In an export
+// of all chats the exporting account is set as the owner of every chat.
+func ParseTelegram(r io.Reader) ([]*Chat, error) {
+	var export telegramExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("reading Telegram export: %w", err)
+	}
+
+	var raw []telegramChat
+	if export.Chats != nil {
+		raw = export.Chats.List
+	} else if export.Messages != nil {
+		raw = []telegramChat{export.telegramChat}
+	}
+	owner := ""
+	if info := export.PersonalInformation; info != nil && info.UserID != 0 {
+		owner = "user" + strconv.FormatInt(info.UserID, 10)
+	}
+
+	var chats []*Chat
+	for _, tc := range raw {
+		chat := &Chat{
+			Source: SourceTelegram,
+			Title:  tc.Name,
+			Group:  strings.Contains(tc.Type, "group") || strings.Contains(tc.Type, "channel"),
+		}
+		for _, tm := range tc.Messages {
+			if tm.Type != "message" {
+				continue
+			}
+			msg := Message{
+				Time:     tm.time(),
+				SenderID: tm.FromID,
+				Text:     tm.text(),
+			}
+			if tm.From != nil {
+				msg.Sender = *tm.From
+			}
+			if msg.Sender == "" {
+				msg.Sender = "Deleted Account"
+			}
+			if msg.Text == "" {
+				continue
+			}
+			chat.Messages = append(chat.Messages, msg)
+		}
+		if len(chat.Messages) == 0 {
+			continue
+		}
+		if chat.Title == "" {
+			chat.Title = "Saved Messages"
+		}
+		if owner != "" {
+			chat.Owner = owner
+		}
+		chats = append(chats, chat)
+	}
+	if len(chats) == 0 {
+		return nil, fmt.Errorf("no Telegram messages found")
+	}
+	return chats, nil
+}
+
+func (m *telegramMessage) time() time.Time {
+	if unix, err := strconv.ParseInt(m.DateUnixtime, 10, 64); err == nil {
+		return time.Unix(unix, 0)
+	}
+	// Older exports only have the local time
+	t, _ := time.ParseInLocation("2006-01-02T15:04:05", m.Date, time.Local)
+	return t
+}
+
+// text returns the message text with media as placeholders. Formatted text
+// is a list of plain strings and entities like {"type": "bold", "text": "hi"}.
+func (m *telegramMessage) text() string {
+	var sb strings.Builder
+	var plain string
+	var parts []json.RawMessage
+	if json.Unmarshal(m.Text, &plain) == nil {
+		sb.WriteString(plain)
+	} else if json.Unmarshal(m.Text, &parts) == nil {
+		for _, part := range parts {
+			var entity struct {
+				Text string `json:"text"`
+			}
+			if json.Unmarshal(part, &plain) == nil {
+				sb.WriteString(plain)
+			} else if json.Unmarshal(part, &entity) == nil {
+				sb.WriteString(entity.Text)
+			}
+		}
+	}
+
+	var media string
+	switch {
+	case m.Photo != "":
+		media = "[photo]"
+	case m.MediaType == "sticker":
+		media = strings.TrimSpace("[sticker "+m.StickerEmoji) + "]"
+	case m.MediaType != "":
+		media = "[" + strings.ReplaceAll(m.MediaType, "_", " ") + "]"
+	case m.File != "":
+		media = "[file]"
+	}
+	text := sb.String()
+	if media != "" {
+		text = strings.TrimSpace(media + " " + text)
+	}
+	if m.ForwardedFrom != "" {
+		text = "[forwarded from " + m.ForwardedFrom + "] " + text
+	}
+	return text
+}
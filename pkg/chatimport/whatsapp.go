@@ -0,0 +1,163 @@
+package chatimport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// whatsAppLine matches the first line of a message in both export layouts:
+//
+//	12/31/23, 9:41 PM - Ana: Hello          (Android)
+//	[31/12/2023, 21:41:05] Ana: Hello       (iOS)
+var whatsAppLine = regexp.MustCompile(`^\[?(\d{1,4})[./-](\d{1,2})[./-](\d{1,4}),? (\d{1,2})[:.](\d{2})(?:[:.](\d{2}))?(?: ?([AaPp])\.? ?[Mm]\.?)?\]?(?: -)? (.*)$`)
+
+// whatsAppMedia maps the placeholders of omitted or attached media
+var whatsAppMedia = regexp.MustCompile(`^(?:<Media omitted>|<attached: .+>|.+ \(file attached\))$`)
+
+// whatsAppInvisible drops the direction marks iOS puts around names and
+// media, and turns the narrow spaces before AM and PM into plain ones
+var whatsAppInvisible = strings.NewReplacer("\u200e", "", "\u200f", "", "\u202f", " ", "\u00a0", " ")
+
+// whatsAppEntry is a message line before its date is known to be day or
+// month first
+type whatsAppEntry struct {
+	a, b, c    int // Date fields in the order written
+	hour, min  int
+	sec        int
+	pm, twelve bool // twelve is set for 12-hour clocks
+	rest       string
+}
+
+// ParseWhatsApp reads the text of a WhatsApp chat export. Lines without a
+// sender, like "Ana added Ben", are left out.
+func ParseWhatsApp(r io.Reader, title string) (*Chat, error) {
+	var entries []whatsAppEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := whatsAppInvisible.Replace(scanner.Text())
+		line = strings.TrimSuffix(line, "\r")
+		m := whatsAppLine.FindStringSubmatch(line)
+		if m == nil {
+			if n := len(entries); n > 0 {
+				entries[n-1].rest += "\n" + line
+			}
+			continue
+		}
+		entry := whatsAppEntry{rest: m[8]}
+		entry.a, _ = strconv.Atoi(m[1])
+		entry.b, _ = strconv.Atoi(m[2])
+		entry.c, _ = strconv.Atoi(m[3])
+		entry.hour, _ = strconv.Atoi(m[4])
+		entry.min, _ = strconv.Atoi(m[5])
+		entry.sec, _ = strconv.Atoi(m[6])
+		if m[7] != "" {
+			entry.twelve = true
+			entry.pm = strings.EqualFold(m[7], "p")
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no WhatsApp messages found")
+	}
+
+	dayFirst := whatsAppDayFirst(entries)
+	chat := &Chat{Source: SourceWhatsApp, Title: title}
+	for _, entry := range entries {
+		sender, text, ok := strings.Cut(entry.rest, ": ")
+		if !ok {
+			continue
+		}
+		if whatsAppMedia.MatchString(strings.TrimSpace(text)) {
+			text = "[media]"
+		}
+		chat.Messages = append(chat.Messages, Message{
+			Time:     entry.time(dayFirst),
+			Sender:   sender,
+			SenderID: whatsAppSenderID(sender),
+			Text:     text,
+		})
+	}
+	if len(chat.Messages) == 0 {
+		return nil, fmt.Errorf("no WhatsApp messages found")
+	}
+
+	senders := make(map[string]bool)
+	for _, msg := range chat.Messages {
+		senders[msg.Sender] = true
+	}
+	chat.Group = len(senders) > 2
+	if chat.Title == "" {
+		chat.Title = chat.Messages[0].Sender
+	}
+	return chat, nil
+}
+
+// whatsAppDayFirst guesses from all dates whether they are written day
+// first, as the export follows the phone's locale
+func whatsAppDayFirst(entries []whatsAppEntry) bool {
+	twelve := false
+	for _, entry := range entries {
+		if entry.a > 31 {
+			// Year first
+			return false
+		}
+		if entry.a > 12 {
+			return true
+		}
+		if entry.b > 12 {
+			return false
+		}
+		twelve = twelve || entry.twelve
+	}
+	// 12-hour clocks mostly come with month-first dates
+	return !twelve
+}
+
+func (e whatsAppEntry) time(dayFirst bool) time.Time {
+	year, month, day := e.c, e.b, e.a
+	switch {
+	case e.a > 31:
+		year, month, day = e.a, e.b, e.c
+	case !dayFirst:
+		month, day = e.a, e.b
+	}
+	if year < 100 {
+		year += 2000
+	}
+	hour := e.hour
+	if e.twelve {
+		hour %= 12
+		if e.pm {
+			hour += 12
+		}
+	}
+	return time.Date(year, time.Month(month), day, hour, e.min, e.sec, 0, time.Local)
+}
+
+// whatsAppSenderID returns the digits of senders shown by phone number,
+// which is how WhatsApp shows contacts not in the address book
+func whatsAppSenderID(sender string) string {
+	if !strings.HasPrefix(sender, "+") {
+		return ""
+	}
+	var digits strings.Builder
+	for _, r := range sender[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')':
+		default:
+			return ""
+		}
+	}
+	return digits.String()
+}
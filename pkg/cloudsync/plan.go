@@ -0,0 +1,137 @@
+package cloudsync
+
+import (
+	"sort"
+	"time"
+)
+
+// Sync directions
+const (
+	DirectionBoth     = "both"
+	DirectionUpload   = "upload"   // Only local changes are copied
+	DirectionDownload = "download" // Only remote changes are copied
+)
+
+// Conflict policies, for files changed on both sides since the last sync
+const (
+	ConflictNewer    = "newer"     // The side changed last wins
+	ConflictLocal    = "local"     // The workspace wins
+	ConflictRemote   = "remote"    // Cloud storage wins
+	ConflictKeepBoth = "keep_both" // The remote file is kept beside the local one
+)
+
+// record is the state of a file when it was last synced
+type record struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"` // Local modification time
+	Hash    string    `json:"hash"`     // Hex MD5 of the content
+	Version string    `json:"version"`  // Remote version
+}
+
+// localFile is a workspace file found by a scan
+type localFile struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string
+}
+
+type actionKind int
+
+const (
+	actUpload actionKind = iota
+	actDownload
+	actDeleteLocal
+	actDeleteRemote
+	actKeepBoth // Download the remote file beside the local one, then upload the local one
+	actRecord   // Both sides hold the same content
+	actForget   // Deleted on both sides
+)
+
+// action is one step of a sync run
+type action struct {
+	kind     actionKind
+	path     string
+	conflict bool // The file changed on both sides
+}
+
+// plan compares both sides with the records of the last sync and returns
+// the steps that bring them together, ordered by path
+func plan(local map[string]localFile, remote map[string]RemoteFile, records map[string]record, direction, policy string) []action {
+	paths := make(map[string]bool, len(local)+len(remote)+len(records))
+	for p := range local {
+		paths[p] = true
+	}
+	for p := range remote {
+		paths[p] = true
+	}
+	for p := range records {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var actions []action
+	for _, p := range sorted {
+		l, lok := local[p]
+		r, rok := remote[p]
+		rec, seen := records[p]
+
+		localChanged := lok != seen || (lok && l.Hash != rec.Hash)
+		remoteChanged := rok != seen || (rok && r.Version != rec.Version)
+		switch direction {
+		case DirectionUpload:
+			remoteChanged = false
+		case DirectionDownload:
+			localChanged = false
+		}
+
+		switch {
+		case !localChanged && !remoteChanged:
+			continue
+		case !lok && !rok:
+			actions = append(actions, action{kind: actForget, path: p})
+		case localChanged && !remoteChanged:
+			if lok {
+				actions = append(actions, action{kind: actUpload, path: p})
+			} else {
+				actions = append(actions, action{kind: actDeleteRemote, path: p})
+			}
+		case remoteChanged && !localChanged:
+			if rok {
+				actions = append(actions, action{kind: actDownload, path: p})
+			} else {
+				actions = append(actions, action{kind: actDeleteLocal, path: p})
+			}
+		case lok && rok && r.Hash != "" && r.Hash == l.Hash:
+			actions = append(actions, action{kind: actRecord, path: p})
+		case !lok:
+			// A deletion never wins over a change
+			actions = append(actions, action{kind: actDownload, path: p, conflict: true})
+		case !rok:
+			actions = append(actions, action{kind: actUpload, path: p, conflict: true})
+		default:
+			actions = append(actions, action{kind: resolveConflict(l, r, policy), path: p, conflict: true})
+		}
+	}
+	return actions
+}
+
+// resolveConflict picks the step for a file changed on both sides
+func resolveConflict(l localFile, r RemoteFile, policy string) actionKind {
+	switch policy {
+	case ConflictLocal:
+		return actUpload
+	case ConflictRemote:
+		return actDownload
+	case ConflictKeepBoth:
+		return actKeepBoth
+	default:
+		if l.ModTime.After(r.ModTime) {
+			return actUpload
+		}
+		return actDownload
+	}
+}
@@ -0,0 +1,125 @@
+package cloudsync
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	older := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	rec := record{Hash: "h1", Version: "v1"}
+
+	tests := []struct {
+		name      string
+		local     map[string]localFile
+		remote    map[string]RemoteFile
+		records   map[string]record
+		direction string
+		policy    string
+		want      []action
+	}{
+		{
+			name:    "unchanged",
+			local:   map[string]localFile{"a": {Hash: "h1"}},
+			remote:  map[string]RemoteFile{"a": {Version: "v1"}},
+			records: map[string]record{"a": rec},
+		},
+		{
+			name:   "new on each side",
+			local:  map[string]localFile{"a": {Hash: "h1"}},
+			remote: map[string]RemoteFile{"b": {Version: "v2"}},
+			want:   []action{{kind: actUpload, path: "a"}, {kind: actDownload, path: "b"}},
+		},
+		{
+			name:    "changed locally",
+			local:   map[string]localFile{"a": {Hash: "h2"}},
+			remote:  map[string]RemoteFile{"a": {Version: "v1"}},
+			records: map[string]record{"a": rec},
+			want:    []action{{kind: actUpload, path: "a"}},
+		},
+		{
+			name:    "deleted locally",
+			remote:  map[string]RemoteFile{"a": {Version: "v1"}},
+			records: map[string]record{"a": rec},
+			want:    []action{{kind: actDeleteRemote, path: "a"}},
+		},
+		{
+			name:    "deleted remotely",
+			local:   map[string]localFile{"a": {Hash: "h1"}},
+			records: map[string]record{"a": rec},
+			want:    []action{{kind: actDeleteLocal, path: "a"}},
+		},
+		{
+			name:    "deleted on both sides",
+			records: map[string]record{"a": rec},
+			want:    []action{{kind: actForget, path: "a"}},
+		},
+		{
+			name:   "same content on both sides",
+			local:  map[string]localFile{"a": {Hash: "h1"}},
+			remote: map[string]RemoteFile{"a": {Version: "v1", Hash: "h1"}},
+			want:   []action{{kind: actRecord, path: "a"}},
+		},
+		{
+			name:    "change wins over deletion",
+			remote:  map[string]RemoteFile{"a": {Version: "v2"}},
+			records: map[string]record{"a": rec},
+			want:    []action{{kind: actDownload, path: "a", conflict: true}},
+		},
+		{
+			name:    "newer local change wins",
+			local:   map[string]localFile{"a": {Hash: "h2", ModTime: newer}},
+			remote:  map[string]RemoteFile{"a": {Version: "v2", ModTime: older}},
+			records: map[string]record{"a": rec},
+			want:    []action{{kind: actUpload, path: "a", conflict: true}},
+		},
+		{
+			name:    "newer remote change wins",
+			local:   map[string]localFile{"a": {Hash: "h2", ModTime: older}},
+			remote:  map[string]RemoteFile{"a": {Version: "v2", ModTime: newer}},
+			records: map[string]record{"a": rec},
+			want:    []action{{kind: actDownload, path: "a", conflict: true}},
+		},
+		{
+			name:    "keep both",
+			local:   map[string]localFile{"a": {Hash: "h2"}},
+			remote:  map[string]RemoteFile{"a": {Version: "v2"}},
+			records: map[string]record{"a": rec},
+			policy:  ConflictKeepBoth,
+			want:    []action{{kind: actKeepBoth, path: "a", conflict: true}},
+		},
+		{
+			name:      "upload ignores remote changes",
+			local:     map[string]localFile{"a": {Hash: "h1"}, "b": {Hash: "h2"}},
+			remote:    map[string]RemoteFile{"a": {Version: "v2"}, "c": {Version: "v3"}},
+			records:   map[string]record{"a": rec},
+			direction: DirectionUpload,
+			want:      []action{{kind: actUpload, path: "b"}},
+		},
+		{
+			name:      "download overrides local changes",
+			local:     map[string]localFile{"a": {Hash: "h2", ModTime: newer}, "b": {Hash: "h3"}},
+			remote:    map[string]RemoteFile{"a": {Version: "v2", ModTime: older}},
+			records:   map[string]record{"a": rec},
+			direction: DirectionDownload,
+			want:      []action{{kind: actDownload, path: "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			direction, policy := tt.direction, tt.policy
+			if direction == "" {
+				direction = DirectionBoth
+			}
+			if policy == "" {
+				policy = ConflictNewer
+			}
+			got := plan(tt.local, tt.remote, tt.records, direction, policy)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package cloudsync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/s3"
+)
+
+// Storage backends
+const (
+	BackendS3     = "s3"
+	BackendWebDAV = "webdav"
+)
+
+// RemoteFile describes a file in cloud storage
+type RemoteFile struct {
+	Size    int64
+	ModTime time.Time
+	// Version changes whenever the content does: the ETag, or the size and
+	// time when the store has none
+	Version string
+	// Hash is the hex MD5 of the content when the store reveals it
+	Hash string
+}
+
+// Remote is cloud storage holding a copy of the workspace. Paths are
+// slash separated and relative to the synced folder.
+type Remote interface {
+	List(ctx context.Context) (map[string]RemoteFile, error)
+	Get(ctx context.Context, path string) (io.ReadCloser, error)
+	// Put stores data and returns the new version of the file
+	Put(ctx context.Context, path string, data []byte) (string, error)
+	Delete(ctx context.Context, path string) error
+}
+
+// NewRemote creates the remote for the backend in cfg, sending its
+// requests through hc
+func NewRemote(cfg config.WorkspaceSyncConfig, hc *http.Client) (Remote, error) {
+	switch cfg.Backend {
+	case BackendS3:
+		client, err := s3.New(cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		client.SetHTTPClient(hc)
+		return &s3Remote{client: client, prefix: s3Prefix(cfg.S3.Prefix)}, nil
+	case BackendWebDAV:
+		return newWebDAVRemote(cfg.WebDAV, hc)
+	default:
+		return nil, fmt.Errorf("%w: unknown workspace sync backend %q", errs.ErrValidation, cfg.Backend)
+	}
+}
+
+// s3Prefix turns the configured prefix into a folder prefix, "" or "dir/"
+func s3Prefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// md5ETag matches ETags of objects uploaded in one part, which are the MD5
+// of their content
+var md5ETag = regexp.MustCompile(`^"?([0-9a-f]{32})"?$`)
+
+// s3Remote keeps the workspace under a prefix of a bucket
+type s3Remote struct {
+	client *s3.Client
+	prefix string
+}
+
+func (r *s3Remote) List(ctx context.Context) (map[string]RemoteFile, error) {
+	objects, err := r.client.List(ctx, r.prefix)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]RemoteFile, len(objects))
+	for _, obj := range objects {
+		path := strings.TrimPrefix(obj.Key, r.prefix)
+		// Folder placeholders created by some clients
+		if path == "" || strings.HasSuffix(path, "/") {
+			continue
+		}
+		file := RemoteFile{Size: obj.Size, ModTime: obj.LastModified, Version: obj.ETag}
+		if m := md5ETag.FindStringSubmatch(obj.ETag); m != nil {
+			file.Hash = m[1]
+		}
+		files[path] = file
+	}
+	return files, nil
+}
+
+func (r *s3Remote) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	return r.client.Get(ctx, r.prefix+path)
+}
+
+func (r *s3Remote) Put(ctx context.Context, path string, data []byte) (string, error) {
+	return r.client.Put(ctx, r.prefix+path, data, "")
+}
+
+func (r *s3Remote) Delete(ctx context.Context, path string) error {
+	return r.client.Delete(ctx, r.prefix+path)
+}
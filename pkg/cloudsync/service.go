@@ -0,0 +1,498 @@
+// Package cloudsync keeps the agent workspace in sync with cloud storage,
+// so files the agent creates on the device appear in the user's S3 bucket
+// or WebDAV folder, and files added there reach the agent.
+package cloudsync
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	defaultInterval = 5 * time.Minute
+	// watchInterval is how often the workspace is checked for changes
+	// when syncing on change
+	watchInterval = 5 * time.Second
+	// stateDir holds machine-local state, including the sync records, and
+	// is never synced
+	stateDir  = "state"
+	stateFile = "workspace_sync.json"
+	// tempPrefix starts the names of files being downloaded
+	tempPrefix = ".picoclaw-sync-"
+)
+
+// Result counts what a sync run did
+type Result struct {
+	Uploaded      int
+	Downloaded    int
+	DeletedLocal  int
+	DeletedRemote int
+	Conflicts     int
+	Failed        int
+}
+
+// Service syncs a workspace with a remote on a schedule
+type Service struct {
+	workspace string
+	remote    Remote
+	direction string
+	policy    string
+	exclude   []string
+	interval  time.Duration
+	onChange  bool
+
+	mu      sync.Mutex // Held during a sync run
+	records map[string]record
+	cancel  context.CancelFunc
+	done    chan struct{}
+	now     func() time.Time
+}
+
+// NewService creates the sync service described by cfg
+func NewService(cfg config.WorkspaceSyncConfig, workspace string) (*Service, error) {
+	remote, err := NewRemote(cfg, newHTTPClient(cfg.UploadKBps, cfg.DownloadKBps))
+	if err != nil {
+		return nil, err
+	}
+	return newService(cfg, workspace, remote)
+}
+
+func newService(cfg config.WorkspaceSyncConfig, workspace string, remote Remote) (*Service, error) {
+	direction := cfg.Direction
+	switch direction {
+	case "":
+		direction = DirectionBoth
+	case DirectionBoth, DirectionUpload, DirectionDownload:
+	default:
+		return nil, fmt.Errorf("%w: unknown workspace sync direction %q", errs.ErrValidation, direction)
+	}
+	policy := cfg.Conflict
+	switch policy {
+	case "":
+		policy = ConflictNewer
+	case ConflictNewer, ConflictLocal, ConflictRemote, ConflictKeepBoth:
+	default:
+		return nil, fmt.Errorf("%w: unknown workspace sync conflict policy %q", errs.ErrValidation, policy)
+	}
+	for _, pattern := range cfg.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: invalid workspace sync exclude pattern %q", errs.ErrValidation, pattern)
+		}
+	}
+
+	s := &Service{
+		workspace: workspace,
+		remote:    remote,
+		direction: direction,
+		policy:    policy,
+		exclude:   cfg.Exclude,
+		interval:  time.Duration(cfg.IntervalSeconds) * time.Second,
+		onChange:  cfg.OnChange,
+		records:   make(map[string]record),
+		now:       time.Now,
+	}
+	if s.interval <= 0 {
+		s.interval = defaultInterval
+	}
+	if err := s.loadRecords(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start syncs once, then every interval and, when enabled, after local
+// changes, until Stop is called or ctx is done
+func (s *Service) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	go s.run(ctx)
+	logger.InfoCF("sync", "Workspace sync started", map[string]interface{}{
+		"direction": s.direction,
+		"interval":  s.interval.String(),
+		"on_change": s.onChange,
+	})
+}
+
+// Stop ends the schedule, waiting for a running sync to give up
+func (s *Service) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	s.cancel = nil
+	logger.InfoC("sync", "Workspace sync stopped")
+}
+
+func (s *Service) run(ctx context.Context) {
+	defer close(s.done)
+
+	s.syncAndLog(ctx)
+	synced := s.fingerprint()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	var watch <-chan time.Time
+	if s.onChange {
+		watcher := time.NewTicker(watchInterval)
+		defer watcher.Stop()
+		watch = watcher.C
+	}
+
+	last := synced
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-watch:
+			// Wait for the workspace to settle before syncing a change
+			fp := s.fingerprint()
+			settled := fp == last
+			last = fp
+			if fp == synced || !settled {
+				continue
+			}
+		}
+		s.syncAndLog(ctx)
+		synced = s.fingerprint()
+		last = synced
+	}
+}
+
+func (s *Service) syncAndLog(ctx context.Context) {
+	res, err := s.Sync(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.ErrorCF("sync", "Workspace sync failed", map[string]interface{}{"error": err.Error()})
+		}
+		return
+	}
+	if res == (Result{}) {
+		return
+	}
+	logger.InfoCF("sync", "Workspace synced", map[string]interface{}{
+		"uploaded":       res.Uploaded,
+		"downloaded":     res.Downloaded,
+		"deleted_local":  res.DeletedLocal,
+		"deleted_remote": res.DeletedRemote,
+		"conflicts":      res.Conflicts,
+		"failed":         res.Failed,
+	})
+}
+
+// Sync runs one sync. Files that fail are logged, counted and retried on
+// the next run; the error is for failures of the whole run.
+func (s *Service) Sync(ctx context.Context) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res Result
+	local, err := s.scan()
+	if err != nil {
+		return res, fmt.Errorf("scan workspace: %w", err)
+	}
+	listed, err := s.remote.List(ctx)
+	if err != nil {
+		return res, fmt.Errorf("list remote: %w", err)
+	}
+	remote := make(map[string]RemoteFile, len(listed))
+	for p, f := range listed {
+		if !s.excluded(p) {
+			remote[p] = f
+		}
+	}
+
+	for _, act := range plan(local, remote, s.records, s.direction, s.policy) {
+		if ctx.Err() != nil {
+			break
+		}
+		if act.conflict {
+			res.Conflicts++
+		}
+		if err := s.apply(ctx, act, local[act.path], remote[act.path], &res); err != nil {
+			res.Failed++
+			logger.WarnCF("sync", "Workspace sync skipped a file", map[string]interface{}{
+				"path":  act.path,
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if err := s.saveRecords(); err != nil {
+		return res, err
+	}
+	return res, ctx.Err()
+}
+
+// apply carries out one step and updates the records
+func (s *Service) apply(ctx context.Context, act action, l localFile, r RemoteFile, res *Result) error {
+	switch act.kind {
+	case actUpload:
+		if err := s.upload(ctx, act.path, l); err != nil {
+			return err
+		}
+		res.Uploaded++
+	case actDownload:
+		if err := s.download(ctx, act.path, act.path, r); err != nil {
+			return err
+		}
+		res.Downloaded++
+	case actDeleteLocal:
+		if err := os.Remove(s.localPath(act.path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(s.records, act.path)
+		res.DeletedLocal++
+	case actDeleteRemote:
+		if err := s.remote.Delete(ctx, act.path); err != nil {
+			return err
+		}
+		delete(s.records, act.path)
+		res.DeletedRemote++
+	case actKeepBoth:
+		copyPath := conflictPath(act.path, s.now())
+		if err := s.download(ctx, act.path, copyPath, r); err != nil {
+			return err
+		}
+		res.Downloaded++
+		if kept := s.records[copyPath]; kept.Hash == l.Hash {
+			// Same content after all: keep one file
+			os.Remove(s.localPath(copyPath))
+			delete(s.records, copyPath)
+			s.records[act.path] = record{Size: l.Size, ModTime: l.ModTime, Hash: l.Hash, Version: r.Version}
+			res.Downloaded--
+			res.Conflicts--
+			return nil
+		}
+		// The copy is uploaded as a new file by the next run
+		delete(s.records, copyPath)
+		if err := s.upload(ctx, act.path, l); err != nil {
+			return err
+		}
+		res.Uploaded++
+	case actRecord:
+		s.records[act.path] = record{Size: l.Size, ModTime: l.ModTime, Hash: l.Hash, Version: r.Version}
+	case actForget:
+		delete(s.records, act.path)
+	}
+	return nil
+}
+
+func (s *Service) upload(ctx context.Context, rel string, l localFile) error {
+	data, err := os.ReadFile(s.localPath(rel))
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(data)
+	version, err := s.remote.Put(ctx, rel, data)
+	if err != nil {
+		return err
+	}
+	// The file may have changed since the scan; record what was sent
+	s.records[rel] = record{Size: l.Size, ModTime: l.ModTime, Hash: hex.EncodeToString(sum[:]), Version: version}
+	return nil
+}
+
+// download writes the remote file rel to the local path dest, through a
+// temporary file so readers never see a partial file
+func (s *Service) download(ctx context.Context, rel, dest string, r RemoteFile) error {
+	body, err := s.remote.Get(ctx, rel)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	target := s.localPath(dest)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	s.records[dest] = record{Size: info.Size(), ModTime: info.ModTime(), Hash: hex.EncodeToString(h.Sum(nil)), Version: r.Version}
+	return nil
+}
+
+// scan lists the workspace files that are synced. Files unchanged since
+// their record keep its hash instead of being read again.
+func (s *Service) scan() (map[string]localFile, error) {
+	files := make(map[string]localFile)
+	err := s.walk(func(rel string, info fs.FileInfo) error {
+		f := localFile{Size: info.Size(), ModTime: info.ModTime()}
+		if rec, ok := s.records[rel]; ok && rec.Size == f.Size && rec.ModTime.Equal(f.ModTime) {
+			f.Hash = rec.Hash
+		} else {
+			hash, err := fileMD5(s.localPath(rel))
+			if err != nil {
+				return err
+			}
+			f.Hash = hash
+		}
+		files[rel] = f
+		return nil
+	})
+	return files, err
+}
+
+// fingerprint summarizes the names, sizes and times of the synced files,
+// to notice local changes cheaply
+func (s *Service) fingerprint() uint64 {
+	h := fnv.New64a()
+	s.walk(func(rel string, info fs.FileInfo) error {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", rel, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64()
+}
+
+// walk calls fn for every regular workspace file that is not excluded,
+// with its slash separated path
+func (s *Service) walk(fn func(rel string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(s.workspace, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(s.workspace, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if s.excluded(rel) || strings.HasPrefix(d.Name(), tempPrefix) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(rel, info)
+	})
+}
+
+// excluded reports whether a workspace path is left out of the sync.
+// Patterns without a slash match any path element, e.g. "*.tmp"; others
+// match the path or one of its folders, e.g. "media/telegram".
+func (s *Service) excluded(rel string) bool {
+	if rel == stateDir || strings.HasPrefix(rel, stateDir+"/") {
+		return true
+	}
+	parts := strings.Split(rel, "/")
+	for _, pattern := range s.exclude {
+		if !strings.Contains(pattern, "/") {
+			for _, part := range parts {
+				if ok, _ := path.Match(pattern, part); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for i := range parts {
+			if ok, _ := path.Match(strings.Trim(pattern, "/"), strings.Join(parts[:i+1], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Service) localPath(rel string) string {
+	return filepath.Join(s.workspace, filepath.FromSlash(rel))
+}
+
+func (s *Service) recordsPath() string {
+	return filepath.Join(s.workspace, stateDir, stateFile)
+}
+
+func (s *Service) loadRecords() error {
+	data, err := os.ReadFile(s.recordsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &s.records); err != nil {
+		return fmt.Errorf("workspace sync records: %w", err)
+	}
+	return nil
+}
+
+// saveRecords writes the records atomically
+func (s *Service) saveRecords() error {
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return err
+	}
+	target := s.recordsPath()
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// conflictPath names the copy of a conflicting remote file, e.g.
+// "notes.conflict-20260302-093000.md" for "notes.md"
+func conflictPath(rel string, t time.Time) string {
+	ext := path.Ext(rel)
+	return strings.TrimSuffix(rel, ext) + ".conflict-" + t.Format("20060102-150405") + ext
+}
+
+func fileMD5(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,223 @@
+package cloudsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+)
+
+// memRemote is cloud storage in memory
+type memRemote struct {
+	files   map[string][]byte
+	mtimes  map[string]time.Time
+	failPut string // Path whose upload fails
+}
+
+func newMemRemote() *memRemote {
+	return &memRemote{files: make(map[string][]byte), mtimes: make(map[string]time.Time)}
+}
+
+func (m *memRemote) set(path, content string, mtime time.Time) {
+	m.files[path] = []byte(content)
+	m.mtimes[path] = mtime
+}
+
+func (m *memRemote) List(ctx context.Context) (map[string]RemoteFile, error) {
+	files := make(map[string]RemoteFile)
+	for p, data := range m.files {
+		sum := md5.Sum(data)
+		files[p] = RemoteFile{Size: int64(len(data)), ModTime: m.mtimes[p], Version: hex.EncodeToString(sum[:]), Hash: hex.EncodeToString(sum[:])}
+	}
+	return files, nil
+}
+
+func (m *memRemote) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	data, ok := m.files[path]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memRemote) Put(ctx context.Context, path string, data []byte) (string, error) {
+	if path == m.failPut {
+		return "", errors.New("upload failed")
+	}
+	m.set(path, string(data), time.Now())
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (m *memRemote) Delete(ctx context.Context, path string) error {
+	delete(m.files, path)
+	return nil
+}
+
+func writeFile(t *testing.T, workspace, rel, content string) {
+	t.Helper()
+	p := filepath.Join(workspace, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, workspace, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(workspace, filepath.FromSlash(rel)))
+	if err != nil {
+		return "<missing>"
+	}
+	return string(data)
+}
+
+func TestServiceSyncBothWays(t *testing.T) {
+	workspace := t.TempDir()
+	remote := newMemRemote()
+	cfg := config.WorkspaceSyncConfig{Exclude: config.FlexibleStringSlice{"*.tmp", "media/telegram"}}
+	s, err := newService(cfg, workspace, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, workspace, "notes/todo.md", "buy milk")
+	writeFile(t, workspace, "scratch.tmp", "skip")
+	writeFile(t, workspace, "media/telegram/photo.jpg", "skip")
+	writeFile(t, workspace, "state/state.json", "{}")
+	remote.set("reports/weekly.txt", "all good", time.Now())
+
+	res, err := s.Sync(context.Background())
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if res.Uploaded != 1 || res.Downloaded != 1 {
+		t.Errorf("result = %+v, want one upload and one download", res)
+	}
+	if string(remote.files["notes/todo.md"]) != "buy milk" || len(remote.files) != 2 {
+		t.Errorf("remote files = %v", remote.files)
+	}
+	if got := readFile(t, workspace, "reports/weekly.txt"); got != "all good" {
+		t.Errorf("downloaded file = %q", got)
+	}
+
+	// Nothing changed
+	if res, err := s.Sync(context.Background()); err != nil || res != (Result{}) {
+		t.Errorf("second Sync() = %+v, %v; want no work", res, err)
+	}
+
+	// Deletions travel both ways, and survive a restart
+	os.Remove(filepath.Join(workspace, "notes", "todo.md"))
+	delete(remote.files, "reports/weekly.txt")
+	s, err = newService(cfg, workspace, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = s.Sync(context.Background())
+	if err != nil || res.DeletedLocal != 1 || res.DeletedRemote != 1 {
+		t.Errorf("Sync() = %+v, %v; want a deletion on each side", res, err)
+	}
+	if readFile(t, workspace, "reports/weekly.txt") != "<missing>" || len(remote.files) != 0 {
+		t.Errorf("deletions not applied: remote %v", remote.files)
+	}
+}
+
+func TestServiceKeepBoth(t *testing.T) {
+	workspace := t.TempDir()
+	remote := newMemRemote()
+	s, err := newService(config.WorkspaceSyncConfig{Conflict: ConflictKeepBoth}, workspace, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC) }
+
+	writeFile(t, workspace, "notes.md", "v1")
+	if _, err := s.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, workspace, "notes.md", "local edit")
+	remote.set("notes.md", "remote edit", time.Now())
+
+	res, err := s.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Conflicts != 1 {
+		t.Errorf("result = %+v, want a conflict", res)
+	}
+	if got := readFile(t, workspace, "notes.conflict-20260302-093000.md"); got != "remote edit" {
+		t.Errorf("conflict copy = %q", got)
+	}
+	if string(remote.files["notes.md"]) != "local edit" {
+		t.Errorf("remote notes.md = %q, want the local edit", remote.files["notes.md"])
+	}
+
+	// The copy reaches cloud storage on the next run
+	if _, err := s.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if string(remote.files["notes.conflict-20260302-093000.md"]) != "remote edit" {
+		t.Errorf("remote files = %v", remote.files)
+	}
+}
+
+func TestServiceRetriesFailedUploads(t *testing.T) {
+	workspace := t.TempDir()
+	remote := newMemRemote()
+	remote.failPut = "a.txt"
+	s, err := newService(config.WorkspaceSyncConfig{}, workspace, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, workspace, "a.txt", "data")
+
+	res, err := s.Sync(context.Background())
+	if err != nil || res.Failed != 1 {
+		t.Fatalf("Sync() = %+v, %v; want one failure", res, err)
+	}
+	remote.failPut = ""
+	res, err = s.Sync(context.Background())
+	if err != nil || res.Uploaded != 1 || string(remote.files["a.txt"]) != "data" {
+		t.Errorf("Sync() = %+v, %v; want the upload retried", res, err)
+	}
+}
+
+func TestNewServiceValidation(t *testing.T) {
+	for _, cfg := range []config.WorkspaceSyncConfig{
+		{Direction: "sideways"},
+		{Conflict: "coin_flip"},
+		{Exclude: config.FlexibleStringSlice{"[a-"}},
+	} {
+		if _, err := newService(cfg, t.TempDir(), newMemRemote()); !errors.Is(err, errs.ErrValidation) {
+			t.Errorf("newService(%+v) error = %v, want a validation error", cfg, err)
+		}
+	}
+	if _, err := NewService(config.WorkspaceSyncConfig{Backend: "ftp"}, t.TempDir()); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("unknown backend error = %v", err)
+	}
+}
+
+func TestConflictPath(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	for rel, want := range map[string]string{
+		"notes.md":       "notes.conflict-20260302-093000.md",
+		"docs/README":    "docs/README.conflict-20260302-093000",
+		"a.b/archive.gz": "a.b/archive.conflict-20260302-093000.gz",
+	} {
+		if got := conflictPath(rel, at); got != want {
+			t.Errorf("conflictPath(%q) = %q, want %q", rel, got, want)
+		}
+	}
+}
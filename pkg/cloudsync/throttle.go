@@ -0,0 +1,112 @@
+package cloudsync
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// throttleChunk is the most read at once, so transfers stay smooth
+const throttleChunk = 16 * 1024
+
+// limiter paces transfers to a number of bytes per second. It is shared
+// by all transfers in one direction.
+type limiter struct {
+	rate int // Bytes per second
+
+	mu   sync.Mutex
+	next time.Time // When the bytes handed out so far have been paid for
+	now  func() time.Time
+}
+
+// newLimiter returns nil when kbps is not positive, meaning no limit
+func newLimiter(kbps int) *limiter {
+	if kbps <= 0 {
+		return nil
+	}
+	return &limiter{rate: kbps * 1024, now: time.Now}
+}
+
+// wait blocks until n more bytes fit the rate
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.rate))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledBody reads through a limiter
+type throttledBody struct {
+	ctx context.Context
+	rc  io.ReadCloser
+	lim *limiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := b.rc.Read(p)
+	if n > 0 {
+		if werr := b.lim.wait(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (b *throttledBody) Close() error {
+	return b.rc.Close()
+}
+
+// throttledTransport limits the bandwidth of request bodies (uploads) and
+// response bodies (downloads)
+type throttledTransport struct {
+	base     http.RoundTripper
+	upload   *limiter // nil means no limit
+	download *limiter
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.upload != nil && req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &throttledBody{ctx: req.Context(), rc: req.Body, lim: t.upload}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || t.download == nil {
+		return resp, err
+	}
+	resp.Body = &throttledBody{ctx: req.Context(), rc: resp.Body, lim: t.download}
+	return resp, nil
+}
+
+// newHTTPClient returns a client limited to the given rates in KiB/s. It
+// has no timeout, as throttled transfers of large files take long; sync
+// runs bound their requests with contexts instead.
+func newHTTPClient(uploadKBps, downloadKBps int) *http.Client {
+	return &http.Client{
+		Transport: &throttledTransport{
+			base:     http.DefaultTransport,
+			upload:   newLimiter(uploadKBps),
+			download: newLimiter(downloadKBps),
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package cloudsync
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestNewLimiterUnlimited(t *testing.T) {
+	if newLimiter(0) != nil || newLimiter(-1) != nil {
+		t.Error("non-positive rates should mean no limit")
+	}
+}
+
+func TestThrottledBody(t *testing.T) {
+	// 4 KiB/s: 1 KiB takes a quarter of a second
+	body := &throttledBody{
+		ctx: context.Background(),
+		rc:  io.NopCloser(bytes.NewReader(make([]byte, 1024))),
+		lim: newLimiter(4),
+	}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, body)
+	if err != nil || n != 1024 {
+		t.Fatalf("copied %d bytes, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("1 KiB at 4 KiB/s took %v", elapsed)
+	}
+}
+
+func TestLimiterWaitCancelled(t *testing.T) {
+	lim := newLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lim.wait(ctx, 1024*1024); err != context.Canceled {
+		t.Errorf("wait() = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,294 @@
+package cloudsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+)
+
+// propfindBody asks for the properties the sync needs
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/><d:getetag/></d:prop></d:propfind>`
+
+// webDAVRemote keeps the workspace in a WebDAV folder
+type webDAVRemote struct {
+	base     *url.URL // Folder URL, ending in "/"
+	username string
+	password string
+	http     *http.Client
+	folders  map[string]bool // Folders known to exist; only used by Sync, which is serialized
+}
+
+func newWebDAVRemote(cfg config.WebDAVConfig, hc *http.Client) (*webDAVRemote, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("%w: invalid webdav url %q", errs.ErrValidation, cfg.URL)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+	return &webDAVRemote{
+		base:     base,
+		username: cfg.Username,
+		password: cfg.Password,
+		http:     hc,
+		folders:  make(map[string]bool),
+	}, nil
+}
+
+// multistatus is a PROPFIND response
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength string `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+				ETag          string `xml:"getetag"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// davEntry is a file or folder listed by PROPFIND
+type davEntry struct {
+	path   string // Relative to the base folder; folders end in "/"
+	folder bool
+	file   RemoteFile
+}
+
+// List walks the folder one level at a time, as many servers refuse
+// "Depth: infinity"
+func (r *webDAVRemote) List(ctx context.Context) (map[string]RemoteFile, error) {
+	files := make(map[string]RemoteFile)
+	pending := []string{""}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+		entries, err := r.propfind(ctx, dir, "1")
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			switch {
+			case e.path == dir:
+				// The folder itself
+			case e.folder:
+				pending = append(pending, e.path)
+			default:
+				files[e.path] = e.file
+			}
+		}
+	}
+	return files, nil
+}
+
+func (r *webDAVRemote) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := r.do(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Put creates the missing parent folders, uploads data and returns the
+// ETag, asking for it when the upload response has none
+func (r *webDAVRemote) Put(ctx context.Context, filePath string, data []byte) (string, error) {
+	if err := r.mkdirAll(ctx, path.Dir(filePath)); err != nil {
+		return "", err
+	}
+	resp, err := r.do(ctx, http.MethodPut, filePath, data, nil)
+	if isStatus(err, http.StatusConflict) {
+		// A folder was removed behind our back; create it again next time
+		r.folders = make(map[string]bool)
+	}
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag, nil
+	}
+
+	entries, err := r.propfind(ctx, filePath, "0")
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("webdav: %s missing after upload", filePath)
+	}
+	return entries[0].file.Version, nil
+}
+
+func (r *webDAVRemote) Delete(ctx context.Context, path string) error {
+	resp, err := r.do(ctx, http.MethodDelete, path, nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// mkdirAll creates dir and its parents, relative to the base folder,
+// starting with the base folder itself. Folders known to exist are skipped.
+func (r *webDAVRemote) mkdirAll(ctx context.Context, dir string) error {
+	folders := []string{""}
+	if dir != "." && dir != "" {
+		current := ""
+		for _, part := range strings.Split(dir, "/") {
+			current += part + "/"
+			folders = append(folders, current)
+		}
+	}
+
+	for _, folder := range folders {
+		if r.folders[folder] {
+			continue
+		}
+		resp, err := r.do(ctx, "MKCOL", folder, nil, nil)
+		// 405: the folder exists
+		if err != nil && !isStatus(err, http.StatusMethodNotAllowed) {
+			return err
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		r.folders[folder] = true
+	}
+	return nil
+}
+
+// propfind lists path with the given depth
+func (r *webDAVRemote) propfind(ctx context.Context, path, depth string) ([]davEntry, error) {
+	resp, err := r.do(ctx, "PROPFIND", path, []byte(propfindBody), map[string]string{
+		"Depth":        depth,
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("webdav propfind %s: %w", path, err)
+	}
+
+	var entries []davEntry
+	for _, res := range ms.Responses {
+		rel, ok := r.relative(res.Href)
+		if !ok {
+			continue
+		}
+		for _, ps := range res.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			prop := ps.Prop
+			entry := davEntry{path: rel, folder: prop.ResourceType.Collection != nil}
+			if entry.folder && !strings.HasSuffix(entry.path, "/") && entry.path != "" {
+				entry.path += "/"
+			}
+			entry.file.Size, _ = strconv.ParseInt(prop.ContentLength, 10, 64)
+			entry.file.ModTime, _ = http.ParseTime(prop.LastModified)
+			entry.file.Version = prop.ETag
+			if entry.file.Version == "" {
+				entry.file.Version = fmt.Sprintf("%d@%d", entry.file.Size, entry.file.ModTime.Unix())
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// relative turns a response href, an absolute URL or path, into a path
+// relative to the base folder
+func (r *webDAVRemote) relative(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	rel, ok := strings.CutPrefix(u.Path, r.base.Path)
+	if !ok {
+		// The base folder itself, listed without its trailing slash
+		if u.Path+"/" == r.base.Path {
+			return "", true
+		}
+		return "", false
+	}
+	return rel, true
+}
+
+// do sends a request for path, relative to the base folder, turning error
+// statuses into errors
+func (r *webDAVRemote) do(ctx context.Context, method, filePath string, body []byte, headers map[string]string) (*http.Response, error) {
+	u := r.base.ResolveReference(&url.URL{Path: filePath})
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webdav %s: %w", method, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+		err := &statusError{method: method, path: u.Path, code: resp.StatusCode, status: resp.Status}
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return nil, &errs.RateLimitError{RetryAfter: errs.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), Err: err}
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// statusError is an error status returned by the server
+type statusError struct {
+	method string
+	path   string
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("webdav %s %s: %s", e.method, e.path, e.status)
+}
+
+// isStatus reports whether err is the error status code
+func isStatus(err error, code int) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.code == code
+}
@@ -0,0 +1,96 @@
+package cloudsync
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestWebDAV(t *testing.T) (*webDAVRemote, string) {
+	t.Helper()
+	dir := t.TempDir()
+	dav := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.Dir(dir),
+		LockSystem: webdav.NewMemLS(),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "me" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	remote, err := newWebDAVRemote(config.WebDAVConfig{URL: srv.URL + "/dav/workspace", Username: "me", Password: "secret"}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return remote, dir
+}
+
+func TestWebDAVRemote(t *testing.T) {
+	ctx := context.Background()
+	remote, dir := newTestWebDAV(t)
+
+	// The base folder is created along with the file's folders
+	version, err := remote.Put(ctx, "notes/2026/march notes.md", []byte("hello"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if version == "" {
+		t.Error("Put returned no version")
+	}
+	if got := readFile(t, dir, "workspace/notes/2026/march notes.md"); got != "hello" {
+		t.Errorf("stored file = %q", got)
+	}
+	if _, err := remote.Put(ctx, "top.txt", []byte("top")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	files, err := remote.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("files = %+v, want 2", files)
+	}
+	if f := files["notes/2026/march notes.md"]; f.Size != 5 || f.Version != version {
+		t.Errorf("listed file = %+v, want size 5 and version %q", f, version)
+	}
+
+	body, err := remote.Get(ctx, "notes/2026/march notes.md")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "hello" {
+		t.Errorf("Get = %q", data)
+	}
+
+	if err := remote.Delete(ctx, "top.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := remote.Delete(ctx, "top.txt"); err != nil {
+		t.Errorf("deleting a missing file: %v", err)
+	}
+	if files, _ := remote.List(ctx); len(files) != 1 {
+		t.Errorf("files after delete = %+v", files)
+	}
+}
+
+func TestWebDAVRemoteAuthError(t *testing.T) {
+	remote, _ := newTestWebDAV(t)
+	remote.password = "wrong"
+	if _, err := remote.List(context.Background()); !isStatus(err, http.StatusUnauthorized) {
+		t.Errorf("List error = %v, want 401", err)
+	}
+}
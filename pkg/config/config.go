@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
-
-	"github.com/caarlos0/env/v11"
 )
 
 // FlexibleStringSlice is a []string that also accepts JSON numbers,
@@ -46,6 +46,9 @@ func (f *FlexibleStringSlice) UnmarshalJSON(data []byte) error {
 type Config struct {
 	mu sync.RWMutex
 
+	// Layout of the config file; older files are upgraded when loaded
+	ConfigVersion int `json:"config_version"`
+
 	// Global settings
 	Debug       bool   `json:"debug" env:"PICOCLAW_DEBUG"`
 	LogLevel    string `json:"log_level" env:"PICOCLAW_LOG_LEVEL"`
@@ -54,15 +57,97 @@ type Config struct {
 	// Security settings
 	EnableAuth bool   `json:"enable_auth" env:"PICOCLAW_ENABLE_AUTH"`
 	SecretKey  string `json:"secret_key" env:"PICOCLAW_SECRET_KEY"`
+
+	// Senders allowed to run in-chat admin commands such as /status and
+	// /pause, as "sender_id" or "channel:sender_id"
+	Admins FlexibleStringSlice `json:"admins" env:"PICOCLAW_ADMINS"`
 	
 	// AI settings
 	AI AIConfig `json:"ai"`
 	
 	// Channel configurations
 	Channels ChannelsConfig `json:"channels"`
+
+	// Keeping queued messages across restarts
+	Bus BusConfig `json:"bus"`
+
+	// Local-only mode keeping inference on the device
+	Privacy PrivacyConfig `json:"privacy"`
+
+	// HTTP server for health checks, webhooks and the admin endpoints
+	Gateway GatewayConfig `json:"gateway"`
+
+	// Tunnel giving the gateway a public URL from behind NAT
+	Tunnel TunnelConfig `json:"tunnel"`
+
+	// Tool configurations
+	Tools ToolsConfig `json:"tools"`
+
+	// Read-only ICS feed of scheduled jobs, served by the gateway
+	CalendarFeed CalendarFeedConfig `json:"calendar_feed"`
+
+	// Encrypted provider payload log for debugging prompt assembly
+	ProviderDebugLog ProviderDebugLogConfig `json:"provider_debug_log"`
+
+	// Confirmation prompt before expensive agent tasks
+	CostEstimate CostEstimateConfig `json:"cost_estimate"`
+
+	// Capabilities of models missing from, or differing from, the built-in registry
+	Models map[string]ModelCapabilityConfig `json:"models,omitempty"`
+
+	// Race a second provider against slow responses
+	Hedging HedgingConfig `json:"hedging"`
+
+	// Run predicted tool calls while the model is still answering
+	ToolPrefetch ToolPrefetchConfig `json:"tool_prefetch"`
+
+	// Connection pooling for provider HTTP clients
+	ProviderHTTP ProviderHTTPConfig `json:"provider_http"`
+
+	// Spreading of scheduled agent jobs that come due together
+	CronBatch CronBatchConfig `json:"cron_batch"`
+
+	// Recurring agent prompts defined here rather than by the cron tool
+	ScheduledPrompts ScheduledPromptsConfig `json:"scheduled_prompts"`
+
+	// Per-channel layouts of system notifications
+	Notifications NotificationsConfig `json:"notifications"`
+
+	// Filters applied to the text of outgoing messages, per channel
+	Pipeline PipelineConfig `json:"pipeline"`
+
+	// Do-not-disturb windows per channel or contact
+	QuietHours QuietHoursConfig `json:"quiet_hours"`
+
+	// Copies of conversation transcripts sent to archive destinations
+	TranscriptArchive TranscriptArchiveConfig `json:"transcript_archive"`
+
+	// Two-way sync of the workspace with cloud storage
+	WorkspaceSync WorkspaceSyncConfig `json:"workspace_sync"`
+
+	// Updates sent while the agent works through tool calls
+	Progress ProgressConfig `json:"progress"`
+
+	// Time-limited guest access through disposable share links
+	Guest GuestConfig `json:"guest"`
+
+	// Token ledger and monthly usage exports
+	Usage UsageConfig `json:"usage"`
+
+	// Alerts before certificates and access tokens expire
+	ExpiryMonitor ExpiryMonitorConfig `json:"expiry_monitor"`
+
+	// Agent turns run at once, for chats handled in parallel
+	Dispatch DispatchConfig `json:"dispatch"`
+
+	// Where conversation history, summaries and chat settings are kept
+	Session SessionConfig `json:"session"`
 	
 	// Raw JSON for unknown fields
 	Raw json.RawMessage `json:"-"`
+
+	// What upgrading an older config file changed
+	migrationNotes []string
 }
 
 // AIConfig represents AI provider configuration
@@ -80,27 +165,249 @@ type ProviderConfig struct {
 	Model       string            `json:"model"`
 	MaxTokens   int               `json:"max_tokens"`
 	Temperature float64           `json:"temperature"`
-	Headers     map[string]string `json:"headers,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"` // Also set one by one from the environment, e.g. PICOCLAW_AI_PROVIDERS_0_HEADERS_X_TEAM for X-Team
 }
 
 // ChannelsConfig represents all channel configurations
 type ChannelsConfig struct {
-	WhatsApp WhatsAppConfig `json:"whatsapp"`
-	Telegram TelegramConfig `json:"telegram"`
-	LINE     LINEConfig     `json:"line"`
-	OneBot   OneBotConfig   `json:"onebot"`
+	WhatsApp   WhatsAppConfig   `json:"whatsapp"`
+	Telegram   TelegramConfig   `json:"telegram"`
+	Discord    DiscordConfig    `json:"discord"`
+	Slack      SlackConfig      `json:"slack"`
+	LINE       LINEConfig       `json:"line"`
+	OneBot     OneBotConfig     `json:"onebot"`
+	Matrix     MatrixConfig     `json:"matrix"`
+	MQTT       MQTTConfig       `json:"mqtt"`
+	Mattermost MattermostConfig `json:"mattermost"`
+	Messenger  MessengerConfig  `json:"messenger"`
+	Terminal   TerminalConfig   `json:"terminal"`
+	WebChat    WebChatConfig    `json:"webchat"`
+
+	RepoWebhook  RepoWebhookConfig  `json:"repo_webhook"`
+	AlertWebhook AlertWebhookConfig `json:"alert_webhook"`
+
+	// Dropping of redelivered inbound messages, shared by all channels
+	InboundDedup InboundDedupConfig `json:"inbound_dedup"`
+
+	// Coalescing of rapid consecutive messages from a sender into one
+	// agent turn
+	InboundDebounce InboundDebounceConfig `json:"inbound_debounce"`
+
+	// How long shutdown waits for pending replies; 0 selects the default
+	// (30), -1 stops without draining
+	DrainTimeoutSeconds int `json:"drain_timeout_seconds" env:"PICOCLAW_CHANNELS_DRAIN_TIMEOUT_SECONDS"`
+
+	// How often the webhook URLs registered with the platforms are checked
+	// and repaired; 0 selects the default (15), -1 registers them on start
+	// only
+	WebhookCheckIntervalMinutes int `json:"webhook_check_interval_minutes" env:"PICOCLAW_CHANNELS_WEBHOOK_CHECK_INTERVAL_MINUTES"`
+
+	// Deletion of the agent's replies after a delay, on channels that can
+	// delete messages
+	MessageTTL MessageTTLConfig `json:"message_ttl"`
+
+	// Retrying of replies that fail to send
+	Delivery DeliveryConfig `json:"delivery"`
+
+	// Pace of messages sent to many chats at once
+	Broadcast BroadcastConfig `json:"broadcast"`
+
+	// Deny lists and chat allowlists keyed by channel name, applied on top
+	// of each channel's allow_from
+	Access map[string]ChannelAccessConfig `json:"access,omitempty"`
+
+	// Copies of inbound messages sent to chats on other channels
+	Bridges []BridgeRule `json:"bridges,omitempty"`
+}
+
+// BridgeRule copies the inbound messages of a channel, optionally only
+// those of some chats or senders, to a chat on another channel, e.g. every
+// message of a WhatsApp group to a Telegram chat. Chats and senders are
+// exact IDs, globs or "re:<regexp>", like access lists.
+type BridgeRule struct {
+	Name        string              `json:"name"`
+	From        string              `json:"from"`         // Source channel
+	FromChats   FlexibleStringSlice `json:"from_chats"`   // Empty matches every chat
+	FromSenders FlexibleStringSlice `json:"from_senders"` // Empty matches every sender
+	Match       string              `json:"match"`        // Regexp the text must match; empty matches all
+	To          string              `json:"to"`           // Destination channel
+	ToChat      string              `json:"to_chat"`
+	// "mirror" (default) copies the message and still hands it to the
+	// agent; "forward" only copies it
+	Mode string `json:"mode"`
+	// Go text/template executed with .Channel, .ChatID, .SenderID,
+	// .Sender (display name if known), .Content, .Metadata and .Time;
+	// default "[{{.Channel}}] {{.Sender}}: {{.Content}}"
+	Template string `json:"template"`
+	// Also send the files that came with the message
+	IncludeMedia bool `json:"include_media"`
+}
+
+// ChannelAccessConfig restricts who can reach the agent on a channel.
+// Entries are exact IDs, globs such as "+49*", or "re:<regexp>"; deny
+// lists win over allow lists.
+type ChannelAccessConfig struct {
+	DenyFrom   FlexibleStringSlice `json:"deny_from"`
+	AllowChats FlexibleStringSlice `json:"allow_chats"` // Empty allows every chat
+	DenyChats  FlexibleStringSlice `json:"deny_chats"`
+}
+
+// MessageTTLConfig sets chats whose replies disappear
+type MessageTTLConfig struct {
+	// Minutes replies stay up, keyed by "channel:chat_id"
+	Chats map[string]int `json:"chats,omitempty"`
+}
+
+// DeliveryConfig sets how outbound messages are retried. The delay doubles
+// after every failed attempt; rate limits use the delay the platform asks for.
+// Messages that fail every attempt go to the bus's dead-letter queue.
+type DeliveryConfig struct {
+	MaxAttempts       int `json:"max_attempts" env:"PICOCLAW_CHANNELS_DELIVERY_MAX_ATTEMPTS"`               // 0 selects the default (3), 1 disables retries
+	RetryDelaySeconds int `json:"retry_delay_seconds" env:"PICOCLAW_CHANNELS_DELIVERY_RETRY_DELAY_SECONDS"` // 0 selects the default (2)
+	// Attempts keyed by channel name, overriding max_attempts for flaky
+	// or rate-limited platforms
+	ChannelMaxAttempts map[string]int `json:"channel_max_attempts,omitempty"`
+}
+
+// BusConfig selects where and how many queued messages the message bus
+// keeps. With
+// persistence "file" every message stays in a journal until it is handled
+// or sent, and whatever a crash interrupted is delivered again on the next
+// start, so a message can be repeated but is not lost.
+type BusConfig struct {
+	Persistence string `json:"persistence" env:"PICOCLAW_BUS_PERSISTENCE"` // "memory" (default) or "file"
+	Path        string `json:"path" env:"PICOCLAW_BUS_PATH"`               // Journal database; empty selects workspace/bus/journal.db
+	Sync        bool   `json:"sync" env:"PICOCLAW_BUS_SYNC"`               // Flush every record to disk, surviving power loss at the cost of speed
+
+	// Messages each queue holds; 0 selects the default (100)
+	QueueSize int `json:"queue_size" env:"PICOCLAW_BUS_QUEUE_SIZE"`
+	// What a full inbound queue does with new messages: "block" (default)
+	// waits, "drop_oldest" or "drop_newest" drop one, "reject" answers the
+	// sender that the agent is busy. Replies are never dropped.
+	Overflow string `json:"overflow" env:"PICOCLAW_BUS_OVERFLOW"`
+	// Fill of the inbound queue (0-1) at which channels stop reading new
+	// messages, and at which they start again; 0 selects 0.8 and 0.5
+	HighWatermark float64 `json:"high_watermark" env:"PICOCLAW_BUS_HIGH_WATERMARK"`
+	LowWatermark  float64 `json:"low_watermark" env:"PICOCLAW_BUS_LOW_WATERMARK"`
+
+	// External broker shared by several instances, so that e.g. webhook
+	// gateways in a few regions hand their messages to one worker running
+	// the agent. "redis" uses Redis Streams at BrokerURL
+	// (redis://[user:password@]host[:port][/db], rediss:// for TLS);
+	// empty keeps the bus in the process. It replaces the file
+	// persistence: the broker keeps the messages until they are handled.
+	Broker    string `json:"broker" env:"PICOCLAW_BUS_BROKER"`
+	BrokerURL string `json:"broker_url" env:"PICOCLAW_BUS_BROKER_URL" secret:"true"`
+	// Messages this instance takes from the broker: "all" (default),
+	// "gateway" for replies only (it runs the channels) or "worker" for
+	// incoming messages only (it runs the agent)
+	BrokerRole string `json:"broker_role" env:"PICOCLAW_BUS_BROKER_ROLE"`
+	// Start of the stream names, to share a server between deployments;
+	// empty selects "picoclaw"
+	BrokerPrefix string `json:"broker_prefix" env:"PICOCLAW_BUS_BROKER_PREFIX"`
+	// Name of this instance among the consumers; it must stay the same
+	// across restarts to get back the messages it had not handled. Empty
+	// selects the host name.
+	BrokerConsumer string `json:"broker_consumer" env:"PICOCLAW_BUS_BROKER_CONSUMER"`
+}
+
+// PrivacyConfig keeps chat content on the device. With LocalOnly the agent
+// only uses ollama or vllm at a local address, web tools are off unless they
+// go through a local WebProxy, voice messages are only transcribed by a
+// local Whisper server, and any other request of the agent to a host outside
+// the local network fails. Chat channels still reach their platforms.
+type PrivacyConfig struct {
+	LocalOnly  bool                `json:"local_only" env:"PICOCLAW_PRIVACY_LOCAL_ONLY"`
+	AllowHosts FlexibleStringSlice `json:"allow_hosts" env:"PICOCLAW_PRIVACY_ALLOW_HOSTS"` // Host names that count as local, e.g. an inference server on the LAN
+	WebProxy   string              `json:"web_proxy" env:"PICOCLAW_PRIVACY_WEB_PROXY"`     // Local HTTP proxy for web_search and web_fetch; empty turns them off
+}
+
+// BroadcastConfig limits how fast a broadcast is sent on each channel,
+// below the platforms' bulk sending limits
+type BroadcastConfig struct {
+	MessagesPerSecond float64            `json:"messages_per_second" env:"PICOCLAW_CHANNELS_BROADCAST_MESSAGES_PER_SECOND"` // Per channel; 0 selects the default (1)
+	ChannelRates      map[string]float64 `json:"channel_rates,omitempty"`                                                     // Messages per second by channel name
+}
+
+// InboundDedupConfig sets how long inbound message IDs are remembered
+type InboundDedupConfig struct {
+	WindowSeconds int `json:"window_seconds" env:"PICOCLAW_CHANNELS_INBOUND_DEDUP_WINDOW_SECONDS"` // 0 selects the default (600), -1 disables
+	MaxEntries    int `json:"max_entries" env:"PICOCLAW_CHANNELS_INBOUND_DEDUP_MAX_ENTRIES"`       // 0 selects the default (10000)
+}
+
+// InboundDebounceConfig holds a sender's messages to a chat until they have
+// been quiet for the window, and hands them to the agent as one message, so
+// "hi" "can you" "check my order?" get one answer. Commands are not held.
+type InboundDebounceConfig struct {
+	WindowMS    int `json:"window_ms" env:"PICOCLAW_CHANNELS_INBOUND_DEBOUNCE_WINDOW_MS"`       // 0 disables
+	MaxWaitMS   int `json:"max_wait_ms" env:"PICOCLAW_CHANNELS_INBOUND_DEBOUNCE_MAX_WAIT_MS"`   // Longest a message is held; 0 selects 4 windows
+	MaxMessages int `json:"max_messages" env:"PICOCLAW_CHANNELS_INBOUND_DEBOUNCE_MAX_MESSAGES"` // Messages coalesced at most; 0 selects 10
+	// Windows by channel name, replacing window_ms; 0 disables debouncing
+	// on that channel
+	ChannelWindowMS map[string]int `json:"channel_window_ms,omitempty"`
 }
 
 // WhatsAppConfig represents WhatsApp channel configuration
 type WhatsAppConfig struct {
 	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_WHATSAPP_ENABLED"`
 	BridgeURL string              `json:"bridge_url" env:"PICOCLAW_CHANNELS_WHATSAPP_BRIDGE_URL"`
+	AuthToken string              `json:"auth_token" env:"PICOCLAW_CHANNELS_WHATSAPP_AUTH_TOKEN"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_WHATSAPP_ALLOW_FROM"`
+	Format    string              `json:"format" env:"PICOCLAW_CHANNELS_WHATSAPP_FORMAT"` // whatsapp (default), markdown or plain
+
+	// Additional bridge accounts served by the same process. Each instance
+	// inherits every other setting from this section.
+	Instances []WhatsAppInstanceConfig `json:"instances,omitempty"`
 	
 	// Facebook WhatsApp Business API configuration
 	FBPhoneNumberID string `json:"fb_phone_number_id" env:"PICOCLAW_CHANNELS_WHATSAPP_FB_PHONE_NUMBER_ID"`
 	FBAccessToken   string `json:"fb_access_token" env:"PICOCLAW_CHANNELS_WHATSAPP_FB_ACCESS_TOKEN"`
 	FBAPIVersion    string `json:"fb_api_version" env:"PICOCLAW_CHANNELS_WHATSAPP_FB_API_VERSION"`
+
+	// Emit a typing indicator when an inbound message is handed to the agent
+	SendTypingIndicators bool `json:"send_typing_indicators" env:"PICOCLAW_CHANNELS_WHATSAPP_SEND_TYPING_INDICATORS"`
+
+	// Bridge message signing. Keys are "id:secret" entries; the first one signs.
+	HMACKeys       FlexibleStringSlice `json:"hmac_keys" env:"PICOCLAW_CHANNELS_WHATSAPP_HMAC_KEYS"`
+	HMACKeyEnv     string              `json:"hmac_key_env" env:"PICOCLAW_CHANNELS_WHATSAPP_HMAC_KEY_ENV"`
+	HMACKeyFile    string              `json:"hmac_key_file" env:"PICOCLAW_CHANNELS_WHATSAPP_HMAC_KEY_FILE"`
+	HMACMissingKey string              `json:"hmac_missing_key" env:"PICOCLAW_CHANNELS_WHATSAPP_HMAC_MISSING_KEY"` // "warn" or "fail"
+	// Sign outgoing messages over raw JSON for bridges without canonical signing support
+	LegacySignatures bool `json:"legacy_signatures" env:"PICOCLAW_CHANNELS_WHATSAPP_LEGACY_SIGNATURES"`
+	// Bridge payload encryption: "off" (default), "prefer" or "require". The
+	// key exchange rides on the hello, so it is only authenticated with HMAC
+	// keys, which "require" needs.
+	Encryption string `json:"encryption" env:"PICOCLAW_CHANNELS_WHATSAPP_ENCRYPTION"`
+
+	// Replay protection for bridge messages
+	ReplayWindowSeconds int `json:"replay_window_seconds" env:"PICOCLAW_CHANNELS_WHATSAPP_REPLAY_WINDOW_SECONDS"`
+	NonceCacheSize      int `json:"nonce_cache_size" env:"PICOCLAW_CHANNELS_WHATSAPP_NONCE_CACHE_SIZE"`
+
+	// Group chats
+	SelfID                   string                         `json:"self_id" env:"PICOCLAW_CHANNELS_WHATSAPP_SELF_ID"`
+	AllowGroups              FlexibleStringSlice            `json:"allow_groups" env:"PICOCLAW_CHANNELS_WHATSAPP_ALLOW_GROUPS"`
+	GroupAllowFrom           map[string]FlexibleStringSlice `json:"group_allow_from,omitempty"`
+	RespondOnlyWhenMentioned bool                           `json:"respond_only_when_mentioned" env:"PICOCLAW_CHANNELS_WHATSAPP_RESPOND_ONLY_WHEN_MENTIONED"`
+
+	// Bridge keepalive; zero values select the defaults (30s, 10s, 60s, 3)
+	PingIntervalSeconds int `json:"ping_interval_seconds" env:"PICOCLAW_CHANNELS_WHATSAPP_PING_INTERVAL_SECONDS"`
+	PongTimeoutSeconds  int `json:"pong_timeout_seconds" env:"PICOCLAW_CHANNELS_WHATSAPP_PONG_TIMEOUT_SECONDS"`
+	ReadTimeoutSeconds  int `json:"read_timeout_seconds" env:"PICOCLAW_CHANNELS_WHATSAPP_READ_TIMEOUT_SECONDS"`
+	MaxMissedPongs      int `json:"max_missed_pongs" env:"PICOCLAW_CHANNELS_WHATSAPP_MAX_MISSED_PONGS"`
+
+	// Bridge reconnection; max attempts -1 retries forever
+	ReconnectMaxAttempts       int     `json:"reconnect_max_attempts" env:"PICOCLAW_CHANNELS_WHATSAPP_RECONNECT_MAX_ATTEMPTS"`
+	ReconnectMaxDelaySeconds   int     `json:"reconnect_max_delay_seconds" env:"PICOCLAW_CHANNELS_WHATSAPP_RECONNECT_MAX_DELAY_SECONDS"`
+	ReconnectJitter            float64 `json:"reconnect_jitter" env:"PICOCLAW_CHANNELS_WHATSAPP_RECONNECT_JITTER"`
+	ReconnectResetAfterSeconds int     `json:"reconnect_reset_after_seconds" env:"PICOCLAW_CHANNELS_WHATSAPP_RECONNECT_RESET_AFTER_SECONDS"`
+}
+
+// WhatsAppInstanceConfig is one WhatsApp bridge account
+type WhatsAppInstanceConfig struct {
+	AccountID string              `json:"account_id"`
+	BridgeURL string              `json:"bridge_url"`
+	AuthToken string              `json:"auth_token"`
+	AllowFrom FlexibleStringSlice `json:"allow_from"` // Empty inherits the section's allow_from
 }
 
 // TelegramConfig represents Telegram channel configuration
@@ -109,6 +416,58 @@ type TelegramConfig struct {
 	Token     string              `json:"token" env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
 	Proxy     string              `json:"proxy" env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
+	Format    string              `json:"format" env:"PICOCLAW_CHANNELS_TELEGRAM_FORMAT"` // telegram_html (default), markdown or plain
+
+	// Mode is "polling" (default) or "webhook". In webhook mode Telegram
+	// posts updates to WebhookURL, which must reach the gateway HTTP server
+	// on the URL's path.
+	Mode          string `json:"mode" env:"PICOCLAW_CHANNELS_TELEGRAM_MODE"`
+	WebhookURL    string `json:"webhook_url" env:"PICOCLAW_CHANNELS_TELEGRAM_WEBHOOK_URL"`
+	WebhookSecret string `json:"webhook_secret" env:"PICOCLAW_CHANNELS_TELEGRAM_WEBHOOK_SECRET"` // Empty derives one from the token
+}
+
+// DiscordConfig represents Discord channel configuration
+type DiscordConfig struct {
+	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_DISCORD_ENABLED"`
+	Token     string              `json:"token" env:"PICOCLAW_CHANNELS_DISCORD_TOKEN"`
+	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_DISCORD_ALLOW_FROM"`
+	Format    string              `json:"format" env:"PICOCLAW_CHANNELS_DISCORD_FORMAT"` // markdown (default) or plain
+
+	// Guilds limits the servers the bot answers in, keyed by guild ID.
+	// Empty answers in every server the bot is in.
+	Guilds map[string]DiscordGuildConfig `json:"guilds,omitempty"`
+
+	// Register the /ask, /show and /list slash commands
+	SlashCommands bool `json:"slash_commands" env:"PICOCLAW_CHANNELS_DISCORD_SLASH_COMMANDS"`
+	// Answer server messages in a thread started on them, so every
+	// conversation has its own thread and session
+	ReplyInThreads bool `json:"reply_in_threads" env:"PICOCLAW_CHANNELS_DISCORD_REPLY_IN_THREADS"`
+}
+
+// DiscordGuildConfig restricts the bot within one Discord server
+type DiscordGuildConfig struct {
+	AllowFrom FlexibleStringSlice `json:"allow_from"` // Users also have to pass the channel's allow_from
+	Channels  FlexibleStringSlice `json:"channels"`   // Channel IDs answered in; empty answers in all
+}
+
+// SlackConfig represents Slack channel configuration
+type SlackConfig struct {
+	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_SLACK_ENABLED"`
+	BotToken  string              `json:"bot_token" env:"PICOCLAW_CHANNELS_SLACK_BOT_TOKEN"`
+	AppToken  string              `json:"app_token" env:"PICOCLAW_CHANNELS_SLACK_APP_TOKEN"` // Socket Mode only
+	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_SLACK_ALLOW_FROM"`
+	Format    string              `json:"format" env:"PICOCLAW_CHANNELS_SLACK_FORMAT"` // slack (default), markdown or plain
+
+	// Mode is "socket" (default), which needs no public URL, or "events".
+	// In events mode Slack posts events, interactions and slash commands
+	// to WebhookPath on the gateway HTTP server, signed with SigningSecret.
+	Mode          string `json:"mode" env:"PICOCLAW_CHANNELS_SLACK_MODE"`
+	SigningSecret string `json:"signing_secret" env:"PICOCLAW_CHANNELS_SLACK_SIGNING_SECRET"`
+	WebhookPath   string `json:"webhook_path" env:"PICOCLAW_CHANNELS_SLACK_WEBHOOK_PATH"` // Default /slack/events
+
+	// Answer channel messages in a thread started on them, as mentions are
+	// answered, so every conversation has its own thread and session
+	ReplyInThreads bool `json:"reply_in_threads" env:"PICOCLAW_CHANNELS_SLACK_REPLY_IN_THREADS"`
 }
 
 // LINEConfig represents LINE channel configuration
@@ -116,6 +475,12 @@ type LINEConfig struct {
 	Enabled           bool                `json:"enabled" env:"PICOCLAW_CHANNELS_LINE_ENABLED"`
 	ChannelSecret     string              `json:"channel_secret" env:"PICOCLAW_CHANNELS_LINE_CHANNEL_SECRET"`
 	ChannelAccessToken string             `json:"channel_access_token" env:"PICOCLAW_CHANNELS_LINE_CHANNEL_ACCESS_TOKEN"`
+	WebhookHost       string              `json:"webhook_host" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_HOST"`
+	WebhookPort       int                 `json:"webhook_port" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_PORT"`
+	WebhookPath       string              `json:"webhook_path" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_PATH"` // Default /webhook/line
+	// Public URL of the webhook server, registered with LINE on start and
+	// whenever it drifts; empty leaves it to the LINE Developers console
+	WebhookURL        string              `json:"webhook_url" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_URL"`
 	AllowFrom         FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_LINE_ALLOW_FROM"`
 }
 
@@ -127,22 +492,665 @@ type OneBotConfig struct {
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_ONEBOT_ALLOW_FROM"`
 }
 
+// MatrixConfig connects to a Matrix homeserver as an existing account,
+// logged in with its access token. Encrypted rooms need an end-to-end
+// encryption proxy such as Pantalaimon as Homeserver; without one their
+// messages cannot be read, and EncryptedRooms decides what happens to them.
+type MatrixConfig struct {
+	Enabled     bool                `json:"enabled" env:"PICOCLAW_CHANNELS_MATRIX_ENABLED"`
+	Homeserver  string              `json:"homeserver" env:"PICOCLAW_CHANNELS_MATRIX_HOMESERVER"` // e.g. https://matrix.example.org
+	AccessToken string              `json:"access_token" env:"PICOCLAW_CHANNELS_MATRIX_ACCESS_TOKEN"`
+	AllowFrom   FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_FROM"` // User IDs, e.g. @alice:example.org
+	Format      string              `json:"format" env:"PICOCLAW_CHANNELS_MATRIX_FORMAT"`         // html (default), markdown or plain
+
+	// Rooms answered in, as room IDs or aliases; empty answers in all
+	AllowRooms FlexibleStringSlice `json:"allow_rooms" env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_ROOMS"`
+	// Join rooms the bot is invited to by allowed users, if the room is allowed
+	AutoJoin bool `json:"auto_join" env:"PICOCLAW_CHANNELS_MATRIX_AUTO_JOIN"`
+	// "ignore" (default) skips encrypted messages, "notice" also tells the
+	// room once that the bot cannot read them
+	EncryptedRooms string `json:"encrypted_rooms" env:"PICOCLAW_CHANNELS_MATRIX_ENCRYPTED_ROOMS"`
+}
+
+
+// MattermostConfig connects to a Mattermost server with a personal access
+// token of a bot or user account. Posts arrive over the WebSocket API and
+// replies and files are posted through the REST API.
+type MattermostConfig struct {
+	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_MATTERMOST_ENABLED"`
+	URL       string              `json:"url" env:"PICOCLAW_CHANNELS_MATTERMOST_URL"` // e.g. https://chat.example.org
+	Token     string              `json:"token" env:"PICOCLAW_CHANNELS_MATTERMOST_TOKEN"`
+	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MATTERMOST_ALLOW_FROM"` // User IDs or @usernames
+	Format    string              `json:"format" env:"PICOCLAW_CHANNELS_MATTERMOST_FORMAT"`         // markdown (default) or plain
+
+	// Channels answered in, as channel IDs or team/channel names; empty
+	// answers in all. Direct and group messages from allowed users are
+	// always answered.
+	AllowChannels FlexibleStringSlice `json:"allow_channels" env:"PICOCLAW_CHANNELS_MATTERMOST_ALLOW_CHANNELS"`
+	// Answer channel messages in a thread started on them, so every
+	// conversation has its own thread and session
+	ReplyInThreads bool `json:"reply_in_threads" env:"PICOCLAW_CHANNELS_MATTERMOST_REPLY_IN_THREADS"`
+}
+
+// MessengerConfig connects a Facebook Page to Messenger. Facebook posts
+// message events to WebhookPath on the gateway HTTP server, signed with
+// the app secret, and replies go out through the Send API.
+type MessengerConfig struct {
+	Enabled         bool                `json:"enabled" env:"PICOCLAW_CHANNELS_MESSENGER_ENABLED"`
+	PageAccessToken string              `json:"page_access_token" env:"PICOCLAW_CHANNELS_MESSENGER_PAGE_ACCESS_TOKEN"`
+	AppSecret       string              `json:"app_secret" env:"PICOCLAW_CHANNELS_MESSENGER_APP_SECRET"`
+	VerifyToken     string              `json:"verify_token" env:"PICOCLAW_CHANNELS_MESSENGER_VERIFY_TOKEN"` // Entered when subscribing the webhook
+	// ID of the Meta app; with it the page webhook is subscribed under the
+	// gateway's public URL on start and whenever it drifts
+	AppID           string              `json:"app_id" env:"PICOCLAW_CHANNELS_MESSENGER_APP_ID"`
+	WebhookPath     string              `json:"webhook_path" env:"PICOCLAW_CHANNELS_MESSENGER_WEBHOOK_PATH"` // Default /messenger/webhook
+	APIVersion      string              `json:"api_version" env:"PICOCLAW_CHANNELS_MESSENGER_API_VERSION"`   // Default v22.0
+	AllowFrom       FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MESSENGER_ALLOW_FROM"`     // Page-scoped user IDs
+	Format          string              `json:"format" env:"PICOCLAW_CHANNELS_MESSENGER_FORMAT"`             // whatsapp (default), markdown or plain
+
+	// Replies are sent as this persona, with its own name and picture in
+	// the conversation; empty sends them as the page. The persona is
+	// created on start unless the page already has one by that name.
+	PersonaName       string `json:"persona_name" env:"PICOCLAW_CHANNELS_MESSENGER_PERSONA_NAME"`
+	PersonaPictureURL string `json:"persona_picture_url" env:"PICOCLAW_CHANNELS_MESSENGER_PERSONA_PICTURE_URL"`
+	// Message tag for notifications, which may be sent after the 24 hour
+	// messaging window, e.g. ACCOUNT_UPDATE; empty sends them as updates
+	MessageTag string `json:"message_tag" env:"PICOCLAW_CHANNELS_MESSENGER_MESSAGE_TAG"`
+}
+
+// TerminalConfig chats with the agent from the console the gateway runs
+// in, for trying prompts and tools locally. The user's messages come from
+// "terminal:local" and anyone with the console may send them.
+type TerminalConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_CHANNELS_TERMINAL_ENABLED"`
+	Color   string `json:"color" env:"PICOCLAW_CHANNELS_TERMINAL_COLOR"`   // auto (default), always or never
+	Format  string `json:"format" env:"PICOCLAW_CHANNELS_TERMINAL_FORMAT"` // markdown (default) or plain
+}
+
+// WebChatConfig serves a chat widget for websites from the gateway: the
+// script at Path/widget.js, and the WebSocket it talks to the agent over at
+// Path/ws. Visitors are identified by session tokens, which sites sign with
+// Secret for their signed-in users; the channel issues anonymous ones when
+// AllowAnonymous is set.
+type WebChatConfig struct {
+	Enabled        bool                `json:"enabled" env:"PICOCLAW_CHANNELS_WEBCHAT_ENABLED"`
+	Path           string              `json:"path" env:"PICOCLAW_CHANNELS_WEBCHAT_PATH"`     // Default /chat
+	Secret         string              `json:"secret" env:"PICOCLAW_CHANNELS_WEBCHAT_SECRET"` // Empty uses a random key, so sessions end with a restart
+	AllowAnonymous bool                `json:"allow_anonymous" env:"PICOCLAW_CHANNELS_WEBCHAT_ALLOW_ANONYMOUS"`
+	AllowFrom      FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_WEBCHAT_ALLOW_FROM"`           // User IDs of signed tokens
+	AllowedOrigins FlexibleStringSlice `json:"allowed_origins" env:"PICOCLAW_CHANNELS_WEBCHAT_ALLOWED_ORIGINS"` // Sites that may embed the widget, e.g. https://example.org; empty allows any
+	// Lifetime of anonymous session tokens, renewed on every visit;
+	// default 720 (30 days)
+	SessionTTLHours int    `json:"session_ttl_hours" env:"PICOCLAW_CHANNELS_WEBCHAT_SESSION_TTL_HOURS"`
+	Format          string `json:"format" env:"PICOCLAW_CHANNELS_WEBCHAT_FORMAT"` // markdown (default), html or plain
+}
+
+// MQTTConfig connects to an MQTT broker for devices and home automation.
+// Messages published to InboundTopic reach the agent and replies are
+// published to OutboundTopic. A {device} segment in InboundTopic matches any
+// device; its value becomes the chat ID and fills {device} in OutboundTopic,
+// so each device gets replies on its own topic. The broker's ACLs decide who
+// may publish; AllowFrom matches the device, or the "sender" of JSON payloads.
+type MQTTConfig struct {
+	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_MQTT_ENABLED"`
+	Broker    string              `json:"broker" env:"PICOCLAW_CHANNELS_MQTT_BROKER" secret:"true"` // tcp://host:1883, or ssl://host:8883 for TLS
+	ClientID  string              `json:"client_id" env:"PICOCLAW_CHANNELS_MQTT_CLIENT_ID"`         // Empty generates one
+	Username  string              `json:"username" env:"PICOCLAW_CHANNELS_MQTT_USERNAME"`
+	Password  string              `json:"password" env:"PICOCLAW_CHANNELS_MQTT_PASSWORD"`
+	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MQTT_ALLOW_FROM"`
+
+	InboundTopic  string `json:"inbound_topic" env:"PICOCLAW_CHANNELS_MQTT_INBOUND_TOPIC"`   // e.g. picoclaw/{device}/ask
+	OutboundTopic string `json:"outbound_topic" env:"PICOCLAW_CHANNELS_MQTT_OUTBOUND_TOPIC"` // e.g. picoclaw/{device}/reply
+	QoS           int    `json:"qos" env:"PICOCLAW_CHANNELS_MQTT_QOS"`                       // 0, 1 or 2, for the subscription and replies
+	// "text" (default) publishes replies as plain text, "json" as
+	// {"text": ..., "device": ...}. Inbound payloads may be either.
+	PayloadFormat    string `json:"payload_format" env:"PICOCLAW_CHANNELS_MQTT_PAYLOAD_FORMAT"`
+	KeepAliveSeconds int    `json:"keep_alive_seconds" env:"PICOCLAW_CHANNELS_MQTT_KEEP_ALIVE_SECONDS"` // 0 selects 60
+
+	TLSCAFile             string `json:"tls_ca_file" env:"PICOCLAW_CHANNELS_MQTT_TLS_CA_FILE"`     // Empty uses the system roots
+	TLSCertFile           string `json:"tls_cert_file" env:"PICOCLAW_CHANNELS_MQTT_TLS_CERT_FILE"` // Client certificate, with TLSKeyFile
+	TLSKeyFile            string `json:"tls_key_file" env:"PICOCLAW_CHANNELS_MQTT_TLS_KEY_FILE"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify" env:"PICOCLAW_CHANNELS_MQTT_TLS_INSECURE_SKIP_VERIFY"`
+}
+
+// GatewayConfig configures the gateway HTTP server, which serves health
+// checks, channel webhooks and the admin endpoints
+type GatewayConfig struct {
+	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"` // Default 0.0.0.0
+	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"` // Default 18790
+
+	// Listener limits; 0 selects the defaults (5, 5, 120 and 1 MiB)
+	ReadTimeoutSeconds  int `json:"read_timeout_seconds" env:"PICOCLAW_GATEWAY_READ_TIMEOUT_SECONDS"`
+	WriteTimeoutSeconds int `json:"write_timeout_seconds" env:"PICOCLAW_GATEWAY_WRITE_TIMEOUT_SECONDS"`
+	IdleTimeoutSeconds  int `json:"idle_timeout_seconds" env:"PICOCLAW_GATEWAY_IDLE_TIMEOUT_SECONDS"`
+	MaxHeaderBytes      int `json:"max_header_bytes" env:"PICOCLAW_GATEWAY_MAX_HEADER_BYTES"`
+
+	// URL the platforms reach the gateway at, e.g. https://bot.example.org
+	// behind a reverse proxy; webhooks are registered under it. Empty uses
+	// the tunnel's URL or the first ACME domain.
+	PublicURL string `json:"public_url" env:"PICOCLAW_GATEWAY_PUBLIC_URL"`
+
+	// Bearer token of POST /api/chat, which answers with the agent's reply;
+	// empty leaves the endpoint off
+	ChatToken string `json:"chat_token" env:"PICOCLAW_GATEWAY_CHAT_TOKEN"`
+
+	// Bearer token of the /admin and /debug endpoints; empty uses
+	// chat_token, and with neither they refuse every request
+	AdminToken string `json:"admin_token" env:"PICOCLAW_GATEWAY_ADMIN_TOKEN"`
+
+	// HTTPS, so webhooks can reach the gateway without a reverse proxy
+	TLS GatewayTLSConfig `json:"tls"`
+}
+
+// GatewayTLSConfig serves the gateway over HTTPS with certificate files or
+// with certificates obtained from an ACME CA such as Let's Encrypt. ACME
+// validates the domains with TLS-ALPN-01 on the gateway port, which must be
+// reachable as port 443, or with HTTP-01 on HTTPPort, reachable as port 80.
+type GatewayTLSConfig struct {
+	// "off" (default), "files" for CertFile and KeyFile, or "acme"
+	Mode     string `json:"mode" env:"PICOCLAW_GATEWAY_TLS_MODE"`
+	CertFile string `json:"cert_file" env:"PICOCLAW_GATEWAY_TLS_CERT_FILE"` // PEM chain; reloaded when it changes
+	KeyFile  string `json:"key_file" env:"PICOCLAW_GATEWAY_TLS_KEY_FILE"`
+
+	Domains      FlexibleStringSlice `json:"domains" env:"PICOCLAW_GATEWAY_TLS_DOMAINS"`             // Names certificates are requested for
+	Email        string              `json:"email" env:"PICOCLAW_GATEWAY_TLS_EMAIL"`                 // Contact for the CA's notices
+	CacheDir     string              `json:"cache_dir" env:"PICOCLAW_GATEWAY_TLS_CACHE_DIR"`         // Default ~/.picoclaw/acme
+	DirectoryURL string              `json:"directory_url" env:"PICOCLAW_GATEWAY_TLS_DIRECTORY_URL"` // Default Let's Encrypt production
+
+	// Plain HTTP listener answering HTTP-01 challenges and redirecting
+	// everything else to HTTPS; 0 disables it
+	HTTPPort int `json:"http_port" env:"PICOCLAW_GATEWAY_TLS_HTTP_PORT"`
+	// Strict-Transport-Security max-age; 0 sends no header
+	HSTSMaxAgeSeconds     int  `json:"hsts_max_age_seconds" env:"PICOCLAW_GATEWAY_TLS_HSTS_MAX_AGE_SECONDS"`
+	HSTSIncludeSubdomains bool `json:"hsts_include_subdomains" env:"PICOCLAW_GATEWAY_TLS_HSTS_INCLUDE_SUBDOMAINS"`
+	// Oldest TLS version accepted, "1.2" (default) or "1.3"
+	MinVersion string `json:"min_version" env:"PICOCLAW_GATEWAY_TLS_MIN_VERSION"`
+}
+
+// TunnelConfig runs a tunnel client next to the gateway, so webhooks reach
+// it from behind NAT. The tunnel's public URL replaces the host of
+// Telegram's webhook_url, which may then be just a path or empty, and is
+// registered again when it changes; the webhook URLs of other channels are
+// logged to be set up with their platforms.
+type TunnelConfig struct {
+	// Empty (off), "cloudflare", "ngrok" or "ssh"
+	Provider string `json:"provider" env:"PICOCLAW_TUNNEL_PROVIDER"`
+	// Client binary; empty looks up cloudflared, ngrok or ssh in PATH
+	Command string `json:"command" env:"PICOCLAW_TUNNEL_COMMAND"`
+	// cloudflare: token of a named tunnel, empty for a quick tunnel on a
+	// random trycloudflare.com URL; ngrok: authtoken
+	Token string `json:"token" env:"PICOCLAW_TUNNEL_TOKEN"`
+	// cloudflare: public hostname the named tunnel routes to the gateway;
+	// ngrok: reserved domain, empty for a random one
+	Hostname string `json:"hostname" env:"PICOCLAW_TUNNEL_HOSTNAME"`
+	// How long startup waits for the public URL; default 30
+	StartTimeoutSeconds int `json:"start_timeout_seconds" env:"PICOCLAW_TUNNEL_START_TIMEOUT_SECONDS"`
+
+	SSH TunnelSSHConfig `json:"ssh"`
+}
+
+// TunnelSSHConfig forwards a port of an SSH server to the gateway. A web
+// server or load balancer there serves the port as PublicURL.
+type TunnelSSHConfig struct {
+	Host         string `json:"host" env:"PICOCLAW_TUNNEL_SSH_HOST"`
+	Port         int    `json:"port" env:"PICOCLAW_TUNNEL_SSH_PORT"` // Default 22
+	User         string `json:"user" env:"PICOCLAW_TUNNEL_SSH_USER"`
+	IdentityFile string `json:"identity_file" env:"PICOCLAW_TUNNEL_SSH_IDENTITY_FILE"` // Empty uses the SSH agent and default keys
+	RemotePort   int    `json:"remote_port" env:"PICOCLAW_TUNNEL_SSH_REMOTE_PORT"`     // Port on the server forwarded to the gateway
+	BindAddress  string `json:"bind_address" env:"PICOCLAW_TUNNEL_SSH_BIND_ADDRESS"`   // Empty binds the server's loopback, per its GatewayPorts
+	PublicURL    string `json:"public_url" env:"PICOCLAW_TUNNEL_SSH_PUBLIC_URL"`       // e.g. https://bot.example.org
+}
+
+// CalendarFeedConfig represents the ICS calendar feed configuration
+type CalendarFeedConfig struct {
+	Enabled     bool   `json:"enabled" env:"PICOCLAW_CALENDAR_FEED_ENABLED"`
+	Secret      string `json:"secret" env:"PICOCLAW_CALENDAR_FEED_SECRET"`
+	HorizonDays int    `json:"horizon_days" env:"PICOCLAW_CALENDAR_FEED_HORIZON_DAYS"`
+}
+
+// ModelCapabilityConfig overrides or adds a model capability entry. Unset
+// fields keep the built-in value of the closest matching model.
+type ModelCapabilityConfig struct {
+	ContextWindow           int      `json:"context_window,omitempty"`
+	MaxOutputTokens         int      `json:"max_output_tokens,omitempty"`
+	SupportsTools           *bool    `json:"supports_tools,omitempty"`
+	SupportsVision          *bool    `json:"supports_vision,omitempty"`
+	SupportsStreaming       *bool    `json:"supports_streaming,omitempty"`
+	UsesMaxCompletionTokens *bool    `json:"uses_max_completion_tokens,omitempty"`
+	FixedTemperature        *float64 `json:"fixed_temperature,omitempty"`
+}
+
+// CostEstimateConfig represents the cost confirmation settings. A task is
+// held for confirmation when its estimate exceeds either threshold.
+type CostEstimateConfig struct {
+	Enabled             bool                    `json:"enabled" env:"PICOCLAW_COST_ESTIMATE_ENABLED"`
+	TokenThreshold      int                     `json:"token_threshold" env:"PICOCLAW_COST_ESTIMATE_TOKEN_THRESHOLD"`
+	CostThreshold       float64                 `json:"cost_threshold" env:"PICOCLAW_COST_ESTIMATE_COST_THRESHOLD"`
+	Currency            string                  `json:"currency" env:"PICOCLAW_COST_ESTIMATE_CURRENCY"`
+	EstimatedSteps      int                     `json:"estimated_steps" env:"PICOCLAW_COST_ESTIMATE_ESTIMATED_STEPS"`
+	OutputTokensPerStep int                     `json:"output_tokens_per_step" env:"PICOCLAW_COST_ESTIMATE_OUTPUT_TOKENS_PER_STEP"`
+	Pricing             map[string]ModelPricing `json:"pricing,omitempty"` // model -> price
+}
+
+// ModelPricing is the price per million tokens of a model
+type ModelPricing struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+// ProviderDebugLogConfig represents the encrypted provider payload log.
+// Logging is available when Key is set and toggled with /admin debug-log.
+// Admins are added to the top-level admins list.
+type ProviderDebugLogConfig struct {
+	Enabled bool                `json:"enabled" env:"PICOCLAW_PROVIDER_DEBUG_LOG_ENABLED"`
+	Path    string              `json:"path" env:"PICOCLAW_PROVIDER_DEBUG_LOG_PATH"`
+	Key     string              `json:"key" env:"PICOCLAW_PROVIDER_DEBUG_LOG_KEY"`
+	Admins  FlexibleStringSlice `json:"admins" env:"PICOCLAW_PROVIDER_DEBUG_LOG_ADMINS"`
+}
+
+// HedgingConfig represents hedged requests: when the primary provider has not
+// answered after DelayMS, the same request is sent to Provider and the first
+// complete response wins. This trades cost for responsiveness.
+type HedgingConfig struct {
+	Enabled  bool   `json:"enabled" env:"PICOCLAW_HEDGING_ENABLED"`
+	Provider string `json:"provider" env:"PICOCLAW_HEDGING_PROVIDER"`
+	Model    string `json:"model" env:"PICOCLAW_HEDGING_MODEL"`       // Empty uses the primary model
+	DelayMS  int    `json:"delay_ms" env:"PICOCLAW_HEDGING_DELAY_MS"` // 0 selects the default (2000)
+}
+
+// ToolPrefetchConfig represents speculative tool prefetching. When a rule
+// matches the user message its tool call starts alongside the LLM request,
+// and the result is used if the model asks for the same call.
+type ToolPrefetchConfig struct {
+	Enabled        bool               `json:"enabled" env:"PICOCLAW_TOOL_PREFETCH_ENABLED"`
+	TimeoutSeconds int                `json:"timeout_seconds" env:"PICOCLAW_TOOL_PREFETCH_TIMEOUT_SECONDS"` // 0 selects the default (30)
+	Rules          []ToolPrefetchRule `json:"rules"`
+}
+
+// ToolPrefetchRule predicts a tool call from keywords in the user message.
+// String arguments may contain {message}, replaced by the message text.
+type ToolPrefetchRule struct {
+	Keywords FlexibleStringSlice    `json:"keywords"`
+	Tool     string                 `json:"tool"`
+	Args     map[string]interface{} `json:"args"`
+}
+
+// NotificationsConfig holds templates for system notifications (alerts,
+// reminders, errors, ...). Templates are keyed by notification type, then by
+// channel name, with "default" applying to other channels. They are Go
+// text/template strings executed with .Type, .Channel, .ChatID, .Time and
+// .Content, the notification text in the channel's markup.
+type NotificationsConfig struct {
+	Templates map[string]map[string]string `json:"templates,omitempty"`
+}
+
+// PipelineConfig transforms the text of outgoing messages between the bus
+// and the channels. Channels lists the stages each channel runs, in order,
+// with "default" applying to channels not listed: "profanity" masks swear
+// words, "redact_secrets" removes API keys and tokens, "cap_length" cuts
+// long messages and "template" wraps the text.
+type PipelineConfig struct {
+	Channels       map[string][]string `json:"channels,omitempty"`
+	ProfanityWords []string            `json:"profanity_words,omitempty"` // Masked in addition to the built-in list
+	RedactPatterns []string            `json:"redact_patterns,omitempty"` // Regular expressions redacted in addition to the built-in secrets
+
+	// Characters cap_length keeps; 0 selects 4000
+	MaxLength int `json:"max_length" env:"PICOCLAW_PIPELINE_MAX_LENGTH"`
+	// Go text/template for the template stage, executed with .Content,
+	// .Channel and .ChatID
+	Template string `json:"template,omitempty" env:"PICOCLAW_PIPELINE_TEMPLATE"`
+}
+
+// CronBatchConfig makes scheduled agent jobs due at the same time (such as
+// digests for many chats) run as a throttled batch instead of all at once
+type CronBatchConfig struct {
+	Enabled       bool `json:"enabled" env:"PICOCLAW_CRON_BATCH_ENABLED"`
+	MaxConcurrent int  `json:"max_concurrent" env:"PICOCLAW_CRON_BATCH_MAX_CONCURRENT"`   // 0 runs one job at a time
+	MinIntervalMS int  `json:"min_interval_ms" env:"PICOCLAW_CRON_BATCH_MIN_INTERVAL_MS"` // Minimum time between job starts
+	SpreadSeconds int  `json:"spread_seconds" env:"PICOCLAW_CRON_BATCH_SPREAD_SECONDS"`   // Window the job starts are spread over
+}
+
+
+// DispatchConfig sets how many agent turns run at once. Messages of
+// different chats are handled in parallel by up to Workers turns; those of
+// one chat always one after the other.
+type DispatchConfig struct {
+	Workers int `json:"workers" env:"PICOCLAW_DISPATCH_WORKERS"` // 0 selects the default (4); 1 handles one message at a time
+}
+
+// SessionConfig chooses where sessions, the conversation of each chat with
+// its summary and settings, are kept. "file" (default) keeps a JSON file
+// per session in the directory at Path, "memory" keeps them until restart,
+// "sqlite" keeps them in the SQLite database at Path and "redis" on the
+// server at URL.
+type SessionConfig struct {
+	Backend string `json:"backend" env:"PICOCLAW_SESSION_BACKEND"`
+	Path    string `json:"path" env:"PICOCLAW_SESSION_PATH"`             // Relative to the workspace; empty selects sessions, or sessions.db for sqlite
+	URL     string `json:"url" env:"PICOCLAW_SESSION_URL" secret:"true"` // redis://[user:password@]host[:port][/db], rediss:// for TLS
+	// Sessions idle for longer are forgotten; 0 keeps them
+	TTLHours int `json:"ttl_hours" env:"PICOCLAW_SESSION_TTL_HOURS"`
+}
+
+// ScheduledPromptsConfig defines recurring agent prompts, such as morning
+// digests. Prompts are Go text/template strings executed with .Name and
+// .Now; {{context "calendar"}}, {{context "feeds"}} and {{context "metrics"}}
+// pull in today's events, feed items published since the previous run and
+// the board's metrics when the prompt runs.
+type ScheduledPromptsConfig struct {
+	Timezone     string              `json:"timezone" env:"PICOCLAW_SCHEDULED_PROMPTS_TIMEZONE"`             // IANA name for calendar dates; empty uses local time
+	Calendars    FlexibleStringSlice `json:"calendars" env:"PICOCLAW_SCHEDULED_PROMPTS_CALENDARS"`           // ICS URLs read by the calendar provider
+	Feeds        FlexibleStringSlice `json:"feeds" env:"PICOCLAW_SCHEDULED_PROMPTS_FEEDS"`                   // RSS or Atom URLs read by the feeds provider
+	MaxFeedItems int                 `json:"max_feed_items" env:"PICOCLAW_SCHEDULED_PROMPTS_MAX_FEED_ITEMS"` // Per feed; 0 lists 10
+	Prompts      []ScheduledPrompt   `json:"prompts"`
+}
+
+// ScheduledPrompt is one recurring prompt. Its answer goes to Channel and To.
+type ScheduledPrompt struct {
+	Name     string `json:"name"` // Unique; identifies the job across restarts
+	Cron     string `json:"cron"` // Cron expression, e.g. "0 8 * * 1-5"
+	Message  string `json:"message"`
+	Channel  string `json:"channel"` // "admins" sends the reply to every admin listed as channel:sender_id
+	To       string `json:"to"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// QuietHoursConfig silences the agent during time windows. Messages that
+// arrive inside a window are queued until it ends, or dropped.
+type QuietHoursConfig struct {
+	Enabled  bool             `json:"enabled" env:"PICOCLAW_QUIET_HOURS_ENABLED"`
+	Timezone string           `json:"timezone" env:"PICOCLAW_QUIET_HOURS_TIMEZONE"` // IANA name; empty uses local time
+	Rules    []QuietHoursRule `json:"rules"`
+}
+
+// QuietHoursRule is one do-not-disturb window. When is a cron expression
+// and the window is every minute it matches, e.g. "* 22-23,0-6 * * *" for
+// nights or "* * * * 6,0" for weekends.
+type QuietHoursRule struct {
+	Channel     string `json:"channel"` // Empty matches every channel
+	Contact     string `json:"contact"` // Chat or sender ID; empty matches everyone
+	When        string `json:"when"`
+	Policy      string `json:"policy"`       // "queue" (default) or "drop"
+	AwayMessage string `json:"away_message"` // Sent once per chat and window
+}
+
+// TranscriptArchiveConfig mirrors every user message and agent reply to
+// the configured destinations, in batches sent every FlushSeconds. Entries
+// are redacted like the provider debug log unless DisableRedaction is set.
+type TranscriptArchiveConfig struct {
+	Enabled          bool                    `json:"enabled" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_ENABLED"`
+	FlushSeconds     int                     `json:"flush_seconds" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_FLUSH_SECONDS"` // 0 selects the default (10)
+	DisableRedaction bool                    `json:"disable_redaction" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_DISABLE_REDACTION"`
+	RedactPatterns   FlexibleStringSlice     `json:"redact_patterns" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_REDACT_PATTERNS"` // Extra regular expressions replaced by [REDACTED]
+	Channel          TranscriptChannelConfig `json:"channel"`
+	Email            TranscriptEmailConfig   `json:"email"`
+	S3               S3Config                `json:"s3"`
+}
+
+// TranscriptChannelConfig sends transcripts to a chat, such as a private
+// Telegram channel the bot posts in
+type TranscriptChannelConfig struct {
+	Channel string `json:"channel" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_CHANNEL_CHANNEL"` // Empty disables this destination
+	ChatID  string `json:"chat_id" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_CHANNEL_CHAT_ID"`
+}
+
+// TranscriptEmailConfig mails transcripts over SMTP, one mail per
+// conversation and batch. Longer flush intervals suit this destination.
+type TranscriptEmailConfig struct {
+	SMTPHost string              `json:"smtp_host" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_EMAIL_SMTP_HOST"` // Empty disables this destination
+	SMTPPort int                 `json:"smtp_port" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_EMAIL_SMTP_PORT"` // 0 selects the default (587)
+	Username string              `json:"username" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_EMAIL_USERNAME"`
+	Password string              `json:"password" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_EMAIL_PASSWORD"`
+	From     string              `json:"from" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_EMAIL_FROM"`
+	To       FlexibleStringSlice `json:"to" env:"PICOCLAW_TRANSCRIPT_ARCHIVE_EMAIL_TO"`
+}
+
+// S3Config points to a bucket on AWS S3 or a compatible store such as
+// MinIO. Its environment variables follow the JSON path, e.g.
+// PICOCLAW_TRANSCRIPT_ARCHIVE_S3_BUCKET.
+type S3Config struct {
+	Endpoint  string `json:"endpoint"` // Empty uses AWS; otherwise path-style URLs are used
+	Region    string `json:"region"`   // Empty selects us-east-1
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"` // Prepended to object keys
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// WorkspaceSyncConfig keeps the workspace in sync with an S3 bucket or a
+// WebDAV folder, every IntervalSeconds and, with OnChange, shortly after
+// local files change. Files changed on both sides since the last sync are
+// resolved by Conflict; a deletion never wins over a change.
+type WorkspaceSyncConfig struct {
+	Enabled         bool                `json:"enabled" env:"PICOCLAW_WORKSPACE_SYNC_ENABLED"`
+	Backend         string              `json:"backend" env:"PICOCLAW_WORKSPACE_SYNC_BACKEND"`                   // "s3" or "webdav"
+	Direction       string              `json:"direction" env:"PICOCLAW_WORKSPACE_SYNC_DIRECTION"`               // "both" (default), "upload" or "download"
+	IntervalSeconds int                 `json:"interval_seconds" env:"PICOCLAW_WORKSPACE_SYNC_INTERVAL_SECONDS"` // 0 selects the default (300)
+	OnChange        bool                `json:"on_change" env:"PICOCLAW_WORKSPACE_SYNC_ON_CHANGE"`
+	Conflict        string              `json:"conflict" env:"PICOCLAW_WORKSPACE_SYNC_CONFLICT"`           // "newer" (default), "local", "remote" or "keep_both"
+	UploadKBps      int                 `json:"upload_kbps" env:"PICOCLAW_WORKSPACE_SYNC_UPLOAD_KBPS"`     // 0 means no limit
+	DownloadKBps    int                 `json:"download_kbps" env:"PICOCLAW_WORKSPACE_SYNC_DOWNLOAD_KBPS"` // 0 means no limit
+	Exclude         FlexibleStringSlice `json:"exclude" env:"PICOCLAW_WORKSPACE_SYNC_EXCLUDE"`             // Glob patterns of workspace paths, e.g. "sessions" or "*.tmp"
+	S3              S3Config            `json:"s3"`
+	WebDAV          WebDAVConfig        `json:"webdav"`
+}
+
+// WebDAVConfig points to a WebDAV folder, such as a Nextcloud directory.
+// Its environment variables follow the JSON path, e.g.
+// PICOCLAW_WORKSPACE_SYNC_WEBDAV_URL.
+type WebDAVConfig struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ProgressConfig sends updates derived from tool calls during long agent
+// tasks. "milestones" reports each tool the first time a task uses it,
+// "verbose" every call and failure. Channels that can edit messages keep the
+// updates of a task in one message, which becomes the final answer.
+type ProgressConfig struct {
+	Verbosity string `json:"verbosity" env:"PICOCLAW_PROGRESS_VERBOSITY"` // "silent" (default), "milestones" or "verbose"
+	// Verbosity per channel, overriding the default
+	Channels map[string]string `json:"channels,omitempty"`
+}
+
+// GuestConfig lets admins share the agent with /share, which creates a
+// one-off link (Telegram deep links) admitting one person until it expires.
+// Guests chat with a separate persona that has no tools and no access to the
+// workspace memory, and their chats are never written to disk.
+type GuestConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_GUEST_ENABLED"`
+	Persona    string `json:"persona" env:"PICOCLAW_GUEST_PERSONA"`         // System prompt for guests; empty uses a friendly default
+	LinkHours  int    `json:"link_hours" env:"PICOCLAW_GUEST_LINK_HOURS"`   // Default validity of links; 0 selects 24
+	MaxHistory int    `json:"max_history" env:"PICOCLAW_GUEST_MAX_HISTORY"` // Messages kept per guest chat; 0 selects 20
+}
+
+// UsageConfig keeps a ledger of the tokens used by every model call in
+// workspace/usage and exports each month's usage per provider, chat and
+// model, priced with cost_estimate.pricing. The export of a month is written
+// on the 1st of the next one, and sent to the owner chat and mailed when
+// those are configured.
+type UsageConfig struct {
+	Enabled bool             `json:"enabled" env:"PICOCLAW_USAGE_ENABLED"`
+	Channel string           `json:"channel" env:"PICOCLAW_USAGE_CHANNEL"` // Owner chat receiving the export; empty disables
+	ChatID  string           `json:"chat_id" env:"PICOCLAW_USAGE_CHAT_ID"`
+	Email   UsageEmailConfig `json:"email"`
+}
+
+// UsageEmailConfig mails the monthly export with the CSV attached
+type UsageEmailConfig struct {
+	SMTPHost string              `json:"smtp_host" env:"PICOCLAW_USAGE_EMAIL_SMTP_HOST"` // Empty disables mailing
+	SMTPPort int                 `json:"smtp_port" env:"PICOCLAW_USAGE_EMAIL_SMTP_PORT"` // 0 selects the default (587)
+	Username string              `json:"username" env:"PICOCLAW_USAGE_EMAIL_USERNAME"`
+	Password string              `json:"password" env:"PICOCLAW_USAGE_EMAIL_PASSWORD"`
+	From     string              `json:"from" env:"PICOCLAW_USAGE_EMAIL_FROM"`
+	To       FlexibleStringSlice `json:"to" env:"PICOCLAW_USAGE_EMAIL_TO"`
+}
+
+// ExpiryMonitorConfig watches the expiry of certificates and access tokens
+// and alerts the owner chat before they lapse. The certificate of wss://
+// WhatsApp bridges, the Graph API access token and stored OAuth logins are
+// watched automatically; status is served at /admin/expiry and answered to
+// /admin expiry.
+type ExpiryMonitorConfig struct {
+	Enabled    bool                `json:"enabled" env:"PICOCLAW_EXPIRY_MONITOR_ENABLED"`
+	WarnDays   int                 `json:"warn_days" env:"PICOCLAW_EXPIRY_MONITOR_WARN_DAYS"`     // 0 selects the default (14)
+	CheckHours int                 `json:"check_hours" env:"PICOCLAW_EXPIRY_MONITOR_CHECK_HOURS"` // 0 selects the default (12)
+	Channel    string              `json:"channel" env:"PICOCLAW_EXPIRY_MONITOR_CHANNEL"`         // Owner chat receiving alerts; empty uses the last active chat
+	ChatID     string              `json:"chat_id" env:"PICOCLAW_EXPIRY_MONITOR_CHAT_ID"`
+	Endpoints  FlexibleStringSlice `json:"endpoints" env:"PICOCLAW_EXPIRY_MONITOR_ENDPOINTS"`   // Extra TLS endpoints, as host:port or https:// URLs, e.g. the gateway's public address
+	CertFiles  FlexibleStringSlice `json:"cert_files" env:"PICOCLAW_EXPIRY_MONITOR_CERT_FILES"` // PEM certificate files, e.g. those of a reverse proxy
+}
+
+// ProviderHTTPConfig tunes the HTTP connections shared by the LLM providers
+type ProviderHTTPConfig struct {
+	MaxIdleConnsPerHost    int  `json:"max_idle_conns_per_host" env:"PICOCLAW_PROVIDER_HTTP_MAX_IDLE_CONNS_PER_HOST"`     // 0 selects the default (16)
+	MaxConnsPerHost        int  `json:"max_conns_per_host" env:"PICOCLAW_PROVIDER_HTTP_MAX_CONNS_PER_HOST"`               // 0 means no limit
+	IdleConnTimeoutSeconds int  `json:"idle_conn_timeout_seconds" env:"PICOCLAW_PROVIDER_HTTP_IDLE_CONN_TIMEOUT_SECONDS"` // 0 selects the default (300)
+	DisableHTTP2           bool `json:"disable_http2" env:"PICOCLAW_PROVIDER_HTTP_DISABLE_HTTP2"`
+	// Open the provider connections at startup instead of on the first message
+	Prewarm bool `json:"prewarm" env:"PICOCLAW_PROVIDER_HTTP_PREWARM"`
+}
+
+// ToolsConfig represents optional agent tool configurations
+type ToolsConfig struct {
+	Kubernetes KubernetesToolConfig `json:"kubernetes"`
+	Repo       RepoToolConfig       `json:"repo"`
+	Issues     IssueTrackerConfig   `json:"issues"`
+	Secrets    SecretsToolConfig    `json:"secrets"`
+}
+
+// KubernetesToolConfig represents the read-only Kubernetes tool configuration
+type KubernetesToolConfig struct {
+	Enabled           bool                `json:"enabled" env:"PICOCLAW_TOOLS_KUBERNETES_ENABLED"`
+	KubectlPath       string              `json:"kubectl_path" env:"PICOCLAW_TOOLS_KUBERNETES_KUBECTL_PATH"`
+	Kubeconfigs       map[string]string   `json:"kubeconfigs,omitempty"`
+	AllowedNamespaces FlexibleStringSlice `json:"allowed_namespaces" env:"PICOCLAW_TOOLS_KUBERNETES_ALLOWED_NAMESPACES"`
+	AllowMutations    bool                `json:"allow_mutations" env:"PICOCLAW_TOOLS_KUBERNETES_ALLOW_MUTATIONS"`
+	// Let describe list the keys of ConfigMaps, with their values redacted
+	DescribeConfigMaps bool `json:"describe_configmaps" env:"PICOCLAW_TOOLS_KUBERNETES_DESCRIBE_CONFIGMAPS"`
+	TimeoutSeconds     int  `json:"timeout_seconds" env:"PICOCLAW_TOOLS_KUBERNETES_TIMEOUT_SECONDS"`
+}
+
+// RepoToolConfig represents the GitHub/GitLab repository tool configuration
+type RepoToolConfig struct {
+	Enabled       bool                `json:"enabled" env:"PICOCLAW_TOOLS_REPO_ENABLED"`
+	GitHubToken   string              `json:"github_token" env:"PICOCLAW_TOOLS_REPO_GITHUB_TOKEN"`
+	GitHubAPIBase string              `json:"github_api_base" env:"PICOCLAW_TOOLS_REPO_GITHUB_API_BASE"`
+	GitLabToken   string              `json:"gitlab_token" env:"PICOCLAW_TOOLS_REPO_GITLAB_TOKEN"`
+	GitLabAPIBase string              `json:"gitlab_api_base" env:"PICOCLAW_TOOLS_REPO_GITLAB_API_BASE"`
+	AllowedRepos  FlexibleStringSlice `json:"allowed_repos" env:"PICOCLAW_TOOLS_REPO_ALLOWED_REPOS"`
+}
+
+// IssueTrackerConfig represents the Jira/Linear ticket tool configuration
+type IssueTrackerConfig struct {
+	Enabled         bool                `json:"enabled" env:"PICOCLAW_TOOLS_ISSUES_ENABLED"`
+	JiraBaseURL     string              `json:"jira_base_url" env:"PICOCLAW_TOOLS_ISSUES_JIRA_BASE_URL"`
+	JiraEmail       string              `json:"jira_email" env:"PICOCLAW_TOOLS_ISSUES_JIRA_EMAIL"`
+	JiraAPIToken    string              `json:"jira_api_token" env:"PICOCLAW_TOOLS_ISSUES_JIRA_API_TOKEN"`
+	LinearAPIKey    string              `json:"linear_api_key" env:"PICOCLAW_TOOLS_ISSUES_LINEAR_API_KEY"`
+	AllowedProjects FlexibleStringSlice `json:"allowed_projects" env:"PICOCLAW_TOOLS_ISSUES_ALLOWED_PROJECTS"`
+}
+
+// SecretsToolConfig represents the password manager lookup tool configuration.
+// Backend is "pass", "bitwarden" or "vault". TOTP also registers the 2FA code
+// tool, which reads its seeds from the same backend.
+type SecretsToolConfig struct {
+	Enabled            bool                `json:"enabled" env:"PICOCLAW_TOOLS_SECRETS_ENABLED"`
+	Backend            string              `json:"backend" env:"PICOCLAW_TOOLS_SECRETS_BACKEND"`
+	Command            string              `json:"command" env:"PICOCLAW_TOOLS_SECRETS_COMMAND"` // pass or bw binary
+	VaultAddr          string              `json:"vault_addr" env:"PICOCLAW_TOOLS_SECRETS_VAULT_ADDR"`
+	VaultToken         string              `json:"vault_token" env:"PICOCLAW_TOOLS_SECRETS_VAULT_TOKEN"`
+	VaultMount         string              `json:"vault_mount" env:"PICOCLAW_TOOLS_SECRETS_VAULT_MOUNT"`
+	Owners             FlexibleStringSlice `json:"owners" env:"PICOCLAW_TOOLS_SECRETS_OWNERS"`
+	SkipApproval       bool                `json:"skip_approval" env:"PICOCLAW_TOOLS_SECRETS_SKIP_APPROVAL"`
+	TOTP               bool                `json:"totp" env:"PICOCLAW_TOOLS_SECRETS_TOTP"`
+	DeleteAfterMinutes int                 `json:"delete_after_minutes" env:"PICOCLAW_TOOLS_SECRETS_DELETE_AFTER_MINUTES"`
+	TimeoutSeconds     int                 `json:"timeout_seconds" env:"PICOCLAW_TOOLS_SECRETS_TIMEOUT_SECONDS"`
+}
+
+// RepoWebhookConfig represents the GitHub/GitLab webhook ingestion channel configuration
+type RepoWebhookConfig struct {
+	Enabled       bool                `json:"enabled" env:"PICOCLAW_CHANNELS_REPO_WEBHOOK_ENABLED"`
+	WebhookHost   string              `json:"webhook_host" env:"PICOCLAW_CHANNELS_REPO_WEBHOOK_HOST"`
+	WebhookPort   int                 `json:"webhook_port" env:"PICOCLAW_CHANNELS_REPO_WEBHOOK_PORT"`
+	WebhookPath   string              `json:"webhook_path" env:"PICOCLAW_CHANNELS_REPO_WEBHOOK_PATH"`
+	GitHubSecret  string              `json:"github_secret" env:"PICOCLAW_CHANNELS_REPO_WEBHOOK_GITHUB_SECRET"`
+	GitLabToken   string              `json:"gitlab_token" env:"PICOCLAW_CHANNELS_REPO_WEBHOOK_GITLAB_TOKEN"`
+	Events        FlexibleStringSlice `json:"events" env:"PICOCLAW_CHANNELS_REPO_WEBHOOK_EVENTS"`
+	NotifyChannel string              `json:"notify_channel" env:"PICOCLAW_CHANNELS_REPO_WEBHOOK_NOTIFY_CHANNEL"`
+	NotifyChatID  string              `json:"notify_chat_id" env:"PICOCLAW_CHANNELS_REPO_WEBHOOK_NOTIFY_CHAT_ID"`
+}
+
+// AlertWebhookConfig represents the PagerDuty/Opsgenie alert ingestion channel configuration
+type AlertWebhookConfig struct {
+	Enabled          bool   `json:"enabled" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_ENABLED"`
+	WebhookHost      string `json:"webhook_host" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_HOST"`
+	WebhookPort      int    `json:"webhook_port" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_PORT"`
+	WebhookPath      string `json:"webhook_path" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_PATH"`
+	PagerDutySecret  string `json:"pagerduty_secret" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_PAGERDUTY_SECRET"`
+	PagerDutyAPIKey  string `json:"pagerduty_api_key" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_PAGERDUTY_API_KEY"`
+	PagerDutyFrom    string `json:"pagerduty_from" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_PAGERDUTY_FROM"`
+	PagerDutyAPIBase string `json:"pagerduty_api_base" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_PAGERDUTY_API_BASE"`
+	OpsgenieToken    string `json:"opsgenie_token" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_OPSGENIE_TOKEN"`
+	OpsgenieAPIKey   string `json:"opsgenie_api_key" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_OPSGENIE_API_KEY"`
+	OpsgenieAPIBase  string `json:"opsgenie_api_base" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_OPSGENIE_API_BASE"`
+	NotifyChannel    string `json:"notify_channel" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_NOTIFY_CHANNEL"`
+	NotifyChatID     string `json:"notify_chat_id" env:"PICOCLAW_CHANNELS_ALERT_WEBHOOK_NOTIFY_CHAT_ID"`
+}
+
 // Load loads configuration from file and environment
 func Load(configPath string) (*Config, error) {
+	return LoadWithOptions(configPath, LoadOptions{})
+}
+
+// LoadOptions change how LoadWithOptions reads the config
+type LoadOptions struct {
+	// Strict fails on the keys of the config file that Lint reports,
+	// instead of ignoring them
+	Strict bool
+	// Profile names the profile of the config file to apply; the
+	// PICOCLAW_PROFILE environment variable when empty
+	Profile string
+}
+
+// LoadWithOptions is Load with options
+func LoadWithOptions(configPath string, opts LoadOptions) (*Config, error) {
+	if opts.Strict && configPath != "" {
+		issues, err := Lint(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config from file: %w", err)
+		}
+		if len(issues) > 0 {
+			msgs := make([]string, len(issues))
+			for i, issue := range issues {
+				msgs[i] = issue.String()
+			}
+			return nil, fmt.Errorf("config has ignored keys: %s", strings.Join(msgs, "; "))
+		}
+	}
+	if opts.Profile == "" {
+		opts.Profile = os.Getenv(profileEnv)
+	}
+
 	cfg := &Config{}
 	
 	// Load from file if exists
 	if configPath != "" {
-		if err := loadFromFile(configPath, cfg); err != nil {
+		if err := loadFromFile(configPath, opts.Profile, cfg); err != nil {
 			return nil, fmt.Errorf("failed to load config from file: %w", err)
 		}
 	}
 	
 	// Override with environment variables
-	if err := env.Parse(cfg); err != nil {
+	if err := parseEnv(cfg, os.Environ()); err != nil {
 		return nil, fmt.Errorf("failed to parse environment: %w", err)
 	}
 	
+	// Resolve env:, file: and vault: references to secrets
+	if err := resolveSecretRefs(reflect.ValueOf(cfg).Elem(), "", false); err != nil {
+		return nil, fmt.Errorf("failed to resolve secret: %w", err)
+	}
+	
 	// Apply defaults
 	cfg.applyDefaults()
 	
@@ -154,8 +1162,9 @@ func Load(configPath string) (*Config, error) {
 	return cfg, nil
 }
 
-// loadFromFile loads configuration from JSON file
-func loadFromFile(configPath string, cfg *Config) error {
+// loadFromFile loads configuration from a JSON, YAML or TOML file, merged
+// with the files it includes and the profile called profile, if any
+func loadFromFile(configPath, profile string, cfg *Config) error {
 	// Expand home directory
 	configPath = expandPath(configPath)
 	
@@ -168,50 +1177,44 @@ func loadFromFile(configPath string, cfg *Config) error {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
 	
-	// Parse JSON
-	if err := json.Unmarshal(data, cfg); err != nil {
-		return fmt.Errorf("failed to parse config JSON: %w", err)
+	// A single file of the current version decodes as it is
+	doc, err := decodeDocument(configPath, data)
+	if err != nil {
+		return err
+	}
+	root, _ := doc.(map[string]interface{})
+	_, hasIncludes := root[includeKey]
+	_, hasProfiles := root[profilesKey]
+	if version, err := documentVersion(root); err != nil {
+		return err
+	} else if version == CurrentConfigVersion && !hasIncludes && !hasProfiles && profile == "" {
+		return decodeConfig(configPath, data, cfg)
 	}
 	
-	return nil
-}
-
-// applyDefaults applies default values
-func (c *Config) applyDefaults() {
-	if c.BindAddress == "" {
-		c.BindAddress = "0.0.0.0:8080"
+	// Merge the includes and the profile, upgrading files of older versions
+	c := &composer{migrate: true}
+	root, err = c.composeFile(configPath)
+	if err == nil {
+		root, err = c.applyProfile(configPath, root, profile)
 	}
-	if c.LogLevel == "" {
-		c.LogLevel = "info"
+	if err != nil {
+		return err
 	}
-	if c.AI.DefaultProvider == "" {
-		c.AI.DefaultProvider = "openai"
+	cfg.migrationNotes = c.notes
+	merged, err := json.Marshal(root)
+	if err != nil {
+		return fmt.Errorf("failed to merge config: %w", err)
 	}
-	
-	// Set default Facebook API version
-	if c.Channels.WhatsApp.FBAPIVersion == "" {
-		c.Channels.WhatsApp.FBAPIVersion = "v22.0"
+	if err := json.Unmarshal(merged, cfg); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
 	}
+	return nil
 }
 
-// Validate validates the configuration
-func (c *Config) Validate() error {
-	// Validate channels
-	if c.Channels.WhatsApp.Enabled {
-		// Check if either bridge URL or Facebook API credentials are provided
-		hasBridge := c.Channels.WhatsApp.BridgeURL != ""
-		hasFBAPI := c.Channels.WhatsApp.FBPhoneNumberID != "" && c.Channels.WhatsApp.FBAccessToken != ""
-		
-		if !hasBridge && !hasFBAPI {
-			return fmt.Errorf("whatsapp: either bridge_url or facebook api credentials (fb_phone_number_id and fb_access_token) must be provided")
-		}
-		
-		if hasBridge && hasFBAPI {
-			return fmt.Errorf("whatsapp: cannot use both bridge_url and facebook api simultaneously")
-		}
-	}
-	
-	return nil
+// MigrationNotes says what was changed in memory to load a config file of
+// an older version, for warning that it should be migrated
+func (c *Config) MigrationNotes() []string {
+	return c.migrationNotes
 }
 
 // GetProvider returns a provider configuration by name
@@ -0,0 +1,293 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config values can be stored encrypted, as "enc:v1:" and the base64 of a
+// nonce and AES-256-GCM ciphertext, so a copied config file does not leak
+// bot tokens. Load decrypts them like other secret references.
+const (
+	encryptedScheme  = "enc"
+	encryptedVersion = "v1:"
+
+	// configKeyEnv holds the config key: 32 random bytes in base64 or
+	// hex, used as the AES key. Passphrases are refused, as a hash of one
+	// can be guessed offline from any copy of the config.
+	configKeyEnv = envPrefix + "_CONFIG_KEY"
+	// configKeyFileEnv names a file holding the config key
+	configKeyFileEnv = configKeyEnv + "_FILE"
+)
+
+// DefaultConfigKeyFile holds the config key when neither PICOCLAW_CONFIG_KEY
+// nor PICOCLAW_CONFIG_KEY_FILE is set
+const DefaultConfigKeyFile = "~/.picoclaw/config.key"
+
+// configKeyFile returns the file the config key is read from
+func configKeyFile() string {
+	if path := os.Getenv(configKeyFileEnv); path != "" {
+		return expandPath(path)
+	}
+	return expandPath(DefaultConfigKeyFile)
+}
+
+// configKey returns the key of the encrypted config values
+func configKey() ([]byte, error) {
+	if key := os.Getenv(configKeyEnv); key != "" {
+		raw, err := decodeConfigKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", configKeyEnv, err)
+		}
+		return raw, nil
+	}
+	path := configKeyFile()
+	key, err := readSecretFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no config key: set %s or create %s", configKeyEnv, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config key: %w", err)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("config key file %s is empty", path)
+	}
+	raw, err := decodeConfigKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("config key file %s: %w", path, err)
+	}
+	return raw, nil
+}
+
+// decodeConfigKey decodes a config key of 32 bytes in hex or base64
+func decodeConfigKey(key string) ([]byte, error) {
+	key = strings.TrimSpace(key)
+	if raw, err := hex.DecodeString(key); err == nil && len(raw) == 32 {
+		return raw, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if raw, err := enc.DecodeString(key); err == nil && len(raw) == 32 {
+			return raw, nil
+		}
+	}
+	return nil, fmt.Errorf("config key must be 32 random bytes in base64 or hex, e.g. from `openssl rand -base64 32`")
+}
+
+// EnsureConfigKey creates a random config key in the key file when no key
+// is set, and returns its path; "" means a key was already set. The key
+// must be kept: the encrypted values cannot be read without it.
+func EnsureConfigKey() (string, error) {
+	if _, err := configKey(); err == nil || os.Getenv(configKeyEnv) != "" {
+		// A key in the environment wins over the file, even a bad one
+		return "", err
+	}
+	path := configKeyFile()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		// Unreadable or empty; not ours to replace
+		_, err := configKey()
+		return "", err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create config key: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(raw) + "\n"
+	if err := os.WriteFile(path, []byte(key), 0600); err != nil {
+		return "", fmt.Errorf("failed to create config key: %w", err)
+	}
+	return path, nil
+}
+
+func configCipher() (cipher.AEAD, error) {
+	key, err := configKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptValue seals a config value
+func encryptValue(aead cipher.AEAD, value string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedScheme + ":" + encryptedVersion + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// resolveEncryptedRef decrypts the part of an encrypted value after "enc:"
+func resolveEncryptedRef(ref string) (string, error) {
+	data, ok := strings.CutPrefix(ref, encryptedVersion)
+	if !ok {
+		return "", fmt.Errorf("unknown encrypted value format")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("encrypted value is not base64: %w", err)
+	}
+	aead, err := configCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted value is truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt value, wrong config key?")
+	}
+	return string(plain), nil
+}
+
+// EncryptFile encrypts the secrets of the config file at path: the values
+// of keys named like secrets (token, api_key, password, ...) and headers,
+// and every value under the JSON paths in sections, e.g. "channels".
+// Values that are already references, such as env: or enc:, are kept. It
+// returns the file, in JSON or YAML like the file, and the number of
+// values encrypted.
+func EncryptFile(path string, sections []string) ([]byte, int, error) {
+	aead, err := configCipher()
+	if err != nil {
+		return nil, 0, err
+	}
+	doc, err := readDocument(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count := 0
+	var encrypt func(v interface{}, path string, secret bool) (interface{}, error)
+	encrypt = func(v interface{}, path string, secret bool) (interface{}, error) {
+		for _, section := range sections {
+			secret = secret || path == section
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, item := range v {
+				value, err := encrypt(item, joinKey(path, key), secret || isSecretKey(key))
+				if err != nil {
+					return nil, err
+				}
+				v[key] = value
+			}
+		case []interface{}:
+			for i, item := range v {
+				value, err := encrypt(item, path, secret)
+				if err != nil {
+					return nil, err
+				}
+				v[i] = value
+			}
+		case string:
+			if _, _, isRef := secretResolver(v); !secret || v == "" || isRef {
+				return v, nil
+			}
+			count++
+			return encryptValue(aead, v)
+		}
+		return v, nil
+	}
+	if _, err := encrypt(doc, "", false); err != nil {
+		return nil, 0, err
+	}
+
+	data, err := encodeDocument(path, doc)
+	return data, count, err
+}
+
+// DecryptFile replaces the encrypted values of the config file at path
+// with what they hold, and returns the file and the number of values
+// decrypted
+func DecryptFile(path string) ([]byte, int, error) {
+	doc, err := readDocument(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count := 0
+	var decrypt func(v interface{}, path string) (interface{}, error)
+	decrypt = func(v interface{}, path string) (interface{}, error) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, item := range v {
+				value, err := decrypt(item, joinKey(path, key))
+				if err != nil {
+					return nil, err
+				}
+				v[key] = value
+			}
+		case []interface{}:
+			for i, item := range v {
+				value, err := decrypt(item, fmt.Sprintf("%s[%d]", path, i))
+				if err != nil {
+					return nil, err
+				}
+				v[i] = value
+			}
+		case string:
+			ref, ok := strings.CutPrefix(v, encryptedScheme+":")
+			if !ok {
+				return v, nil
+			}
+			plain, err := resolveEncryptedRef(ref)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			count++
+			return plain, nil
+		}
+		return v, nil
+	}
+	if _, err := decrypt(doc, ""); err != nil {
+		return nil, 0, err
+	}
+
+	data, err := encodeDocument(path, doc)
+	return data, count, err
+}
+
+// readDocument reads and decodes the config file at path
+func readDocument(path string) (interface{}, error) {
+	data, err := os.ReadFile(expandPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return decodeDocument(path, data)
+}
+
+// encodeDocument writes a config document in the format of the file at
+// path; TOML cannot be written and comes out as JSON
+func encodeDocument(path string, doc interface{}) ([]byte, error) {
+	var data []byte
+	var err error
+	if configFormat(path) == "YAML" {
+		data, err = yaml.Marshal(doc)
+	} else {
+		data, err = json.MarshalIndent(doc, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write config: %w", err)
+	}
+	return data, nil
+}
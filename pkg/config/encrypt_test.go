@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testConfigKey is a config key in hex; keys in base64 are tested too
+const testConfigKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestEncryptFile(t *testing.T) {
+	t.Setenv(configKeyEnv, testConfigKey)
+	path := writeConfig(t, "config.json", `{
+  "channels": {
+    "telegram": {"enabled": true, "token": "123:abc", "allow_from": ["42"]},
+    "discord": {"token": "env:DISCORD_TOKEN"},
+    "mqtt": {"broker": "tcp://user:pw@broker:1883", "inbound_topic": "in"}
+  },
+  "ai": {"providers": [{"name": "openai", "api_key": "sk-live", "headers": {"X-Org": "org-1"}}]}
+}`)
+
+	data, count, err := EncryptFile(path, []string{"channels.mqtt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// token, api_key, the header and both mqtt values
+	if count != 5 {
+		t.Errorf("encrypted %d values, want 5", count)
+	}
+	for _, plain := range []string{"123:abc", "sk-live", "org-1", "broker:1883"} {
+		if strings.Contains(string(data), plain) {
+			t.Errorf("%q left in the clear:\n%s", plain, data)
+		}
+	}
+	for _, kept := range []string{`"42"`, `"env:DISCORD_TOKEN"`, `"openai"`, `"enc:v1:`} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("missing %s:\n%s", kept, data)
+		}
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load decrypts transparently
+	t.Setenv("DISCORD_TOKEN", "d")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Channels.Telegram.Token != "123:abc" || cfg.AI.Providers[0].APIKey != "sk-live" ||
+		cfg.AI.Providers[0].Headers["X-Org"] != "org-1" || cfg.Channels.MQTT.Broker != "tcp://user:pw@broker:1883" {
+		t.Errorf("decrypted config = %+v, %+v", cfg.Channels.Telegram, cfg.AI.Providers)
+	}
+
+	// Encrypting again finds nothing to do
+	if _, count, err := EncryptFile(path, nil); err != nil || count != 0 {
+		t.Errorf("second EncryptFile = %d, %v", count, err)
+	}
+
+	plain, count, err := DecryptFile(path)
+	if err != nil || count != 5 || !strings.Contains(string(plain), `"token": "123:abc"`) {
+		t.Errorf("DecryptFile = %d, %v\n%s", count, err, plain)
+	}
+
+	t.Setenv(configKeyEnv, "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "wrong config key") {
+		t.Errorf("wrong key error = %v", err)
+	}
+	if _, _, err := DecryptFile(path); err == nil || !strings.Contains(err.Error(), "cannot decrypt") {
+		t.Errorf("DecryptFile error = %v", err)
+	}
+}
+
+func TestEncryptFileYAML(t *testing.T) {
+	t.Setenv(configKeyEnv, "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8")
+	path := writeConfig(t, "config.yaml", "channels:\n  slack:\n    bot_token: xoxb-1\n")
+	data, count, err := EncryptFile(path, nil)
+	if err != nil || count != 1 || !strings.Contains(string(data), "bot_token: enc:v1:") {
+		t.Errorf("EncryptFile(yaml) = %d, %v\n%s", count, err, data)
+	}
+}
+
+func TestEnsureConfigKey(t *testing.T) {
+	t.Setenv(configKeyEnv, "")
+	keyFile := filepath.Join(t.TempDir(), "keys", "config.key")
+	t.Setenv(configKeyFileEnv, keyFile)
+
+	if _, err := configKey(); err == nil || !strings.Contains(err.Error(), configKeyEnv) {
+		t.Errorf("missing key error = %v", err)
+	}
+	created, err := EnsureConfigKey()
+	if err != nil || created != keyFile {
+		t.Fatalf("EnsureConfigKey = %q, %v", created, err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file: %v, %v", info, err)
+	}
+	key, err := configKey()
+	if err != nil || len(key) != 32 {
+		t.Errorf("configKey = %q, %v", key, err)
+	}
+	if created, err := EnsureConfigKey(); err != nil || created != "" {
+		t.Errorf("second EnsureConfigKey = %q, %v", created, err)
+	}
+}
+
+func TestConfigKeyRejectsPassphrases(t *testing.T) {
+	t.Setenv(configKeyFileEnv, filepath.Join(t.TempDir(), "config.key"))
+	for _, key := range []string{"correct horse battery staple", "k", testConfigKey[:62], "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwd"} {
+		t.Setenv(configKeyEnv, key)
+		if _, err := configKey(); err == nil || !strings.Contains(err.Error(), "32 random bytes") {
+			t.Errorf("configKey(%q) error = %v", key, err)
+		}
+		// A bad key in the environment is reported, not papered over with a new file
+		if created, err := EnsureConfigKey(); err == nil || created != "" {
+			t.Errorf("EnsureConfigKey with %q = %q, %v", key, created, err)
+		}
+	}
+}
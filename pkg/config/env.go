@@ -0,0 +1,243 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+)
+
+// envPrefix starts the environment variables derived from JSON paths.
+// Fields without an env tag are read from PICOCLAW_<PATH>, e.g.
+// PICOCLAW_CHANNELS_ACCESS, and list items from
+// PICOCLAW_<PATH>_<INDEX>_<FIELD>, e.g. PICOCLAW_AI_PROVIDERS_0_API_KEY.
+// Lists of strings take commas or JSON, other lists and maps JSON; single
+// headers are set with PICOCLAW_<PATH>_HEADERS_<NAME>.
+const envPrefix = "PICOCLAW"
+
+// headersType is the type of "headers" fields, whose HTTP headers can also
+// be set one at a time
+var headersType = reflect.TypeOf(map[string]string{})
+
+// maxEnvListIndex bounds list indexes, so a typo cannot allocate a huge list
+const maxEnvListIndex = 999
+
+// envParsers are the parsers env.Parse uses for config types it does not
+// handle well on its own
+var envParsers = map[reflect.Type]env.ParserFunc{
+	reflect.TypeOf(FlexibleStringSlice{}): func(value string) (interface{}, error) {
+		return parseEnvList(value)
+	},
+}
+
+// parseEnvList reads a list given as a JSON array or comma separated
+func parseEnvList(value string) (FlexibleStringSlice, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") {
+		var list FlexibleStringSlice
+		if err := json.Unmarshal([]byte(value), &list); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	list := FlexibleStringSlice{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, nil
+}
+
+// parseEnv overrides cfg with environment variables, including secrets read
+// from files: fields with an env tag first, then the fields and list items
+// named after their JSON path, and last the variables of Section.Env for the
+// fields still unset
+func parseEnv(cfg *Config, environ []string) error {
+	vars := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+
+	if err := loadSecretFiles(vars); err != nil {
+		return err
+	}
+
+	if err := env.ParseWithOptions(cfg, env.Options{Environment: vars, FuncMap: envParsers}); err != nil {
+		return err
+	}
+	if err := applyPathEnv(reflect.ValueOf(cfg).Elem(), envPrefix, vars); err != nil {
+		return err
+	}
+	return applySectionEnv(cfg, vars)
+}
+
+// applyPathEnv sets the untagged fields of struct v from variables named
+// prefix_<JSON NAME>
+func applyPathEnv(v reflect.Value, prefix string, vars map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		key := prefix + "_" + strings.ToUpper(name)
+		fv := v.Field(i)
+
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			if err := applyPathEnv(fv, key, vars); err != nil {
+				return err
+			}
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			if err := applyListEnv(fv, key, vars); err != nil {
+				return err
+			}
+		case name == "headers" && field.Type == headersType:
+			if err := applyHeadersEnv(fv, key, vars); err != nil {
+				return err
+			}
+		case field.Tag.Get("env") == "":
+			value, ok := vars[key]
+			if !ok {
+				continue
+			}
+			if err := setEnvValue(fv, value); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyListEnv sets a list of sections from key, holding the whole list as
+// JSON, and from key_<INDEX>_<FIELD> variables, which override single
+// fields and add items
+func applyListEnv(list reflect.Value, key string, vars map[string]string) error {
+	if value, ok := vars[key]; ok {
+		if err := json.Unmarshal([]byte(value), list.Addr().Interface()); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	indexes := make(map[int]bool)
+	for k := range vars {
+		rest, ok := strings.CutPrefix(k, key+"_")
+		if !ok {
+			continue
+		}
+		digits, _, ok := strings.Cut(rest, "_")
+		index, err := strconv.Atoi(digits)
+		if !ok || err != nil || index < 0 {
+			continue
+		}
+		if index > maxEnvListIndex {
+			return fmt.Errorf("%s: index %d above %d", k, index, maxEnvListIndex)
+		}
+		indexes[index] = true
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	sorted := make([]int, 0, len(indexes))
+	for index := range indexes {
+		sorted = append(sorted, index)
+	}
+	sort.Ints(sorted)
+	if n := sorted[len(sorted)-1] + 1; n > list.Len() {
+		grown := reflect.MakeSlice(list.Type(), n, n)
+		reflect.Copy(grown, list)
+		list.Set(grown)
+	}
+	for _, index := range sorted {
+		if err := applyPathEnv(list.Index(index), key+"_"+strconv.Itoa(index), vars); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyHeadersEnv sets HTTP headers from key, holding them all as JSON, and
+// from key_<NAME> variables, which set one header each. Underscores in NAME
+// stand for dashes: key_X_TEAM sets X-Team.
+func applyHeadersEnv(headers reflect.Value, key string, vars map[string]string) error {
+	if value, ok := vars[key]; ok {
+		if err := setEnvValue(headers, value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	for k, value := range vars {
+		name, ok := strings.CutPrefix(k, key+"_")
+		if !ok || name == "" {
+			continue
+		}
+		if headers.IsNil() {
+			headers.Set(reflect.MakeMap(headersType))
+		}
+		name = http.CanonicalHeaderKey(strings.ReplaceAll(name, "_", "-"))
+		headers.SetMapIndex(reflect.ValueOf(name), reflect.ValueOf(value))
+	}
+	return nil
+}
+
+// setEnvValue parses value into v. Lists of strings take JSON or comma
+// separated values; maps and other lists take JSON.
+func setEnvValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		ptr := reflect.New(v.Type().Elem())
+		if err := setEnvValue(ptr.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(ptr)
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			list, err := parseEnvList(value)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(list).Convert(v.Type()))
+			return nil
+		}
+		return json.Unmarshal([]byte(value), v.Addr().Interface())
+	default:
+		return json.Unmarshal([]byte(value), v.Addr().Interface())
+	}
+	return nil
+}
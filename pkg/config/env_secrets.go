@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSecretsDir is where Docker mounts secrets. Kubernetes secret
+// volumes can be pointed to with PICOCLAW_SECRETS_DIR.
+const DefaultSecretsDir = "/run/secrets"
+
+// secretsDirEnv overrides DefaultSecretsDir
+const secretsDirEnv = "PICOCLAW_SECRETS_DIR"
+
+// secretEnvSuffixes mark the variables that hold secrets
+var secretEnvSuffixes = []string{"_TOKEN", "_SECRET", "_KEY", "_PASSWORD"}
+
+// isSecretEnv reports whether the variable name holds a secret
+func isSecretEnv(name string) bool {
+	for _, suffix := range secretEnvSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSecretFiles sets secret variables that are not in vars from files:
+// NAME_FILE names the file holding NAME, as with Docker and Kubernetes
+// secrets; otherwise a file called NAME (or name) in the secrets directory
+// is used if it exists. Trailing newlines are dropped.
+func loadSecretFiles(vars map[string]string) error {
+	for key, path := range vars {
+		name, ok := strings.CutSuffix(key, "_FILE")
+		if !ok || !strings.HasPrefix(name, envPrefix+"_") || !isSecretEnv(name) {
+			continue
+		}
+		if _, set := vars[name]; set {
+			return fmt.Errorf("both %s and %s are set", name, key)
+		}
+		value, err := readSecretFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		vars[name] = value
+	}
+
+	dir, ok := vars[secretsDirEnv]
+	if !ok {
+		dir = DefaultSecretsDir
+	}
+	if dir == "" {
+		return nil
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil
+	}
+	for _, opt := range Schema() {
+		// List items are only read from NAME_FILE
+		if !opt.Secret || strings.Contains(opt.Env, "<N>") {
+			continue
+		}
+		if _, set := vars[opt.Env]; set {
+			continue
+		}
+		for _, file := range []string{opt.Env, strings.ToLower(opt.Env)} {
+			value, err := readSecretFile(filepath.Join(dir, file))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", opt.Env, err)
+			}
+			vars[opt.Env] = value
+			break
+		}
+	}
+	return nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
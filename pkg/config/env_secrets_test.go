@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tokenFile := write("telegram-token", "123:abc\n")
+	keyFile := write("openai-key", "sk-file")
+	write("picoclaw_channels_line_channel_secret", "line-secret\n")
+	write("PICOCLAW_CHANNELS_ONEBOT_ACCESS_TOKEN", "onebot-token")
+	write("PICOCLAW_SECRET_KEY", "ignored, set directly")
+
+	cfg := &Config{}
+	err := parseEnv(cfg, []string{
+		"PICOCLAW_SECRETS_DIR=" + dir,
+		"PICOCLAW_CHANNELS_TELEGRAM_TOKEN_FILE=" + tokenFile,
+		"PICOCLAW_AI_PROVIDERS_0_API_KEY_FILE=" + keyFile,
+		"PICOCLAW_SECRET_KEY=from-env",
+	})
+	if err != nil {
+		t.Fatalf("parseEnv: %v", err)
+	}
+
+	checks := map[string][2]string{
+		"telegram token":     {cfg.Channels.Telegram.Token, "123:abc"},
+		"list item key":      {firstProviderKey(cfg), "sk-file"},
+		"lowercase file":     {cfg.Channels.LINE.ChannelSecret, "line-secret"},
+		"uppercase file":     {cfg.Channels.OneBot.AccessToken, "onebot-token"},
+		"env before secrets": {cfg.SecretKey, "from-env"},
+	}
+	for name, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%s = %q, want %q", name, c[0], c[1])
+		}
+	}
+}
+
+func firstProviderKey(cfg *Config) string {
+	if len(cfg.AI.Providers) == 0 {
+		return ""
+	}
+	return cfg.AI.Providers[0].APIKey
+}
+
+func TestParseEnvSecretFileErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		environ []string
+		want    string
+	}{
+		{"missing file", []string{"PICOCLAW_CHANNELS_TELEGRAM_TOKEN_FILE=/nonexistent/token"}, "PICOCLAW_CHANNELS_TELEGRAM_TOKEN_FILE"},
+		{"both set", []string{"PICOCLAW_CHANNELS_TELEGRAM_TOKEN=x", "PICOCLAW_CHANNELS_TELEGRAM_TOKEN_FILE=" + file}, "both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseEnv(&Config{}, append(tt.environ, "PICOCLAW_SECRETS_DIR="))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to mention %s", err, tt.want)
+			}
+		})
+	}
+
+	// Only secrets are read from files
+	cfg := &Config{}
+	if err := parseEnv(cfg, []string{"PICOCLAW_LOG_LEVEL_FILE=" + file, "PICOCLAW_SECRETS_DIR="}); err != nil || cfg.LogLevel != "" {
+		t.Errorf("log level = %q, err = %v; _FILE should be ignored", cfg.LogLevel, err)
+	}
+}
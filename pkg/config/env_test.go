@@ -0,0 +1,152 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  FlexibleStringSlice
+	}{
+		{"123, 456 ,alice", FlexibleStringSlice{"123", "456", "alice"}},
+		{`["123", 456]`, FlexibleStringSlice{"123", "456"}},
+		{"", FlexibleStringSlice{}},
+	}
+	for _, tt := range tests {
+		got, err := parseEnvList(tt.value)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseEnvList(%q) = %q, %v; want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	cfg := &Config{}
+	cfg.AI.Providers = []ProviderConfig{{Name: "openai", APIKey: "from-file", Model: "gpt-4o"}}
+
+	err := parseEnv(cfg, []string{
+		"PICOCLAW_ADMINS=telegram:1, telegram:2",
+		"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM=[\"123\", 456]",
+		"PICOCLAW_AI_PROVIDERS_0_API_KEY=sk-env",
+		"PICOCLAW_AI_PROVIDERS_1_NAME=local",
+		"PICOCLAW_AI_PROVIDERS_1_TEMPERATURE=0.2",
+		"PICOCLAW_AI_PROVIDERS_1_HEADERS={\"X-Team\": \"ops\"}",
+		"PICOCLAW_CHANNELS_WHATSAPP_INSTANCES_0_ACCOUNT_ID=sales",
+		"PICOCLAW_QUIET_HOURS_RULES_0_POLICY=drop",
+		"PICOCLAW_CHANNELS_ACCESS={\"telegram\": {\"deny_from\": [\"99\"]}}",
+		"UNRELATED=1",
+	})
+	if err != nil {
+		t.Fatalf("parseEnv: %v", err)
+	}
+
+	if want := (FlexibleStringSlice{"telegram:1", "telegram:2"}); !reflect.DeepEqual(cfg.Admins, want) {
+		t.Errorf("admins = %q, want %q", cfg.Admins, want)
+	}
+	if want := (FlexibleStringSlice{"123", "456"}); !reflect.DeepEqual(cfg.Channels.Telegram.AllowFrom, want) {
+		t.Errorf("telegram allow_from = %q, want %q", cfg.Channels.Telegram.AllowFrom, want)
+	}
+
+	providers := cfg.AI.Providers
+	if len(providers) != 2 {
+		t.Fatalf("got %d providers, want 2", len(providers))
+	}
+	if p := providers[0]; p.Name != "openai" || p.APIKey != "sk-env" || p.Model != "gpt-4o" {
+		t.Errorf("provider 0 = %+v, want the file entry with the env API key", p)
+	}
+	if p := providers[1]; p.Name != "local" || p.Temperature != 0.2 || p.Headers["X-Team"] != "ops" {
+		t.Errorf("provider 1 = %+v", p)
+	}
+
+	if inst := cfg.Channels.WhatsApp.Instances; len(inst) != 1 || inst[0].AccountID != "sales" {
+		t.Errorf("whatsapp instances = %+v", inst)
+	}
+	if rules := cfg.QuietHours.Rules; len(rules) != 1 || rules[0].Policy != "drop" {
+		t.Errorf("quiet hours rules = %+v", rules)
+	}
+	if deny := cfg.Channels.Access["telegram"].DenyFrom; len(deny) != 1 || deny[0] != "99" {
+		t.Errorf("telegram access = %+v", cfg.Channels.Access["telegram"])
+	}
+}
+
+func TestParseEnvHeaders(t *testing.T) {
+	cfg := &Config{}
+	cfg.AI.Providers = []ProviderConfig{{Name: "openai", Headers: map[string]string{"X-Team": "file"}}}
+
+	err := parseEnv(cfg, []string{
+		"PICOCLAW_AI_PROVIDERS_0_HEADERS_X_TEAM=ops",
+		"PICOCLAW_AI_PROVIDERS_0_HEADERS_OPENAI_ORGANIZATION=org-1",
+		"PICOCLAW_AI_PROVIDERS_1_NAME=local",
+		"PICOCLAW_AI_PROVIDERS_1_HEADERS={\"Authorization\": \"Bearer t\"}",
+		"PICOCLAW_AI_PROVIDERS_1_HEADERS_X_DEBUG=1",
+	})
+	if err != nil {
+		t.Fatalf("parseEnv: %v", err)
+	}
+	want := []map[string]string{
+		{"X-Team": "ops", "Openai-Organization": "org-1"},
+		{"Authorization": "Bearer t", "X-Debug": "1"},
+	}
+	for i, headers := range want {
+		if got := cfg.AI.Providers[i].Headers; !reflect.DeepEqual(got, headers) {
+			t.Errorf("provider %d headers = %v, want %v", i, got, headers)
+		}
+	}
+}
+
+// Every channel's allow_from takes a comma-separated list
+func TestParseEnvAllowFrom(t *testing.T) {
+	var environ, paths []string
+	for _, opt := range Schema() {
+		if strings.HasSuffix(opt.Path, ".allow_from") && opt.Env != "" && !strings.Contains(opt.Env, "<") {
+			environ = append(environ, opt.Env+"=alice, 42")
+			paths = append(paths, opt.Path)
+		}
+	}
+	if len(paths) < 10 {
+		t.Fatalf("found %d allow_from options", len(paths))
+	}
+
+	cfg := &Config{}
+	if err := parseEnv(cfg, environ); err != nil {
+		t.Fatalf("parseEnv: %v", err)
+	}
+	data, _ := json.Marshal(cfg)
+	var doc map[string]interface{}
+	json.Unmarshal(data, &doc)
+	for _, path := range paths {
+		var v interface{} = doc
+		for _, key := range strings.Split(path, ".") {
+			v = v.(map[string]interface{})[key]
+		}
+		if !reflect.DeepEqual(v, []interface{}{"alice", "42"}) {
+			t.Errorf("%s = %v", path, v)
+		}
+	}
+}
+
+func TestParseEnvErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		kv   string
+	}{
+		{"bad list JSON", "PICOCLAW_AI_PROVIDERS=[{"},
+		{"bad item value", "PICOCLAW_AI_PROVIDERS_0_MAX_TOKENS=lots"},
+		{"index too large", "PICOCLAW_AI_PROVIDERS_5000_NAME=x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseEnv(&Config{}, []string{tt.kv})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if name, _, _ := strings.Cut(tt.kv, "="); !strings.Contains(err.Error(), name) {
+				t.Errorf("error %q should name %s", err, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeConfig parses data into cfg in the format given by the extension of
+// path: .yaml or .yml for YAML, .toml for TOML, anything else for JSON.
+// YAML and TOML are converted to JSON first, so the json tags and the
+// UnmarshalJSON methods of the config types apply to every format.
+func decodeConfig(path string, data []byte, cfg *Config) error {
+	if configFormat(path) == "JSON" {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("failed to parse config JSON: %w", err)
+		}
+		return nil
+	}
+
+	doc, err := decodeDocument(path, data)
+	if err != nil || doc == nil {
+		// nil is an empty document
+		return err
+	}
+	converted, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to convert config: %w", err)
+	}
+	if err := json.Unmarshal(converted, cfg); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	return nil
+}
+
+// configFormat names the format of the config file at path
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "YAML"
+	case ".toml":
+		return "TOML"
+	}
+	return "JSON"
+}
+
+// decodeDocument parses a config file into maps, slices and scalars, as
+// JSON would decode it
+func decodeDocument(path string, data []byte) (interface{}, error) {
+	var doc interface{}
+	var err error
+	format := configFormat(path)
+	switch format {
+	case "YAML":
+		err = yaml.Unmarshal(data, &doc)
+	case "TOML":
+		doc, err = parseTOML(string(data))
+	default:
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", format, err)
+	}
+	return jsonValue(doc), nil
+}
+
+// jsonValue turns the maps YAML decodes with non-string keys into maps JSON
+// can encode
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const formatJSON = `{
+  "log_level": "debug",
+  "channels": {"telegram": {"enabled": true, "token": "123:abc", "allow_from": ["123", 456]}},
+  "ai": {"providers": [
+    {"name": "openai", "api_key": "sk-test", "temperature": 0.2},
+    {"name": "local", "endpoint": "http://localhost:11434", "headers": {"X-Team": "ops"}}
+  ]},
+  "session": {"backend": "redis", "url": "redis://localhost", "ttl_hours": 48}
+}`
+
+const formatYAML = `
+log_level: debug
+channels:
+  telegram:
+    enabled: true
+    token: "123:abc"
+    allow_from: ["123", 456]
+ai:
+  providers:
+    - name: openai
+      api_key: sk-test # comments are the point
+      temperature: 0.2
+    - name: local
+      endpoint: http://localhost:11434
+      headers:
+        X-Team: ops
+session:
+  backend: redis
+  url: redis://localhost
+  ttl_hours: 48
+`
+
+const formatTOML = `
+log_level = "debug"
+
+[channels.telegram]
+enabled = true
+token = "123:abc"
+allow_from = ["123", 456]
+
+# Providers are tried in order
+[[ai.providers]]
+name = "openai"
+api_key = "sk-test"
+temperature = 0.2
+
+[[ai.providers]]
+name = "local"
+endpoint = "http://localhost:11434"
+headers = { X-Team = "ops" }
+
+[session]
+backend = "redis"
+url = "redis://localhost"
+ttl_hours = 48
+`
+
+func TestDecodeConfigFormats(t *testing.T) {
+	want := &Config{}
+	if err := decodeConfig("config.json", []byte(formatJSON), want); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, _ := json.Marshal(want)
+
+	for _, tt := range []struct{ path, data string }{
+		{"config.yaml", formatYAML},
+		{"config.YML", formatYAML},
+		{"config.toml", formatTOML},
+	} {
+		got := &Config{}
+		if err := decodeConfig(tt.path, []byte(tt.data), got); err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if gotJSON, _ := json.Marshal(got); string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s decoded differently from JSON:\n%s\nwant\n%s", tt.path, gotJSON, wantJSON)
+		}
+	}
+
+	if want.Channels.Telegram.AllowFrom[1] != "456" || want.Session.TTLHours != 48 {
+		t.Errorf("decoded %+v", want)
+	}
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	for _, tt := range []struct{ path, data string }{
+		{"config.json", `{"log_level": `},
+		{"config.yaml", "log_level: [unclosed"},
+		{"config.toml", "log_level = "},
+		{"config.toml", "gateway = { port = \"not a number\" }"},
+	} {
+		if err := decodeConfig(tt.path, []byte(tt.data), &Config{}); err == nil {
+			t.Errorf("%s %q: no error", tt.path, tt.data)
+		}
+	}
+
+	// Empty YAML and TOML documents leave the defaults
+	for _, path := range []string{"config.yaml", "config.toml"} {
+		cfg := &Config{}
+		if err := decodeConfig(path, []byte("# nothing yet\n"), cfg); err != nil || !reflect.DeepEqual(cfg.Channels, ChannelsConfig{}) {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
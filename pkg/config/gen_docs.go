@@ -0,0 +1,108 @@
+//go:build ignore
+
+// gen_docs extracts the doc comments of the config structs into
+// schema_docs.go, so Schema can describe options at runtime.
+//
+//	go generate ./pkg/config
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+const output = "schema_docs.go"
+
+func main() {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		name := fi.Name()
+		return !strings.HasSuffix(name, "_test.go") && name != output && name != "gen_docs.go" && name != "schema.go"
+	}, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	typeDocs := make(map[string]string)
+	fieldDocs := make(map[string]string)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					st, ok := ts.Type.(*ast.StructType)
+					if !ok || !ts.Name.IsExported() {
+						continue
+					}
+					doc := ts.Doc
+					if doc == nil && len(gen.Specs) == 1 {
+						doc = gen.Doc
+					}
+					if text := clean(doc); text != "" {
+						typeDocs[ts.Name.Name] = text
+					}
+					for _, field := range st.Fields.List {
+						text := clean(field.Doc)
+						if text == "" {
+							text = clean(field.Comment)
+						}
+						for _, name := range field.Names {
+							if text != "" && name.IsExported() {
+								fieldDocs[ts.Name.Name+"."+name.Name] = text
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gen_docs.go; DO NOT EDIT.\n\npackage config\n\n")
+	b.WriteString("// typeDocs holds the doc comments of the config structs\n")
+	writeMap(&b, "typeDocs", typeDocs)
+	b.WriteString("\n// fieldDocs holds the doc comments of config fields, keyed by \"Type.Field\"\n")
+	writeMap(&b, "fieldDocs", fieldDocs)
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(output, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// clean joins a comment into one line
+func clean(group *ast.CommentGroup) string {
+	if group == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
+
+func writeMap(b *bytes.Buffer, name string, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(b, "var %s = map[string]string{\n", name)
+	for _, k := range keys {
+		fmt.Fprintf(b, "\t%q: %q,\n", k, m[k])
+	}
+	b.WriteString("}\n")
+}
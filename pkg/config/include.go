@@ -0,0 +1,222 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Keys of a config file that compose the config from several files, and
+// are not part of Config:
+//
+//	include   a path or list of paths of config files to merge under this
+//	          one, relative to it; globs match in name order
+//	profiles  named overlays, merged over the config when selected with
+//	          --profile or PICOCLAW_PROFILE; a profile may include files too
+const (
+	includeKey  = "include"
+	profilesKey = "profiles"
+)
+
+// profileEnv selects a profile when LoadOptions.Profile is empty
+const profileEnv = envPrefix + "_PROFILE"
+
+// composer reads a config file with the files it includes
+type composer struct {
+	// migrate upgrades each file to CurrentConfigVersion
+	migrate bool
+	notes   []string
+	// Files being read, to catch include cycles
+	reading map[string]bool
+}
+
+// composeFile reads the config file at path merged over the files it
+// includes. The profiles of all files are merged and kept under
+// profilesKey.
+func (c *composer) composeFile(path string) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.reading == nil {
+		c.reading = make(map[string]bool)
+	}
+	if c.reading[abs] {
+		return nil, fmt.Errorf("%s is included in a loop", path)
+	}
+	c.reading[abs] = true
+	defer delete(c.reading, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	doc, err := decodeDocument(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	root, ok := doc.(map[string]interface{})
+	if !ok && doc != nil {
+		return nil, fmt.Errorf("%s: config must be an object", path)
+	}
+	if root == nil {
+		root = map[string]interface{}{}
+	}
+
+	if c.migrate {
+		notes, err := migrateDocument(root)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(c.reading) > 1 {
+			// Notes on included files say which
+			for i, note := range notes {
+				notes[i] = filepath.Base(path) + ": " + note
+			}
+		}
+		c.notes = append(c.notes, notes...)
+	}
+	return c.compose(path, root)
+}
+
+// compose merges doc, read from path, over the files it includes
+func (c *composer) compose(path string, doc map[string]interface{}) (map[string]interface{}, error) {
+	includes, err := includePaths(path, doc[includeKey])
+	if err != nil {
+		return nil, err
+	}
+	delete(doc, includeKey)
+
+	merged := map[string]interface{}{}
+	for _, include := range includes {
+		included, err := c.composeFile(include)
+		if err != nil {
+			return nil, err
+		}
+		mergeDocument(merged, included)
+	}
+	mergeDocument(merged, doc)
+	return merged, nil
+}
+
+// applyProfile merges the profile called name over doc, and drops the
+// profiles from it. path is the file the profiles' includes are relative to.
+func (c *composer) applyProfile(path string, doc map[string]interface{}, name string) (map[string]interface{}, error) {
+	profiles, _ := doc[profilesKey].(map[string]interface{})
+	delete(doc, profilesKey)
+	if name == "" {
+		return doc, nil
+	}
+
+	profile, ok := profiles[name].(map[string]interface{})
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown profile %q: the config has no profiles", name)
+		}
+		return nil, fmt.Errorf("unknown profile %q, have %s", name, strings.Join(names, ", "))
+	}
+	profile, err := c.compose(path, profile)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	mergeDocument(doc, profile)
+	return doc, nil
+}
+
+// includePaths returns the files an include value names, relative to the
+// directory of path
+func includePaths(path string, include interface{}) ([]string, error) {
+	var patterns []string
+	switch v := include.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		patterns = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: include must list paths, got %v", path, item)
+			}
+			patterns = append(patterns, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s: include must be a path or a list of paths, got %v", path, v)
+	}
+
+	var paths []string
+	for _, pattern := range patterns {
+		pattern = expandPath(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+		// Globs may match nothing, e.g. an empty conf.d
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include %q: %w", path, pattern, err)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// mergeDocument merges src into dst. Objects merge key by key and lists of
+// named objects, such as ai.providers, merge item by item by name; any
+// other value of src replaces that of dst.
+func mergeDocument(dst, src map[string]interface{}) {
+	for key, value := range src {
+		dst[key] = mergeValue(dst[key], value)
+	}
+}
+
+func mergeValue(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			return src
+		}
+		mergeDocument(d, s)
+		return d
+	case []interface{}:
+		d, ok := dst.([]interface{})
+		if !ok || !namedItems(d) || !namedItems(s) {
+			return src
+		}
+		for _, item := range s {
+			name := item.(map[string]interface{})["name"].(string)
+			if i := providerIndex(d, name); i >= 0 {
+				mergeDocument(d[i].(map[string]interface{}), item.(map[string]interface{}))
+			} else {
+				d = append(d, item)
+			}
+		}
+		return d
+	}
+	return src
+}
+
+// namedItems reports whether a list holds objects with a name
+func namedItems(list []interface{}) bool {
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if name, _ := m["name"].(string); name == "" {
+			return false
+		}
+	}
+	return len(list) > 0
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadIncludesAndProfiles(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `include: [secrets.json, "channels.d/*.toml"]
+debug: true
+ai:
+  default_provider: openai
+  providers:
+    - name: openai
+      model: gpt-4o
+profiles:
+  dev:
+    debug: false
+    ai:
+      providers:
+        - name: openai
+          model: gpt-4o-mini
+  prod:
+    include: prod-secrets.json
+`,
+		"secrets.json":          `{"ai": {"providers": [{"name": "openai", "api_key": "sk-dev"}, {"name": "groq", "api_key": "gsk"}]}}`,
+		"prod-secrets.json":     `{"ai": {"providers": [{"name": "openai", "api_key": "sk-prod"}]}}`,
+		"channels.d/10-tg.toml": "[channels.telegram]\nenabled = true\ntoken = \"1:a\"\n",
+		"channels.d/20-tg.toml": "[channels.telegram]\ntoken = \"2:b\"\n",
+	})
+	path := filepath.Join(dir, "config.yaml")
+
+	tests := []struct {
+		profile string
+		debug   bool
+		model   string
+		apiKey  string
+	}{
+		{"", true, "gpt-4o", "sk-dev"},
+		{"dev", false, "gpt-4o-mini", "sk-dev"},
+		{"prod", true, "gpt-4o", "sk-prod"},
+	}
+	for _, tt := range tests {
+		cfg, err := LoadWithOptions(path, LoadOptions{Profile: tt.profile})
+		if err != nil {
+			t.Fatalf("profile %q: %v", tt.profile, err)
+		}
+		if cfg.Debug != tt.debug || len(cfg.AI.Providers) != 2 {
+			t.Errorf("profile %q: debug = %v, providers = %+v", tt.profile, cfg.Debug, cfg.AI.Providers)
+			continue
+		}
+		openai := cfg.AI.Providers[0]
+		if openai.Name != "openai" || openai.Model != tt.model || openai.APIKey != tt.apiKey {
+			t.Errorf("profile %q: openai = %+v", tt.profile, openai)
+		}
+		// Later files win, in name order
+		if tg := cfg.Channels.Telegram; !tg.Enabled || tg.Token != "2:b" {
+			t.Errorf("profile %q: telegram = %+v", tt.profile, tg)
+		}
+	}
+
+	t.Setenv(profileEnv, "dev")
+	if cfg, err := Load(path); err != nil || cfg.AI.Providers[0].Model != "gpt-4o-mini" {
+		t.Errorf("%s=dev: %v", profileEnv, err)
+	}
+
+	if _, err := LoadWithOptions(path, LoadOptions{Profile: "staging"}); err == nil || !strings.Contains(err.Error(), "have dev, prod") {
+		t.Errorf("unknown profile error = %v", err)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"loop.json":    `{"include": "other.json"}`,
+		"other.json":   `{"include": ["loop.json"]}`,
+		"missing.json": `{"include": "nope.json"}`,
+		"bad.json":     `{"include": 42}`,
+		"empty.json":   `{"include": "conf.d/*.json", "debug": true}`,
+	})
+
+	for name, want := range map[string]string{
+		"loop.json":    "included in a loop",
+		"missing.json": "nope.json",
+		"bad.json":     "include must be a path or a list of paths",
+	} {
+		if _, err := Load(filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error = %v, want %q", name, err, want)
+		}
+	}
+
+	// A glob may match nothing
+	if cfg, err := Load(filepath.Join(dir, "empty.json")); err != nil || !cfg.Debug {
+		t.Errorf("empty glob: %v", err)
+	}
+}
+
+func TestMergeDocument(t *testing.T) {
+	var dst, src map[string]interface{}
+	json.Unmarshal([]byte(`{
+  "a": {"b": 1, "c": [1, 2]},
+  "named": [{"name": "x", "v": 1}, {"name": "y", "v": 2}],
+  "plain": [{"v": 1}]
+}`), &dst)
+	json.Unmarshal([]byte(`{
+  "a": {"c": [3], "d": true},
+  "named": [{"name": "y", "w": 3}, {"name": "z"}],
+  "plain": [{"v": 2}]
+}`), &src)
+	mergeDocument(dst, src)
+
+	var want map[string]interface{}
+	json.Unmarshal([]byte(`{
+  "a": {"b": 1, "c": [3], "d": true},
+  "named": [{"name": "x", "v": 1}, {"name": "y", "v": 2, "w": 3}, {"name": "z"}],
+  "plain": [{"v": 2}]
+}`), &want)
+	if !reflect.DeepEqual(dst, want) {
+		got, _ := json.Marshal(dst)
+		t.Errorf("merged = %s", got)
+	}
+}
+
+func TestLintIncludesAndProfiles(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.json":  `{"include": "secrets.json", "profiles": {"dev": {"include": "x.json", "debgu": true}}}`,
+		"secrets.json": `{"channels": {"telegram": {"tokn": "1:a"}}}`,
+	})
+	issues, err := Lint(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, issue := range issues {
+		paths = append(paths, issue.Path)
+	}
+	if want := []string{"channels.telegram.tokn", "profiles.dev.debgu"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("issues = %v, want %v", issues, want)
+	}
+}
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Issue is a key of a config file that Load ignores
+type Issue struct {
+	Path    string `json:"path"` // JSON path, e.g. "channels.telegram.tokn"
+	Message string `json:"message"`
+	// Key to use instead of a deprecated one
+	Replacement string `json:"replacement,omitempty"`
+}
+
+func (i Issue) String() string {
+	return i.Path + ": " + i.Message
+}
+
+// deprecatedKeys maps the keys of the original PicoClaw config layout to
+// their replacements; * matches any name
+var deprecatedKeys = map[string]string{
+	"agents.defaults.provider":    "ai.default_provider",
+	"agents.defaults.model":       "ai.providers[].model",
+	"agents.defaults.max_tokens":  "ai.providers[].max_tokens",
+	"agents.defaults.temperature": "ai.providers[].temperature",
+	"providers.*.api_key":         "ai.providers[].api_key",
+	"providers.*.api_base":        "ai.providers[].endpoint",
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Lint reports the keys of the config file at configPath that Load would
+// ignore: unknown keys, often typos, and deprecated keys with their
+// replacements. A missing file has none.
+func Lint(configPath string) ([]Issue, error) {
+	configPath = expandPath(configPath)
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	c := &composer{}
+	doc, err := c.composeFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each profile is checked on its own
+	var issues []Issue
+	profiles, _ := doc[profilesKey].(map[string]interface{})
+	delete(doc, profilesKey)
+	lintValue(doc, reflect.TypeOf(Config{}), "", &issues)
+	for name, profile := range profiles {
+		if m, ok := profile.(map[string]interface{}); ok {
+			delete(m, includeKey)
+		}
+		lintValue(profile, reflect.TypeOf(Config{}), joinKey(profilesKey, name), &issues)
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return issues, nil
+}
+
+// lintValue checks the keys of doc against the type it is decoded into.
+// Values of the wrong type are left to Load to report.
+func lintValue(doc interface{}, t reflect.Type, path string, issues *[]Issue) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		// Decoded its own way
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for key, value := range m {
+			child := joinKey(path, key)
+			if field, ok := lookupField(fields, key); ok {
+				lintValue(value, field, child, issues)
+				continue
+			}
+			lintUnknown(value, child, closestKey(key, fields), issues)
+		}
+	case reflect.Map:
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, value := range m {
+			lintValue(value, t.Elem(), joinKey(path, key), issues)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := doc.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			lintValue(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), issues)
+		}
+	}
+}
+
+// lintUnknown reports a key the config does not have. suggestion is the
+// known key it is closest to, if any.
+func lintUnknown(value interface{}, path, suggestion string, issues *[]Issue) {
+	if replacement, ok := deprecatedKey(path); ok {
+		*issues = append(*issues, Issue{
+			Path:        path,
+			Message:     "deprecated, use " + replacement,
+			Replacement: replacement,
+		})
+		return
+	}
+	if m, ok := value.(map[string]interface{}); ok && hasDeprecatedKeys(path) {
+		for key, item := range m {
+			lintUnknown(item, joinKey(path, key), "", issues)
+		}
+		return
+	}
+
+	msg := "unknown key"
+	if suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %q?", suggestion)
+	}
+	*issues = append(*issues, Issue{Path: path, Message: msg})
+}
+
+// deprecatedKey returns the replacement of the key at path, if deprecated
+func deprecatedKey(path string) (string, bool) {
+	segments := strings.Split(path, ".")
+	for pattern, replacement := range deprecatedKeys {
+		parts := strings.Split(pattern, ".")
+		if len(parts) == len(segments) && matchKey(parts, segments) {
+			return replacement, true
+		}
+	}
+	return "", false
+}
+
+// hasDeprecatedKeys reports whether deprecated keys start with path
+func hasDeprecatedKeys(path string) bool {
+	segments := strings.Split(path, ".")
+	for pattern := range deprecatedKeys {
+		parts := strings.Split(pattern, ".")
+		if len(parts) > len(segments) && matchKey(parts[:len(segments)], segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchKey(pattern, segments []string) bool {
+	for i, part := range pattern {
+		if part != "*" && part != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonFields returns the types of the fields of struct t by JSON name,
+// including the fields of embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded, ft := range jsonFields(field.Type) {
+				fields[embedded] = ft
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// lookupField finds a field as encoding/json does, preferring an exact
+// match over a case-insensitive one
+func lookupField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// closestKey returns the field name within two edits of key, if any
+func closestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if d := editDistance(key, name); d < bestDistance || d == bestDistance && name < best {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// maskedSecret replaces secrets in Masked
+const maskedSecret = "********"
+
+// Masked returns the config as JSON values with its secrets masked, for
+// showing the effective config: values of keys named like secrets (token,
+// api_key, password, ...), header values, and the passwords of URLs
+func (c *Config) Masked() (map[string]interface{}, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	maskSecrets(doc, false)
+	return doc, nil
+}
+
+// EffectiveJSON returns the config as indented JSON with its secrets
+// masked, for debugging what was loaded
+func (c *Config) EffectiveJSON() ([]byte, error) {
+	masked, err := c.Masked()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(masked, "", "  ")
+}
+
+// maskSecrets masks the secrets in v, all of its strings when secret
+func maskSecrets(v interface{}, secret bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = maskSecrets(item, secret || isSecretKey(key))
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = maskSecrets(item, secret)
+		}
+		return v
+	case string:
+		if v == "" {
+			return v
+		}
+		if secret {
+			return maskedSecret
+		}
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return u.Redacted()
+			}
+		}
+	}
+	return v
+}
+
+// isSecretKey reports whether the values under a JSON key are secrets
+func isSecretKey(key string) bool {
+	name := "_" + strings.ToUpper(key)
+	return key == "headers" || isSecretEnv(name) || isSecretEnv(strings.TrimSuffix(name, "S"))
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// CurrentConfigVersion is the config_version of the Config layout. Version
+// 1 is the original PicoClaw layout, with a providers object keyed by
+// provider name and the model settings under agents.defaults.
+const CurrentConfigVersion = 2
+
+// configMigrations[i] upgrades a config document from version i+1
+var configMigrations = []func(root map[string]interface{}) []string{
+	migrateConfigV1,
+}
+
+// MigrateFile upgrades the config file at path to CurrentConfigVersion. It
+// returns the upgraded file, in JSON or YAML like the file, and notes on
+// what changed; no notes means the file is current. TOML files cannot be
+// written back and are returned as JSON.
+func MigrateFile(path string) ([]byte, []string, error) {
+	data, err := os.ReadFile(expandPath(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	doc, err := decodeDocument(path, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	notes, err := migrateDocument(doc)
+	if err != nil || len(notes) == 0 {
+		return data, nil, err
+	}
+
+	if data, err = encodeDocument(path, doc); err != nil {
+		return nil, nil, err
+	}
+	return data, notes, nil
+}
+
+// migrateDocument upgrades a decoded config file in place and returns
+// notes on what it changed
+func migrateDocument(doc interface{}) ([]string, error) {
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		// Not an object; decoding reports it
+		return nil, nil
+	}
+	version, err := documentVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	if version == CurrentConfigVersion {
+		return nil, nil
+	}
+
+	notes := []string{fmt.Sprintf("upgraded from config_version %d to %d", version, CurrentConfigVersion)}
+	for ; version < CurrentConfigVersion; version++ {
+		notes = append(notes, configMigrations[version-1](root)...)
+	}
+	root["config_version"] = CurrentConfigVersion
+	return notes, nil
+}
+
+// documentVersion returns the config_version of a config document. Files
+// from before config_version are told apart by their keys.
+func documentVersion(root map[string]interface{}) (int, error) {
+	var version float64
+	switch v := root["config_version"].(type) {
+	case nil:
+		if _, ok := root["providers"].(map[string]interface{}); ok {
+			return 1, nil
+		}
+		for _, key := range movedAgentDefaults {
+			if _, ok := agentDefaults(root)[key]; ok {
+				return 1, nil
+			}
+		}
+		return CurrentConfigVersion, nil
+	case float64:
+		version = v
+	case int:
+		version = float64(v)
+	case int64:
+		version = float64(v)
+	default:
+		return 0, fmt.Errorf("config_version must be a number, got %v", v)
+	}
+	if version < 1 || version != math.Trunc(version) {
+		return 0, fmt.Errorf("invalid config_version %v", version)
+	}
+	if version > CurrentConfigVersion {
+		return 0, fmt.Errorf("config_version %v is newer than this picoclaw supports (%d)", version, CurrentConfigVersion)
+	}
+	return int(version), nil
+}
+
+// movedAgentDefaults are the agents.defaults keys that version 2 keeps on
+// the default provider
+var movedAgentDefaults = []string{"provider", "model", "max_tokens", "temperature"}
+
+func agentDefaults(root map[string]interface{}) map[string]interface{} {
+	agents, _ := root["agents"].(map[string]interface{})
+	defaults, _ := agents["defaults"].(map[string]interface{})
+	return defaults
+}
+
+// migrateConfigV1 moves the providers object into the ai.providers list,
+// and the model settings of agents.defaults onto the default provider
+func migrateConfigV1(root map[string]interface{}) []string {
+	var notes []string
+	ai, ok := root["ai"].(map[string]interface{})
+	if !ok {
+		ai = map[string]interface{}{}
+	}
+	providers, _ := ai["providers"].([]interface{})
+
+	if old, ok := root["providers"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(old))
+		for name := range old {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			settings, _ := old[name].(map[string]interface{})
+			entry := map[string]interface{}{"name": name}
+			if key, _ := settings["api_key"].(string); key != "" {
+				entry["api_key"] = key
+			}
+			if base, _ := settings["api_base"].(string); base != "" {
+				entry["endpoint"] = base
+			}
+			for _, key := range []string{"proxy", "auth_method"} {
+				if value, _ := settings[key].(string); value != "" {
+					notes = append(notes, fmt.Sprintf("dropped providers.%s.%s, which has no equivalent", name, key))
+				}
+			}
+			switch {
+			case len(entry) == 1:
+				// Never set up
+			case providerIndex(providers, name) >= 0:
+				notes = append(notes, fmt.Sprintf("dropped providers.%s, ai.providers already has %q", name, name))
+			default:
+				providers = append(providers, entry)
+				notes = append(notes, fmt.Sprintf("moved providers.%s to ai.providers[%d]", name, len(providers)-1))
+			}
+		}
+		delete(root, "providers")
+	}
+
+	if defaults := agentDefaults(root); defaults != nil {
+		if provider, _ := defaults["provider"].(string); provider != "" {
+			if _, set := ai["default_provider"]; !set {
+				ai["default_provider"] = provider
+			}
+			delete(defaults, "provider")
+			notes = append(notes, "moved agents.defaults.provider to ai.default_provider")
+		}
+
+		// The settings go to the default provider, or the first one
+		defaultProvider, _ := ai["default_provider"].(string)
+		target := providerIndex(providers, defaultProvider)
+		if target < 0 && len(providers) > 0 {
+			target = 0
+		}
+		for _, key := range movedAgentDefaults[1:] {
+			value, ok := defaults[key]
+			if !ok {
+				continue
+			}
+			if target < 0 {
+				notes = append(notes, fmt.Sprintf("kept agents.defaults.%s: there is no provider to move it to", key))
+				continue
+			}
+			entry, _ := providers[target].(map[string]interface{})
+			if _, set := entry[key]; !set && entry != nil {
+				entry[key] = value
+			}
+			delete(defaults, key)
+			notes = append(notes, fmt.Sprintf("moved agents.defaults.%s to ai.providers[%d].%s", key, target, key))
+		}
+
+		agents := root["agents"].(map[string]interface{})
+		if len(defaults) == 0 {
+			delete(agents, "defaults")
+		}
+		if len(agents) == 0 {
+			delete(root, "agents")
+		}
+	}
+
+	if len(providers) > 0 {
+		ai["providers"] = providers
+	}
+	if len(ai) > 0 {
+		root["ai"] = ai
+	}
+	return notes
+}
+
+// providerIndex returns the index of the provider called name in a
+// decoded ai.providers list, or -1
+func providerIndex(providers []interface{}, name string) int {
+	for i, p := range providers {
+		if entry, ok := p.(map[string]interface{}); ok && entry["name"] == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrateDocumentV1(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{
+  "agents": {"defaults": {"workspace": "~/ws", "provider": "openai", "model": "gpt-4o", "max_tokens": 4096}},
+  "providers": {
+    "anthropic": {"api_key": "sk-ant"},
+    "openai": {"api_key": "sk", "api_base": "https://api.openai.com/v1", "proxy": "http://proxy:8080"},
+    "groq": {"api_key": ""}
+  }
+}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	notes, err := migrateDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNotes := []string{
+		"upgraded from config_version 1 to 2",
+		"moved providers.anthropic to ai.providers[0]",
+		"dropped providers.openai.proxy, which has no equivalent",
+		"moved providers.openai to ai.providers[1]",
+		"moved agents.defaults.provider to ai.default_provider",
+		"moved agents.defaults.model to ai.providers[1].model",
+		"moved agents.defaults.max_tokens to ai.providers[1].max_tokens",
+	}
+	if !reflect.DeepEqual(notes, wantNotes) {
+		t.Errorf("notes =\n%q\nwant\n%q", notes, wantNotes)
+	}
+
+	got, _ := json.Marshal(doc)
+	want := `{"agents":{"defaults":{"workspace":"~/ws"}},"ai":{"default_provider":"openai","providers":[` +
+		`{"api_key":"sk-ant","name":"anthropic"},` +
+		`{"api_key":"sk","endpoint":"https://api.openai.com/v1","max_tokens":4096,"model":"gpt-4o","name":"openai"}]},` +
+		`"config_version":2}`
+	if string(got) != want {
+		t.Errorf("migrated =\n%s\nwant\n%s", got, want)
+	}
+
+	// Migrating again changes nothing
+	if notes, err := migrateDocument(doc); notes != nil || err != nil {
+		t.Errorf("second migration = %q, %v", notes, err)
+	}
+}
+
+func TestMigrateDocumentKeepsNewSettings(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{
+  "ai": {"providers": [{"name": "openai", "api_key": "new", "model": "gpt-4.1"}]},
+  "agents": {"defaults": {"model": "gpt-4o", "temperature": 0.2}},
+  "providers": {"openai": {"api_key": "old"}}
+}`), &doc)
+
+	notes, err := migrateDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(notes, "\n"), `dropped providers.openai, ai.providers already has "openai"`) {
+		t.Errorf("notes = %q", notes)
+	}
+	root := doc.(map[string]interface{})
+	provider := root["ai"].(map[string]interface{})["providers"].([]interface{})[0]
+	want := map[string]interface{}{"name": "openai", "api_key": "new", "model": "gpt-4.1", "temperature": 0.2}
+	if !reflect.DeepEqual(provider, want) {
+		t.Errorf("provider = %v, want %v", provider, want)
+	}
+	if _, ok := root["agents"]; ok {
+		t.Errorf("empty agents section kept: %v", root["agents"])
+	}
+
+	// With no provider the settings stay where they are
+	json.Unmarshal([]byte(`{"agents": {"defaults": {"model": "gpt-4o"}}}`), &doc)
+	notes, _ = migrateDocument(doc)
+	if len(notes) != 2 || !strings.HasPrefix(notes[1], "kept agents.defaults.model") {
+		t.Errorf("notes = %q", notes)
+	}
+	if model := agentDefaults(doc.(map[string]interface{}))["model"]; model != "gpt-4o" {
+		t.Errorf("model = %v", model)
+	}
+}
+
+func TestDocumentVersion(t *testing.T) {
+	tests := []struct {
+		doc     string
+		version int
+		err     string
+	}{
+		{`{}`, CurrentConfigVersion, ""},
+		{`{"ai": {"providers": []}}`, CurrentConfigVersion, ""},
+		{`{"providers": {}}`, 1, ""},
+		{`{"agents": {"defaults": {"model": "gpt-4o"}}}`, 1, ""},
+		{`{"config_version": 1}`, 1, ""},
+		{`{"config_version": 2, "providers": {}}`, 2, ""},
+		{`{"config_version": 3}`, 0, "newer than this picoclaw supports"},
+		{`{"config_version": 1.5}`, 0, "invalid config_version"},
+		{`{"config_version": "2"}`, 0, "must be a number"},
+	}
+	for _, tt := range tests {
+		var root map[string]interface{}
+		json.Unmarshal([]byte(tt.doc), &root)
+		version, err := documentVersion(root)
+		if tt.err == "" && (err != nil || version != tt.version) {
+			t.Errorf("%s: version = %d, %v; want %d", tt.doc, version, err, tt.version)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: error = %v, want %q", tt.doc, err, tt.err)
+		}
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	current := writeConfig(t, "config.json", `{"config_version": 2}`)
+	if data, notes, err := MigrateFile(current); err != nil || notes != nil || string(data) != `{"config_version": 2}` {
+		t.Errorf("MigrateFile(current) = %s, %q, %v", data, notes, err)
+	}
+
+	path := writeConfig(t, "config.json", `{"providers": {"openai": {"api_key": "sk"}}}`)
+	data, notes, err := MigrateFile(path)
+	if err != nil || len(notes) == 0 {
+		t.Fatalf("MigrateFile(json) = %q, %v", notes, err)
+	}
+	want := "{\n  \"ai\": {\n    \"providers\": [\n      {\n        \"api_key\": \"sk\",\n        \"name\": \"openai\"\n      }\n    ]\n  },\n  \"config_version\": 2\n}\n"
+	if string(data) != want {
+		t.Errorf("MigrateFile(json) =\n%s\nwant\n%s", data, want)
+	}
+
+	path = writeConfig(t, "config.yaml", "providers:\n  openai:\n    api_key: sk\n")
+	data, _, err = MigrateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil || doc["config_version"] != CurrentConfigVersion {
+		t.Errorf("MigrateFile(yaml) =\n%s (%v)", data, err)
+	}
+
+	if _, _, err := MigrateFile(writeConfig(t, "config.json", `{"config_version": 9}`)); err == nil {
+		t.Error("MigrateFile accepted a newer config_version")
+	}
+}
+
+func TestLoadMigratesOldFile(t *testing.T) {
+	path := writeConfig(t, "config.json", `{
+  "agents": {"defaults": {"provider": "openai", "model": "gpt-4o"}},
+  "providers": {"openai": {"api_key": "sk"}}
+}`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.MigrationNotes()) == 0 || cfg.ConfigVersion != CurrentConfigVersion {
+		t.Errorf("notes = %q, version = %d", cfg.MigrationNotes(), cfg.ConfigVersion)
+	}
+	if cfg.AI.DefaultProvider != "openai" || len(cfg.AI.Providers) != 1 ||
+		cfg.AI.Providers[0].APIKey != "sk" || cfg.AI.Providers[0].Model != "gpt-4o" {
+		t.Errorf("ai = %+v", cfg.AI)
+	}
+
+	// The file itself is left alone
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "config_version") {
+		t.Errorf("Load rewrote the file: %s", data)
+	}
+
+	cfg, err = Load(writeConfig(t, "config.json", `{"config_version": 2}`))
+	if err != nil || cfg.MigrationNotes() != nil {
+		t.Errorf("Load(current) notes = %q, %v", cfg.MigrationNotes(), err)
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+//go:generate go run gen_docs.go
+
+// Option describes one configuration option, for setup tools and UIs that
+// need to stay in sync with the config structs.
+type Option struct {
+	// Dotted JSON path, e.g. "channels.whatsapp.bridge_url". List items
+	// are marked "[]" and map entries "<key>".
+	Path        string      `json:"path"`
+	Env         string      `json:"env,omitempty"` // Environment variable overriding it
+	Type        string      `json:"type"`          // string, boolean, integer, number, array, map or object
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Secret      bool        `json:"secret,omitempty"` // Also read from Env+"_FILE" and the secrets directory
+}
+
+var flexibleStringSliceType = reflect.TypeOf(FlexibleStringSlice{})
+
+// Schema returns every configuration option in declaration order. Defaults
+// are the values applied when the option is unset; options documented as
+// "0 selects the default" describe theirs in the description.
+func Schema() []Option {
+	defaults := &Config{}
+	defaults.applyDefaults()
+
+	var options []Option
+	walkOptions(reflect.ValueOf(defaults).Elem(), "", &options)
+	return options
+}
+
+// walkOptions appends the options of the struct v, whose path starts with
+// prefix. v may be the zero Value for structs inside lists and maps.
+func walkOptions(v reflect.Value, prefix string, options *[]Option) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		opt := Option{
+			Path:        prefix + name,
+			Env:         field.Tag.Get("env"),
+			Type:        optionType(field.Type),
+			Description: fieldDocs[t.Name()+"."+field.Name],
+		}
+		if opt.Env == "" {
+			opt.Env = envName(opt.Path)
+		}
+		opt.Secret = field.Type.Kind() == reflect.String && isSecretEnv(opt.Env)
+
+		fv := v.Field(i)
+		elem := field.Type
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		switch {
+		case elem.Kind() == reflect.Struct:
+			// Sections are set through their fields
+			opt.Env = ""
+			if opt.Description == "" {
+				opt.Description = typeDocs[elem.Name()]
+			}
+			*options = append(*options, opt)
+			section := fv
+			if !section.IsValid() || field.Type.Kind() != reflect.Struct {
+				// Optional sections have no defaults of their own
+				section = reflect.New(elem).Elem()
+			}
+			walkOptions(section, opt.Path+".", options)
+			continue
+		case (elem.Kind() == reflect.Slice || elem.Kind() == reflect.Map) && elem.Elem().Kind() == reflect.Struct:
+			if opt.Description == "" {
+				opt.Description = typeDocs[elem.Elem().Name()]
+			}
+			*options = append(*options, opt)
+			itemPrefix := opt.Path + "[]."
+			if elem.Kind() == reflect.Map {
+				itemPrefix = opt.Path + ".<key>."
+			}
+			walkOptions(reflect.New(elem.Elem()).Elem(), itemPrefix, options)
+			continue
+		}
+
+		if fv.IsValid() && !fv.IsZero() {
+			opt.Default = fv.Interface()
+		}
+		*options = append(*options, opt)
+	}
+}
+
+// envName returns the environment variable parseEnv reads for an untagged
+// option, or "" for map entries, which are only set with their whole map
+func envName(path string) string {
+	if strings.Contains(path, "<key>") {
+		return ""
+	}
+	name := strings.ReplaceAll(strings.ReplaceAll(path, "[]", "_<N>"), ".", "_")
+	return envPrefix + "_" + strings.ToUpper(name)
+}
+
+// optionType names the JSON type of t
+func optionType(t reflect.Type) string {
+	if t == flexibleStringSliceType {
+		return "array"
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map:
+		return "map"
+	default:
+		return "object"
+	}
+}
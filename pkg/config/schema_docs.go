@@ -0,0 +1,316 @@
+// Code generated by gen_docs.go; DO NOT EDIT.
+
+package config
+
+// typeDocs holds the doc comments of the config structs
+var typeDocs = map[string]string{
+	"AIConfig":                "AIConfig represents AI provider configuration",
+	"AlertWebhookConfig":      "AlertWebhookConfig represents the PagerDuty/Opsgenie alert ingestion channel configuration",
+	"BridgeRule":              "BridgeRule copies the inbound messages of a channel, optionally only those of some chats or senders, to a chat on another channel, e.g. every message of a WhatsApp group to a Telegram chat. Chats and senders are exact IDs, globs or \"re:<regexp>\", like access lists.",
+	"BroadcastConfig":         "BroadcastConfig limits how fast a broadcast is sent on each channel, below the platforms' bulk sending limits",
+	"BusConfig":               "BusConfig selects where and how many queued messages the message bus keeps. With persistence \"file\" every message stays in a journal until it is handled or sent, and whatever a crash interrupted is delivered again on the next start, so a message can be repeated but is not lost.",
+	"CalendarFeedConfig":      "CalendarFeedConfig represents the ICS calendar feed configuration",
+	"ChannelAccessConfig":     "ChannelAccessConfig restricts who can reach the agent on a channel. Entries are exact IDs, globs such as \"+49*\", or \"re:<regexp>\"; deny lists win over allow lists.",
+	"ChannelsConfig":          "ChannelsConfig represents all channel configurations",
+	"Config":                  "Config represents the main configuration structure",
+	"CostEstimateConfig":      "CostEstimateConfig represents the cost confirmation settings. A task is held for confirmation when its estimate exceeds either threshold.",
+	"CronBatchConfig":         "CronBatchConfig makes scheduled agent jobs due at the same time (such as digests for many chats) run as a throttled batch instead of all at once",
+	"DeliveryConfig":          "DeliveryConfig sets how outbound messages are retried. The delay doubles after every failed attempt; rate limits use the delay the platform asks for. Messages that fail every attempt go to the bus's dead-letter queue.",
+	"DiscordConfig":           "DiscordConfig represents Discord channel configuration",
+	"DiscordGuildConfig":      "DiscordGuildConfig restricts the bot within one Discord server",
+	"DispatchConfig":          "DispatchConfig sets how many agent turns run at once. Messages of different chats are handled in parallel by up to Workers turns; those of one chat always one after the other.",
+	"ExpiryMonitorConfig":     "ExpiryMonitorConfig watches the expiry of certificates and access tokens and alerts the owner chat before they lapse. The certificate of wss:// WhatsApp bridges, the Graph API access token and stored OAuth logins are watched automatically; status is served at /admin/expiry and answered to /admin expiry.",
+	"GatewayConfig":           "GatewayConfig configures the gateway HTTP server, which serves health checks, channel webhooks and the admin endpoints",
+	"GatewayTLSConfig":        "GatewayTLSConfig serves the gateway over HTTPS with certificate files or with certificates obtained from an ACME CA such as Let's Encrypt. ACME validates the domains with TLS-ALPN-01 on the gateway port, which must be reachable as port 443, or with HTTP-01 on HTTPPort, reachable as port 80.",
+	"GuestConfig":             "GuestConfig lets admins share the agent with /share, which creates a one-off link (Telegram deep links) admitting one person until it expires. Guests chat with a separate persona that has no tools and no access to the workspace memory, and their chats are never written to disk.",
+	"HedgingConfig":           "HedgingConfig represents hedged requests: when the primary provider has not answered after DelayMS, the same request is sent to Provider and the first complete response wins. This trades cost for responsiveness.",
+	"InboundDebounceConfig":   "InboundDebounceConfig holds a sender's messages to a chat until they have been quiet for the window, and hands them to the agent as one message, so \"hi\" \"can you\" \"check my order?\" get one answer. Commands are not held.",
+	"InboundDedupConfig":      "InboundDedupConfig sets how long inbound message IDs are remembered",
+	"Issue":                   "Issue is a key of a config file that Load ignores",
+	"IssueTrackerConfig":      "IssueTrackerConfig represents the Jira/Linear ticket tool configuration",
+	"KubernetesToolConfig":    "KubernetesToolConfig represents the read-only Kubernetes tool configuration",
+	"LINEConfig":              "LINEConfig represents LINE channel configuration",
+	"LoadOptions":             "LoadOptions change how LoadWithOptions reads the config",
+	"MQTTConfig":              "MQTTConfig connects to an MQTT broker for devices and home automation. Messages published to InboundTopic reach the agent and replies are published to OutboundTopic. A {device} segment in InboundTopic matches any device; its value becomes the chat ID and fills {device} in OutboundTopic, so each device gets replies on its own topic. The broker's ACLs decide who may publish; AllowFrom matches the device, or the \"sender\" of JSON payloads.",
+	"MatrixConfig":            "MatrixConfig connects to a Matrix homeserver as an existing account, logged in with its access token. Encrypted rooms need an end-to-end encryption proxy such as Pantalaimon as Homeserver; without one their messages cannot be read, and EncryptedRooms decides what happens to them.",
+	"MattermostConfig":        "MattermostConfig connects to a Mattermost server with a personal access token of a bot or user account. Posts arrive over the WebSocket API and replies and files are posted through the REST API.",
+	"MessageTTLConfig":        "MessageTTLConfig sets chats whose replies disappear",
+	"MessengerConfig":         "MessengerConfig connects a Facebook Page to Messenger. Facebook posts message events to WebhookPath on the gateway HTTP server, signed with the app secret, and replies go out through the Send API.",
+	"ModelCapabilityConfig":   "ModelCapabilityConfig overrides or adds a model capability entry. Unset fields keep the built-in value of the closest matching model.",
+	"ModelPricing":            "ModelPricing is the price per million tokens of a model",
+	"NotificationsConfig":     "NotificationsConfig holds templates for system notifications (alerts, reminders, errors, ...). Templates are keyed by notification type, then by channel name, with \"default\" applying to other channels. They are Go text/template strings executed with .Type, .Channel, .ChatID, .Time and .Content, the notification text in the channel's markup.",
+	"OneBotConfig":            "OneBotConfig represents OneBot channel configuration",
+	"PipelineConfig":          "PipelineConfig transforms the text of outgoing messages between the bus and the channels. Channels lists the stages each channel runs, in order, with \"default\" applying to channels not listed: \"profanity\" masks swear words, \"redact_secrets\" removes API keys and tokens, \"cap_length\" cuts long messages and \"template\" wraps the text.",
+	"PrivacyConfig":           "PrivacyConfig keeps chat content on the device. With LocalOnly the agent only uses ollama or vllm at a local address, web tools are off unless they go through a local WebProxy, voice messages are only transcribed by a local Whisper server, and any other request of the agent to a host outside the local network fails. Chat channels still reach their platforms.",
+	"ProgressConfig":          "ProgressConfig sends updates derived from tool calls during long agent tasks. \"milestones\" reports each tool the first time a task uses it, \"verbose\" every call and failure. Channels that can edit messages keep the updates of a task in one message, which becomes the final answer.",
+	"ProviderConfig":          "ProviderConfig represents a single AI provider configuration",
+	"ProviderDebugLogConfig":  "ProviderDebugLogConfig represents the encrypted provider payload log. Logging is available when Key is set and toggled with /admin debug-log. Admins are added to the top-level admins list.",
+	"ProviderHTTPConfig":      "ProviderHTTPConfig tunes the HTTP connections shared by the LLM providers",
+	"QuietHoursConfig":        "QuietHoursConfig silences the agent during time windows. Messages that arrive inside a window are queued until it ends, or dropped.",
+	"QuietHoursRule":          "QuietHoursRule is one do-not-disturb window. When is a cron expression and the window is every minute it matches, e.g. \"* 22-23,0-6 * * *\" for nights or \"* * * * 6,0\" for weekends.",
+	"RepoToolConfig":          "RepoToolConfig represents the GitHub/GitLab repository tool configuration",
+	"RepoWebhookConfig":       "RepoWebhookConfig represents the GitHub/GitLab webhook ingestion channel configuration",
+	"S3Config":                "S3Config points to a bucket on AWS S3 or a compatible store such as MinIO. Its environment variables follow the JSON path, e.g. PICOCLAW_TRANSCRIPT_ARCHIVE_S3_BUCKET.",
+	"ScheduledPrompt":         "ScheduledPrompt is one recurring prompt. Its answer goes to Channel and To.",
+	"ScheduledPromptsConfig":  "ScheduledPromptsConfig defines recurring agent prompts, such as morning digests. Prompts are Go text/template strings executed with .Name and .Now; {{context \"calendar\"}}, {{context \"feeds\"}} and {{context \"metrics\"}} pull in today's events, feed items published since the previous run and the board's metrics when the prompt runs.",
+	"SecretsToolConfig":       "SecretsToolConfig represents the password manager lookup tool configuration. Backend is \"pass\", \"bitwarden\" or \"vault\". TOTP also registers the 2FA code tool, which reads its seeds from the same backend.",
+	"Section":                 "Section declares, in one place, how a section of the config is completed and checked: a new channel or provider registers its defaults, validation rules and extra environment variables with RegisterSection.",
+	"SessionConfig":           "SessionConfig chooses where sessions, the conversation of each chat with its summary and settings, are kept. \"file\" (default) keeps a JSON file per session in the directory at Path, \"memory\" keeps them until restart, \"sqlite\" keeps them in the SQLite database at Path and \"redis\" on the server at URL.",
+	"SlackConfig":             "SlackConfig represents Slack channel configuration",
+	"TelegramConfig":          "TelegramConfig represents Telegram channel configuration",
+	"TerminalConfig":          "TerminalConfig chats with the agent from the console the gateway runs in, for trying prompts and tools locally. The user's messages come from \"terminal:local\" and anyone with the console may send them.",
+	"ToolPrefetchConfig":      "ToolPrefetchConfig represents speculative tool prefetching. When a rule matches the user message its tool call starts alongside the LLM request, and the result is used if the model asks for the same call.",
+	"ToolPrefetchRule":        "ToolPrefetchRule predicts a tool call from keywords in the user message. String arguments may contain {message}, replaced by the message text.",
+	"ToolsConfig":             "ToolsConfig represents optional agent tool configurations",
+	"TranscriptArchiveConfig": "TranscriptArchiveConfig mirrors every user message and agent reply to the configured destinations, in batches sent every FlushSeconds. Entries are redacted like the provider debug log unless DisableRedaction is set.",
+	"TranscriptChannelConfig": "TranscriptChannelConfig sends transcripts to a chat, such as a private Telegram channel the bot posts in",
+	"TranscriptEmailConfig":   "TranscriptEmailConfig mails transcripts over SMTP, one mail per conversation and batch. Longer flush intervals suit this destination.",
+	"TunnelConfig":            "TunnelConfig runs a tunnel client next to the gateway, so webhooks reach it from behind NAT. The tunnel's public URL replaces the host of Telegram's webhook_url, which may then be just a path or empty, and is registered again when it changes; the webhook URLs of other channels are logged to be set up with their platforms.",
+	"TunnelSSHConfig":         "TunnelSSHConfig forwards a port of an SSH server to the gateway. A web server or load balancer there serves the port as PublicURL.",
+	"UsageConfig":             "UsageConfig keeps a ledger of the tokens used by every model call in workspace/usage and exports each month's usage per provider, chat and model, priced with cost_estimate.pricing. The export of a month is written on the 1st of the next one, and sent to the owner chat and mailed when those are configured.",
+	"UsageEmailConfig":        "UsageEmailConfig mails the monthly export with the CSV attached",
+	"WebChatConfig":           "WebChatConfig serves a chat widget for websites from the gateway: the script at Path/widget.js, and the WebSocket it talks to the agent over at Path/ws. Visitors are identified by session tokens, which sites sign with Secret for their signed-in users; the channel issues anonymous ones when AllowAnonymous is set.",
+	"WebDAVConfig":            "WebDAVConfig points to a WebDAV folder, such as a Nextcloud directory. Its environment variables follow the JSON path, e.g. PICOCLAW_WORKSPACE_SYNC_WEBDAV_URL.",
+	"WhatsAppConfig":          "WhatsAppConfig represents WhatsApp channel configuration",
+	"WhatsAppInstanceConfig":  "WhatsAppInstanceConfig is one WhatsApp bridge account",
+	"WorkspaceSyncConfig":     "WorkspaceSyncConfig keeps the workspace in sync with an S3 bucket or a WebDAV folder, every IntervalSeconds and, with OnChange, shortly after local files change. Files changed on both sides since the last sync are resolved by Conflict; a deletion never wins over a change.",
+}
+
+// fieldDocs holds the doc comments of config fields, keyed by "Type.Field"
+var fieldDocs = map[string]string{
+	"BridgeRule.From":                            "Source channel",
+	"BridgeRule.FromChats":                       "Empty matches every chat",
+	"BridgeRule.FromSenders":                     "Empty matches every sender",
+	"BridgeRule.IncludeMedia":                    "Also send the files that came with the message",
+	"BridgeRule.Match":                           "Regexp the text must match; empty matches all",
+	"BridgeRule.Mode":                            "\"mirror\" (default) copies the message and still hands it to the agent; \"forward\" only copies it",
+	"BridgeRule.Template":                        "Go text/template executed with .Channel, .ChatID, .SenderID, .Sender (display name if known), .Content, .Metadata and .Time; default \"[{{.Channel}}] {{.Sender}}: {{.Content}}\"",
+	"BridgeRule.To":                              "Destination channel",
+	"BroadcastConfig.ChannelRates":               "Messages per second by channel name",
+	"BroadcastConfig.MessagesPerSecond":          "Per channel; 0 selects the default (1)",
+	"BusConfig.Broker":                           "External broker shared by several instances, so that e.g. webhook gateways in a few regions hand their messages to one worker running the agent. \"redis\" uses Redis Streams at BrokerURL (redis://[user:password@]host[:port][/db], rediss:// for TLS); empty keeps the bus in the process. It replaces the file persistence: the broker keeps the messages until they are handled.",
+	"BusConfig.BrokerConsumer":                   "Name of this instance among the consumers; it must stay the same across restarts to get back the messages it had not handled. Empty selects the host name.",
+	"BusConfig.BrokerPrefix":                     "Start of the stream names, to share a server between deployments; empty selects \"picoclaw\"",
+	"BusConfig.BrokerRole":                       "Messages this instance takes from the broker: \"all\" (default), \"gateway\" for replies only (it runs the channels) or \"worker\" for incoming messages only (it runs the agent)",
+	"BusConfig.HighWatermark":                    "Fill of the inbound queue (0-1) at which channels stop reading new messages, and at which they start again; 0 selects 0.8 and 0.5",
+	"BusConfig.Overflow":                         "What a full inbound queue does with new messages: \"block\" (default) waits, \"drop_oldest\" or \"drop_newest\" drop one, \"reject\" answers the sender that the agent is busy. Replies are never dropped.",
+	"BusConfig.Path":                             "Journal database; empty selects workspace/bus/journal.db",
+	"BusConfig.Persistence":                      "\"memory\" (default) or \"file\"",
+	"BusConfig.QueueSize":                        "Messages each queue holds; 0 selects the default (100)",
+	"BusConfig.Sync":                             "Flush every record to disk, surviving power loss at the cost of speed",
+	"ChannelAccessConfig.AllowChats":             "Empty allows every chat",
+	"ChannelsConfig.Access":                      "Deny lists and chat allowlists keyed by channel name, applied on top of each channel's allow_from",
+	"ChannelsConfig.Bridges":                     "Copies of inbound messages sent to chats on other channels",
+	"ChannelsConfig.Broadcast":                   "Pace of messages sent to many chats at once",
+	"ChannelsConfig.Delivery":                    "Retrying of replies that fail to send",
+	"ChannelsConfig.DrainTimeoutSeconds":         "How long shutdown waits for pending replies; 0 selects the default (30), -1 stops without draining",
+	"ChannelsConfig.InboundDebounce":             "Coalescing of rapid consecutive messages from a sender into one agent turn",
+	"ChannelsConfig.InboundDedup":                "Dropping of redelivered inbound messages, shared by all channels",
+	"ChannelsConfig.MessageTTL":                  "Deletion of the agent's replies after a delay, on channels that can delete messages",
+	"ChannelsConfig.WebhookCheckIntervalMinutes": "How often the webhook URLs registered with the platforms are checked and repaired; 0 selects the default (15), -1 registers them on start only",
+	"Config.AI":                                  "AI settings",
+	"Config.Admins":                              "Senders allowed to run in-chat admin commands such as /status and /pause, as \"sender_id\" or \"channel:sender_id\"",
+	"Config.Bus":                                 "Keeping queued messages across restarts",
+	"Config.CalendarFeed":                        "Read-only ICS feed of scheduled jobs, served by the gateway",
+	"Config.Channels":                            "Channel configurations",
+	"Config.ConfigVersion":                       "Layout of the config file; older files are upgraded when loaded",
+	"Config.CostEstimate":                        "Confirmation prompt before expensive agent tasks",
+	"Config.CronBatch":                           "Spreading of scheduled agent jobs that come due together",
+	"Config.Debug":                               "Global settings",
+	"Config.Dispatch":                            "Agent turns run at once, for chats handled in parallel",
+	"Config.EnableAuth":                          "Security settings",
+	"Config.ExpiryMonitor":                       "Alerts before certificates and access tokens expire",
+	"Config.Gateway":                             "HTTP server for health checks, webhooks and the admin endpoints",
+	"Config.Guest":                               "Time-limited guest access through disposable share links",
+	"Config.Hedging":                             "Race a second provider against slow responses",
+	"Config.Models":                              "Capabilities of models missing from, or differing from, the built-in registry",
+	"Config.Notifications":                       "Per-channel layouts of system notifications",
+	"Config.Pipeline":                            "Filters applied to the text of outgoing messages, per channel",
+	"Config.Privacy":                             "Local-only mode keeping inference on the device",
+	"Config.Progress":                            "Updates sent while the agent works through tool calls",
+	"Config.ProviderDebugLog":                    "Encrypted provider payload log for debugging prompt assembly",
+	"Config.ProviderHTTP":                        "Connection pooling for provider HTTP clients",
+	"Config.QuietHours":                          "Do-not-disturb windows per channel or contact",
+	"Config.Raw":                                 "Raw JSON for unknown fields",
+	"Config.ScheduledPrompts":                    "Recurring agent prompts defined here rather than by the cron tool",
+	"Config.Session":                             "Where conversation history, summaries and chat settings are kept",
+	"Config.ToolPrefetch":                        "Run predicted tool calls while the model is still answering",
+	"Config.Tools":                               "Tool configurations",
+	"Config.TranscriptArchive":                   "Copies of conversation transcripts sent to archive destinations",
+	"Config.Tunnel":                              "Tunnel giving the gateway a public URL from behind NAT",
+	"Config.Usage":                               "Token ledger and monthly usage exports",
+	"Config.WorkspaceSync":                       "Two-way sync of the workspace with cloud storage",
+	"CostEstimateConfig.Pricing":                 "model -> price",
+	"CronBatchConfig.MaxConcurrent":              "0 runs one job at a time",
+	"CronBatchConfig.MinIntervalMS":              "Minimum time between job starts",
+	"CronBatchConfig.SpreadSeconds":              "Window the job starts are spread over",
+	"DeliveryConfig.ChannelMaxAttempts":          "Attempts keyed by channel name, overriding max_attempts for flaky or rate-limited platforms",
+	"DeliveryConfig.MaxAttempts":                 "0 selects the default (3), 1 disables retries",
+	"DeliveryConfig.RetryDelaySeconds":           "0 selects the default (2)",
+	"DiscordConfig.Format":                       "markdown (default) or plain",
+	"DiscordConfig.Guilds":                       "Guilds limits the servers the bot answers in, keyed by guild ID. Empty answers in every server the bot is in.",
+	"DiscordConfig.ReplyInThreads":               "Answer server messages in a thread started on them, so every conversation has its own thread and session",
+	"DiscordConfig.SlashCommands":                "Register the /ask, /show and /list slash commands",
+	"DiscordGuildConfig.AllowFrom":               "Users also have to pass the channel's allow_from",
+	"DiscordGuildConfig.Channels":                "Channel IDs answered in; empty answers in all",
+	"DispatchConfig.Workers":                     "0 selects the default (4); 1 handles one message at a time",
+	"ExpiryMonitorConfig.CertFiles":              "PEM certificate files, e.g. those of a reverse proxy",
+	"ExpiryMonitorConfig.Channel":                "Owner chat receiving alerts; empty uses the last active chat",
+	"ExpiryMonitorConfig.CheckHours":             "0 selects the default (12)",
+	"ExpiryMonitorConfig.Endpoints":              "Extra TLS endpoints, as host:port or https:// URLs, e.g. the gateway's public address",
+	"ExpiryMonitorConfig.WarnDays":               "0 selects the default (14)",
+	"GatewayConfig.AdminToken":                   "Bearer token of the /admin and /debug endpoints; empty uses chat_token, and with neither they refuse every request",
+	"GatewayConfig.ChatToken":                    "Bearer token of POST /api/chat, which answers with the agent's reply; empty leaves the endpoint off",
+	"GatewayConfig.Host":                         "Default 0.0.0.0",
+	"GatewayConfig.Port":                         "Default 18790",
+	"GatewayConfig.PublicURL":                    "URL the platforms reach the gateway at, e.g. https://bot.example.org behind a reverse proxy; webhooks are registered under it. Empty uses the tunnel's URL or the first ACME domain.",
+	"GatewayConfig.ReadTimeoutSeconds":           "Listener limits; 0 selects the defaults (5, 5, 120 and 1 MiB)",
+	"GatewayConfig.TLS":                          "HTTPS, so webhooks can reach the gateway without a reverse proxy",
+	"GatewayTLSConfig.CacheDir":                  "Default ~/.picoclaw/acme",
+	"GatewayTLSConfig.CertFile":                  "PEM chain; reloaded when it changes",
+	"GatewayTLSConfig.DirectoryURL":              "Default Let's Encrypt production",
+	"GatewayTLSConfig.Domains":                   "Names certificates are requested for",
+	"GatewayTLSConfig.Email":                     "Contact for the CA's notices",
+	"GatewayTLSConfig.HSTSMaxAgeSeconds":         "Strict-Transport-Security max-age; 0 sends no header",
+	"GatewayTLSConfig.HTTPPort":                  "Plain HTTP listener answering HTTP-01 challenges and redirecting everything else to HTTPS; 0 disables it",
+	"GatewayTLSConfig.MinVersion":                "Oldest TLS version accepted, \"1.2\" (default) or \"1.3\"",
+	"GatewayTLSConfig.Mode":                      "\"off\" (default), \"files\" for CertFile and KeyFile, or \"acme\"",
+	"GuestConfig.LinkHours":                      "Default validity of links; 0 selects 24",
+	"GuestConfig.MaxHistory":                     "Messages kept per guest chat; 0 selects 20",
+	"GuestConfig.Persona":                        "System prompt for guests; empty uses a friendly default",
+	"HedgingConfig.DelayMS":                      "0 selects the default (2000)",
+	"HedgingConfig.Model":                        "Empty uses the primary model",
+	"InboundDebounceConfig.ChannelWindowMS":      "Windows by channel name, replacing window_ms; 0 disables debouncing on that channel",
+	"InboundDebounceConfig.MaxMessages":          "Messages coalesced at most; 0 selects 10",
+	"InboundDebounceConfig.MaxWaitMS":            "Longest a message is held; 0 selects 4 windows",
+	"InboundDebounceConfig.WindowMS":             "0 disables",
+	"InboundDedupConfig.MaxEntries":              "0 selects the default (10000)",
+	"InboundDedupConfig.WindowSeconds":           "0 selects the default (600), -1 disables",
+	"Issue.Path":                                 "JSON path, e.g. \"channels.telegram.tokn\"",
+	"Issue.Replacement":                          "Key to use instead of a deprecated one",
+	"KubernetesToolConfig.DescribeConfigMaps":    "Let describe list the keys of ConfigMaps, with their values redacted",
+	"LINEConfig.WebhookPath":                     "Default /webhook/line",
+	"LINEConfig.WebhookURL":                      "Public URL of the webhook server, registered with LINE on start and whenever it drifts; empty leaves it to the LINE Developers console",
+	"LoadOptions.Profile":                        "Profile names the profile of the config file to apply; the PICOCLAW_PROFILE environment variable when empty",
+	"LoadOptions.Strict":                         "Strict fails on the keys of the config file that Lint reports, instead of ignoring them",
+	"MQTTConfig.Broker":                          "tcp://host:1883, or ssl://host:8883 for TLS",
+	"MQTTConfig.ClientID":                        "Empty generates one",
+	"MQTTConfig.InboundTopic":                    "e.g. picoclaw/{device}/ask",
+	"MQTTConfig.KeepAliveSeconds":                "0 selects 60",
+	"MQTTConfig.OutboundTopic":                   "e.g. picoclaw/{device}/reply",
+	"MQTTConfig.PayloadFormat":                   "\"text\" (default) publishes replies as plain text, \"json\" as {\"text\": ..., \"device\": ...}. Inbound payloads may be either.",
+	"MQTTConfig.QoS":                             "0, 1 or 2, for the subscription and replies",
+	"MQTTConfig.TLSCAFile":                       "Empty uses the system roots",
+	"MQTTConfig.TLSCertFile":                     "Client certificate, with TLSKeyFile",
+	"MatrixConfig.AllowFrom":                     "User IDs, e.g. @alice:example.org",
+	"MatrixConfig.AllowRooms":                    "Rooms answered in, as room IDs or aliases; empty answers in all",
+	"MatrixConfig.AutoJoin":                      "Join rooms the bot is invited to by allowed users, if the room is allowed",
+	"MatrixConfig.EncryptedRooms":                "\"ignore\" (default) skips encrypted messages, \"notice\" also tells the room once that the bot cannot read them",
+	"MatrixConfig.Format":                        "html (default), markdown or plain",
+	"MatrixConfig.Homeserver":                    "e.g. https://matrix.example.org",
+	"MattermostConfig.AllowChannels":             "Channels answered in, as channel IDs or team/channel names; empty answers in all. Direct and group messages from allowed users are always answered.",
+	"MattermostConfig.AllowFrom":                 "User IDs or @usernames",
+	"MattermostConfig.Format":                    "markdown (default) or plain",
+	"MattermostConfig.ReplyInThreads":            "Answer channel messages in a thread started on them, so every conversation has its own thread and session",
+	"MattermostConfig.URL":                       "e.g. https://chat.example.org",
+	"MessageTTLConfig.Chats":                     "Minutes replies stay up, keyed by \"channel:chat_id\"",
+	"MessengerConfig.APIVersion":                 "Default v22.0",
+	"MessengerConfig.AllowFrom":                  "Page-scoped user IDs",
+	"MessengerConfig.AppID":                      "ID of the Meta app; with it the page webhook is subscribed under the gateway's public URL on start and whenever it drifts",
+	"MessengerConfig.Format":                     "whatsapp (default), markdown or plain",
+	"MessengerConfig.MessageTag":                 "Message tag for notifications, which may be sent after the 24 hour messaging window, e.g. ACCOUNT_UPDATE; empty sends them as updates",
+	"MessengerConfig.PersonaName":                "Replies are sent as this persona, with its own name and picture in the conversation; empty sends them as the page. The persona is created on start unless the page already has one by that name.",
+	"MessengerConfig.VerifyToken":                "Entered when subscribing the webhook",
+	"MessengerConfig.WebhookPath":                "Default /messenger/webhook",
+	"PipelineConfig.MaxLength":                   "Characters cap_length keeps; 0 selects 4000",
+	"PipelineConfig.ProfanityWords":              "Masked in addition to the built-in list",
+	"PipelineConfig.RedactPatterns":              "Regular expressions redacted in addition to the built-in secrets",
+	"PipelineConfig.Template":                    "Go text/template for the template stage, executed with .Content, .Channel and .ChatID",
+	"PrivacyConfig.AllowHosts":                   "Host names that count as local, e.g. an inference server on the LAN",
+	"PrivacyConfig.WebProxy":                     "Local HTTP proxy for web_search and web_fetch; empty turns them off",
+	"ProgressConfig.Channels":                    "Verbosity per channel, overriding the default",
+	"ProgressConfig.Verbosity":                   "\"silent\" (default), \"milestones\" or \"verbose\"",
+	"ProviderConfig.Headers":                     "Also set one by one from the environment, e.g. PICOCLAW_AI_PROVIDERS_0_HEADERS_X_TEAM for X-Team",
+	"ProviderHTTPConfig.IdleConnTimeoutSeconds":  "0 selects the default (300)",
+	"ProviderHTTPConfig.MaxConnsPerHost":         "0 means no limit",
+	"ProviderHTTPConfig.MaxIdleConnsPerHost":     "0 selects the default (16)",
+	"ProviderHTTPConfig.Prewarm":                 "Open the provider connections at startup instead of on the first message",
+	"QuietHoursConfig.Timezone":                  "IANA name; empty uses local time",
+	"QuietHoursRule.AwayMessage":                 "Sent once per chat and window",
+	"QuietHoursRule.Channel":                     "Empty matches every channel",
+	"QuietHoursRule.Contact":                     "Chat or sender ID; empty matches everyone",
+	"QuietHoursRule.Policy":                      "\"queue\" (default) or \"drop\"",
+	"S3Config.Endpoint":                          "Empty uses AWS; otherwise path-style URLs are used",
+	"S3Config.Prefix":                            "Prepended to object keys",
+	"S3Config.Region":                            "Empty selects us-east-1",
+	"ScheduledPrompt.Channel":                    "\"admins\" sends the reply to every admin listed as channel:sender_id",
+	"ScheduledPrompt.Cron":                       "Cron expression, e.g. \"0 8 * * 1-5\"",
+	"ScheduledPrompt.Name":                       "Unique; identifies the job across restarts",
+	"ScheduledPromptsConfig.Calendars":           "ICS URLs read by the calendar provider",
+	"ScheduledPromptsConfig.Feeds":               "RSS or Atom URLs read by the feeds provider",
+	"ScheduledPromptsConfig.MaxFeedItems":        "Per feed; 0 lists 10",
+	"ScheduledPromptsConfig.Timezone":            "IANA name for calendar dates; empty uses local time",
+	"SecretsToolConfig.Command":                  "pass or bw binary",
+	"Section.Defaults":                           "Defaults fills in the unset options of the section",
+	"Section.Env":                                "Env maps options of the section to environment variables they fall back to when neither the file nor their PICOCLAW_ variable sets them, e.g. \"github_token\": \"GITHUB_TOKEN\"",
+	"Section.Path":                               "JSON path of the section, e.g. \"channels.telegram\"; \"\" is the root",
+	"Section.Validate":                           "Validate checks the section once defaults are applied",
+	"SessionConfig.Path":                         "Relative to the workspace; empty selects sessions, or sessions.db for sqlite",
+	"SessionConfig.TTLHours":                     "Sessions idle for longer are forgotten; 0 keeps them",
+	"SessionConfig.URL":                          "redis://[user:password@]host[:port][/db], rediss:// for TLS",
+	"SlackConfig.AppToken":                       "Socket Mode only",
+	"SlackConfig.Format":                         "slack (default), markdown or plain",
+	"SlackConfig.Mode":                           "Mode is \"socket\" (default), which needs no public URL, or \"events\". In events mode Slack posts events, interactions and slash commands to WebhookPath on the gateway HTTP server, signed with SigningSecret.",
+	"SlackConfig.ReplyInThreads":                 "Answer channel messages in a thread started on them, as mentions are answered, so every conversation has its own thread and session",
+	"SlackConfig.WebhookPath":                    "Default /slack/events",
+	"TelegramConfig.Format":                      "telegram_html (default), markdown or plain",
+	"TelegramConfig.Mode":                        "Mode is \"polling\" (default) or \"webhook\". In webhook mode Telegram posts updates to WebhookURL, which must reach the gateway HTTP server on the URL's path.",
+	"TelegramConfig.WebhookSecret":               "Empty derives one from the token",
+	"TerminalConfig.Color":                       "auto (default), always or never",
+	"TerminalConfig.Format":                      "markdown (default) or plain",
+	"ToolPrefetchConfig.TimeoutSeconds":          "0 selects the default (30)",
+	"TranscriptArchiveConfig.FlushSeconds":       "0 selects the default (10)",
+	"TranscriptArchiveConfig.RedactPatterns":     "Extra regular expressions replaced by [REDACTED]",
+	"TranscriptChannelConfig.Channel":            "Empty disables this destination",
+	"TranscriptEmailConfig.SMTPHost":             "Empty disables this destination",
+	"TranscriptEmailConfig.SMTPPort":             "0 selects the default (587)",
+	"TunnelConfig.Command":                       "Client binary; empty looks up cloudflared, ngrok or ssh in PATH",
+	"TunnelConfig.Hostname":                      "cloudflare: public hostname the named tunnel routes to the gateway; ngrok: reserved domain, empty for a random one",
+	"TunnelConfig.Provider":                      "Empty (off), \"cloudflare\", \"ngrok\" or \"ssh\"",
+	"TunnelConfig.StartTimeoutSeconds":           "How long startup waits for the public URL; default 30",
+	"TunnelConfig.Token":                         "cloudflare: token of a named tunnel, empty for a quick tunnel on a random trycloudflare.com URL; ngrok: authtoken",
+	"TunnelSSHConfig.BindAddress":                "Empty binds the server's loopback, per its GatewayPorts",
+	"TunnelSSHConfig.IdentityFile":               "Empty uses the SSH agent and default keys",
+	"TunnelSSHConfig.Port":                       "Default 22",
+	"TunnelSSHConfig.PublicURL":                  "e.g. https://bot.example.org",
+	"TunnelSSHConfig.RemotePort":                 "Port on the server forwarded to the gateway",
+	"UsageConfig.Channel":                        "Owner chat receiving the export; empty disables",
+	"UsageEmailConfig.SMTPHost":                  "Empty disables mailing",
+	"UsageEmailConfig.SMTPPort":                  "0 selects the default (587)",
+	"WebChatConfig.AllowFrom":                    "User IDs of signed tokens",
+	"WebChatConfig.AllowedOrigins":               "Sites that may embed the widget, e.g. https://example.org; empty allows any",
+	"WebChatConfig.Format":                       "markdown (default), html or plain",
+	"WebChatConfig.Path":                         "Default /chat",
+	"WebChatConfig.Secret":                       "Empty uses a random key, so sessions end with a restart",
+	"WebChatConfig.SessionTTLHours":              "Lifetime of anonymous session tokens, renewed on every visit; default 720 (30 days)",
+	"WhatsAppConfig.Encryption":                  "Bridge payload encryption: \"off\" (default), \"prefer\" or \"require\". The key exchange rides on the hello, so it is only authenticated with HMAC keys, which \"require\" needs.",
+	"WhatsAppConfig.FBPhoneNumberID":             "Facebook WhatsApp Business API configuration",
+	"WhatsAppConfig.Format":                      "whatsapp (default), markdown or plain",
+	"WhatsAppConfig.HMACKeys":                    "Bridge message signing. Keys are \"id:secret\" entries; the first one signs.",
+	"WhatsAppConfig.HMACMissingKey":              "\"warn\" or \"fail\"",
+	"WhatsAppConfig.Instances":                   "Additional bridge accounts served by the same process. Each instance inherits every other setting from this section.",
+	"WhatsAppConfig.LegacySignatures":            "Sign outgoing messages over raw JSON for bridges without canonical signing support",
+	"WhatsAppConfig.PingIntervalSeconds":         "Bridge keepalive; zero values select the defaults (30s, 10s, 60s, 3)",
+	"WhatsAppConfig.ReconnectMaxAttempts":        "Bridge reconnection; max attempts -1 retries forever",
+	"WhatsAppConfig.ReplayWindowSeconds":         "Replay protection for bridge messages",
+	"WhatsAppConfig.SelfID":                      "Group chats",
+	"WhatsAppConfig.SendTypingIndicators":        "Emit a typing indicator when an inbound message is handed to the agent",
+	"WhatsAppInstanceConfig.AllowFrom":           "Empty inherits the section's allow_from",
+	"WorkspaceSyncConfig.Backend":                "\"s3\" or \"webdav\"",
+	"WorkspaceSyncConfig.Conflict":               "\"newer\" (default), \"local\", \"remote\" or \"keep_both\"",
+	"WorkspaceSyncConfig.Direction":              "\"both\" (default), \"upload\" or \"download\"",
+	"WorkspaceSyncConfig.DownloadKBps":           "0 means no limit",
+	"WorkspaceSyncConfig.Exclude":                "Glob patterns of workspace paths, e.g. \"sessions\" or \"*.tmp\"",
+	"WorkspaceSyncConfig.IntervalSeconds":        "0 selects the default (300)",
+	"WorkspaceSyncConfig.UploadKBps":             "0 means no limit",
+}
@@ -0,0 +1,74 @@
+package config
+
+import "testing"
+
+func TestSchema(t *testing.T) {
+	options := make(map[string]Option)
+	for _, opt := range Schema() {
+		if _, dup := options[opt.Path]; dup {
+			t.Errorf("duplicate option %s", opt.Path)
+		}
+		options[opt.Path] = opt
+	}
+
+	tests := []struct {
+		path    string
+		typ     string
+		env     string
+		def     interface{}
+		withDoc bool
+	}{
+		{"bind_address", "string", "", "0.0.0.0:8080", false},
+		{"ai", "object", "", nil, true},
+		{"ai.providers", "array", "", nil, true},
+		{"ai.providers[].name", "string", "", nil, false},
+		{"ai.providers[].api_key", "string", "PICOCLAW_AI_PROVIDERS_<N>_API_KEY", nil, false},
+		{"ai.models.<key>", "", "", nil, false},
+		{"channels.telegram.token", "string", "PICOCLAW_CHANNELS_TELEGRAM_TOKEN", nil, false},
+		{"channels.delivery.max_attempts", "integer", "PICOCLAW_CHANNELS_DELIVERY_MAX_ATTEMPTS", nil, true},
+		{"channels.whatsapp.fb_api_version", "string", "", "v22.0", false},
+		{"channels.whatsapp.instances[].account_id", "string", "", nil, false},
+		{"channels.access.<key>.deny_from", "array", "", nil, false},
+	}
+	for _, tt := range tests {
+		opt, ok := options[tt.path]
+		if !ok {
+			if tt.typ != "" {
+				t.Errorf("missing option %s", tt.path)
+			}
+			continue
+		}
+		if tt.typ == "" {
+			t.Errorf("map entries should only be listed through their fields, got %s", tt.path)
+			continue
+		}
+		if opt.Type != tt.typ || opt.Default != tt.def {
+			t.Errorf("%s: type %s, default %v; want %s, %v", tt.path, opt.Type, opt.Default, tt.typ, tt.def)
+		}
+		if tt.env != "" && opt.Env != tt.env {
+			t.Errorf("%s: env %q, want %q", tt.path, opt.Env, tt.env)
+		}
+		if tt.withDoc && opt.Description == "" {
+			t.Errorf("%s: missing description", tt.path)
+		}
+	}
+}
+
+func TestSchemaSecrets(t *testing.T) {
+	secrets := make(map[string]bool)
+	for _, opt := range Schema() {
+		secrets[opt.Path] = opt.Secret
+	}
+	for path, want := range map[string]bool{
+		"channels.telegram.token":          true,
+		"ai.providers[].api_key":           true,
+		"channels.line.channel_secret":     true,
+		"channels.telegram.webhook_url":    false,
+		"tools.prefetch.rules[].keywords":  false,
+		"channels.whatsapp.fb_api_version": false,
+	} {
+		if secrets[path] != want {
+			t.Errorf("%s: secret = %v, want %v", path, secrets[path], want)
+		}
+	}
+}
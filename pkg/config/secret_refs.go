@@ -0,0 +1,195 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretResolver returns the secret a reference points to, given the part
+// after "scheme:", e.g. "OPENAI_API_KEY" for "env:OPENAI_API_KEY"
+type SecretResolver func(ref string) (string, error)
+
+var (
+	secretResolversMu sync.RWMutex
+	secretResolvers   = map[string]SecretResolver{
+		"env":   resolveEnvRef,
+		"file":  resolveFileRef,
+		"vault": resolveVaultRef,
+		"enc":   resolveEncryptedRef,
+	}
+)
+
+// RegisterSecretResolver makes config values starting with scheme+":"
+// resolve through r, replacing the resolver of that scheme if any. The
+// built-in schemes are env, file, vault and enc, for values encrypted with
+// EncryptFile.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	secretResolversMu.Lock()
+	defer secretResolversMu.Unlock()
+	secretResolvers[scheme] = r
+}
+
+// secretResolver returns the resolver of the reference in value, if value
+// is one
+func secretResolver(value string) (SecretResolver, string, bool) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok || ref == "" {
+		return nil, "", false
+	}
+	secretResolversMu.RLock()
+	defer secretResolversMu.RUnlock()
+	r, ok := secretResolvers[scheme]
+	return r, ref, ok
+}
+
+// resolveSecretRefs replaces the string values of v that are references,
+// such as "env:OPENAI_API_KEY", "file:/run/secrets/token" or
+// "vault:secret/picoclaw#key", with the secrets they point to. Only secret
+// fields are resolved: those named like secrets (token, api_key, password,
+// headers, ...) or tagged secret:"true", and the strings in their lists and
+// maps; a prompt starting with "file:" is left alone. Encrypted values are
+// resolved anywhere, as they can only hold what was encrypted. path is the
+// JSON path of v, for errors.
+func resolveSecretRefs(v reflect.Value, path string, secret bool) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return resolveSecretRefs(v.Elem(), path, secret)
+	case reflect.String:
+		r, ref, ok := secretResolver(v.String())
+		if !ok || (!secret && !strings.HasPrefix(v.String(), encryptedScheme+":")) {
+			return nil
+		}
+		value, err := r(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(value)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			fieldSecret := secret || isSecretKey(name) || field.Tag.Get("secret") == "true"
+			if path != "" {
+				name = path + "." + name
+			}
+			if err := resolveSecretRefs(v.Field(i), name, fieldSecret); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveSecretRefs(v.Index(i), fmt.Sprintf("%s[%d]", path, i), secret); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// Map values cannot be set in place
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			if err := resolveSecretRefs(value, fmt.Sprintf("%s.%v", path, iter.Key()), secret); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), value)
+		}
+	}
+	return nil
+}
+
+// resolveEnvRef reads an environment variable
+func resolveEnvRef(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// resolveFileRef reads a file, without its trailing newlines
+func resolveFileRef(path string) (string, error) {
+	return readSecretFile(expandPath(path))
+}
+
+// vaultTimeout bounds reading a secret from Vault
+const vaultTimeout = 15 * time.Second
+
+// resolveVaultRef reads a field of a HashiCorp Vault KV v2 secret, written
+// mount/path#field, from the server at VAULT_ADDR with VAULT_TOKEN or the
+// token the vault CLI saved in ~/.vault-token
+func resolveVaultRef(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	mount, secretPath, hasPath := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || field == "" || !hasPath {
+		return "", fmt.Errorf("vault reference %q is not mount/path#field", ref)
+	}
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		home, _ := os.UserHomeDir()
+		saved, err := readSecretFile(filepath.Join(home, ".vault-token"))
+		if err != nil {
+			return "", fmt.Errorf("VAULT_TOKEN is not set")
+		}
+		token = saved
+	}
+
+	segments := strings.Split(secretPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s", addr, url.PathEscape(mount), strings.Join(segments, "/"))
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	client := &http.Client{Timeout: vaultTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d for %s", resp.StatusCode, path)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("failed to parse vault response: %w", err)
+	}
+	value, ok := secret.Data.Data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %q", path, field)
+	}
+	return value, nil
+}
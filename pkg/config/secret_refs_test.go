@@ -0,0 +1,105 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecretRefs(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" || r.URL.Path != "/v1/secret/data/picoclaw/slack" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"bot_token": "xoxb-vault"}, "metadata": {}}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "s.test")
+	t.Setenv("TEST_OPENAI_KEY", "sk-env")
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("123:file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{}
+	cfg.AI.Providers = []ProviderConfig{{
+		Name:    "openai",
+		APIKey:  "env:TEST_OPENAI_KEY",
+		Headers: map[string]string{"Authorization": "env:TEST_OPENAI_KEY", "X-Team": "ops"},
+	}}
+	cfg.Channels.Telegram.Token = "file:" + tokenFile
+	cfg.Channels.Slack.BotToken = "vault:secret/picoclaw/slack#bot_token"
+	cfg.Session.URL = "redis://localhost:6379"
+	cfg.Bus.BrokerURL = "env:TEST_OPENAI_KEY"
+	// Not secret fields, so left as written
+	cfg.Session.Path = "file:" + tokenFile
+	cfg.Channels.Telegram.AllowFrom = FlexibleStringSlice{"env:TEST_OPENAI_KEY"}
+
+	if err := resolveSecretRefs(reflect.ValueOf(cfg).Elem(), "", false); err != nil {
+		t.Fatal(err)
+	}
+	provider := cfg.AI.Providers[0]
+	if provider.APIKey != "sk-env" || provider.Headers["Authorization"] != "sk-env" || provider.Headers["X-Team"] != "ops" {
+		t.Errorf("provider = %+v", provider)
+	}
+	if cfg.Channels.Telegram.Token != "123:file" {
+		t.Errorf("telegram token = %q", cfg.Channels.Telegram.Token)
+	}
+	if cfg.Channels.Slack.BotToken != "xoxb-vault" {
+		t.Errorf("slack token = %q", cfg.Channels.Slack.BotToken)
+	}
+	if cfg.Session.URL != "redis://localhost:6379" {
+		t.Errorf("unknown scheme resolved: %q", cfg.Session.URL)
+	}
+	if cfg.Bus.BrokerURL != "sk-env" {
+		t.Errorf("broker url = %q", cfg.Bus.BrokerURL)
+	}
+	if cfg.Session.Path != "file:"+tokenFile || cfg.Channels.Telegram.AllowFrom[0] != "env:TEST_OPENAI_KEY" {
+		t.Errorf("resolved a reference outside secret fields: %q, %q", cfg.Session.Path, cfg.Channels.Telegram.AllowFrom)
+	}
+}
+
+func TestResolveSecretRefsErrors(t *testing.T) {
+	vault := httptest.NewServer(http.NotFoundHandler())
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "s.test")
+
+	tests := []struct{ value, err string }{
+		{"env:PICOCLAW_TEST_UNSET", "ai.providers[0].api_key: environment variable PICOCLAW_TEST_UNSET is not set"},
+		{"file:/nonexistent/token", "no such file"},
+		{"vault:secret/picoclaw", "not mount/path#field"},
+		{"vault:secret/picoclaw#key", "vault returned status 404"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{}
+		cfg.AI.Providers = []ProviderConfig{{Name: "openai", APIKey: tt.value}}
+		err := resolveSecretRefs(reflect.ValueOf(cfg).Elem(), "", false)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want %q", tt.value, err, tt.err)
+		}
+	}
+}
+
+func TestRegisterSecretResolver(t *testing.T) {
+	RegisterSecretResolver("test", func(ref string) (string, error) {
+		return strings.ToUpper(ref), nil
+	})
+	defer func() {
+		secretResolversMu.Lock()
+		delete(secretResolvers, "test")
+		secretResolversMu.Unlock()
+	}()
+
+	cfg := &Config{SecretKey: "test:abc"}
+	if err := resolveSecretRefs(reflect.ValueOf(cfg).Elem(), "", false); err != nil || cfg.SecretKey != "ABC" {
+		t.Errorf("secret_key = %q, %v", cfg.SecretKey, err)
+	}
+}
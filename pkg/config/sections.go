@@ -0,0 +1,678 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/privacy"
+)
+
+// Section declares, in one place, how a section of the config is completed
+// and checked: a new channel or provider registers its defaults,
+// validation rules and extra environment variables with RegisterSection.
+type Section struct {
+	// JSON path of the section, e.g. "channels.telegram"; "" is the root
+	Path string
+	// Defaults fills in the unset options of the section
+	Defaults func(c *Config)
+	// Validate checks the section once defaults are applied
+	Validate func(c *Config) error
+	// Env maps options of the section to environment variables they fall
+	// back to when neither the file nor their PICOCLAW_ variable sets them,
+	// e.g. "github_token": "GITHUB_TOKEN"
+	Env map[string]string
+}
+
+var (
+	sectionsMu sync.RWMutex
+	sections   = builtinSections()
+)
+
+// RegisterSection adds a section to the config, replacing the section of
+// the same path if any. Defaults and validation run in registration order,
+// after those of the built-in sections.
+func RegisterSection(s Section) {
+	sectionsMu.Lock()
+	defer sectionsMu.Unlock()
+	for i := range sections {
+		if sections[i].Path == s.Path {
+			sections[i] = s
+			return
+		}
+	}
+	sections = append(sections, s)
+}
+
+// registeredSections returns the sections whose path is prefix or under it
+func registeredSections(prefix string) []Section {
+	sectionsMu.RLock()
+	defer sectionsMu.RUnlock()
+	var matched []Section
+	for _, s := range sections {
+		if prefix == "" || s.Path == prefix || strings.HasPrefix(s.Path, prefix+".") {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// applyDefaults applies default values
+func (c *Config) applyDefaults() {
+	for _, s := range registeredSections("") {
+		if s.Defaults != nil {
+			s.Defaults(c)
+		}
+	}
+}
+
+// Validate validates the configuration
+func (c *Config) Validate() error {
+	return c.validateSections("")
+}
+
+// validateChannels checks that every enabled channel has what it needs to
+// connect
+func (c *Config) validateChannels() error {
+	return c.validateSections("channels")
+}
+
+func (c *Config) validateSections(prefix string) error {
+	for _, s := range registeredSections(prefix) {
+		if s.Validate == nil {
+			continue
+		}
+		if err := s.Validate(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySectionEnv sets the options still unset from the environment
+// variables the sections bind them to
+func applySectionEnv(cfg *Config, vars map[string]string) error {
+	root := reflect.ValueOf(cfg).Elem()
+	for _, s := range registeredSections("") {
+		for option, name := range s.Env {
+			value, ok := vars[name]
+			if !ok || value == "" {
+				continue
+			}
+			field, ok := lookupPath(root, joinKey(s.Path, option))
+			if !ok || !field.CanSet() {
+				return fmt.Errorf("%s: no option %s", name, joinKey(s.Path, option))
+			}
+			if !field.IsZero() {
+				continue
+			}
+			if err := setEnvValue(field, value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// lookupPath finds the value at a JSON path such as "channels.telegram.token"
+// or "ai.providers[0].model". Map entries are copies and cannot be set.
+func lookupPath(v reflect.Value, path string) (reflect.Value, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		key, index, hasIndex := strings.Cut(key, "[")
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := structField(v, key)
+			if !ok {
+				return reflect.Value{}, false
+			}
+			v = field
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false
+			}
+			v = v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return reflect.Value{}, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+
+		if hasIndex {
+			i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+			if err != nil || v.Kind() != reflect.Slice || i < 0 || i >= v.Len() {
+				return reflect.Value{}, false
+			}
+			v = v.Index(i)
+		}
+	}
+	return v, true
+}
+
+// structField returns the field of struct v with the JSON name key
+func structField(v reflect.Value, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.IsExported() && name == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// Get returns the value of the option at a JSON path, such as
+// "channels.telegram.token" or "ai.providers[0].model"
+func (c *Config) Get(path string) (interface{}, bool) {
+	v, ok := lookupPath(reflect.ValueOf(c).Elem(), path)
+	if !ok {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+// GetString returns the string option at path, or "" if it is not one
+func (c *Config) GetString(path string) string {
+	v, ok := lookupPath(reflect.ValueOf(c).Elem(), path)
+	if !ok || v.Kind() != reflect.String {
+		return ""
+	}
+	return v.String()
+}
+
+// GetBool returns the boolean option at path, or false if it is not one
+func (c *Config) GetBool(path string) bool {
+	v, ok := lookupPath(reflect.ValueOf(c).Elem(), path)
+	return ok && v.Kind() == reflect.Bool && v.Bool()
+}
+
+// GetInt returns the integer option at path, or 0 if it is not one
+func (c *Config) GetInt(path string) int {
+	v, ok := lookupPath(reflect.ValueOf(c).Elem(), path)
+	if !ok {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	}
+	return 0
+}
+
+// GetFloat returns the numeric option at path, or 0 if it is not one
+func (c *Config) GetFloat(path string) float64 {
+	v, ok := lookupPath(reflect.ValueOf(c).Elem(), path)
+	if !ok {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return 0
+}
+
+// builtinSections declares the sections of Config, in the order their
+// defaults and validation run
+func builtinSections() []Section {
+	return []Section{
+		{
+			Path: "",
+			Defaults: func(c *Config) {
+				if c.ConfigVersion == 0 {
+					c.ConfigVersion = CurrentConfigVersion
+				}
+				if c.BindAddress == "" {
+					c.BindAddress = "0.0.0.0:8080"
+				}
+				if c.LogLevel == "" {
+					c.LogLevel = "info"
+				}
+			},
+		},
+		{
+			Path: "ai",
+			Defaults: func(c *Config) {
+				if c.AI.DefaultProvider == "" {
+					c.AI.DefaultProvider = "openai"
+				}
+			},
+		},
+		{
+			Path: "tools.kubernetes",
+			Defaults: func(c *Config) {
+				if c.Tools.Kubernetes.KubectlPath == "" {
+					c.Tools.Kubernetes.KubectlPath = "kubectl"
+				}
+				if c.Tools.Kubernetes.TimeoutSeconds == 0 {
+					c.Tools.Kubernetes.TimeoutSeconds = 30
+				}
+			},
+		},
+		{
+			Path: "tools.repo",
+			Env:  map[string]string{"github_token": "GITHUB_TOKEN", "gitlab_token": "GITLAB_TOKEN"},
+		},
+		{
+			Path: "tools.issues",
+			Env:  map[string]string{"linear_api_key": "LINEAR_API_KEY"},
+		},
+		{
+			Path:     "gateway",
+			Defaults: gatewayDefaults,
+			Validate: validateGateway,
+		},
+		{
+			Path:     "privacy",
+			Validate: validatePrivacy,
+		},
+		{
+			Path:     "bus",
+			Validate: validateBus,
+		},
+		{
+			Path:     "session",
+			Validate: validateSession,
+		},
+		{
+			Path:     "pipeline",
+			Validate: validatePipeline,
+		},
+		{
+			Path:     "tunnel",
+			Defaults: tunnelDefaults,
+			Validate: validateTunnel,
+		},
+		{
+			Path: "channels.whatsapp",
+			Defaults: func(c *Config) {
+				if c.Channels.WhatsApp.FBAPIVersion == "" {
+					c.Channels.WhatsApp.FBAPIVersion = "v22.0"
+				}
+			},
+			Validate: validateWhatsApp,
+		},
+		{
+			Path:     "channels.telegram",
+			Validate: validateTelegram,
+		},
+		{
+			Path: "channels.discord",
+			Validate: func(c *Config) error {
+				if ch := c.Channels.Discord; ch.Enabled && ch.Token == "" {
+					return fmt.Errorf("discord: token must be provided")
+				}
+				return nil
+			},
+		},
+		{
+			Path:     "channels.slack",
+			Validate: validateSlack,
+		},
+		{
+			Path: "channels.line",
+			Defaults: func(c *Config) {
+				webhookDefaults(&c.Channels.LINE.WebhookHost, &c.Channels.LINE.WebhookPort, 18791)
+			},
+			Validate: func(c *Config) error {
+				if ch := c.Channels.LINE; ch.Enabled && (ch.ChannelSecret == "" || ch.ChannelAccessToken == "") {
+					return fmt.Errorf("line: channel_secret and channel_access_token must be provided")
+				}
+				return nil
+			},
+		},
+		{
+			Path: "channels.matrix",
+			Validate: func(c *Config) error {
+				if ch := c.Channels.Matrix; ch.Enabled && (ch.Homeserver == "" || ch.AccessToken == "") {
+					return fmt.Errorf("matrix: homeserver and access_token must be provided")
+				}
+				return nil
+			},
+		},
+		{
+			Path: "channels.mattermost",
+			Validate: func(c *Config) error {
+				if ch := c.Channels.Mattermost; ch.Enabled && (ch.URL == "" || ch.Token == "") {
+					return fmt.Errorf("mattermost: url and token must be provided")
+				}
+				return nil
+			},
+		},
+		{
+			Path: "channels.messenger",
+			Validate: func(c *Config) error {
+				if m := c.Channels.Messenger; m.Enabled && (m.PageAccessToken == "" || m.AppSecret == "" || m.VerifyToken == "") {
+					return fmt.Errorf("messenger: page_access_token, app_secret and verify_token must be provided")
+				}
+				return nil
+			},
+		},
+		{
+			Path:     "channels.mqtt",
+			Validate: validateMQTT,
+		},
+		{
+			Path: "channels.webchat",
+			Validate: func(c *Config) error {
+				if ch := c.Channels.WebChat; ch.Enabled && ch.Secret == "" && !ch.AllowAnonymous {
+					return fmt.Errorf("webchat: either secret or allow_anonymous must be set")
+				}
+				return nil
+			},
+		},
+		{
+			Path: "channels.repo_webhook",
+			Defaults: func(c *Config) {
+				webhookDefaults(&c.Channels.RepoWebhook.WebhookHost, &c.Channels.RepoWebhook.WebhookPort, 18792)
+			},
+			Validate: func(c *Config) error {
+				if ch := c.Channels.RepoWebhook; ch.Enabled && ch.GitHubSecret == "" && ch.GitLabToken == "" {
+					return fmt.Errorf("repo_webhook: github_secret or gitlab_token must be provided")
+				}
+				return nil
+			},
+		},
+		{
+			Path: "channels.alert_webhook",
+			Defaults: func(c *Config) {
+				webhookDefaults(&c.Channels.AlertWebhook.WebhookHost, &c.Channels.AlertWebhook.WebhookPort, 18793)
+			},
+			Validate: func(c *Config) error {
+				if a := c.Channels.AlertWebhook; a.Enabled && a.PagerDutySecret == "" && a.OpsgenieToken == "" {
+					return fmt.Errorf("alert_webhook: pagerduty_secret or opsgenie_token must be provided")
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// webhookDefaults defaults the address a webhook channel listens on
+func webhookDefaults(host *string, port *int, defaultPort int) {
+	if *host == "" {
+		*host = "0.0.0.0"
+	}
+	if *port == 0 {
+		*port = defaultPort
+	}
+}
+
+func gatewayDefaults(c *Config) {
+	if c.Gateway.Host == "" {
+		c.Gateway.Host = "0.0.0.0"
+	}
+	if c.Gateway.Port == 0 {
+		c.Gateway.Port = 18790
+	}
+	if c.Gateway.TLS.Mode == "acme" && c.Gateway.TLS.CacheDir == "" {
+		c.Gateway.TLS.CacheDir = "~/.picoclaw/acme"
+	}
+	c.Gateway.TLS.CacheDir = expandPath(c.Gateway.TLS.CacheDir)
+}
+
+func validateGateway(c *Config) error {
+	switch tls := c.Gateway.TLS; tls.Mode {
+	case "", "off":
+	case "files":
+		if tls.CertFile == "" || tls.KeyFile == "" {
+			return fmt.Errorf("gateway.tls: files mode needs cert_file and key_file")
+		}
+	case "acme":
+		if len(tls.Domains) == 0 {
+			return fmt.Errorf("gateway.tls: acme mode needs at least one domain")
+		}
+	default:
+		return fmt.Errorf("gateway.tls: unknown mode %q (want off, files or acme)", tls.Mode)
+	}
+	if u, err := url.Parse(c.Gateway.PublicURL); c.Gateway.PublicURL != "" && (err != nil || u.Scheme != "https" || u.Host == "") {
+		return fmt.Errorf("gateway.public_url: webhooks need an https URL, got %q", c.Gateway.PublicURL)
+	}
+	return nil
+}
+
+// validatePrivacy refuses destinations that would take chat content off the
+// device in local-only mode
+func validatePrivacy(c *Config) error {
+	p := c.Privacy
+	if !p.LocalOnly {
+		return nil
+	}
+	if p.WebProxy != "" && !privacy.IsLocalURL(p.WebProxy, p.AllowHosts) {
+		return fmt.Errorf("privacy.web_proxy: %q is not on the local network", p.WebProxy)
+	}
+	if archive := c.TranscriptArchive; archive.Enabled {
+		if archive.Email.SMTPHost != "" {
+			return fmt.Errorf("privacy.local_only: transcript_archive.email mails transcripts off the device")
+		}
+		if archive.S3.Bucket != "" && !privacy.IsLocalURL(archive.S3.Endpoint, p.AllowHosts) {
+			return fmt.Errorf("privacy.local_only: transcript_archive.s3 needs a local endpoint")
+		}
+	}
+	if repo := c.Tools.Repo; repo.Enabled {
+		if repo.GitHubToken != "" && !privacy.IsLocalURL(repo.GitHubAPIBase, p.AllowHosts) {
+			return fmt.Errorf("privacy.local_only: tools.repo needs a local github_api_base, e.g. GitHub Enterprise on the LAN")
+		}
+		if repo.GitLabToken != "" && !privacy.IsLocalURL(repo.GitLabAPIBase, p.AllowHosts) {
+			return fmt.Errorf("privacy.local_only: tools.repo needs a local gitlab_api_base")
+		}
+	}
+	if issues := c.Tools.Issues; issues.Enabled {
+		if issues.JiraBaseURL != "" && !privacy.IsLocalURL(issues.JiraBaseURL, p.AllowHosts) {
+			return fmt.Errorf("privacy.local_only: tools.issues needs a local jira_base_url")
+		}
+		if issues.LinearAPIKey != "" {
+			return fmt.Errorf("privacy.local_only: tools.issues cannot use Linear, which is a cloud service")
+		}
+	}
+	if sync := c.WorkspaceSync; sync.Enabled {
+		endpoint := sync.S3.Endpoint
+		if sync.Backend == "webdav" {
+			endpoint = sync.WebDAV.URL
+		}
+		if !privacy.IsLocalURL(endpoint, p.AllowHosts) {
+			return fmt.Errorf("privacy.local_only: workspace_sync needs a local %s endpoint", sync.Backend)
+		}
+	}
+	return nil
+}
+
+func validateBus(c *Config) error {
+	switch c.Bus.Persistence {
+	case "", "memory", "file":
+	default:
+		return fmt.Errorf("bus.persistence: unknown mode %q (want memory or file)", c.Bus.Persistence)
+	}
+	switch c.Bus.Overflow {
+	case "", "block", "drop_oldest", "drop_newest", "reject":
+	default:
+		return fmt.Errorf("bus.overflow: unknown policy %q (want block, drop_oldest, drop_newest or reject)", c.Bus.Overflow)
+	}
+	if c.Bus.QueueSize < 0 {
+		return fmt.Errorf("bus.queue_size must not be negative")
+	}
+	high := c.Bus.HighWatermark
+	if high == 0 {
+		high = 0.8
+	}
+	if high < 0 || high > 1 || c.Bus.LowWatermark < 0 || c.Bus.LowWatermark >= high {
+		return fmt.Errorf("bus: want 0 <= low_watermark < high_watermark <= 1")
+	}
+	switch c.Bus.Broker {
+	case "":
+	case "redis":
+		if c.Bus.BrokerURL == "" {
+			return fmt.Errorf("bus.broker_url: the redis broker needs a url")
+		}
+		if c.Bus.Persistence == "file" {
+			return fmt.Errorf("bus: persistence \"file\" does not apply with a broker, which keeps the messages itself")
+		}
+	default:
+		return fmt.Errorf("bus.broker: unknown broker %q (want redis)", c.Bus.Broker)
+	}
+	switch c.Bus.BrokerRole {
+	case "", "all", "gateway", "worker":
+	default:
+		return fmt.Errorf("bus.broker_role: unknown role %q (want all, gateway or worker)", c.Bus.BrokerRole)
+	}
+	return nil
+}
+
+func validateSession(c *Config) error {
+	switch c.Session.Backend {
+	case "", "file", "memory", "sqlite":
+	case "redis":
+		if c.Session.URL == "" {
+			return fmt.Errorf("session.url: the redis backend needs a url")
+		}
+	default:
+		return fmt.Errorf("session.backend: unknown backend %q (want file, memory, sqlite or redis)", c.Session.Backend)
+	}
+	if c.Session.TTLHours < 0 {
+		return fmt.Errorf("session.ttl_hours must not be negative")
+	}
+	return nil
+}
+
+func validatePipeline(c *Config) error {
+	for channel, stages := range c.Pipeline.Channels {
+		for _, stage := range stages {
+			switch stage {
+			case "profanity", "redact_secrets", "cap_length", "template":
+			default:
+				return fmt.Errorf("pipeline.channels.%s: unknown stage %q (want profanity, redact_secrets, cap_length or template)", channel, stage)
+			}
+			if stage == "template" && c.Pipeline.Template == "" {
+				return fmt.Errorf("pipeline.channels.%s: the template stage needs pipeline.template", channel)
+			}
+		}
+	}
+	return nil
+}
+
+func tunnelDefaults(c *Config) {
+	if c.Tunnel.Provider != "" && c.Tunnel.StartTimeoutSeconds == 0 {
+		c.Tunnel.StartTimeoutSeconds = 30
+	}
+	c.Tunnel.SSH.IdentityFile = expandPath(c.Tunnel.SSH.IdentityFile)
+}
+
+func validateTunnel(c *Config) error {
+	switch tunnel := c.Tunnel; tunnel.Provider {
+	case "":
+	case "cloudflare":
+		if tunnel.Token != "" && tunnel.Hostname == "" {
+			return fmt.Errorf("tunnel: a named cloudflare tunnel needs its hostname")
+		}
+	case "ngrok":
+	case "ssh":
+		if tunnel.SSH.Host == "" || tunnel.SSH.RemotePort == 0 || tunnel.SSH.PublicURL == "" {
+			return fmt.Errorf("tunnel: ssh needs host, remote_port and public_url")
+		}
+	default:
+		return fmt.Errorf("tunnel: unknown provider %q (want cloudflare, ngrok or ssh)", tunnel.Provider)
+	}
+	return nil
+}
+
+func validateWhatsApp(c *Config) error {
+	wa := c.Channels.WhatsApp
+	if !wa.Enabled {
+		return nil
+	}
+	// Check if either bridge URL or Facebook API credentials are provided
+	hasBridge := wa.BridgeURL != "" || len(wa.Instances) > 0
+	hasFBAPI := wa.FBPhoneNumberID != "" && wa.FBAccessToken != ""
+	if !hasBridge && !hasFBAPI {
+		return fmt.Errorf("whatsapp: either bridge_url or facebook api credentials (fb_phone_number_id and fb_access_token) must be provided")
+	}
+	if hasBridge && hasFBAPI {
+		return fmt.Errorf("whatsapp: cannot use both bridge_url and facebook api simultaneously")
+	}
+
+	seen := make(map[string]bool)
+	for i, inst := range wa.Instances {
+		if inst.AccountID == "" || inst.BridgeURL == "" {
+			return fmt.Errorf("whatsapp: instances[%d] needs both account_id and bridge_url", i)
+		}
+		if seen[inst.AccountID] {
+			return fmt.Errorf("whatsapp: duplicate instance account_id %q", inst.AccountID)
+		}
+		seen[inst.AccountID] = true
+	}
+	return nil
+}
+
+func validateTelegram(c *Config) error {
+	tg := c.Channels.Telegram
+	if !tg.Enabled {
+		return nil
+	}
+	if tg.Token == "" {
+		return fmt.Errorf("telegram: token must be provided")
+	}
+	switch tg.Mode {
+	case "", "polling":
+	case "webhook":
+		if u, err := url.Parse(tg.WebhookURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("telegram: webhook mode needs an https webhook_url, got %q", tg.WebhookURL)
+		}
+	default:
+		return fmt.Errorf("telegram: unknown mode %q (want polling or webhook)", tg.Mode)
+	}
+	return nil
+}
+
+func validateSlack(c *Config) error {
+	slack := c.Channels.Slack
+	if !slack.Enabled {
+		return nil
+	}
+	switch slack.Mode {
+	case "", "socket":
+		if slack.BotToken == "" || slack.AppToken == "" {
+			return fmt.Errorf("slack: bot_token and app_token must be provided in socket mode")
+		}
+	case "events":
+		if slack.BotToken == "" || slack.SigningSecret == "" {
+			return fmt.Errorf("slack: bot_token and signing_secret must be provided in events mode")
+		}
+	default:
+		return fmt.Errorf("slack: unknown mode %q (want socket or events)", slack.Mode)
+	}
+	return nil
+}
+
+func validateMQTT(c *Config) error {
+	mqtt := c.Channels.MQTT
+	if !mqtt.Enabled {
+		return nil
+	}
+	if u, err := url.Parse(mqtt.Broker); err != nil || u.Host == "" {
+		return fmt.Errorf("mqtt: broker must be a url such as tcp://host:1883, got %q", mqtt.Broker)
+	}
+	if mqtt.InboundTopic == "" {
+		return fmt.Errorf("mqtt: inbound_topic must be provided")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRegisterSection(t *testing.T) {
+	saved := sections
+	t.Cleanup(func() { sections = saved })
+	sections = append([]Section(nil), saved...)
+
+	RegisterSection(Section{
+		Path: "channels.matrix",
+		Defaults: func(c *Config) {
+			if c.Channels.Matrix.Homeserver == "" {
+				c.Channels.Matrix.Homeserver = "https://matrix.example.org"
+			}
+		},
+		Validate: func(c *Config) error {
+			if c.Channels.Matrix.Enabled && len(c.Channels.Matrix.AllowRooms) == 0 {
+				return fmt.Errorf("matrix: allow_rooms must be provided")
+			}
+			return nil
+		},
+		Env: map[string]string{"access_token": "MATRIX_TOKEN"},
+	})
+	if n := len(sections); n != len(saved) {
+		t.Errorf("replacing a section added one: %d sections, want %d", n, len(saved))
+	}
+
+	cfg := &Config{}
+	cfg.Channels.Matrix.Enabled = true
+	if err := parseEnv(cfg, []string{"MATRIX_TOKEN=syt_x"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg.applyDefaults()
+	if cfg.Channels.Matrix.Homeserver != "https://matrix.example.org" || cfg.Channels.Matrix.AccessToken != "syt_x" {
+		t.Errorf("matrix = %+v", cfg.Channels.Matrix)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "allow_rooms") {
+		t.Errorf("Validate error = %v", err)
+	}
+
+	RegisterSection(Section{Path: "tools.bad", Env: map[string]string{"nope": "BAD_VAR"}})
+	if err := parseEnv(&Config{}, []string{"BAD_VAR=1"}); err == nil || !strings.Contains(err.Error(), "no option tools.bad.nope") {
+		t.Errorf("unknown option error = %v", err)
+	}
+}
+
+func TestSectionEnvFallback(t *testing.T) {
+	cfg := &Config{}
+	if err := parseEnv(cfg, []string{"GITHUB_TOKEN=ghp_env", "LINEAR_API_KEY="}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tools.Repo.GitHubToken != "ghp_env" || cfg.Tools.Issues.LinearAPIKey != "" {
+		t.Errorf("tools = %+v", cfg.Tools)
+	}
+
+	// The file and PICOCLAW_ variables win
+	cfg = &Config{}
+	cfg.Tools.Repo.GitHubToken = "ghp_file"
+	if err := parseEnv(cfg, []string{"GITHUB_TOKEN=ghp_env", "GITLAB_TOKEN=glpat_env", "PICOCLAW_TOOLS_REPO_GITLAB_TOKEN=glpat_picoclaw"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tools.Repo.GitHubToken != "ghp_file" || cfg.Tools.Repo.GitLabToken != "glpat_picoclaw" {
+		t.Errorf("repo = %+v", cfg.Tools.Repo)
+	}
+}
+
+func TestValidateSessionSQLite(t *testing.T) {
+	cfg := &Config{}
+	cfg.applyDefaults()
+	cfg.Session.Backend = "sqlite"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate error = %v", err)
+	}
+	cfg.Session.Backend = "postgres"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "unknown backend") {
+		t.Errorf("Validate error = %v", err)
+	}
+}
+
+func TestGetters(t *testing.T) {
+	cfg := &Config{}
+	cfg.applyDefaults()
+	cfg.Channels.Telegram.Enabled = true
+	cfg.AI.Providers = []ProviderConfig{{Name: "openai", Model: "gpt-4o", Temperature: 0.5, Headers: map[string]string{"X-Team": "a"}}}
+
+	if got := cfg.GetString("channels.line.webhook_host"); got != "0.0.0.0" {
+		t.Errorf("GetString = %q", got)
+	}
+	if got := cfg.GetInt("gateway.port"); got != 18790 {
+		t.Errorf("GetInt = %d", got)
+	}
+	if !cfg.GetBool("channels.telegram.enabled") || cfg.GetBool("channels.discord.enabled") {
+		t.Error("GetBool mismatch")
+	}
+	if got := cfg.GetString("ai.providers[0].model"); got != "gpt-4o" {
+		t.Errorf("GetString(list item) = %q", got)
+	}
+	if got := cfg.GetFloat("ai.providers[0].temperature"); got != 0.5 {
+		t.Errorf("GetFloat = %v", got)
+	}
+	if got := cfg.GetFloat("gateway.port"); got != 18790 {
+		t.Errorf("GetFloat(int) = %v", got)
+	}
+	if got := cfg.GetString("ai.providers[0].headers.X-Team"); got != "a" {
+		t.Errorf("GetString(map entry) = %q", got)
+	}
+
+	for _, path := range []string{"nope", "ai.providers[1].model", "ai.providers[x]", "gateway.port.x"} {
+		if v, ok := cfg.Get(path); ok {
+			t.Errorf("Get(%q) = %v", path, v)
+		}
+	}
+	if got := cfg.GetInt("channels.telegram.token"); got != 0 {
+		t.Errorf("GetInt(string) = %d", got)
+	}
+}
+
+func TestEffectiveJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.applyDefaults()
+	cfg.Channels.Discord.Token = "secret-token"
+
+	data, err := cfg.EffectiveJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-token") || !strings.Contains(string(data), "\n  \"gateway\": {") {
+		t.Errorf("EffectiveJSON =\n%s", data)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+}
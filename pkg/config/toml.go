@@ -0,0 +1,54 @@
+package config
+
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML decodes a TOML document into maps, slices and scalars, the
+// shapes encoding/json decodes. Dates and times are kept as strings, in
+// the layout they were written in.
+func parseTOML(src string) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	if _, err := toml.Decode(src, &doc); err != nil {
+		return nil, err
+	}
+	return tomlValue(doc).(map[string]interface{}), nil
+}
+
+// tomlValue turns the arrays of tables and the dates the decoder returns
+// into lists and strings
+func tomlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = tomlValue(item)
+		}
+		return v
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, table := range v {
+			list[i] = tomlValue(table)
+		}
+		return list
+	case []interface{}:
+		for i, item := range v {
+			v[i] = tomlValue(item)
+		}
+		return v
+	case time.Time:
+		// Local dates and times carry no offset; the decoder marks them
+		// with these zone names
+		switch v.Location().String() {
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999")
+		case "date-local":
+			return v.Format(time.DateOnly)
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return v
+}
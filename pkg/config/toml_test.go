@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	got, err := parseTOML(`# comment
+title = "basic \"quoted\" \u00e9\n"
+path = 'C:\Users\pico'
+"quoted key" = 1
+site."picoclaw.dev".port = 0x1F90
+numbers = [ 1_000, -2, 3.5, 1e3, ]
+nested = [[1, 2], ["a"]]
+multi = """
+first \
+  second"""
+raw = '''
+line\n'''
+when = 1979-05-27T07:32:00Z
+local = 1979-05-27T07:32:00.5
+day = 1979-05-27
+alarm = 07:32:00
+flags = {on = true, off = false}
+
+[owner] # trailing comment
+name = "pico"
+
+[[bots]]
+name = "a"
+
+[[bots]]
+name = "b"
+[bots.limits]
+rate = 2
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"title":      "basic \"quoted\" é\n",
+		"path":       `C:\Users\pico`,
+		"quoted key": int64(1),
+		"site":       map[string]interface{}{"picoclaw.dev": map[string]interface{}{"port": int64(8080)}},
+		"numbers":    []interface{}{int64(1000), int64(-2), 3.5, 1000.0},
+		"nested":     []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{"a"}},
+		"multi":      "first second",
+		"raw":        `line\n`,
+		"when":       "1979-05-27T07:32:00Z",
+		"local":      "1979-05-27T07:32:00.5",
+		"day":        "1979-05-27",
+		"alarm":      "07:32:00",
+		"flags":      map[string]interface{}{"on": true, "off": false},
+		"owner":      map[string]interface{}{"name": "pico"},
+		"bots": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": "b", "limits": map[string]interface{}{"rate": int64(2)}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct{ src, err string }{
+		{"a = 1\na = 2", "line 2"},
+		{"a = \"open", "unexpected EOF"},
+		{"a = 1 b = 2", "to end with a newline"},
+		{"a = [1 2]", "expected a comma"},
+		{"a = yes", `found "yes"`},
+		{"a = 1\n[a]", "already been defined"},
+		{"[table\nb = 1", "to end table name"},
+		{"a = \"\\q\"", `escape`},
+		{"[[a]]\n[a]", "already been defined"},
+	}
+	for _, tt := range tests {
+		_, err := parseTOML(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parseTOML(%q) error = %v, want %q", tt.src, err, tt.err)
+		}
+	}
+}
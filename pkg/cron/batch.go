@@ -0,0 +1,136 @@
+package cron
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// BatchOptions controls how agent jobs that come due together are run. With
+// many chats scheduled at the same time (e.g. morning digests at 08:00),
+// running every job at once would burst past provider rate limits.
+type BatchOptions struct {
+	MaxConcurrent int           // Jobs running at once; 0 or less means 1
+	MinInterval   time.Duration // Minimum time between two job starts
+	Spread        time.Duration // Window the starts of a batch are spread over
+}
+
+// SetBatching makes agent jobs that come due together run as a batch:
+// identical jobs run once, and starts are spread and throttled according to
+// opts. Jobs that only deliver a message or run a command are not batched.
+func (cs *CronService) SetBatching(opts BatchOptions) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.batch = &opts
+}
+
+// isAgentTurn reports whether the job is processed by the agent, i.e. costs
+// an LLM request
+func (job *CronJob) isAgentTurn() bool {
+	return !job.Payload.Deliver && job.Payload.Command == ""
+}
+
+// batchKey identifies jobs that would produce the same result
+type batchKey struct {
+	message, channel, to string
+}
+
+// coalesceJobs groups jobs with the same message and destination, keeping
+// the order in which each group first appears
+func coalesceJobs(jobs []CronJob) [][]CronJob {
+	index := make(map[batchKey]int)
+	var groups [][]CronJob
+	for _, job := range jobs {
+		key := batchKey{job.Payload.Message, job.Payload.Channel, job.Payload.To}
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], job)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []CronJob{job})
+	}
+	return groups
+}
+
+// batchInterval returns the delay between two starts for n jobs
+func batchInterval(opts BatchOptions, n int) time.Duration {
+	interval := opts.MinInterval
+	if n > 1 {
+		if spread := opts.Spread / time.Duration(n-1); spread > interval {
+			interval = spread
+		}
+	}
+	return interval
+}
+
+// runBatch runs due agent jobs according to opts. Jobs not started when stop
+// is closed keep no next run; Start schedules them again.
+func (cs *CronService) runBatch(opts BatchOptions, jobs []CronJob, stop <-chan struct{}) {
+	groups := coalesceJobs(jobs)
+	interval := batchInterval(opts, len(groups))
+	maxConcurrent := opts.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+
+	log.Printf("[cron] running batch of %d jobs as %d runs, %v apart", len(jobs), len(groups), interval)
+
+	slots := make(chan struct{}, maxConcurrent)
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		if i > 0 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-stop:
+				return
+			}
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-stop:
+			return
+		}
+
+		wg.Add(1)
+		go func(group []CronJob) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			cs.runGroup(group)
+		}(group)
+	}
+	wg.Wait()
+}
+
+// runGroup runs one job of a group of identical jobs and records the outcome
+// for all of them. Jobs removed or disabled while the batch was waiting are
+// skipped.
+func (cs *CronService) runGroup(group []CronJob) {
+	startTime := time.Now().UnixMilli()
+
+	cs.mu.RLock()
+	handler := cs.onJob
+	var live []CronJob
+	for _, job := range group {
+		for i := range cs.store.Jobs {
+			if cs.store.Jobs[i].ID == job.ID && cs.store.Jobs[i].Enabled {
+				live = append(live, cs.store.Jobs[i])
+				break
+			}
+		}
+	}
+	cs.mu.RUnlock()
+
+	if len(live) == 0 {
+		return
+	}
+
+	var err error
+	if handler != nil {
+		job := live[0]
+		_, err = handler(&job)
+	}
+
+	for _, job := range live {
+		cs.finishJob(job.ID, startTime, err)
+	}
+}
@@ -0,0 +1,128 @@
+package cron
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		opts BatchOptions
+		n    int
+		want time.Duration
+	}{
+		{"single job", BatchOptions{Spread: time.Minute}, 1, 0},
+		{"spread over window", BatchOptions{Spread: time.Minute}, 7, 10 * time.Second},
+		{"min interval wins", BatchOptions{Spread: time.Minute, MinInterval: 20 * time.Second}, 7, 20 * time.Second},
+		{"no options", BatchOptions{}, 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchInterval(tt.opts, tt.n); got != tt.want {
+				t.Errorf("batchInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+
+	var (
+		mu               sync.Mutex
+		ran              []string
+		starts           []time.Time
+		running, maxSeen int
+	)
+	cs.SetOnJob(func(job *CronJob) (string, error) {
+		mu.Lock()
+		ran = append(ran, job.Payload.To)
+		starts = append(starts, time.Now())
+		running++
+		if running > maxSeen {
+			maxSeen = running
+		}
+		mu.Unlock()
+
+		time.Sleep(30 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "ok", nil
+	})
+
+	every := CronSchedule{Kind: "every", EveryMS: int64Ptr(3600000)}
+	var jobs []CronJob
+	for _, to := range []string{"group-a", "group-b", "group-c", "group-a"} {
+		job, err := cs.AddJob("digest", every, "Summarize today's messages", false, "whatsapp", to)
+		if err != nil {
+			t.Fatalf("AddJob: %v", err)
+		}
+		jobs = append(jobs, *job)
+	}
+
+	cs.runBatch(BatchOptions{MaxConcurrent: 2, MinInterval: 10 * time.Millisecond}, jobs, make(chan struct{}))
+
+	if len(ran) != 3 {
+		t.Fatalf("expected the duplicate group-a job to be coalesced, got runs %v", ran)
+	}
+	if maxSeen > 2 {
+		t.Errorf("expected at most 2 concurrent jobs, saw %d", maxSeen)
+	}
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < 10*time.Millisecond {
+			t.Errorf("jobs %d and %d started %v apart", i, i+1, gap)
+		}
+	}
+
+	for _, job := range cs.ListJobs(false) {
+		if job.State.LastStatus != "ok" || job.State.NextRunAtMS == nil {
+			t.Errorf("job for %s not finished: %+v", job.Payload.To, job.State)
+		}
+	}
+}
+
+func TestRunBatchStop(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+
+	var mu sync.Mutex
+	runs := 0
+	cs.SetOnJob(func(job *CronJob) (string, error) {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		return "ok", nil
+	})
+
+	var jobs []CronJob
+	for _, to := range []string{"a", "b", "c"} {
+		job, _ := cs.AddJob("digest", CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}, "hi", false, "telegram", to)
+		jobs = append(jobs, *job)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		cs.runBatch(BatchOptions{MinInterval: time.Hour}, jobs, stop)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runBatch did not return after stop")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if runs != 1 {
+		t.Errorf("expected only the first job to run before stop, got %d", runs)
+	}
+}
@@ -0,0 +1,162 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ContextProvider supplies text that templated job messages pull in when the
+// job runs, such as today's calendar events or unread feed items. since is
+// the job's previous run, zero on the first one.
+type ContextProvider interface {
+	Context(ctx context.Context, since time.Time) (string, error)
+}
+
+// templateData is what templated job messages are executed with
+type templateData struct {
+	Name string    // Job name
+	Now  time.Time // When the job runs
+}
+
+// SetContextProviders registers the providers templated jobs can call by name
+func (cs *CronService) SetContextProviders(providers map[string]ContextProvider) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.providers = providers
+}
+
+// ExpandMessage returns the message of a job with its template resolved.
+// Messages of jobs that are not templated are returned as is. Templates call
+// providers with {{context "name"}}; only the providers a template calls are
+// asked, and a failing provider is reported inline instead of failing the
+// job.
+func (cs *CronService) ExpandMessage(ctx context.Context, job *CronJob) (string, error) {
+	if !job.Payload.Template {
+		return job.Payload.Message, nil
+	}
+
+	cs.mu.RLock()
+	providers := cs.providers
+	cs.mu.RUnlock()
+
+	var since time.Time
+	if job.State.LastRunAtMS != nil {
+		since = time.UnixMilli(*job.State.LastRunAtMS)
+	}
+
+	funcs := template.FuncMap{
+		"context": func(name string) (string, error) {
+			provider, ok := providers[name]
+			if !ok {
+				return "", fmt.Errorf("unknown context provider %q", name)
+			}
+			text, err := provider.Context(ctx, since)
+			if err != nil {
+				log.Printf("[cron] context provider %s failed for job %s: %v", name, job.ID, err)
+				return fmt.Sprintf("(%s unavailable: %v)", name, err), nil
+			}
+			return strings.TrimSpace(text), nil
+		},
+	}
+	tmpl, err := template.New(job.ID).Funcs(funcs).Parse(job.Payload.Message)
+	if err != nil {
+		return "", fmt.Errorf("invalid message template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, templateData{Name: job.Name, Now: time.Now()}); err != nil {
+		return "", fmt.Errorf("failed to render message template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// ConfigJobPrefix starts the IDs of jobs defined in the configuration
+const ConfigJobPrefix = "config-"
+
+// SyncConfigJobs makes the jobs defined in the configuration match jobs:
+// new ones are added, changed ones updated and removed ones deleted. Jobs are
+// matched by ID, which must start with ConfigJobPrefix; jobs created at run
+// time are left alone. While the store is corrupt the jobs are applied once
+// it has been repaired.
+func (cs *CronService) SyncConfigJobs(jobs []CronJob) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, job := range jobs {
+		if !strings.HasPrefix(job.ID, ConfigJobPrefix) {
+			return fmt.Errorf("config job %q must have an ID starting with %q", job.ID, ConfigJobPrefix)
+		}
+	}
+	cs.configJobs = append([]CronJob{}, jobs...)
+	if cs.storeErr != nil {
+		return nil
+	}
+	return cs.syncConfigJobsUnsafe(jobs)
+}
+
+func (cs *CronService) syncConfigJobsUnsafe(jobs []CronJob) error {
+	now := time.Now().UnixMilli()
+	wanted := make(map[string]CronJob, len(jobs))
+	for _, job := range jobs {
+		wanted[job.ID] = job
+	}
+
+	var kept []CronJob
+	for _, existing := range cs.store.Jobs {
+		if !strings.HasPrefix(existing.ID, ConfigJobPrefix) {
+			kept = append(kept, existing)
+			continue
+		}
+		job, ok := wanted[existing.ID]
+		if !ok {
+			continue
+		}
+		delete(wanted, existing.ID)
+
+		// Keep the run history, but pick up schedule and payload changes
+		job.State = existing.State
+		job.CreatedAtMS = existing.CreatedAtMS
+		job.UpdatedAtMS = existing.UpdatedAtMS
+		if !sameSchedule(job.Schedule, existing.Schedule) || job.Payload != existing.Payload || job.Name != existing.Name || job.Enabled != existing.Enabled {
+			job.UpdatedAtMS = now
+			job.State.NextRunAtMS = nil
+			if job.Enabled {
+				job.State.NextRunAtMS = cs.computeNextRun(&job.Schedule, now)
+			}
+		}
+		kept = append(kept, job)
+	}
+
+	// Add the new ones in configuration order
+	for _, job := range jobs {
+		if _, ok := wanted[job.ID]; !ok {
+			continue
+		}
+		job.CreatedAtMS = now
+		job.UpdatedAtMS = now
+		if job.Enabled {
+			job.State.NextRunAtMS = cs.computeNextRun(&job.Schedule, now)
+		}
+		kept = append(kept, job)
+	}
+
+	cs.store.Jobs = kept
+	return cs.saveStoreUnsafe()
+}
+
+// sameSchedule compares schedules by value
+func sameSchedule(a, b CronSchedule) bool {
+	return a.Kind == b.Kind && a.Expr == b.Expr && a.TZ == b.TZ &&
+		sameMS(a.AtMS, b.AtMS) && sameMS(a.EveryMS, b.EveryMS)
+}
+
+func sameMS(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,112 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticProvider struct {
+	text  string
+	err   error
+	calls int
+	since time.Time
+}
+
+func (p *staticProvider) Context(ctx context.Context, since time.Time) (string, error) {
+	p.calls++
+	p.since = since
+	return p.text, p.err
+}
+
+func TestExpandMessage(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	calendar := &staticProvider{text: "09:00 Standup\n"}
+	feeds := &staticProvider{err: errors.New("timeout")}
+	unused := &staticProvider{}
+	cs.SetContextProviders(map[string]ContextProvider{"calendar": calendar, "feeds": feeds, "metrics": unused})
+
+	lastRun := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC).UnixMilli()
+	job := &CronJob{
+		ID:   "config-digest",
+		Name: "digest",
+		Payload: CronPayload{
+			Message:  "{{.Name}}\nEvents:\n{{context \"calendar\"}}\nNews:\n{{context \"feeds\"}}",
+			Template: true,
+		},
+		State: CronJobState{LastRunAtMS: &lastRun},
+	}
+
+	got, err := cs.ExpandMessage(context.Background(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "digest\nEvents:\n09:00 Standup\nNews:\n(feeds unavailable: timeout)"
+	if got != want {
+		t.Errorf("ExpandMessage() = %q, want %q", got, want)
+	}
+	if !calendar.since.Equal(time.UnixMilli(lastRun)) {
+		t.Errorf("provider got since %v, want the last run", calendar.since)
+	}
+	if unused.calls != 0 {
+		t.Error("providers the template does not call should not be asked")
+	}
+
+	job.Payload.Message = `{{context "weather"}}`
+	if _, err := cs.ExpandMessage(context.Background(), job); err == nil || !strings.Contains(err.Error(), "weather") {
+		t.Errorf("expected an unknown provider error, got %v", err)
+	}
+
+	job.Payload.Template = false
+	if got, _ := cs.ExpandMessage(context.Background(), job); got != job.Payload.Message {
+		t.Errorf("plain messages should be left alone, got %q", got)
+	}
+}
+
+func TestSyncConfigJobs(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	manual, err := cs.AddJob("manual", CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}, "hello", false, "cli", "direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := CronJob{
+		ID:       ConfigJobPrefix + "digest",
+		Name:     "digest",
+		Enabled:  true,
+		Schedule: CronSchedule{Kind: "cron", Expr: "0 8 * * *"},
+		Payload:  CronPayload{Kind: "agent_turn", Message: "Digest", Template: true},
+	}
+	old := CronJob{ID: ConfigJobPrefix + "old", Enabled: true, Schedule: CronSchedule{Kind: "every", EveryMS: int64Ptr(1000)}}
+	if err := cs.SyncConfigJobs([]CronJob{digest, old}); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := cs.ListJobs(true); len(jobs) != 3 || jobs[1].State.NextRunAtMS == nil {
+		t.Fatalf("unexpected jobs after the first sync: %+v", jobs)
+	}
+
+	// Run history survives a sync without changes
+	ran := time.Now().UnixMilli()
+	jobs := cs.ListJobs(true)
+	jobs[1].State.LastRunAtMS = &ran
+	if err := cs.UpdateJob(&jobs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.SyncConfigJobs([]CronJob{digest}); err != nil {
+		t.Fatal(err)
+	}
+	jobs = cs.ListJobs(true)
+	if len(jobs) != 2 || jobs[0].ID != manual.ID || jobs[1].ID != digest.ID {
+		t.Fatalf("unexpected jobs after removing one: %+v", jobs)
+	}
+	if jobs[1].State.LastRunAtMS == nil || *jobs[1].State.LastRunAtMS != ran {
+		t.Error("the last run should be kept")
+	}
+
+	if err := cs.SyncConfigJobs([]CronJob{{ID: "digest"}}); err == nil {
+		t.Error("config jobs need the config prefix")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -29,6 +30,9 @@ type CronPayload struct {
 	Deliver bool   `json:"deliver"`
 	Channel string `json:"channel,omitempty"`
 	To      string `json:"to,omitempty"`
+	// Template marks messages that are text/template strings resolved with
+	// context providers when the job runs
+	Template bool `json:"template,omitempty"`
 }
 
 type CronJobState struct {
@@ -57,6 +61,10 @@ type CronStore struct {
 
 type JobHandler func(job *CronJob) (string, error)
 
+// ErrStoreCorrupt means the job store could not be parsed. Jobs are paused
+// and the file is left untouched until it is repaired.
+var ErrStoreCorrupt = errors.New("cron job store is corrupt")
+
 type CronService struct {
 	storePath string
 	store     *CronStore
@@ -65,6 +73,12 @@ type CronService struct {
 	running   bool
 	stopChan  chan struct{}
 	gronx     *gronx.Gronx
+	batch     *BatchOptions
+	providers map[string]ContextProvider
+
+	storeErr   error     // Set while the store is corrupt
+	corruptMod time.Time // Modification time of the corrupt store file
+	configJobs []CronJob // Last jobs passed to SyncConfigJobs, reapplied after a repair
 }
 
 func NewCronService(storePath string, onJob JobHandler) *CronService {
@@ -86,13 +100,17 @@ func (cs *CronService) Start() error {
 		return nil
 	}
 
-	if err := cs.loadStore(); err != nil {
+	if err := cs.loadStore(); err != nil && !errors.Is(err, ErrStoreCorrupt) {
 		return fmt.Errorf("failed to load store: %w", err)
 	}
 
-	cs.recomputeNextRuns()
-	if err := cs.saveStoreUnsafe(); err != nil {
-		return fmt.Errorf("failed to save store: %w", err)
+	if cs.storeErr != nil {
+		log.Printf("[cron] %v; jobs are paused until %s is repaired", cs.storeErr, cs.storePath)
+	} else {
+		cs.recomputeNextRuns()
+		if err := cs.saveStoreUnsafe(); err != nil {
+			return fmt.Errorf("failed to save store: %w", err)
+		}
 	}
 
 	cs.stopChan = make(chan struct{})
@@ -138,15 +156,27 @@ func (cs *CronService) checkJobs() {
 		cs.mu.Unlock()
 		return
 	}
+	if cs.storeErr != nil {
+		cs.reloadRepairedUnsafe()
+		if cs.storeErr != nil {
+			cs.mu.Unlock()
+			return
+		}
+	}
 
 	now := time.Now().UnixMilli()
 	var dueJobIDs []string
+	var batched []CronJob
 
 	// Collect jobs that are due (we need to copy them to execute outside lock)
 	for i := range cs.store.Jobs {
 		job := &cs.store.Jobs[i]
 		if job.Enabled && job.State.NextRunAtMS != nil && *job.State.NextRunAtMS <= now {
-			dueJobIDs = append(dueJobIDs, job.ID)
+			if cs.batch != nil && job.isAgentTurn() {
+				batched = append(batched, *job)
+			} else {
+				dueJobIDs = append(dueJobIDs, job.ID)
+			}
 		}
 	}
 
@@ -155,6 +185,9 @@ func (cs *CronService) checkJobs() {
 	for _, jobID := range dueJobIDs {
 		dueMap[jobID] = true
 	}
+	for _, job := range batched {
+		dueMap[job.ID] = true
+	}
 	for i := range cs.store.Jobs {
 		if dueMap[cs.store.Jobs[i].ID] {
 			cs.store.Jobs[i].State.NextRunAtMS = nil
@@ -165,6 +198,10 @@ func (cs *CronService) checkJobs() {
 		log.Printf("[cron] failed to save store: %v", err)
 	}
 
+	if len(batched) > 0 {
+		go cs.runBatch(*cs.batch, batched, cs.stopChan)
+	}
+
 	cs.mu.Unlock()
 
 	// Execute jobs outside lock.
@@ -197,7 +234,11 @@ func (cs *CronService) executeJobByID(jobID string) {
 		_, err = cs.onJob(callbackJob)
 	}
 
-	// Now acquire lock to update state
+	cs.finishJob(jobID, startTime, err)
+}
+
+// finishJob records the outcome of a run and schedules the next one
+func (cs *CronService) finishJob(jobID string, startTime int64, err error) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
@@ -306,6 +347,37 @@ func (cs *CronService) Load() error {
 	return cs.loadStore()
 }
 
+// StoreErr returns why jobs are paused, or nil while the store is healthy
+func (cs *CronService) StoreErr() error {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.storeErr
+}
+
+// reloadRepairedUnsafe reloads a corrupt store once its file has changed
+// and resumes the jobs if it parses
+func (cs *CronService) reloadRepairedUnsafe() {
+	if info, err := os.Stat(cs.storePath); err == nil && info.ModTime().Equal(cs.corruptMod) {
+		return
+	}
+	if err := cs.loadStore(); err != nil {
+		if !errors.Is(err, ErrStoreCorrupt) {
+			log.Printf("[cron] failed to reload store: %v", err)
+		}
+		return
+	}
+
+	log.Printf("[cron] job store repaired, resuming jobs")
+	cs.recomputeNextRuns()
+	if cs.configJobs != nil {
+		if err := cs.syncConfigJobsUnsafe(cs.configJobs); err != nil {
+			log.Printf("[cron] failed to restore config jobs: %v", err)
+		}
+	} else if err := cs.saveStoreUnsafe(); err != nil {
+		log.Printf("[cron] failed to save store: %v", err)
+	}
+}
+
 func (cs *CronService) SetOnJob(handler JobHandler) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -318,6 +390,8 @@ func (cs *CronService) loadStore() error {
 		Jobs:    []CronJob{},
 	}
 
+	cs.storeErr = nil
+
 	data, err := os.ReadFile(cs.storePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -326,10 +400,23 @@ func (cs *CronService) loadStore() error {
 		return err
 	}
 
-	return json.Unmarshal(data, cs.store)
+	store := &CronStore{Version: 1, Jobs: []CronJob{}}
+	if err := json.Unmarshal(data, store); err != nil {
+		// Keep the file for repair; saving now would replace it with an empty store
+		cs.storeErr = fmt.Errorf("%w: %v", ErrStoreCorrupt, err)
+		if info, statErr := os.Stat(cs.storePath); statErr == nil {
+			cs.corruptMod = info.ModTime()
+		}
+		return cs.storeErr
+	}
+	cs.store = store
+	return nil
 }
 
 func (cs *CronService) saveStoreUnsafe() error {
+	if cs.storeErr != nil {
+		return cs.storeErr
+	}
 	dir := filepath.Dir(cs.storePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
@@ -478,6 +565,7 @@ func (cs *CronService) Status() map[string]interface{} {
 
 	return map[string]interface{}{
 		"enabled":      cs.running,
+		"paused":       cs.storeErr != nil,
 		"jobs":         len(cs.store.Jobs),
 		"nextWakeAtMS": cs.getNextWakeMS(),
 	}
@@ -1,10 +1,12 @@
 package cron
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func TestSaveStore_FilePermissions(t *testing.T) {
@@ -36,3 +38,45 @@ func TestSaveStore_FilePermissions(t *testing.T) {
 func int64Ptr(v int64) *int64 {
 	return &v
 }
+
+func TestCorruptStorePausesJobs(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "jobs.json")
+	if err := os.WriteFile(storePath, []byte(`{"version":1,"jobs":[`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := NewCronService(storePath, nil)
+	if err := cs.Start(); err != nil {
+		t.Fatalf("Start() = %v, want jobs paused instead", err)
+	}
+	cs.Stop()
+	cs.running = true // drive checkJobs by hand
+
+	if !errors.Is(cs.StoreErr(), ErrStoreCorrupt) {
+		t.Fatalf("StoreErr() = %v, want ErrStoreCorrupt", cs.StoreErr())
+	}
+	if _, err := cs.AddJob("x", CronSchedule{Kind: "every", EveryMS: int64Ptr(1000)}, "hi", false, "cli", "direct"); err == nil {
+		t.Error("AddJob should fail while the store is corrupt")
+	}
+	if err := cs.SyncConfigJobs([]CronJob{{ID: ConfigJobPrefix + "daily", Name: "daily", Enabled: true, Schedule: CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}}}); err != nil {
+		t.Errorf("SyncConfigJobs() = %v", err)
+	}
+	cs.checkJobs()
+	if data, _ := os.ReadFile(storePath); string(data) != `{"version":1,"jobs":[` {
+		t.Errorf("corrupt store was overwritten: %s", data)
+	}
+
+	// Repairing the file resumes the jobs, including the config ones
+	repaired := `{"version":1,"jobs":[{"id":"a","name":"a","enabled":true,"schedule":{"kind":"every","everyMs":60000},"payload":{"kind":"agent_turn","message":"hi"}}]}`
+	if err := os.WriteFile(storePath, []byte(repaired), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(storePath, time.Now(), time.Now().Add(time.Second))
+	cs.checkJobs()
+	if err := cs.StoreErr(); err != nil {
+		t.Fatalf("StoreErr() after repair = %v", err)
+	}
+	if jobs := cs.ListJobs(true); len(jobs) != 2 || jobs[0].State.NextRunAtMS == nil || jobs[1].ID != ConfigJobPrefix+"daily" {
+		t.Errorf("jobs after repair = %+v", jobs)
+	}
+}
@@ -0,0 +1,99 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metrics reports the load, memory, temperature and uptime of the board the
+// agent runs on, read from /proc and /sys. It is a context provider for
+// scheduled digests. Readings the system does not offer are left out.
+type Metrics struct {
+	root string // Prefix of /proc and /sys, for tests
+}
+
+// NewMetrics creates a provider for the host's metrics
+func NewMetrics() *Metrics {
+	return &Metrics{root: "/"}
+}
+
+// Context returns one reading per line
+func (m *Metrics) Context(ctx context.Context, since time.Time) (string, error) {
+	var lines []string
+	if load, err := m.read("proc/loadavg"); err == nil {
+		if fields := strings.Fields(load); len(fields) >= 3 {
+			lines = append(lines, fmt.Sprintf("Load: %s %s %s", fields[0], fields[1], fields[2]))
+		}
+	}
+	if line := m.memory(); line != "" {
+		lines = append(lines, line)
+	}
+	if line := m.temperature(); line != "" {
+		lines = append(lines, line)
+	}
+	if uptime, err := m.read("proc/uptime"); err == nil {
+		if fields := strings.Fields(uptime); len(fields) > 0 {
+			if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				lines = append(lines, "Uptime: "+(time.Duration(seconds)*time.Second).Truncate(time.Minute).String())
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no metrics available on this system")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (m *Metrics) read(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(m.root, name))
+	return strings.TrimSpace(string(data)), err
+}
+
+// memory reports used memory from /proc/meminfo
+func (m *Metrics) memory() string {
+	info, err := m.read("proc/meminfo")
+	if err != nil {
+		return ""
+	}
+	values := make(map[string]int64)
+	for _, line := range strings.Split(info, "\n") {
+		key, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if fields := strings.Fields(rest); len(fields) > 0 {
+			values[key], _ = strconv.ParseInt(fields[0], 10, 64)
+		}
+	}
+	total, available := values["MemTotal"], values["MemAvailable"]
+	if total == 0 {
+		return ""
+	}
+	used := total - available
+	return fmt.Sprintf("Memory: %d/%d MiB used (%d%%)", used/1024, total/1024, used*100/total)
+}
+
+// temperature reports the hottest thermal zone
+func (m *Metrics) temperature() string {
+	zones, _ := filepath.Glob(filepath.Join(m.root, "sys/class/thermal/thermal_zone*/temp"))
+	hottest := int64(-1 << 62)
+	for _, zone := range zones {
+		data, err := os.ReadFile(zone)
+		if err != nil {
+			continue
+		}
+		milli, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err == nil && milli > hottest {
+			hottest = milli
+		}
+	}
+	if hottest == -1<<62 {
+		return ""
+	}
+	return fmt.Sprintf("Temperature: %.1f°C", float64(hottest)/1000)
+}
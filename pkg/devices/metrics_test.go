@@ -0,0 +1,42 @@
+package devices
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMetricsContext(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"proc/loadavg":                         "0.52 0.40 0.31 1/123 4567\n",
+		"proc/meminfo":                         "MemTotal:        1048576 kB\nMemFree:          100000 kB\nMemAvailable:     524288 kB\n",
+		"proc/uptime":                          "93784.21 180000.00\n",
+		"sys/class/thermal/thermal_zone0/temp": "45000\n",
+		"sys/class/thermal/thermal_zone1/temp": "51250\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &Metrics{root: root}
+	got, err := m.Context(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Load: 0.52 0.40 0.31\nMemory: 512/1024 MiB used (50%)\nTemperature: 51.2°C\nUptime: 26h3m0s"
+	if got != want {
+		t.Errorf("Context() = %q, want %q", got, want)
+	}
+
+	m = &Metrics{root: t.TempDir()}
+	if _, err := m.Context(context.Background(), time.Time{}); err == nil {
+		t.Error("expected an error without any metrics")
+	}
+}
@@ -0,0 +1,141 @@
+// Package errs defines the error kinds shared by channels, providers and
+// the agent, and maps them to replies for users and HTTP statuses. Errors
+// are classified by wrapping a kind, e.g.
+//
+//	fmt.Errorf("%w: telegram bot not running", errs.ErrChannelDown)
+//
+// so the detail stays in logs while users get a helpful message.
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error kinds
+var (
+	// ErrChannelDown means a chat channel is stopped, disconnected or unknown
+	ErrChannelDown = errors.New("channel unavailable")
+	// ErrRateLimited means a provider or channel asked us to slow down
+	ErrRateLimited = errors.New("rate limited")
+	// ErrBudgetExceeded means a provider quota or spending limit was reached
+	ErrBudgetExceeded = errors.New("budget exceeded")
+	// ErrValidation means a request or its input was rejected as invalid
+	ErrValidation = errors.New("invalid input")
+)
+
+// RateLimitError is an ErrRateLimited that knows when to retry
+type RateLimitError struct {
+	RetryAfter time.Duration // Zero when unknown
+	Err        error         // Underlying error, may be nil
+}
+
+func (e *RateLimitError) Error() string {
+	msg := ErrRateLimited.Error()
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrRateLimited) match
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// ParseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date, returning zero when it is missing or unusable
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// UserMessage returns a reply for the user that explains err without
+// exposing internal details. Unclassified errors get a generic apology.
+func UserMessage(err error) string {
+	var rateLimit *RateLimitError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &rateLimit) && rateLimit.RetryAfter > 0:
+		return fmt.Sprintf("I'm getting too many requests right now. Please try again in %s.", roundUp(rateLimit.RetryAfter))
+	case errors.Is(err, ErrRateLimited):
+		return "I'm getting too many requests right now. Please try again in a minute."
+	case errors.Is(err, ErrBudgetExceeded):
+		return "My usage limit has been reached, so I can't answer right now. Please let the owner know."
+	case errors.Is(err, ErrChannelDown):
+		return "I can't reach that chat service right now. Please try again later."
+	case errors.Is(err, ErrValidation):
+		return "I couldn't process that request: it looks invalid. Please check it and try again."
+	default:
+		return "Sorry, something went wrong while handling your message. Please try again."
+	}
+}
+
+// HTTPStatus returns the HTTP status code that fits err
+func HTTPStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrBudgetExceeded):
+		return http.StatusPaymentRequired
+	case errors.Is(err, ErrChannelDown):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// WriteHTTP writes err as a plain-text response with the fitting status and
+// a Retry-After header for rate limits
+func WriteHTTP(w http.ResponseWriter, err error) {
+	var rateLimit *RateLimitError
+	if errors.As(err, &rateLimit) && rateLimit.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(roundUp(rateLimit.RetryAfter)/time.Second)))
+	}
+	status := HTTPStatus(err)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// FromHTTPStatus classifies an error response from an upstream API, such as
+// an LLM provider. It returns nil for statuses that have no kind.
+func FromHTTPStatus(status int, retryAfter string, cause error) error {
+	switch status {
+	case http.StatusTooManyRequests:
+		return &RateLimitError{RetryAfter: ParseRetryAfter(retryAfter, time.Now()), Err: cause}
+	case http.StatusPaymentRequired:
+		return fmt.Errorf("%w: %w", ErrBudgetExceeded, cause)
+	case http.StatusServiceUnavailable:
+		if d := ParseRetryAfter(retryAfter, time.Now()); d > 0 {
+			return &RateLimitError{RetryAfter: d, Err: cause}
+		}
+	}
+	return nil
+}
+
+// roundUp rounds d up to whole seconds
+func roundUp(d time.Duration) time.Duration {
+	return (d + time.Second - 1).Truncate(time.Second)
+}
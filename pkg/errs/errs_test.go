@@ -0,0 +1,105 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, http.StatusOK},
+		{fmt.Errorf("%w: bad payload", ErrValidation), http.StatusBadRequest},
+		{&RateLimitError{RetryAfter: time.Second}, http.StatusTooManyRequests},
+		{fmt.Errorf("%w: quota", ErrBudgetExceeded), http.StatusPaymentRequired},
+		{fmt.Errorf("send: %w", fmt.Errorf("%w: telegram bot not running", ErrChannelDown)), http.StatusServiceUnavailable},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := HTTPStatus(tt.err); got != tt.want {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestUserMessageHidesDetails(t *testing.T) {
+	secret := errors.New("API request failed: Body: {\"key\":\"sk-123\"}")
+	for _, err := range []error{
+		secret,
+		fmt.Errorf("%w: %w", ErrBudgetExceeded, secret),
+		&RateLimitError{Err: secret},
+	} {
+		if msg := UserMessage(err); strings.Contains(msg, "sk-123") || msg == "" {
+			t.Errorf("UserMessage(%v) = %q", err, msg)
+		}
+	}
+
+	if msg := UserMessage(&RateLimitError{RetryAfter: 1500 * time.Millisecond}); !strings.Contains(msg, "2s") {
+		t.Errorf("rate limit message should round the delay up, got %q", msg)
+	}
+	if UserMessage(nil) != "" {
+		t.Error("nil error should have no message")
+	}
+}
+
+func TestRateLimitErrorIs(t *testing.T) {
+	cause := errors.New("429")
+	err := fmt.Errorf("LLM call failed: %w", &RateLimitError{Err: cause})
+	if !errors.Is(err, ErrRateLimited) || !errors.Is(err, cause) {
+		t.Errorf("wrapped rate limit error should match kind and cause: %v", err)
+	}
+}
+
+func TestFromHTTPStatus(t *testing.T) {
+	cause := errors.New("upstream")
+
+	var rl *RateLimitError
+	if err := FromHTTPStatus(http.StatusTooManyRequests, "30", cause); !errors.As(err, &rl) || rl.RetryAfter != 30*time.Second {
+		t.Errorf("429 = %v, want rate limit with 30s", err)
+	}
+	if err := FromHTTPStatus(http.StatusPaymentRequired, "", cause); !errors.Is(err, ErrBudgetExceeded) || !errors.Is(err, cause) {
+		t.Errorf("402 = %v, want budget exceeded", err)
+	}
+	if err := FromHTTPStatus(http.StatusServiceUnavailable, "", cause); err != nil {
+		t.Errorf("503 without Retry-After = %v, want nil", err)
+	}
+	if err := FromHTTPStatus(http.StatusInternalServerError, "", cause); err != nil {
+		t.Errorf("500 = %v, want nil", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if d := ParseRetryAfter("120", now); d != 2*time.Minute {
+		t.Errorf("seconds = %v", d)
+	}
+	if d := ParseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now); d != time.Minute {
+		t.Errorf("date = %v", d)
+	}
+	for _, v := range []string{"", "soon", "-5", now.Add(-time.Minute).Format(http.TimeFormat)} {
+		if d := ParseRetryAfter(v, now); d != 0 {
+			t.Errorf("ParseRetryAfter(%q) = %v, want 0", v, d)
+		}
+	}
+}
+
+func TestWriteHTTP(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteHTTP(rec, &RateLimitError{RetryAfter: 90 * time.Second})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "90" {
+		t.Errorf("got %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	rec = httptest.NewRecorder()
+	WriteHTTP(rec, fmt.Errorf("%w: missing field", ErrValidation))
+	if rec.Code != http.StatusBadRequest || strings.Contains(rec.Body.String(), "missing field") {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,116 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const suiteYAML = `name: smoke
+max_latency: 1m
+cases:
+  - name: greets
+    prompt: Say hello
+    must_contain: [Hello]
+    must_not_contain: ["as an AI"]
+  - prompt: What's the weather in Berlin?
+    must_call: [web_search]
+    must_not_call: [exec]
+    must_match: '\d+ ?°C'
+    max_latency: 10ms
+`
+
+func writeSuite(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "suite.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSuite(t *testing.T) {
+	suite, err := LoadSuite(writeSuite(t, suiteYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suite.Name != "smoke" || len(suite.Cases) != 2 {
+		t.Fatalf("unexpected suite %+v", suite)
+	}
+	if c := suite.Cases[0]; time.Duration(c.MaxLatency) != time.Minute {
+		t.Errorf("suite max_latency not applied: %v", time.Duration(c.MaxLatency))
+	}
+	if c := suite.Cases[1]; c.Name != "case 2" || time.Duration(c.MaxLatency) != 10*time.Millisecond {
+		t.Errorf("unexpected case %+v", c)
+	}
+
+	for content, want := range map[string]string{
+		"cases: []":          "has no cases",
+		"cases: [{name: a}]": "has no prompt",
+		"cases: [{prompt: x, max_latency: soon}]":             "invalid duration",
+		"cases: [{prompt: x, must_match: '('}]":               "missing closing",
+		"cases: [{name: a, prompt: x}, {name: a, prompt: y}]": "duplicate case name",
+	} {
+		if _, err := LoadSuite(writeSuite(t, content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	suite, err := LoadSuite(writeSuite(t, suiteYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := func(ctx context.Context, prompt string) (Response, error) {
+		if strings.Contains(prompt, "hello") {
+			return Response{Content: "hello there, as an AI I can't wave"}, nil
+		}
+		time.Sleep(20 * time.Millisecond)
+		return Response{Content: "Rainy", Tools: []string{"exec"}}, nil
+	}
+
+	var seen []string
+	report := Run(context.Background(), suite, agent, func(r Result) { seen = append(seen, r.Name) })
+	if report.Passed != 0 || report.Failed != 2 || len(seen) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if got, want := report.Results[0].Failures, []string{`contains "as an AI"`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("failures %q, want %q", got, want)
+	}
+	failures := strings.Join(report.Results[1].Failures, "; ")
+	for _, want := range []string{"does not match", "did not call web_search", "called exec", "over 10ms"} {
+		if !strings.Contains(failures, want) {
+			t.Errorf("failures %q lack %q", failures, want)
+		}
+	}
+
+	report = Run(context.Background(), suite, func(ctx context.Context, prompt string) (Response, error) {
+		return Response{}, errors.New("provider down")
+	}, nil)
+	if report.Results[0].Failures[0] != "error: provider down" {
+		t.Errorf("unexpected failures %q", report.Results[0].Failures)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &Report{Results: []Result{{Name: "a", Passed: true}, {Name: "b"}, {Name: "c", Passed: true}}}
+	current := &Report{Results: []Result{{Name: "a"}, {Name: "b", Passed: true}, {Name: "d"}}}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := baseline.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regressions, fixed := current.Compare(loaded)
+	if !reflect.DeepEqual(regressions, []string{"a"}) || !reflect.DeepEqual(fixed, []string{"b"}) {
+		t.Errorf("regressions %v, fixed %v", regressions, fixed)
+	}
+}
@@ -0,0 +1,204 @@
+package expiry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/auth"
+)
+
+// Check kinds
+const (
+	KindTLS           = "tls"
+	KindCertFile      = "cert_file"
+	KindFacebookToken = "facebook_token"
+	KindOAuth         = "oauth"
+)
+
+// defaultTLSPorts are the ports of URL schemes without an explicit one
+var defaultTLSPorts = map[string]string{
+	"https": "443",
+	"wss":   "443",
+	"ssl":   "8883",
+	"tls":   "8883",
+}
+
+// TLSEndpoint watches the certificate chain served at addr, given as
+// host:port or as a URL. The chain expires with its first certificate.
+func TLSEndpoint(name, addr string) (Check, error) {
+	hostport := addr
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return Check{}, fmt.Errorf("invalid endpoint %q: %w", addr, err)
+		}
+		port, ok := defaultTLSPorts[u.Scheme]
+		if !ok {
+			return Check{}, fmt.Errorf("endpoint %q does not use TLS", addr)
+		}
+		if u.Port() != "" {
+			port = u.Port()
+		}
+		hostport = net.JoinHostPort(u.Hostname(), port)
+	}
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return Check{}, fmt.Errorf("invalid endpoint %q: %w", addr, err)
+	}
+
+	return Check{
+		Name: name,
+		Kind: KindTLS,
+		Expiry: func(ctx context.Context) (time.Time, error) {
+			dialer := &tls.Dialer{Config: &tls.Config{
+				ServerName: host,
+				// Only the dates are read: an expired or otherwise invalid
+				// certificate must still be reported
+				InsecureSkipVerify: true,
+			}}
+			conn, err := dialer.DialContext(ctx, "tcp", hostport)
+			if err != nil {
+				return time.Time{}, err
+			}
+			defer conn.Close()
+			return chainExpiry(conn.(*tls.Conn).ConnectionState().PeerCertificates)
+		},
+	}, nil
+}
+
+// CertFile watches the certificates of a PEM file
+func CertFile(name, path string) Check {
+	return Check{
+		Name: name,
+		Kind: KindCertFile,
+		Expiry: func(ctx context.Context) (time.Time, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return time.Time{}, err
+			}
+			var certs []*x509.Certificate
+			for {
+				var block *pem.Block
+				block, data = pem.Decode(data)
+				if block == nil {
+					break
+				}
+				if block.Type != "CERTIFICATE" {
+					continue
+				}
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return time.Time{}, fmt.Errorf("invalid certificate in %s: %w", path, err)
+				}
+				certs = append(certs, cert)
+			}
+			return chainExpiry(certs)
+		},
+	}
+}
+
+// chainExpiry returns when the first certificate of a chain expires
+func chainExpiry(certs []*x509.Certificate) (time.Time, error) {
+	if len(certs) == 0 {
+		return time.Time{}, fmt.Errorf("no certificate found")
+	}
+	expiry := certs[0].NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	return expiry, nil
+}
+
+// FacebookToken watches a Graph API access token through debug_token
+// introspection. graphURL is the versioned API root, e.g.
+// https://graph.facebook.com/v22.0. An invalidated token, e.g. after a
+// password change, reports as expired.
+func FacebookToken(name, graphURL, token string, client *http.Client) Check {
+	if client == nil {
+		client = &http.Client{Timeout: checkTimeout}
+	}
+	return Check{
+		Name: name,
+		Kind: KindFacebookToken,
+		Expiry: func(ctx context.Context) (time.Time, error) {
+			query := url.Values{"input_token": {token}, "access_token": {token}}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(graphURL, "/")+"/debug_token?"+query.Encode(), nil)
+			if err != nil {
+				return time.Time{}, err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("debug_token request failed: %w", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+			var result struct {
+				Data struct {
+					IsValid   bool  `json:"is_valid"`
+					ExpiresAt int64 `json:"expires_at"` // 0 for tokens that do not expire
+				} `json:"data"`
+				Error *struct {
+					Message string `json:"message"`
+					Code    int    `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(body, &result); err != nil {
+				return time.Time{}, fmt.Errorf("invalid debug_token response (status %d)", resp.StatusCode)
+			}
+			if result.Error != nil {
+				// Code 190 is Graph's invalid or expired access token
+				if result.Error.Code == 190 {
+					return time.Now(), nil
+				}
+				return time.Time{}, fmt.Errorf("debug_token failed: %s", result.Error.Message)
+			}
+			if !result.Data.IsValid {
+				if expires := time.Unix(result.Data.ExpiresAt, 0); result.Data.ExpiresAt > 0 && expires.Before(time.Now()) {
+					return expires, nil
+				}
+				return time.Now(), nil
+			}
+			if result.Data.ExpiresAt == 0 {
+				return time.Time{}, nil
+			}
+			return time.Unix(result.Data.ExpiresAt, 0), nil
+		},
+	}
+}
+
+// OAuthLogin watches the stored OAuth login of provider. Access tokens
+// that come with a refresh token are renewed when used and do not expire;
+// the others expire with the access token.
+func OAuthLogin(provider string) Check {
+	return Check{
+		Name: provider + " login",
+		Kind: KindOAuth,
+		Expiry: func(ctx context.Context) (time.Time, error) {
+			cred, err := auth.GetCredential(provider)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if cred == nil {
+				return time.Time{}, fmt.Errorf("not logged in")
+			}
+			if cred.RefreshToken != "" {
+				return time.Time{}, nil
+			}
+			return cred.ExpiresAt, nil
+		},
+	}
+}
@@ -0,0 +1,280 @@
+// Package expiry watches certificates and access tokens and warns before
+// they lapse. An expired Graph API token or bridge certificate fails
+// silently from the chat's point of view: messages just stop flowing.
+package expiry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	defaultWarnDays = 14
+	defaultInterval = 12 * time.Hour
+	// checkTimeout bounds a single check
+	checkTimeout = 30 * time.Second
+)
+
+// States of a watched certificate or token
+const (
+	StateOK       = "ok"
+	StateExpiring = "expiring" // Within the warning window
+	StateExpired  = "expired"
+	StateError    = "error" // The expiry could not be determined
+	StatePending  = "pending"
+)
+
+// Check reports when one certificate or token expires. A zero time with a
+// nil error means it does not expire.
+type Check struct {
+	Name   string // e.g. "whatsapp bridge"
+	Kind   string // e.g. "tls", "facebook_token", "oauth"
+	Expiry func(ctx context.Context) (time.Time, error)
+}
+
+// Status is the last result of a check
+type Status struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	State     string    `json:"state"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	DaysLeft  int       `json:"days_left,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+}
+
+// Monitor runs its checks on a schedule and alerts through notify when a
+// certificate or token enters the warning window, has a day left, and when
+// it has expired. Alerts are remembered in memory only, so a restart repeats
+// the latest one.
+type Monitor struct {
+	checks   []Check
+	warn     time.Duration
+	interval time.Duration
+	notify   func(content string)
+
+	mu       sync.Mutex
+	statuses map[string]Status
+	alerted  map[string]string // Check name -> last alert stage
+	now      func() time.Time
+}
+
+// NewMonitor creates a monitor warning warnDays before expiry and checking
+// every interval; zero values select the defaults
+func NewMonitor(warnDays int, interval time.Duration, notify func(content string)) *Monitor {
+	if warnDays <= 0 {
+		warnDays = defaultWarnDays
+	}
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Monitor{
+		warn:     time.Duration(warnDays) * 24 * time.Hour,
+		interval: interval,
+		notify:   notify,
+		statuses: make(map[string]Status),
+		alerted:  make(map[string]string),
+		now:      time.Now,
+	}
+}
+
+// Add registers a check. Checks must be added before Run.
+func (m *Monitor) Add(check Check) {
+	m.checks = append(m.checks, check)
+	m.mu.Lock()
+	m.statuses[check.Name] = Status{Name: check.Name, Kind: check.Kind, State: StatePending}
+	m.mu.Unlock()
+}
+
+// Len returns the number of registered checks
+func (m *Monitor) Len() int {
+	return len(m.checks)
+}
+
+// Run checks now and then every interval until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll runs every check once and sends the alerts due
+func (m *Monitor) CheckAll(ctx context.Context) {
+	for _, check := range m.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		expiresAt, err := check.Expiry(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		m.record(check, expiresAt, err)
+	}
+}
+
+// record stores the result of a check and alerts if it reached a new stage
+func (m *Monitor) record(check Check, expiresAt time.Time, err error) {
+	now := m.now()
+	status := Status{Name: check.Name, Kind: check.Kind, State: StateOK, ExpiresAt: expiresAt, CheckedAt: now}
+	switch {
+	case err != nil:
+		status.State = StateError
+		status.Error = err.Error()
+		logger.WarnCF("expiry", "Expiry check failed", map[string]interface{}{
+			"name":  check.Name,
+			"error": err.Error(),
+		})
+	case expiresAt.IsZero():
+	case !expiresAt.After(now):
+		status.State = StateExpired
+	default:
+		status.DaysLeft = int(expiresAt.Sub(now).Hours() / 24)
+		if expiresAt.Sub(now) <= m.warn {
+			status.State = StateExpiring
+		}
+	}
+
+	m.mu.Lock()
+	m.statuses[check.Name] = status
+	if status.State == StateError {
+		// The certificate or token may well be fine: keep quiet and
+		// remember the alerts already sent
+		m.mu.Unlock()
+		return
+	}
+	stage := alertStage(status)
+	previous := m.alerted[check.Name]
+	if stage == "" {
+		delete(m.alerted, check.Name)
+	} else {
+		m.alerted[check.Name] = stage
+	}
+	m.mu.Unlock()
+
+	if stage != "" && stage != previous && m.notify != nil {
+		logger.InfoCF("expiry", "Sending expiry alert", map[string]interface{}{
+			"name":  check.Name,
+			"state": status.State,
+		})
+		m.notify(alertMessage(status))
+	}
+}
+
+// alertStage identifies the alert due for status, or "" for none
+func alertStage(status Status) string {
+	switch {
+	case status.State == StateExpired:
+		return "expired"
+	case status.State == StateExpiring && status.DaysLeft < 1:
+		return "last-day"
+	case status.State == StateExpiring:
+		return "warning"
+	}
+	return ""
+}
+
+// alertMessage is the owner chat alert for status
+func alertMessage(status Status) string {
+	if status.State == StateExpired {
+		return fmt.Sprintf("⚠️ The %s (%s) expired on %s. Renew it to restore service.",
+			status.Name, kindName(status.Kind), status.ExpiresAt.Format("Jan 2 15:04 MST"))
+	}
+	left := fmt.Sprintf("%d days", status.DaysLeft)
+	if status.DaysLeft < 1 {
+		left = "less than a day"
+	} else if status.DaysLeft == 1 {
+		left = "1 day"
+	}
+	return fmt.Sprintf("⚠️ The %s (%s) expires in %s, on %s. Renew it before then.",
+		status.Name, kindName(status.Kind), left, status.ExpiresAt.Format("Jan 2 15:04 MST"))
+}
+
+// kindName describes a check kind for people
+func kindName(kind string) string {
+	switch kind {
+	case KindTLS, KindCertFile:
+		return "TLS certificate"
+	case KindFacebookToken:
+		return "Graph API access token"
+	case KindOAuth:
+		return "OAuth login"
+	}
+	return kind
+}
+
+// Statuses returns the last result of every check, soonest expiry first
+func (m *Monitor) Statuses() []Status {
+	m.mu.Lock()
+	statuses := make([]Status, 0, len(m.statuses))
+	for _, status := range m.statuses {
+		statuses = append(statuses, status)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.ExpiresAt.IsZero() != b.ExpiresAt.IsZero() {
+			return b.ExpiresAt.IsZero()
+		}
+		if !a.ExpiresAt.Equal(b.ExpiresAt) {
+			return a.ExpiresAt.Before(b.ExpiresAt)
+		}
+		return a.Name < b.Name
+	})
+	return statuses
+}
+
+// Summary describes every check for the /admin expiry command
+func (m *Monitor) Summary() string {
+	statuses := m.Statuses()
+	if len(statuses) == 0 {
+		return "Nothing to watch: no certificates or tokens configured"
+	}
+	var b strings.Builder
+	b.WriteString("Expiry:")
+	for _, status := range statuses {
+		fmt.Fprintf(&b, "\n- %s: ", status.Name)
+		switch status.State {
+		case StateError:
+			fmt.Fprintf(&b, "check failed (%s)", status.Error)
+		case StatePending:
+			b.WriteString("not checked yet")
+		case StateExpired:
+			fmt.Fprintf(&b, "EXPIRED on %s", status.ExpiresAt.Format("2006-01-02"))
+		default:
+			if status.ExpiresAt.IsZero() {
+				b.WriteString("does not expire")
+				continue
+			}
+			fmt.Fprintf(&b, "%d days left (%s)", status.DaysLeft, status.ExpiresAt.Format("2006-01-02"))
+			if status.State == StateExpiring {
+				b.WriteString(" ⚠️")
+			}
+		}
+	}
+	return b.String()
+}
+
+// ServeHTTP serves the statuses as JSON for /admin/expiry
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"checks": m.Statuses()})
+}
@@ -0,0 +1,166 @@
+package expiry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorAlerts(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var alerts []string
+	m := NewMonitor(14, 0, func(content string) { alerts = append(alerts, content) })
+	m.now = func() time.Time { return now }
+
+	expires := now.Add(30 * 24 * time.Hour)
+	var checkErr error
+	m.Add(Check{Name: "bridge", Kind: KindTLS, Expiry: func(ctx context.Context) (time.Time, error) { return expires, checkErr }})
+	m.Add(Check{Name: "token", Kind: KindFacebookToken, Expiry: func(ctx context.Context) (time.Time, error) { return time.Time{}, nil }})
+
+	step := func(advance time.Duration, wantAlerts int) {
+		t.Helper()
+		now = now.Add(advance)
+		m.CheckAll(context.Background())
+		if len(alerts) != wantAlerts {
+			t.Fatalf("after %v: %d alerts, want %d: %q", advance, len(alerts), wantAlerts, alerts)
+		}
+	}
+
+	step(0, 0)
+	step(20*24*time.Hour, 1) // 10 days left
+	if !strings.Contains(alerts[0], "bridge (TLS certificate) expires in 10 days") {
+		t.Errorf("unexpected alert %q", alerts[0])
+	}
+	step(24*time.Hour, 1) // Still in the same stage
+
+	// A failing check keeps quiet and does not reset the stage
+	checkErr = errors.New("connection refused")
+	step(time.Hour, 1)
+	checkErr = nil
+	step(time.Hour, 1)
+
+	step(8*24*time.Hour+12*time.Hour, 2) // Last day
+	step(12*time.Hour, 3)                // Expired
+	if !strings.Contains(alerts[2], "expired") {
+		t.Errorf("unexpected alert %q", alerts[2])
+	}
+
+	// Renewal resets the stages
+	expires = now.Add(90 * 24 * time.Hour)
+	step(time.Hour, 3)
+	expires = now.Add(5 * 24 * time.Hour)
+	step(time.Hour, 4)
+
+	statuses := m.Statuses()
+	if len(statuses) != 2 || statuses[0].Name != "bridge" || statuses[0].State != StateExpiring || statuses[1].State != StateOK {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+	if summary := m.Summary(); !strings.Contains(summary, "bridge: 4 days left") || !strings.Contains(summary, "token: does not expire") {
+		t.Errorf("unexpected summary %q", summary)
+	}
+}
+
+// writeTestCert writes a self-signed certificate valid until notAfter
+func writeTestCert(t *testing.T, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "picoclaw.test"},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCertFile(t *testing.T) {
+	notAfter := time.Now().Add(10 * 24 * time.Hour).Truncate(time.Second)
+	got, err := CertFile("proxy", writeTestCert(t, notAfter)).Expiry(context.Background())
+	if err != nil || !got.Equal(notAfter) {
+		t.Errorf("Expiry() = %v, %v, want %v", got, err, notAfter)
+	}
+	if _, err := CertFile("missing", filepath.Join(t.TempDir(), "none.pem")).Expiry(context.Background()); err == nil {
+		t.Error("missing file should fail")
+	}
+}
+
+func TestTLSEndpoint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	check, err := TLSEndpoint("gateway", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := check.Expiry(context.Background())
+	if err != nil || !got.Equal(server.Certificate().NotAfter) {
+		t.Errorf("Expiry() = %v, %v, want %v", got, err, server.Certificate().NotAfter)
+	}
+
+	for _, addr := range []string{"ws://bridge.local", "bridge.local", "http://bridge.local"} {
+		if _, err := TLSEndpoint("bad", addr); err == nil {
+			t.Errorf("%q: expected an error", addr)
+		}
+	}
+	if _, err := TLSEndpoint("bridge", "wss://bridge.local/ws"); err != nil {
+		t.Errorf("wss URL: %v", err)
+	}
+}
+
+func TestFacebookToken(t *testing.T) {
+	var response string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v22.0/debug_token" || r.URL.Query().Get("input_token") != "EAAB" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		io.WriteString(w, response)
+	}))
+	defer server.Close()
+	check := FacebookToken("graph", server.URL+"/v22.0", "EAAB", nil)
+
+	response = `{"data":{"is_valid":true,"expires_at":1900000000}}`
+	if got, err := check.Expiry(context.Background()); err != nil || got.Unix() != 1900000000 {
+		t.Errorf("Expiry() = %v, %v", got, err)
+	}
+	response = `{"data":{"is_valid":true,"expires_at":0}}`
+	if got, err := check.Expiry(context.Background()); err != nil || !got.IsZero() {
+		t.Errorf("non-expiring token: %v, %v", got, err)
+	}
+	response = `{"data":{"is_valid":false,"expires_at":1900000000}}`
+	if got, err := check.Expiry(context.Background()); err != nil || got.After(time.Now()) {
+		t.Errorf("invalidated token: %v, %v", got, err)
+	}
+	response = `{"error":{"message":"Error validating access token: Session has expired","code":190}}`
+	if got, err := check.Expiry(context.Background()); err != nil || got.After(time.Now()) {
+		t.Errorf("expired token: %v, %v", got, err)
+	}
+	response = `{"error":{"message":"Application request limit reached","code":4}}`
+	if _, err := check.Expiry(context.Background()); err == nil {
+		t.Error("rate limit should fail the check")
+	}
+}
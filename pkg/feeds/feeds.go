@@ -0,0 +1,216 @@
+// Package feeds reads RSS and Atom feeds for scheduled digests.
+package feeds
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxFeedSize bounds the feed documents read
+	maxFeedSize = 4 << 20
+	// defaultMaxItems is the number of items listed per feed by default
+	defaultMaxItems = 10
+	// firstRunWindow is how far back the first run of a job looks
+	firstRunWindow = 24 * time.Hour
+)
+
+// Item is an entry of an RSS or Atom feed
+type Item struct {
+	Title     string
+	Link      string
+	Published time.Time
+}
+
+// Unread lists the items published since the previous run of a job, which
+// are the ones its reader has not seen yet. It is a context provider for
+// scheduled digests.
+type Unread struct {
+	urls     []string
+	maxItems int
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewUnread creates a provider for the feeds at urls that lists up to
+// maxItems items per feed; 0 or less uses the default of 10
+func NewUnread(urls []string, maxItems int) *Unread {
+	if maxItems <= 0 {
+		maxItems = defaultMaxItems
+	}
+	return &Unread{
+		urls:     urls,
+		maxItems: maxItems,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}
+}
+
+// Context returns the unread items, newest first, one per line. On a job's
+// first run the items of the last day are listed.
+func (u *Unread) Context(ctx context.Context, since time.Time) (string, error) {
+	if since.IsZero() {
+		since = u.now().Add(-firstRunWindow)
+	}
+
+	var b strings.Builder
+	var failed []string
+	for _, url := range u.urls {
+		title, items, err := u.fetch(ctx, url)
+		if err != nil {
+			// One broken feed should not hide the others
+			failed = append(failed, fmt.Sprintf("%s: %v", url, err))
+			continue
+		}
+
+		var unread []Item
+		for _, item := range items {
+			if item.Published.After(since) {
+				unread = append(unread, item)
+			}
+		}
+		if len(unread) == 0 {
+			continue
+		}
+		sort.SliceStable(unread, func(i, j int) bool { return unread[i].Published.After(unread[j].Published) })
+		if len(unread) > u.maxItems {
+			unread = unread[:u.maxItems]
+		}
+
+		fmt.Fprintf(&b, "%s:\n", title)
+		for _, item := range unread {
+			fmt.Fprintf(&b, "- %s (%s)\n", item.Title, item.Link)
+		}
+	}
+
+	if len(failed) == len(u.urls) && len(failed) > 0 {
+		return "", fmt.Errorf("failed to fetch feeds: %s", strings.Join(failed, "; "))
+	}
+	for _, f := range failed {
+		fmt.Fprintf(&b, "(failed to fetch %s)\n", f)
+	}
+	if b.Len() == 0 {
+		return "No unread items", nil
+	}
+	return b.String(), nil
+}
+
+func (u *Unread) fetch(ctx context.Context, url string) (string, []Item, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	title, items, err := Parse(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return "", nil, err
+	}
+	if title == "" {
+		title = url
+	}
+	return title, items, nil
+}
+
+// document holds the parts of RSS 2.0 and Atom documents that are read
+type document struct {
+	XMLName xml.Name
+	// RSS
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title   string `xml:"title"`
+			Link    string `xml:"link"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+	// Atom
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// Parse reads the title and items of an RSS 2.0 or Atom feed. Items without
+// a readable date are skipped.
+func Parse(r io.Reader) (string, []Item, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return "", nil, fmt.Errorf("invalid feed: %w", err)
+	}
+
+	var items []Item
+	switch doc.XMLName.Local {
+	case "rss":
+		for _, it := range doc.Channel.Items {
+			published, err := parseDate(it.PubDate)
+			if err != nil {
+				continue
+			}
+			items = append(items, Item{Title: strings.TrimSpace(it.Title), Link: strings.TrimSpace(it.Link), Published: published})
+		}
+		return strings.TrimSpace(doc.Channel.Title), items, nil
+
+	case "feed":
+		for _, entry := range doc.Entries {
+			date := entry.Published
+			if date == "" {
+				date = entry.Updated
+			}
+			published, err := parseDate(date)
+			if err != nil {
+				continue
+			}
+			item := Item{Title: strings.TrimSpace(entry.Title), Published: published}
+			for _, link := range entry.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					item.Link = link.Href
+					break
+				}
+			}
+			items = append(items, item)
+		}
+		return strings.TrimSpace(doc.Title), items, nil
+	}
+	return "", nil, fmt.Errorf("unsupported feed format %q", doc.XMLName.Local)
+}
+
+// dateLayouts are the date formats found in the wild, RFC 822 variants for
+// RSS and RFC 3339 for Atom
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+}
+
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %q", s)
+}
@@ -0,0 +1,83 @@
+package feeds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Tech News</title>
+<item><title>Old story</title><link>https://example.org/old</link><pubDate>Sat, 28 Feb 2026 06:00:00 +0000</pubDate></item>
+<item><title>New story</title><link>https://example.org/new</link><pubDate>Sun, 01 Mar 2026 07:00:00 +0000</pubDate></item>
+<item><title>Newer story</title><link>https://example.org/newer</link><pubDate>Sun, 1 Mar 2026 07:30:00 GMT</pubDate></item>
+<item><title>Undated</title><link>https://example.org/undated</link></item>
+</channel></rss>`
+
+const testAtom = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Project Blog</title>
+<entry><title>Release 2.0</title><link rel="alternate" href="https://blog.example.org/2.0"/><updated>2026-03-01T05:00:00Z</updated></entry>
+</feed>`
+
+func TestParse(t *testing.T) {
+	title, items, err := Parse(strings.NewReader(testRSS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Tech News" || len(items) != 3 {
+		t.Fatalf("Parse(rss) = %q, %+v", title, items)
+	}
+
+	title, items, err = Parse(strings.NewReader(testAtom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Project Blog" || len(items) != 1 || items[0].Link != "https://blog.example.org/2.0" {
+		t.Fatalf("Parse(atom) = %q, %+v", title, items)
+	}
+
+	if _, _, err := Parse(strings.NewReader(`<html></html>`)); err == nil {
+		t.Error("expected an error for a document that is not a feed")
+	}
+}
+
+func TestUnreadContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rss":
+			w.Write([]byte(testRSS))
+		case "/atom":
+			w.Write([]byte(testAtom))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	unread := NewUnread([]string{srv.URL + "/rss", srv.URL + "/atom", srv.URL + "/gone"}, 1)
+	since := time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)
+	got, err := unread.Context(context.Background(), since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Tech News:\n- Newer story (https://example.org/newer)\n" +
+		"(failed to fetch " + srv.URL + "/gone: HTTP 404)\n"
+	if got != want {
+		t.Errorf("Context() = %q, want %q", got, want)
+	}
+
+	// The first run looks back a day
+	unread = NewUnread([]string{srv.URL + "/atom"}, 0)
+	unread.now = func() time.Time { return time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC) }
+	if got, _ := unread.Context(context.Background(), time.Time{}); !strings.Contains(got, "Release 2.0") {
+		t.Errorf("first run = %q", got)
+	}
+
+	unread = NewUnread([]string{srv.URL + "/gone"}, 0)
+	if _, err := unread.Context(context.Background(), since); err == nil {
+		t.Error("expected an error when every feed fails")
+	}
+}
@@ -0,0 +1,134 @@
+// Package format converts the Markdown written by the model to the native
+// markup of each channel.
+package format
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Style is the markup a channel renders
+type Style string
+
+const (
+	Markdown     Style = "markdown"      // Sent unchanged
+	WhatsApp     Style = "whatsapp"      // *bold*, _italic_, ~strike~, ```code```
+	TelegramHTML Style = "telegram_html" // Telegram's HTML parse mode
+	Slack        Style = "slack"         // Slack mrkdwn: WhatsApp markup with <url|text> links
+	HTML         Style = "html"          // HTML, as Matrix renders
+	Plain        Style = "plain"         // No markup at all
+)
+
+// ParseStyle returns the style named name, or def when name is empty
+func ParseStyle(name string, def Style) (Style, error) {
+	if name == "" {
+		return def, nil
+	}
+	switch style := Style(strings.ToLower(name)); style {
+	case Markdown, WhatsApp, TelegramHTML, Slack, HTML, Plain:
+		return style, nil
+	}
+	return def, fmt.Errorf("unknown format %q (want markdown, whatsapp, telegram_html, slack, html or plain)", name)
+}
+
+// Convert converts Markdown text to style
+func Convert(text string, style Style) string {
+	switch style {
+	case WhatsApp:
+		return ToWhatsApp(text)
+	case TelegramHTML:
+		return ToTelegramHTML(text)
+	case Slack:
+		return ToSlack(text)
+	case HTML:
+		return ToHTML(text)
+	case Plain:
+		return ToPlain(text)
+	default:
+		return text
+	}
+}
+
+var (
+	reHeading     = regexp.MustCompile(`(?m)^#{1,6}\s+(.+?)\s*#*$`)
+	reBullet      = regexp.MustCompile(`(?m)^(\s*)[-*+]\s+`)
+	reLink        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	reBoldStars   = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	reBoldUnder   = regexp.MustCompile(`__(.+?)__`)
+	reItalicStar  = regexp.MustCompile(`\*([^*\n]+)\*`)
+	reItalicUnder = regexp.MustCompile(`\b_([^_\n]+)_\b`)
+	reStrike      = regexp.MustCompile(`~~(.+?)~~`)
+)
+
+// formatLink renders a link as "text (url)", or just the URL when the text
+// repeats it
+func formatLink(text string) string {
+	return reLink.ReplaceAllStringFunc(text, func(s string) string {
+		m := reLink.FindStringSubmatch(s)
+		if m[1] == m[2] {
+			return m[2]
+		}
+		return m[1] + " (" + m[2] + ")"
+	})
+}
+
+// restoreCode puts the code removed by extractCodeBlocks and
+// extractInlineCodes back, rendered by block and inline
+func restoreCode(text string, blocks codeBlockMatch, inline inlineCodeMatch, block, span func(string) string) string {
+	for i, code := range inline.codes {
+		text = strings.ReplaceAll(text, fmt.Sprintf("\x00IC%d\x00", i), span(code))
+	}
+	for i, code := range blocks.codes {
+		text = strings.ReplaceAll(text, fmt.Sprintf("\x00CB%d\x00", i), block(code))
+	}
+	return text
+}
+
+type codeBlockMatch struct {
+	text  string
+	codes []string
+}
+
+func extractCodeBlocks(text string) codeBlockMatch {
+	re := regexp.MustCompile("```[\\w]*\\n?([\\s\\S]*?)```")
+	matches := re.FindAllStringSubmatch(text, -1)
+
+	codes := make([]string, 0, len(matches))
+	for _, match := range matches {
+		codes = append(codes, match[1])
+	}
+
+	i := 0
+	text = re.ReplaceAllStringFunc(text, func(m string) string {
+		placeholder := fmt.Sprintf("\x00CB%d\x00", i)
+		i++
+		return placeholder
+	})
+
+	return codeBlockMatch{text: text, codes: codes}
+}
+
+type inlineCodeMatch struct {
+	text  string
+	codes []string
+}
+
+func extractInlineCodes(text string) inlineCodeMatch {
+	re := regexp.MustCompile("`([^`]+)`")
+	matches := re.FindAllStringSubmatch(text, -1)
+
+	codes := make([]string, 0, len(matches))
+	for _, match := range matches {
+		codes = append(codes, match[1])
+	}
+
+	i := 0
+	text = re.ReplaceAllStringFunc(text, func(m string) string {
+		placeholder := fmt.Sprintf("\x00IC%d\x00", i)
+		i++
+		return placeholder
+	})
+
+	return inlineCodeMatch{text: text, codes: codes}
+}
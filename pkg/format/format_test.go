@@ -0,0 +1,129 @@
+package format
+
+import "testing"
+
+func TestToWhatsApp(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"bold", "This is **important**", "This is *important*"},
+		{"bold underscores", "This is __important__", "This is *important*"},
+		{"italic", "This is *subtle*", "This is _subtle_"},
+		{"bold and italic", "**Note:** *maybe*", "*Note:* _maybe_"},
+		{"strikethrough", "~~old~~ new", "~old~ new"},
+		{"heading", "## Summary\nDone", "*Summary*\nDone"},
+		{"bold heading", "# **Summary**", "*Summary*"},
+		{"bullets", "- one\n* two\n  + nested", "• one\n• two\n  • nested"},
+		{"link", "[docs](https://example.com)", "docs (https://example.com)"},
+		{"bare link", "[https://example.com](https://example.com)", "https://example.com"},
+		{"inline code untouched", "run `**x**` now", "run `**x**` now"},
+		{"code block language dropped", "```go\nx := **y**\n```", "```\nx := **y**\n```"},
+		{"snake case untouched", "set max_idle_conns", "set max_idle_conns"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToWhatsApp(tt.in); got != tt.want {
+				t.Errorf("ToWhatsApp(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToSlack(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"emphasis", "**bold**, *italic* and ~~gone~~", "*bold*, _italic_ and ~gone~"},
+		{"heading and list", "# Title\n- item", "*Title*\n• item"},
+		{"link", "see [docs](https://example.com/?a=1&b=2)", "see <https://example.com/?a=1&amp;b=2|docs>"},
+		{"bare link", "[https://example.com](https://example.com)", "<https://example.com>"},
+		{"escaping", "a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{"code", "`x<y` and ```go\n**a**\n```", "`x&lt;y` and ```\n**a**\n```"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToSlack(tt.in); got != tt.want {
+				t.Errorf("ToSlack(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToPlain(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"emphasis", "**bold**, *italic*, _also_ and ~~gone~~", "bold, italic, also and gone"},
+		{"heading and list", "# Title\n- item", "Title\n• item"},
+		{"link", "see [docs](https://example.com)", "see docs (https://example.com)"},
+		{"code", "`x` and ```sh\nls\n```", "x and ls\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToPlain(tt.in); got != tt.want {
+				t.Errorf("ToPlain(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"emphasis", "**bold**, *italic* and ~~gone~~", "<b>bold</b>, <i>italic</i> and <del>gone</del>"},
+		{"heading and list", "# Title\n- item", "<b>Title</b><br>• item"},
+		{"link", "[docs](https://example.com/?a=1&b=2)", `<a href="https://example.com/?a=1&amp;b=2">docs</a>`},
+		{"escaped", "1 < 2 & **<b>**", "1 &lt; 2 &amp; <b>&lt;b&gt;</b>"},
+		{"code keeps line breaks", "run:\n```sh\nls <dir>\nexit\n```", "run:<br><pre><code>ls &lt;dir&gt;\nexit\n</code></pre>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToHTML(tt.in); got != tt.want {
+				t.Errorf("ToHTML(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Style
+		wantErr bool
+	}{
+		{"", WhatsApp, false},
+		{"plain", Plain, false},
+		{"Telegram_HTML", TelegramHTML, false},
+		{"slack", Slack, false},
+		{"HTML", HTML, false},
+		{"rtf", WhatsApp, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseStyle(tt.name, WhatsApp)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseStyle(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestConvertTelegramHTML(t *testing.T) {
+	got := Convert("**a** <b> `c`", TelegramHTML)
+	want := "<b>a</b> &lt;b&gt; <code>c</code>"
+	if got != want {
+		t.Errorf("Convert() = %q, want %q", got, want)
+	}
+}
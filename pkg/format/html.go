@@ -0,0 +1,33 @@
+package format
+
+import "strings"
+
+// ToHTML converts Markdown to HTML for channels that render it, such as
+// Matrix. Line breaks become <br> outside code blocks.
+func ToHTML(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	blocks := extractCodeBlocks(text)
+	inline := extractInlineCodes(blocks.text)
+	text = escapeHTML(inline.text)
+
+	text = reHeading.ReplaceAllString(text, "<b>$1</b>")
+	text = reBullet.ReplaceAllString(text, "$1• ")
+	text = reLink.ReplaceAllStringFunc(text, func(s string) string {
+		m := reLink.FindStringSubmatch(s)
+		return `<a href="` + strings.ReplaceAll(m[2], `"`, "%22") + `">` + m[1] + "</a>"
+	})
+
+	text = reBoldStars.ReplaceAllString(text, "<b>$1</b>")
+	text = reBoldUnder.ReplaceAllString(text, "<b>$1</b>")
+	text = reItalicStar.ReplaceAllString(text, "<i>$1</i>")
+	text = reItalicUnder.ReplaceAllString(text, "<i>$1</i>")
+	text = reStrike.ReplaceAllString(text, "<del>$1</del>")
+	text = strings.ReplaceAll(text, "\n", "<br>")
+
+	return restoreCode(text, blocks, inline,
+		func(code string) string { return "<pre><code>" + escapeHTML(code) + "</code></pre>" },
+		func(code string) string { return "<code>" + escapeHTML(code) + "</code>" })
+}
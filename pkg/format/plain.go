@@ -0,0 +1,27 @@
+package format
+
+// ToPlain removes Markdown markup, keeping the text readable where the
+// channel renders none
+func ToPlain(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	blocks := extractCodeBlocks(text)
+	inline := extractInlineCodes(blocks.text)
+	text = inline.text
+
+	text = reHeading.ReplaceAllString(text, "$1")
+	text = reBullet.ReplaceAllString(text, "$1• ")
+	text = formatLink(text)
+
+	text = reBoldStars.ReplaceAllString(text, "$1")
+	text = reBoldUnder.ReplaceAllString(text, "$1")
+	text = reItalicStar.ReplaceAllString(text, "$1")
+	text = reItalicUnder.ReplaceAllString(text, "$1")
+	text = reStrike.ReplaceAllString(text, "$1")
+
+	return restoreCode(text, blocks, inline,
+		func(code string) string { return code },
+		func(code string) string { return code })
+}
@@ -0,0 +1,46 @@
+package format
+
+import "strings"
+
+// ToSlack converts Markdown to Slack mrkdwn. It is WhatsApp markup with
+// links written as <url|text> and &, < and > escaped, as Slack requires.
+func ToSlack(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	blocks := extractCodeBlocks(text)
+	inline := extractInlineCodes(blocks.text)
+	text = escapeSlack(inline.text)
+
+	text = reHeading.ReplaceAllStringFunc(text, func(s string) string {
+		title := reHeading.FindStringSubmatch(s)[1]
+		title = strings.ReplaceAll(title, "**", "")
+		return boldMark + title + boldMark
+	})
+	text = reBullet.ReplaceAllString(text, "$1• ")
+	text = reLink.ReplaceAllStringFunc(text, func(s string) string {
+		m := reLink.FindStringSubmatch(s)
+		if m[1] == m[2] {
+			return "<" + m[2] + ">"
+		}
+		return "<" + m[2] + "|" + m[1] + ">"
+	})
+
+	text = reBoldStars.ReplaceAllString(text, boldMark+"$1"+boldMark)
+	text = reBoldUnder.ReplaceAllString(text, boldMark+"$1"+boldMark)
+	text = reItalicStar.ReplaceAllString(text, "_${1}_")
+	text = strings.ReplaceAll(text, boldMark, "*")
+	text = reStrike.ReplaceAllString(text, "~$1~")
+
+	return restoreCode(text, blocks, inline,
+		func(code string) string { return "```\n" + escapeSlack(code) + "```" },
+		func(code string) string { return "`" + escapeSlack(code) + "`" })
+}
+
+func escapeSlack(text string) string {
+	text = strings.ReplaceAll(text, "&", "&amp;")
+	text = strings.ReplaceAll(text, "<", "&lt;")
+	text = strings.ReplaceAll(text, ">", "&gt;")
+	return text
+}
@@ -0,0 +1,37 @@
+package format
+
+import "strings"
+
+// boldMark stands in for converted bold text while italics are rewritten
+const boldMark = "\x00B"
+
+// ToWhatsApp converts Markdown to WhatsApp markup. Headings become bold
+// lines, list markers become bullets and links show their URL; code blocks
+// keep their fences but lose the language, which WhatsApp would print.
+func ToWhatsApp(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	blocks := extractCodeBlocks(text)
+	inline := extractInlineCodes(blocks.text)
+	text = inline.text
+
+	text = reHeading.ReplaceAllStringFunc(text, func(s string) string {
+		title := reHeading.FindStringSubmatch(s)[1]
+		title = strings.ReplaceAll(title, "**", "")
+		return boldMark + title + boldMark
+	})
+	text = reBullet.ReplaceAllString(text, "$1• ")
+	text = formatLink(text)
+
+	text = reBoldStars.ReplaceAllString(text, boldMark+"$1"+boldMark)
+	text = reBoldUnder.ReplaceAllString(text, boldMark+"$1"+boldMark)
+	text = reItalicStar.ReplaceAllString(text, "_${1}_")
+	text = strings.ReplaceAll(text, boldMark, "*")
+	text = reStrike.ReplaceAllString(text, "~$1~")
+
+	return restoreCode(text, blocks, inline,
+		func(code string) string { return "```\n" + code + "```" },
+		func(code string) string { return "`" + code + "`" })
+}
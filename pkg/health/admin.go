@@ -0,0 +1,33 @@
+package health
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// SetAdminToken sets the bearer token of the handlers registered with
+// HandleAdmin. It must be called before Start.
+func (s *Server) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
+// HandleAdmin registers a handler that only answers requests carrying the
+// admin token as "Authorization: Bearer <token>". Without an admin token
+// every request is refused, so admin endpoints are never open on the
+// public listener.
+func (s *Server) HandleAdmin(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, requireToken(&s.adminToken, handler))
+}
+
+func requireToken(token *string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if *token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(*token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,45 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleAdmin(t *testing.T) {
+	s := NewServer("127.0.0.1", 0)
+	s.HandleAdmin("/admin/dead-letters/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func(method, auth string) int {
+		req := httptest.NewRequest(method, "/admin/dead-letters/retry?id=all", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Without an admin token nothing gets through
+	for _, auth := range []string{"", "Bearer ", "Bearer anything"} {
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			if code := do(method, auth); code != http.StatusUnauthorized {
+				t.Errorf("no token, %s %q = %d, want 401", method, auth, code)
+			}
+		}
+	}
+
+	s.SetAdminToken("s3cret")
+	for _, auth := range []string{"", "Bearer wrong", "s3cret", "Basic s3cret"} {
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			if code := do(method, auth); code != http.StatusUnauthorized {
+				t.Errorf("%s %q = %d, want 401", method, auth, code)
+			}
+		}
+	}
+	if code := do(http.MethodPost, "Bearer s3cret"); code != http.StatusNoContent {
+		t.Errorf("authorized POST = %d, want 204", code)
+	}
+}
@@ -0,0 +1,60 @@
+package health
+
+import "time"
+
+// Degradation modes. When a subsystem is unavailable the gateway keeps
+// running with reduced behavior instead of failing:
+//
+//	session store unavailable  → memoryless: history is kept in memory only
+//	scheduler store corrupt    → paused: jobs do not run, the owner is alerted
+//	media pipeline unavailable → text_only: attachments are dropped
+const (
+	ModeMemoryless = "memoryless"
+	ModePaused     = "paused"
+	ModeTextOnly   = "text_only"
+)
+
+// Degradation describes a subsystem running in a reduced mode
+type Degradation struct {
+	Mode      string    `json:"mode"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RegisterDegradation reports subsystem name as degraded to mode whenever
+// errFn returns an error. It is evaluated on every /health and /ready
+// request; a degraded gateway is still ready.
+func (s *Server) RegisterDegradation(name, mode string, errFn func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.degradations[name] = degradationCheck{mode: mode, errFn: errFn}
+}
+
+type degradationCheck struct {
+	mode  string
+	errFn func() error
+}
+
+// degraded evaluates the registered degradations, returning nil when every
+// subsystem is healthy
+func (s *Server) degraded() map[string]Degradation {
+	s.mu.RLock()
+	checks := make(map[string]degradationCheck, len(s.degradations))
+	for k, v := range s.degradations {
+		checks[k] = v
+	}
+	s.mu.RUnlock()
+
+	var out map[string]Degradation
+	for name, check := range checks {
+		err := check.errFn()
+		if err == nil {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]Degradation)
+		}
+		out[name] = Degradation{Mode: check.mode, Reason: err.Error(), Timestamp: time.Now()}
+	}
+	return out
+}
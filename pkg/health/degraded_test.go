@@ -0,0 +1,41 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDegradedStatus(t *testing.T) {
+	s := NewServer("127.0.0.1", 0)
+	s.SetReady(true)
+	var storeErr error
+	s.RegisterDegradation("sessions", ModeMemoryless, func() error { return storeErr })
+
+	get := func(path string) (int, StatusResponse) {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var resp StatusResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return rec.Code, resp
+	}
+
+	if _, resp := get("/health"); resp.Status != "ok" || resp.Degraded != nil {
+		t.Errorf("healthy /health = %+v", resp)
+	}
+
+	storeErr = errors.New("read-only file system")
+	for _, path := range []string{"/health", "/ready"} {
+		code, resp := get(path)
+		if code != http.StatusOK || resp.Status != "degraded" {
+			t.Errorf("%s = %d %q, want 200 degraded", path, code, resp.Status)
+		}
+		if d := resp.Degraded["sessions"]; d.Mode != ModeMemoryless || d.Reason != "read-only file system" {
+			t.Errorf("%s degradation = %+v", path, d)
+		}
+	}
+}
@@ -11,10 +11,21 @@ import (
 
 type Server struct {
 	server    *http.Server
+	mux       *http.ServeMux
 	mu        sync.RWMutex
 	ready     bool
 	checks    map[string]Check
+	live      map[string]func() (bool, string)
 	startTime time.Time
+
+	degradations map[string]degradationCheck
+
+	// Bearer token of the handlers registered with HandleAdmin
+	adminToken string
+
+	// Plain HTTP listener for ACME challenges and redirects to HTTPS,
+	// when TLS is enabled with one
+	httpServer *http.Server
 }
 
 type Check struct {
@@ -28,14 +39,20 @@ type StatusResponse struct {
 	Status string           `json:"status"`
 	Uptime string           `json:"uptime"`
 	Checks map[string]Check `json:"checks,omitempty"`
+
+	Degraded map[string]Degradation `json:"degraded,omitempty"`
 }
 
 func NewServer(host string, port int) *Server {
 	mux := http.NewServeMux()
 	s := &Server{
+		mux:       mux,
 		ready:     false,
 		checks:    make(map[string]Check),
+		live:      make(map[string]func() (bool, string)),
 		startTime: time.Now(),
+
+		degradations: make(map[string]degradationCheck),
 	}
 
 	mux.HandleFunc("/health", s.healthHandler)
@@ -52,11 +69,17 @@ func NewServer(host string, port int) *Server {
 	return s
 }
 
+// Handle registers an additional handler on the gateway HTTP server.
+// It must be called before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
 func (s *Server) Start() error {
 	s.mu.Lock()
 	s.ready = true
 	s.mu.Unlock()
-	return s.server.ListenAndServe()
+	return s.listenAndServe()
 }
 
 func (s *Server) StartContext(ctx context.Context) error {
@@ -66,14 +89,14 @@ func (s *Server) StartContext(ctx context.Context) error {
 
 	errCh := make(chan error, 1)
 	go func() {
-		errCh <- s.server.ListenAndServe()
+		errCh <- s.listenAndServe()
 	}()
 
 	select {
 	case err := <-errCh:
 		return err
 	case <-ctx.Done():
-		return s.server.Shutdown(context.Background())
+		return s.shutdown(context.Background())
 	}
 }
 
@@ -81,7 +104,7 @@ func (s *Server) Stop(ctx context.Context) error {
 	s.mu.Lock()
 	s.ready = false
 	s.mu.Unlock()
-	return s.server.Shutdown(ctx)
+	return s.shutdown(ctx)
 }
 
 func (s *Server) SetReady(ready bool) {
@@ -103,14 +126,26 @@ func (s *Server) RegisterCheck(name string, checkFn func() (bool, string)) {
 	}
 }
 
+// RegisterLiveCheck adds a check that runs on every /ready request, for
+// state that changes at runtime such as channel connections
+func (s *Server) RegisterLiveCheck(name string, checkFn func() (bool, string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.live[name] = checkFn
+}
+
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	uptime := time.Since(s.startTime)
 	resp := StatusResponse{
-		Status: "ok",
-		Uptime: uptime.String(),
+		Status:   "ok",
+		Uptime:   uptime.String(),
+		Degraded: s.degraded(),
+	}
+	if resp.Degraded != nil {
+		resp.Status = "degraded"
 	}
 
 	json.NewEncoder(w).Encode(resp)
@@ -125,8 +160,22 @@ func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
 	for k, v := range s.checks {
 		checks[k] = v
 	}
+	live := make(map[string]func() (bool, string), len(s.live))
+	for k, v := range s.live {
+		live[k] = v
+	}
 	s.mu.RUnlock()
 
+	for name, checkFn := range live {
+		status, msg := checkFn()
+		checks[name] = Check{
+			Name:      name,
+			Status:    statusString(status),
+			Message:   msg,
+			Timestamp: time.Now(),
+		}
+	}
+
 	if !ready {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(StatusResponse{
@@ -149,11 +198,16 @@ func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	uptime := time.Since(s.startTime)
-	json.NewEncoder(w).Encode(StatusResponse{
-		Status: "ready",
-		Uptime: uptime.String(),
-		Checks: checks,
-	})
+	resp := StatusResponse{
+		Status:   "ready",
+		Uptime:   uptime.String(),
+		Checks:   checks,
+		Degraded: s.degraded(),
+	}
+	if resp.Degraded != nil {
+		resp.Status = "degraded"
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
 func statusString(ok bool) string {
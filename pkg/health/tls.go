@@ -0,0 +1,294 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ListenOptions tunes the gateway listener; zero values keep the defaults
+type ListenOptions struct {
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+}
+
+// SetListenOptions applies opts to the listener. It must be called before
+// Start.
+func (s *Server) SetListenOptions(opts ListenOptions) {
+	if opts.ReadTimeout > 0 {
+		s.server.ReadTimeout = opts.ReadTimeout
+	}
+	if opts.WriteTimeout > 0 {
+		s.server.WriteTimeout = opts.WriteTimeout
+	}
+	if opts.IdleTimeout > 0 {
+		s.server.IdleTimeout = opts.IdleTimeout
+	}
+	if opts.MaxHeaderBytes > 0 {
+		s.server.MaxHeaderBytes = opts.MaxHeaderBytes
+	}
+}
+
+// TLSOptions serves the gateway over HTTPS, with the certificate in
+// CertFile and KeyFile or with certificates for ACMEDomains obtained from an
+// ACME CA. ACME answers TLS-ALPN-01 challenges on the HTTPS listener and,
+// with HTTPPort set, HTTP-01 challenges on the plain HTTP one.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+
+	ACMEDomains      []string
+	ACMEEmail        string
+	ACMECacheDir     string
+	ACMEDirectoryURL string // Empty for Let's Encrypt production
+
+	// HTTPPort is a plain HTTP listener on the gateway host that answers
+	// ACME HTTP-01 challenges and redirects everything else to HTTPS; 0
+	// disables it
+	HTTPPort int
+	// HSTSMaxAge sends Strict-Transport-Security when positive
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	MinVersion            uint16 // Default TLS 1.2
+}
+
+// ParseTLSVersion reads a TLS version given as "1.2" or "1.3"; empty
+// selects TLS 1.2
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q (want 1.2 or 1.3)", version)
+	}
+}
+
+// EnableTLS makes Start serve HTTPS. It must be called before Start.
+func (s *Server) EnableTLS(opts TLSOptions) error {
+	minVersion := opts.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	var tlsConfig *tls.Config
+	var challenges http.Handler
+	switch {
+	case opts.CertFile != "" && len(opts.ACMEDomains) > 0:
+		return fmt.Errorf("certificate files and ACME cannot be used together")
+	case opts.CertFile != "":
+		reloader, err := newCertReloader(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig = &tls.Config{GetCertificate: reloader.getCertificate}
+	case len(opts.ACMEDomains) > 0:
+		if opts.ACMECacheDir == "" {
+			return fmt.Errorf("ACME needs a cache directory for its account key and certificates")
+		}
+		if err := os.MkdirAll(opts.ACMECacheDir, 0700); err != nil {
+			return fmt.Errorf("failed to create ACME cache directory: %w", err)
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(opts.ACMEDomains...),
+			Cache:      autocert.DirCache(opts.ACMECacheDir),
+			Email:      opts.ACMEEmail,
+		}
+		if opts.ACMEDirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: opts.ACMEDirectoryURL}
+		}
+		// Includes the acme-tls/1 protocol for TLS-ALPN-01
+		tlsConfig = manager.TLSConfig()
+		if opts.HTTPPort > 0 {
+			challenges = manager.HTTPHandler(nil)
+		}
+	default:
+		return fmt.Errorf("TLS needs certificate files or ACME domains")
+	}
+	tlsConfig.MinVersion = minVersion
+	s.server.TLSConfig = tlsConfig
+	s.server.Handler = hsts(s.server.Handler, opts.HSTSMaxAge, opts.HSTSIncludeSubdomains)
+
+	if opts.HTTPPort > 0 {
+		host, port, err := net.SplitHostPort(s.server.Addr)
+		if err != nil {
+			return err
+		}
+		redirect := redirectToHTTPS(port)
+		if challenges == nil {
+			challenges = redirect
+		} else {
+			// autocert's handler redirects non-challenge requests to the
+			// default HTTPS port, which may not be ours
+			challenges = acmeChallengesOr(challenges, redirect)
+		}
+		s.httpServer = &http.Server{
+			Addr:              net.JoinHostPort(host, strconv.Itoa(opts.HTTPPort)),
+			Handler:           challenges,
+			ReadHeaderTimeout: s.server.ReadTimeout,
+			WriteTimeout:      s.server.WriteTimeout,
+		}
+	}
+	return nil
+}
+
+// Scheme returns "https" when TLS is enabled and "http" otherwise
+func (s *Server) Scheme() string {
+	if s.server.TLSConfig != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// listenAndServe serves plain HTTP or HTTPS, plus the HTTP listener for
+// challenges and redirects if there is one
+func (s *Server) listenAndServe() error {
+	if s.server.TLSConfig == nil {
+		return s.server.ListenAndServe()
+	}
+	if s.httpServer != nil {
+		go func() {
+			if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.ErrorCF("health", "HTTP challenge listener error", map[string]interface{}{
+					"addr":  s.httpServer.Addr,
+					"error": err.Error(),
+				})
+			}
+		}()
+	}
+	return s.server.ListenAndServeTLS("", "")
+}
+
+// shutdown stops the listeners
+func (s *Server) shutdown(ctx context.Context) error {
+	if s.httpServer != nil {
+		s.httpServer.Shutdown(ctx)
+	}
+	return s.server.Shutdown(ctx)
+}
+
+// hsts adds the Strict-Transport-Security header to HTTPS responses
+func hsts(next http.Handler, maxAge time.Duration, includeSubdomains bool) http.Handler {
+	if maxAge <= 0 {
+		return next
+	}
+	value := fmt.Sprintf("max-age=%d", int(maxAge.Seconds()))
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToHTTPS redirects requests to the same host on the HTTPS port
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// acmeChallengesOr sends ACME HTTP-01 challenges to challenges and
+// everything else to fallback
+func acmeChallengesOr(challenges, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, acmeChallengePath) {
+			challenges.ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// acmeChallengePath is where HTTP-01 challenges are fetched from
+const acmeChallengePath = "/.well-known/acme-challenge/"
+
+// certReloader serves a certificate from files, reloading it when the
+// files change, e.g. after a renewal by certbot
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.getCertificate(nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// getCertificate returns the current certificate. A failed reload keeps
+// serving the previous one.
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime := r.modTime
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			if r.cert != nil {
+				return r.cert, nil
+			}
+			return nil, fmt.Errorf("failed to read TLS certificate: %w", err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if r.cert != nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			logger.WarnCF("health", "Failed to reload TLS certificate, keeping the previous one", map[string]interface{}{
+				"cert_file": r.certFile,
+				"error":     err.Error(),
+			})
+			r.modTime = modTime
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	if r.cert != nil {
+		logger.InfoCF("health", "Reloaded TLS certificate", map[string]interface{}{
+			"cert_file": r.certFile,
+		})
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return r.cert, nil
+}
@@ -0,0 +1,183 @@
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes a self-signed certificate for 127.0.0.1, valid until
+// notAfter, and its key
+func writeKeyPair(t *testing.T, dir string, notAfter time.Time) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(notAfter.Unix()),
+		Subject:      pkix.Name{CommonName: "picoclaw.test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+// freePort returns a port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestServeTLSFromFiles(t *testing.T) {
+	certFile, keyFile := writeKeyPair(t, t.TempDir(), time.Now().Add(24*time.Hour))
+	port := freePort(t)
+	s := NewServer("127.0.0.1", port)
+	s.SetListenOptions(ListenOptions{IdleTimeout: time.Minute, MaxHeaderBytes: 8 << 10})
+	if err := s.EnableTLS(TLSOptions{CertFile: certFile, KeyFile: keyFile, HSTSMaxAge: 365 * 24 * time.Hour}); err != nil {
+		t.Fatalf("EnableTLS: %v", err)
+	}
+	if s.Scheme() != "https" || s.server.MaxHeaderBytes != 8<<10 || s.server.ReadTimeout != 5*time.Second {
+		t.Errorf("unexpected listener: %s, %d, %s", s.Scheme(), s.server.MaxHeaderBytes, s.server.ReadTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.StartContext(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	url := "https://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) + "/health"
+	var resp *http.Response
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if resp, err = client.Get(url); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("GET /health: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Strict-Transport-Security") != "max-age=31536000" {
+		t.Errorf("unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	first := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	certFile, keyFile := writeKeyPair(t, dir, first)
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewed := first.Add(90 * 24 * time.Hour)
+	writeKeyPair(t, dir, renewed)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	cert, err := r.getCertificate(nil)
+	if err != nil || !cert.Leaf.NotAfter.Equal(renewed) {
+		t.Fatalf("renewed certificate not loaded: %v", err)
+	}
+
+	// A broken renewal keeps the previous certificate
+	os.WriteFile(certFile, []byte("garbage"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if cert, err := r.getCertificate(nil); err != nil || !cert.Leaf.NotAfter.Equal(renewed) {
+		t.Errorf("broken renewal: %v", err)
+	}
+
+	if _, err := newCertReloader(filepath.Join(dir, "none.pem"), keyFile); err == nil {
+		t.Error("missing certificate should fail")
+	}
+}
+
+func TestEnableTLSACME(t *testing.T) {
+	s := NewServer("127.0.0.1", 8443)
+	err := s.EnableTLS(TLSOptions{
+		ACMEDomains:  []string{"pico.example.org"},
+		ACMECacheDir: filepath.Join(t.TempDir(), "acme"),
+		HTTPPort:     8080,
+		MinVersion:   tls.VersionTLS13,
+	})
+	if err != nil {
+		t.Fatalf("EnableTLS: %v", err)
+	}
+	if !slices.Contains(s.server.TLSConfig.NextProtos, "acme-tls/1") || s.server.TLSConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("unexpected TLS config %+v", s.server.TLSConfig)
+	}
+	if s.httpServer == nil || s.httpServer.Addr != "127.0.0.1:8080" {
+		t.Fatalf("challenge listener not set up")
+	}
+
+	// Everything but challenges is redirected to the gateway's HTTPS port
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "http://pico.example.org/messenger/webhook?x=1", nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "https://pico.example.org:8443/messenger/webhook?x=1" {
+		t.Errorf("unexpected redirect %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://pico.example.org/.well-known/acme-challenge/unknown", nil))
+	if rec.Code == http.StatusMovedPermanently {
+		t.Error("challenge request was redirected")
+	}
+
+	for name, opts := range map[string]TLSOptions{
+		"nothing":  {},
+		"both":     {CertFile: "cert.pem", KeyFile: "key.pem", ACMEDomains: []string{"pico.example.org"}},
+		"no cache": {ACMEDomains: []string{"pico.example.org"}},
+	} {
+		if err := NewServer("127.0.0.1", 8443).EnableTLS(opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	for version, want := range map[string]uint16{"": tls.VersionTLS12, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13} {
+		if got, err := ParseTLSVersion(version); err != nil || got != want {
+			t.Errorf("ParseTLSVersion(%q) = %d, %v", version, got, err)
+		}
+	}
+	if _, err := ParseTLSVersion("1.0"); err == nil {
+		t.Error("TLS 1.0 should be refused")
+	}
+}
@@ -308,9 +308,10 @@ func (hs *HeartbeatService) sendResponse(response string) {
 	}
 
 	msgBus.PublishOutbound(bus.OutboundMessage{
-		Channel: platform,
-		ChatID:  userID,
-		Content: response,
+		Channel:      platform,
+		ChatID:       userID,
+		Content:      response,
+		Notification: bus.NotificationHeartbeat,
 	})
 
 	hs.logInfo("Heartbeat result sent to %s", platform)
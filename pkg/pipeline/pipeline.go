@@ -0,0 +1,94 @@
+// Package pipeline transforms the text of outgoing messages in stages, such
+// as masking profanity or redacting secrets, chosen per channel.
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Names of the built-in stages, as used in the configuration
+const (
+	StageProfanity     = "profanity"
+	StageRedactSecrets = "redact_secrets"
+	StageCapLength     = "cap_length"
+	StageTemplate      = "template"
+)
+
+// defaultChannel is the key of the stages for channels without their own
+const defaultChannel = "default"
+
+// Message is what stages see of an outgoing message
+type Message struct {
+	Channel string
+	ChatID  string
+	Content string
+}
+
+// Stage transforms the content of a message
+type Stage interface {
+	Apply(msg Message) string
+}
+
+// StageFunc adapts a function to a Stage
+type StageFunc func(msg Message) string
+
+func (f StageFunc) Apply(msg Message) string {
+	return f(msg)
+}
+
+// Pipeline runs the stages configured for each channel
+type Pipeline struct {
+	byChannel map[string][]Stage
+}
+
+// New builds the stages named in cfg
+func New(cfg config.PipelineConfig) (*Pipeline, error) {
+	p := &Pipeline{byChannel: make(map[string][]Stage, len(cfg.Channels))}
+	built := make(map[string]Stage)
+	for channel, names := range cfg.Channels {
+		for _, name := range names {
+			stage, ok := built[name]
+			if !ok {
+				var err error
+				if stage, err = newStage(name, cfg); err != nil {
+					return nil, fmt.Errorf("pipeline stage %s: %w", name, err)
+				}
+				built[name] = stage
+			}
+			p.byChannel[channel] = append(p.byChannel[channel], stage)
+		}
+	}
+	return p, nil
+}
+
+func newStage(name string, cfg config.PipelineConfig) (Stage, error) {
+	switch name {
+	case StageProfanity:
+		return Profanity(cfg.ProfanityWords), nil
+	case StageRedactSecrets:
+		return RedactSecrets(cfg.RedactPatterns)
+	case StageCapLength:
+		return CapLength(cfg.MaxLength), nil
+	case StageTemplate:
+		return Template(cfg.Template)
+	}
+	return nil, fmt.Errorf("unknown stage")
+}
+
+// Apply runs the stages of msg's channel over its content, in order, and
+// returns the result. A nil pipeline returns the content unchanged.
+func (p *Pipeline) Apply(msg Message) string {
+	if p == nil {
+		return msg.Content
+	}
+	stages, ok := p.byChannel[msg.Channel]
+	if !ok {
+		stages = p.byChannel[defaultChannel]
+	}
+	for _, stage := range stages {
+		msg.Content = stage.Apply(msg)
+	}
+	return msg.Content
+}
@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// defaultProfanity is masked by the profanity stage in addition to the
+// configured words
+var defaultProfanity = []string{
+	"asshole", "bastard", "bitch", "bullshit", "cunt", "dickhead",
+	"fuck", "fucked", "fucker", "fucking", "motherfucker", "shit", "shitty",
+}
+
+// Profanity masks the built-in swear words and the given words, keeping
+// their first letter: "shit" becomes "s***". Matching ignores case and
+// takes whole words only.
+func Profanity(words []string) Stage {
+	all := append(append([]string(nil), defaultProfanity...), words...)
+	quoted := make([]string, 0, len(all))
+	for _, w := range all {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	re := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	return StageFunc(func(msg Message) string {
+		return re.ReplaceAllStringFunc(msg.Content, func(word string) string {
+			first, size := utf8.DecodeRuneInString(word)
+			return string(first) + strings.Repeat("*", utf8.RuneCountInString(word[size:]))
+		})
+	})
+}
+
+// secretPatterns are API keys, tokens and credentials the redact_secrets
+// stage always removes
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{8,}`), "Bearer [REDACTED]"},
+	{regexp.MustCompile(`\b(?:sk|pk|rk|gsk)[-_][A-Za-z0-9_-]{16,}`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`\bxox[abpr]-[A-Za-z0-9-]{10,}`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{30,}`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`\b\d{8,10}:[A-Za-z0-9_-]{35}\b`), "[REDACTED_KEY]"}, // Telegram bot tokens
+	{regexp.MustCompile(`(?i)(\\?"(?:api_?key|access_?token|token|secret|password)\\?"\s*:\s*\\?")[^"\\]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)\b((?:api_?key|access_?token|token|secret|password)=)[^\s&"]+`), "${1}[REDACTED]"},
+}
+
+// RedactSecrets replaces API keys, tokens, private keys and credentials in
+// key=value or JSON form, and whatever matches the extra regular
+// expressions, with placeholders. Unlike the debug log it keeps e-mail
+// addresses and phone numbers, which replies often need.
+func RedactSecrets(extra []string) (Stage, error) {
+	patterns := make([]*regexp.Regexp, 0, len(extra))
+	for _, p := range extra {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, re)
+	}
+	return StageFunc(func(msg Message) string {
+		s := msg.Content
+		for _, p := range secretPatterns {
+			s = p.re.ReplaceAllString(s, p.repl)
+		}
+		for _, re := range patterns {
+			s = re.ReplaceAllString(s, "[REDACTED]")
+		}
+		return s
+	}), nil
+}
+
+// DefaultMaxLength is the length cap_length keeps when none is configured
+const DefaultMaxLength = 4000
+
+// capSuffix marks content cut by cap_length
+const capSuffix = "…"
+
+// CapLength cuts content longer than limit characters, at a space when one
+// is near the end, and marks the cut with an ellipsis. limit <= 0 selects
+// DefaultMaxLength.
+func CapLength(limit int) Stage {
+	if limit <= 0 {
+		limit = DefaultMaxLength
+	}
+	return StageFunc(func(msg Message) string {
+		s := msg.Content
+		if utf8.RuneCountInString(s) <= limit {
+			return s
+		}
+		all := []rune(s)
+		runes := all[:limit-1]
+		// Prefer not to cut a word, unless that loses over a fifth
+		for i := len(runes); i >= len(runes)*4/5; i-- {
+			if all[i] == ' ' || all[i] == '\n' {
+				runes = all[:i]
+				break
+			}
+		}
+		return strings.TrimRight(string(runes), " \n") + capSuffix
+	})
+}
+
+// Template wraps content in a text/template executed with .Content,
+// .Channel and .ChatID, e.g. "{{.Content}}\n\n— sent by picoclaw". Content
+// is left unchanged when the template fails.
+func Template(text string) (Stage, error) {
+	tmpl, err := template.New("pipeline").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return StageFunc(func(msg Message) string {
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, msg); err != nil {
+			logger.WarnCF("pipeline", "Message template failed", map[string]interface{}{
+				"channel": msg.Channel,
+				"error":   err.Error(),
+			})
+			return msg.Content
+		}
+		return sb.String()
+	}), nil
+}
@@ -0,0 +1,143 @@
+// Package privacy enforces local-only mode, in which inference and the
+// agent's own requests never reach a host outside the device or the local
+// network. Chat channels are not affected: they reach the platforms the
+// user connected on purpose.
+package privacy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ErrCloudEndpoint is returned for requests refused in local-only mode
+var ErrCloudEndpoint = errors.New("local-only mode refuses hosts outside the local network")
+
+var mode = struct {
+	sync.RWMutex
+	enabled bool
+	allow   []string
+}{}
+
+// Enable turns local-only mode on for the process. Hosts in allow, such as
+// the name of an inference server on the LAN, count as local.
+func Enable(allow []string) {
+	mode.Lock()
+	defer mode.Unlock()
+	mode.enabled = true
+	mode.allow = append([]string(nil), allow...)
+}
+
+// Disable turns local-only mode off
+func Disable() {
+	mode.Lock()
+	defer mode.Unlock()
+	mode.enabled = false
+	mode.allow = nil
+}
+
+// Enabled reports whether local-only mode is on
+func Enabled() bool {
+	mode.RLock()
+	defer mode.RUnlock()
+	return mode.enabled
+}
+
+// IsLocalHost reports whether host, a name or IP address without port, is
+// the device itself or on the local network: loopback, private and
+// link-local addresses, localhost and .local names, and the hosts in allow.
+// Other names are not resolved, as DNS could point them anywhere.
+func IsLocalHost(host string, allow []string) bool {
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	for _, allowed := range allow {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
+
+// IsLocalURL reports whether rawURL points to a local host, see IsLocalHost.
+// URLs without a scheme, like "localhost:4321", are read as http URLs.
+func IsLocalURL(rawURL string, allow []string) bool {
+	u, err := parseURL(rawURL)
+	return err == nil && u.Hostname() != "" && IsLocalHost(u.Hostname(), allow)
+}
+
+// CheckURL returns an error wrapping ErrCloudEndpoint when local-only mode
+// is on and rawURL is not local
+func CheckURL(rawURL string) error {
+	mode.RLock()
+	enabled, allow := mode.enabled, mode.allow
+	mode.RUnlock()
+	if !enabled || IsLocalURL(rawURL, allow) {
+		return nil
+	}
+	host := rawURL
+	if u, err := parseURL(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return fmt.Errorf("%w: %s", ErrCloudEndpoint, host)
+}
+
+func parseURL(rawURL string) (*url.URL, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	return url.Parse(rawURL)
+}
+
+// guard refuses requests to hosts that are not local while local-only mode
+// is on
+type guard struct {
+	next http.RoundTripper
+}
+
+// Guard wraps next so its requests fail with ErrCloudEndpoint instead of
+// reaching a host outside the local network while local-only mode is on.
+// The check happens on every request, so mode changes apply at once.
+func Guard(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &guard{next: next}
+}
+
+func (g *guard) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := CheckURL(req.URL.String()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	if t, ok := g.next.(*http.Transport); ok && t.Proxy != nil && Enabled() {
+		// A proxy outside the local network would see every request
+		if proxy, err := t.Proxy(req); err == nil && proxy != nil {
+			if err := CheckURL(proxy.String()); err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, fmt.Errorf("proxy: %w", err)
+			}
+		}
+	}
+	return g.next.RoundTrip(req)
+}
+
+// CloseIdleConnections passes on to the wrapped transport
+func (g *guard) CloseIdleConnections() {
+	if c, ok := g.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
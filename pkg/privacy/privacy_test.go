@@ -0,0 +1,59 @@
+package privacy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestIsLocalURL(t *testing.T) {
+	for rawURL, want := range map[string]bool{
+		"http://localhost:11434/v1":     true,
+		"http://127.0.0.1:8000":         true,
+		"http://[::1]:8000":             true,
+		"http://192.168.1.20:8000/v1":   true,
+		"http://10.0.0.5":               true,
+		"http://gpu-box.local:8000":     true,
+		"localhost:4321":                true,
+		"http://gpu-box:8000":           true, // In the allow list
+		"https://api.openai.com/v1":     false,
+		"https://8.8.8.8":               false,
+		"https://localhost.example.com": false,
+		"not a url":                     false,
+	} {
+		if got := IsLocalURL(rawURL, []string{"gpu-box"}); got != want {
+			t.Errorf("IsLocalURL(%q) = %v, want %v", rawURL, got, want)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := &http.Client{Transport: Guard(nil)}
+
+	Enable(nil)
+	defer Disable()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("local request refused: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := client.Get("https://api.anthropic.com/v1/messages"); !errors.Is(err, ErrCloudEndpoint) {
+		t.Errorf("cloud request not refused: %v", err)
+	}
+
+	proxied := http.DefaultTransport.(*http.Transport).Clone()
+	proxied.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: "proxy.example.com:3128"})
+	client = &http.Client{Transport: Guard(proxied)}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrCloudEndpoint) {
+		t.Errorf("remote proxy not refused: %v", err)
+	}
+
+	Disable()
+	if err := CheckURL("https://api.anthropic.com"); err != nil {
+		t.Errorf("refused with local-only mode off: %v", err)
+	}
+}
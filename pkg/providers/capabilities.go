@@ -0,0 +1,217 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// minOutputTokens is the smallest max_tokens left after clamping to the
+// context window; below it the request would be useless anyway.
+const minOutputTokens = 256
+
+// ModelCapabilities describes what a model accepts. Zero sizes mean unknown.
+type ModelCapabilities struct {
+	ContextWindow           int
+	MaxOutputTokens         int
+	SupportsTools           bool
+	SupportsVision          bool
+	SupportsStreaming       bool
+	UsesMaxCompletionTokens bool    // Expects "max_completion_tokens" instead of "max_tokens"
+	FixedTemperature        float64 // Only this temperature is accepted (0 = any)
+}
+
+// genericCapabilities is assumed for models the registry does not know
+var genericCapabilities = ModelCapabilities{
+	SupportsTools:     true,
+	SupportsStreaming: true,
+}
+
+var builtinModels = map[string]ModelCapabilities{
+	"gpt-4o":            {ContextWindow: 128000, MaxOutputTokens: 16384, SupportsTools: true, SupportsVision: true, SupportsStreaming: true},
+	"gpt-4.1":           {ContextWindow: 1047576, MaxOutputTokens: 32768, SupportsTools: true, SupportsVision: true, SupportsStreaming: true},
+	"gpt-5":             {ContextWindow: 400000, MaxOutputTokens: 128000, SupportsTools: true, SupportsVision: true, SupportsStreaming: true, UsesMaxCompletionTokens: true},
+	"o1":                {ContextWindow: 200000, MaxOutputTokens: 100000, SupportsTools: true, SupportsVision: true, UsesMaxCompletionTokens: true},
+	"o3":                {ContextWindow: 200000, MaxOutputTokens: 100000, SupportsTools: true, SupportsVision: true, SupportsStreaming: true, UsesMaxCompletionTokens: true},
+	"o4-mini":           {ContextWindow: 200000, MaxOutputTokens: 100000, SupportsTools: true, SupportsVision: true, SupportsStreaming: true, UsesMaxCompletionTokens: true},
+	"claude-3-5-sonnet": {ContextWindow: 200000, MaxOutputTokens: 8192, SupportsTools: true, SupportsVision: true, SupportsStreaming: true},
+	"claude-3-5-haiku":  {ContextWindow: 200000, MaxOutputTokens: 8192, SupportsTools: true, SupportsStreaming: true},
+	"claude-sonnet-4":   {ContextWindow: 200000, MaxOutputTokens: 64000, SupportsTools: true, SupportsVision: true, SupportsStreaming: true},
+	"claude-opus-4":     {ContextWindow: 200000, MaxOutputTokens: 32000, SupportsTools: true, SupportsVision: true, SupportsStreaming: true},
+	"gemini-2.5":        {ContextWindow: 1048576, MaxOutputTokens: 65536, SupportsTools: true, SupportsVision: true, SupportsStreaming: true},
+	"deepseek-chat":     {ContextWindow: 128000, MaxOutputTokens: 8192, SupportsTools: true, SupportsStreaming: true},
+	"deepseek-reasoner": {ContextWindow: 128000, MaxOutputTokens: 65536, SupportsStreaming: true},
+	"glm":               {ContextWindow: 128000, SupportsTools: true, SupportsStreaming: true, UsesMaxCompletionTokens: true},
+	"kimi-k2":           {ContextWindow: 256000, SupportsTools: true, SupportsStreaming: true, FixedTemperature: 1.0},
+}
+
+// ModelRegistry maps model names to their capabilities. A model matches the
+// entry with its exact name or, failing that, the longest entry that is a
+// prefix of it, so "claude-sonnet-4-5-20250929" uses "claude-sonnet-4".
+type ModelRegistry struct {
+	mu      sync.RWMutex
+	entries map[string]ModelCapabilities
+}
+
+// DefaultModels is the registry used by the built-in providers
+var DefaultModels = NewModelRegistry()
+
+// NewModelRegistry creates a registry holding the built-in entries
+func NewModelRegistry() *ModelRegistry {
+	r := &ModelRegistry{entries: make(map[string]ModelCapabilities, len(builtinModels))}
+	for name, caps := range builtinModels {
+		r.entries[name] = caps
+	}
+	return r
+}
+
+// Register adds or replaces an entry
+func (r *ModelRegistry) Register(name string, caps ModelCapabilities) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[strings.ToLower(name)] = caps
+}
+
+// RegisterConfig applies the user entries from the config. Fields left unset
+// keep the value of the entry the model already matched.
+func (r *ModelRegistry) RegisterConfig(models map[string]config.ModelCapabilityConfig) {
+	for name, mc := range models {
+		caps, _ := r.Lookup(name)
+		if mc.ContextWindow > 0 {
+			caps.ContextWindow = mc.ContextWindow
+		}
+		if mc.MaxOutputTokens > 0 {
+			caps.MaxOutputTokens = mc.MaxOutputTokens
+		}
+		if mc.SupportsTools != nil {
+			caps.SupportsTools = *mc.SupportsTools
+		}
+		if mc.SupportsVision != nil {
+			caps.SupportsVision = *mc.SupportsVision
+		}
+		if mc.SupportsStreaming != nil {
+			caps.SupportsStreaming = *mc.SupportsStreaming
+		}
+		if mc.UsesMaxCompletionTokens != nil {
+			caps.UsesMaxCompletionTokens = *mc.UsesMaxCompletionTokens
+		}
+		if mc.FixedTemperature != nil {
+			caps.FixedTemperature = *mc.FixedTemperature
+		}
+		r.Register(name, caps)
+	}
+}
+
+// Lookup returns the capabilities of a model. Unknown models get generic
+// capabilities and false.
+func (r *ModelRegistry) Lookup(model string) (ModelCapabilities, bool) {
+	name := strings.ToLower(model)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for {
+		if caps, ok := r.entries[name]; ok {
+			return caps, true
+		}
+		best := ""
+		for key := range r.entries {
+			if strings.HasPrefix(name, key) && len(key) > len(best) {
+				best = key
+			}
+		}
+		if best != "" {
+			return r.entries[best], true
+		}
+		// Retry without the provider prefix (e.g. "openrouter/gpt-4o")
+		idx := strings.Index(name, "/")
+		if idx == -1 {
+			return genericCapabilities, false
+		}
+		name = name[idx+1:]
+	}
+}
+
+// Clamp adapts a request to the model: it drops tools the model cannot use,
+// caps max_tokens to the model's output limit and to what is left of the
+// context window, and pins the temperature when the model requires it.
+// The options map passed in is not modified.
+func (r *ModelRegistry) Clamp(model string, messages []Message, tools []ToolDefinition, options map[string]interface{}) ([]ToolDefinition, map[string]interface{}) {
+	caps, known := r.Lookup(model)
+	if !known {
+		return tools, options
+	}
+
+	if !caps.SupportsTools {
+		tools = nil
+	}
+
+	clamped := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		clamped[k] = v
+	}
+
+	if maxTokens, ok := clamped["max_tokens"].(int); ok {
+		limit := maxTokens
+		if caps.MaxOutputTokens > 0 && limit > caps.MaxOutputTokens {
+			limit = caps.MaxOutputTokens
+		}
+		if caps.ContextWindow > 0 {
+			if room := caps.ContextWindow - estimatePromptTokens(messages, tools); limit > room {
+				limit = room
+			}
+		}
+		if limit < minOutputTokens {
+			limit = min(maxTokens, minOutputTokens)
+		}
+		if limit != maxTokens {
+			logger.DebugCF("provider", "Clamped max_tokens to model limits",
+				map[string]interface{}{"model": model, "requested": maxTokens, "max_tokens": limit})
+			clamped["max_tokens"] = limit
+		}
+	}
+
+	if caps.FixedTemperature != 0 {
+		if _, ok := clamped["temperature"]; ok {
+			clamped["temperature"] = caps.FixedTemperature
+		}
+	}
+	return tools, clamped
+}
+
+// estimatePromptTokens uses the same 2.5 characters per token heuristic as the
+// agent's context management.
+func estimatePromptTokens(messages []Message, tools []ToolDefinition) int {
+	chars := 0
+	for _, m := range messages {
+		chars += utf8.RuneCountInString(m.Content)
+	}
+	if len(tools) > 0 {
+		if defs, err := json.Marshal(tools); err == nil {
+			chars += utf8.RuneCount(defs)
+		}
+	}
+	return chars * 2 / 5
+}
+
+// capabilityProvider clamps every request to the model's capabilities
+type capabilityProvider struct {
+	LLMProvider
+	models *ModelRegistry
+}
+
+// WithModelCapabilities wraps a provider so requests are clamped to the
+// capabilities registered for the requested model.
+func WithModelCapabilities(provider LLMProvider, models *ModelRegistry) LLMProvider {
+	return &capabilityProvider{LLMProvider: provider, models: models}
+}
+
+func (p *capabilityProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	tools, options = p.models.Clamp(model, messages, tools, options)
+	return p.LLMProvider.Chat(ctx, messages, tools, model, options)
+}
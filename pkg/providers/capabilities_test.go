@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestModelRegistryLookup(t *testing.T) {
+	r := NewModelRegistry()
+
+	tests := []struct {
+		model     string
+		wantKnown bool
+		wantMax   int
+	}{
+		{"gpt-4o", true, 16384},
+		{"gpt-4o-mini", true, 16384},
+		{"openrouter/anthropic/claude-sonnet-4-5-20250929", true, 64000},
+		{"Claude-3-5-Sonnet-Latest", true, 8192},
+		{"some-new-model", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			caps, known := r.Lookup(tt.model)
+			if known != tt.wantKnown || caps.MaxOutputTokens != tt.wantMax {
+				t.Errorf("Lookup(%q) = %+v, %v", tt.model, caps, known)
+			}
+		})
+	}
+}
+
+func TestModelRegistryRegisterConfig(t *testing.T) {
+	r := NewModelRegistry()
+	noTools := false
+	r.RegisterConfig(map[string]config.ModelCapabilityConfig{
+		"my-local-model":    {ContextWindow: 8000, SupportsTools: &noTools},
+		"gpt-4o-2024-08-06": {MaxOutputTokens: 4096},
+	})
+
+	local, known := r.Lookup("ollama/my-local-model:7b")
+	if !known || local.ContextWindow != 8000 || local.SupportsTools {
+		t.Errorf("unexpected user entry: %+v (known %v)", local, known)
+	}
+
+	// Unset fields inherit from the built-in "gpt-4o" entry
+	snapshot, _ := r.Lookup("gpt-4o-2024-08-06")
+	if snapshot.MaxOutputTokens != 4096 || snapshot.ContextWindow != 128000 || !snapshot.SupportsVision {
+		t.Errorf("override should only change max output tokens: %+v", snapshot)
+	}
+}
+
+func TestModelRegistryClamp(t *testing.T) {
+	r := NewModelRegistry()
+	noTools := false
+	r.RegisterConfig(map[string]config.ModelCapabilityConfig{
+		"tiny": {ContextWindow: 1000, SupportsTools: &noTools},
+	})
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "exec"}}}
+	options := map[string]interface{}{"max_tokens": 8192, "temperature": 0.7}
+
+	// Output limit
+	_, got := r.Clamp("claude-3-5-sonnet", nil, tools, map[string]interface{}{"max_tokens": 20000})
+	if got["max_tokens"] != 8192 {
+		t.Errorf("expected max_tokens clamped to 8192, got %v", got["max_tokens"])
+	}
+
+	// Context window and tool support
+	messages := []Message{{Role: "user", Content: strings.Repeat("x", 1000)}} // ~400 tokens
+	gotTools, got := r.Clamp("tiny", messages, tools, options)
+	if gotTools != nil {
+		t.Error("tools should be dropped for a model without tool support")
+	}
+	if got["max_tokens"] != 600 {
+		t.Errorf("expected max_tokens clamped to remaining context 600, got %v", got["max_tokens"])
+	}
+	if options["max_tokens"] != 8192 {
+		t.Error("caller options must not be modified")
+	}
+
+	// Fixed temperature
+	_, got = r.Clamp("moonshot/kimi-k2-0905", nil, nil, options)
+	if got["temperature"] != 1.0 {
+		t.Errorf("expected temperature pinned to 1.0, got %v", got["temperature"])
+	}
+
+	// Unknown models pass through untouched
+	if _, got = r.Clamp("mystery", nil, tools, options); got["max_tokens"] != 8192 {
+		t.Errorf("unknown model should not be clamped, got %v", got["max_tokens"])
+	}
+}
+
+type recordingProvider struct {
+	options map[string]interface{}
+}
+
+func (p *recordingProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	p.options = options
+	return &LLMResponse{}, nil
+}
+
+func (p *recordingProvider) GetDefaultModel() string { return "" }
+
+func TestWithModelCapabilities(t *testing.T) {
+	inner := &recordingProvider{}
+	provider := WithModelCapabilities(inner, NewModelRegistry())
+
+	if _, err := provider.Chat(context.Background(), nil, nil, "deepseek-chat", map[string]interface{}{"max_tokens": 32000}); err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if inner.options["max_tokens"] != 8192 {
+		t.Errorf("expected clamped request, got %v", inner.options["max_tokens"])
+	}
+}
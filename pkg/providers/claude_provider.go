@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/sipeed/picoclaw/pkg/auth"
 )
 
+const claudeBaseURL = "https://api.anthropic.com"
+
 type ClaudeProvider struct {
 	client      *anthropic.Client
 	tokenSource func() (string, error)
@@ -18,7 +21,8 @@ type ClaudeProvider struct {
 func NewClaudeProvider(token string) *ClaudeProvider {
 	client := anthropic.NewClient(
 		option.WithAuthToken(token),
-		option.WithBaseURL("https://api.anthropic.com"),
+		option.WithBaseURL(claudeBaseURL),
+		option.WithHTTPClient(&http.Client{Transport: guardedTransport("")}),
 	)
 	return &ClaudeProvider{client: &client}
 }
@@ -52,6 +56,11 @@ func (p *ClaudeProvider) Chat(ctx context.Context, messages []Message, tools []T
 	return parseClaudeResponse(resp), nil
 }
 
+// WarmUp opens a connection to the Anthropic API
+func (p *ClaudeProvider) WarmUp(ctx context.Context) error {
+	return warmURL(ctx, &http.Client{Transport: guardedTransport("")}, claudeBaseURL)
+}
+
 func (p *ClaudeProvider) GetDefaultModel() string {
 	return "claude-sonnet-4-5-20250929"
 }
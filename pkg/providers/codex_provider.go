@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/openai/openai-go/v3"
@@ -14,6 +15,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
+const codexBaseURL = "https://chatgpt.com/backend-api/codex"
 const codexDefaultModel = "gpt-5.2"
 const codexDefaultInstructions = "You are Codex, a coding assistant."
 
@@ -27,7 +29,8 @@ const defaultCodexInstructions = "You are Codex, a coding assistant."
 
 func NewCodexProvider(token, accountID string) *CodexProvider {
 	opts := []option.RequestOption{
-		option.WithBaseURL("https://chatgpt.com/backend-api/codex"),
+		option.WithBaseURL(codexBaseURL),
+		option.WithHTTPClient(&http.Client{Transport: guardedTransport("")}),
 		option.WithAPIKey(token),
 		option.WithHeader("originator", "codex_cli_rs"),
 		option.WithHeader("OpenAI-Beta", "responses=experimental"),
@@ -48,6 +51,11 @@ func NewCodexProviderWithTokenSource(token, accountID string, tokenSource func()
 	return p
 }
 
+// WarmUp opens a connection to the Codex backend
+func (p *CodexProvider) WarmUp(ctx context.Context) error {
+	return warmURL(ctx, &http.Client{Transport: guardedTransport("")}, codexBaseURL)
+}
+
 func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
 	var opts []option.RequestOption
 	accountID := p.accountID
@@ -0,0 +1,140 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// DefaultHedgeDelay is how long the primary provider gets before the hedged
+// request is sent
+const DefaultHedgeDelay = 2 * time.Second
+
+// hedgedProvider sends a request to a second provider when the primary is
+// slow or fails, and returns the first complete response.
+type hedgedProvider struct {
+	LLMProvider // Primary
+	hedge       LLMProvider
+	hedgeModel  string // Empty sends the primary model
+	delay       time.Duration
+}
+
+// WithHedging wraps primary so that a request still unanswered after delay is
+// also sent to hedge (with hedgeModel, if set). The first successful response
+// wins and the other request is cancelled. A failed primary request fires the
+// hedge right away.
+func WithHedging(primary, hedge LLMProvider, hedgeModel string, delay time.Duration) LLMProvider {
+	if delay < 0 {
+		delay = 0
+	}
+	return &hedgedProvider{LLMProvider: primary, hedge: hedge, hedgeModel: hedgeModel, delay: delay}
+}
+
+// WithConfiguredHedging applies the hedging section of the config to
+// primary. It returns primary unchanged when hedging is disabled.
+func WithConfiguredHedging(cfg *config.Config, primary LLMProvider) (LLMProvider, error) {
+	hc := cfg.Hedging
+	if !hc.Enabled {
+		return primary, nil
+	}
+	if hc.Provider == "" {
+		return primary, fmt.Errorf("hedging enabled without a provider")
+	}
+
+	model := hc.Model
+	if model == "" {
+		model = cfg.Agents.Defaults.Model
+	}
+	hedge, err := CreateProviderFor(cfg, hc.Provider, model)
+	if err != nil {
+		return primary, fmt.Errorf("creating hedge provider %s: %w", hc.Provider, err)
+	}
+
+	delay := DefaultHedgeDelay
+	if hc.DelayMS > 0 {
+		delay = time.Duration(hc.DelayMS) * time.Millisecond
+	}
+	// The hedge model has its own limits
+	return WithHedging(primary, WithModelCapabilities(hedge, DefaultModels), hc.Model, delay), nil
+}
+
+type hedgeResult struct {
+	resp   *LLMResponse
+	err    error
+	hedged bool
+}
+
+func (p *hedgedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops the losing request
+
+	results := make(chan hedgeResult, 2)
+	go func() {
+		resp, err := p.LLMProvider.Chat(ctx, messages, tools, model, options)
+		results <- hedgeResult{resp: resp, err: err}
+	}()
+
+	hedgeModel := model
+	if p.hedgeModel != "" {
+		hedgeModel = p.hedgeModel
+	}
+	started := time.Now()
+	fireHedge := func() {
+		logger.DebugCF("provider", "Sending hedged request",
+			map[string]interface{}{"model": hedgeModel, "after_ms": time.Since(started).Milliseconds()})
+		go func() {
+			resp, err := p.hedge.Chat(ctx, messages, tools, hedgeModel, options)
+			results <- hedgeResult{resp: resp, err: err, hedged: true}
+		}()
+	}
+
+	timer := time.NewTimer(p.delay)
+	defer timer.Stop()
+
+	pending, hedged := 1, false
+	var primaryErr, hedgeErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				if r.hedged {
+					logger.InfoCF("provider", "Hedged request answered first",
+						map[string]interface{}{"model": hedgeModel, "latency_ms": time.Since(started).Milliseconds()})
+				}
+				return r.resp, nil
+			}
+			if r.hedged {
+				hedgeErr = r.err
+				continue
+			}
+			primaryErr = r.err
+			if !hedged && ctx.Err() == nil {
+				hedged = true
+				pending++
+				fireHedge()
+			}
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				pending++
+				fireHedge()
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// Callers inspect the primary error (e.g. for context window overflows)
+	if primaryErr != nil {
+		if hedgeErr != nil {
+			logger.WarnCF("provider", "Hedged request failed too",
+				map[string]interface{}{"model": hedgeModel, "error": hedgeErr.Error()})
+		}
+		return nil, primaryErr
+	}
+	return nil, hedgeErr
+}
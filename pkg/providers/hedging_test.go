@@ -0,0 +1,139 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowProvider answers after a delay, or fails, unless cancelled first
+type slowProvider struct {
+	name      string
+	delay     time.Duration
+	err       error
+	calls     atomic.Int32
+	cancelled atomic.Bool
+	model     atomic.Value
+}
+
+func (p *slowProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	p.calls.Add(1)
+	p.model.Store(model)
+	select {
+	case <-time.After(p.delay):
+		if p.err != nil {
+			return nil, p.err
+		}
+		return &LLMResponse{Content: p.name}, nil
+	case <-ctx.Done():
+		p.cancelled.Store(true)
+		return nil, ctx.Err()
+	}
+}
+
+func (p *slowProvider) GetDefaultModel() string { return "" }
+
+func TestHedgedProvider(t *testing.T) {
+	errPrimary := errors.New("primary down")
+	errHedge := errors.New("hedge down")
+
+	tests := []struct {
+		name        string
+		primary     *slowProvider
+		hedge       *slowProvider
+		want        string
+		wantErr     error
+		wantHedged  bool
+		wantCancels string // Provider whose request should be cancelled
+	}{
+		{
+			name:    "fast primary",
+			primary: &slowProvider{name: "primary", delay: 10 * time.Millisecond},
+			hedge:   &slowProvider{name: "hedge"},
+			want:    "primary",
+		},
+		{
+			name:        "slow primary",
+			primary:     &slowProvider{name: "primary", delay: time.Second},
+			hedge:       &slowProvider{name: "hedge", delay: 10 * time.Millisecond},
+			want:        "hedge",
+			wantHedged:  true,
+			wantCancels: "primary",
+		},
+		{
+			name:        "primary still wins after hedging",
+			primary:     &slowProvider{name: "primary", delay: 80 * time.Millisecond},
+			hedge:       &slowProvider{name: "hedge", delay: time.Second},
+			want:        "primary",
+			wantHedged:  true,
+			wantCancels: "hedge",
+		},
+		{
+			name:       "failed primary fires hedge at once",
+			primary:    &slowProvider{name: "primary", err: errPrimary},
+			hedge:      &slowProvider{name: "hedge", delay: 10 * time.Millisecond},
+			want:       "hedge",
+			wantHedged: true,
+		},
+		{
+			name:       "both fail",
+			primary:    &slowProvider{name: "primary", err: errPrimary},
+			hedge:      &slowProvider{name: "hedge", err: errHedge},
+			wantErr:    errPrimary,
+			wantHedged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := WithHedging(tt.primary, tt.hedge, "hedge-model", 50*time.Millisecond)
+			start := time.Now()
+			resp, err := provider.Chat(context.Background(), nil, nil, "primary-model", nil)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Chat() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && resp.Content != tt.want {
+				t.Errorf("Chat() answered by %s, want %s", resp.Content, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("Chat() took %v, the slow request should not be awaited", elapsed)
+			}
+			if hedged := tt.hedge.calls.Load() > 0; hedged != tt.wantHedged {
+				t.Errorf("hedge called = %v, want %v", hedged, tt.wantHedged)
+			}
+			if tt.wantHedged {
+				if model, _ := tt.hedge.model.Load().(string); model != "hedge-model" {
+					t.Errorf("hedge got model %q", model)
+				}
+			}
+
+			if tt.wantCancels != "" {
+				loser := tt.primary
+				if tt.wantCancels == "hedge" {
+					loser = tt.hedge
+				}
+				deadline := time.Now().Add(time.Second)
+				for !loser.cancelled.Load() && time.Now().Before(deadline) {
+					time.Sleep(5 * time.Millisecond)
+				}
+				if !loser.cancelled.Load() {
+					t.Errorf("%s request was not cancelled", tt.wantCancels)
+				}
+			}
+		})
+	}
+}
+
+func TestHedgedProviderCallerCancel(t *testing.T) {
+	primary := &slowProvider{name: "primary", delay: time.Second}
+	provider := WithHedging(primary, &slowProvider{name: "hedge", delay: time.Second}, "", time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := provider.Chat(ctx, nil, nil, "m", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the caller's deadline, got %v", err)
+	}
+}
@@ -13,12 +13,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"strings"
-	"time"
 
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+	"github.com/sipeed/picoclaw/pkg/privacy"
+	"github.com/sipeed/picoclaw/pkg/trace"
 )
 
 type HTTPProvider struct {
@@ -28,23 +29,10 @@ type HTTPProvider struct {
 }
 
 func NewHTTPProvider(apiKey, apiBase, proxy string) *HTTPProvider {
-	client := &http.Client{
-		Timeout: 120 * time.Second,
-	}
-
-	if proxy != "" {
-		proxyURL, err := url.Parse(proxy)
-		if err == nil {
-			client.Transport = &http.Transport{
-				Proxy: http.ProxyURL(proxyURL),
-			}
-		}
-	}
-
 	return &HTTPProvider{
 		apiKey:     apiKey,
 		apiBase:    strings.TrimRight(apiBase, "/"),
-		httpClient: client,
+		httpClient: sharedHTTPClient(proxy),
 	}
 }
 
@@ -71,9 +59,10 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 		requestBody["tool_choice"] = "auto"
 	}
 
+	caps, _ := DefaultModels.Lookup(model)
+
 	if maxTokens, ok := options["max_tokens"].(int); ok {
-		lowerModel := strings.ToLower(model)
-		if strings.Contains(lowerModel, "glm") || strings.Contains(lowerModel, "o1") {
+		if caps.UsesMaxCompletionTokens {
 			requestBody["max_completion_tokens"] = maxTokens
 		} else {
 			requestBody["max_tokens"] = maxTokens
@@ -81,10 +70,9 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 	}
 
 	if temperature, ok := options["temperature"].(float64); ok {
-		lowerModel := strings.ToLower(model)
-		// Kimi k2 models only support temperature=1
-		if strings.Contains(lowerModel, "kimi") && strings.Contains(lowerModel, "k2") {
-			requestBody["temperature"] = 1.0
+		// Some models (e.g. Kimi k2) only accept one temperature
+		if caps.FixedTemperature != 0 {
+			requestBody["temperature"] = caps.FixedTemperature
 		} else {
 			requestBody["temperature"] = temperature
 		}
@@ -104,6 +92,10 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 	if p.apiKey != "" {
 		req.Header.Set("Authorization", "Bearer "+p.apiKey)
 	}
+	// Lets gateways such as LiteLLM log the request under the same trace
+	if id := trace.ID(ctx); id != "" {
+		req.Header.Set(trace.Header, id)
+	}
 
 	resp, err := p.httpClient.Do(req)
 	if err != nil {
@@ -117,7 +109,15 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
+		err := fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
+		// OpenAI-compatible APIs report exhausted credit as a 429
+		if resp.StatusCode == http.StatusTooManyRequests && strings.Contains(string(body), "insufficient_quota") {
+			return nil, fmt.Errorf("%w: %w", errs.ErrBudgetExceeded, err)
+		}
+		if classified := errs.FromHTTPStatus(resp.StatusCode, resp.Header.Get("Retry-After"), err); classified != nil {
+			return nil, classified
+		}
+		return nil, err
 	}
 
 	return p.parseResponse(body)
@@ -220,8 +220,16 @@ func createCodexAuthProvider() (LLMProvider, error) {
 }
 
 func CreateProvider(cfg *config.Config) (LLMProvider, error) {
-	model := cfg.Agents.Defaults.Model
-	providerName := strings.ToLower(cfg.Agents.Defaults.Provider)
+	return CreateProviderFor(cfg, cfg.Agents.Defaults.Provider, cfg.Agents.Defaults.Model)
+}
+
+// CreateProviderFor creates the provider for model, using providerName when
+// it is configured and detecting the provider from the model name otherwise.
+func CreateProviderFor(cfg *config.Config, providerName, model string) (LLMProvider, error) {
+	providerName = strings.ToLower(providerName)
+	if cfg.Privacy.LocalOnly {
+		return createLocalProvider(cfg, providerName, model)
+	}
 
 	var apiKey, apiBase, proxy string
 
@@ -448,3 +456,36 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 
 	return NewHTTPProvider(apiKey, apiBase, proxy), nil
 }
+
+// createLocalProvider creates the provider in local-only mode, where only
+// ollama and vllm serve models, and only from the local network
+func createLocalProvider(cfg *config.Config, providerName, model string) (LLMProvider, error) {
+	var apiKey, apiBase, proxy string
+	switch {
+	case providerName == "vllm" || (providerName == "" && cfg.Providers.VLLM.APIBase != "" && !strings.HasPrefix(strings.ToLower(model), "ollama")):
+		apiKey = cfg.Providers.VLLM.APIKey
+		apiBase = cfg.Providers.VLLM.APIBase
+		proxy = cfg.Providers.VLLM.Proxy
+		if apiBase == "" {
+			return nil, fmt.Errorf("no API base configured for vllm (model: %s)", model)
+		}
+	case providerName == "ollama" || providerName == "":
+		apiKey = cfg.Providers.Ollama.APIKey
+		apiBase = cfg.Providers.Ollama.APIBase
+		proxy = cfg.Providers.Ollama.Proxy
+		if apiBase == "" {
+			apiBase = "http://localhost:11434/v1"
+		}
+	default:
+		return nil, fmt.Errorf("%w: provider %s is not a local backend, use ollama or vllm", privacy.ErrCloudEndpoint, providerName)
+	}
+
+	allow := cfg.Privacy.AllowHosts
+	if !privacy.IsLocalURL(apiBase, allow) {
+		return nil, fmt.Errorf("%w: api_base %s (model: %s)", privacy.ErrCloudEndpoint, apiBase, model)
+	}
+	if proxy != "" && !privacy.IsLocalURL(proxy, allow) {
+		return nil, fmt.Errorf("%w: proxy %s", privacy.ErrCloudEndpoint, proxy)
+	}
+	return NewHTTPProvider(apiKey, apiBase, proxy), nil
+}
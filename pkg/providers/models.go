@@ -0,0 +1,221 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// maxModelSuggestions bounds the close matches offered for an unknown model
+const maxModelSuggestions = 3
+
+// ModelLister is implemented by providers that can list the models they serve.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// ModelCheck is the result of validating the configured model.
+type ModelCheck struct {
+	Model       string
+	Supported   bool     // The provider can list its models
+	Found       bool     // The model is in the list
+	Suggestions []string // Close matches when the model was not found
+	Err         error    // Listing failed
+}
+
+// String renders the check for status output.
+func (c ModelCheck) String() string {
+	switch {
+	case !c.Supported:
+		return "not checked (provider cannot list models)"
+	case c.Err != nil:
+		return fmt.Sprintf("not checked (%v)", c.Err)
+	case c.Found:
+		return "✓ available"
+	case len(c.Suggestions) > 0:
+		return fmt.Sprintf("✗ not found, did you mean: %s?", strings.Join(c.Suggestions, ", "))
+	default:
+		return "✗ not found"
+	}
+}
+
+// CheckModel verifies that the provider serves the model.
+func CheckModel(ctx context.Context, provider LLMProvider, model string) ModelCheck {
+	check := ModelCheck{Model: model}
+
+	lister, ok := unwrapProvider(provider).(ModelLister)
+	if !ok {
+		return check
+	}
+	check.Supported = true
+
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+
+	candidates := []string{strings.ToLower(model)}
+	// Providers list ids without the routing prefix (e.g. "groq/llama-3.3-70b")
+	if idx := strings.Index(model, "/"); idx != -1 {
+		candidates = append(candidates, strings.ToLower(model[idx+1:]))
+	}
+	for _, m := range models {
+		for _, c := range candidates {
+			if strings.ToLower(m) == c {
+				check.Found = true
+				return check
+			}
+		}
+	}
+
+	check.Suggestions = suggestModels(candidates[len(candidates)-1], models)
+	return check
+}
+
+// unwrapProvider returns the provider underneath logging/clamping/hedging
+// wrappers.
+func unwrapProvider(provider LLMProvider) LLMProvider {
+	for {
+		switch p := provider.(type) {
+		case *payloadLoggingProvider:
+			provider = p.LLMProvider
+		case *capabilityProvider:
+			provider = p.LLMProvider
+		case *hedgedProvider:
+			provider = p.LLMProvider
+		default:
+			return provider
+		}
+	}
+}
+
+// suggestModels returns the models closest to name by edit distance,
+// preferring ones that contain it or are contained in it.
+func suggestModels(name string, models []string) []string {
+	type scored struct {
+		id    string
+		score int
+	}
+
+	var matches []scored
+	for _, m := range models {
+		lower := strings.ToLower(m)
+		score := levenshtein(name, lower)
+		if strings.Contains(lower, name) || strings.Contains(name, lower) {
+			score /= 2
+		}
+		// Skip models that share almost nothing with the name
+		if score > len(name)/2+2 {
+			continue
+		}
+		matches = append(matches, scored{m, score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		return matches[i].id < matches[j].id
+	})
+
+	var out []string
+	for i := 0; i < len(matches) && i < maxModelSuggestions; i++ {
+		out = append(out, matches[i].id)
+	}
+	return out
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// ListModels queries the OpenAI-compatible /models endpoint.
+func (p *HTTPProvider) ListModels(ctx context.Context) ([]string, error) {
+	if p.apiBase == "" {
+		return nil, fmt.Errorf("API base not configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.apiBase+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("model listing failed with status %d", resp.StatusCode)
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse model list: %w", err)
+	}
+
+	models := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// ListModels lists the models available to the Anthropic account.
+func (p *ClaudeProvider) ListModels(ctx context.Context) ([]string, error) {
+	var opts []option.RequestOption
+	if p.tokenSource != nil {
+		tok, err := p.tokenSource()
+		if err != nil {
+			return nil, fmt.Errorf("refreshing token: %w", err)
+		}
+		opts = append(opts, option.WithAuthToken(tok))
+	}
+
+	var models []string
+	pager := p.client.Models.ListAutoPaging(ctx, anthropic.ModelListParams{}, opts...)
+	for pager.Next() {
+		models = append(models, pager.Current().ID)
+	}
+	if err := pager.Err(); err != nil {
+		return nil, fmt.Errorf("claude model listing: %w", err)
+	}
+	return models, nil
+}
@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newModelServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "unexpected request", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":[{"id":"gpt-4o"},{"id":"gpt-4o-mini"},{"id":"llama-3.3-70b-versatile"},{"id":"whisper-1"}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckModel(t *testing.T) {
+	server := newModelServer(t)
+	provider := NewHTTPProvider("key", server.URL+"/v1", "")
+
+	tests := []struct {
+		name            string
+		model           string
+		wantFound       bool
+		wantSuggestions []string
+	}{
+		{"exact", "gpt-4o", true, nil},
+		{"routing prefix", "groq/llama-3.3-70b-versatile", true, nil},
+		{"typo", "gpt-4o-mni", false, []string{"gpt-4o-mini", "gpt-4o"}},
+		{"unrelated", "claude-opus-4", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CheckModel(context.Background(), provider, tt.model)
+			if !check.Supported || check.Err != nil {
+				t.Fatalf("unexpected check result: %+v", check)
+			}
+			if check.Found != tt.wantFound || !reflect.DeepEqual(check.Suggestions, tt.wantSuggestions) {
+				t.Errorf("CheckModel(%q) = found %v, suggestions %v", tt.model, check.Found, check.Suggestions)
+			}
+		})
+	}
+}
+
+func TestCheckModelUnwrapsAndReportsErrors(t *testing.T) {
+	server := newModelServer(t)
+
+	wrapped := WithModelCapabilities(NewHTTPProvider("key", server.URL+"/v1", ""), NewModelRegistry())
+	if check := CheckModel(context.Background(), wrapped, "gpt-4o"); !check.Found {
+		t.Errorf("wrapped provider should still be checked: %+v", check)
+	}
+
+	badKey := CheckModel(context.Background(), NewHTTPProvider("wrong", server.URL+"/v1", ""), "gpt-4o")
+	if badKey.Err == nil || !strings.Contains(badKey.String(), "not checked") {
+		t.Errorf("expected listing error, got %+v", badKey)
+	}
+
+	if check := CheckModel(context.Background(), &recordingProvider{}, "gpt-4o"); check.Supported {
+		t.Error("providers without listing support should be skipped")
+	}
+}
@@ -0,0 +1,251 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/trace"
+)
+
+// PayloadRecord is one provider round trip as written to the debug log.
+type PayloadRecord struct {
+	Time       time.Time              `json:"time"`
+	TraceID    string                 `json:"trace_id,omitempty"`
+	Model      string                 `json:"model"`
+	Messages   []Message              `json:"messages"`
+	Tools      []ToolDefinition       `json:"tools,omitempty"`
+	Options    map[string]interface{} `json:"options,omitempty"`
+	Response   *LLMResponse           `json:"response,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+}
+
+var payloadRedactions = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`), "Bearer [REDACTED]"},
+	{regexp.MustCompile(`\b(?:sk|pk|rk|gsk|xox[abpr])[-_][A-Za-z0-9_-]{16,}`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`(?i)(\\?"(?:api_?key|access_?token|token|secret|password)\\?"\s*:\s*\\?")[^"\\]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)\b((?:api_?key|access_?token|token|secret|password)=)[^\s&"]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\+\d[\d\s().-]{6,}\d`), "[PHONE]"},
+	{regexp.MustCompile(`\b\d{3}[\s.-]\d{3}[\s.-]\d{4}\b`), "[PHONE]"},
+}
+
+// PayloadLogger writes full provider requests and responses to an encrypted
+// debug log. Each line is one AES-256-GCM sealed record, base64 encoded.
+// Records are redacted before encryption, so the log stays safe to share
+// once decrypted. Logging can be toggled at runtime.
+type PayloadLogger struct {
+	path    string
+	aead    cipher.AEAD
+	enabled atomic.Bool
+
+	mu      sync.Mutex
+	secrets []string
+}
+
+// NewPayloadLogger creates a debug log writer. The encryption key is derived
+// from key, which is required.
+func NewPayloadLogger(path, key string) (*PayloadLogger, error) {
+	if path == "" {
+		return nil, fmt.Errorf("debug log path is required")
+	}
+	aead, err := payloadCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &PayloadLogger{path: path, aead: aead}, nil
+}
+
+func payloadCipher(key string) (cipher.AEAD, error) {
+	if key == "" {
+		return nil, fmt.Errorf("debug log encryption key is required")
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Path returns the debug log file path.
+func (l *PayloadLogger) Path() string {
+	return l.path
+}
+
+// SetEnabled turns payload logging on or off.
+func (l *PayloadLogger) SetEnabled(enabled bool) {
+	l.enabled.Store(enabled)
+}
+
+// Enabled reports whether payloads are currently being logged.
+func (l *PayloadLogger) Enabled() bool {
+	return l.enabled.Load()
+}
+
+// AddSecrets registers literal values (e.g. configured API keys) that are
+// always redacted, whatever their format.
+func (l *PayloadLogger) AddSecrets(secrets ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range secrets {
+		// Very short values would redact ordinary words
+		if len(s) >= 8 {
+			l.secrets = append(l.secrets, s)
+		}
+	}
+}
+
+// Redact removes API keys, credentials, e-mail addresses and phone numbers.
+func (l *PayloadLogger) Redact(s string) string {
+	l.mu.Lock()
+	secrets := l.secrets
+	l.mu.Unlock()
+
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, "[REDACTED]")
+	}
+	return RedactText(s)
+}
+
+// RedactText removes API keys, credentials, e-mail addresses and phone
+// numbers, as the debug log does, without the logger's known secrets.
+func RedactText(s string) string {
+	for _, r := range payloadRedactions {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	return s
+}
+
+// Log redacts, encrypts and appends a record. It is a no-op when disabled.
+func (l *PayloadLogger) Log(rec PayloadRecord) error {
+	if !l.Enabled() {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(rec); err != nil {
+		return fmt.Errorf("failed to encode payload record: %w", err)
+	}
+	plaintext := []byte(l.Redact(strings.TrimSuffix(buf.String(), "\n")))
+
+	nonce := make([]byte, l.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := l.aead.Seal(nonce, nonce, plaintext, nil)
+	line := base64.StdEncoding.EncodeToString(sealed) + "\n"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return fmt.Errorf("failed to create debug log directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open debug log: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(line)
+	return err
+}
+
+// DecryptPayloadLog reads an encrypted debug log and writes one JSON record
+// per line to w.
+func DecryptPayloadLog(r io.Reader, w io.Writer, key string) error {
+	aead, err := payloadCipher(key)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(sealed) < aead.NonceSize() {
+			return fmt.Errorf("line %d: malformed record", lineNo)
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return fmt.Errorf("line %d: decryption failed (wrong key?)", lineNo)
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", plaintext); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// payloadLoggingProvider records every Chat call while its logger is enabled.
+type payloadLoggingProvider struct {
+	LLMProvider
+	log *PayloadLogger
+}
+
+// WithPayloadLogging wraps a provider so its requests and responses are
+// written to the debug log.
+func WithPayloadLogging(provider LLMProvider, log *PayloadLogger) LLMProvider {
+	if log == nil {
+		return provider
+	}
+	return &payloadLoggingProvider{LLMProvider: provider, log: log}
+}
+
+func (p *payloadLoggingProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	if !p.log.Enabled() {
+		return p.LLMProvider.Chat(ctx, messages, tools, model, options)
+	}
+
+	start := time.Now()
+	resp, err := p.LLMProvider.Chat(ctx, messages, tools, model, options)
+
+	rec := PayloadRecord{
+		Time:       start.UTC(),
+		TraceID:    trace.ID(ctx),
+		Model:      model,
+		Messages:   messages,
+		Tools:      tools,
+		Options:    options,
+		Response:   resp,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	// A failing debug log must never break the conversation
+	_ = p.log.Log(rec)
+
+	return resp, err
+}
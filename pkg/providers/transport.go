@@ -0,0 +1,179 @@
+package providers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/privacy"
+)
+
+const (
+	defaultMaxIdleConnsPerHost = 16
+	defaultIdleConnTimeout     = 5 * time.Minute
+	providerRequestTimeout     = 120 * time.Second
+	warmUpTimeout              = 10 * time.Second
+)
+
+// transportSettings tunes the shared provider transports
+type transportSettings struct {
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	disableHTTP2        bool
+}
+
+// transports holds one transport per proxy ("" for direct connections), so
+// providers talking to the same host reuse each other's connections.
+var transports = struct {
+	sync.Mutex
+	settings transportSettings
+	byProxy  map[string]*http.Transport
+}{byProxy: map[string]*http.Transport{}}
+
+// ConfigureHTTP sets the connection pool settings of the provider HTTP
+// clients. Call it before creating providers; existing transports keep their
+// settings.
+func ConfigureHTTP(cfg config.ProviderHTTPConfig) {
+	configureTransport(transportSettings{
+		maxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		maxConnsPerHost:     cfg.MaxConnsPerHost,
+		idleConnTimeout:     time.Duration(cfg.IdleConnTimeoutSeconds) * time.Second,
+		disableHTTP2:        cfg.DisableHTTP2,
+	})
+}
+
+func configureTransport(s transportSettings) {
+	transports.Lock()
+	defer transports.Unlock()
+	transports.settings = s
+	transports.byProxy = map[string]*http.Transport{}
+}
+
+// sharedTransport returns the pooled transport for proxy
+func sharedTransport(proxy string) *http.Transport {
+	transports.Lock()
+	defer transports.Unlock()
+
+	if t, ok := transports.byProxy[proxy]; ok {
+		return t
+	}
+	t := newProviderTransport(transports.settings, proxy)
+	transports.byProxy[proxy] = t
+	return t
+}
+
+// sharedHTTPClient returns a client with the request timeout of the HTTP
+// providers on top of the pooled transport for proxy
+func sharedHTTPClient(proxy string) *http.Client {
+	return &http.Client{
+		Timeout:   providerRequestTimeout,
+		Transport: guardedTransport(proxy),
+	}
+}
+
+// guardedTransport returns the pooled transport for proxy, refusing hosts
+// outside the local network in local-only mode
+func guardedTransport(proxy string) http.RoundTripper {
+	return privacy.Guard(sharedTransport(proxy))
+}
+
+func newProviderTransport(s transportSettings, proxy string) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if s.maxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = s.maxIdleConnsPerHost
+	}
+	if t.MaxIdleConns < t.MaxIdleConnsPerHost {
+		t.MaxIdleConns = t.MaxIdleConnsPerHost
+	}
+	t.MaxConnsPerHost = s.maxConnsPerHost
+	t.IdleConnTimeout = defaultIdleConnTimeout
+	if s.idleConnTimeout > 0 {
+		t.IdleConnTimeout = s.idleConnTimeout
+	}
+
+	t.ForceAttemptHTTP2 = !s.disableHTTP2
+	if s.disableHTTP2 {
+		// A non-nil empty map turns off HTTP/2 negotiation
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			logger.WarnCF("provider", "Ignoring invalid proxy URL",
+				map[string]interface{}{"proxy": proxy, "error": err.Error()})
+		} else {
+			t.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	return t
+}
+
+// warmer is implemented by providers that can open their connections ahead
+// of the first request
+type warmer interface {
+	WarmUp(ctx context.Context) error
+}
+
+// WarmUp opens the connections of provider, and of the providers it wraps,
+// so the first message does not wait for DNS, TCP and TLS setup.
+func WarmUp(ctx context.Context, provider LLMProvider) error {
+	ctx, cancel := context.WithTimeout(ctx, warmUpTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, p := range warmTargets(provider) {
+		if w, ok := p.(warmer); ok {
+			if err := w.WarmUp(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// warmTargets returns the providers doing the requests for provider
+func warmTargets(provider LLMProvider) []LLMProvider {
+	switch p := provider.(type) {
+	case *hedgedProvider:
+		return append(warmTargets(p.LLMProvider), warmTargets(p.hedge)...)
+	case *payloadLoggingProvider:
+		return warmTargets(p.LLMProvider)
+	case *capabilityProvider:
+		return warmTargets(p.LLMProvider)
+	default:
+		return []LLMProvider{provider}
+	}
+}
+
+// warmURL sends a HEAD request to rawURL. Any response means the connection
+// is open; the status does not matter.
+func warmURL(ctx context.Context, client *http.Client, rawURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("warm up %s: %w", rawURL, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("warm up %s: %w", rawURL, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// WarmUp opens a connection to the API host
+func (p *HTTPProvider) WarmUp(ctx context.Context) error {
+	return warmURL(ctx, p.httpClient, p.apiBase)
+}
@@ -0,0 +1,79 @@
+package providers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSharedTransport(t *testing.T) {
+	configureTransport(transportSettings{maxIdleConnsPerHost: 4, idleConnTimeout: time.Minute})
+	t.Cleanup(func() { configureTransport(transportSettings{}) })
+
+	direct := sharedTransport("")
+	if sharedTransport("") != direct {
+		t.Error("direct connections should share one transport")
+	}
+	proxied := sharedTransport("http://127.0.0.1:3128")
+	if proxied == direct {
+		t.Error("a proxy should get its own transport")
+	}
+
+	if direct.MaxIdleConnsPerHost != 4 || direct.IdleConnTimeout != time.Minute || !direct.ForceAttemptHTTP2 {
+		t.Errorf("settings not applied: idle/host=%d idle timeout=%v h2=%v",
+			direct.MaxIdleConnsPerHost, direct.IdleConnTimeout, direct.ForceAttemptHTTP2)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+	if u, err := proxied.Proxy(req); err != nil || u == nil || u.Host != "127.0.0.1:3128" {
+		t.Errorf("proxy not applied: %v, %v", u, err)
+	}
+
+	configureTransport(transportSettings{disableHTTP2: true})
+	if tr := sharedTransport(""); tr == direct || tr.ForceAttemptHTTP2 || tr.TLSNextProto == nil {
+		t.Error("reconfiguring should build a new transport without HTTP/2")
+	}
+}
+
+func TestWarmUpReusesConnection(t *testing.T) {
+	configureTransport(transportSettings{})
+	t.Cleanup(func() { configureTransport(transportSettings{}) })
+
+	var conns, heads atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+		}
+		w.WriteHeader(http.StatusNotFound) // Any response opens the connection
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	primary := NewHTTPProvider("key", srv.URL, "")
+	hedge := NewHTTPProvider("key", srv.URL+"/v1", "")
+	provider := WithModelCapabilities(WithHedging(primary, hedge, "", time.Second), nil)
+
+	if err := WarmUp(context.Background(), provider); err != nil {
+		t.Fatalf("WarmUp: %v", err)
+	}
+	if heads.Load() != 2 {
+		t.Errorf("expected the primary and the hedge to be warmed, got %d requests", heads.Load())
+	}
+
+	resp, err := primary.httpClient.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if conns.Load() != 1 {
+		t.Errorf("expected every request to reuse the warmed connection, got %d connections", conns.Load())
+	}
+}
@@ -0,0 +1,50 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWhisperTranscriber(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("model") != "whisper-1" {
+			http.Error(w, "bad model", http.StatusBadRequest)
+			return
+		}
+		if _, header, err := r.FormFile("file"); err != nil || header.Filename != "voice.ogg" {
+			http.Error(w, "missing file", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"text":"call me back","language":"en"}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "voice.ogg")
+	if err := os.WriteFile(path, []byte("OggS"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	transcriber := NewWhisperTranscriber("sk-test", server.URL+"/v1/", "", "")
+	result, err := transcriber.Transcribe(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if result.Text != "call me back" || result.Language != "en" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	if _, err := NewWhisperTranscriber("sk-wrong", server.URL+"/v1", "", "").Transcribe(context.Background(), path); err == nil {
+		t.Error("expected an error on a rejected request")
+	}
+	if NewWhisperTranscriber("", "", "", "").IsAvailable() {
+		t.Error("a transcriber without an API key should not be available")
+	}
+}
@@ -0,0 +1,234 @@
+// Package redis is a small Redis client speaking RESP, enough for the
+// message bus broker and the session store without a driver dependency.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DialTimeout bounds connecting and logging in, and commands run without a
+// context deadline
+const DialTimeout = 15 * time.Second
+
+// Client runs commands on a server. Do shares one connection, dialled
+// again when lost; Dial opens a connection of its own, for blocking reads.
+type Client struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+
+	mu     sync.Mutex // Guards conn
+	conn   *Conn
+	closed bool
+}
+
+// New returns a client for the server at rawURL, written as
+// redis://[user:password@]host[:port][/db], or rediss:// for TLS.
+// Connections are opened when first needed.
+func New(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis url: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("redis url: want redis:// or rediss://, got %q", rawURL)
+	}
+	c := &Client{
+		addr:   u.Host,
+		useTLS: u.Scheme == "rediss",
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis url: bad database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// Do runs a command on the shared connection, dialling again once when
+// the connection was lost. See Conn.Do for the replies.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, errors.New("redis client closed")
+	}
+
+	for attempt := 0; ; attempt++ {
+		if c.conn == nil {
+			conn, err := c.Dial(ctx)
+			if err != nil {
+				return nil, err
+			}
+			c.conn = conn
+		}
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(DialTimeout)
+		}
+		c.conn.conn.SetDeadline(deadline)
+		reply, err := c.conn.Do(args...)
+		var redisErr Error
+		if err == nil || errors.As(err, &redisErr) {
+			return reply, err
+		}
+		c.conn.Close()
+		c.conn = nil
+		if attempt > 0 || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+}
+
+// Dial opens a connection, logged in and on the right database
+func (c *Client) Dial(ctx context.Context) (*Conn, error) {
+	dialer := &net.Dialer{Timeout: DialTimeout}
+	var conn net.Conn
+	var err error
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.addr)
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", c.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	rc := &Conn{conn: conn, r: bufio.NewReader(conn)}
+
+	conn.SetDeadline(time.Now().Add(DialTimeout))
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := rc.Do(args...); err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("redis auth: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.Do("SELECT", strconv.Itoa(c.db)); err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("redis select: %w", err)
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	return rc, nil
+}
+
+// Close closes the shared connection. Connections from Dial are closed by
+// their users.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	return nil
+}
+
+// Error is an error reply of the server; the connection stays usable
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Conn speaks RESP over one connection, a command at a time
+type Conn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	closeOnce sync.Once
+}
+
+func (c *Conn) Close() {
+	c.closeOnce.Do(func() { c.conn.Close() })
+}
+
+// Do sends a command and returns its reply: a string for simple strings,
+// int64 for integers, []byte for bulk strings, []interface{} for arrays, and
+// nil for null replies. Error replies are returned as Error.
+func (c *Conn) Do(args ...string) (interface{}, error) {
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, cmd.String()); err != nil {
+		return nil, err
+	}
+	reply, err := ReadReply(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(Error); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+// ReadReply reads one reply. Error replies are returned as values, so that
+// an error nested in an array does not cut the reply short.
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return Error(rest), nil
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = ReadReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
@@ -0,0 +1,322 @@
+// Package s3 is a small client for S3 compatible object stores. It signs
+// requests with AWS Signature Version 4 and needs no SDK.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/errs"
+)
+
+// DefaultRegion is used when the config leaves the region empty
+const DefaultRegion = "us-east-1"
+
+const (
+	amzDateFormat  = "20060102T150405Z"
+	amzAlgorithm   = "AWS4-HMAC-SHA256"
+	amzService     = "s3"
+	amzTerminator  = "aws4_request"
+	amzContentHash = "X-Amz-Content-Sha256"
+	amzDateHeader  = "X-Amz-Date"
+)
+
+// unsignedHeaders may be changed on the way to the store
+var unsignedHeaders = map[string]bool{
+	"authorization":   true,
+	"user-agent":      true,
+	"content-length":  true,
+	"accept-encoding": true,
+}
+
+// Client reads and writes the objects of one bucket
+type Client struct {
+	endpoint  *url.URL
+	pathStyle bool
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	http      *http.Client
+	now       func() time.Time
+}
+
+// New creates a client for the bucket in cfg. Without an endpoint the
+// bucket is reached on AWS with virtual-hosted URLs; custom endpoints use
+// path-style URLs, which MinIO and most other stores expect.
+func New(cfg config.S3Config) (*Client, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("%w: s3 bucket is required", errs.ErrValidation)
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("%w: s3 access_key and secret_key are required", errs.ErrValidation)
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	raw, pathStyle := cfg.Endpoint, true
+	if raw == "" {
+		raw, pathStyle = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cfg.Bucket, region), false
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(raw, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: invalid s3 endpoint %q", errs.ErrValidation, raw)
+	}
+
+	return &Client{
+		endpoint:  endpoint,
+		pathStyle: pathStyle,
+		region:    region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		http:      &http.Client{Timeout: 60 * time.Second},
+		now:       time.Now,
+	}, nil
+}
+
+// SetHTTPClient replaces the HTTP client, e.g. to limit bandwidth
+func (c *Client) SetHTTPClient(hc *http.Client) {
+	c.http = hc
+}
+
+// Put stores body under key, replacing any object already there, and
+// returns the ETag of the new object
+func (c *Client) Put(ctx context.Context, key string, body []byte, contentType string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(req, body)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// Get opens the object under key. The caller closes the body.
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object under key. Missing objects are not an error.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Object describes a stored object
+type Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	ETag         string    `xml:"ETag"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// listResult is a page of a ListObjectsV2 response
+type listResult struct {
+	Contents              []Object `xml:"Contents"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// List returns every object whose key starts with prefix
+func (c *Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL("")+"?"+canonicalQuery(query), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list: %w", err)
+		}
+
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// objectURL returns the URL of key, with each path segment escaped
+func (c *Client) objectURL(key string) string {
+	u := *c.endpoint
+	path := "/" + strings.TrimPrefix(key, "/")
+	if c.pathStyle {
+		path = "/" + c.bucket + path
+	}
+	u.Path = u.Path + path
+	u.RawPath = c.endpoint.EscapedPath() + uriEncode(path, false)
+	return u.String()
+}
+
+// do signs and sends req, turning error statuses into errors
+func (c *Client) do(req *http.Request, body []byte) (*http.Response, error) {
+	c.sign(req, body, c.now())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s: %w", req.Method, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(detail)))
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return nil, &errs.RateLimitError{RetryAfter: errs.ParseRetryAfter(resp.Header.Get("Retry-After"), c.now()), Err: err}
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// sign adds the Signature Version 4 headers to req. Every header already
+// set on req is signed, along with the host.
+func (c *Client) sign(req *http.Request, body []byte, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format(amzDateFormat)
+	payloadHash := sha256Hex(body)
+	req.Header.Set(amzDateHeader, amzDate)
+	req.Header.Set(amzContentHash, payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if unsignedHeaders[name] {
+			continue
+		}
+		headers[name] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{t.Format("20060102"), c.region, amzService, amzTerminator}, "/")
+	stringToSign := strings.Join([]string{amzAlgorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), t.Format("20060102"))
+	for _, part := range []string{c.region, amzService, amzTerminator} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		amzAlgorithm, c.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery sorts and strictly escapes query parameters
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything but unreserved characters, and slashes
+// unless encodeSlash is set, as Signature Version 4 requires
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
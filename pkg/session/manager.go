@@ -1,45 +1,189 @@
 package session
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
+// expireInterval is how often sessions idle past the TTL are looked for
+const expireInterval = 10 * time.Minute
+
+// Session is the conversation of a chat, keyed by Key(channel, chatID)
 type Session struct {
 	Key      string              `json:"key"`
 	Messages []providers.Message `json:"messages"`
 	Summary  string              `json:"summary,omitempty"`
-	Created  time.Time           `json:"created"`
-	Updated  time.Time           `json:"updated"`
+	// Settings of the chat, such as its language, given to the agent
+	Settings map[string]string `json:"settings,omitempty"`
+	Created  time.Time         `json:"created"`
+	Updated  time.Time         `json:"updated"`
+
+	scratch bool // Forked sessions live in memory only
+}
+
+// Context is what the agent builds a turn's context from
+type Context struct {
+	History  []providers.Message
+	Summary  string
+	Settings map[string]string
 }
 
 type SessionManager struct {
 	sessions map[string]*Session
 	mu       sync.RWMutex
-	storage  string
+	store    Store         // nil keeps sessions in memory only
+	ttl      time.Duration // Sessions idle for longer are forgotten; 0 keeps them
+	storeErr error         // Last storage failure; sessions stay in memory while set
+
+	expireMu   sync.Mutex
+	lastExpire time.Time
 }
 
+// NewSessionManager returns a manager keeping sessions as files in
+// storage, or in memory only when storage is empty
 func NewSessionManager(storage string) *SessionManager {
-	sm := &SessionManager{
-		sessions: make(map[string]*Session),
-		storage:  storage,
+	if storage == "" {
+		return NewSessionManagerWithStore(nil, 0)
+	}
+	store, err := NewFileStore(storage)
+	if err != nil {
+		sm := NewSessionManagerWithStore(nil, 0)
+		sm.storeErr = err
+		return sm
+	}
+	return NewSessionManagerWithStore(store, 0)
+}
+
+// NewSessionManagerWithStore returns a manager keeping sessions in store,
+// or in memory only when store is nil. Sessions idle for longer than ttl
+// are forgotten; 0 keeps them.
+func NewSessionManagerWithStore(store Store, ttl time.Duration) *SessionManager {
+	return &SessionManager{
+		sessions:   make(map[string]*Session),
+		store:      store,
+		ttl:        ttl,
+		lastExpire: time.Now(),
+	}
+}
+
+// StoreErr returns why sessions cannot be persisted, or nil when the store
+// is working. It is updated by every Save, so it clears once the store
+// recovers.
+func (sm *SessionManager) StoreErr() error {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.storeErr
+}
+
+func (sm *SessionManager) setStoreErr(err error) {
+	sm.mu.Lock()
+	sm.storeErr = err
+	sm.mu.Unlock()
+}
+
+// expired reports whether session has been idle for longer than the TTL
+func (sm *SessionManager) expired(session *Session) bool {
+	return sm.ttl > 0 && time.Since(session.Updated) > sm.ttl
+}
+
+// load brings the session under key into memory from the store, unless it
+// is there already, and forgets it once expired
+func (sm *SessionManager) load(key string) {
+	sm.expireIdle()
+
+	sm.mu.RLock()
+	session, ok := sm.sessions[key]
+	expired := ok && sm.expired(session)
+	sm.mu.RUnlock()
+
+	if ok {
+		if expired {
+			sm.forget(key, session)
+		}
+		return
+	}
+	if sm.store == nil {
+		return
 	}
 
-	if storage != "" {
-		os.MkdirAll(storage, 0755)
-		sm.loadSessions()
+	stored, err := sm.store.Load(key)
+	if err != nil {
+		logger.WarnCF("session", "Failed to load session", map[string]interface{}{
+			"session_key": key,
+			"error":       err.Error(),
+		})
+		return
+	}
+	if stored == nil || sm.expired(stored) {
+		return
+	}
+
+	sm.mu.Lock()
+	if _, ok := sm.sessions[key]; !ok {
+		sm.sessions[key] = stored
+	}
+	sm.mu.Unlock()
+}
+
+// forget drops session, expired, from memory and the store
+func (sm *SessionManager) forget(key string, session *Session) {
+	sm.mu.Lock()
+	if sm.sessions[key] != session {
+		// Replaced meanwhile
+		sm.mu.Unlock()
+		return
+	}
+	delete(sm.sessions, key)
+	sm.mu.Unlock()
+
+	if sm.store != nil && !session.scratch {
+		if err := sm.store.Delete(key); err != nil {
+			logger.WarnCF("session", "Failed to delete expired session", map[string]interface{}{
+				"session_key": key,
+				"error":       err.Error(),
+			})
+		}
+	}
+}
+
+// expireIdle forgets the sessions idle past the TTL, at most once per
+// expireInterval. The store is swept in the background.
+func (sm *SessionManager) expireIdle() {
+	if sm.ttl <= 0 {
+		return
+	}
+	sm.expireMu.Lock()
+	if time.Since(sm.lastExpire) < expireInterval {
+		sm.expireMu.Unlock()
+		return
 	}
+	sm.lastExpire = time.Now()
+	sm.expireMu.Unlock()
 
-	return sm
+	sm.mu.Lock()
+	for key, session := range sm.sessions {
+		if sm.expired(session) {
+			delete(sm.sessions, key)
+		}
+	}
+	sm.mu.Unlock()
+
+	if sm.store != nil {
+		go func() {
+			if err := sm.store.Expire(time.Now().Add(-sm.ttl)); err != nil {
+				logger.WarnCF("session", "Failed to expire idle sessions", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}()
+	}
 }
 
 func (sm *SessionManager) GetOrCreate(key string) *Session {
+	sm.load(key)
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -69,6 +213,7 @@ func (sm *SessionManager) AddMessage(sessionKey, role, content string) {
 // AddFullMessage adds a complete message with tool calls and tool call ID to the session.
 // This is used to save the full conversation flow including tool calls and tool results.
 func (sm *SessionManager) AddFullMessage(sessionKey string, msg providers.Message) {
+	sm.load(sessionKey)
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -87,6 +232,7 @@ func (sm *SessionManager) AddFullMessage(sessionKey string, msg providers.Messag
 }
 
 func (sm *SessionManager) GetHistory(key string) []providers.Message {
+	sm.load(key)
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
@@ -101,6 +247,7 @@ func (sm *SessionManager) GetHistory(key string) []providers.Message {
 }
 
 func (sm *SessionManager) GetSummary(key string) string {
+	sm.load(key)
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
@@ -112,6 +259,7 @@ func (sm *SessionManager) GetSummary(key string) string {
 }
 
 func (sm *SessionManager) SetSummary(key string, summary string) {
+	sm.load(key)
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -123,6 +271,7 @@ func (sm *SessionManager) SetSummary(key string, summary string) {
 }
 
 func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
+	sm.load(key)
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -145,34 +294,69 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	session.Updated = time.Now()
 }
 
-// sanitizeFilename converts a session key into a cross-platform safe filename.
-// Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
-// volume separator on Windows, so filepath.Base would misinterpret the key.
-// We replace it with '_'. The original key is preserved inside the JSON file,
-// so loadSessions still maps back to the right in-memory key.
-func sanitizeFilename(key string) string {
-	return strings.ReplaceAll(key, ":", "_")
+// GetSettings returns the settings of the chat of a session
+func (sm *SessionManager) GetSettings(key string) map[string]string {
+	sm.load(key)
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return map[string]string{}
+	}
+	settings := make(map[string]string, len(session.Settings))
+	for name, value := range session.Settings {
+		settings[name] = value
+	}
+	return settings
 }
 
-func (sm *SessionManager) Save(key string) error {
-	if sm.storage == "" {
-		return nil
+// SetSetting sets a setting of the chat of a session, creating the session
+// when missing. An empty value removes the setting.
+func (sm *SessionManager) SetSetting(key, name, value string) {
+	sm.load(key)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		session = &Session{
+			Key:      key,
+			Messages: []providers.Message{},
+			Created:  time.Now(),
+		}
+		sm.sessions[key] = session
+	}
+	if value == "" {
+		delete(session.Settings, name)
+	} else {
+		if session.Settings == nil {
+			session.Settings = make(map[string]string)
+		}
+		session.Settings[name] = value
 	}
+	session.Updated = time.Now()
+}
 
-	filename := sanitizeFilename(key)
+// Context returns the history, summary and settings of a session at once
+func (sm *SessionManager) Context(key string) Context {
+	return Context{
+		History:  sm.GetHistory(key),
+		Summary:  sm.GetSummary(key),
+		Settings: sm.GetSettings(key),
+	}
+}
 
-	// filepath.IsLocal rejects empty names, "..", absolute paths, and
-	// OS-reserved device names (NUL, COM1 … on Windows).
-	// The extra checks reject "." and any directory separators so that
-	// the session file is always written directly inside sm.storage.
-	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
-		return os.ErrInvalid
+// Save writes a session to the store
+func (sm *SessionManager) Save(key string) error {
+	if sm.store == nil {
+		return nil
 	}
 
-	// Snapshot under read lock, then perform slow file I/O after unlock.
+	// Snapshot under read lock, then perform slow I/O after unlock.
 	sm.mu.RLock()
 	stored, ok := sm.sessions[key]
-	if !ok {
+	if !ok || stored.scratch {
 		sm.mu.RUnlock()
 		return nil
 	}
@@ -189,84 +373,30 @@ func (sm *SessionManager) Save(key string) error {
 	} else {
 		snapshot.Messages = []providers.Message{}
 	}
-	sm.mu.RUnlock()
-
-	data, err := json.MarshalIndent(snapshot, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	sessionPath := filepath.Join(sm.storage, filename+".json")
-	tmpFile, err := os.CreateTemp(sm.storage, "session-*.tmp")
-	if err != nil {
-		return err
-	}
-
-	tmpPath := tmpFile.Name()
-	cleanup := true
-	defer func() {
-		if cleanup {
-			_ = os.Remove(tmpPath)
+	if len(stored.Settings) > 0 {
+		snapshot.Settings = make(map[string]string, len(stored.Settings))
+		for name, value := range stored.Settings {
+			snapshot.Settings[name] = value
 		}
-	}()
-
-	if _, err := tmpFile.Write(data); err != nil {
-		_ = tmpFile.Close()
-		return err
-	}
-	if err := tmpFile.Chmod(0644); err != nil {
-		_ = tmpFile.Close()
-		return err
-	}
-	if err := tmpFile.Sync(); err != nil {
-		_ = tmpFile.Close()
-		return err
-	}
-	if err := tmpFile.Close(); err != nil {
-		return err
 	}
+	sm.mu.RUnlock()
 
-	if err := os.Rename(tmpPath, sessionPath); err != nil {
-		return err
-	}
-	cleanup = false
-	return nil
+	err := sm.store.Save(&snapshot)
+	sm.setStoreErr(err)
+	return err
 }
 
-func (sm *SessionManager) loadSessions() error {
-	files, err := os.ReadDir(sm.storage)
-	if err != nil {
-		return err
-	}
-
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		if filepath.Ext(file.Name()) != ".json" {
-			continue
-		}
-
-		sessionPath := filepath.Join(sm.storage, file.Name())
-		data, err := os.ReadFile(sessionPath)
-		if err != nil {
-			continue
-		}
-
-		var session Session
-		if err := json.Unmarshal(data, &session); err != nil {
-			continue
-		}
-
-		sm.sessions[session.Key] = &session
+// Close closes the store
+func (sm *SessionManager) Close() error {
+	if sm.store == nil {
+		return nil
 	}
-
-	return nil
+	return sm.store.Close()
 }
 
 // SetHistory updates the messages of a session.
 func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
+	sm.load(key)
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -280,3 +410,41 @@ func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
 		session.Updated = time.Now()
 	}
 }
+
+// Fork copies the history and summary of a session into a scratch session
+// under dst, replacing any session already there. Scratch sessions are never
+// saved to disk.
+func (sm *SessionManager) Fork(src, dst string) {
+	sm.load(src)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	fork := &Session{
+		Key:      dst,
+		Messages: []providers.Message{},
+		Created:  time.Now(),
+		Updated:  time.Now(),
+		scratch:  true,
+	}
+	if session, ok := sm.sessions[src]; ok {
+		fork.Messages = make([]providers.Message, len(session.Messages))
+		copy(fork.Messages, session.Messages)
+		fork.Summary = session.Summary
+		for name, value := range session.Settings {
+			if fork.Settings == nil {
+				fork.Settings = make(map[string]string, len(session.Settings))
+			}
+			fork.Settings[name] = value
+		}
+	}
+	sm.sessions[dst] = fork
+}
+
+// Delete drops a session from memory. Its stored copy, if any, is left
+// alone.
+func (sm *SessionManager) Delete(key string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	delete(sm.sessions, key)
+}
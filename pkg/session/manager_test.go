@@ -72,3 +72,72 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestFork(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+
+	key := "telegram:123456"
+	sm.AddMessage(key, "user", "hello")
+	sm.SetSummary(key, "greetings")
+
+	fork := key + ":fork"
+	sm.Fork(key, fork)
+	sm.AddMessage(fork, "user", "what if?")
+
+	if history := sm.GetHistory(key); len(history) != 1 {
+		t.Errorf("the fork should not change the original, got %d messages", len(history))
+	}
+	if history := sm.GetHistory(fork); len(history) != 2 || history[0].Content != "hello" {
+		t.Errorf("unexpected fork history %+v", history)
+	}
+	if summary := sm.GetSummary(fork); summary != "greetings" {
+		t.Errorf("fork summary = %q, want %q", summary, "greetings")
+	}
+
+	if err := sm.Save(fork); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, sanitizeFilename(fork)+".json")); !os.IsNotExist(err) {
+		t.Error("scratch sessions should not be saved")
+	}
+
+	sm.Delete(fork)
+	if history := sm.GetHistory(fork); len(history) != 0 {
+		t.Errorf("expected the fork to be gone, got %+v", history)
+	}
+}
+
+func TestStoreErr(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	dir := t.TempDir()
+	sm := NewSessionManager(dir)
+	if err := sm.StoreErr(); err != nil {
+		t.Fatalf("StoreErr() = %v", err)
+	}
+
+	os.Chmod(dir, 0555)
+	defer os.Chmod(dir, 0755)
+	sm.AddMessage("telegram:1", "user", "hello")
+	if err := sm.Save("telegram:1"); err == nil || sm.StoreErr() == nil {
+		t.Fatalf("Save() = %v, StoreErr() = %v, want both set", err, sm.StoreErr())
+	}
+	if len(sm.GetHistory("telegram:1")) != 1 {
+		t.Error("history should be kept in memory while the store is down")
+	}
+
+	os.Chmod(dir, 0755)
+	if err := sm.Save("telegram:1"); err != nil || sm.StoreErr() != nil {
+		t.Errorf("Save() = %v, StoreErr() = %v after recovery", err, sm.StoreErr())
+	}
+}
+
+func TestStoreErrUnavailable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0644)
+	if sm := NewSessionManager(filepath.Join(file, "sessions")); sm.StoreErr() == nil {
+		t.Error("StoreErr() should report a storage path that cannot be created")
+	}
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/redis"
+)
+
+// DefaultRedisPrefix starts the keys of the sessions kept in Redis
+const DefaultRedisPrefix = "picoclaw:session:"
+
+// RedisStore keeps each session as a JSON string under a key of its own.
+// Redis expires idle sessions itself.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration // 0 keeps sessions forever
+}
+
+// NewRedisStore returns a store on the server at rawURL, written as
+// redis://[user:password@]host[:port][/db], or rediss:// for TLS. Keys
+// start with prefix; empty selects DefaultRedisPrefix.
+func NewRedisStore(rawURL, prefix string, ttl time.Duration) (*RedisStore, error) {
+	client, err := redis.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix, ttl: ttl}, nil
+}
+
+func (s *RedisStore) Load(key string) (*Session, error) {
+	reply, err := s.client.Do(context.Background(), "GET", s.prefix+key)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, _ := reply.([]byte)
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *RedisStore) Save(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	args := []string{"SET", s.prefix + session.Key, string(data)}
+	if s.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(s.ttl.Milliseconds(), 10))
+	}
+	_, err = s.client.Do(context.Background(), args...)
+	return err
+}
+
+func (s *RedisStore) Delete(key string) error {
+	_, err := s.client.Do(context.Background(), "DEL", s.prefix+key)
+	return err
+}
+
+// Expire does nothing: keys are saved with the TTL
+func (s *RedisStore) Expire(cutoff time.Time) error {
+	return nil
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
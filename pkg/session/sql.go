@@ -0,0 +1,81 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	// Pure Go SQLite driver, registered as "sqlite"; no cgo needed
+	_ "modernc.org/sqlite"
+)
+
+// SQLStore keeps sessions in a table of a SQLite database, through the
+// database/sql driver registered under the given name. The "sqlite" driver
+// is built in.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore opens the database at dsn with driver and creates the
+// sessions table when missing
+func NewSQLStore(driver, dsn string) (*SQLStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("session database: %w", err)
+	}
+	// SQLite takes one writer at a time; a single connection queues them
+	// instead of failing with "database is locked"
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS sessions (
+		session_key TEXT PRIMARY KEY,
+		data        TEXT NOT NULL,
+		updated     INTEGER NOT NULL
+	)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("session database: %w", err)
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Load(key string) (*Session, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM sessions WHERE session_key = ?`, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *SQLStore) Save(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO sessions (session_key, data, updated) VALUES (?, ?, ?)
+		ON CONFLICT (session_key) DO UPDATE SET data = excluded.data, updated = excluded.updated`,
+		session.Key, string(data), session.Updated.Unix())
+	return err
+}
+
+func (s *SQLStore) Delete(key string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE session_key = ?`, key)
+	return err
+}
+
+func (s *SQLStore) Expire(cutoff time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE updated < ?`, cutoff.Unix())
+	return err
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,66 @@
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Store keeps sessions beyond the process. The manager holds the sessions
+// in use in memory, loads the others from its store when first needed and
+// writes them back on Save.
+type Store interface {
+	// Load returns the session kept under key, or nil when there is none
+	Load(key string) (*Session, error)
+	Save(session *Session) error
+	Delete(key string) error
+	// Expire deletes the sessions last updated before cutoff
+	Expire(cutoff time.Time) error
+	Close() error
+}
+
+// Key is the key of the session of a chat
+func Key(channel, chatID string) string {
+	return channel + ":" + chatID
+}
+
+// NewStore opens the store configured by cfg; nil keeps sessions in memory
+// only. Relative and empty paths are taken from workspace.
+func NewStore(cfg config.SessionConfig, workspace string) (Store, error) {
+	path := cfg.Path
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(workspace, path)
+	}
+	switch cfg.Backend {
+	case "", "file":
+		if path == "" {
+			path = filepath.Join(workspace, "sessions")
+		}
+		return NewFileStore(path)
+	case "memory":
+		return nil, nil
+	case "sqlite":
+		if path == "" {
+			path = filepath.Join(workspace, "sessions.db")
+		}
+		return NewSQLStore("sqlite", path)
+	case "redis":
+		return NewRedisStore(cfg.URL, "", time.Duration(cfg.TTLHours)*time.Hour)
+	}
+	return nil, fmt.Errorf("session: unknown backend %q", cfg.Backend)
+}
+
+// Open returns the session manager configured by cfg. When its store
+// cannot be opened, sessions stay in memory and StoreErr says why.
+func Open(cfg config.SessionConfig, workspace string) *SessionManager {
+	ttl := time.Duration(cfg.TTLHours) * time.Hour
+	store, err := NewStore(cfg, workspace)
+	if err != nil {
+		sm := NewSessionManagerWithStore(nil, ttl)
+		sm.storeErr = err
+		return sm
+	}
+	return NewSessionManagerWithStore(store, ttl)
+}
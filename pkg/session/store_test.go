@@ -0,0 +1,244 @@
+package session
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/redis"
+)
+
+func TestSettingsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewSessionManager(dir)
+
+	key := Key("telegram", "42")
+	sm.AddMessage(key, "user", "hallo")
+	sm.SetSetting(key, "language", "German")
+	sm.SetSetting(key, "tone", "formal")
+	sm.SetSetting(key, "tone", "")
+	if err := sm.Save(key); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := NewSessionManager(dir).Context(key)
+	if len(sc.History) != 1 || sc.History[0].Content != "hallo" {
+		t.Errorf("history %+v", sc.History)
+	}
+	if len(sc.Settings) != 1 || sc.Settings["language"] != "German" {
+		t.Errorf("settings %v", sc.Settings)
+	}
+}
+
+func TestSessionTTL(t *testing.T) {
+	for _, backend := range []string{"file", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			store, err := NewStore(config.SessionConfig{Backend: backend}, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			testSessionTTL(t, store)
+		})
+	}
+}
+
+func testSessionTTL(t *testing.T, store Store) {
+	sm := NewSessionManagerWithStore(store, time.Hour)
+
+	sm.AddMessage("telegram:1", "user", "old")
+	sm.GetOrCreate("telegram:1").Updated = time.Now().Add(-2 * time.Hour)
+	sm.AddMessage("telegram:2", "user", "new")
+	sm.Save("telegram:1")
+	sm.Save("telegram:2")
+
+	if history := sm.GetHistory("telegram:1"); len(history) != 0 {
+		t.Errorf("expired session still in memory: %+v", history)
+	}
+	if stored, _ := store.Load("telegram:1"); stored != nil {
+		t.Error("expired session still stored")
+	}
+
+	// A stale copy in the store is not loaded, and is swept away
+	sm.AddMessage("telegram:3", "user", "stale")
+	sm.GetOrCreate("telegram:3").Updated = time.Now().Add(-2 * time.Hour)
+	sm.Save("telegram:3")
+	fresh := NewSessionManagerWithStore(store, time.Hour)
+	if history := fresh.GetHistory("telegram:3"); len(history) != 0 {
+		t.Errorf("expired session loaded: %+v", history)
+	}
+	if history := fresh.GetHistory("telegram:2"); len(history) != 1 {
+		t.Errorf("live session not loaded: %+v", history)
+	}
+	if err := store.Expire(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := store.Load("telegram:3"); stored != nil {
+		t.Error("Expire kept an idle session")
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	workspace := t.TempDir()
+	if store, err := NewStore(config.SessionConfig{Backend: "memory"}, workspace); store != nil || err != nil {
+		t.Errorf("memory: %v, %v", store, err)
+	}
+	if store, err := NewStore(config.SessionConfig{}, workspace); err != nil || store.(*FileStore).dir != workspace+"/sessions" {
+		t.Errorf("file: %+v, %v", store, err)
+	}
+	if _, err := NewStore(config.SessionConfig{Backend: "mongo"}, workspace); err == nil {
+		t.Error("unknown backend accepted")
+	}
+
+	if store, err := NewStore(config.SessionConfig{Backend: "sqlite"}, workspace); err != nil {
+		t.Errorf("sqlite: %v", err)
+	} else {
+		store.Close()
+	}
+
+	// A database in a directory that does not exist cannot be opened
+	sm := Open(config.SessionConfig{Backend: "sqlite", Path: "missing/sessions.db"}, workspace)
+	if sm.StoreErr() == nil {
+		t.Error("StoreErr() should report the unusable database")
+	}
+	sm.AddMessage("telegram:1", "user", "hello")
+	if len(sm.GetHistory("telegram:1")) != 1 {
+		t.Error("sessions should be kept in memory without a store")
+	}
+}
+
+func TestSQLStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := NewSQLStore("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewSessionManagerWithStore(store, 0)
+	sm.AddMessage("slack:C1", "user", "hi")
+	sm.SetSetting("slack:C1", "language", "French")
+	if err := sm.Save("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	// Saving again replaces the row
+	sm.AddMessage("slack:C1", "assistant", "salut")
+	if err := sm.Save("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// The sessions outlive the process
+	store, err = NewSQLStore("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	sc := NewSessionManagerWithStore(store, 0).Context("slack:C1")
+	if len(sc.History) != 2 || sc.History[1].Content != "salut" || sc.Settings["language"] != "French" {
+		t.Errorf("loaded %+v", sc)
+	}
+
+	if err := store.Delete("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Load("slack:C1"); stored != nil || err != nil {
+		t.Errorf("after delete: %+v, %v", stored, err)
+	}
+}
+
+// fakeRedisKV serves GET, SET and DEL
+type fakeRedisKV struct {
+	mu   sync.Mutex
+	data map[string]string
+	ttls map[string]string
+}
+
+func newFakeRedisKV(t *testing.T) (*fakeRedisKV, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedisKV{data: make(map[string]string), ttls: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, "redis://" + ln.Addr().String()
+}
+
+func (f *fakeRedisKV) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		cmd, err := redis.ReadReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range cmd.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+		f.mu.Lock()
+		reply := "+OK\r\n"
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			if v, ok := f.data[args[1]]; ok {
+				reply = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			f.data[args[1]] = args[2]
+			if len(args) == 5 && args[3] == "PX" {
+				f.ttls[args[1]] = args[4]
+			}
+		case "DEL":
+			delete(f.data, args[1])
+			reply = ":1\r\n"
+		}
+		f.mu.Unlock()
+		conn.Write([]byte(reply))
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	f, url := newFakeRedisKV(t)
+	store, err := NewRedisStore(url, "", 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	sm := NewSessionManagerWithStore(store, 2*time.Hour)
+	sm.AddMessage("slack:C1", "user", "hi")
+	sm.SetSetting("slack:C1", "language", "French")
+	if err := sm.Save("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := f.ttls[DefaultRedisPrefix+"slack:C1"]; ttl != "7200000" {
+		t.Errorf("ttl = %q", ttl)
+	}
+
+	sc := NewSessionManagerWithStore(store, 2*time.Hour).Context("slack:C1")
+	if len(sc.History) != 1 || sc.Settings["language"] != "French" {
+		t.Errorf("loaded %+v", sc)
+	}
+
+	if err := store.Delete("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Load("slack:C1"); stored != nil || err != nil {
+		t.Errorf("after delete: %+v, %v", stored, err)
+	}
+}
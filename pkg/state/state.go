@@ -10,9 +10,16 @@ import (
 	"time"
 )
 
+// SchemaVersion is the version of the state file layout, raised whenever
+// it changes incompatibly
+const SchemaVersion = 1
+
 // State represents the persistent state for a workspace.
 // It includes information about the last active channel/chat.
 type State struct {
+	// Version is the SchemaVersion the file was written with
+	Version int `json:"version,omitempty"`
+
 	// LastChannel is the last channel used for communication
 	LastChannel string `json:"last_channel,omitempty"`
 
@@ -121,6 +128,11 @@ func (sm *Manager) GetTimestamp() time.Time {
 	return sm.state.Timestamp
 }
 
+// Path returns the state file
+func (sm *Manager) Path() string {
+	return sm.stateFile
+}
+
 // saveAtomic performs an atomic save using temp file + rename.
 // This ensures that the state file is never corrupted:
 // 1. Write to a temp file
@@ -133,6 +145,7 @@ func (sm *Manager) saveAtomic() error {
 	tempFile := sm.stateFile + ".tmp"
 
 	// Marshal state to JSON
+	sm.state.Version = SchemaVersion
 	data, err := json.MarshalIndent(sm.state, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
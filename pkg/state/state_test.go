@@ -214,3 +214,26 @@ func TestNewManager_EmptyWorkspace(t *testing.T) {
 		t.Error("Expected zero timestamp for new state")
 	}
 }
+
+func TestSchemaVersionIsSaved(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewManager(tmpDir)
+	if want := filepath.Join(tmpDir, "state", "state.json"); sm.Path() != want {
+		t.Errorf("Path() = %q, want %q", sm.Path(), want)
+	}
+
+	if err := sm.SetLastChannel("telegram"); err != nil {
+		t.Fatalf("SetLastChannel failed: %v", err)
+	}
+	data, err := os.ReadFile(sm.Path())
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	var saved State
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Failed to parse state file: %v", err)
+	}
+	if saved.Version != SchemaVersion {
+		t.Errorf("Saved version = %d, want %d", saved.Version, SchemaVersion)
+	}
+}
@@ -11,12 +11,21 @@ type Tool interface {
 }
 
 // ContextualTool is an optional interface that tools can implement
-// to receive the current message context (channel, chatID)
+// to receive the current message context (channel, chatID). Within an
+// agent turn the context comes from the Turn in ctx; SetContext sets it
+// for calls made outside one.
 type ContextualTool interface {
 	Tool
 	SetContext(channel, chatID string)
 }
 
+// SenderAwareTool is an optional interface that tools can implement
+// to receive the sender of the current message
+type SenderAwareTool interface {
+	Tool
+	SetSender(senderID string)
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
@@ -0,0 +1,700 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var issueKeyPattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_]*)-[0-9]+$`)
+
+var issueProjectPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// linearPriorities maps priority names to Linear's numeric priority scale.
+var linearPriorities = map[string]int{
+	"urgent": 1,
+	"high":   2,
+	"medium": 3,
+	"low":    4,
+}
+
+// jiraIssueTypes and jiraPriorities map schema values to Jira's default names.
+var jiraIssueTypes = map[string]string{
+	"bug":   "Bug",
+	"task":  "Task",
+	"story": "Story",
+}
+
+var jiraPriorities = map[string]string{
+	"urgent": "Highest",
+	"high":   "High",
+	"medium": "Medium",
+	"low":    "Low",
+}
+
+// IssueTrackerToolOptions configures an IssueTrackerTool. A provider is enabled when its credentials are set.
+type IssueTrackerToolOptions struct {
+	JiraBaseURL     string
+	JiraEmail       string
+	JiraAPIToken    string
+	LinearAPIKey    string
+	LinearAPIBase   string
+	AllowedProjects []string // Jira project keys / Linear team keys; empty allows all
+}
+
+// IssueTrackerTool creates, searches and transitions tickets in Jira and Linear.
+// Ticket fields are taken from the tool schema so the model fills in a complete,
+// consistently formatted bug report instead of free-form text.
+type IssueTrackerTool struct {
+	jiraBaseURL     string
+	jiraEmail       string
+	jiraToken       string
+	linearAPIKey    string
+	linearAPIBase   string
+	allowedProjects map[string]bool
+	client          *http.Client
+}
+
+// issueDraft holds the structured fields of a ticket to be created.
+type issueDraft struct {
+	Project  string
+	Title    string
+	Type     string
+	Summary  string
+	Steps    []string
+	Expected string
+	Actual   string
+	Priority string
+	Labels   []string
+}
+
+// trackerIssue is the provider-neutral representation of a ticket.
+type trackerIssue struct {
+	Key    string
+	Title  string
+	Status string
+	URL    string
+}
+
+// NewIssueTrackerTool creates a new IssueTrackerTool
+func NewIssueTrackerTool(opts IssueTrackerToolOptions) *IssueTrackerTool {
+	linearBase := opts.LinearAPIBase
+	if linearBase == "" {
+		linearBase = "https://api.linear.app/graphql"
+	}
+
+	allowed := make(map[string]bool, len(opts.AllowedProjects))
+	for _, project := range opts.AllowedProjects {
+		allowed[strings.ToUpper(project)] = true
+	}
+
+	return &IssueTrackerTool{
+		jiraBaseURL:     strings.TrimSuffix(opts.JiraBaseURL, "/"),
+		jiraEmail:       opts.JiraEmail,
+		jiraToken:       opts.JiraAPIToken,
+		linearAPIKey:    opts.LinearAPIKey,
+		linearAPIBase:   linearBase,
+		allowedProjects: allowed,
+		client:          &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (t *IssueTrackerTool) Name() string {
+	return "issue_tracker"
+}
+
+func (t *IssueTrackerTool) Description() string {
+	return "Work with Jira/Linear tickets: create a ticket (e.g. when the user asks to file a bug), search existing tickets, and move a ticket to another status. When creating, fill in the structured fields instead of putting everything in the title."
+}
+
+func (t *IssueTrackerTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"create", "search", "transition"},
+				"description": "Operation to perform",
+			},
+			"provider": map[string]interface{}{
+				"type":        "string",
+				"enum":        t.providers(),
+				"description": "Issue tracker (default: jira if configured, otherwise linear)",
+			},
+			"project": map[string]interface{}{
+				"type":        "string",
+				"description": "Jira project key or Linear team key (for create and search)",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Short, specific ticket title (for create)",
+			},
+			"issue_type": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"bug", "task", "story"},
+				"description": "Ticket type (for create, default: bug)",
+			},
+			"summary": map[string]interface{}{
+				"type":        "string",
+				"description": "One or two sentences describing the problem or request (for create)",
+			},
+			"steps_to_reproduce": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Ordered reproduction steps (for bugs)",
+			},
+			"expected": map[string]interface{}{
+				"type":        "string",
+				"description": "Expected behaviour (for bugs)",
+			},
+			"actual": map[string]interface{}{
+				"type":        "string",
+				"description": "Actual behaviour (for bugs)",
+			},
+			"priority": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"urgent", "high", "medium", "low"},
+				"description": "Ticket priority (for create)",
+			},
+			"labels": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Labels to apply (Jira only)",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Text to search for (for search)",
+			},
+			"key": map[string]interface{}{
+				"type":        "string",
+				"description": "Ticket key such as 'ENG-123' (for transition)",
+			},
+			"status": map[string]interface{}{
+				"type":        "string",
+				"description": "Target status name such as 'In Progress' or 'Done' (for transition)",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of tickets to return (default 10, max 50)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *IssueTrackerTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	if action == "" {
+		return ErrorResult("action is required")
+	}
+
+	provider, _ := args["provider"].(string)
+	if provider == "" {
+		providers := t.providers()
+		if len(providers) == 0 {
+			return ErrorResult("no issue tracker is configured")
+		}
+		provider = providers[0]
+	}
+	if provider == "jira" && t.jiraToken == "" || provider == "linear" && t.linearAPIKey == "" {
+		return ErrorResult(fmt.Sprintf("provider %q is not configured", provider))
+	}
+
+	switch action {
+	case "create":
+		draft := issueDraftFromArgs(args)
+		if draft.Title == "" || draft.Summary == "" {
+			return ErrorResult("title and summary are required for create")
+		}
+		if err := t.checkProject(draft.Project); err != nil {
+			return ErrorResult(err.Error())
+		}
+		var issue *trackerIssue
+		var err error
+		if provider == "linear" {
+			issue, err = t.linearCreate(ctx, draft)
+		} else {
+			issue, err = t.jiraCreate(ctx, draft)
+		}
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to create ticket: %v", err)).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("Created %s: %s\n%s", issue.Key, draft.Title, issue.URL))
+
+	case "search":
+		project, _ := args["project"].(string)
+		if project != "" {
+			if err := t.checkProject(project); err != nil {
+				return ErrorResult(err.Error())
+			}
+		}
+		query, _ := args["query"].(string)
+		limit := 10
+		if v, ok := args["limit"].(float64); ok && v > 0 {
+			limit = int(v)
+		}
+		if limit > 50 {
+			limit = 50
+		}
+		var issues []trackerIssue
+		var err error
+		if provider == "linear" {
+			issues, err = t.linearSearch(ctx, t.searchScope(project), query, limit)
+		} else {
+			issues, err = t.jiraSearch(ctx, t.searchScope(project), query, limit)
+		}
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to search tickets: %v", err)).WithError(err)
+		}
+		return NewToolResult(formatTrackerIssues(query, issues))
+
+	case "transition":
+		key, _ := args["key"].(string)
+		status, _ := args["status"].(string)
+		if key == "" || strings.TrimSpace(status) == "" {
+			return ErrorResult("key and status are required for transition")
+		}
+		match := issueKeyPattern.FindStringSubmatch(key)
+		if match == nil {
+			return ErrorResult(fmt.Sprintf("invalid ticket key %q", key))
+		}
+		if err := t.checkProject(match[1]); err != nil {
+			return ErrorResult(err.Error())
+		}
+		var newStatus string
+		var err error
+		if provider == "linear" {
+			newStatus, err = t.linearTransition(ctx, key, status)
+		} else {
+			newStatus, err = t.jiraTransition(ctx, key, status)
+		}
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to transition %s: %v", key, err)).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("Moved %s to %s", key, newStatus))
+	}
+
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
+
+func (t *IssueTrackerTool) providers() []string {
+	var providers []string
+	if t.jiraToken != "" {
+		providers = append(providers, "jira")
+	}
+	if t.linearAPIKey != "" {
+		providers = append(providers, "linear")
+	}
+	return providers
+}
+
+func (t *IssueTrackerTool) checkProject(project string) error {
+	if project == "" {
+		return fmt.Errorf("project is required")
+	}
+	if !issueProjectPattern.MatchString(project) {
+		return fmt.Errorf("invalid project %q", project)
+	}
+	if len(t.allowedProjects) > 0 && !t.allowedProjects[strings.ToUpper(project)] {
+		return fmt.Errorf("project %q is not in the allowlist", project)
+	}
+	return nil
+}
+
+// searchScope returns the projects a search is restricted to. Without an
+// explicit project, searches cover the whole allowlist.
+func (t *IssueTrackerTool) searchScope(project string) []string {
+	if project != "" {
+		return []string{strings.ToUpper(project)}
+	}
+	scope := make([]string, 0, len(t.allowedProjects))
+	for p := range t.allowedProjects {
+		scope = append(scope, p)
+	}
+	sort.Strings(scope)
+	return scope
+}
+
+func issueDraftFromArgs(args map[string]interface{}) issueDraft {
+	draft := issueDraft{}
+	draft.Project, _ = args["project"].(string)
+	draft.Title, _ = args["title"].(string)
+	draft.Type, _ = args["issue_type"].(string)
+	draft.Summary, _ = args["summary"].(string)
+	draft.Expected, _ = args["expected"].(string)
+	draft.Actual, _ = args["actual"].(string)
+	draft.Priority, _ = args["priority"].(string)
+	draft.Steps = stringSliceArg(args["steps_to_reproduce"])
+	draft.Labels = stringSliceArg(args["labels"])
+
+	draft.Project = strings.ToUpper(strings.TrimSpace(draft.Project))
+	draft.Title = strings.TrimSpace(draft.Title)
+	draft.Summary = strings.TrimSpace(draft.Summary)
+	if _, ok := jiraIssueTypes[draft.Type]; !ok {
+		draft.Type = "bug"
+	}
+	return draft
+}
+
+func stringSliceArg(v interface{}) []string {
+	raw, _ := v.([]interface{})
+	values := make([]string, 0, len(raw))
+	for _, item := range raw {
+		if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+			values = append(values, strings.TrimSpace(s))
+		}
+	}
+	return values
+}
+
+// formatIssueDescription renders the draft as a ticket body. Jira uses wiki
+// markup, Linear uses Markdown.
+func formatIssueDescription(draft issueDraft, markdown bool) string {
+	heading := func(title string) string {
+		if markdown {
+			return "### " + title
+		}
+		return "h3. " + title
+	}
+
+	sections := []string{draft.Summary}
+	if len(draft.Steps) > 0 {
+		lines := []string{heading("Steps to reproduce")}
+		for i, step := range draft.Steps {
+			if markdown {
+				lines = append(lines, fmt.Sprintf("%d. %s", i+1, step))
+			} else {
+				lines = append(lines, "# "+step)
+			}
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+	if draft.Expected != "" {
+		sections = append(sections, heading("Expected")+"\n"+draft.Expected)
+	}
+	if draft.Actual != "" {
+		sections = append(sections, heading("Actual")+"\n"+draft.Actual)
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+func (t *IssueTrackerTool) jiraCreate(ctx context.Context, draft issueDraft) (*trackerIssue, error) {
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": draft.Project},
+		"summary":     draft.Title,
+		"description": formatIssueDescription(draft, false),
+		"issuetype":   map[string]string{"name": jiraIssueTypes[draft.Type]},
+	}
+	if p, ok := jiraPriorities[draft.Priority]; ok {
+		fields["priority"] = map[string]string{"name": p}
+	}
+	if len(draft.Labels) > 0 {
+		fields["labels"] = draft.Labels
+	}
+
+	var resp struct {
+		Key string `json:"key"`
+	}
+	if err := t.jiraDo(ctx, http.MethodPost, "/rest/api/2/issue", map[string]interface{}{"fields": fields}, &resp); err != nil {
+		return nil, err
+	}
+	return &trackerIssue{Key: resp.Key, Title: draft.Title, URL: t.jiraBaseURL + "/browse/" + resp.Key}, nil
+}
+
+func (t *IssueTrackerTool) jiraSearch(ctx context.Context, projects []string, query string, limit int) ([]trackerIssue, error) {
+	var clauses []string
+	if len(projects) > 0 {
+		clauses = append(clauses, fmt.Sprintf("project in (%s)", strings.Join(projects, ", ")))
+	}
+	if query != "" {
+		clauses = append(clauses, fmt.Sprintf("text ~ %s", jqlQuote(query)))
+	}
+	jql := strings.Join(clauses, " AND ") + " ORDER BY updated DESC"
+
+	var resp struct {
+		Issues []struct {
+			Key    string `json:"key"`
+			Fields struct {
+				Summary string `json:"summary"`
+				Status  struct {
+					Name string `json:"name"`
+				} `json:"status"`
+			} `json:"fields"`
+		} `json:"issues"`
+	}
+	endpoint := fmt.Sprintf("/rest/api/2/search?jql=%s&maxResults=%d&fields=summary,status", url.QueryEscape(strings.TrimSpace(jql)), limit)
+	if err := t.jiraDo(ctx, http.MethodGet, endpoint, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	issues := make([]trackerIssue, 0, len(resp.Issues))
+	for _, r := range resp.Issues {
+		issues = append(issues, trackerIssue{
+			Key:    r.Key,
+			Title:  r.Fields.Summary,
+			Status: r.Fields.Status.Name,
+			URL:    t.jiraBaseURL + "/browse/" + r.Key,
+		})
+	}
+	return issues, nil
+}
+
+func (t *IssueTrackerTool) jiraTransition(ctx context.Context, key, status string) (string, error) {
+	var resp struct {
+		Transitions []struct {
+			ID string `json:"id"`
+			To struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	endpoint := fmt.Sprintf("/rest/api/2/issue/%s/transitions", key)
+	if err := t.jiraDo(ctx, http.MethodGet, endpoint, nil, &resp); err != nil {
+		return "", err
+	}
+
+	var available []string
+	for _, tr := range resp.Transitions {
+		if strings.EqualFold(tr.To.Name, status) {
+			payload := map[string]interface{}{"transition": map[string]string{"id": tr.ID}}
+			if err := t.jiraDo(ctx, http.MethodPost, endpoint, payload, nil); err != nil {
+				return "", err
+			}
+			return tr.To.Name, nil
+		}
+		available = append(available, tr.To.Name)
+	}
+	return "", fmt.Errorf("no transition to %q (available: %s)", status, strings.Join(available, ", "))
+}
+
+func (t *IssueTrackerTool) jiraDo(ctx context.Context, method, endpoint string, payload interface{}, out interface{}) error {
+	headers := map[string]string{"Accept": "application/json"}
+	req := func(r *http.Request) {
+		r.SetBasicAuth(t.jiraEmail, t.jiraToken)
+	}
+	return t.do(ctx, "jira", method, t.jiraBaseURL+endpoint, headers, req, payload, out)
+}
+
+func (t *IssueTrackerTool) linearCreate(ctx context.Context, draft issueDraft) (*trackerIssue, error) {
+	teamID, err := t.linearTeamID(ctx, draft.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	input := map[string]interface{}{
+		"teamId":      teamID,
+		"title":       draft.Title,
+		"description": formatIssueDescription(draft, true),
+	}
+	if p, ok := linearPriorities[draft.Priority]; ok {
+		input["priority"] = p
+	}
+
+	var resp struct {
+		IssueCreate struct {
+			Success bool `json:"success"`
+			Issue   struct {
+				Identifier string `json:"identifier"`
+				URL        string `json:"url"`
+			} `json:"issue"`
+		} `json:"issueCreate"`
+	}
+	query := `mutation($input: IssueCreateInput!) { issueCreate(input: $input) { success issue { identifier url } } }`
+	if err := t.linearDo(ctx, query, map[string]interface{}{"input": input}, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.IssueCreate.Success {
+		return nil, fmt.Errorf("linear did not create the issue")
+	}
+	return &trackerIssue{Key: resp.IssueCreate.Issue.Identifier, Title: draft.Title, URL: resp.IssueCreate.Issue.URL}, nil
+}
+
+func (t *IssueTrackerTool) linearTeamID(ctx context.Context, key string) (string, error) {
+	var resp struct {
+		Teams struct {
+			Nodes []struct {
+				ID string `json:"id"`
+			} `json:"nodes"`
+		} `json:"teams"`
+	}
+	query := `query($key: String!) { teams(filter: { key: { eq: $key } }) { nodes { id } } }`
+	if err := t.linearDo(ctx, query, map[string]interface{}{"key": key}, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Teams.Nodes) == 0 {
+		return "", fmt.Errorf("linear team %q not found", key)
+	}
+	return resp.Teams.Nodes[0].ID, nil
+}
+
+func (t *IssueTrackerTool) linearSearch(ctx context.Context, teams []string, text string, limit int) ([]trackerIssue, error) {
+	filter := map[string]interface{}{}
+	if len(teams) > 0 {
+		filter["team"] = map[string]interface{}{"key": map[string]interface{}{"in": teams}}
+	}
+	if text != "" {
+		filter["title"] = map[string]interface{}{"containsIgnoreCase": text}
+	}
+
+	var resp struct {
+		Issues struct {
+			Nodes []struct {
+				Identifier string `json:"identifier"`
+				Title      string `json:"title"`
+				URL        string `json:"url"`
+				State      struct {
+					Name string `json:"name"`
+				} `json:"state"`
+			} `json:"nodes"`
+		} `json:"issues"`
+	}
+	query := `query($filter: IssueFilter, $first: Int) { issues(filter: $filter, first: $first, orderBy: updatedAt) { nodes { identifier title url state { name } } } }`
+	if err := t.linearDo(ctx, query, map[string]interface{}{"filter": filter, "first": limit}, &resp); err != nil {
+		return nil, err
+	}
+
+	issues := make([]trackerIssue, 0, len(resp.Issues.Nodes))
+	for _, r := range resp.Issues.Nodes {
+		issues = append(issues, trackerIssue{Key: r.Identifier, Title: r.Title, Status: r.State.Name, URL: r.URL})
+	}
+	return issues, nil
+}
+
+func (t *IssueTrackerTool) linearTransition(ctx context.Context, key, status string) (string, error) {
+	var issue struct {
+		Issue struct {
+			ID   string `json:"id"`
+			Team struct {
+				States struct {
+					Nodes []struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"nodes"`
+				} `json:"states"`
+			} `json:"team"`
+		} `json:"issue"`
+	}
+	query := `query($id: String!) { issue(id: $id) { id team { states { nodes { id name } } } } }`
+	if err := t.linearDo(ctx, query, map[string]interface{}{"id": key}, &issue); err != nil {
+		return "", err
+	}
+
+	var available []string
+	for _, state := range issue.Issue.Team.States.Nodes {
+		if strings.EqualFold(state.Name, status) {
+			var resp struct {
+				IssueUpdate struct {
+					Success bool `json:"success"`
+				} `json:"issueUpdate"`
+			}
+			mutation := `mutation($id: String!, $stateId: String!) { issueUpdate(id: $id, input: { stateId: $stateId }) { success } }`
+			if err := t.linearDo(ctx, mutation, map[string]interface{}{"id": issue.Issue.ID, "stateId": state.ID}, &resp); err != nil {
+				return "", err
+			}
+			if !resp.IssueUpdate.Success {
+				return "", fmt.Errorf("linear did not update the issue")
+			}
+			return state.Name, nil
+		}
+		available = append(available, state.Name)
+	}
+	return "", fmt.Errorf("no state named %q (available: %s)", status, strings.Join(available, ", "))
+}
+
+func (t *IssueTrackerTool) linearDo(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	headers := map[string]string{"Authorization": t.linearAPIKey}
+	payload := map[string]interface{}{"query": query, "variables": variables}
+	if err := t.do(ctx, "linear", http.MethodPost, t.linearAPIBase, headers, nil, payload, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("linear API error: %s", resp.Errors[0].Message)
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+func (t *IssueTrackerTool) do(ctx context.Context, provider, method, endpoint string, headers map[string]string, prepare func(*http.Request), payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s API returned status %d: %s", provider, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// jqlQuote quotes a user-supplied search string for use in a JQL text clause.
+func jqlQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func formatTrackerIssues(query string, issues []trackerIssue) string {
+	if len(issues) == 0 {
+		if query == "" {
+			return "No tickets found"
+		}
+		return fmt.Sprintf("No tickets found matching %q", query)
+	}
+
+	lines := []string{fmt.Sprintf("Found %d tickets:", len(issues))}
+	for _, issue := range issues {
+		lines = append(lines, fmt.Sprintf("%s [%s] %s\n   %s", issue.Key, issue.Status, issue.Title, issue.URL))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIssueTrackerTool_JiraCreateFormatsBugReport(t *testing.T) {
+	var fields map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/rest/api/2/issue" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "jira-token" {
+			t.Errorf("unexpected basic auth %q/%q", user, pass)
+		}
+		var payload struct {
+			Fields map[string]interface{} `json:"fields"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		fields = payload.Fields
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"key": "APP-42"}`))
+	}))
+	defer server.Close()
+
+	tool := NewIssueTrackerTool(IssueTrackerToolOptions{
+		JiraBaseURL:     server.URL,
+		JiraEmail:       "bot@example.com",
+		JiraAPIToken:    "jira-token",
+		AllowedProjects: []string{"APP"},
+	})
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":             "create",
+		"project":            "app",
+		"title":              "Login button unresponsive",
+		"summary":            "The login button does nothing on Safari.",
+		"steps_to_reproduce": []interface{}{"Open /login in Safari", "Click 'Sign in'"},
+		"expected":           "User is signed in",
+		"actual":             "Nothing happens",
+		"priority":           "high",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "APP-42") || !strings.Contains(result.ForLLM, server.URL+"/browse/APP-42") {
+		t.Errorf("expected ticket key and link, got: %s", result.ForLLM)
+	}
+
+	description, _ := fields["description"].(string)
+	for _, want := range []string{"h3. Steps to reproduce", "# Open /login in Safari", "h3. Expected", "Nothing happens"} {
+		if !strings.Contains(description, want) {
+			t.Errorf("description missing %q:\n%s", want, description)
+		}
+	}
+	if issueType, _ := fields["issuetype"].(map[string]interface{}); issueType["name"] != "Bug" {
+		t.Errorf("expected issue type Bug, got %v", fields["issuetype"])
+	}
+	if project, _ := fields["project"].(map[string]interface{}); project["key"] != "APP" {
+		t.Errorf("expected project APP, got %v", fields["project"])
+	}
+}
+
+func TestIssueTrackerTool_ProjectAllowlist(t *testing.T) {
+	tool := NewIssueTrackerTool(IssueTrackerToolOptions{
+		JiraBaseURL:     "http://127.0.0.1:0",
+		JiraAPIToken:    "jira-token",
+		AllowedProjects: []string{"APP"},
+	})
+
+	tests := []map[string]interface{}{
+		{"action": "create", "project": "OPS", "title": "x", "summary": "y"},
+		{"action": "search", "project": "OPS"},
+		{"action": "transition", "key": "OPS-1", "status": "Done"},
+		{"action": "transition", "key": "not a key", "status": "Done"},
+	}
+	for _, args := range tests {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestIssueTrackerTool_LinearTransition(t *testing.T) {
+	var updatedState string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "lin-key" {
+			t.Errorf("unexpected auth header %q", got)
+		}
+		var payload struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		if strings.Contains(payload.Query, "issueUpdate") {
+			updatedState, _ = payload.Variables["stateId"].(string)
+			w.Write([]byte(`{"data": {"issueUpdate": {"success": true}}}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"issue": {"id": "uuid-1", "team": {"states": {"nodes": [
+			{"id": "s-todo", "name": "Todo"},
+			{"id": "s-progress", "name": "In Progress"}
+		]}}}}}`))
+	}))
+	defer server.Close()
+
+	tool := NewIssueTrackerTool(IssueTrackerToolOptions{LinearAPIKey: "lin-key", LinearAPIBase: server.URL})
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "transition",
+		"key":    "ENG-7",
+		"status": "in progress",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if updatedState != "s-progress" {
+		t.Errorf("expected state s-progress, got %q", updatedState)
+	}
+	if !strings.Contains(result.ForLLM, "In Progress") {
+		t.Errorf("unexpected result: %s", result.ForLLM)
+	}
+}
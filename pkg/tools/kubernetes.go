@@ -0,0 +1,444 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// k8sNamePattern matches DNS-1123 style names. Anything that could be parsed
+// as a kubectl flag is rejected before the command is built.
+var k8sNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+
+var k8sSelectorPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_./=!,-]*$`)
+
+// k8sDescribableKinds lists the resource kinds the describe action may inspect.
+// Secrets are deliberately absent, and ConfigMaps, which often hold
+// credentials too, need DescribeConfigMaps and are shown with their values
+// redacted.
+var k8sDescribableKinds = map[string]bool{
+	"pod":         true,
+	"deployment":  true,
+	"statefulset": true,
+	"daemonset":   true,
+	"replicaset":  true,
+	"service":     true,
+	"ingress":     true,
+	"job":         true,
+	"cronjob":     true,
+	"node":        true,
+}
+
+var k8sReadActions = []string{"get_pods", "logs", "describe", "events"}
+
+var k8sMutatingActions = []string{"delete_pod", "rollout_restart"}
+
+// KubectlRunner executes kubectl with the given arguments and returns the combined output.
+type KubectlRunner func(ctx context.Context, kubectl string, args ...string) (string, error)
+
+// KubernetesToolOptions configures a KubernetesTool.
+type KubernetesToolOptions struct {
+	KubectlPath       string
+	Kubeconfigs       map[string]string // cluster name -> kubeconfig path
+	AllowedNamespaces []string
+	AllowMutations    bool
+	// DescribeConfigMaps lets describe list the keys of ConfigMaps; their
+	// values are never shown
+	DescribeConfigMaps bool
+	Timeout            time.Duration
+}
+
+// KubernetesTool exposes kubectl-like read operations for chat-based triage.
+// Every invocation is written to the audit log together with the originating chat.
+type KubernetesTool struct {
+	kubectl            string
+	kubeconfigs        map[string]string
+	allowedNamespaces  map[string]bool
+	allowMutations     bool
+	describeConfigMaps bool
+	timeout            time.Duration
+	runner             KubectlRunner
+	channel            string
+	chatID             string
+	mu                 sync.RWMutex
+}
+
+// NewKubernetesTool creates a new KubernetesTool
+func NewKubernetesTool(opts KubernetesToolOptions) *KubernetesTool {
+	kubectl := opts.KubectlPath
+	if kubectl == "" {
+		kubectl = "kubectl"
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	allowed := make(map[string]bool, len(opts.AllowedNamespaces))
+	for _, ns := range opts.AllowedNamespaces {
+		allowed[ns] = true
+	}
+
+	return &KubernetesTool{
+		kubectl:            kubectl,
+		kubeconfigs:        opts.Kubeconfigs,
+		allowedNamespaces:  allowed,
+		allowMutations:     opts.AllowMutations,
+		describeConfigMaps: opts.DescribeConfigMaps,
+		timeout:            timeout,
+		runner:             runKubectl,
+	}
+}
+
+func (t *KubernetesTool) Name() string {
+	return "kubernetes"
+}
+
+func (t *KubernetesTool) Description() string {
+	desc := "Inspect Kubernetes clusters for troubleshooting: list pods, tail pod logs, describe resources and list recent events."
+	if t.allowMutations {
+		desc += " Mutating actions (delete_pod, rollout_restart) are enabled; only use them when the user explicitly asks."
+	}
+	if t.describeConfigMaps {
+		desc += " Describing a configmap lists its keys and value sizes, never the values."
+	}
+	return desc
+}
+
+func (t *KubernetesTool) Parameters() map[string]interface{} {
+	params := map[string]interface{}{
+		"action": map[string]interface{}{
+			"type":        "string",
+			"enum":        t.actions(),
+			"description": "Operation to perform",
+		},
+		"namespace": map[string]interface{}{
+			"type":        "string",
+			"description": "Namespace to operate in (default: 'default')",
+		},
+		"name": map[string]interface{}{
+			"type":        "string",
+			"description": "Resource name (pod name for logs/delete_pod, deployment name for rollout_restart)",
+		},
+		"kind": map[string]interface{}{
+			"type":        "string",
+			"description": "Resource kind for describe (pod, deployment, service, node, ...). Default: pod",
+		},
+		"selector": map[string]interface{}{
+			"type":        "string",
+			"description": "Optional label selector for get_pods (e.g. 'app=web')",
+		},
+		"container": map[string]interface{}{
+			"type":        "string",
+			"description": "Optional container name for logs",
+		},
+		"tail": map[string]interface{}{
+			"type":        "integer",
+			"description": "Number of log lines to return (default 100, max 1000)",
+		},
+		"previous": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Return logs of the previous container instance",
+		},
+	}
+
+	if clusters := t.clusterNames(); len(clusters) > 0 {
+		params["cluster"] = map[string]interface{}{
+			"type":        "string",
+			"enum":        clusters,
+			"description": "Configured cluster to query",
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": params,
+		"required":   []string{"action"},
+	}
+}
+
+// SetContext records the originating chat for audit logging.
+func (t *KubernetesTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// SetRunner replaces the kubectl runner. Intended for tests.
+func (t *KubernetesTool) SetRunner(runner KubectlRunner) {
+	t.runner = runner
+}
+
+func (t *KubernetesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	if action == "" {
+		return ErrorResult("action is required")
+	}
+
+	namespace, _ := args["namespace"].(string)
+	if namespace == "" {
+		namespace = "default"
+	}
+	cluster, _ := args["cluster"].(string)
+
+	kubectlArgs, err := t.buildArgs(action, namespace, cluster, args)
+	t.audit(ctx, action, namespace, cluster, args, err)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	output, err := t.runner(cmdCtx, t.kubectl, kubectlArgs...)
+	if kind, _ := args["kind"].(string); err == nil && action == "describe" && strings.ToLower(kind) == "configmap" {
+		if output, err = redactConfigMap(output); err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+	}
+	if output == "" {
+		output = "(no output)"
+	}
+
+	maxLen := 10000
+	if len(output) > maxLen {
+		output = output[len(output)-maxLen:]
+		output = fmt.Sprintf("... (truncated, showing last %d chars)\n", maxLen) + output
+	}
+
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("kubectl %s failed: %v\n%s", action, err, output)).WithError(err)
+	}
+
+	return NewToolResult(output)
+}
+
+// buildArgs validates the request and translates it into kubectl arguments.
+func (t *KubernetesTool) buildArgs(action, namespace, cluster string, args map[string]interface{}) ([]string, error) {
+	if isMutatingK8sAction(action) && !t.allowMutations {
+		return nil, fmt.Errorf("action %q is a mutation and mutations are disabled", action)
+	}
+
+	if !k8sNamePattern.MatchString(namespace) {
+		return nil, fmt.Errorf("invalid namespace %q", namespace)
+	}
+	if len(t.allowedNamespaces) > 0 && !t.allowedNamespaces[namespace] {
+		return nil, fmt.Errorf("namespace %q is not in the allowlist", namespace)
+	}
+
+	var base []string
+	if cluster != "" || len(t.kubeconfigs) > 0 {
+		if cluster == "" {
+			return nil, fmt.Errorf("cluster is required (available: %s)", strings.Join(t.clusterNames(), ", "))
+		}
+		path, ok := t.kubeconfigs[cluster]
+		if !ok {
+			return nil, fmt.Errorf("unknown cluster %q", cluster)
+		}
+		base = append(base, "--kubeconfig", path)
+	}
+	base = append(base, "--namespace", namespace)
+
+	name, _ := args["name"].(string)
+
+	switch action {
+	case "get_pods":
+		cmd := append(base, "get", "pods", "-o", "wide")
+		if selector, _ := args["selector"].(string); selector != "" {
+			if !k8sSelectorPattern.MatchString(selector) {
+				return nil, fmt.Errorf("invalid label selector %q", selector)
+			}
+			cmd = append(cmd, "--selector", selector)
+		}
+		return cmd, nil
+
+	case "logs":
+		if err := validateK8sName("name", name); err != nil {
+			return nil, err
+		}
+		tail := 100
+		if v, ok := args["tail"].(float64); ok && v > 0 {
+			tail = int(v)
+		}
+		if tail > 1000 {
+			tail = 1000
+		}
+		cmd := append(base, "logs", name, fmt.Sprintf("--tail=%d", tail))
+		if container, _ := args["container"].(string); container != "" {
+			if err := validateK8sName("container", container); err != nil {
+				return nil, err
+			}
+			cmd = append(cmd, "--container", container)
+		}
+		if previous, _ := args["previous"].(bool); previous {
+			cmd = append(cmd, "--previous")
+		}
+		return cmd, nil
+
+	case "describe":
+		kind, _ := args["kind"].(string)
+		if kind == "" {
+			kind = "pod"
+		}
+		kind = strings.ToLower(kind)
+		if kind == "configmap" && t.describeConfigMaps {
+			if err := validateK8sName("name", name); err != nil {
+				return nil, err
+			}
+			// kubectl describe prints the values; the JSON is redacted
+			// before it reaches the model
+			return append(base, "get", "configmap", name, "-o", "json"), nil
+		}
+		if !k8sDescribableKinds[kind] {
+			return nil, fmt.Errorf("describe is not allowed for kind %q", kind)
+		}
+		if err := validateK8sName("name", name); err != nil {
+			return nil, err
+		}
+		return append(base, "describe", kind, name), nil
+
+	case "events":
+		return append(base, "get", "events", "--sort-by=.lastTimestamp"), nil
+
+	case "delete_pod":
+		if err := validateK8sName("name", name); err != nil {
+			return nil, err
+		}
+		return append(base, "delete", "pod", name, "--wait=false"), nil
+
+	case "rollout_restart":
+		if err := validateK8sName("name", name); err != nil {
+			return nil, err
+		}
+		return append(base, "rollout", "restart", "deployment/"+name), nil
+	}
+
+	return nil, fmt.Errorf("unknown action: %s", action)
+}
+
+// redactConfigMap turns the JSON of a ConfigMap into a summary of its
+// metadata and keys, with the size of each value instead of the value
+func redactConfigMap(output string) (string, error) {
+	var cm struct {
+		Metadata struct {
+			Name              string            `json:"name"`
+			Namespace         string            `json:"namespace"`
+			Labels            map[string]string `json:"labels"`
+			CreationTimestamp string            `json:"creationTimestamp"`
+		} `json:"metadata"`
+		Data       map[string]string `json:"data"`
+		BinaryData map[string]string `json:"binaryData"`
+	}
+	if err := json.Unmarshal([]byte(output), &cm); err != nil {
+		// Never pass on output that could not be redacted
+		return "", fmt.Errorf("unexpected kubectl output for configmap: %v", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Name:       %s\nNamespace:  %s\nCreated:    %s\n", cm.Metadata.Name, cm.Metadata.Namespace, cm.Metadata.CreationTimestamp)
+	if len(cm.Metadata.Labels) > 0 {
+		b.WriteString("Labels:\n")
+		for _, key := range sortedKeys(cm.Metadata.Labels) {
+			fmt.Fprintf(&b, "  %s=%s\n", key, cm.Metadata.Labels[key])
+		}
+	}
+	b.WriteString("Data (values redacted):\n")
+	if len(cm.Data)+len(cm.BinaryData) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for _, key := range sortedKeys(cm.Data) {
+		fmt.Fprintf(&b, "  %s: %d bytes\n", key, len(cm.Data[key]))
+	}
+	for _, key := range sortedKeys(cm.BinaryData) {
+		raw, _ := base64.StdEncoding.DecodeString(cm.BinaryData[key])
+		fmt.Fprintf(&b, "  %s: %d bytes, binary\n", key, len(raw))
+	}
+	return b.String(), nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (t *KubernetesTool) audit(ctx context.Context, action, namespace, cluster string, args map[string]interface{}, err error) {
+	t.mu.RLock()
+	channel, chatID := turnChat(ctx, t.channel, t.chatID)
+	t.mu.RUnlock()
+
+	fields := map[string]interface{}{
+		"action":    action,
+		"namespace": namespace,
+		"cluster":   cluster,
+		"name":      args["name"],
+		"channel":   channel,
+		"chat_id":   chatID,
+		"mutation":  isMutatingK8sAction(action),
+	}
+	if err != nil {
+		fields["denied"] = err.Error()
+		logger.WarnCF("kubernetes", "Kubernetes action denied", fields)
+		return
+	}
+	logger.InfoCF("kubernetes", "Kubernetes action", fields)
+}
+
+func (t *KubernetesTool) actions() []string {
+	actions := append([]string{}, k8sReadActions...)
+	if t.allowMutations {
+		actions = append(actions, k8sMutatingActions...)
+	}
+	return actions
+}
+
+func (t *KubernetesTool) clusterNames() []string {
+	names := make([]string, 0, len(t.kubeconfigs))
+	for name := range t.kubeconfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isMutatingK8sAction(action string) bool {
+	for _, a := range k8sMutatingActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func validateK8sName(field, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if !k8sNamePattern.MatchString(value) {
+		return fmt.Errorf("invalid %s %q", field, value)
+	}
+	return nil
+}
+
+func runKubectl(ctx context.Context, kubectl string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, kubectl, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
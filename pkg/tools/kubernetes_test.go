@@ -0,0 +1,183 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func newTestKubernetesTool(opts KubernetesToolOptions) (*KubernetesTool, *[]string) {
+	tool := NewKubernetesTool(opts)
+	var captured []string
+	tool.SetRunner(func(ctx context.Context, kubectl string, args ...string) (string, error) {
+		captured = append([]string{kubectl}, args...)
+		return "ok", nil
+	})
+	return tool, &captured
+}
+
+func TestKubernetesTool_GetPods(t *testing.T) {
+	tool, captured := newTestKubernetesTool(KubernetesToolOptions{})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":    "get_pods",
+		"namespace": "web",
+		"selector":  "app=frontend",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+
+	got := strings.Join(*captured, " ")
+	want := "kubectl --namespace web get pods -o wide --selector app=frontend"
+	if got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+}
+
+func TestKubernetesTool_LogsTailCapped(t *testing.T) {
+	tool, captured := newTestKubernetesTool(KubernetesToolOptions{})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "logs",
+		"name":   "api-7d9f",
+		"tail":   float64(5000),
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if !strings.Contains(strings.Join(*captured, " "), "--tail=1000") {
+		t.Errorf("expected tail to be capped at 1000, got %v", *captured)
+	}
+}
+
+func TestKubernetesTool_NamespaceAllowlist(t *testing.T) {
+	tool, captured := newTestKubernetesTool(KubernetesToolOptions{
+		AllowedNamespaces: []string{"web"},
+	})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":    "get_pods",
+		"namespace": "kube-system",
+	})
+	if !result.IsError {
+		t.Fatal("expected namespace outside allowlist to be rejected")
+	}
+	if *captured != nil {
+		t.Error("kubectl should not run for a denied namespace")
+	}
+}
+
+func TestKubernetesTool_MutationsDisabledByDefault(t *testing.T) {
+	tool, captured := newTestKubernetesTool(KubernetesToolOptions{})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "delete_pod",
+		"name":   "api-7d9f",
+	})
+	if !result.IsError {
+		t.Fatal("expected delete_pod to be rejected when mutations are disabled")
+	}
+	if *captured != nil {
+		t.Error("kubectl should not run for a denied mutation")
+	}
+
+	enabled, captured := newTestKubernetesTool(KubernetesToolOptions{AllowMutations: true})
+	result = enabled.Execute(context.Background(), map[string]interface{}{
+		"action": "delete_pod",
+		"name":   "api-7d9f",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error with mutations enabled: %s", result.ForLLM)
+	}
+	if !strings.Contains(strings.Join(*captured, " "), "delete pod api-7d9f") {
+		t.Errorf("unexpected args: %v", *captured)
+	}
+}
+
+func TestKubernetesTool_RejectsFlagInjection(t *testing.T) {
+	tool, _ := newTestKubernetesTool(KubernetesToolOptions{})
+
+	tests := []map[string]interface{}{
+		{"action": "logs", "name": "--all-containers"},
+		{"action": "describe", "kind": "secret", "name": "db"},
+		{"action": "get_pods", "namespace": "-A"},
+	}
+	for _, args := range tests {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestKubernetesTool_ClusterSelection(t *testing.T) {
+	tool, captured := newTestKubernetesTool(KubernetesToolOptions{
+		Kubeconfigs: map[string]string{"prod": "/etc/kube/prod.yaml"},
+	})
+
+	if result := tool.Execute(context.Background(), map[string]interface{}{"action": "events"}); !result.IsError {
+		t.Error("expected missing cluster to be rejected when kubeconfigs are configured")
+	}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action":  "events",
+		"cluster": "prod",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if !strings.Contains(strings.Join(*captured, " "), "--kubeconfig /etc/kube/prod.yaml") {
+		t.Errorf("expected kubeconfig flag, got %v", *captured)
+	}
+}
+
+func TestKubernetesTool_ConfigMapsNeedOptIn(t *testing.T) {
+	tool, captured := newTestKubernetesTool(KubernetesToolOptions{})
+	args := map[string]interface{}{"action": "describe", "kind": "configmap", "name": "app"}
+	if result := tool.Execute(context.Background(), args); !result.IsError {
+		t.Errorf("configmap described without describe_configmaps: %s", result.ForLLM)
+	}
+	if len(*captured) != 0 {
+		t.Errorf("kubectl ran: %v", *captured)
+	}
+}
+
+func TestKubernetesTool_ConfigMapValuesRedacted(t *testing.T) {
+	tool := NewKubernetesTool(KubernetesToolOptions{DescribeConfigMaps: true})
+	var captured []string
+	tool.SetRunner(func(ctx context.Context, kubectl string, args ...string) (string, error) {
+		captured = args
+		return `{"kind": "ConfigMap", "metadata": {"name": "app", "namespace": "web", "labels": {"team": "core"}},
+			"data": {"DATABASE_URL": "postgres://app:hunter2@db/app", "LOG_LEVEL": "debug"},
+			"binaryData": {"cert.der": "AAECAw=="}}`, nil
+	})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "describe", "kind": "ConfigMap", "namespace": "web", "name": "app",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if got := strings.Join(captured, " "); got != "--namespace web get configmap app -o json" {
+		t.Errorf("args = %q", got)
+	}
+	for _, secret := range []string{"hunter2", "debug", "AAECAw"} {
+		if strings.Contains(result.ForLLM, secret) {
+			t.Errorf("value %q shown:\n%s", secret, result.ForLLM)
+		}
+	}
+	for _, want := range []string{"DATABASE_URL: 29 bytes", "LOG_LEVEL: 5 bytes", "cert.der: 4 bytes, binary", "team=core"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("missing %q:\n%s", want, result.ForLLM)
+		}
+	}
+
+	// Output that cannot be parsed is not passed on
+	tool.SetRunner(func(ctx context.Context, kubectl string, args ...string) (string, error) {
+		return "Data\n====\nDATABASE_URL:\n----\npostgres://app:hunter2@db/app", nil
+	})
+	result = tool.Execute(context.Background(), map[string]interface{}{"action": "describe", "kind": "configmap", "name": "app"})
+	if !result.IsError || strings.Contains(result.ForLLM, "hunter2") {
+		t.Errorf("unparsed output passed on: %s", result.ForLLM)
+	}
+}
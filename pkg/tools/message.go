@@ -3,15 +3,32 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
-type SendCallback func(channel, chatID, content string) error
+type SendCallback func(ctx context.Context, channel, chatID, content string) error
+
+// SendCardCallback sends a card, used for messages with reply options
+type SendCardCallback func(ctx context.Context, channel, chatID string, card *bus.Card) error
+
+// SendExpiringCallback sends a message that is deleted after ttl
+type SendExpiringCallback func(ctx context.Context, channel, chatID, content string, ttl time.Duration) error
+
+// SendContactCallback sends a message followed by a contact card
+type SendContactCallback func(ctx context.Context, channel, chatID, content string, contact *bus.Contact) error
 
 type MessageTool struct {
-	sendCallback   SendCallback
-	defaultChannel string
-	defaultChatID  string
-	sentInRound    bool // Tracks whether a message was sent in the current processing round
+	sendCallback     SendCallback
+	cardCallback     SendCardCallback
+	expiringCallback SendExpiringCallback
+	contactCallback  SendContactCallback
+	defaultChannel   string
+	defaultChatID    string
+	sentInRound      atomic.Bool // Tracks whether a message was sent in the current processing round
 }
 
 func NewMessageTool() *MessageTool {
@@ -42,6 +59,31 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional: target chat/user ID",
 			},
+			"options": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Optional: choices shown as reply buttons. The user's pick arrives as their next message.",
+			},
+			"contact": map[string]interface{}{
+				"type":        "object",
+				"description": "Optional: a contact card to share after the content",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string"},
+					"phones": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"type": "string"},
+					},
+					"emails": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"type": "string"},
+					},
+				},
+				"required": []string{"name"},
+			},
+			"delete_after_minutes": map[string]interface{}{
+				"type":        "number",
+				"description": "Optional: delete the message this many minutes after sending, for sensitive content such as one-time codes or passwords. Only channels that can delete messages honor it.",
+			},
 		},
 		"required": []string{"content"},
 	}
@@ -50,18 +92,36 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 func (t *MessageTool) SetContext(channel, chatID string) {
 	t.defaultChannel = channel
 	t.defaultChatID = chatID
-	t.sentInRound = false // Reset send tracking for new processing round
+	t.sentInRound.Store(false) // Reset send tracking for new processing round
 }
 
-// HasSentInRound returns true if the message tool sent a message during the current round.
+// HasSentInRound returns true if the message tool sent a message during the
+// current round. Turns running concurrently use Turn.MessageSent instead.
 func (t *MessageTool) HasSentInRound() bool {
-	return t.sentInRound
+	return t.sentInRound.Load()
 }
 
 func (t *MessageTool) SetSendCallback(callback SendCallback) {
 	t.sendCallback = callback
 }
 
+// SetCardCallback sets how messages with options are sent. Without it,
+// options are listed in the message text.
+func (t *MessageTool) SetCardCallback(callback SendCardCallback) {
+	t.cardCallback = callback
+}
+
+// SetExpiringCallback sets how messages with delete_after_minutes are sent.
+// Without it, such messages are refused rather than sent to stay.
+func (t *MessageTool) SetExpiringCallback(callback SendExpiringCallback) {
+	t.expiringCallback = callback
+}
+
+// SetContactCallback sets how messages with a contact card are sent
+func (t *MessageTool) SetContactCallback(callback SendContactCallback) {
+	t.contactCallback = callback
+}
+
 func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	content, ok := args["content"].(string)
 	if !ok {
@@ -71,11 +131,12 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 	channel, _ := args["channel"].(string)
 	chatID, _ := args["chat_id"].(string)
 
+	defaultChannel, defaultChatID := turnChat(ctx, t.defaultChannel, t.defaultChatID)
 	if channel == "" {
-		channel = t.defaultChannel
+		channel = defaultChannel
 	}
 	if chatID == "" {
-		chatID = t.defaultChatID
+		chatID = defaultChatID
 	}
 
 	if channel == "" || chatID == "" {
@@ -86,7 +147,56 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
 	}
 
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	var ttl time.Duration
+	if minutes, ok := args["delete_after_minutes"].(float64); ok && minutes > 0 {
+		ttl = time.Duration(minutes * float64(time.Minute))
+		if t.expiringCallback == nil {
+			return &ToolResult{ForLLM: "Expiring messages not configured", IsError: true}
+		}
+	}
+
+	contact, err := messageContact(args["contact"])
+	if err != nil {
+		return &ToolResult{ForLLM: err.Error(), IsError: true}
+	}
+	if contact != nil {
+		if t.contactCallback == nil {
+			return &ToolResult{ForLLM: "Contact cards not configured", IsError: true}
+		}
+		if ttl > 0 {
+			return &ToolResult{ForLLM: "delete_after_minutes cannot be used with a contact", IsError: true}
+		}
+	}
+
+	options := messageOptions(args["options"])
+	switch {
+	case contact != nil:
+		// Contacts carry no card, so options go in the text
+		for _, option := range options {
+			content += "\n- " + option
+		}
+		err = t.contactCallback(ctx, channel, chatID, content, contact)
+	case ttl > 0:
+		// Cards carry no TTL, so options go in the text
+		for _, option := range options {
+			content += "\n- " + option
+		}
+		err = t.expiringCallback(ctx, channel, chatID, content, ttl)
+	case len(options) > 0 && t.cardCallback != nil:
+		card := &bus.Card{Text: content}
+		for _, option := range options {
+			card.Buttons = append(card.Buttons, bus.CardButton{Label: option, Reply: option})
+		}
+		err = t.cardCallback(ctx, channel, chatID, card)
+	case len(options) > 0:
+		for _, option := range options {
+			content += "\n- " + option
+		}
+		err = t.sendCallback(ctx, channel, chatID, content)
+	default:
+		err = t.sendCallback(ctx, channel, chatID, content)
+	}
+	if err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -94,10 +204,42 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		}
 	}
 
-	t.sentInRound = true
+	t.sentInRound.Store(true)
+	if turn := TurnFrom(ctx); turn != nil {
+		turn.messageSent.Store(true)
+	}
 	// Silent: user already received the message directly
 	return &ToolResult{
 		ForLLM: fmt.Sprintf("Message sent to %s:%s", channel, chatID),
 		Silent: true,
 	}
 }
+
+// messageOptions reads the non-empty strings of an array argument
+func messageOptions(arg interface{}) []string {
+	items, _ := arg.([]interface{})
+	options := make([]string, 0, len(items))
+	for _, item := range items {
+		if option, ok := item.(string); ok && option != "" {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// messageContact reads the contact argument, which needs a name
+func messageContact(arg interface{}) (*bus.Contact, error) {
+	fields, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	name, _ := fields["name"].(string)
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("contact name is required")
+	}
+	return &bus.Contact{
+		Name:   name,
+		Phones: messageOptions(fields["phones"]),
+		Emails: messageOptions(fields["emails"]),
+	}, nil
+}
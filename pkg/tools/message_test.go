@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 func TestMessageTool_Execute_Success(t *testing.T) {
@@ -11,7 +14,7 @@ func TestMessageTool_Execute_Success(t *testing.T) {
 	tool.SetContext("test-channel", "test-chat-id")
 
 	var sentChannel, sentChatID, sentContent string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error {
 		sentChannel = channel
 		sentChatID = chatID
 		sentContent = content
@@ -63,7 +66,7 @@ func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 	tool.SetContext("default-channel", "default-chat-id")
 
 	var sentChannel, sentChatID string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error {
 		sentChannel = channel
 		sentChatID = chatID
 		return nil
@@ -99,7 +102,7 @@ func TestMessageTool_Execute_SendFailure(t *testing.T) {
 	tool.SetContext("test-channel", "test-chat-id")
 
 	sendErr := errors.New("network error")
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error {
 		return sendErr
 	})
 
@@ -153,7 +156,7 @@ func TestMessageTool_Execute_NoTargetChannel(t *testing.T) {
 	tool := NewMessageTool()
 	// No SetContext called, so defaultChannel and defaultChatID are empty
 
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error {
 		return nil
 	})
 
@@ -257,3 +260,123 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_Execute_Options(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("test-channel", "test-chat-id")
+
+	var sentContent string
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error {
+		sentContent = content
+		return nil
+	})
+
+	args := map[string]interface{}{
+		"content": "Deploy now?",
+		"options": []interface{}{"Yes", "No", ""},
+	}
+
+	// Without a card callback the options are listed in the text
+	if result := tool.Execute(context.Background(), args); result.IsError {
+		t.Fatalf("Unexpected error: %s", result.ForLLM)
+	}
+	if sentContent != "Deploy now?\n- Yes\n- No" {
+		t.Errorf("Expected options in the text, got %q", sentContent)
+	}
+
+	var sentCard *bus.Card
+	tool.SetCardCallback(func(ctx context.Context, channel, chatID string, card *bus.Card) error {
+		sentCard = card
+		return nil
+	})
+	if result := tool.Execute(context.Background(), args); result.IsError || !result.Silent {
+		t.Fatalf("Expected a silent success, got %+v", result)
+	}
+	if sentCard == nil || sentCard.Text != "Deploy now?" || len(sentCard.Buttons) != 2 {
+		t.Fatalf("Expected a card with 2 buttons, got %+v", sentCard)
+	}
+	if b := sentCard.Buttons[1]; b.Label != "No" || b.Reply != "No" {
+		t.Errorf("Expected reply button 'No', got %+v", b)
+	}
+}
+
+func TestMessageTool_Execute_DeleteAfter(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42")
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error {
+		t.Error("expiring messages should not use the plain callback")
+		return nil
+	})
+
+	args := map[string]interface{}{"content": "Your code is 1234", "delete_after_minutes": 2.0}
+	if result := tool.Execute(context.Background(), args); !result.IsError {
+		t.Error("expected an error without an expiring callback")
+	}
+
+	var gotTTL time.Duration
+	tool.SetExpiringCallback(func(ctx context.Context, channel, chatID, content string, ttl time.Duration) error {
+		gotTTL = ttl
+		return nil
+	})
+	if result := tool.Execute(context.Background(), args); result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if gotTTL != 2*time.Minute {
+		t.Errorf("ttl = %v, want 2m", gotTTL)
+	}
+}
+
+func TestMessageTool_Execute_Contact(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("whatsapp", "+1234567890")
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error { return nil })
+
+	args := map[string]interface{}{
+		"content": "Here is her card",
+		"contact": map[string]interface{}{"name": "Ada Lovelace", "phones": []interface{}{"+44 1234"}},
+	}
+	if result := tool.Execute(context.Background(), args); !result.IsError {
+		t.Error("expected an error without a contact callback")
+	}
+
+	var sent *bus.Contact
+	tool.SetContactCallback(func(ctx context.Context, channel, chatID, content string, contact *bus.Contact) error {
+		sent = contact
+		return nil
+	})
+	if result := tool.Execute(context.Background(), args); result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if sent == nil || sent.Name != "Ada Lovelace" || len(sent.Phones) != 1 {
+		t.Errorf("unexpected contact %+v", sent)
+	}
+
+	args["contact"] = map[string]interface{}{"phones": []interface{}{"+44 1234"}}
+	if result := tool.Execute(context.Background(), args); !result.IsError {
+		t.Error("expected an error for a contact without a name")
+	}
+}
+
+func TestMessageTool_Execute_Turn(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("stale-channel", "stale-chat")
+
+	var sentChannel, sentChatID string
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error {
+		sentChannel, sentChatID = channel, chatID
+		return nil
+	})
+
+	// The turn's chat wins over the one SetContext stored last
+	turn := &Turn{Channel: "telegram", ChatID: "42"}
+	result := tool.Execute(WithTurn(context.Background(), turn), map[string]interface{}{"content": "hi"})
+	if result.IsError {
+		t.Fatalf("Execute failed: %s", result.ForLLM)
+	}
+	if sentChannel != "telegram" || sentChatID != "42" {
+		t.Errorf("sent to %s:%s", sentChannel, sentChatID)
+	}
+	if !turn.MessageSent() {
+		t.Error("turn not marked as replied")
+	}
+}
@@ -0,0 +1,339 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// Poll limits
+const (
+	MaxPollOptions = 12
+	maxKeptPolls   = 100 // Oldest polls are forgotten beyond this
+)
+
+// SendPollCallback sends a poll to a chat
+type SendPollCallback func(ctx context.Context, channel, chatID string, poll *bus.Poll) error
+
+// trackedPoll is a poll sent by the agent and its votes
+type trackedPoll struct {
+	poll    bus.Poll
+	channel string
+	chatID  string
+	votes   map[string][]int // Voter -> 0-based options
+	closed  bool
+}
+
+// PollBook keeps the polls sent by the agent and tallies their votes. Each
+// voter has one ballot per poll: voting again replaces it.
+type PollBook struct {
+	mu    sync.Mutex
+	polls map[string]*trackedPoll
+	order []string // Poll IDs, oldest first
+	seq   int
+}
+
+// NewPollBook creates an empty poll book
+func NewPollBook() *PollBook {
+	return &PollBook{polls: make(map[string]*trackedPoll)}
+}
+
+// Open records a poll sent to a chat and assigns its ID
+func (b *PollBook) Open(channel, chatID string, poll bus.Poll) bus.Poll {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	poll.ID = fmt.Sprintf("poll-%d", b.seq)
+	b.polls[poll.ID] = &trackedPoll{poll: poll, channel: channel, chatID: chatID, votes: make(map[string][]int)}
+	b.order = append(b.order, poll.ID)
+	if len(b.order) > maxKeptPolls {
+		delete(b.polls, b.order[0])
+		b.order = b.order[1:]
+	}
+	return poll
+}
+
+// Vote records the ballot of voter on a native poll. An empty ballot
+// retracts the vote. It returns false if the poll is unknown or closed.
+func (b *PollBook) Vote(pollID, voter string, options []int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, ok := b.polls[pollID]
+	if !ok || p.closed {
+		return false
+	}
+	return p.cast(voter, options)
+}
+
+// VoteByReply records a reply of option numbers ("2" or "1, 3") as a ballot
+// on the latest open poll of the chat. It returns false if the reply is not
+// a valid ballot, so it can be handled as a normal message.
+func (b *PollBook) VoteByReply(channel, chatID, voter, reply string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p := b.latestOpen(channel, chatID)
+	if p == nil {
+		return false
+	}
+	options, ok := parseBallot(reply, len(p.poll.Options))
+	if !ok || (len(options) > 1 && !p.poll.MultipleAnswers) {
+		return false
+	}
+	return p.cast(voter, options)
+}
+
+// Results describes the tally of a poll. An empty ID selects the latest
+// poll of the chat.
+func (b *PollBook) Results(pollID, channel, chatID string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.find(pollID, channel, chatID)
+	if err != nil {
+		return "", err
+	}
+	return p.summary(), nil
+}
+
+// Close stops a poll from accepting votes and describes its final tally
+func (b *PollBook) Close(pollID, channel, chatID string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.find(pollID, channel, chatID)
+	if err != nil {
+		return "", err
+	}
+	p.closed = true
+	return p.summary(), nil
+}
+
+func (b *PollBook) find(pollID, channel, chatID string) (*trackedPoll, error) {
+	if pollID != "" {
+		p, ok := b.polls[pollID]
+		if !ok {
+			return nil, fmt.Errorf("unknown poll %q", pollID)
+		}
+		return p, nil
+	}
+	for i := len(b.order) - 1; i >= 0; i-- {
+		if p := b.polls[b.order[i]]; p.channel == channel && p.chatID == chatID {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("no poll in this chat")
+}
+
+func (b *PollBook) latestOpen(channel, chatID string) *trackedPoll {
+	for i := len(b.order) - 1; i >= 0; i-- {
+		if p := b.polls[b.order[i]]; p.channel == channel && p.chatID == chatID && !p.closed {
+			return p
+		}
+	}
+	return nil
+}
+
+// cast replaces the ballot of voter, ignoring options out of range
+func (p *trackedPoll) cast(voter string, options []int) bool {
+	var ballot []int
+	for _, option := range options {
+		if option >= 0 && option < len(p.poll.Options) && !slices.Contains(ballot, option) {
+			ballot = append(ballot, option)
+		}
+	}
+	if len(ballot) == 0 {
+		delete(p.votes, voter)
+	} else {
+		p.votes[voter] = ballot
+	}
+	return true
+}
+
+// summary lists the votes of each option
+func (p *trackedPoll) summary() string {
+	counts := make([]int, len(p.poll.Options))
+	for _, ballot := range p.votes {
+		for _, option := range ballot {
+			counts[option]++
+		}
+	}
+
+	state := "open"
+	if p.closed {
+		state = "closed"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Poll %s %q (%s, %d voters)", p.poll.ID, p.poll.Question, state, len(p.votes))
+	for i, option := range p.poll.Options {
+		unit := "votes"
+		if counts[i] == 1 {
+			unit = "vote"
+		}
+		fmt.Fprintf(&sb, "\n%d. %s: %d %s", i+1, option, counts[i], unit)
+	}
+	return sb.String()
+}
+
+// parseBallot parses 1-based option numbers separated by commas or spaces
+// into 0-based options
+func parseBallot(reply string, options int) ([]int, bool) {
+	fields := strings.FieldsFunc(reply, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 {
+		return nil, false
+	}
+	ballot := make([]int, 0, len(fields))
+	for _, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 || n > options {
+			return nil, false
+		}
+		ballot = append(ballot, n-1)
+	}
+	return ballot, true
+}
+
+// PollTool lets the agent ask a chat to vote and read the results
+type PollTool struct {
+	book           *PollBook
+	sendCallback   SendPollCallback
+	defaultChannel string
+	defaultChatID  string
+	mu             sync.RWMutex
+}
+
+// NewPollTool creates a poll tool recording its polls in book
+func NewPollTool(book *PollBook) *PollTool {
+	return &PollTool{book: book}
+}
+
+func (t *PollTool) Name() string {
+	return "send_poll"
+}
+
+func (t *PollTool) Description() string {
+	return "Ask a chat to vote on options and read the tally. Use this for group decisions. Action 'create' sends a poll, 'results' reports the current votes, 'close' stops voting and reports the final tally."
+}
+
+func (t *PollTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"create", "results", "close"},
+				"description": "Action to perform",
+			},
+			"question": map[string]interface{}{
+				"type":        "string",
+				"description": "The question to vote on (for create)",
+			},
+			"options": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": fmt.Sprintf("2 to %d answer options (for create)", MaxPollOptions),
+			},
+			"multiple_answers": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: allow voting for several options (for create)",
+			},
+			"poll_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: poll to report or close; defaults to the latest poll of the chat",
+			},
+			"channel": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: target channel (telegram, whatsapp, etc.)",
+			},
+			"chat_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: target chat/user ID",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *PollTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.defaultChannel = channel
+	t.defaultChatID = chatID
+}
+
+// SetSendCallback sets how polls are sent
+func (t *PollTool) SetSendCallback(callback SendPollCallback) {
+	t.sendCallback = callback
+}
+
+func (t *PollTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, _ := args["channel"].(string)
+	chatID, _ := args["chat_id"].(string)
+	t.mu.RLock()
+	defaultChannel, defaultChatID := turnChat(ctx, t.defaultChannel, t.defaultChatID)
+	t.mu.RUnlock()
+	if channel == "" {
+		channel = defaultChannel
+	}
+	if chatID == "" {
+		chatID = defaultChatID
+	}
+
+	pollID, _ := args["poll_id"].(string)
+	action, _ := args["action"].(string)
+	switch action {
+	case "create":
+		return t.create(ctx, channel, chatID, args)
+	case "results":
+		summary, err := t.book.Results(pollID, channel, chatID)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(summary)
+	case "close":
+		summary, err := t.book.Close(pollID, channel, chatID)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(summary)
+	case "":
+		return ErrorResult("action is required")
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *PollTool) create(ctx context.Context, channel, chatID string, args map[string]interface{}) *ToolResult {
+	if channel == "" || chatID == "" {
+		return ErrorResult("No target channel/chat specified")
+	}
+	if t.sendCallback == nil {
+		return ErrorResult("Poll sending not configured")
+	}
+
+	question, _ := args["question"].(string)
+	if strings.TrimSpace(question) == "" {
+		return ErrorResult("question is required for create")
+	}
+	options := messageOptions(args["options"])
+	if len(options) < 2 || len(options) > MaxPollOptions {
+		return ErrorResult(fmt.Sprintf("a poll needs 2 to %d options, got %d", MaxPollOptions, len(options)))
+	}
+	multiple, _ := args["multiple_answers"].(bool)
+
+	poll := t.book.Open(channel, chatID, bus.Poll{Question: question, Options: options, MultipleAnswers: multiple})
+	if err := t.sendCallback(ctx, channel, chatID, &poll); err != nil {
+		t.book.Close(poll.ID, channel, chatID)
+		return ErrorResult(fmt.Sprintf("sending poll: %v", err)).WithError(err)
+	}
+
+	return SilentResult(fmt.Sprintf("Poll %s sent to %s:%s. Votes are tallied as they arrive; use action 'results' to read them.",
+		poll.ID, channel, chatID))
+}
@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestPollBook(t *testing.T) {
+	book := NewPollBook()
+	poll := book.Open("telegram", "42", bus.Poll{Question: "Lunch?", Options: []string{"Pizza", "Sushi", "Tacos"}})
+	if poll.ID == "" {
+		t.Fatal("expected the poll to get an ID")
+	}
+
+	book.Vote(poll.ID, "alice", []int{0})
+	book.Vote(poll.ID, "bob", []int{1})
+	book.Vote(poll.ID, "bob", []int{0}) // Changed vote
+	book.Vote(poll.ID, "carol", []int{2})
+	book.Vote(poll.ID, "carol", nil) // Retracted vote
+
+	if !book.VoteByReply("telegram", "42", "dave", " 3 ") {
+		t.Error("a number reply should count as a vote")
+	}
+	if book.VoteByReply("telegram", "42", "erin", "1,2") {
+		t.Error("several numbers should not count on a single-answer poll")
+	}
+	if book.VoteByReply("telegram", "42", "erin", "4") || book.VoteByReply("telegram", "42", "erin", "see you at 1") {
+		t.Error("replies that are not ballots should not count")
+	}
+	if book.VoteByReply("slack", "42", "erin", "1") {
+		t.Error("votes should only count in the poll's chat")
+	}
+
+	want := "Poll " + poll.ID + " \"Lunch?\" (open, 3 voters)\n1. Pizza: 2 votes\n2. Sushi: 0 votes\n3. Tacos: 1 vote"
+	if got, err := book.Results("", "telegram", "42"); err != nil || got != want {
+		t.Errorf("Results() = %q, %v; want %q", got, err, want)
+	}
+
+	if _, err := book.Close(poll.ID, "", ""); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if book.Vote(poll.ID, "frank", []int{1}) || book.VoteByReply("telegram", "42", "frank", "2") {
+		t.Error("closed polls should not take votes")
+	}
+	if _, err := book.Results("poll-99", "", ""); err == nil {
+		t.Error("expected an error for an unknown poll")
+	}
+}
+
+func TestPollBookMultipleAnswers(t *testing.T) {
+	book := NewPollBook()
+	poll := book.Open("slack", "C1", bus.Poll{Question: "Days?", Options: []string{"Mon", "Tue", "Wed"}, MultipleAnswers: true})
+
+	if !book.VoteByReply("slack", "C1", "alice", "1, 3") {
+		t.Fatal("several numbers should count on a multiple-answer poll")
+	}
+	got, _ := book.Results(poll.ID, "", "")
+	if !strings.Contains(got, "1. Mon: 1 vote") || !strings.Contains(got, "3. Wed: 1 vote") {
+		t.Errorf("unexpected results %q", got)
+	}
+}
+
+func TestPollTool_Execute(t *testing.T) {
+	tool := NewPollTool(NewPollBook())
+	tool.SetContext("telegram", "42")
+
+	var sent *bus.Poll
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID string, poll *bus.Poll) error {
+		sent = poll
+		return nil
+	})
+
+	ctx := context.Background()
+	result := tool.Execute(ctx, map[string]interface{}{
+		"action":   "create",
+		"question": "Lunch?",
+		"options":  []interface{}{"Pizza", "Sushi"},
+	})
+	if result.IsError || !result.Silent {
+		t.Fatalf("create failed: %+v", result)
+	}
+	if sent == nil || sent.ID == "" || len(sent.Options) != 2 {
+		t.Fatalf("unexpected poll sent: %+v", sent)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "results"})
+	if result.IsError || !strings.Contains(result.ForLLM, "Pizza: 0 votes") {
+		t.Errorf("unexpected results: %+v", result)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "create", "question": "Lunch?", "options": []interface{}{"Pizza"}})
+	if !result.IsError {
+		t.Error("expected an error for a poll with one option")
+	}
+
+	tool.SetSendCallback(func(ctx context.Context, channel, chatID string, poll *bus.Poll) error {
+		return errors.New("channel down")
+	})
+	result = tool.Execute(ctx, map[string]interface{}{"action": "create", "question": "Dinner?", "options": []interface{}{"A", "B"}})
+	if !result.IsError || result.Err == nil {
+		t.Errorf("expected the send error, got %+v", result)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/trace"
 )
 
 type ToolRegistry struct {
@@ -43,32 +44,33 @@ func (r *ToolRegistry) Execute(ctx context.Context, name string, args map[string
 // the callback will be set on the tool before execution.
 func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args map[string]interface{}, channel, chatID string, asyncCallback AsyncCallback) *ToolResult {
 	logger.InfoCF("tool", "Tool execution started",
-		map[string]interface{}{
+		trace.Fields(ctx, map[string]interface{}{
 			"tool": name,
 			"args": args,
-		})
+		}))
 
 	tool, ok := r.Get(name)
 	if !ok {
 		logger.ErrorCF("tool", "Tool not found",
-			map[string]interface{}{
+			trace.Fields(ctx, map[string]interface{}{
 				"tool": name,
-			})
+			}))
 		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
 	}
 
-	// If tool implements ContextualTool, set context
-	if contextualTool, ok := tool.(ContextualTool); ok && channel != "" && chatID != "" {
-		contextualTool.SetContext(channel, chatID)
+	// Contextual tools read the chat from the turn in ctx, as the turns of
+	// different chats run concurrently
+	if channel != "" && chatID != "" && TurnFrom(ctx) == nil {
+		ctx = WithTurn(ctx, &Turn{Channel: channel, ChatID: chatID})
 	}
 
 	// If tool implements AsyncTool and callback is provided, set callback
 	if asyncTool, ok := tool.(AsyncTool); ok && asyncCallback != nil {
 		asyncTool.SetCallback(asyncCallback)
 		logger.DebugCF("tool", "Async callback injected",
-			map[string]interface{}{
+			trace.Fields(ctx, map[string]interface{}{
 				"tool": name,
-			})
+			}))
 	}
 
 	start := time.Now()
@@ -78,24 +80,24 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 	// Log based on result type
 	if result.IsError {
 		logger.ErrorCF("tool", "Tool execution failed",
-			map[string]interface{}{
+			trace.Fields(ctx, map[string]interface{}{
 				"tool":     name,
 				"duration": duration.Milliseconds(),
 				"error":    result.ForLLM,
-			})
+			}))
 	} else if result.Async {
 		logger.InfoCF("tool", "Tool started (async)",
-			map[string]interface{}{
+			trace.Fields(ctx, map[string]interface{}{
 				"tool":     name,
 				"duration": duration.Milliseconds(),
-			})
+			}))
 	} else {
 		logger.InfoCF("tool", "Tool execution completed",
-			map[string]interface{}{
+			trace.Fields(ctx, map[string]interface{}{
 				"tool":          name,
 				"duration_ms":   duration.Milliseconds(),
 				"result_length": len(result.ForLLM),
-			})
+			}))
 	}
 
 	return result
@@ -0,0 +1,414 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RepoToolOptions configures a RepoTool. A provider is enabled when its token is set.
+type RepoToolOptions struct {
+	GitHubToken   string
+	GitHubAPIBase string
+	GitLabToken   string
+	GitLabAPIBase string
+	AllowedRepos  []string // "owner/repo" entries; empty allows all repos the tokens can access
+}
+
+// RepoTool lets the agent inspect and comment on GitHub and GitLab repositories.
+type RepoTool struct {
+	githubToken   string
+	githubAPIBase string
+	gitlabToken   string
+	gitlabAPIBase string
+	allowedRepos  map[string]bool
+	client        *http.Client
+}
+
+// repoItem is the provider-neutral representation of an issue or pull/merge request.
+type repoItem struct {
+	Number int
+	Title  string
+	Author string
+	URL    string
+	Draft  bool
+}
+
+// repoCheck is the provider-neutral representation of a CI run or pipeline.
+type repoCheck struct {
+	Name       string
+	Status     string
+	Conclusion string
+	URL        string
+}
+
+// NewRepoTool creates a new RepoTool
+func NewRepoTool(opts RepoToolOptions) *RepoTool {
+	githubBase := opts.GitHubAPIBase
+	if githubBase == "" {
+		githubBase = "https://api.github.com"
+	}
+	gitlabBase := opts.GitLabAPIBase
+	if gitlabBase == "" {
+		gitlabBase = "https://gitlab.com/api/v4"
+	}
+
+	allowed := make(map[string]bool, len(opts.AllowedRepos))
+	for _, repo := range opts.AllowedRepos {
+		allowed[strings.ToLower(repo)] = true
+	}
+
+	return &RepoTool{
+		githubToken:   opts.GitHubToken,
+		githubAPIBase: strings.TrimSuffix(githubBase, "/"),
+		gitlabToken:   opts.GitLabToken,
+		gitlabAPIBase: strings.TrimSuffix(gitlabBase, "/"),
+		allowedRepos:  allowed,
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (t *RepoTool) Name() string {
+	return "repo"
+}
+
+func (t *RepoTool) Description() string {
+	return "Work with GitHub/GitLab repositories: list open issues and pull/merge requests, comment on them, and fetch CI status for a branch or commit."
+}
+
+func (t *RepoTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list_issues", "list_prs", "comment", "ci_status"},
+				"description": "Operation to perform",
+			},
+			"provider": map[string]interface{}{
+				"type":        "string",
+				"enum":        t.providers(),
+				"description": "Code host (default: github if configured, otherwise gitlab)",
+			},
+			"repo": map[string]interface{}{
+				"type":        "string",
+				"description": "Repository as 'owner/name' (GitLab: 'group/project')",
+			},
+			"number": map[string]interface{}{
+				"type":        "integer",
+				"description": "Issue or pull/merge request number (for comment)",
+			},
+			"kind": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"issue", "pr"},
+				"description": "What 'number' refers to when commenting on GitLab (default: issue)",
+			},
+			"body": map[string]interface{}{
+				"type":        "string",
+				"description": "Comment text (for comment)",
+			},
+			"ref": map[string]interface{}{
+				"type":        "string",
+				"description": "Branch, tag or commit SHA for ci_status (default: main)",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of items to return (default 10, max 50)",
+			},
+		},
+		"required": []string{"action", "repo"},
+	}
+}
+
+func (t *RepoTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	repo, _ := args["repo"].(string)
+	if action == "" || repo == "" {
+		return ErrorResult("action and repo are required")
+	}
+	if strings.Count(repo, "/") < 1 || strings.Contains(repo, "..") {
+		return ErrorResult(fmt.Sprintf("invalid repo %q, expected 'owner/name'", repo))
+	}
+	if len(t.allowedRepos) > 0 && !t.allowedRepos[strings.ToLower(repo)] {
+		return ErrorResult(fmt.Sprintf("repo %q is not in the allowlist", repo))
+	}
+
+	provider, _ := args["provider"].(string)
+	if provider == "" {
+		providers := t.providers()
+		if len(providers) == 0 {
+			return ErrorResult("no code host is configured")
+		}
+		provider = providers[0]
+	}
+	if provider == "github" && t.githubToken == "" || provider == "gitlab" && t.gitlabToken == "" {
+		return ErrorResult(fmt.Sprintf("provider %q is not configured", provider))
+	}
+
+	limit := 10
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+	if limit > 50 {
+		limit = 50
+	}
+
+	switch action {
+	case "list_issues", "list_prs":
+		items, err := t.listItems(ctx, provider, repo, action == "list_prs", limit)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to list items: %v", err)).WithError(err)
+		}
+		return NewToolResult(formatRepoItems(repo, action == "list_prs", items))
+
+	case "comment":
+		number, _ := args["number"].(float64)
+		body, _ := args["body"].(string)
+		if number <= 0 || strings.TrimSpace(body) == "" {
+			return ErrorResult("number and body are required for comment")
+		}
+		kind, _ := args["kind"].(string)
+		link, err := t.comment(ctx, provider, repo, int(number), kind == "pr", body)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to comment: %v", err)).WithError(err)
+		}
+		return NewToolResult(fmt.Sprintf("Comment posted on %s#%d: %s", repo, int(number), link))
+
+	case "ci_status":
+		ref, _ := args["ref"].(string)
+		if ref == "" {
+			ref = "main"
+		}
+		checks, err := t.ciStatus(ctx, provider, repo, ref, limit)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to fetch CI status: %v", err)).WithError(err)
+		}
+		return NewToolResult(formatRepoChecks(repo, ref, checks))
+	}
+
+	return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+}
+
+func (t *RepoTool) providers() []string {
+	var providers []string
+	if t.githubToken != "" {
+		providers = append(providers, "github")
+	}
+	if t.gitlabToken != "" {
+		providers = append(providers, "gitlab")
+	}
+	return providers
+}
+
+func (t *RepoTool) listItems(ctx context.Context, provider, repo string, pulls bool, limit int) ([]repoItem, error) {
+	if provider == "gitlab" {
+		path := "issues"
+		if pulls {
+			path = "merge_requests"
+		}
+		var raw []struct {
+			IID    int    `json:"iid"`
+			Title  string `json:"title"`
+			WebURL string `json:"web_url"`
+			Draft  bool   `json:"draft"`
+			Author struct {
+				Username string `json:"username"`
+			} `json:"author"`
+		}
+		endpoint := fmt.Sprintf("/projects/%s/%s?state=opened&per_page=%d", url.PathEscape(repo), path, limit)
+		if err := t.do(ctx, provider, http.MethodGet, endpoint, nil, &raw); err != nil {
+			return nil, err
+		}
+		items := make([]repoItem, 0, len(raw))
+		for _, r := range raw {
+			items = append(items, repoItem{Number: r.IID, Title: r.Title, Author: r.Author.Username, URL: r.WebURL, Draft: r.Draft})
+		}
+		return items, nil
+	}
+
+	path := "issues"
+	if pulls {
+		path = "pulls"
+	}
+	var raw []struct {
+		Number      int             `json:"number"`
+		Title       string          `json:"title"`
+		HTMLURL     string          `json:"html_url"`
+		Draft       bool            `json:"draft"`
+		PullRequest json.RawMessage `json:"pull_request"`
+		User        struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	}
+	endpoint := fmt.Sprintf("/repos/%s/%s?state=open&per_page=%d", repo, path, limit)
+	if err := t.do(ctx, provider, http.MethodGet, endpoint, nil, &raw); err != nil {
+		return nil, err
+	}
+	items := make([]repoItem, 0, len(raw))
+	for _, r := range raw {
+		// The GitHub issues endpoint also returns pull requests
+		if !pulls && len(r.PullRequest) > 0 {
+			continue
+		}
+		items = append(items, repoItem{Number: r.Number, Title: r.Title, Author: r.User.Login, URL: r.HTMLURL, Draft: r.Draft})
+	}
+	return items, nil
+}
+
+func (t *RepoTool) comment(ctx context.Context, provider, repo string, number int, pull bool, body string) (string, error) {
+	var resp struct {
+		HTMLURL string `json:"html_url"`
+		ID      int    `json:"id"`
+	}
+	payload := map[string]string{"body": body}
+
+	if provider == "gitlab" {
+		path := "issues"
+		if pull {
+			path = "merge_requests"
+		}
+		endpoint := fmt.Sprintf("/projects/%s/%s/%d/notes", url.PathEscape(repo), path, number)
+		if err := t.do(ctx, provider, http.MethodPost, endpoint, payload, &resp); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("note %d", resp.ID), nil
+	}
+
+	endpoint := fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number)
+	if err := t.do(ctx, provider, http.MethodPost, endpoint, payload, &resp); err != nil {
+		return "", err
+	}
+	return resp.HTMLURL, nil
+}
+
+func (t *RepoTool) ciStatus(ctx context.Context, provider, repo, ref string, limit int) ([]repoCheck, error) {
+	if provider == "gitlab" {
+		var raw []struct {
+			ID     int    `json:"id"`
+			Status string `json:"status"`
+			Ref    string `json:"ref"`
+			WebURL string `json:"web_url"`
+		}
+		endpoint := fmt.Sprintf("/projects/%s/pipelines?ref=%s&per_page=%d", url.PathEscape(repo), url.QueryEscape(ref), limit)
+		if err := t.do(ctx, provider, http.MethodGet, endpoint, nil, &raw); err != nil {
+			return nil, err
+		}
+		checks := make([]repoCheck, 0, len(raw))
+		for _, r := range raw {
+			checks = append(checks, repoCheck{Name: fmt.Sprintf("pipeline #%d", r.ID), Status: r.Status, URL: r.WebURL})
+		}
+		return checks, nil
+	}
+
+	var raw struct {
+		CheckRuns []struct {
+			Name       string `json:"name"`
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+			HTMLURL    string `json:"html_url"`
+		} `json:"check_runs"`
+	}
+	endpoint := fmt.Sprintf("/repos/%s/commits/%s/check-runs?per_page=%d", repo, url.PathEscape(ref), limit)
+	if err := t.do(ctx, provider, http.MethodGet, endpoint, nil, &raw); err != nil {
+		return nil, err
+	}
+	checks := make([]repoCheck, 0, len(raw.CheckRuns))
+	for _, r := range raw.CheckRuns {
+		checks = append(checks, repoCheck{Name: r.Name, Status: r.Status, Conclusion: r.Conclusion, URL: r.HTMLURL})
+	}
+	return checks, nil
+}
+
+func (t *RepoTool) do(ctx context.Context, provider, method, endpoint string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	base := t.githubAPIBase
+	if provider == "gitlab" {
+		base = t.gitlabAPIBase
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, base+endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if provider == "gitlab" {
+		req.Header.Set("PRIVATE-TOKEN", t.gitlabToken)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+t.githubToken)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s API returned status %d: %s", provider, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+func formatRepoItems(repo string, pulls bool, items []repoItem) string {
+	kind := "issues"
+	if pulls {
+		kind = "pull requests"
+	}
+	if len(items) == 0 {
+		return fmt.Sprintf("No open %s in %s", kind, repo)
+	}
+
+	lines := []string{fmt.Sprintf("Open %s in %s:", kind, repo)}
+	for _, item := range items {
+		draft := ""
+		if item.Draft {
+			draft = " [draft]"
+		}
+		lines = append(lines, fmt.Sprintf("#%d %s%s (by %s)\n   %s", item.Number, item.Title, draft, item.Author, item.URL))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatRepoChecks(repo, ref string, checks []repoCheck) string {
+	if len(checks) == 0 {
+		return fmt.Sprintf("No CI runs found for %s@%s", repo, ref)
+	}
+
+	lines := []string{fmt.Sprintf("CI status for %s@%s:", repo, ref)}
+	for _, check := range checks {
+		state := check.Status
+		if check.Conclusion != "" {
+			state = check.Conclusion
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s %s", check.Name, state, check.URL))
+	}
+	return strings.Join(lines, "\n")
+}
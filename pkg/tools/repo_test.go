@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRepoTool_ListIssuesSkipsPullRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/app/issues" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer gh-token" {
+			t.Errorf("unexpected auth header %q", got)
+		}
+		w.Write([]byte(`[
+			{"number": 1, "title": "Crash on start", "html_url": "https://github.com/acme/app/issues/1", "user": {"login": "alice"}},
+			{"number": 2, "title": "Fix crash", "html_url": "https://github.com/acme/app/pull/2", "user": {"login": "bob"}, "pull_request": {}}
+		]`))
+	}))
+	defer server.Close()
+
+	tool := NewRepoTool(RepoToolOptions{GitHubToken: "gh-token", GitHubAPIBase: server.URL})
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "list_issues",
+		"repo":   "acme/app",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "Crash on start") {
+		t.Errorf("expected issue in output, got: %s", result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "Fix crash") {
+		t.Errorf("pull requests should be filtered from issues, got: %s", result.ForLLM)
+	}
+}
+
+func TestRepoTool_GitLabComment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if r.URL.EscapedPath() != "/projects/group%2Fproject/merge_requests/7/notes" {
+			t.Errorf("unexpected path %s", r.URL.EscapedPath())
+		}
+		if got := r.Header.Get("PRIVATE-TOKEN"); got != "gl-token" {
+			t.Errorf("unexpected token header %q", got)
+		}
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload["body"] != "LGTM" {
+			t.Errorf("unexpected body %q", payload["body"])
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 42}`))
+	}))
+	defer server.Close()
+
+	tool := NewRepoTool(RepoToolOptions{GitLabToken: "gl-token", GitLabAPIBase: server.URL})
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "comment",
+		"repo":   "group/project",
+		"number": float64(7),
+		"kind":   "pr",
+		"body":   "LGTM",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+}
+
+func TestRepoTool_AllowedRepos(t *testing.T) {
+	tool := NewRepoTool(RepoToolOptions{GitHubToken: "gh-token", AllowedRepos: []string{"acme/app"}})
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"action": "list_prs",
+		"repo":   "other/repo",
+	})
+	if !result.IsError {
+		t.Error("expected repo outside the allowlist to be rejected")
+	}
+}
@@ -1,6 +1,10 @@
 package tools
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
 
 // ToolResult represents the structured return value from tool execution.
 // It provides clear semantics for different types of results and supports
@@ -15,6 +19,11 @@ type ToolResult struct {
 	// Silent=true overrides this field.
 	ForUser string `json:"for_user,omitempty"`
 
+	// Card is structured content sent to the user after ForUser.
+	// Channels render it natively or fall back to text.
+	// Silent=true overrides this field.
+	Card *bus.Card `json:"card,omitempty"`
+
 	// Silent suppresses sending any message to the user.
 	// When true, ForUser is ignored even if set.
 	Silent bool `json:"silent"`
@@ -120,6 +129,24 @@ func UserResult(content string) *ToolResult {
 	}
 }
 
+// CardResult creates a ToolResult that shows card to the user and gives
+// forLLM to the LLM.
+//
+// Use this for results with a natural structure, such as:
+// - Status summaries with labelled values
+// - Search results with links
+// - Choices the user can pick from with buttons
+//
+// Example:
+//
+//	result := CardResult("Build #12 passed", &bus.Card{Title: "Build #12", Fields: fields})
+func CardResult(forLLM string, card *bus.Card) *ToolResult {
+	return &ToolResult{
+		ForLLM: forLLM,
+		Card:   card,
+	}
+}
+
 // MarshalJSON implements custom JSON serialization.
 // The Err field is excluded from JSON output via the json:"-" tag.
 func (tr *ToolResult) MarshalJSON() ([]byte, error) {
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 func TestNewToolResult(t *testing.T) {
@@ -95,6 +97,33 @@ func TestUserResult(t *testing.T) {
 	}
 }
 
+func TestCardResult(t *testing.T) {
+	card := &bus.Card{Title: "Build #12", Fields: []bus.CardField{{Label: "Status", Value: "passed"}}}
+	result := CardResult("Build #12 passed", card)
+
+	if result.ForLLM != "Build #12 passed" {
+		t.Errorf("Expected ForLLM 'Build #12 passed', got '%s'", result.ForLLM)
+	}
+	if result.Card != card {
+		t.Error("Expected Card to be set")
+	}
+	if result.ForUser != "" {
+		t.Errorf("Expected ForUser to be empty, got '%s'", result.ForUser)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var decoded ToolResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if decoded.Card == nil || decoded.Card.Fields[0].Value != "passed" {
+		t.Errorf("Card did not survive JSON round trip: %s", data)
+	}
+}
+
 func TestToolResultJSONSerialization(t *testing.T) {
 	tests := []struct {
 		name   string
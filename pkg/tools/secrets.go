@@ -0,0 +1,341 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/trace"
+)
+
+// secretNamePattern matches the secret names that may be looked up.
+// Anything that could be parsed as a command flag is rejected.
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9_@][A-Za-z0-9_@ .:/#+-]{0,199}$`)
+
+// secretApprovalTimeout is how long the owner has to approve a request
+const secretApprovalTimeout = 5 * time.Minute
+
+// SecretsToolOptions configures a SecretsTool
+type SecretsToolOptions struct {
+	Backend      SecretBackend
+	Owners       []string // Sender IDs, optionally as "channel:sender_id"
+	SkipApproval bool     // Deliver without asking the owner first
+	DeleteAfter  time.Duration
+	Timeout      time.Duration
+}
+
+// secretRequest is a lookup waiting for the owner's approval
+type secretRequest struct {
+	name     string
+	totp     bool // Deliver a 2FA code generated from the secret instead of the secret
+	channel  string
+	chatID   string
+	senderID string
+	traceID  string // Trace of the message that asked for the secret
+	expires  time.Time
+}
+
+// what describes the request to the owner
+func (r *secretRequest) what() string {
+	if r.totp {
+		return fmt.Sprintf("2FA code for %q", r.name)
+	}
+	return fmt.Sprintf("secret %q", r.name)
+}
+
+// SecretsTool looks up passwords for the owner. Secrets never reach the
+// model: they are sent straight to the chat as messages that delete
+// themselves, after the owner approves the request. Every step is written
+// to the audit log.
+type SecretsTool struct {
+	backend         SecretBackend
+	owners          []string
+	skipApproval    bool
+	deleteAfter     time.Duration
+	timeout         time.Duration
+	promptCallback  SendCardCallback
+	deliverCallback SendExpiringCallback
+	channel         string
+	chatID          string
+	senderID        string
+	pending         map[string]*secretRequest // Approval code -> request
+	mu              sync.Mutex
+}
+
+// NewSecretsTool creates a new SecretsTool
+func NewSecretsTool(opts SecretsToolOptions) *SecretsTool {
+	deleteAfter := opts.DeleteAfter
+	if deleteAfter <= 0 {
+		deleteAfter = 5 * time.Minute
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	return &SecretsTool{
+		backend:      opts.Backend,
+		owners:       opts.Owners,
+		skipApproval: opts.SkipApproval,
+		deleteAfter:  deleteAfter,
+		timeout:      timeout,
+		pending:      make(map[string]*secretRequest),
+	}
+}
+
+func (t *SecretsTool) Name() string {
+	return "secrets"
+}
+
+func (t *SecretsTool) Description() string {
+	return fmt.Sprintf("Send the owner a password from their password manager (%s), e.g. the WiFi password. "+
+		"The secret goes directly to the chat after the owner approves and is deleted after %d minutes; you never see it, so do not repeat or guess it.",
+		t.backend.Name(), int(t.deleteAfter/time.Minute))
+}
+
+func (t *SecretsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the secret in the password manager (e.g. 'wifi/home')",
+			},
+			"reason": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: why the secret is needed, shown to the owner when asking for approval",
+			},
+		},
+		"required": []string{"name"},
+	}
+}
+
+// SetContext records the chat that secrets are sent to
+func (t *SecretsTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// SetSender records who sent the message being handled, which must be an owner
+func (t *SecretsTool) SetSender(senderID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.senderID = senderID
+}
+
+// SetPromptCallback sets how approval prompts are sent
+func (t *SecretsTool) SetPromptCallback(callback SendCardCallback) {
+	t.promptCallback = callback
+}
+
+// SetDeliverCallback sets how secrets are sent. They must be deleted after the TTL.
+func (t *SecretsTool) SetDeliverCallback(callback SendExpiringCallback) {
+	t.deliverCallback = callback
+}
+
+func (t *SecretsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	name, _ := args["name"].(string)
+	reason, _ := args["reason"].(string)
+	return t.request(ctx, name, reason, false)
+}
+
+// request checks a lookup and either delivers it straight away or asks the
+// owner to approve it first
+func (t *SecretsTool) request(ctx context.Context, name, reason string, totp bool) *ToolResult {
+	t.mu.Lock()
+	channel, chatID := turnChat(ctx, t.channel, t.chatID)
+	req := &secretRequest{name: name, totp: totp, channel: channel, chatID: chatID, senderID: turnSender(ctx, t.senderID), traceID: trace.ID(ctx)}
+	t.mu.Unlock()
+
+	what := req.what()
+
+	if err := t.checkRequest(req); err != nil {
+		t.audit("denied", req, err)
+		return ErrorResult(err.Error())
+	}
+	if t.deliverCallback == nil || (!t.skipApproval && t.promptCallback == nil) {
+		return ErrorResult("Secret delivery not configured")
+	}
+
+	if t.skipApproval {
+		if err := t.deliver(ctx, req); err != nil {
+			return ErrorResult(fmt.Sprintf("retrieving %s: %v", what, err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("The %s was sent to the chat; it will be deleted after %d minutes.", what, int(t.deleteAfter/time.Minute)))
+	}
+
+	code, err := t.hold(req)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	text := fmt.Sprintf("Send the %s here? It will be deleted after %d minutes.", what, int(t.deleteAfter/time.Minute))
+	if reason != "" {
+		text += "\nReason: " + reason
+	}
+	card := &bus.Card{
+		Title: "Secret request",
+		Text:  text,
+		Buttons: []bus.CardButton{
+			{Label: "Approve", Reply: "approve " + code},
+			{Label: "Deny", Reply: "deny " + code},
+		},
+	}
+	if err := t.promptCallback(ctx, req.channel, req.chatID, card); err != nil {
+		t.take(code, req.channel, req.chatID, req.senderID)
+		return ErrorResult(fmt.Sprintf("asking for approval: %v", err)).WithError(err)
+	}
+	t.audit("requested", req, nil)
+
+	return SilentResult(fmt.Sprintf("Approval for the %s requested from the owner. Once approved it is sent straight to the chat; do not ask for it again.", what))
+}
+
+// HandleReply answers an approval prompt if content is the owner's reply
+// to one in this chat. It returns a response for the chat and whether
+// content was such a reply.
+func (t *SecretsTool) HandleReply(ctx context.Context, channel, chatID, senderID, content string) (string, bool) {
+	verb, code, ok := strings.Cut(strings.TrimSpace(content), " ")
+	verb = strings.ToLower(verb)
+	if !ok || (verb != "approve" && verb != "deny") {
+		return "", false
+	}
+	req, mine := t.take(strings.TrimSpace(code), channel, chatID, senderID)
+	if req == nil {
+		return "", false
+	}
+	if !mine {
+		// Only the owner who asked may answer, in the chat they asked in;
+		// the request stays open for them
+		t.audit("rejected", req, fmt.Errorf("answered by %s:%s in %s", channel, senderID, chatID))
+		return "", false
+	}
+	if time.Now().After(req.expires) {
+		t.audit("expired", req, nil)
+		return "The secret request expired. Ask again if you still need it.", true
+	}
+
+	if verb == "deny" {
+		t.audit("denied by owner", req, nil)
+		return fmt.Sprintf("The %s was not sent.", req.what()), true
+	}
+	if err := t.deliver(ctx, req); err != nil {
+		return fmt.Sprintf("Could not retrieve the %s: %v", req.what(), err), true
+	}
+	return "", true
+}
+
+// checkRequest verifies the sender is an owner and the name is valid
+func (t *SecretsTool) checkRequest(req *secretRequest) error {
+	if !t.isOwner(req.channel, req.senderID) {
+		return fmt.Errorf("secrets are only available to the owner")
+	}
+	if req.channel == "" || req.chatID == "" {
+		return fmt.Errorf("no chat to send the secret to")
+	}
+	if !secretNamePattern.MatchString(req.name) || strings.Contains(req.name, "..") {
+		return fmt.Errorf("invalid secret name %q", req.name)
+	}
+	return nil
+}
+
+// isOwner reports whether senderID is an owner. Senders of the form
+// "id|username" match by id.
+func (t *SecretsTool) isOwner(channel, senderID string) bool {
+	if senderID == "" {
+		return false
+	}
+	id, _, _ := strings.Cut(senderID, "|")
+	for _, owner := range t.owners {
+		for _, candidate := range []string{senderID, id} {
+			if owner == candidate || owner == channel+":"+candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hold keeps req until it is answered and returns its approval code
+func (t *SecretsTool) hold(req *secretRequest) (string, error) {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating approval code: %w", err)
+	}
+	code := hex.EncodeToString(buf)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for c, pending := range t.pending {
+		if now.After(pending.expires) {
+			delete(t.pending, c)
+		}
+	}
+	req.expires = now.Add(secretApprovalTimeout)
+	t.pending[code] = req
+	return code, nil
+}
+
+// take returns the request with the given approval code and whether it was
+// made by senderID in chatID of channel. Only those requests are removed;
+// another sender cannot cancel one by answering it.
+func (t *SecretsTool) take(code, channel, chatID, senderID string) (*secretRequest, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	req := t.pending[code]
+	if req == nil || req.channel != channel || req.chatID != chatID || req.senderID != senderID {
+		return req, false
+	}
+	delete(t.pending, code)
+	return req, true
+}
+
+// deliver looks the secret up and sends it to the chat of the request
+func (t *SecretsTool) deliver(ctx context.Context, req *secretRequest) error {
+	lookupCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	secret, err := t.backend.Lookup(lookupCtx, req.name)
+	if err == nil && secret == "" {
+		err = fmt.Errorf("secret is empty")
+	}
+	if err == nil && req.totp {
+		// The code is generated on approval so it is fresh when it arrives
+		secret, err = GenerateTOTP(secret, time.Now())
+	}
+	if err == nil {
+		err = t.deliverCallback(ctx, req.channel, req.chatID, secret, t.deleteAfter)
+	}
+	if err != nil {
+		t.audit("failed", req, err)
+		return err
+	}
+	t.audit("delivered", req, nil)
+	return nil
+}
+
+func (t *SecretsTool) audit(outcome string, req *secretRequest, err error) {
+	fields := map[string]interface{}{
+		"outcome":   outcome,
+		"secret":    req.name,
+		"totp":      req.totp,
+		"backend":   t.backend.Name(),
+		"channel":   req.channel,
+		"chat_id":   req.chatID,
+		"sender_id": req.senderID,
+		"trace_id":  req.traceID,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.WarnCF("secrets", "Secret request", fields)
+		return
+	}
+	logger.InfoCF("secrets", "Secret request", fields)
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// SecretBackend looks secrets up by name in a password manager
+type SecretBackend interface {
+	Name() string
+	Lookup(ctx context.Context, name string) (string, error)
+}
+
+// SecretRunner executes a password manager command and returns its output
+type SecretRunner func(ctx context.Context, command string, args ...string) (string, error)
+
+// NewSecretBackend creates the backend of the given kind: "pass",
+// "bitwarden" or "vault". command overrides the pass or bw binary.
+func NewSecretBackend(kind, command, vaultAddr, vaultToken, vaultMount string) (SecretBackend, error) {
+	switch kind {
+	case "pass", "":
+		if command == "" {
+			command = "pass"
+		}
+		return &passBackend{command: command, runner: runSecretCommand}, nil
+	case "bitwarden":
+		if command == "" {
+			command = "bw"
+		}
+		return &bitwardenBackend{command: command, runner: runSecretCommand}, nil
+	case "vault":
+		if vaultAddr == "" || vaultToken == "" {
+			return nil, fmt.Errorf("vault backend needs vault_addr and vault_token")
+		}
+		if vaultMount == "" {
+			vaultMount = "secret"
+		}
+		return &vaultBackend{
+			addr:   strings.TrimRight(vaultAddr, "/"),
+			token:  vaultToken,
+			mount:  strings.Trim(vaultMount, "/"),
+			client: &http.Client{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q", kind)
+	}
+}
+
+// passBackend reads the first line of a pass entry, where pass keeps the password
+type passBackend struct {
+	command string
+	runner  SecretRunner
+}
+
+func (b *passBackend) Name() string {
+	return "pass"
+}
+
+func (b *passBackend) Lookup(ctx context.Context, name string) (string, error) {
+	out, err := b.runner(ctx, b.command, "show", name)
+	if err != nil {
+		return "", err
+	}
+	password, _, _ := strings.Cut(out, "\n")
+	return strings.TrimSpace(password), nil
+}
+
+// bitwardenBackend reads the password of a Bitwarden item with the bw CLI,
+// which must be unlocked (BW_SESSION set in the environment)
+type bitwardenBackend struct {
+	command string
+	runner  SecretRunner
+}
+
+func (b *bitwardenBackend) Name() string {
+	return "bitwarden"
+}
+
+func (b *bitwardenBackend) Lookup(ctx context.Context, name string) (string, error) {
+	out, err := b.runner(ctx, b.command, "get", "password", name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// vaultBackend reads a field of a HashiCorp Vault KV v2 secret. Names are
+// "path" or "path#field"; the field defaults to "password".
+type vaultBackend struct {
+	addr   string
+	token  string
+	mount  string
+	client *http.Client
+}
+
+func (b *vaultBackend) Name() string {
+	return "vault"
+}
+
+func (b *vaultBackend) Lookup(ctx context.Context, name string) (string, error) {
+	path, field, ok := strings.Cut(name, "#")
+	if !ok {
+		field = "password"
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s", b.addr, b.mount, strings.Join(segments, "/"))
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", b.token)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	value, ok := secret.Data.Data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	return value, nil
+}
+
+// runSecretCommand runs a password manager command. Failures carry the
+// first line of its error output.
+func runSecretCommand(ctx context.Context, command string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, command, args...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		if msg == "" {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %s", err, msg)
+	}
+	return out.String(), nil
+}
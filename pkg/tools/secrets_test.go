@@ -0,0 +1,230 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+type fakeSecretBackend struct {
+	secrets map[string]string
+	lookups []string
+}
+
+func (b *fakeSecretBackend) Name() string {
+	return "fake"
+}
+
+func (b *fakeSecretBackend) Lookup(ctx context.Context, name string) (string, error) {
+	b.lookups = append(b.lookups, name)
+	return b.secrets[name], nil
+}
+
+type sentSecret struct {
+	channel, chatID, content string
+	ttl                      time.Duration
+}
+
+func newTestSecretsTool(opts SecretsToolOptions) (*SecretsTool, *fakeSecretBackend, *[]*bus.Card, *[]sentSecret) {
+	backend := &fakeSecretBackend{secrets: map[string]string{"wifi/home": "hunter2"}}
+	opts.Backend = backend
+	if opts.Owners == nil {
+		opts.Owners = []string{"telegram:42"}
+	}
+	tool := NewSecretsTool(opts)
+	tool.SetContext("telegram", "chat1")
+	tool.SetSender("42|alice")
+
+	var prompts []*bus.Card
+	var sent []sentSecret
+	tool.SetPromptCallback(func(ctx context.Context, channel, chatID string, card *bus.Card) error {
+		prompts = append(prompts, card)
+		return nil
+	})
+	tool.SetDeliverCallback(func(ctx context.Context, channel, chatID, content string, ttl time.Duration) error {
+		sent = append(sent, sentSecret{channel, chatID, content, ttl})
+		return nil
+	})
+	return tool, backend, &prompts, &sent
+}
+
+func TestSecretsTool_ApproveDelivers(t *testing.T) {
+	tool, backend, prompts, sent := newTestSecretsTool(SecretsToolOptions{DeleteAfter: 2 * time.Minute})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"name": "wifi/home"})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "hunter2") {
+		t.Fatal("secret leaked into the tool result")
+	}
+	if len(*prompts) != 1 || len(backend.lookups) != 0 {
+		t.Fatalf("expected one prompt and no lookup before approval, got %d prompts, %d lookups", len(*prompts), len(backend.lookups))
+	}
+
+	approve := (*prompts)[0].Buttons[0].Reply
+	response, handled := tool.HandleReply(context.Background(), "telegram", "chat1", "42|alice", approve)
+	if !handled || response != "" {
+		t.Fatalf("HandleReply() = %q, %v", response, handled)
+	}
+	want := sentSecret{"telegram", "chat1", "hunter2", 2 * time.Minute}
+	if len(*sent) != 1 || (*sent)[0] != want {
+		t.Fatalf("sent = %+v, want %+v", *sent, want)
+	}
+
+	// Codes are single use
+	if _, handled := tool.HandleReply(context.Background(), "telegram", "chat1", "42|alice", approve); handled {
+		t.Error("approval code was accepted twice")
+	}
+}
+
+func TestSecretsTool_Deny(t *testing.T) {
+	tool, backend, prompts, sent := newTestSecretsTool(SecretsToolOptions{})
+
+	tool.Execute(context.Background(), map[string]interface{}{"name": "wifi/home"})
+	deny := (*prompts)[0].Buttons[1].Reply
+	response, handled := tool.HandleReply(context.Background(), "telegram", "chat1", "42|alice", deny)
+	if !handled || !strings.Contains(response, "not sent") {
+		t.Fatalf("HandleReply() = %q, %v", response, handled)
+	}
+	if len(backend.lookups) != 0 || len(*sent) != 0 {
+		t.Error("denied secret was looked up or sent")
+	}
+}
+
+func TestSecretsTool_ReplyFromOtherSender(t *testing.T) {
+	tool, _, prompts, sent := newTestSecretsTool(SecretsToolOptions{})
+
+	tool.Execute(context.Background(), map[string]interface{}{"name": "wifi/home"})
+	approve := (*prompts)[0].Buttons[0].Reply
+	if _, handled := tool.HandleReply(context.Background(), "telegram", "chat1", "99", approve); handled {
+		t.Error("approval from another sender was accepted")
+	}
+	if len(*sent) != 0 {
+		t.Error("secret sent on approval from another sender")
+	}
+
+	// The owner can still answer
+	if _, handled := tool.HandleReply(context.Background(), "telegram", "chat1", "42|alice", approve); !handled || len(*sent) != 1 {
+		t.Errorf("owner approval after another sender: handled %v, sent %d", handled, len(*sent))
+	}
+}
+
+func TestSecretsTool_OwnerOnly(t *testing.T) {
+	tests := []struct {
+		name   string
+		owners []string
+		sender string
+		allow  bool
+	}{
+		{"channel qualified", []string{"telegram:42"}, "42|alice", true},
+		{"bare id", []string{"42"}, "42", true},
+		{"other sender", []string{"telegram:42"}, "43", false},
+		{"other channel", []string{"discord:42"}, "42", false},
+		{"no owners", []string{}, "42", false},
+		{"no sender", []string{"telegram:42"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, _, prompts, _ := newTestSecretsTool(SecretsToolOptions{Owners: tt.owners})
+			tool.SetSender(tt.sender)
+
+			result := tool.Execute(context.Background(), map[string]interface{}{"name": "wifi/home"})
+			if result.IsError == tt.allow {
+				t.Errorf("IsError = %v, want %v (%s)", result.IsError, !tt.allow, result.ForLLM)
+			}
+			if got := len(*prompts) == 1; got != tt.allow {
+				t.Errorf("prompted = %v, want %v", got, tt.allow)
+			}
+		})
+	}
+}
+
+func TestSecretsTool_InvalidNames(t *testing.T) {
+	for _, name := range []string{"", "--help", "../etc/passwd", "wifi\nhome", strings.Repeat("a", 201)} {
+		tool, backend, prompts, _ := newTestSecretsTool(SecretsToolOptions{SkipApproval: true})
+		result := tool.Execute(context.Background(), map[string]interface{}{"name": name})
+		if !result.IsError {
+			t.Errorf("name %q was accepted", name)
+		}
+		if len(backend.lookups) != 0 || len(*prompts) != 0 {
+			t.Errorf("name %q was looked up", name)
+		}
+	}
+}
+
+func TestSecretsTool_SkipApproval(t *testing.T) {
+	tool, _, prompts, sent := newTestSecretsTool(SecretsToolOptions{SkipApproval: true})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"name": "wifi/home"})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if len(*prompts) != 0 || len(*sent) != 1 || (*sent)[0].content != "hunter2" {
+		t.Errorf("prompts = %d, sent = %+v", len(*prompts), *sent)
+	}
+	if (*sent)[0].ttl != 5*time.Minute {
+		t.Errorf("ttl = %v, want the 5 minute default", (*sent)[0].ttl)
+	}
+}
+
+func TestPassBackend(t *testing.T) {
+	var captured []string
+	backend := &passBackend{command: "pass", runner: func(ctx context.Context, command string, args ...string) (string, error) {
+		captured = append([]string{command}, args...)
+		return "s3cret\nusername: me\n", nil
+	}}
+
+	got, err := backend.Lookup(context.Background(), "wifi/home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "s3cret" {
+		t.Errorf("Lookup() = %q, want the first line", got)
+	}
+	if strings.Join(captured, " ") != "pass show wifi/home" {
+		t.Errorf("command = %v", captured)
+	}
+}
+
+func TestVaultBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/home/wifi" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"password":"hunter2","ssid":"home"}}}`))
+	}))
+	defer server.Close()
+
+	backend, err := NewSecretBackend("vault", "", server.URL+"/", "token", "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"home/wifi", "hunter2", false},
+		{"home/wifi#ssid", "home", false},
+		{"home/wifi#missing", "", true},
+		{"other", "", true},
+	}
+	for _, tt := range tests {
+		got, err := backend.Lookup(context.Background(), tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
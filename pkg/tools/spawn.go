@@ -3,12 +3,14 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sync"
 )
 
 type SpawnTool struct {
 	manager       *SubagentManager
 	originChannel string
 	originChatID  string
+	mu            sync.Mutex
 	callback      AsyncCallback // For async completion notification
 }
 
@@ -22,6 +24,8 @@ func NewSpawnTool(manager *SubagentManager) *SpawnTool {
 
 // SetCallback implements AsyncTool interface for async completion notification
 func (t *SpawnTool) SetCallback(cb AsyncCallback) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.callback = cb
 }
 
@@ -68,7 +72,11 @@ func (t *SpawnTool) Execute(ctx context.Context, args map[string]interface{}) *T
 	}
 
 	// Pass callback to manager for async completion notification
-	result, err := t.manager.Spawn(ctx, task, label, t.originChannel, t.originChatID, t.callback)
+	t.mu.Lock()
+	callback := t.callback
+	t.mu.Unlock()
+	originChannel, originChatID := turnChat(ctx, t.originChannel, t.originChatID)
+	result, err := t.manager.Spawn(ctx, task, label, originChannel, originChatID, callback)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to spawn subagent: %v", err))
 	}
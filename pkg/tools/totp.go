@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenerateTOTP returns the RFC 6238 code for seed at now. The seed is either
+// a base32 secret, which gets 6 digits every 30 seconds with SHA-1, or an
+// otpauth://totp/ URI as exported by authenticator apps and pass-otp.
+func GenerateTOTP(seed string, now time.Time) (string, error) {
+	secret := strings.TrimSpace(seed)
+	digits, period, newHash := 6, 30, sha1.New
+
+	if strings.HasPrefix(secret, "otpauth://") {
+		u, err := url.Parse(secret)
+		if err != nil {
+			return "", fmt.Errorf("invalid otpauth URI: %w", err)
+		}
+		if u.Host != "totp" {
+			return "", fmt.Errorf("unsupported OTP type %q", u.Host)
+		}
+		query := u.Query()
+		secret = query.Get("secret")
+		if v := query.Get("digits"); v != "" {
+			if digits, err = strconv.Atoi(v); err != nil || digits < 6 || digits > 10 {
+				return "", fmt.Errorf("invalid digits %q", v)
+			}
+		}
+		if v := query.Get("period"); v != "" {
+			if period, err = strconv.Atoi(v); err != nil || period <= 0 {
+				return "", fmt.Errorf("invalid period %q", v)
+			}
+		}
+		switch strings.ToUpper(query.Get("algorithm")) {
+		case "", "SHA1":
+		case "SHA256":
+			newHash = sha256.New
+		case "SHA512":
+			newHash = sha512.New
+		default:
+			return "", fmt.Errorf("unsupported algorithm %q", query.Get("algorithm"))
+		}
+	}
+
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, uint64(now.Unix())/uint64(period), digits, newHash), nil
+}
+
+// decodeTOTPSecret decodes a base32 secret, tolerating the spaces, lower
+// case and missing padding that authenticator setup pages use
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("seed is not a valid base32 secret")
+	}
+	return key, nil
+}
+
+// totpCode computes the HOTP value (RFC 4226) of key for counter
+func totpCode(key []byte, counter uint64, digits int, newHash func() hash.Hash) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(newHash, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint64(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, uint64(value)%mod)
+}
+
+// TOTPTool sends the owner a 2FA code generated from a seed kept in their
+// password manager. It shares the owner check, approval prompts, delivery
+// and audit log of the SecretsTool it wraps; the seed itself is never sent.
+type TOTPTool struct {
+	secrets *SecretsTool
+}
+
+// NewTOTPTool creates a new TOTPTool that looks seeds up through secrets
+func NewTOTPTool(secrets *SecretsTool) *TOTPTool {
+	return &TOTPTool{secrets: secrets}
+}
+
+func (t *TOTPTool) Name() string {
+	return "totp"
+}
+
+func (t *TOTPTool) Description() string {
+	return fmt.Sprintf("Send the owner a current 2FA (TOTP) code for an account whose seed is kept in their password manager (%s). "+
+		"The code goes directly to the chat after the owner approves and is deleted after %d minutes; you never see it, so do not repeat or guess it.",
+		t.secrets.backend.Name(), int(t.secrets.deleteAfter/time.Minute))
+}
+
+func (t *TOTPTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the entry holding the TOTP seed in the password manager (e.g. 'totp/github')",
+			},
+			"reason": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: why the code is needed, shown to the owner when asking for approval",
+			},
+		},
+		"required": []string{"name"},
+	}
+}
+
+// SetContext records the chat that codes are sent to
+func (t *TOTPTool) SetContext(channel, chatID string) {
+	t.secrets.SetContext(channel, chatID)
+}
+
+// SetSender records who sent the message being handled, which must be an owner
+func (t *TOTPTool) SetSender(senderID string) {
+	t.secrets.SetSender(senderID)
+}
+
+func (t *TOTPTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	name, _ := args["name"].(string)
+	reason, _ := args["reason"].(string)
+	return t.secrets.request(ctx, name, reason, true)
+}
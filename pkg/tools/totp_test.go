@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestGenerateTOTP_RFC6238Vectors(t *testing.T) {
+	sha1Seed := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	sha256Seed := base32.StdEncoding.EncodeToString([]byte("12345678901234567890123456789012"))
+
+	tests := []struct {
+		seed string
+		unix int64
+		want string
+	}{
+		{sha1Seed, 59, "287082"},
+		{sha1Seed, 1111111109, "081804"},
+		{"otpauth://totp/test?secret=" + sha1Seed + "&digits=8", 1234567890, "89005924"},
+		{"otpauth://totp/test?secret=" + sha256Seed + "&digits=8&algorithm=SHA256", 59, "46119246"},
+		{"otpauth://totp/test?secret=" + sha1Seed + "&digits=8&period=60", 119, "94287082"},
+	}
+	for _, tt := range tests {
+		got, err := GenerateTOTP(tt.seed, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Errorf("GenerateTOTP(%q, %d) error: %v", tt.seed, tt.unix, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("GenerateTOTP(%q, %d) = %s, want %s", tt.seed, tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateTOTP_LenientSecret(t *testing.T) {
+	want, err := GenerateTOTP("JBSWY3DPEHPK3PXP", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := GenerateTOTP(" jbsw y3dp ehpk 3pxp\n", time.Unix(1700000000, 0))
+	if err != nil || got != want {
+		t.Errorf("lenient secret = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestGenerateTOTP_Invalid(t *testing.T) {
+	for _, seed := range []string{
+		"",
+		"not base32!",
+		"otpauth://hotp/test?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/test?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+		"otpauth://totp/test?secret=JBSWY3DPEHPK3PXP&digits=3",
+	} {
+		if _, err := GenerateTOTP(seed, time.Now()); err == nil {
+			t.Errorf("GenerateTOTP(%q) succeeded, want error", seed)
+		}
+	}
+}
+
+func TestTOTPTool_ApproveDeliversCode(t *testing.T) {
+	secrets, backend, prompts, sent := newTestSecretsTool(SecretsToolOptions{})
+	backend.secrets["totp/github"] = "JBSWY3DPEHPK3PXP"
+	tool := NewTOTPTool(secrets)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"name": "totp/github"})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if len(*prompts) != 1 || len(backend.lookups) != 0 {
+		t.Fatalf("expected one prompt and no lookup, got %d prompts, %d lookups", len(*prompts), len(backend.lookups))
+	}
+
+	reply := (*prompts)[0].Buttons[0].Reply
+	if _, handled := secrets.HandleReply(context.Background(), "telegram", "chat1", "42|alice", reply); !handled {
+		t.Fatal("approval not handled")
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("expected one delivery, got %d", len(*sent))
+	}
+	code := (*sent)[0].content
+	if len(code) != 6 || code == "JBSWY3DPEHPK3PXP" {
+		t.Errorf("delivered %q, want a 6 digit code", code)
+	}
+}
+
+func TestTOTPTool_NonOwnerDenied(t *testing.T) {
+	secrets, backend, prompts, _ := newTestSecretsTool(SecretsToolOptions{})
+	secrets.SetSender("99|mallory")
+	tool := NewTOTPTool(secrets)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"name": "totp/github"})
+	if !result.IsError {
+		t.Fatal("expected non-owner to be denied")
+	}
+	if len(*prompts) != 0 || len(backend.lookups) != 0 {
+		t.Error("non-owner request should not prompt or look anything up")
+	}
+}
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Turn is the agent turn a tool call runs in: the chat it answers and the
+// sender of the message. Turns of different chats run concurrently, so
+// contextual tools read the chat from ctx rather than from what SetContext
+// last stored.
+type Turn struct {
+	Channel  string
+	ChatID   string
+	SenderID string
+
+	messageSent atomic.Bool
+}
+
+type turnKey struct{}
+
+// WithTurn returns ctx carrying turn
+func WithTurn(ctx context.Context, turn *Turn) context.Context {
+	return context.WithValue(ctx, turnKey{}, turn)
+}
+
+// TurnFrom returns the turn ctx carries, or nil
+func TurnFrom(ctx context.Context) *Turn {
+	turn, _ := ctx.Value(turnKey{}).(*Turn)
+	return turn
+}
+
+// MessageSent reports whether the message tool sent a message in the turn
+func (t *Turn) MessageSent() bool {
+	return t.messageSent.Load()
+}
+
+// turnChat returns the chat of the turn in ctx, or channel and chatID,
+// those set by SetContext, outside a turn
+func turnChat(ctx context.Context, channel, chatID string) (string, string) {
+	if turn := TurnFrom(ctx); turn != nil && turn.Channel != "" && turn.ChatID != "" {
+		return turn.Channel, turn.ChatID
+	}
+	return channel, chatID
+}
+
+// turnSender returns the sender of the turn in ctx, or senderID outside a
+// turn
+func turnSender(ctx context.Context, senderID string) string {
+	if turn := TurnFrom(ctx); turn != nil && turn.SenderID != "" {
+		return turn.SenderID
+	}
+	return senderID
+}
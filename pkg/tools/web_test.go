@@ -254,3 +254,27 @@ func TestWebTool_WebFetch_MissingDomain(t *testing.T) {
 		t.Errorf("Expected domain error message, got ForLLM: %s", result.ForLLM)
 	}
 }
+
+// TestWebTool_WebFetch_Proxy verifies fetches go through the configured proxy
+func TestWebTool_WebFetch_Proxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	tool := NewWebFetchTool(50000)
+	tool.SetProxy(proxy.URL)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"url": "http://example.com/page",
+	})
+
+	if result.IsError || !strings.Contains(result.ForUser, "via proxy") {
+		t.Fatalf("Expected the proxy's response, got: %s", result.ForLLM)
+	}
+	if requested != "http://example.com/page" {
+		t.Errorf("Expected the proxy to get the full URL, got %q", requested)
+	}
+}
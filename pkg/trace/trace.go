@@ -0,0 +1,68 @@
+// Package trace carries per-message trace IDs, so a single message can be
+// followed through channel, agent, provider, tool and outbound logs.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// Header is the HTTP header that carries trace IDs in webhook requests,
+// webhook responses and provider requests
+const Header = "X-Trace-ID"
+
+// validID matches trace IDs accepted from callers
+var validID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type contextKey struct{}
+
+// NewID returns a random trace ID
+func NewID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "untraced"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// FromRequest returns the trace ID sent by the caller in the Header or
+// X-Request-ID header, or a new one when neither holds a usable ID
+func FromRequest(r *http.Request) string {
+	for _, name := range []string{Header, "X-Request-ID"} {
+		if id := r.Header.Get(name); validID.MatchString(id) {
+			return id
+		}
+	}
+	return NewID()
+}
+
+// WithID returns a copy of ctx carrying id
+func WithID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// ID returns the trace ID carried by ctx, or "" if there is none
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Fields adds the trace ID carried by ctx to log fields. It creates the map
+// when fields is nil.
+func Fields(ctx context.Context, fields map[string]interface{}) map[string]interface{} {
+	id := ID(ctx)
+	if id == "" {
+		return fields
+	}
+	if fields == nil {
+		fields = make(map[string]interface{}, 1)
+	}
+	fields["trace_id"] = id
+	return fields
+}
@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	if ID(ctx) != "" {
+		t.Fatal("empty context should carry no trace ID")
+	}
+	if WithID(ctx, "") != ctx {
+		t.Error("empty ID should leave the context unchanged")
+	}
+
+	ctx = WithID(ctx, "abc123")
+	if got := ID(ctx); got != "abc123" {
+		t.Errorf("ID() = %q, want abc123", got)
+	}
+
+	fields := Fields(ctx, nil)
+	if fields["trace_id"] != "abc123" {
+		t.Errorf("Fields() = %v", fields)
+	}
+	if Fields(context.Background(), nil) != nil {
+		t.Error("Fields without a trace ID should not create a map")
+	}
+}
+
+func TestNewIDUnique(t *testing.T) {
+	a, b := NewID(), NewID()
+	if len(a) != 16 || a == b {
+		t.Errorf("NewID() = %q, %q", a, b)
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("X-Request-ID", "req-42")
+	if got := FromRequest(r); got != "req-42" {
+		t.Errorf("FromRequest() = %q, want req-42", got)
+	}
+
+	r.Header.Set(Header, "trace.7")
+	if got := FromRequest(r); got != "trace.7" {
+		t.Errorf("FromRequest() = %q, want trace.7", got)
+	}
+
+	bad := httptest.NewRequest("POST", "/", nil)
+	bad.Header.Set(Header, "has spaces\nand newlines")
+	if got := FromRequest(bad); got == "has spaces\nand newlines" || len(got) != 16 {
+		t.Errorf("FromRequest() accepted an invalid ID: %q", got)
+	}
+}
@@ -0,0 +1,345 @@
+// Package tunnel runs a tunnel client (cloudflared, ngrok or ssh) next to
+// the gateway, so platforms can deliver webhooks to a device behind NAT. The
+// client is restarted when it exits, and the public URL it announces is
+// passed on whenever it changes.
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Providers
+const (
+	ProviderCloudflare = "cloudflare"
+	ProviderNgrok      = "ngrok"
+	ProviderSSH        = "ssh"
+)
+
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+	// stableAfter is how long a client must run for its next exit to be
+	// retried at once again
+	stableAfter = time.Minute
+	// stopGrace is how long a client gets to close after an interrupt
+	stopGrace = 5 * time.Second
+)
+
+// quickTunnelURL is announced by cloudflared for quick tunnels
+var quickTunnelURL = regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
+
+// Tunnel supervises a tunnel client process
+type Tunnel struct {
+	provider string
+	command  string
+	args     []string
+	env      []string // Added to the environment; keeps tokens off the command line
+	// urlFrom returns the public URL announced by a line of the client's
+	// output, or ""
+	urlFrom func(line string) string
+	// fixedURL is known upfront and ready as soon as the client runs
+	fixedURL string
+
+	minDelay time.Duration
+
+	mu       sync.Mutex
+	url      string
+	ready    chan struct{} // Closed once there is a URL
+	onChange []func(string)
+	notifyMu sync.Mutex // Held while OnChange functions run
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// New prepares a tunnel to the gateway at localURL, e.g.
+// http://127.0.0.1:18790
+func New(cfg config.TunnelConfig, localURL string) (*Tunnel, error) {
+	local, err := url.Parse(localURL)
+	if err != nil || local.Host == "" {
+		return nil, fmt.Errorf("invalid local URL %q", localURL)
+	}
+	t := &Tunnel{
+		provider: cfg.Provider,
+		minDelay: minRestartDelay,
+		ready:    make(chan struct{}),
+	}
+
+	var binary string
+	switch cfg.Provider {
+	case ProviderCloudflare:
+		binary = "cloudflared"
+		t.args = []string{"tunnel", "--no-autoupdate"}
+		if cfg.Token != "" {
+			// A named tunnel; the hostname's route to the gateway is set
+			// up in the Cloudflare dashboard
+			t.args = append(t.args, "run")
+			t.env = []string{"TUNNEL_TOKEN=" + cfg.Token}
+			public := "https://" + cfg.Hostname
+			t.urlFrom = func(line string) string {
+				if strings.Contains(line, "Registered tunnel connection") {
+					return public
+				}
+				return ""
+			}
+		} else {
+			t.args = append(t.args, "--url", localURL)
+			if local.Scheme == "https" {
+				// The gateway's certificate is for its public name
+				t.args = append(t.args, "--no-tls-verify")
+			}
+			t.urlFrom = func(line string) string {
+				return quickTunnelURL.FindString(line)
+			}
+		}
+	case ProviderNgrok:
+		binary = "ngrok"
+		t.args = []string{"http", localURL, "--log", "stdout", "--log-format", "json"}
+		if cfg.Hostname != "" {
+			t.args = append(t.args, "--url", cfg.Hostname)
+		}
+		if cfg.Token != "" {
+			t.env = []string{"NGROK_AUTHTOKEN=" + cfg.Token}
+		}
+		t.urlFrom = ngrokURL
+	case ProviderSSH:
+		binary = "ssh"
+		if cfg.SSH.Host == "" || cfg.SSH.RemotePort == 0 || cfg.SSH.PublicURL == "" {
+			return nil, fmt.Errorf("ssh tunnel needs host, remote_port and public_url")
+		}
+		t.args = sshArgs(cfg.SSH, local)
+		t.fixedURL = strings.TrimSuffix(cfg.SSH.PublicURL, "/")
+	default:
+		return nil, fmt.Errorf("unknown tunnel provider %q", cfg.Provider)
+	}
+
+	if cfg.Command != "" {
+		binary = cfg.Command
+	}
+	t.command, err = exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("%s tunnel client not found (install it or set tunnel.command): %w", cfg.Provider, err)
+	}
+	return t, nil
+}
+
+// sshArgs forwards the server's remote port to the gateway. ssh exits when
+// the port cannot be forwarded, so a taken port is retried like a dropped
+// connection.
+func sshArgs(cfg config.TunnelSSHConfig, local *url.URL) []string {
+	port := local.Port()
+	if port == "" {
+		port = "80"
+		if local.Scheme == "https" {
+			port = "443"
+		}
+	}
+	forward := strconv.Itoa(cfg.RemotePort) + ":" + net.JoinHostPort(local.Hostname(), port)
+	if cfg.BindAddress != "" {
+		forward = net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.RemotePort)) + ":" + net.JoinHostPort(local.Hostname(), port)
+	}
+	args := []string{
+		"-N", "-T",
+		"-o", "BatchMode=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30",
+		"-o", "ServerAliveCountMax=3",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-R", forward,
+	}
+	if cfg.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(cfg.Port))
+	}
+	if cfg.IdentityFile != "" {
+		args = append(args, "-i", cfg.IdentityFile)
+	}
+	target := cfg.Host
+	if cfg.User != "" {
+		target = cfg.User + "@" + cfg.Host
+	}
+	return append(args, target)
+}
+
+// ngrokURL reads the URL from ngrok's "started tunnel" log line
+func ngrokURL(line string) string {
+	var entry struct {
+		Msg string `json:"msg"`
+		URL string `json:"url"`
+	}
+	if json.Unmarshal([]byte(line), &entry) != nil || entry.Msg != "started tunnel" {
+		return ""
+	}
+	if !strings.HasPrefix(entry.URL, "https://") {
+		return ""
+	}
+	return entry.URL
+}
+
+// OnChange calls fn with the public URL each time it changes, including
+// when it is first known. Calls do not overlap, and a URL replaced before
+// its turn is skipped.
+func (t *Tunnel) OnChange(fn func(publicURL string)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onChange = append(t.onChange, fn)
+}
+
+// Start runs the client until Stop, restarting it when it exits
+func (t *Tunnel) Start(ctx context.Context) {
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.done = make(chan struct{})
+	go t.run(ctx)
+}
+
+// Stop ends the client and waits for it to exit
+func (t *Tunnel) Stop() {
+	if t.cancel == nil {
+		return
+	}
+	t.cancel()
+	<-t.done
+}
+
+// URL returns the public URL, or "" until the client announced it
+func (t *Tunnel) URL() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.url
+}
+
+// WaitURL waits for the public URL
+func (t *Tunnel) WaitURL(ctx context.Context) (string, error) {
+	select {
+	case <-t.ready:
+		return t.URL(), nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("%s tunnel did not come up: %w", t.provider, ctx.Err())
+	}
+}
+
+func (t *Tunnel) run(ctx context.Context) {
+	defer close(t.done)
+	delay := t.minDelay
+	for {
+		started := time.Now()
+		err := t.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > stableAfter {
+			delay = t.minDelay
+		}
+		logger.WarnCF("tunnel", "Tunnel client exited, restarting", map[string]interface{}{
+			"provider": t.provider,
+			"error":    err.Error(),
+			"retry_in": delay.String(),
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+// runOnce runs the client until it exits, watching its output for the
+// public URL
+func (t *Tunnel) runOnce(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, t.command, t.args...)
+	cmd.Env = append(os.Environ(), t.env...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = stopGrace
+	output, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	if err := cmd.Start(); err != nil {
+		writer.Close()
+		return err
+	}
+	logger.InfoCF("tunnel", "Tunnel client started", map[string]interface{}{
+		"provider": t.provider,
+		"pid":      cmd.Process.Pid,
+	})
+	if t.fixedURL != "" {
+		t.setURL(t.fixedURL)
+	}
+
+	scanned := make(chan struct{})
+	go func() {
+		defer close(scanned)
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			line := scanner.Text()
+			logger.DebugCF("tunnel", line, map[string]interface{}{"provider": t.provider})
+			if t.urlFrom != nil {
+				if u := t.urlFrom(line); u != "" {
+					t.setURL(u)
+				}
+			}
+		}
+		// Keep draining so the client never blocks on a full pipe
+		io.Copy(io.Discard, output)
+	}()
+
+	err := cmd.Wait()
+	writer.Close()
+	<-scanned
+	if err == nil {
+		err = fmt.Errorf("exited")
+	}
+	return err
+}
+
+// setURL records the public URL and tells the OnChange functions about a
+// new one
+func (t *Tunnel) setURL(publicURL string) {
+	t.mu.Lock()
+	if publicURL == t.url {
+		t.mu.Unlock()
+		return
+	}
+	first := t.url == ""
+	t.url = publicURL
+	callbacks := t.onChange
+	t.mu.Unlock()
+
+	if first {
+		close(t.ready)
+	}
+	logger.InfoCF("tunnel", "Tunnel URL", map[string]interface{}{
+		"provider": t.provider,
+		"url":      publicURL,
+	})
+	// Registering the URL may take a while, during which the client's
+	// output must still be read
+	go func() {
+		t.notifyMu.Lock()
+		defer t.notifyMu.Unlock()
+		if t.URL() != publicURL {
+			// Already replaced by a newer one
+			return
+		}
+		for _, fn := range callbacks {
+			fn(publicURL)
+		}
+	}()
+}
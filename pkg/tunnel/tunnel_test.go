@@ -0,0 +1,149 @@
+package tunnel
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeClient writes a shell script standing in for a tunnel client
+func fakeClient(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "client")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestQuickTunnelRestarts(t *testing.T) {
+	// Each run announces a new URL, like quick tunnels do, and the first
+	// run exits
+	runs := filepath.Join(t.TempDir(), "runs")
+	client := fakeClient(t, `echo x >> `+runs+`
+n=$(wc -l < `+runs+` | tr -d ' ')
+echo "INF |  https://run-$n.trycloudflare.com  |" >&2
+[ "$n" -gt 1 ] && exec sleep 30
+exit 0
+`)
+	tun, err := New(config.TunnelConfig{Provider: ProviderCloudflare, Command: client}, "http://127.0.0.1:18790")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tun.minDelay = 10 * time.Millisecond
+
+	changed := make(chan string, 4)
+	tun.OnChange(func(publicURL string) {
+		changed <- publicURL
+	})
+	tun.Start(context.Background())
+	defer tun.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := tun.WaitURL(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case publicURL := <-changed:
+			if publicURL == "https://run-2.trycloudflare.com" {
+				if tun.URL() != publicURL {
+					t.Errorf("URL() = %q, want %q", tun.URL(), publicURL)
+				}
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("URL of the restarted client not seen")
+		}
+	}
+}
+
+func TestNamedTunnel(t *testing.T) {
+	// The token is passed in the environment, never as an argument
+	client := fakeClient(t, `[ "$TUNNEL_TOKEN" = secret ] || exit 1
+case "$*" in *secret*) exit 1 ;; esac
+echo "INF Registered tunnel connection connIndex=0" >&2
+exec sleep 30
+`)
+	tun, err := New(config.TunnelConfig{Provider: ProviderCloudflare, Command: client, Token: "secret", Hostname: "bot.example.org"}, "http://127.0.0.1:18790")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tun.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	publicURL, err := tun.WaitURL(ctx)
+	if err != nil || publicURL != "https://bot.example.org" {
+		t.Fatalf("WaitURL = %q, %v", publicURL, err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		tun.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(stopGrace + time.Second):
+		t.Fatal("Stop did not end the client")
+	}
+}
+
+func TestNgrokURL(t *testing.T) {
+	for line, want := range map[string]string{
+		`{"lvl":"info","msg":"started tunnel","obj":"tunnels","name":"command_line","addr":"http://127.0.0.1:18790","url":"https://a1b2.ngrok-free.app"}`: "https://a1b2.ngrok-free.app",
+		`{"lvl":"info","msg":"client session established","obj":"tunnels.session"}`:                                                                       "",
+		`t=2026-01-02T15:04:05 lvl=info msg="started tunnel" url=https://a1b2.ngrok-free.app`:                                                             "",
+	} {
+		if got := ngrokURL(line); got != want {
+			t.Errorf("ngrokURL(%s) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	local, _ := url.Parse("http://127.0.0.1:18790")
+	args := sshArgs(config.TunnelSSHConfig{
+		Host:         "relay.example.org",
+		Port:         2222,
+		User:         "tunnel",
+		IdentityFile: "/keys/id_ed25519",
+		RemotePort:   8080,
+		BindAddress:  "0.0.0.0",
+	}, local)
+	joined := strings.Join(args, " ")
+	for _, want := range []string{"-R 0.0.0.0:8080:127.0.0.1:18790", "-p 2222", "-i /keys/id_ed25519", "ExitOnForwardFailure=yes"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing %q in %q", want, joined)
+		}
+	}
+	if args[len(args)-1] != "tunnel@relay.example.org" {
+		t.Errorf("unexpected target in %q", joined)
+	}
+
+	args = sshArgs(config.TunnelSSHConfig{Host: "relay.example.org", RemotePort: 8080}, local)
+	if !slices.Contains(args, "8080:127.0.0.1:18790") || slices.Contains(args, "-p") {
+		t.Errorf("unexpected args %q", args)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for name, cfg := range map[string]config.TunnelConfig{
+		"unknown provider": {Provider: "wireguard"},
+		"missing client":   {Provider: ProviderNgrok, Command: filepath.Join(t.TempDir(), "ngrok")},
+		"ssh without url":  {Provider: ProviderSSH, SSH: config.TunnelSSHConfig{Host: "relay.example.org", RemotePort: 8080}},
+	} {
+		if _, err := New(cfg, "http://127.0.0.1:18790"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
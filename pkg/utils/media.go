@@ -14,7 +14,7 @@ import (
 
 // IsAudioFile checks if a file is an audio file based on its filename extension and content type.
 func IsAudioFile(filename, contentType string) bool {
-	audioExtensions := []string{".mp3", ".wav", ".ogg", ".m4a", ".flac", ".aac", ".wma"}
+	audioExtensions := []string{".mp3", ".wav", ".ogg", ".opus", ".m4a", ".flac", ".aac", ".wma"}
 	audioTypes := []string{"audio/", "application/ogg", "application/x-ogg"}
 
 	for _, ext := range audioExtensions {
@@ -51,10 +51,11 @@ type DownloadOptions struct {
 	Timeout      time.Duration
 	ExtraHeaders map[string]string
 	LoggerPrefix string
+	Dir          string // Directory to save to; empty uses a temp directory
 }
 
-// DownloadFile downloads a file from URL to a local temp directory.
-// Returns the local file path or empty string on error.
+// DownloadFile downloads a file from URL to opts.Dir or a local temp
+// directory. Returns the local file path or empty string on error.
 func DownloadFile(url, filename string, opts DownloadOptions) string {
 	// Set defaults
 	if opts.Timeout == 0 {
@@ -64,7 +65,10 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		opts.LoggerPrefix = "utils"
 	}
 
-	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	mediaDir := opts.Dir
+	if mediaDir == "" {
+		mediaDir = filepath.Join(os.TempDir(), "picoclaw_media")
+	}
 	if err := os.MkdirAll(mediaDir, 0700); err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to create media directory", map[string]interface{}{
 			"error": err.Error(),
@@ -0,0 +1,235 @@
+// Package webhooksig signs and verifies the webhooks picoclaw sends, so that
+// receivers can check a request came from picoclaw and was not replayed. It
+// has no dependencies outside the standard library and can be imported by
+// third-party receivers.
+//
+// A request carries a header such as
+//
+//	X-PicoClaw-Signature: t=1767225600,kid=k1,v1=5d41402abc4b2a76...
+//
+// where v1 is the hex HMAC-SHA256 of "<t>.<body>" under the key named kid.
+// Keys are "id:secret" entries. The first key of a set signs and every key
+// verifies, so a new key can be rolled out before the old one is retired.
+package webhooksig
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header is the request header holding the signature
+const Header = "X-PicoClaw-Signature"
+
+// DefaultTolerance is how far the signing time of a request may be from the
+// receiver's clock
+const DefaultTolerance = 5 * time.Minute
+
+// maxBodySize bounds the request bodies read by VerifyRequest
+const maxBodySize = 10 << 20
+
+var (
+	// ErrNoSignature means the request carries no signature header
+	ErrNoSignature = errors.New("webhook signature missing")
+	// ErrInvalidSignature means no key produces the signature
+	ErrInvalidSignature = errors.New("webhook signature invalid")
+	// ErrExpired means the request was signed outside the tolerance, which
+	// usually is a replay
+	ErrExpired = errors.New("webhook signature expired")
+)
+
+// Key is a signing secret and the identifier sent with signatures
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// String returns the key as an "id:secret" entry
+func (k Key) String() string {
+	return k.ID + ":" + string(k.Secret)
+}
+
+// GenerateKey creates a key with a random 256-bit secret. An empty id is
+// derived from the current time, so rotated keys sort by age.
+func GenerateKey(id string) (Key, error) {
+	if id == "" {
+		id = "k" + time.Now().UTC().Format("20060102150405")
+	}
+	if strings.ContainsAny(id, ":,= \t\n") {
+		return Key{}, fmt.Errorf("key id %q must not contain ':', ',', '=' or spaces", id)
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return Key{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return Key{ID: id, Secret: []byte(base64.RawURLEncoding.EncodeToString(raw))}, nil
+}
+
+// ParseKeys parses "id:secret" entries; blank entries are skipped
+func ParseKeys(entries []string) ([]Key, error) {
+	keys := make([]Key, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("webhook key %q is not an id:secret entry", id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate webhook key id %q", id)
+		}
+		seen[id] = true
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+// ReadKeyFile reads keys from a file with one "id:secret" entry per line.
+// Blank lines and lines starting with # are ignored.
+func ReadKeyFile(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return ParseKeys(lines)
+}
+
+// WriteKeyFile writes keys to a file readable by its owner only, replacing
+// it atomically
+func WriteKeyFile(path string, keys []Key) error {
+	var b strings.Builder
+	b.WriteString("# Webhook signing keys, newest first. The first key signs.\n")
+	for _, key := range keys {
+		b.WriteString(key.String())
+		b.WriteString("\n")
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return nil
+}
+
+// Rotate puts key first, so it signs from now on, and keeps up to keep of
+// the previous keys so receivers still accept requests signed before they
+// picked up the new key
+func Rotate(keys []Key, key Key, keep int) []Key {
+	rotated := []Key{key}
+	for _, old := range keys {
+		if len(rotated) > keep {
+			break
+		}
+		if old.ID != key.ID {
+			rotated = append(rotated, old)
+		}
+	}
+	return rotated
+}
+
+// Sign returns the signature header value for body sent at t
+func Sign(key Key, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,kid=%s,v1=%s", ts, key.ID, hex.EncodeToString(mac(key.Secret, ts, body)))
+}
+
+// SignRequest sets the signature header of a request with the given body
+func SignRequest(r *http.Request, key Key, body []byte) {
+	r.Header.Set(Header, Sign(key, body, time.Now()))
+}
+
+// Verify checks a signature header value against body. The key named in the
+// header is used when present, otherwise every key is tried. A tolerance of
+// zero uses DefaultTolerance.
+func Verify(keys []Key, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	if header == "" {
+		return ErrNoSignature
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+
+	var ts, kid string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			ts = value
+		case "kid":
+			kid = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return ErrExpired
+	}
+
+	for _, key := range keys {
+		if kid != "" && key.ID != kid {
+			continue
+		}
+		expected := mac(key.Secret, ts, body)
+		for _, sig := range sigs {
+			if hmac.Equal(sig, expected) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// VerifyRequest reads and verifies the body of a request and returns it. The
+// body is restored, so handlers can read it again.
+func VerifyRequest(r *http.Request, keys []Key, tolerance time.Duration) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := Verify(keys, r.Header.Get(Header), body, time.Now(), tolerance); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func mac(secret []byte, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
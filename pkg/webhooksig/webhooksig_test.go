@@ -0,0 +1,121 @@
+package webhooksig
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	oldKey := Key{ID: "k1", Secret: []byte("old-secret")}
+	newKey := Key{ID: "k2", Secret: []byte("new-secret")}
+	body := []byte(`{"event":"reply"}`)
+	now := time.Unix(1767225600, 0)
+
+	header := Sign(oldKey, body, now)
+	if !strings.HasPrefix(header, "t=1767225600,kid=k1,v1=") {
+		t.Errorf("unexpected header %q", header)
+	}
+
+	// A receiver that already has the new key still accepts the old one
+	keys := []Key{newKey, oldKey}
+	if err := Verify(keys, header, body, now.Add(time.Minute), 0); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		keys   []Key
+		header string
+		body   []byte
+		now    time.Time
+		want   error
+	}{
+		{"missing", keys, "", body, now, ErrNoSignature},
+		{"tampered body", keys, header, []byte(`{"event":"other"}`), now, ErrInvalidSignature},
+		{"retired key", []Key{newKey}, header, body, now, ErrInvalidSignature},
+		{"replayed", keys, header, body, now.Add(10 * time.Minute), ErrExpired},
+		{"from the future", keys, header, body, now.Add(-10 * time.Minute), ErrExpired},
+		{"garbage", keys, "v1=zz", body, now, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.keys, tt.header, tt.body, tt.now, 0); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Without a key ID every key is tried
+	unnamed := strings.Replace(header, "kid=k1,", "", 1)
+	if err := Verify(keys, unnamed, body, now, 0); err != nil {
+		t.Errorf("Verify() without kid = %v", err)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	key := Key{ID: "k1", Secret: []byte("secret")}
+	body := `{"event":"reply"}`
+	req := httptest.NewRequest("POST", "/hook", strings.NewReader(body))
+	SignRequest(req, key, []byte(body))
+
+	got, err := VerifyRequest(req, []Key{key}, 0)
+	if err != nil || string(got) != body {
+		t.Fatalf("VerifyRequest() = %q, %v", got, err)
+	}
+	again, _ := io.ReadAll(req.Body)
+	if string(again) != body {
+		t.Errorf("the body should be readable again, got %q", again)
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	a, err := GenerateKey("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateKey("b")
+	if a.ID != "a" || len(a.Secret) != 43 || string(a.Secret) == string(b.Secret) {
+		t.Errorf("unexpected keys %q and %q", a, b)
+	}
+	if k, _ := GenerateKey(""); !strings.HasPrefix(k.ID, "k") {
+		t.Errorf("derived id = %q", k.ID)
+	}
+	if _, err := GenerateKey("bad:id"); err == nil {
+		t.Error("ids with ':' should be rejected")
+	}
+}
+
+func TestRotateKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhook.keys")
+	k1, k2, k3 := Key{ID: "k1", Secret: []byte("s1")}, Key{ID: "k2", Secret: []byte("s2")}, Key{ID: "k3", Secret: []byte("s3")}
+
+	keys := Rotate(Rotate(nil, k1, 1), k2, 1)
+	if err := WriteKeyFile(path, keys); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	read, err := ReadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := Rotate(read, k3, 1)
+	if len(rotated) != 2 || rotated[0].ID != "k3" || rotated[1].ID != "k2" {
+		t.Errorf("Rotate() = %v, want k3 then k2", rotated)
+	}
+
+	if _, err := ParseKeys([]string{"k1:a", "k1:b"}); err == nil {
+		t.Error("duplicate ids should be rejected")
+	}
+	if _, err := ParseKeys([]string{"no-secret"}); err == nil {
+		t.Error("entries without a secret should be rejected")
+	}
+}